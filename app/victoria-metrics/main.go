@@ -51,13 +51,18 @@ func main() {
 
 	logger.Infof("starting VictoriaMetrics at %q...", *httpListenAddr)
 	startTime := time.Now()
+	// Start http server before the initialization of the storage, so /health page could be used for liveness checks
+	// while /ready page returns non-OK responses until the initialization is complete.
+	httpserver.SetReady(false)
+	go httpserver.Serve(*httpListenAddr, requestHandler)
+
 	storage.SetDedupInterval(*minScrapeInterval)
 	vmstorage.Init(promql.ResetRollupResultCacheIfNeeded)
 	vmselect.Init()
 	vminsert.Init()
 	startSelfScraper()
 
-	go httpserver.Serve(*httpListenAddr, requestHandler)
+	httpserver.SetReady(true)
 	logger.Infof("started VictoriaMetrics in %.3f seconds", time.Since(startTime).Seconds())
 
 	sig := procutil.WaitForSigterm()
@@ -54,8 +54,12 @@ var (
 	opentsdbHTTPListenAddr = flag.String("opentsdbHTTPListenAddr", "", "TCP address to listen for OpentTSDB HTTP put requests. Usually :4242 must be set. Doesn't work if empty")
 	configAuthKey          = flag.String("configAuthKey", "", "Authorization key for accessing /config page. It must be passed via authKey query arg")
 	dryRun                 = flag.Bool("dryRun", false, "Whether to check only config files without running vmagent. The following files are checked: "+
-		"-promscrape.config, -remoteWrite.relabelConfig, -remoteWrite.urlRelabelConfig . "+
+		"-promscrape.config, -remoteWrite.relabelConfig, -remoteWrite.urlRelabelConfig, -remoteWrite.routingConfig . "+
 		"Unknown config entries aren't allowed in -promscrape.config by default. This can be changed by passing -promscrape.config.strictParse=false command-line flag")
+	maxImportRequestSize = flagutil.NewBytes("import.maxRequestSize", 0, "The maximum size in bytes of a single request to /api/v1/import, /api/v1/import/csv, /api/v1/import/prometheus and /api/v1/import/native. "+
+		"Bigger requests are rejected with '413 Request Entity Too Large' response. There is no limit if the value is set to 0")
+	maxInfluxRequestSize = flagutil.NewBytes("influx.maxRequestSize", 0, "The maximum size in bytes of a single InfluxDB line protocol request sent over HTTP. "+
+		"Bigger requests are rejected with '413 Request Entity Too Large' response. There is no limit if the value is set to 0")
 )
 
 var (
@@ -91,6 +95,9 @@ func main() {
 		if err := remotewrite.CheckRelabelConfigs(); err != nil {
 			logger.Fatalf("error when checking relabel configs: %s", err)
 		}
+		if err := remotewrite.CheckRoutingConfig(); err != nil {
+			logger.Fatalf("error when checking routing config: %s", err)
+		}
 		if err := promscrape.CheckConfig(); err != nil {
 			logger.Fatalf("error when checking -promscrape.config: %s", err)
 		}
@@ -178,6 +185,7 @@ func requestHandler(w http.ResponseWriter, r *http.Request) bool {
 	}
 
 	path := strings.Replace(r.URL.Path, "//", "/", -1)
+	httpserver.LimitRequestBody(r, getMaxRequestBodySize(path))
 	switch path {
 	case "/api/v1/write":
 		prometheusWriteRequests.Inc()
@@ -305,7 +313,7 @@ func requestHandler(w http.ResponseWriter, r *http.Request) bool {
 		promscrapeStatusConfigRequests.Inc()
 		w.Header().Set("Content-Type", "application/json")
 		var bb bytesutil.ByteBuffer
-		promscrape.WriteConfigData(&bb)
+		promscrape.WriteEffectiveConfigData(&bb)
 		fmt.Fprintf(w, `{"status":"success","data":{"yaml":%q}}`, bb.B)
 		return true
 	case "/api/v1/targets":
@@ -356,6 +364,7 @@ func processMultitenantRequest(w http.ResponseWriter, r *http.Request, path stri
 		httpserver.Errorf(w, r, "cannot obtain auth token: %s", err)
 		return true
 	}
+	httpserver.LimitRequestBody(r, getMaxRequestBodySize(p.Suffix))
 	switch p.Suffix {
 	case "prometheus/", "prometheus", "prometheus/api/v1/write":
 		prometheusWriteRequests.Inc()
@@ -490,6 +499,22 @@ var (
 	promscrapeConfigReloadRequests = metrics.NewCounter(`vmagent_http_requests_total{path="/-/reload"}`)
 )
 
+// getMaxRequestBodySize returns the maximum request body size for the given ingestion path.
+//
+// Zero is returned if the request body size isn't limited for the given path.
+func getMaxRequestBodySize(path string) int64 {
+	path = strings.TrimPrefix(path, "/")
+	path = strings.TrimPrefix(path, "prometheus/")
+	switch path {
+	case "api/v1/import", "api/v1/import/csv", "api/v1/import/prometheus", "api/v1/import/native":
+		return int64(maxImportRequestSize.N)
+	case "write", "api/v2/write", "influx/write", "influx/api/v2/write":
+		return int64(maxInfluxRequestSize.N)
+	default:
+		return 0
+	}
+}
+
 func usage() {
 	const s = `
 vmagent collects metrics data via popular data ingestion protocols and routes it to VictoriaMetrics.
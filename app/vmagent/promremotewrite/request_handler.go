@@ -1,6 +1,7 @@
 package promremotewrite
 
 import (
+	"flag"
 	"io"
 	"net/http"
 
@@ -18,6 +19,10 @@ import (
 )
 
 var (
+	honorLabels = flag.Bool("remoteWriteInput.honorLabels", false, "Whether to preserve labels of samples received via Prometheus remote_write protocol "+
+		"if they clash with labels set via -remoteWrite.label. By default labels from -remoteWrite.label override the clashing labels of the received samples. "+
+		"See https://docs.victoriametrics.com/vmagent.html#adding-labels-to-metrics")
+
 	rowsInserted       = metrics.NewCounter(`vmagent_rows_inserted_total{type="promremotewrite"}`)
 	rowsTenantInserted = tenantmetrics.NewCounterMap(`vmagent_tenant_inserted_rows_total{type="promremotewrite"}`)
 	rowsPerInsert      = metrics.NewHistogram(`vmagent_rows_per_insert{type="promremotewrite"}`)
@@ -81,7 +86,11 @@ func insertRows(at *auth.Token, timeseries []prompb.TimeSeries, extraLabels []pr
 	ctx.WriteRequest.Timeseries = tssDst
 	ctx.Labels = labels
 	ctx.Samples = samples
-	remotewrite.PushWithAuthToken(at, &ctx.WriteRequest)
+	if *honorLabels {
+		remotewrite.PushWithAuthTokenHonorLabels(at, &ctx.WriteRequest)
+	} else {
+		remotewrite.PushWithAuthToken(at, &ctx.WriteRequest)
+	}
 	rowsInserted.Add(rowsTotal)
 	if at != nil {
 		rowsTenantInserted.Get(at).Add(rowsTotal)
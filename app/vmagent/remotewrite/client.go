@@ -86,7 +86,9 @@ type client struct {
 	authCfg   *promauth.Config
 	awsCfg    *awsapi.Config
 
-	rl rateLimiter
+	rl          rateLimiter
+	retryPolicy *retryPolicy
+	debugDumper *debugDumper
 
 	bytesSent       *metrics.Counter
 	blocksSent      *metrics.Counter
@@ -142,7 +144,9 @@ func newHTTPClient(argIdx int, remoteWriteURL, sanitizedURL string, fq *persiste
 			Transport: tr,
 			Timeout:   sendTimeout.GetOptionalArgOrDefault(argIdx, time.Minute),
 		},
-		stopCh: make(chan struct{}),
+		retryPolicy: getRetryPolicy(argIdx),
+		debugDumper: getDebugDumper(),
+		stopCh:      make(chan struct{}),
 	}
 	c.sendBlock = c.sendBlockHTTP
 	return c
@@ -245,9 +249,10 @@ func getAWSAPIConfig(argIdx int) (*awsapi.Config, error) {
 func (c *client) runWorker() {
 	var ok bool
 	var block []byte
+	var blockID uint64
 	ch := make(chan bool, 1)
 	for {
-		block, ok = c.fq.MustReadBlock(block[:0])
+		block, blockID, ok = c.fq.MustReadBlockForAck(block[:0])
 		if !ok {
 			return
 		}
@@ -259,38 +264,49 @@ func (c *client) runWorker() {
 		select {
 		case ok := <-ch:
 			if ok {
-				// The block has been sent successfully
+				// The block has been sent successfully, so it mustn't be sent again after unclean restart.
+				c.fq.AckBlock(blockID)
 				continue
 			}
 			// Return unsent block to the queue.
-			c.fq.MustWriteBlock(block)
+			c.returnBlockToQueue(block, blockID)
 			return
 		case <-c.stopCh:
 			// c must be stopped. Wait for a while in the hope the block will be sent.
 			graceDuration := 5 * time.Second
 			select {
 			case ok := <-ch:
-				if !ok {
+				if ok {
+					c.fq.AckBlock(blockID)
+				} else {
 					// Return unsent block to the queue.
-					c.fq.MustWriteBlock(block)
+					c.returnBlockToQueue(block, blockID)
 				}
 			case <-time.After(graceDuration):
 				// Return unsent block to the queue.
-				c.fq.MustWriteBlock(block)
+				c.returnBlockToQueue(block, blockID)
 			}
 			return
 		}
 	}
 }
 
+// returnBlockToQueue writes the unsent block back to c.fq and then acknowledges the original block with the given blockID.
+func (c *client) returnBlockToQueue(block []byte, blockID uint64) {
+	c.fq.MustWriteBlock(block)
+	c.fq.AckBlock(blockID)
+}
+
 // sendBlockHTTP returns false only if c.stopCh is closed.
-// Otherwise it tries sending the block to remote storage indefinitely.
+// Otherwise it tries sending the block to remote storage until it succeeds
+// or until -remoteWrite.retryMaxTime is exceeded.
 func (c *client) sendBlockHTTP(block []byte) bool {
 	c.rl.register(len(block), c.stopCh)
-	retryDuration := time.Second
+	firstAttemptTime := time.Now()
 	retriesCount := 0
 	c.bytesSent.Add(len(block))
 	c.blocksSent.Inc()
+	c.debugDumper.maybeDump(c.sanitizedURL, block)
 	sigv4Hash := ""
 	if c.awsCfg != nil {
 		sigv4Hash = awsapi.HashHex(block)
@@ -320,21 +336,17 @@ again:
 	c.requestDuration.UpdateDuration(startTime)
 	if err != nil {
 		c.errorsCount.Inc()
-		retryDuration *= 2
-		if retryDuration > time.Minute {
-			retryDuration = time.Minute
+		retriesCount++
+		retryDuration := c.retryPolicy.backoff(retriesCount)
+		if c.retryPolicy.isExhausted(firstAttemptTime, retryDuration) {
+			c.dropBlockAfterRetries(len(block), retriesCount, firstAttemptTime)
+			return true
 		}
 		logger.Warnf("couldn't send a block with size %d bytes to %q: %s; re-sending the block in %.3f seconds",
 			len(block), c.sanitizedURL, err, retryDuration.Seconds())
-		t := timerpool.Get(retryDuration)
-		select {
-		case <-c.stopCh:
-			timerpool.Put(t)
+		if !c.sleepBeforeRetry(retryDuration) {
 			return false
-		case <-t.C:
-			timerpool.Put(t)
 		}
-		c.retriesCount.Inc()
 		goto again
 	}
 	statusCode := resp.StatusCode
@@ -366,19 +378,30 @@ again:
 
 	// Unexpected status code returned
 	retriesCount++
-	retryDuration *= 2
-	if retryDuration > time.Minute {
-		retryDuration = time.Minute
-	}
+	retryDuration := c.retryPolicy.backoff(retriesCount)
 	body, err := ioutil.ReadAll(resp.Body)
 	_ = resp.Body.Close()
+	if c.retryPolicy.isExhausted(firstAttemptTime, retryDuration) {
+		c.dropBlockAfterRetries(len(block), retriesCount, firstAttemptTime)
+		return true
+	}
 	if err != nil {
 		logger.Errorf("cannot read response body from %q during retry #%d: %s", c.sanitizedURL, retriesCount, err)
 	} else {
 		logger.Errorf("unexpected status code received after sending a block with size %d bytes to %q during retry #%d: %d; response body=%q; "+
 			"re-sending the block in %.3f seconds", len(block), c.sanitizedURL, retriesCount, statusCode, body, retryDuration.Seconds())
 	}
-	t := timerpool.Get(retryDuration)
+	if !c.sleepBeforeRetry(retryDuration) {
+		return false
+	}
+	goto again
+}
+
+// sleepBeforeRetry sleeps for the given d before the next retry.
+//
+// It returns false if c.stopCh is closed during the sleep.
+func (c *client) sleepBeforeRetry(d time.Duration) bool {
+	t := timerpool.Get(d)
 	select {
 	case <-c.stopCh:
 		timerpool.Put(t)
@@ -387,7 +410,13 @@ again:
 		timerpool.Put(t)
 	}
 	c.retriesCount.Inc()
-	goto again
+	return true
+}
+
+func (c *client) dropBlockAfterRetries(blockLen, retriesCount int, firstAttemptTime time.Time) {
+	logger.Errorf("dropping a block with size %d bytes, which couldn't be sent to %q during %d attempts in %.3f seconds; "+
+		"see -remoteWrite.retryMaxTime", blockLen, c.sanitizedURL, retriesCount, time.Since(firstAttemptTime).Seconds())
+	c.packetsDropped.Inc()
 }
 
 type rateLimiter struct {
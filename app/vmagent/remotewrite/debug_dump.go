@@ -0,0 +1,175 @@
+package remotewrite
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/golang/snappy"
+)
+
+var (
+	debugDumpSampleRate = flag.Float64("remoteWrite.debugDumpSampleRate", 0, "The fraction of requests to -remoteWrite.url, which must be logged in decoded form "+
+		"for debugging purposes. For example, 0.01 means that every 100th request is logged on average. The value must be in the range [0..1]. "+
+		"Logging is disabled by default. See https://docs.victoriametrics.com/vmagent.html#debugging-remote-write-requests")
+	debugDumpRedactLabels = flagutil.NewArray("remoteWrite.debugDumpRedactLabels", "Optional label name, which value must be replaced with <redacted> "+
+		"in requests logged via -remoteWrite.debugDumpSampleRate. Pass multiple -remoteWrite.debugDumpRedactLabels flags in order to redact multiple labels")
+	debugDumpRedactValuesRegex = flag.String("remoteWrite.debugDumpRedactValuesRegex", "", "Optional regex for label values, which must be replaced with <redacted> "+
+		"in requests logged via -remoteWrite.debugDumpSampleRate. This may be used for hiding secrets such as tokens in label values. "+
+		"The regex is anchored to the whole label value")
+)
+
+var debugDumpedRequests = metrics.NewCounter(`vmagent_remotewrite_debug_dumped_requests_total`)
+
+// redactedValue is logged instead of label values hidden via -remoteWrite.debugDumpRedactLabels and -remoteWrite.debugDumpRedactValuesRegex.
+const redactedValue = "<redacted>"
+
+// debugDumpMaxLen is the maximum length of the decoded request to log.
+//
+// Remote write requests may contain megabytes of data, so only a prefix is logged for big requests.
+const debugDumpMaxLen = 4 * 1024
+
+// debugDumper logs a sampled fraction of remote write requests in decoded form.
+type debugDumper struct {
+	// sampleRate is the fraction of requests to log. It must be in the range [0..1].
+	sampleRate float64
+
+	redactLabels      map[string]struct{}
+	redactValuesRegex *regexp.Regexp
+
+	// maxLen is the maximum length of the decoded request to log.
+	maxLen int
+
+	// logf is used for logging the decoded requests.
+	logf func(format string, args ...interface{})
+}
+
+var (
+	debugDumperOnce   sync.Once
+	debugDumperGlobal *debugDumper
+)
+
+// getDebugDumper returns debugDumper configured via -remoteWrite.debugDump* command-line flags.
+//
+// nil is returned if -remoteWrite.debugDumpSampleRate isn't set.
+func getDebugDumper() *debugDumper {
+	debugDumperOnce.Do(func() {
+		dd, err := newDebugDumper(*debugDumpSampleRate, *debugDumpRedactLabels, *debugDumpRedactValuesRegex)
+		if err != nil {
+			logger.Fatalf("cannot initialize remote write debug dump: %s", err)
+		}
+		debugDumperGlobal = dd
+	})
+	return debugDumperGlobal
+}
+
+func newDebugDumper(sampleRate float64, redactLabels []string, redactValuesRegex string) (*debugDumper, error) {
+	if sampleRate < 0 || sampleRate > 1 {
+		return nil, fmt.Errorf("-remoteWrite.debugDumpSampleRate must be in the range [0..1]; got %g", sampleRate)
+	}
+	if sampleRate == 0 {
+		return nil, nil
+	}
+	dd := &debugDumper{
+		sampleRate:   sampleRate,
+		redactLabels: make(map[string]struct{}, len(redactLabels)),
+		maxLen:       debugDumpMaxLen,
+		logf:         logger.Infof,
+	}
+	for _, name := range redactLabels {
+		dd.redactLabels[name] = struct{}{}
+	}
+	if redactValuesRegex != "" {
+		re, err := regexp.Compile("^(?:" + redactValuesRegex + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse -remoteWrite.debugDumpRedactValuesRegex=%q: %w", redactValuesRegex, err)
+		}
+		dd.redactValuesRegex = re
+	}
+	return dd, nil
+}
+
+// maybeDump logs the snappy-compressed remote write request from block sent to sanitizedURL if the request is sampled.
+func (dd *debugDumper) maybeDump(sanitizedURL string, block []byte) {
+	if dd == nil || rand.Float64() >= dd.sampleRate {
+		return
+	}
+	bb := debugDumpBufPool.Get()
+	defer debugDumpBufPool.Put(bb)
+	var err error
+	bb.B, err = dd.formatBlock(bb.B[:0], block)
+	if err != nil {
+		logger.Errorf("cannot decode remote write request to %q for debug dump: %s", sanitizedURL, err)
+		return
+	}
+	debugDumpedRequests.Inc()
+	if len(bb.B) <= dd.maxLen {
+		dd.logf("debug dump of remote write request to %q:\n%s", sanitizedURL, bb.B)
+		return
+	}
+	// Log only the whole lines from the prefix of the decoded request.
+	prefix := bb.B[:dd.maxLen]
+	if n := bytes.LastIndexByte(prefix, '\n'); n >= 0 {
+		prefix = prefix[:n+1]
+	}
+	dd.logf("debug dump of remote write request to %q (the first %d bytes out of %d bytes):\n%s", sanitizedURL, len(prefix), len(bb.B), prefix)
+}
+
+// formatBlock appends the decoded snappy-compressed remote write request from block to dst and returns the result.
+//
+// Every sample is written on a separate line in Prometheus text exposition format with the timestamp in milliseconds.
+func (dd *debugDumper) formatBlock(dst, block []byte) ([]byte, error) {
+	data, err := snappy.Decode(nil, block)
+	if err != nil {
+		return dst, fmt.Errorf("cannot decompress block with size %d bytes: %w", len(block), err)
+	}
+	var wr prompb.WriteRequest
+	if err := wr.Unmarshal(data); err != nil {
+		return dst, fmt.Errorf("cannot unmarshal WriteRequest from %d bytes: %w", len(data), err)
+	}
+	for i := range wr.Timeseries {
+		ts := &wr.Timeseries[i]
+		var metric []byte
+		metric = append(metric, '{')
+		for j := range ts.Labels {
+			label := &ts.Labels[j]
+			if j > 0 {
+				metric = append(metric, ',')
+			}
+			metric = append(metric, label.Name...)
+			metric = append(metric, '=')
+			metric = strconv.AppendQuote(metric, dd.getLabelValue(label))
+		}
+		metric = append(metric, '}')
+		for _, s := range ts.Samples {
+			dst = append(dst, metric...)
+			dst = append(dst, ' ')
+			dst = strconv.AppendFloat(dst, s.Value, 'g', -1, 64)
+			dst = append(dst, ' ')
+			dst = strconv.AppendInt(dst, s.Timestamp, 10)
+			dst = append(dst, '\n')
+		}
+	}
+	return dst, nil
+}
+
+func (dd *debugDumper) getLabelValue(label *prompb.Label) string {
+	if _, ok := dd.redactLabels[string(label.Name)]; ok {
+		return redactedValue
+	}
+	if dd.redactValuesRegex != nil && dd.redactValuesRegex.Match(label.Value) {
+		return redactedValue
+	}
+	return string(label.Value)
+}
+
+var debugDumpBufPool bytesutil.ByteBufferPool
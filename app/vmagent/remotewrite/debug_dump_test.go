@@ -0,0 +1,101 @@
+package remotewrite
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+func TestDebugDumperMaybeDump(t *testing.T) {
+	f := func(sampleRate float64, redactLabels []string, redactValuesRegex string, maxLen int, dumpExpected string) {
+		t.Helper()
+		dd, err := newDebugDumper(sampleRate, redactLabels, redactValuesRegex)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var dump string
+		if dd != nil {
+			if maxLen > 0 {
+				dd.maxLen = maxLen
+			}
+			dd.logf = func(format string, args ...interface{}) {
+				dump += fmt.Sprintf(format, args...)
+			}
+		}
+		wr := &prompbmarshal.WriteRequest{
+			Timeseries: []prompbmarshal.TimeSeries{
+				{
+					Labels: []prompbmarshal.Label{
+						{Name: "__name__", Value: "foo"},
+						{Name: "job", Value: "bar"},
+						{Name: "token", Value: "secret-123"},
+					},
+					Samples: []prompbmarshal.Sample{
+						{Value: 1.5, Timestamp: 1000},
+						{Value: 2, Timestamp: 2000},
+					},
+				},
+				{
+					Labels: []prompbmarshal.Label{
+						{Name: "__name__", Value: "baz"},
+					},
+					Samples: []prompbmarshal.Sample{
+						{Value: -3, Timestamp: 3000},
+					},
+				},
+			},
+		}
+		pushWriteRequest(wr, func(block []byte) {
+			dd.maybeDump("1:secret-url", block)
+		})
+		if dump != dumpExpected {
+			t.Fatalf("unexpected dump\ngot\n%s\nwant\n%s", dump, dumpExpected)
+		}
+	}
+
+	// Dumping is disabled
+	f(0, nil, "", 0, "")
+
+	// All the requests are sampled
+	f(1, nil, "", 0, `debug dump of remote write request to "1:secret-url":
+{__name__="foo",job="bar",token="secret-123"} 1.5 1000
+{__name__="foo",job="bar",token="secret-123"} 2 2000
+{__name__="baz"} -3 3000
+`)
+
+	// Redact labels by name
+	f(1, []string{"token", "job"}, "", 0, `debug dump of remote write request to "1:secret-url":
+{__name__="foo",job="<redacted>",token="<redacted>"} 1.5 1000
+{__name__="foo",job="<redacted>",token="<redacted>"} 2 2000
+{__name__="baz"} -3 3000
+`)
+
+	// Redact labels by value
+	f(1, nil, "secret-.+|ba", 0, `debug dump of remote write request to "1:secret-url":
+{__name__="foo",job="bar",token="<redacted>"} 1.5 1000
+{__name__="foo",job="bar",token="<redacted>"} 2 2000
+{__name__="baz"} -3 3000
+`)
+
+	// Big requests are truncated to the whole lines
+	f(1, nil, "", 100, `debug dump of remote write request to "1:secret-url" (the first 55 bytes out of 133 bytes):
+{__name__="foo",job="bar",token="secret-123"} 1.5 1000
+`)
+
+	// The first line exceeds the limit
+	f(1, nil, "", 10, `debug dump of remote write request to "1:secret-url" (the first 10 bytes out of 133 bytes):
+{__name__=`)
+}
+
+func TestNewDebugDumperFailure(t *testing.T) {
+	f := func(sampleRate float64, redactValuesRegex string) {
+		t.Helper()
+		if _, err := newDebugDumper(sampleRate, nil, redactValuesRegex); err == nil {
+			t.Fatalf("expecting non-nil error for sampleRate=%g, redactValuesRegex=%q", sampleRate, redactValuesRegex)
+		}
+	}
+	f(-0.1, "")
+	f(1.1, "")
+	f(0.5, "foo(")
+}
@@ -86,7 +86,16 @@ func initLabelsGlobal() {
 	}
 }
 
-func (rctx *relabelCtx) applyRelabeling(tss []prompbmarshal.TimeSeries, extraLabels []prompbmarshal.Label, pcs *promrelabel.ParsedConfigs) []prompbmarshal.TimeSeries {
+// applyRelabeling adds extraLabels to tss and then applies pcs to tss.
+//
+// If honorLabels is set, then the existing labels in tss aren't overridden by extraLabels with the same names.
+func (rctx *relabelCtx) applyRelabeling(tss []prompbmarshal.TimeSeries, extraLabels []prompbmarshal.Label, honorLabels bool, pcs *promrelabel.ParsedConfigs) []prompbmarshal.TimeSeries {
+	return rctx.applyRelabelingKeepTenantID(tss, extraLabels, honorLabels, pcs, false)
+}
+
+// applyRelabelingKeepTenantID works like applyRelabeling, but preserves the __tenant_id__ label if keepTenantID is set.
+func (rctx *relabelCtx) applyRelabelingKeepTenantID(tss []prompbmarshal.TimeSeries, extraLabels []prompbmarshal.Label, honorLabels bool,
+	pcs *promrelabel.ParsedConfigs, keepTenantID bool) []prompbmarshal.TimeSeries {
 	if len(extraLabels) == 0 && pcs.Len() == 0 {
 		// Nothing to change.
 		return tss
@@ -102,12 +111,19 @@ func (rctx *relabelCtx) applyRelabeling(tss []prompbmarshal.TimeSeries, extraLab
 			extraLabel := &extraLabels[j]
 			tmp := promrelabel.GetLabelByName(labels[labelsLen:], extraLabel.Name)
 			if tmp != nil {
-				tmp.Value = extraLabel.Value
+				if !honorLabels {
+					tmp.Value = extraLabel.Value
+				}
 			} else {
 				labels = append(labels, *extraLabel)
 			}
 		}
-		labels = pcs.Apply(labels, labelsLen, true)
+		if keepTenantID {
+			labels = pcs.Apply(labels, labelsLen, false)
+			labels = finalizeLabelsWithTenantID(labels[:labelsLen], labels[labelsLen:])
+		} else {
+			labels = pcs.Apply(labels, labelsLen, true)
+		}
 		if len(labels) == labelsLen {
 			// Drop the current time series, since relabeling removed all the labels.
 			continue
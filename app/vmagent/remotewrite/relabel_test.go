@@ -0,0 +1,152 @@
+package remotewrite
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/golang/snappy"
+)
+
+func TestRemoteWriteCtxPushRelabeling(t *testing.T) {
+	f := func(relabelConfig string, tss []prompbmarshal.TimeSeries, resultExpected []string) {
+		t.Helper()
+		pcs, err := promrelabel.ParseRelabelConfigsData([]byte(relabelConfig), false)
+		if err != nil {
+			t.Fatalf("cannot parse relabel config: %s", err)
+		}
+		allRelabelConfigs.Store(&relabelConfigs{
+			perURL: []*promrelabel.ParsedConfigs{pcs},
+		})
+
+		var result []string
+		pushBlock := func(block []byte) {
+			data, err := snappy.Decode(nil, block)
+			if err != nil {
+				panic(fmt.Errorf("cannot decode block: %w", err))
+			}
+			var wr prompb.WriteRequest
+			if err := wr.Unmarshal(data); err != nil {
+				panic(fmt.Errorf("cannot unmarshal block: %w", err))
+			}
+			for _, ts := range wr.Timeseries {
+				var labels []string
+				for _, label := range ts.Labels {
+					labels = append(labels, fmt.Sprintf("%s=%q", label.Name, label.Value))
+				}
+				for _, sample := range ts.Samples {
+					result = append(result, fmt.Sprintf("{%s} %v %d", strings.Join(labels, ","), sample.Value, sample.Timestamp))
+				}
+			}
+		}
+		rwctx := &remoteWriteCtx{
+			pss:                    []*pendingSeries{newPendingSeries(pushBlock, 0, 0)},
+			rowsPushedAfterRelabel: metrics.GetOrCreateCounter(`test_remotewrite_rows_pushed_after_relabel_total`),
+			rowsDroppedByRelabel:   metrics.GetOrCreateCounter(`test_remotewrite_relabel_metrics_dropped_total`),
+		}
+		rwctx.Push(tss)
+		// MustStop flushes the pending series to pushBlock.
+		rwctx.pss[0].MustStop()
+
+		sort.Strings(result)
+		if strings.Join(result, "\n") != strings.Join(resultExpected, "\n") {
+			t.Fatalf("unexpected result;\ngot\n%s\nwant\n%s", strings.Join(result, "\n"), strings.Join(resultExpected, "\n"))
+		}
+	}
+
+	// Series imported via /api/v1/import, which must be relabeled before sending to -remoteWrite.url
+	importedSeries := func() []prompbmarshal.TimeSeries {
+		return []prompbmarshal.TimeSeries{
+			{
+				Labels: []prompbmarshal.Label{
+					{Name: "__name__", Value: "http_requests_total"},
+					{Name: "instance", Value: "host1"},
+				},
+				Samples: []prompbmarshal.Sample{
+					{Value: 1, Timestamp: 1000},
+					{Value: 2, Timestamp: 2000},
+				},
+			},
+			{
+				Labels: []prompbmarshal.Label{
+					{Name: "__name__", Value: "debug_info"},
+					{Name: "instance", Value: "host1"},
+				},
+				Samples: []prompbmarshal.Sample{
+					{Value: 3, Timestamp: 1000},
+				},
+			},
+		}
+	}
+
+	// Empty relabel config
+	f(``, importedSeries(), []string{
+		`{__name__="debug_info",instance="host1"} 3 1000`,
+		`{__name__="http_requests_total",instance="host1"} 1 1000`,
+		`{__name__="http_requests_total",instance="host1"} 2 2000`,
+	})
+
+	// Add label and drop series
+	f(`
+- target_label: env
+  replacement: prod
+- action: drop
+  source_labels: [__name__]
+  regex: "debug_.+"
+- action: labeldrop
+  regex: instance
+`, importedSeries(), []string{
+		`{__name__="http_requests_total",env="prod"} 1 1000`,
+		`{__name__="http_requests_total",env="prod"} 2 2000`,
+	})
+
+	// Drop all the series
+	f(`
+- action: drop
+  source_labels: [instance]
+  regex: host1
+`, importedSeries(), nil)
+}
+
+func TestApplyRelabelingHonorLabels(t *testing.T) {
+	f := func(honorLabels bool, resultExpected string) {
+		t.Helper()
+		// Series received via remote_write from upstream Prometheus, which already sets job and instance labels.
+		tss := []prompbmarshal.TimeSeries{{
+			Labels: []prompbmarshal.Label{
+				{Name: "__name__", Value: "up"},
+				{Name: "job", Value: "node"},
+				{Name: "instance", Value: "host1:9100"},
+			},
+		}}
+		// Labels set via -remoteWrite.label
+		extraLabels := []prompbmarshal.Label{
+			{Name: "job", Value: "vmagent"},
+			{Name: "dc", Value: "eu"},
+		}
+		var rctx relabelCtx
+		tss = rctx.applyRelabeling(tss, extraLabels, honorLabels, nil)
+		if len(tss) != 1 {
+			t.Fatalf("unexpected number of time series; got %d; want 1", len(tss))
+		}
+		var labels []string
+		for _, label := range tss[0].Labels {
+			labels = append(labels, fmt.Sprintf("%s=%q", label.Name, label.Value))
+		}
+		result := "{" + strings.Join(labels, ",") + "}"
+		if result != resultExpected {
+			t.Fatalf("unexpected result;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	// Incoming labels are overridden by -remoteWrite.label by default.
+	f(false, `{__name__="up",dc="eu",instance="host1:9100",job="vmagent"}`)
+
+	// Incoming labels are preserved if honorLabels is set.
+	f(true, `{__name__="up",dc="eu",instance="host1:9100",job="node"}`)
+}
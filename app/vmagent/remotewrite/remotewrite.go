@@ -140,9 +140,19 @@ func Init() {
 	}
 	allRelabelConfigs.Store(rcs)
 
+	rr, err := loadRoutingConfig()
+	if err != nil {
+		logger.Fatalf("cannot load routing config: %s", err)
+	}
+	if rr != nil && *shardByURL {
+		logger.Fatalf("cannot use -remoteWrite.routingConfig together with -remoteWrite.shardByURL")
+	}
+	routingRulesGlobal.Store(rr)
+
 	if len(*remoteWriteURLs) > 0 {
-		rwctxsDefault = newRemoteWriteCtxs(nil, *remoteWriteURLs)
+		rwctxsDefault = newRemoteWriteCtxs(nil, getRemoteWriteURLs())
 	}
+	initRequiredLabels()
 
 	// Start config reloader.
 	configReloaderWG.Add(1)
@@ -158,14 +168,34 @@ func Init() {
 			rcs, err := loadRelabelConfigs()
 			if err != nil {
 				logger.Errorf("cannot reload relabel configs; preserving the previous configs; error: %s", err)
-				continue
+			} else {
+				allRelabelConfigs.Store(rcs)
+				logger.Infof("Successfully reloaded relabel configs")
+			}
+			if *routingConfigPath != "" {
+				rr, err := loadRoutingConfig()
+				if err != nil {
+					logger.Errorf("cannot reload -remoteWrite.routingConfig; preserving the previous config; error: %s", err)
+					continue
+				}
+				routingRulesGlobal.Store(rr)
+				logger.Infof("Successfully reloaded -remoteWrite.routingConfig")
 			}
-			allRelabelConfigs.Store(rcs)
-			logger.Infof("Successfully reloaded relabel configs")
 		}
 	}()
 }
 
+// getRemoteWriteURLs returns urls for remote storages, which receive the data.
+//
+// Every tenant gets its own set of remote storages for these urls if -remoteWrite.multitenantURL is set.
+// The number of returned urls matches the number of remoteWriteCtx items created per each set of remote storages.
+func getRemoteWriteURLs() []string {
+	if len(*remoteWriteMultitenantURLs) > 0 {
+		return *remoteWriteMultitenantURLs
+	}
+	return *remoteWriteURLs
+}
+
 func newRemoteWriteCtxs(at *auth.Token, urls []string) []*remoteWriteCtx {
 	if len(urls) == 0 {
 		logger.Panicf("BUG: urls must be non-empty")
@@ -224,6 +254,8 @@ func Stop() {
 	}
 	rwctxsMap = nil
 
+	stopRequiredLabels()
+
 	if sl := hourlySeriesLimiter; sl != nil {
 		sl.MustStop()
 	}
@@ -243,6 +275,18 @@ func Push(wr *prompbmarshal.WriteRequest) {
 //
 // Note that wr may be modified by Push due to relabeling and rounding.
 func PushWithAuthToken(at *auth.Token, wr *prompbmarshal.WriteRequest) {
+	pushWithAuthToken(at, wr, false)
+}
+
+// PushWithAuthTokenHonorLabels works like PushWithAuthToken, but preserves the labels in wr
+// if they clash with labels set via `-remoteWrite.label`.
+//
+// Note that wr may be modified by Push due to relabeling and rounding.
+func PushWithAuthTokenHonorLabels(at *auth.Token, wr *prompbmarshal.WriteRequest) {
+	pushWithAuthToken(at, wr, true)
+}
+
+func pushWithAuthToken(at *auth.Token, wr *prompbmarshal.WriteRequest, honorLabels bool) {
 	if at == nil && len(*remoteWriteMultitenantURLs) > 0 {
 		// Write data to default tenant if at isn't set while -remoteWrite.multitenantURL is set.
 		at = defaultAuthToken
@@ -254,17 +298,7 @@ func PushWithAuthToken(at *auth.Token, wr *prompbmarshal.WriteRequest) {
 		if len(*remoteWriteMultitenantURLs) == 0 {
 			logger.Panicf("BUG: remoteWriteMultitenantURLs must be non-empty for non-nil at")
 		}
-		rwctxsMapLock.Lock()
-		tenantID := tenantmetrics.TenantID{
-			AccountID: at.AccountID,
-			ProjectID: at.ProjectID,
-		}
-		rwctxs = rwctxsMap[tenantID]
-		if rwctxs == nil {
-			rwctxs = newRemoteWriteCtxs(at, *remoteWriteMultitenantURLs)
-			rwctxsMap[tenantID] = rwctxs
-		}
-		rwctxsMapLock.Unlock()
+		rwctxs = getTenantRemoteWriteCtxs(at)
 	}
 
 	var rctx *relabelCtx
@@ -299,15 +333,26 @@ func PushWithAuthToken(at *auth.Token, wr *prompbmarshal.WriteRequest) {
 		} else {
 			tss = nil
 		}
+		if at != nil {
+			// Ignore the __tenant_id__ label sent by the client, since otherwise it could write data to arbitrary tenants.
+			// The label may be set only via relabeling configured at vmagent.
+			removeTenantIDLabels(tssBlock)
+		}
 		if rctx != nil {
 			rowsCountBeforeRelabel := getRowsCount(tssBlock)
-			tssBlock = rctx.applyRelabeling(tssBlock, labelsGlobal, pcsGlobal)
+			// Preserve the __tenant_id__ label set by relabeling, so it could be used for routing samples to tenants below.
+			tssBlock = rctx.applyRelabelingKeepTenantID(tssBlock, labelsGlobal, honorLabels, pcsGlobal, at != nil)
 			rowsCountAfterRelabel := getRowsCount(tssBlock)
 			rowsDroppedByGlobalRelabel.Add(rowsCountBeforeRelabel - rowsCountAfterRelabel)
 		}
+		tssBlock = applyRequiredLabels(tssBlock)
 		sortLabelsIfNeeded(tssBlock)
 		tssBlock = limitSeriesCardinality(tssBlock)
-		pushBlockToRemoteStorages(rwctxs, tssBlock)
+		if at != nil {
+			pushBlockToTenants(at, rwctxs, tssBlock)
+		} else {
+			pushBlockToRemoteStorages(rwctxs, tssBlock)
+		}
 		if rctx != nil {
 			rctx.reset()
 		}
@@ -317,11 +362,35 @@ func PushWithAuthToken(at *auth.Token, wr *prompbmarshal.WriteRequest) {
 	}
 }
 
+// getTenantRemoteWriteCtxs returns remoteWriteCtxs for -remoteWrite.multitenantURL and the tenant from at.
+func getTenantRemoteWriteCtxs(at *auth.Token) []*remoteWriteCtx {
+	tenantID := tenantmetrics.TenantID{
+		AccountID: at.AccountID,
+		ProjectID: at.ProjectID,
+	}
+	rwctxsMapLock.Lock()
+	rwctxs := rwctxsMap[tenantID]
+	if rwctxs == nil {
+		rwctxs = newRemoteWriteCtxs(at, getRemoteWriteURLs())
+		rwctxsMap[tenantID] = rwctxs
+	}
+	rwctxsMapLock.Unlock()
+	return rwctxs
+}
+
 func pushBlockToRemoteStorages(rwctxs []*remoteWriteCtx, tssBlock []prompbmarshal.TimeSeries) {
 	if len(tssBlock) == 0 {
 		// Nothing to push
 		return
 	}
+	if rr := routingRulesGlobal.Load().(*routingRules); rr != nil {
+		pushBlockToRoutedRemoteStorages(rwctxs, tssBlock, rr)
+		return
+	}
+	if *shardByURL && len(rwctxs) > 1 {
+		pushBlockToRemoteStorageShards(rwctxs, tssBlock)
+		return
+	}
 	// Push block to remote storages in parallel in order to reduce the time needed for sending the data to multiple remote storage systems.
 	var wg sync.WaitGroup
 	for _, rwctx := range rwctxs {
@@ -334,6 +403,34 @@ func pushBlockToRemoteStorages(rwctxs []*remoteWriteCtx, tssBlock []prompbmarsha
 	wg.Wait()
 }
 
+// pushBlockToRemoteStorageShards pushes every series from tssBlock to a single remote storage from rwctxs
+// selected by hash of series labels.
+func pushBlockToRemoteStorageShards(rwctxs []*remoteWriteCtx, tssBlock []prompbmarshal.TimeSeries) {
+	seeds := make([]uint64, len(rwctxs))
+	for i, rwctx := range rwctxs {
+		seeds[i] = rwctx.shardSeed
+	}
+	blocks := make([][]prompbmarshal.TimeSeries, len(rwctxs))
+	shardTimeseries(blocks, tssBlock, seeds)
+	pushBlocksPerRemoteStorage(rwctxs, blocks)
+}
+
+// pushBlocksPerRemoteStorage pushes blocks[i] to rwctxs[i] in parallel.
+func pushBlocksPerRemoteStorage(rwctxs []*remoteWriteCtx, blocks [][]prompbmarshal.TimeSeries) {
+	var wg sync.WaitGroup
+	for i, tss := range blocks {
+		if len(tss) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(rwctx *remoteWriteCtx, tss []prompbmarshal.TimeSeries) {
+			defer wg.Done()
+			rwctx.Push(tss)
+		}(rwctxs[i], tss)
+	}
+	wg.Wait()
+}
+
 // sortLabelsIfNeeded sorts labels if -sortLabels command-line flag is set.
 func sortLabelsIfNeeded(tss []prompbmarshal.TimeSeries) {
 	if !*sortLabels {
@@ -429,6 +526,9 @@ type remoteWriteCtx struct {
 	pss        []*pendingSeries
 	pssNextIdx uint64
 
+	// shardSeed is used for selecting the remote storage for series when -remoteWrite.shardByURL is set.
+	shardSeed uint64
+
 	rowsPushedAfterRelabel *metrics.Counter
 	rowsDroppedByRelabel   *metrics.Counter
 }
@@ -469,10 +569,11 @@ func newRemoteWriteCtx(argIdx int, at *auth.Token, remoteWriteURL *url.URL, maxI
 		pss[i] = newPendingSeries(fq.MustWriteBlock, sf, rd)
 	}
 	return &remoteWriteCtx{
-		idx: argIdx,
-		fq:  fq,
-		c:   c,
-		pss: pss,
+		idx:       argIdx,
+		fq:        fq,
+		c:         c,
+		pss:       pss,
+		shardSeed: h,
 
 		rowsPushedAfterRelabel: metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_rows_pushed_after_relabel_total{path=%q, url=%q}`, queuePath, sanitizedURL)),
 		rowsDroppedByRelabel:   metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_relabel_metrics_dropped_total{path=%q, url=%q}`, queuePath, sanitizedURL)),
@@ -499,7 +600,11 @@ func (rwctx *remoteWriteCtx) Push(tss []prompbmarshal.TimeSeries) {
 	var rctx *relabelCtx
 	var v *[]prompbmarshal.TimeSeries
 	rcs := allRelabelConfigs.Load().(*relabelConfigs)
-	pcs := rcs.perURL[rwctx.idx]
+	var pcs *promrelabel.ParsedConfigs
+	if rwctx.idx < len(rcs.perURL) {
+		// rwctx.idx may exceed the number of -remoteWrite.url args for deadLetterRWCtx.
+		pcs = rcs.perURL[rwctx.idx]
+	}
 	if pcs.Len() > 0 {
 		rctx = getRelabelCtx()
 		// Make a copy of tss before applying relabeling in order to prevent
@@ -509,7 +614,7 @@ func (rwctx *remoteWriteCtx) Push(tss []prompbmarshal.TimeSeries) {
 		v = tssRelabelPool.Get().(*[]prompbmarshal.TimeSeries)
 		tss = append(*v, tss...)
 		rowsCountBeforeRelabel := getRowsCount(tss)
-		tss = rctx.applyRelabeling(tss, nil, pcs)
+		tss = rctx.applyRelabeling(tss, nil, false, pcs)
 		rowsCountAfterRelabel := getRowsCount(tss)
 		rwctx.rowsDroppedByRelabel.Add(rowsCountBeforeRelabel - rowsCountAfterRelabel)
 	}
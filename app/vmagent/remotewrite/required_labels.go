@@ -0,0 +1,128 @@
+package remotewrite
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	requiredLabels = flagutil.NewArray("remoteWrite.requiredLabel", "Optional label name, which must be present in all the metrics before sending them to -remoteWrite.url. "+
+		"Metrics without the required label or with empty value for it are dropped or are sent to -remoteWrite.requiredLabelsDeadLetterURL. "+
+		"Pass multiple -remoteWrite.requiredLabel flags in order to require multiple labels. "+
+		"See https://docs.victoriametrics.com/vmagent.html#required-labels")
+	requiredLabelsDeadLetterURL = flag.String("remoteWrite.requiredLabelsDeadLetterURL", "", "Optional remote storage URL for sending metrics without labels "+
+		"from -remoteWrite.requiredLabel instead of dropping them. It must support Prometheus remote_write API. "+
+		"See https://docs.victoriametrics.com/vmagent.html#required-labels")
+)
+
+var (
+	rowsDroppedByRequiredLabels    = metrics.NewCounter(`vmagent_remotewrite_required_labels_dropped_rows_total`)
+	rowsDeadLetterByRequiredLabels = metrics.NewCounter(`vmagent_remotewrite_required_labels_dead_letter_rows_total`)
+)
+
+// deadLetterRWCtx is used for sending metrics without the required labels to -remoteWrite.requiredLabelsDeadLetterURL.
+//
+// It is nil if -remoteWrite.requiredLabelsDeadLetterURL isn't set.
+var deadLetterRWCtx *remoteWriteCtx
+
+// initRequiredLabels must be called after parsing command-line flags.
+func initRequiredLabels() {
+	if *requiredLabelsDeadLetterURL == "" {
+		return
+	}
+	if len(*requiredLabels) == 0 {
+		logger.Fatalf("-remoteWrite.requiredLabelsDeadLetterURL cannot be set without -remoteWrite.requiredLabel")
+	}
+	deadLetterURL, err := url.Parse(*requiredLabelsDeadLetterURL)
+	if err != nil {
+		logger.Fatalf("invalid -remoteWrite.requiredLabelsDeadLetterURL=%q: %s", *requiredLabelsDeadLetterURL, err)
+	}
+	sanitizedURL := "dead-letter:secret-url"
+	if *showRemoteWriteURL {
+		sanitizedURL = fmt.Sprintf("dead-letter:%s", deadLetterURL)
+	}
+	// Use the index after all the -remoteWrite.url args, so the dead-letter queue doesn't clash with queues for -remoteWrite.url.
+	// Per-url options such as -remoteWrite.bearerToken are applied to it only if they contain a single value.
+	argIdx := len(*remoteWriteURLs) + len(*remoteWriteMultitenantURLs)
+	deadLetterRWCtx = newRemoteWriteCtx(argIdx, nil, deadLetterURL, 2*(*queues), sanitizedURL)
+}
+
+func stopRequiredLabels() {
+	if deadLetterRWCtx != nil {
+		deadLetterRWCtx.MustStop()
+		deadLetterRWCtx = nil
+	}
+}
+
+// applyRequiredLabels removes time series without -remoteWrite.requiredLabel labels from tss and returns the remaining time series.
+//
+// The removed time series are sent to -remoteWrite.requiredLabelsDeadLetterURL if it is set. Otherwise they are dropped.
+func applyRequiredLabels(tss []prompbmarshal.TimeSeries) []prompbmarshal.TimeSeries {
+	if len(*requiredLabels) == 0 {
+		return tss
+	}
+	v := tssRequiredLabelsPool.Get().(*[]prompbmarshal.TimeSeries)
+	tss, missing := splitByRequiredLabels(tss, (*v)[:0], *requiredLabels)
+	if len(missing) > 0 {
+		rowsCount := getRowsCount(missing)
+		if deadLetterRWCtx != nil {
+			deadLetterRWCtx.Push(missing)
+			rowsDeadLetterByRequiredLabels.Add(rowsCount)
+		} else {
+			rowsDroppedByRequiredLabels.Add(rowsCount)
+		}
+	}
+	*v = prompbmarshal.ResetTimeSeries(missing)
+	tssRequiredLabelsPool.Put(v)
+	return tss
+}
+
+var tssRequiredLabelsPool = &sync.Pool{
+	New: func() interface{} {
+		a := []prompbmarshal.TimeSeries{}
+		return &a
+	},
+}
+
+// splitByRequiredLabels moves time series without any of the requiredLabels from tss to missing.
+//
+// It returns the remaining time series and the moved time series.
+func splitByRequiredLabels(tss, missing []prompbmarshal.TimeSeries, requiredLabels []string) ([]prompbmarshal.TimeSeries, []prompbmarshal.TimeSeries) {
+	tssDst := tss[:0]
+	for _, ts := range tss {
+		if hasRequiredLabels(ts.Labels, requiredLabels) {
+			tssDst = append(tssDst, ts)
+		} else {
+			missing = append(missing, ts)
+		}
+	}
+	return tssDst, missing
+}
+
+func hasRequiredLabels(labels []prompbmarshal.Label, requiredLabels []string) bool {
+	for _, name := range requiredLabels {
+		if name == "" {
+			continue
+		}
+		if !hasNonEmptyLabel(labels, name) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasNonEmptyLabel(labels []prompbmarshal.Label, name string) bool {
+	for _, label := range labels {
+		if label.Name == name {
+			return label.Value != ""
+		}
+	}
+	return false
+}
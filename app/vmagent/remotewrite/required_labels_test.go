@@ -0,0 +1,125 @@
+package remotewrite
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/golang/snappy"
+)
+
+func TestApplyRequiredLabels(t *testing.T) {
+	newTimeSeries := func() []prompbmarshal.TimeSeries {
+		return []prompbmarshal.TimeSeries{
+			{
+				Labels: []prompbmarshal.Label{
+					{Name: "__name__", Value: "foo"},
+					{Name: "team", Value: "infra"},
+				},
+				Samples: []prompbmarshal.Sample{{Value: 1, Timestamp: 1000}},
+			},
+			{
+				Labels: []prompbmarshal.Label{
+					{Name: "__name__", Value: "bar"},
+				},
+				Samples: []prompbmarshal.Sample{{Value: 2, Timestamp: 2000}},
+			},
+			{
+				Labels: []prompbmarshal.Label{
+					{Name: "__name__", Value: "baz"},
+					{Name: "team", Value: ""},
+				},
+				Samples: []prompbmarshal.Sample{{Value: 3, Timestamp: 3000}},
+			},
+		}
+	}
+	tssString := func(tss []prompbmarshal.TimeSeries) string {
+		var a []string
+		for _, ts := range tss {
+			a = append(a, ts.Labels[0].Value)
+		}
+		return strings.Join(a, ",")
+	}
+
+	prevRequiredLabels := *requiredLabels
+	*requiredLabels = []string{"team"}
+	defer func() {
+		*requiredLabels = prevRequiredLabels
+	}()
+
+	// Drop mode
+	droppedBefore := rowsDroppedByRequiredLabels.Get()
+	tss := applyRequiredLabels(newTimeSeries())
+	if s := tssString(tss); s != "foo" {
+		t.Fatalf("unexpected time series left after dropping; got %q; want %q", s, "foo")
+	}
+	if n := rowsDroppedByRequiredLabels.Get() - droppedBefore; n != 2 {
+		t.Fatalf("unexpected number of dropped rows; got %d; want 2", n)
+	}
+
+	// Dead-letter mode
+	var deadLetterSeries []string
+	pushBlock := func(block []byte) {
+		data, err := snappy.Decode(nil, block)
+		if err != nil {
+			panic(fmt.Errorf("cannot decode block: %w", err))
+		}
+		var wr prompb.WriteRequest
+		if err := wr.Unmarshal(data); err != nil {
+			panic(fmt.Errorf("cannot unmarshal block: %w", err))
+		}
+		for _, ts := range wr.Timeseries {
+			deadLetterSeries = append(deadLetterSeries, string(ts.Labels[0].Value))
+		}
+	}
+	allRelabelConfigs.Store(&relabelConfigs{})
+	deadLetterRWCtx = &remoteWriteCtx{
+		pss:                    []*pendingSeries{newPendingSeries(pushBlock, 0, 0)},
+		rowsPushedAfterRelabel: metrics.GetOrCreateCounter(`test_required_labels_rows_pushed_after_relabel_total`),
+		rowsDroppedByRelabel:   metrics.GetOrCreateCounter(`test_required_labels_relabel_metrics_dropped_total`),
+	}
+	defer func() {
+		deadLetterRWCtx = nil
+	}()
+	droppedBefore = rowsDroppedByRequiredLabels.Get()
+	deadLetterBefore := rowsDeadLetterByRequiredLabels.Get()
+	tss = applyRequiredLabels(newTimeSeries())
+	if s := tssString(tss); s != "foo" {
+		t.Fatalf("unexpected time series left after sending to dead-letter url; got %q; want %q", s, "foo")
+	}
+	// MustStop flushes the pending series to pushBlock.
+	deadLetterRWCtx.pss[0].MustStop()
+	if s := strings.Join(deadLetterSeries, ","); s != "bar,baz" {
+		t.Fatalf("unexpected time series sent to dead-letter url; got %q; want %q", s, "bar,baz")
+	}
+	if n := rowsDeadLetterByRequiredLabels.Get() - deadLetterBefore; n != 2 {
+		t.Fatalf("unexpected number of dead-letter rows; got %d; want 2", n)
+	}
+	if n := rowsDroppedByRequiredLabels.Get() - droppedBefore; n != 0 {
+		t.Fatalf("unexpected number of dropped rows in dead-letter mode; got %d; want 0", n)
+	}
+}
+
+func TestHasRequiredLabels(t *testing.T) {
+	f := func(labels []prompbmarshal.Label, requiredLabels []string, resultExpected bool) {
+		t.Helper()
+		result := hasRequiredLabels(labels, requiredLabels)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for hasRequiredLabels(%v, %q); got %v; want %v", labels, requiredLabels, result, resultExpected)
+		}
+	}
+	labels := []prompbmarshal.Label{
+		{Name: "__name__", Value: "foo"},
+		{Name: "team", Value: "infra"},
+		{Name: "env", Value: ""},
+	}
+	f(labels, nil, true)
+	f(labels, []string{"team"}, true)
+	f(labels, []string{"team", "__name__"}, true)
+	f(labels, []string{"team", "owner"}, false)
+	f(labels, []string{"env"}, false)
+	f(nil, []string{"team"}, false)
+}
@@ -0,0 +1,75 @@
+package remotewrite
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+var (
+	retryMinInterval = flagutil.NewArrayDuration("remoteWrite.retryMinInterval", "The minimum delay between retry attempts to send a block of data to the corresponding -remoteWrite.url. "+
+		"Every subsequent retry attempt doubles the delay until it reaches -remoteWrite.retryMaxInterval. Default value: 1s")
+	retryMaxInterval = flagutil.NewArrayDuration("remoteWrite.retryMaxInterval", "The maximum delay between retry attempts to send a block of data to the corresponding -remoteWrite.url. "+
+		"Default value: 1m")
+	retryJitterPercent = flagutil.NewArrayInt("remoteWrite.retryJitterPercent", "The percentage of random jitter applied to the delay between retry attempts to send a block of data "+
+		"to the corresponding -remoteWrite.url. The jitter spreads retries from many vmagent instances after remote storage outage. Default value: 10")
+	retryMaxTime = flagutil.NewArrayDuration("remoteWrite.retryMaxTime", "The maximum duration for retrying to send a block of data to the corresponding -remoteWrite.url. "+
+		"The block is dropped if it cannot be sent during this time. The number of dropped blocks is exposed via vmagent_remotewrite_packets_dropped_total metric. "+
+		"By default the block is retried until it is sent")
+)
+
+// retryPolicy holds settings for retrying failed requests to remote storage.
+type retryPolicy struct {
+	minInterval time.Duration
+	maxInterval time.Duration
+
+	// jitter is the fraction of the delay, which may be randomly subtracted from it. It must be in the range [0..1].
+	jitter float64
+
+	// maxTime is the maximum duration for retrying the same block. Zero means retrying indefinitely.
+	maxTime time.Duration
+}
+
+func getRetryPolicy(argIdx int) *retryPolicy {
+	rp := &retryPolicy{
+		minInterval: retryMinInterval.GetOptionalArgOrDefault(argIdx, time.Second),
+		maxInterval: retryMaxInterval.GetOptionalArgOrDefault(argIdx, time.Minute),
+		jitter:      float64(retryJitterPercent.GetOptionalArgOrDefault(argIdx, 10)) / 100,
+		maxTime:     retryMaxTime.GetOptionalArgOrDefault(argIdx, 0),
+	}
+	if rp.minInterval <= 0 {
+		logger.Fatalf("-remoteWrite.retryMinInterval must be positive; got %s", rp.minInterval)
+	}
+	if rp.maxInterval < rp.minInterval {
+		logger.Fatalf("-remoteWrite.retryMaxInterval=%s cannot be smaller than -remoteWrite.retryMinInterval=%s", rp.maxInterval, rp.minInterval)
+	}
+	if rp.jitter < 0 || rp.jitter > 1 {
+		logger.Fatalf("-remoteWrite.retryJitterPercent must be in the range [0..100]; got %.0f", rp.jitter*100)
+	}
+	return rp
+}
+
+// backoff returns the delay before the given retry attempt starting from 1.
+func (rp *retryPolicy) backoff(attempt int) time.Duration {
+	d := rp.minInterval
+	for i := 1; i < attempt && d < rp.maxInterval; i++ {
+		d *= 2
+	}
+	if d > rp.maxInterval {
+		d = rp.maxInterval
+	}
+	if rp.jitter > 0 {
+		d -= time.Duration(rp.jitter * rand.Float64() * float64(d))
+	}
+	return d
+}
+
+// isExhausted returns true if the retry after the given delay exceeds rp.maxTime since the startTime.
+func (rp *retryPolicy) isExhausted(startTime time.Time, delay time.Duration) bool {
+	if rp.maxTime <= 0 {
+		return false
+	}
+	return time.Since(startTime)+delay > rp.maxTime
+}
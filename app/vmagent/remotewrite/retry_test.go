@@ -0,0 +1,157 @@
+package remotewrite
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	f := func(rp *retryPolicy, attempt int, minExpected, maxExpected time.Duration) {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			d := rp.backoff(attempt)
+			if d < minExpected || d > maxExpected {
+				t.Fatalf("unexpected backoff for attempt #%d; got %s; want in the range [%s..%s]", attempt, d, minExpected, maxExpected)
+			}
+		}
+	}
+
+	// Without jitter
+	rp := &retryPolicy{
+		minInterval: time.Second,
+		maxInterval: 10 * time.Second,
+	}
+	f(rp, 1, time.Second, time.Second)
+	f(rp, 2, 2*time.Second, 2*time.Second)
+	f(rp, 3, 4*time.Second, 4*time.Second)
+	f(rp, 4, 8*time.Second, 8*time.Second)
+	f(rp, 5, 10*time.Second, 10*time.Second)
+	f(rp, 1000, 10*time.Second, 10*time.Second)
+
+	// With jitter
+	rp.jitter = 0.2
+	f(rp, 1, 800*time.Millisecond, time.Second)
+	f(rp, 3, 3200*time.Millisecond, 4*time.Second)
+	f(rp, 1000, 8*time.Second, 10*time.Second)
+}
+
+func TestRetryPolicyIsExhausted(t *testing.T) {
+	rp := &retryPolicy{}
+	if rp.isExhausted(time.Now().Add(-time.Hour), time.Hour) {
+		t.Fatalf("retries must be never exhausted if maxTime isn't set")
+	}
+	rp.maxTime = time.Minute
+	if rp.isExhausted(time.Now(), time.Second) {
+		t.Fatalf("retries mustn't be exhausted before maxTime")
+	}
+	if !rp.isExhausted(time.Now().Add(-50*time.Second), 20*time.Second) {
+		t.Fatalf("retries must be exhausted if the next retry exceeds maxTime")
+	}
+}
+
+func TestClientSendBlockHTTPRetries(t *testing.T) {
+	newTestClient := func(name, url string, rp *retryPolicy) *client {
+		newCounter := func(metricName string) *metrics.Counter {
+			return metrics.GetOrCreateCounter(fmt.Sprintf(`%s{test=%q}`, metricName, name))
+		}
+		return &client{
+			sanitizedURL:    url,
+			remoteWriteURL:  url,
+			hc:              &http.Client{},
+			authCfg:         &promauth.Config{},
+			retryPolicy:     rp,
+			bytesSent:       newCounter("test_remotewrite_bytes_sent_total"),
+			blocksSent:      newCounter("test_remotewrite_blocks_sent_total"),
+			requestDuration: metrics.GetOrCreateHistogram(fmt.Sprintf(`test_remotewrite_duration_seconds{test=%q}`, name)),
+			requestsOKCount: newCounter("test_remotewrite_requests_total"),
+			errorsCount:     newCounter("test_remotewrite_errors_total"),
+			packetsDropped:  newCounter("test_remotewrite_packets_dropped_total"),
+			retriesCount:    newCounter("test_remotewrite_retries_count_total"),
+			stopCh:          make(chan struct{}),
+		}
+	}
+
+	// Flapping endpoint, which fails the first requests and then accepts the data.
+	var requests uint64
+	flapping := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddUint64(&requests, 1) <= 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer flapping.Close()
+
+	rp := &retryPolicy{
+		minInterval: 10 * time.Millisecond,
+		maxInterval: 40 * time.Millisecond,
+		jitter:      0.5,
+		maxTime:     10 * time.Second,
+	}
+	c := newTestClient("flapping", flapping.URL, rp)
+	startTime := time.Now()
+	if !c.sendBlockHTTP([]byte("foobar")) {
+		t.Fatalf("sendBlockHTTP must return true")
+	}
+	d := time.Since(startTime)
+	// The minimum sum of delays for 3 retries with 50% jitter is (10ms+20ms+40ms)/2
+	if minDuration := 35 * time.Millisecond; d < minDuration {
+		t.Fatalf("too small duration for 3 retries; got %s; want at least %s", d, minDuration)
+	}
+	if n := atomic.LoadUint64(&requests); n != 4 {
+		t.Fatalf("unexpected number of requests; got %d; want 4", n)
+	}
+	if n := c.retriesCount.Get(); n != 3 {
+		t.Fatalf("unexpected number of retries; got %d; want 3", n)
+	}
+	if n := c.requestsOKCount.Get(); n != 1 {
+		t.Fatalf("unexpected number of successful requests; got %d; want 1", n)
+	}
+	if n := c.packetsDropped.Get(); n != 0 {
+		t.Fatalf("unexpected number of dropped blocks; got %d; want 0", n)
+	}
+
+	// Endpoint, which is always down. The block must be dropped after rp.maxTime.
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	rp = &retryPolicy{
+		minInterval: 10 * time.Millisecond,
+		maxInterval: 20 * time.Millisecond,
+		maxTime:     100 * time.Millisecond,
+	}
+	c = newTestClient("down", down.URL, rp)
+	startTime = time.Now()
+	if !c.sendBlockHTTP([]byte("foobar")) {
+		t.Fatalf("sendBlockHTTP must return true")
+	}
+	if d := time.Since(startTime); d > rp.maxTime {
+		t.Fatalf("the block must be dropped before maxTime=%s; got %s", rp.maxTime, d)
+	}
+	if n := c.packetsDropped.Get(); n != 1 {
+		t.Fatalf("unexpected number of dropped blocks; got %d; want 1", n)
+	}
+	if n := c.requestsOKCount.Get(); n != 0 {
+		t.Fatalf("unexpected number of successful requests; got %d; want 0", n)
+	}
+
+	// Stopped client must return false while waiting for the retry.
+	rp = &retryPolicy{
+		minInterval: time.Hour,
+		maxInterval: time.Hour,
+	}
+	c = newTestClient("stopped", down.URL, rp)
+	close(c.stopCh)
+	if c.sendBlockHTTP([]byte("foobar")) {
+		t.Fatalf("sendBlockHTTP must return false for stopped client")
+	}
+}
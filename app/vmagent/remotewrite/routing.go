@@ -0,0 +1,175 @@
+package remotewrite
+
+import (
+	"flag"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envtemplate"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+	"gopkg.in/yaml.v2"
+)
+
+var routingConfigPath = flag.String("remoteWrite.routingConfig", "", "Optional path to file with routing rules for sending series to the particular -remoteWrite.url targets. "+
+	"The path can point either to local file or to http url. The rules are applied after the relabeling with -remoteWrite.relabelConfig. "+
+	"See https://docs.victoriametrics.com/vmagent.html#routing-among-remote-storages")
+
+// routingConfig is the config for -remoteWrite.routingConfig
+type routingConfig struct {
+	Routes []routeConfig `yaml:"routes"`
+
+	// DefaultURLs contains 1-based indexes of -remoteWrite.url targets for series, which do not match any route.
+	// Such series are sent to all the -remoteWrite.url targets if DefaultURLs is empty.
+	DefaultURLs []int `yaml:"default_urls,omitempty"`
+}
+
+// routeConfig is a single route in routingConfig.
+type routeConfig struct {
+	Match *promrelabel.IfExpression `yaml:"match"`
+
+	// URLs contains 1-based indexes of -remoteWrite.url targets for series matching Match.
+	URLs []int `yaml:"urls"`
+}
+
+// routingRules contains parsed routingConfig.
+type routingRules struct {
+	routes      []route
+	defaultURLs []int
+
+	// urlsCount is the number of remote storage urls the rules were parsed for.
+	urlsCount int
+}
+
+type route struct {
+	match *promrelabel.IfExpression
+
+	// urls contains 0-based indexes of -remoteWrite.url targets.
+	urls []int
+}
+
+// CheckRoutingConfig checks -remoteWrite.routingConfig.
+func CheckRoutingConfig() error {
+	_, err := loadRoutingConfig()
+	return err
+}
+
+func loadRoutingConfig() (*routingRules, error) {
+	if *routingConfigPath == "" {
+		return nil, nil
+	}
+	data, err := fs.ReadFileOrHTTP(*routingConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read -remoteWrite.routingConfig=%q: %w", *routingConfigPath, err)
+	}
+	data = envtemplate.Replace(data)
+	rr, err := parseRoutingConfig(data, len(getRemoteWriteURLs()))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -remoteWrite.routingConfig=%q: %w", *routingConfigPath, err)
+	}
+	return rr, nil
+}
+
+func parseRoutingConfig(data []byte, urlsCount int) (*routingRules, error) {
+	var rc routingConfig
+	if err := yaml.UnmarshalStrict(data, &rc); err != nil {
+		return nil, err
+	}
+	if len(rc.Routes) == 0 {
+		return nil, fmt.Errorf("missing `routes` section")
+	}
+	var rr routingRules
+	for i, r := range rc.Routes {
+		if r.Match == nil {
+			return nil, fmt.Errorf("missing `match` in route #%d", i+1)
+		}
+		urls, err := getURLIndexes(r.URLs, urlsCount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid `urls` in route #%d: %w", i+1, err)
+		}
+		if len(urls) == 0 {
+			return nil, fmt.Errorf("missing `urls` in route #%d", i+1)
+		}
+		rr.routes = append(rr.routes, route{
+			match: r.Match,
+			urls:  urls,
+		})
+	}
+	defaultURLs, err := getURLIndexes(rc.DefaultURLs, urlsCount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid `default_urls`: %w", err)
+	}
+	if len(defaultURLs) == 0 {
+		for i := 0; i < urlsCount; i++ {
+			defaultURLs = append(defaultURLs, i)
+		}
+	}
+	rr.defaultURLs = defaultURLs
+	rr.urlsCount = urlsCount
+	return &rr, nil
+}
+
+// getURLIndexes converts 1-based url indexes to 0-based indexes.
+func getURLIndexes(urls []int, urlsCount int) ([]int, error) {
+	var dst []int
+	for _, n := range urls {
+		if n < 1 || n > urlsCount {
+			return nil, fmt.Errorf("url index %d must be in the range [1..%d] according to the number of -remoteWrite.url or -remoteWrite.multitenantURL args", n, urlsCount)
+		}
+		dst = append(dst, n-1)
+	}
+	return dst, nil
+}
+
+// routeTimeseries appends series from tss to dst according to rr.
+//
+// A series is appended to dst[i] if the i-th -remoteWrite.url is set in any matching route.
+// A series is appended only once to every dst[i] even if it matches multiple routes with the same url.
+// Series without matching routes are appended to dst items for rr.defaultURLs.
+//
+// len(dst) must match the number of urls rr was parsed for.
+func (rr *routingRules) routeTimeseries(dst [][]prompbmarshal.TimeSeries, tss []prompbmarshal.TimeSeries) {
+	if len(dst) != rr.urlsCount {
+		logger.Panicf("BUG: len(dst)=%d must match the number of urls in routing rules=%d", len(dst), rr.urlsCount)
+	}
+	seen := make([]bool, len(dst))
+	for _, ts := range tss {
+		for i := range seen {
+			seen[i] = false
+		}
+		matched := false
+		for _, r := range rr.routes {
+			if !r.match.Match(ts.Labels) {
+				continue
+			}
+			matched = true
+			for _, idx := range r.urls {
+				if !seen[idx] {
+					seen[idx] = true
+					dst[idx] = append(dst[idx], ts)
+				}
+			}
+		}
+		if matched {
+			continue
+		}
+		for _, idx := range rr.defaultURLs {
+			if !seen[idx] {
+				seen[idx] = true
+				dst[idx] = append(dst[idx], ts)
+			}
+		}
+	}
+}
+
+// pushBlockToRoutedRemoteStorages pushes series from tssBlock to rwctxs according to rr.
+func pushBlockToRoutedRemoteStorages(rwctxs []*remoteWriteCtx, tssBlock []prompbmarshal.TimeSeries, rr *routingRules) {
+	blocks := make([][]prompbmarshal.TimeSeries, len(rwctxs))
+	rr.routeTimeseries(blocks, tssBlock)
+	pushBlocksPerRemoteStorage(rwctxs, blocks)
+}
+
+// routingRulesGlobal contains the current *routingRules loaded from -remoteWrite.routingConfig.
+var routingRulesGlobal atomic.Value
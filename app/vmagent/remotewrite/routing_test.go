@@ -0,0 +1,197 @@
+package remotewrite
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+func TestParseRoutingConfigFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+		rr, err := parseRoutingConfig([]byte(data), 2)
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if rr != nil {
+			t.Fatalf("expecting nil rr")
+		}
+	}
+	// Empty config
+	f(``)
+	// Invalid yaml
+	f(`foobar`)
+	// Unknown field
+	f(`
+routes:
+- match: foo
+  urls: [1]
+  foo: bar
+`)
+	// Missing match
+	f(`
+routes:
+- urls: [1]
+`)
+	// Invalid match
+	f(`
+routes:
+- match: '{'
+  urls: [1]
+`)
+	// Missing urls
+	f(`
+routes:
+- match: foo
+`)
+	// Too big url index
+	f(`
+routes:
+- match: foo
+  urls: [3]
+`)
+	// Zero url index
+	f(`
+routes:
+- match: foo
+  urls: [0]
+`)
+	// Invalid default_urls
+	f(`
+routes:
+- match: foo
+  urls: [1]
+default_urls: [5]
+`)
+}
+
+func TestRoutingRulesRouteTimeseries(t *testing.T) {
+	f := func(config string, urlsCount int, metricNames []string, resultExpected [][]string) {
+		t.Helper()
+		rr, err := parseRoutingConfig([]byte(config), urlsCount)
+		if err != nil {
+			t.Fatalf("cannot parse routing config: %s", err)
+		}
+		tss := make([]prompbmarshal.TimeSeries, len(metricNames))
+		for i, name := range metricNames {
+			tss[i].Labels = []prompbmarshal.Label{
+				{
+					Name:  "__name__",
+					Value: name,
+				},
+				{
+					Name:  "job",
+					Value: "test",
+				},
+			}
+		}
+		dst := make([][]prompbmarshal.TimeSeries, urlsCount)
+		rr.routeTimeseries(dst, tss)
+		result := make([][]string, urlsCount)
+		for i, tss := range dst {
+			for _, ts := range tss {
+				result[i] = append(result[i], ts.Labels[0].Value)
+			}
+		}
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected result\ngot\n%q\nwant\n%q", result, resultExpected)
+		}
+	}
+
+	// Series without matching routes are sent to all the urls
+	f(`
+routes:
+- match: '{__name__=~"slo_.*"}'
+  urls: [1]
+`, 2, []string{"slo_foo", "bar", "slo_baz"}, [][]string{
+		{"slo_foo", "bar", "slo_baz"},
+		{"bar"},
+	})
+
+	// Series without matching routes are sent to default_urls
+	f(`
+routes:
+- match: '{__name__=~"slo_.*"}'
+  urls: [1]
+default_urls: [2]
+`, 2, []string{"slo_foo", "bar", "slo_baz"}, [][]string{
+		{"slo_foo", "slo_baz"},
+		{"bar"},
+	})
+
+	// Series matching multiple routes are sent to the union of urls
+	f(`
+routes:
+- match: '{__name__=~"slo_.*"}'
+  urls: [1]
+- match: '{job="test", __name__=~".*_errors"}'
+  urls: [1, 2]
+- match: 'foo'
+  urls: [3]
+default_urls: [3]
+`, 3, []string{"slo_errors", "http_errors", "foo", "bar"}, [][]string{
+		{"slo_errors", "http_errors"},
+		{"slo_errors", "http_errors"},
+		{"foo", "bar"},
+	})
+}
+
+func TestLoadRoutingConfigMultitenantURLs(t *testing.T) {
+	f, err := ioutil.TempFile("", "routing_config")
+	if err != nil {
+		t.Fatalf("cannot create temporary file: %s", err)
+	}
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+	if _, err := f.WriteString(`
+routes:
+- match: '{__name__=~"slo_.*"}'
+  urls: [2]
+`); err != nil {
+		t.Fatalf("cannot write routing config: %s", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("cannot close routing config: %s", err)
+	}
+
+	origRoutingConfigPath := *routingConfigPath
+	origMultitenantURLs := *remoteWriteMultitenantURLs
+	defer func() {
+		*routingConfigPath = origRoutingConfigPath
+		*remoteWriteMultitenantURLs = origMultitenantURLs
+	}()
+	*routingConfigPath = f.Name()
+	*remoteWriteMultitenantURLs = []string{"http://foo/", "http://bar/"}
+
+	rr, err := loadRoutingConfig()
+	if err != nil {
+		t.Fatalf("cannot load routing config: %s", err)
+	}
+	// Per-tenant remote storages are created for every -remoteWrite.multitenantURL.
+	dst := make([][]prompbmarshal.TimeSeries, len(getRemoteWriteURLs()))
+	tss := []prompbmarshal.TimeSeries{
+		{
+			Labels: []prompbmarshal.Label{{Name: "__name__", Value: "slo_foo"}},
+		},
+		{
+			Labels: []prompbmarshal.Label{{Name: "__name__", Value: "bar"}},
+		},
+	}
+	rr.routeTimeseries(dst, tss)
+	if len(dst[0]) != 1 || dst[0][0].Labels[0].Value != "bar" {
+		t.Fatalf("unexpected series routed to the first url: %v", dst[0])
+	}
+	if len(dst[1]) != 2 {
+		t.Fatalf("unexpected number of series routed to the second url; got %d; want 2", len(dst[1]))
+	}
+
+	// Urls outside -remoteWrite.multitenantURL list must be rejected.
+	*remoteWriteMultitenantURLs = []string{"http://foo/"}
+	if _, err := loadRoutingConfig(); err == nil {
+		t.Fatalf("expecting non-nil error for url index outside -remoteWrite.multitenantURL list")
+	}
+}
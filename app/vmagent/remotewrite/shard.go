@@ -0,0 +1,60 @@
+package remotewrite
+
+import (
+	"encoding/binary"
+	"flag"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	xxhash "github.com/cespare/xxhash/v2"
+)
+
+var shardByURL = flag.Bool("remoteWrite.shardByURL", false, "Whether to shard outgoing series across all the -remoteWrite.url targets instead of replicating them to all the targets. "+
+	"Every series is consistently sent to a single -remoteWrite.url target, which is selected by hash of the series labels. "+
+	"See https://docs.victoriametrics.com/vmagent.html#sharding-among-remote-storages")
+
+// getShardIdx returns the index of seeds for the series with the given labelsHash.
+//
+// It uses rendezvous hashing, so the series are remapped only from the removed shard when the shard is removed from seeds.
+// See https://en.wikipedia.org/wiki/Rendezvous_hashing
+func getShardIdx(labelsHash uint64, seeds []uint64) int {
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[:8], labelsHash)
+	idx := 0
+	var maxWeight uint64
+	for i, seed := range seeds {
+		binary.LittleEndian.PutUint64(buf[8:], seed)
+		w := xxhash.Sum64(buf[:])
+		if i == 0 || w > maxWeight {
+			maxWeight = w
+			idx = i
+		}
+	}
+	return idx
+}
+
+// getShardingLabelsHash returns hash for the given labels, which doesn't depend on the order of labels.
+//
+// This guarantees that the series is sent to the same shard even if its labels are passed in different order.
+func getShardingLabelsHash(labels []prompbmarshal.Label) uint64 {
+	bb := labelsHashBufPool.Get()
+	var h uint64
+	for _, label := range labels {
+		bb.B = append(bb.B[:0], label.Name...)
+		bb.B = append(bb.B, '=')
+		bb.B = append(bb.B, label.Value...)
+		h += xxhash.Sum64(bb.B)
+	}
+	labelsHashBufPool.Put(bb)
+	return h
+}
+
+// shardTimeseries appends tss to shards according to getShardIdx for the given seeds.
+//
+// len(shards) must be equal to len(seeds).
+func shardTimeseries(shards [][]prompbmarshal.TimeSeries, tss []prompbmarshal.TimeSeries, seeds []uint64) {
+	for _, ts := range tss {
+		h := getShardingLabelsHash(ts.Labels)
+		idx := getShardIdx(h, seeds)
+		shards[idx] = append(shards[idx], ts)
+	}
+}
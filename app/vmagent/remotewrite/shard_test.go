@@ -0,0 +1,96 @@
+package remotewrite
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+func TestShardTimeseries(t *testing.T) {
+	newTimeseries := func(n int) []prompbmarshal.TimeSeries {
+		tss := make([]prompbmarshal.TimeSeries, n)
+		for i := range tss {
+			tss[i].Labels = []prompbmarshal.Label{
+				{
+					Name:  "__name__",
+					Value: "foo",
+				},
+				{
+					Name:  "instance",
+					Value: fmt.Sprintf("host-%d", i),
+				},
+			}
+		}
+		return tss
+	}
+	getShards := func(tss []prompbmarshal.TimeSeries, seeds []uint64) map[string]int {
+		shards := make([][]prompbmarshal.TimeSeries, len(seeds))
+		shardTimeseries(shards, tss, seeds)
+		m := make(map[string]int)
+		for i, shard := range shards {
+			for _, ts := range shard {
+				key := labelsToString(ts.Labels)
+				if _, ok := m[key]; ok {
+					t.Fatalf("series %s is sent to multiple shards", key)
+				}
+				m[key] = i
+			}
+		}
+		if len(m) != len(tss) {
+			t.Fatalf("unexpected number of sharded series; got %d; want %d", len(m), len(tss))
+		}
+		return m
+	}
+
+	const seriesCount = 10000
+	tss := newTimeseries(seriesCount)
+	for shardsCount := 1; shardsCount <= 5; shardsCount++ {
+		seeds := make([]uint64, shardsCount)
+		for i := range seeds {
+			seeds[i] = uint64(i*1000 + 123)
+		}
+		m := getShards(tss, seeds)
+
+		// Series must be sent to the same shards on subsequent calls
+		if m2 := getShards(tss, seeds); !reflect.DeepEqual(m, m2) {
+			t.Fatalf("unstable sharding for %d shards", shardsCount)
+		}
+
+		// Series must be evenly distributed among shards
+		counts := make([]int, shardsCount)
+		for _, idx := range m {
+			counts[idx]++
+		}
+		for i, n := range counts {
+			expected := seriesCount / shardsCount
+			if n < expected*8/10 || n > expected*12/10 {
+				t.Fatalf("uneven sharding for %d shards; shard #%d got %d series; expecting around %d series", shardsCount, i, n, expected)
+			}
+		}
+
+		if shardsCount < 2 {
+			continue
+		}
+		// Removing the last shard must remap only series from this shard
+		mLess := getShards(tss, seeds[:shardsCount-1])
+		for key, idx := range m {
+			if idx != shardsCount-1 && mLess[key] != idx {
+				t.Fatalf("series %s has been moved from shard #%d to shard #%d after removing shard #%d", key, idx, mLess[key], shardsCount-1)
+			}
+		}
+	}
+
+	// The order of labels mustn't affect the shard
+	seeds := []uint64{1, 2, 3, 4, 5, 6, 7, 8}
+	for _, ts := range tss[:100] {
+		labels := ts.Labels
+		reversed := []prompbmarshal.Label{labels[1], labels[0]}
+		idx := getShardIdx(getShardingLabelsHash(labels), seeds)
+		idxReversed := getShardIdx(getShardingLabelsHash(reversed), seeds)
+		if idx != idxReversed {
+			t.Fatalf("the shard for series %s depends on labels order; got %d and %d", labelsToString(labels), idx, idxReversed)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package remotewrite
+
+import (
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/tenantmetrics"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// tenantIDLabelName is the label name, which can be set via relabeling in order to route samples
+// to the given tenant when -remoteWrite.multitenantURL is set.
+//
+// The label value must be in the form accountID or accountID:projectID.
+// See https://docs.victoriametrics.com/vmagent.html#multitenancy
+const tenantIDLabelName = "__tenant_id__"
+
+var rowsDroppedByInvalidTenantID = metrics.NewCounter(`vmagent_remotewrite_invalid_tenant_id_dropped_rows_total`)
+
+var invalidTenantIDLogger = logger.WithThrottler("invalid_tenant_id", 5*time.Second)
+
+// tenantBlock contains time series, which must be sent to the given tenant.
+type tenantBlock struct {
+	tenantID tenantmetrics.TenantID
+	tss      []prompbmarshal.TimeSeries
+}
+
+// pushBlockToTenants pushes tssBlock to remote storage systems for tenants from the __tenant_id__ label.
+//
+// Time series without the __tenant_id__ label are pushed to rwctxs, which belong to the tenant from at.
+func pushBlockToTenants(at *auth.Token, rwctxs []*remoteWriteCtx, tssBlock []prompbmarshal.TimeSeries) {
+	if !hasTenantIDLabel(tssBlock) {
+		pushBlockToRemoteStorages(rwctxs, tssBlock)
+		return
+	}
+	defaultTenantID := tenantmetrics.TenantID{
+		AccountID: at.AccountID,
+		ProjectID: at.ProjectID,
+	}
+	tbs := splitByTenantID(tssBlock, defaultTenantID)
+	for _, tb := range tbs {
+		if tb.tenantID == defaultTenantID {
+			pushBlockToRemoteStorages(rwctxs, tb.tss)
+			continue
+		}
+		tbAt := &auth.Token{
+			AccountID: tb.tenantID.AccountID,
+			ProjectID: tb.tenantID.ProjectID,
+		}
+		pushBlockToRemoteStorages(getTenantRemoteWriteCtxs(tbAt), tb.tss)
+	}
+}
+
+func hasTenantIDLabel(tss []prompbmarshal.TimeSeries) bool {
+	for i := range tss {
+		for _, label := range tss[i].Labels {
+			if label.Name == tenantIDLabelName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// removeTenantIDLabels removes the __tenant_id__ label from tss in place.
+func removeTenantIDLabels(tss []prompbmarshal.TimeSeries) {
+	for i := range tss {
+		ts := &tss[i]
+		if promrelabel.GetLabelByName(ts.Labels, tenantIDLabelName) == nil {
+			continue
+		}
+		labels := ts.Labels[:0]
+		for _, label := range ts.Labels {
+			if label.Name != tenantIDLabelName {
+				labels = append(labels, label)
+			}
+		}
+		ts.Labels = labels
+	}
+}
+
+// splitByTenantID splits tss into blocks per each tenant from the __tenant_id__ label and removes the label.
+//
+// Time series without the __tenant_id__ label are put to the block for defaultTenantID.
+// Time series with invalid __tenant_id__ label are dropped.
+// Blocks are returned in the order of the first appearance of the tenant in tss.
+func splitByTenantID(tss []prompbmarshal.TimeSeries, defaultTenantID tenantmetrics.TenantID) []tenantBlock {
+	var tbs []tenantBlock
+	m := make(map[tenantmetrics.TenantID]int)
+	for _, ts := range tss {
+		tenantID := defaultTenantID
+		labels := ts.Labels[:0]
+		tenantIDValue := ""
+		for _, label := range ts.Labels {
+			if label.Name == tenantIDLabelName {
+				tenantIDValue = label.Value
+				continue
+			}
+			labels = append(labels, label)
+		}
+		ts.Labels = labels
+		if tenantIDValue != "" {
+			at, err := auth.NewToken(tenantIDValue)
+			if err != nil {
+				invalidTenantIDLogger.Warnf("dropping series with invalid %s=%q label: %s", tenantIDLabelName, tenantIDValue, err)
+				rowsDroppedByInvalidTenantID.Add(len(ts.Samples))
+				continue
+			}
+			tenantID = tenantmetrics.TenantID{
+				AccountID: at.AccountID,
+				ProjectID: at.ProjectID,
+			}
+		}
+		idx, ok := m[tenantID]
+		if !ok {
+			idx = len(tbs)
+			m[tenantID] = idx
+			tbs = append(tbs, tenantBlock{
+				tenantID: tenantID,
+			})
+		}
+		tbs[idx].tss = append(tbs[idx].tss, ts)
+	}
+	return tbs
+}
+
+// finalizeLabelsWithTenantID works like promrelabel.FinalizeLabels, but preserves the __tenant_id__ label.
+func finalizeLabelsWithTenantID(dst, src []prompbmarshal.Label) []prompbmarshal.Label {
+	for i := range src {
+		label := &src[i]
+		name := label.Name
+		if strings.HasPrefix(name, "__") && name != "__name__" && name != tenantIDLabelName {
+			continue
+		}
+		dst = append(dst, *label)
+	}
+	return dst
+}
@@ -0,0 +1,139 @@
+package remotewrite
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/tenantmetrics"
+)
+
+func TestSplitByTenantID(t *testing.T) {
+	newTimeSeries := func(name string, labels ...string) prompbmarshal.TimeSeries {
+		ts := prompbmarshal.TimeSeries{
+			Labels: []prompbmarshal.Label{
+				{Name: "__name__", Value: name},
+			},
+			Samples: []prompbmarshal.Sample{{Value: 1, Timestamp: 1000}},
+		}
+		for i := 0; i < len(labels); i += 2 {
+			ts.Labels = append(ts.Labels, prompbmarshal.Label{
+				Name:  labels[i],
+				Value: labels[i+1],
+			})
+		}
+		return ts
+	}
+	tbsString := func(tbs []tenantBlock) string {
+		var a []string
+		for _, tb := range tbs {
+			var series []string
+			for _, ts := range tb.tss {
+				series = append(series, labelsToString(ts.Labels))
+			}
+			a = append(a, fmt.Sprintf("%d:%d=[%s]", tb.tenantID.AccountID, tb.tenantID.ProjectID, strings.Join(series, ",")))
+		}
+		return strings.Join(a, " ")
+	}
+
+	tss := []prompbmarshal.TimeSeries{
+		newTimeSeries("foo", "namespace", "dev"),
+		newTimeSeries("foo", "namespace", "prod", "__tenant_id__", "42"),
+		newTimeSeries("bar", "__tenant_id__", "42:7", "namespace", "prod"),
+		newTimeSeries("baz", "__tenant_id__", "42"),
+		newTimeSeries("invalid", "__tenant_id__", "foo"),
+		newTimeSeries("bar", "namespace", "dev"),
+	}
+	droppedBefore := rowsDroppedByInvalidTenantID.Get()
+	tbs := splitByTenantID(tss, tenantmetrics.TenantID{AccountID: 1, ProjectID: 2})
+	result := tbsString(tbs)
+	resultExpected := `1:2=[{__name__="foo",namespace="dev"},{__name__="bar",namespace="dev"}] 42:0=[{__name__="foo",namespace="prod"},{__name__="baz"}] 42:7=[{__name__="bar",namespace="prod"}]`
+	if result != resultExpected {
+		t.Fatalf("unexpected result;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+	if n := rowsDroppedByInvalidTenantID.Get() - droppedBefore; n != 1 {
+		t.Fatalf("unexpected number of dropped rows; got %d; want 1", n)
+	}
+}
+
+func TestApplyRelabelingKeepTenantID(t *testing.T) {
+	pcs, err := promrelabel.ParseRelabelConfigsData([]byte(`
+- source_labels: [namespace]
+  regex: prod
+  target_label: __tenant_id__
+  replacement: "42:1"
+- target_label: __tmp
+  replacement: x
+`), false)
+	if err != nil {
+		t.Fatalf("cannot parse relabel configs: %s", err)
+	}
+	f := func(keepTenantID bool, resultExpected string) {
+		t.Helper()
+		tss := []prompbmarshal.TimeSeries{
+			{
+				Labels: []prompbmarshal.Label{
+					{Name: "__name__", Value: "foo"},
+					{Name: "namespace", Value: "prod"},
+				},
+			},
+		}
+		var rctx relabelCtx
+		tss = rctx.applyRelabelingKeepTenantID(tss, nil, false, pcs, keepTenantID)
+		if len(tss) != 1 {
+			t.Fatalf("unexpected number of time series; got %d; want 1", len(tss))
+		}
+		result := labelsToString(tss[0].Labels)
+		if result != resultExpected {
+			t.Fatalf("unexpected labels;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+	f(false, `{__name__="foo",namespace="prod"}`)
+	f(true, `{__name__="foo",__tenant_id__="42:1",namespace="prod"}`)
+}
+
+func TestRemoveTenantIDLabels(t *testing.T) {
+	pcs, err := promrelabel.ParseRelabelConfigsData([]byte(`
+- source_labels: [namespace]
+  regex: prod
+  target_label: __tenant_id__
+  replacement: "42:1"
+`), false)
+	if err != nil {
+		t.Fatalf("cannot parse relabel configs: %s", err)
+	}
+	tss := []prompbmarshal.TimeSeries{
+		{
+			Labels: []prompbmarshal.Label{
+				{Name: "__name__", Value: "foo"},
+				{Name: "__tenant_id__", Value: "100"},
+				{Name: "namespace", Value: "dev"},
+			},
+		},
+		{
+			Labels: []prompbmarshal.Label{
+				{Name: "__name__", Value: "bar"},
+				{Name: "__tenant_id__", Value: "100"},
+				{Name: "namespace", Value: "prod"},
+			},
+		},
+	}
+	// The __tenant_id__ label sent by the client must be ignored, while the label set via relabeling must be used for routing.
+	removeTenantIDLabels(tss)
+	var rctx relabelCtx
+	tss = rctx.applyRelabelingKeepTenantID(tss, nil, false, pcs, true)
+	tbs := splitByTenantID(tss, tenantmetrics.TenantID{AccountID: 1, ProjectID: 2})
+	var a []string
+	for _, tb := range tbs {
+		for _, ts := range tb.tss {
+			a = append(a, fmt.Sprintf("%d:%d=%s", tb.tenantID.AccountID, tb.tenantID.ProjectID, labelsToString(ts.Labels)))
+		}
+	}
+	result := strings.Join(a, " ")
+	resultExpected := `1:2={__name__="foo",namespace="dev"} 42:1={__name__="bar",namespace="prod"}`
+	if result != resultExpected {
+		t.Fatalf("unexpected result;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"hash/fnv"
 	"sort"
@@ -30,6 +31,7 @@ type AlertingRule struct {
 	GroupID      uint64
 	GroupName    string
 	EvalInterval time.Duration
+	EvalTimeout  time.Duration
 
 	q datasource.Querier
 
@@ -53,10 +55,11 @@ type AlertingRule struct {
 }
 
 type alertingRuleMetrics struct {
-	errors  *utils.Gauge
-	pending *utils.Gauge
-	active  *utils.Gauge
-	samples *utils.Gauge
+	errors   *utils.Gauge
+	pending  *utils.Gauge
+	active   *utils.Gauge
+	samples  *utils.Gauge
+	timeouts *utils.Counter
 }
 
 func newAlertingRule(qb datasource.QuerierBuilder, group *Group, cfg config.Rule) *AlertingRule {
@@ -71,10 +74,12 @@ func newAlertingRule(qb datasource.QuerierBuilder, group *Group, cfg config.Rule
 		GroupID:      group.ID(),
 		GroupName:    group.Name,
 		EvalInterval: group.Interval,
+		EvalTimeout:  cfg.EvalTimeout.Duration(),
 		q: qb.BuildWithParams(datasource.QuerierParams{
 			DataSourceType:     &group.Type,
 			EvaluationInterval: group.Interval,
 			QueryParams:        group.Params,
+			Headers:            headersToMap(cfg.Headers),
 		}),
 		alerts:  make(map[uint64]*notifier.Alert),
 		metrics: &alertingRuleMetrics{},
@@ -120,6 +125,7 @@ func newAlertingRule(qb datasource.QuerierBuilder, group *Group, cfg config.Rule
 			defer ar.mu.RUnlock()
 			return float64(ar.lastExecSamples)
 		})
+	ar.metrics.timeouts = utils.GetOrCreateCounter(fmt.Sprintf(`vmalert_alerting_rules_eval_timeouts_total{%s}`, labels))
 	return ar
 }
 
@@ -129,6 +135,7 @@ func (ar *AlertingRule) Close() {
 	ar.metrics.pending.Unregister()
 	ar.metrics.errors.Unregister()
 	ar.metrics.samples.Unregister()
+	ar.metrics.timeouts.Unregister()
 }
 
 // String implements Stringer interface
@@ -242,7 +249,7 @@ const resolvedRetention = 15 * time.Minute
 // Based on the Querier results AlertingRule maintains notifier.Alerts
 func (ar *AlertingRule) Exec(ctx context.Context, ts time.Time) ([]prompbmarshal.TimeSeries, error) {
 	start := time.Now()
-	qMetrics, err := ar.q.Query(ctx, ar.Expr, ts)
+	qMetrics, err := queryWithTimeout(ctx, ar.q, ar.Expr, ts, ar.EvalTimeout)
 	ar.mu.Lock()
 	defer ar.mu.Unlock()
 
@@ -251,6 +258,9 @@ func (ar *AlertingRule) Exec(ctx context.Context, ts time.Time) ([]prompbmarshal
 	ar.lastExecError = err
 	ar.lastExecSamples = len(qMetrics)
 	if err != nil {
+		if errors.Is(err, errEvalTimeout) {
+			ar.metrics.timeouts.Inc()
+		}
 		return nil, fmt.Errorf("failed to execute query %q: %w", ar.Expr, err)
 	}
 
@@ -358,6 +368,7 @@ func (ar *AlertingRule) UpdateWith(r Rule) error {
 	ar.Labels = nr.Labels
 	ar.Annotations = nr.Annotations
 	ar.EvalInterval = nr.EvalInterval
+	ar.EvalTimeout = nr.EvalTimeout
 	ar.q = nr.q
 	return nil
 }
@@ -592,12 +603,20 @@ func (ar *AlertingRule) Restore(ctx context.Context, q datasource.Querier, lookb
 
 // alertsToSend walks through the current alerts of AlertingRule
 // and returns only those which should be sent to notifier.
+// Alerts which were sent less than debounce ago aren't sent
+// regardless of their state.
 // Isn't concurrent safe.
-func (ar *AlertingRule) alertsToSend(ts time.Time, resolveDuration, resendDelay time.Duration) []notifier.Alert {
+func (ar *AlertingRule) alertsToSend(ts time.Time, resolveDuration, resendDelay, debounce time.Duration) []notifier.Alert {
 	needsSending := func(a *notifier.Alert) bool {
 		if a.State == notifier.StatePending {
 			return false
 		}
+		if debounce > 0 && ts.Sub(a.LastSent) < debounce {
+			if a.ResolvedAt.After(a.LastSent) || a.LastSent.Add(resendDelay).Before(ts) {
+				alertsDebounced.Inc()
+			}
+			return false
+		}
 		if a.ResolvedAt.After(a.LastSent) {
 			return true
 		}
@@ -789,7 +789,7 @@ func TestAlertsToSend(t *testing.T) {
 		for i, a := range alerts {
 			ar.alerts[uint64(i)] = a
 		}
-		gotAlerts := ar.alertsToSend(ts, resolveDuration, resendDelay)
+		gotAlerts := ar.alertsToSend(ts, resolveDuration, resendDelay, 0)
 		if gotAlerts == nil && expAlerts == nil {
 			return
 		}
@@ -861,6 +861,50 @@ func TestAlertsToSend(t *testing.T) {
 	)
 }
 
+func TestAlertsToSendDebounce(t *testing.T) {
+	fq := &fakeQuerier{}
+	ar := newTestAlertingRule("flapping", 0)
+	ar.q = fq
+	ts := time.Now()
+	debounce := 5 * time.Minute
+
+	var sent []notifier.AlertState
+	f := func(offset time.Duration, firing bool) {
+		t.Helper()
+		fq.reset()
+		if firing {
+			fq.add(metricWithValueAndLabels(t, 1, "__name__", "foo"))
+		}
+		evalTS := ts.Add(offset)
+		if _, err := ar.Exec(context.Background(), evalTS); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		for _, a := range ar.alertsToSend(evalTS, time.Hour, 0, debounce) {
+			sent = append(sent, a.State)
+		}
+	}
+
+	// the alert flaps within the debounce window
+	f(0, true)
+	f(time.Minute, false)
+	f(2*time.Minute, true)
+	f(3*time.Minute, false)
+	f(4*time.Minute, true)
+	if len(sent) != 1 || sent[0] != notifier.StateFiring {
+		t.Fatalf("expecting a single firing notification within the debounce window; got %v", sent)
+	}
+
+	// the latest state is sent after the debounce window
+	f(6*time.Minute, false)
+	if len(sent) != 2 || sent[1] != notifier.StateInactive {
+		t.Fatalf("expecting resolved notification after the debounce window; got %v", sent)
+	}
+	f(7*time.Minute, false)
+	if len(sent) != 2 {
+		t.Fatalf("unexpected notifications for resolved alert; got %v", sent)
+	}
+}
+
 func newTestRuleWithLabels(name string, labels ...string) *AlertingRule {
 	r := newTestAlertingRule(name, 0)
 	r.Labels = make(map[string]string)
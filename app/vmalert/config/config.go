@@ -42,6 +42,13 @@ type Group struct {
 	Checksum string
 	// Optional HTTP URL parameters added to each rule request
 	Params url.Values `yaml:"params"`
+	// RemoteWriteURL is an optional URL for persisting recording rules results
+	// of the group instead of -remoteWrite.url.
+	RemoteWriteURL string `yaml:"remote_write_url,omitempty"`
+	// EvalTimeout is the default evaluation timeout for the group rules.
+	EvalTimeout *promutils.Duration `yaml:"eval_timeout,omitempty"`
+	// Headers is an optional list of HTTP headers added to each rule request
+	Headers []Header `yaml:"headers,omitempty"`
 
 	// Catches all undefined fields and must be empty after parsing.
 	XXX map[string]interface{} `yaml:",inline"`
@@ -89,6 +96,18 @@ func (g *Group) Validate(validateAnnotations, validateExpressions bool) error {
 	if g.Name == "" {
 		return fmt.Errorf("group name must be set")
 	}
+	if g.EvalTimeout.Duration() < 0 {
+		return fmt.Errorf("eval_timeout for group %q can't be negative", g.Name)
+	}
+	if g.RemoteWriteURL != "" {
+		u, err := url.Parse(g.RemoteWriteURL)
+		if err != nil {
+			return fmt.Errorf("invalid remote_write_url for group %q: %w", g.Name, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("invalid remote_write_url for group %q: unsupported scheme %q; supported schemes: http, https", g.Name, u.Scheme)
+		}
+	}
 
 	uniqueRules := map[uint64]struct{}{}
 	for _, r := range g.Rules {
@@ -133,6 +152,12 @@ type Rule struct {
 	For         *promutils.Duration `yaml:"for,omitempty"`
 	Labels      map[string]string   `yaml:"labels,omitempty"`
 	Annotations map[string]string   `yaml:"annotations,omitempty"`
+	// EvalTimeout limits the duration of rule evaluation.
+	// It overrides the eval_timeout of the group.
+	EvalTimeout *promutils.Duration `yaml:"eval_timeout,omitempty"`
+	// Headers is an optional list of HTTP headers added to the rule requests.
+	// It has priority over the group headers with the same name.
+	Headers []Header `yaml:"headers,omitempty"`
 
 	// Catches all undefined fields and must be empty after parsing.
 	XXX map[string]interface{} `yaml:",inline"`
@@ -174,9 +199,46 @@ func HashRule(r Rule) uint64 {
 		h.Write([]byte(i.value))
 		h.Write([]byte("\xff"))
 	}
+	// headers are hashed in order to distinguish rules
+	// with the same expression executed for different tenants
+	for _, hdr := range r.Headers {
+		h.Write([]byte("header"))
+		h.Write([]byte(hdr.Key))
+		h.Write([]byte(hdr.Value))
+		h.Write([]byte("\xff"))
+	}
 	return h.Sum64()
 }
 
+// Header is an HTTP header in the form of "Name: value"
+type Header struct {
+	Key   string
+	Value string
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (h *Header) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	n := strings.IndexByte(s, ':')
+	if n < 0 {
+		return fmt.Errorf("missing ':' in header %q; expecting the format 'Name: value'", s)
+	}
+	h.Key = strings.TrimSpace(s[:n])
+	h.Value = strings.TrimSpace(s[n+1:])
+	if h.Key == "" {
+		return fmt.Errorf("missing name in header %q; expecting the format 'Name: value'", s)
+	}
+	return nil
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (h Header) MarshalYAML() (interface{}, error) {
+	return h.Key + ": " + h.Value, nil
+}
+
 // Validate check for Rule configuration errors
 func (r *Rule) Validate() error {
 	if (r.Record == "" && r.Alert == "") || (r.Record != "" && r.Alert != "") {
@@ -185,6 +247,9 @@ func (r *Rule) Validate() error {
 	if r.Expr == "" {
 		return fmt.Errorf("expression can't be empty")
 	}
+	if r.EvalTimeout.Duration() < 0 {
+		return fmt.Errorf("eval_timeout can't be negative")
+	}
 	return checkOverflow(r.XXX, "rule")
 }
 
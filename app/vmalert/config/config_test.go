@@ -3,6 +3,7 @@ package config
 import (
 	"net/url"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -97,6 +98,67 @@ func TestGroup_Validate(t *testing.T) {
 			group:  &Group{},
 			expErr: "group name must be set",
 		},
+		{
+			group: &Group{Name: "test",
+				RemoteWriteURL: "ftp://vm:8428",
+				Rules: []Rule{
+					{
+						Record: "record",
+						Expr:   "up",
+					},
+				},
+			},
+			expErr: "invalid remote_write_url",
+		},
+		{
+			group: &Group{Name: "test",
+				EvalTimeout: promutils.NewDuration(-time.Second),
+				Rules: []Rule{
+					{
+						Record: "record",
+						Expr:   "up",
+					},
+				},
+			},
+			expErr: "eval_timeout for group",
+		},
+		{
+			group: &Group{Name: "test",
+				Rules: []Rule{
+					{
+						Record:      "record",
+						Expr:        "up",
+						EvalTimeout: promutils.NewDuration(-time.Second),
+					},
+				},
+			},
+			expErr: "eval_timeout can't be negative",
+		},
+		{
+			group: &Group{Name: "test",
+				EvalTimeout: promutils.NewDuration(10 * time.Second),
+				Rules: []Rule{
+					{
+						Record:      "record",
+						Expr:        "up",
+						EvalTimeout: promutils.NewDuration(time.Second),
+					},
+				},
+			},
+			expErr: "",
+		},
+		{
+			group: &Group{Name: "test",
+				RemoteWriteURL: "http://vm-long-term:8428",
+				Rules: []Rule{
+					{
+						Record: "record",
+						Expr:   "up",
+					},
+				},
+			},
+			expErr: "",
+		},
 		{
 			group: &Group{Name: "test",
 				Rules: []Rule{
@@ -386,6 +448,11 @@ func TestHashRule(t *testing.T) {
 			Rule{Alert: "alert", Expr: "up == 1"},
 			false,
 		},
+		{
+			Rule{Alert: "alert", Expr: "up == 1", Headers: []Header{{Key: "X-Scope-OrgID", Value: "foo"}}},
+			Rule{Alert: "alert", Expr: "up == 1", Headers: []Header{{Key: "X-Scope-OrgID", Value: "bar"}}},
+			false,
+		},
 	}
 	for i, tc := range testCases {
 		aID, bID := HashRule(tc.a), HashRule(tc.b)
@@ -556,3 +623,58 @@ rules:
 `, url.Values{"nocache": {"1"}, "extra_label": {"env=prod", "job=victoriametrics"}})
 	})
 }
+
+func TestGroupHeaders(t *testing.T) {
+	f := func(data string, expGroupHeaders, expRuleHeaders []Header) {
+		t.Helper()
+		var g Group
+		if err := yaml.Unmarshal([]byte(data), &g); err != nil {
+			t.Fatalf("failed to unmarshal: %s", err)
+		}
+		if !reflect.DeepEqual(g.Headers, expGroupHeaders) {
+			t.Fatalf("unexpected group headers; got %v; want %v", g.Headers, expGroupHeaders)
+		}
+		if !reflect.DeepEqual(g.Rules[0].Headers, expRuleHeaders) {
+			t.Fatalf("unexpected rule headers; got %v; want %v", g.Rules[0].Headers, expRuleHeaders)
+		}
+	}
+	f(`
+name: TestGroup
+rules:
+  - alert: ExampleAlertAlwaysFiring
+    expr: sum by(job) (up == 1)
+`, nil, nil)
+	f(`
+name: TestGroup
+headers:
+  - "X-Scope-OrgID: team-a"
+  - "X-Foo:bar:baz"
+rules:
+  - alert: ExampleAlertAlwaysFiring
+    expr: sum by(job) (up == 1)
+    headers:
+      - "X-Scope-OrgID: team-b"
+`, []Header{{Key: "X-Scope-OrgID", Value: "team-a"}, {Key: "X-Foo", Value: "bar:baz"}}, []Header{{Key: "X-Scope-OrgID", Value: "team-b"}})
+
+	fBad := func(data string) {
+		t.Helper()
+		var g Group
+		if err := yaml.Unmarshal([]byte(data), &g); err == nil {
+			t.Fatalf("expecting non-nil error for invalid headers")
+		}
+	}
+	fBad(`
+name: TestGroup
+headers: ["X-Scope-OrgID"]
+rules:
+  - alert: ExampleAlertAlwaysFiring
+    expr: sum by(job) (up == 1)
+`)
+	fBad(`
+name: TestGroup
+rules:
+  - alert: ExampleAlertAlwaysFiring
+    expr: sum by(job) (up == 1)
+    headers: [": foo"]
+`)
+}
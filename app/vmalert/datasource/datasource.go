@@ -22,6 +22,8 @@ type QuerierParams struct {
 	DataSourceType     *Type
 	EvaluationInterval time.Duration
 	QueryParams        url.Values
+	// Headers contains optional HTTP headers added to each request
+	Headers map[string]string
 }
 
 // Metric is the basic entity which should be return by datasource
@@ -24,6 +24,7 @@ type VMStorage struct {
 	dataSourceType     Type
 	evaluationInterval time.Duration
 	extraParams        url.Values
+	extraHeaders       map[string]string
 }
 
 // Clone makes clone of VMStorage, shares http client.
@@ -46,6 +47,7 @@ func (s *VMStorage) ApplyParams(params QuerierParams) *VMStorage {
 	}
 	s.evaluationInterval = params.EvaluationInterval
 	s.extraParams = params.QueryParams
+	s.extraHeaders = params.Headers
 	return s
 }
 
@@ -150,5 +152,8 @@ func (s *VMStorage) newRequestPOST() (*http.Request, error) {
 			req.Header.Set("Authorization", auth)
 		}
 	}
+	for k, v := range s.extraHeaders {
+		req.Header.Set(k, v)
+	}
 	return req, nil
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"hash/fnv"
+	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
@@ -19,6 +20,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
 	"github.com/VictoriaMetrics/metrics"
+	"github.com/VictoriaMetrics/metricsql"
 )
 
 // Group is an entity for grouping rules
@@ -36,6 +38,12 @@ type Group struct {
 	Labels map[string]string
 	Params url.Values
 
+	// RemoteWriteURL is an optional URL for persisting recording rules results instead of -remoteWrite.url
+	RemoteWriteURL string
+	// recordingRW is the client for RemoteWriteURL.
+	// It is set by manager before the group start.
+	recordingRW *remotewrite.Client
+
 	doneCh     chan struct{}
 	finishedCh chan struct{}
 	// channel accepts new Group obj
@@ -84,6 +92,37 @@ func mergeLabels(groupName, ruleName string, set1, set2 map[string]string) map[s
 	return r
 }
 
+// mergeHeaders merges the given headers.
+// set2 has priority over set1.
+func mergeHeaders(set1, set2 []config.Header) []config.Header {
+	var r []config.Header
+	for _, h := range set1 {
+		overridden := false
+		for _, h2 := range set2 {
+			if http.CanonicalHeaderKey(h.Key) == http.CanonicalHeaderKey(h2.Key) {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			r = append(r, h)
+		}
+	}
+	return append(r, set2...)
+}
+
+// headersToMap converts headers to the map suitable for datasource.QuerierParams
+func headersToMap(headers []config.Header) map[string]string {
+	if len(headers) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(headers))
+	for _, h := range headers {
+		m[h.Key] = h.Value
+	}
+	return m
+}
+
 func newGroup(cfg config.Group, qb datasource.QuerierBuilder, defaultInterval time.Duration, labels map[string]string) *Group {
 	g := &Group{
 		Type:        cfg.Type,
@@ -95,6 +134,8 @@ func newGroup(cfg config.Group, qb datasource.QuerierBuilder, defaultInterval ti
 		Params:      cfg.Params,
 		Labels:      cfg.Labels,
 
+		RemoteWriteURL: cfg.RemoteWriteURL,
+
 		doneCh:     make(chan struct{}),
 		finishedCh: make(chan struct{}),
 		updateCh:   make(chan *Group),
@@ -122,6 +163,15 @@ func newGroup(cfg config.Group, qb datasource.QuerierBuilder, defaultInterval ti
 			r.Labels = mergeLabels(g.Name, r.Name(), extraLabels, r.Labels)
 		}
 
+		// apply group headers, rule headers have priority over them
+		if len(cfg.Headers) > 0 {
+			r.Headers = mergeHeaders(cfg.Headers, r.Headers)
+		}
+		// apply group eval_timeout if the rule has no own timeout
+		if r.EvalTimeout == nil {
+			r.EvalTimeout = cfg.EvalTimeout
+		}
+
 		rules[i] = g.newRule(qb, r)
 	}
 	g.Rules = rules
@@ -215,6 +265,8 @@ func (g *Group) updateWith(newGroup *Group) error {
 	g.Concurrency = newGroup.Concurrency
 	g.Params = newGroup.Params
 	g.Labels = newGroup.Labels
+	g.RemoteWriteURL = newGroup.RemoteWriteURL
+	g.recordingRW = newGroup.recordingRW
 	g.Checksum = newGroup.Checksum
 	g.Rules = newRules
 	return nil
@@ -243,7 +295,9 @@ func (g *Group) start(ctx context.Context, nts func() []notifier.Notifier, rw *r
 
 	e := &executor{
 		rw:                       rw,
+		recordingRW:              g.recordingRW,
 		notifiers:                nts,
+		dependencyDelay:          *ruleDependencyDelay,
 		previouslySentSeriesToRW: make(map[uint64]map[string][]prompbmarshal.Label)}
 
 	// Spread group rules evaluation over time in order to reduce load on VictoriaMetrics.
@@ -267,6 +321,7 @@ func (g *Group) start(ctx context.Context, nts func() []notifier.Notifier, rw *r
 	}
 
 	evalTS := time.Now()
+	ruleLevels := getRuleLevels(g.Rules)
 
 	logger.Infof("group %q started; interval=%v; concurrency=%d", g.Name, g.Interval, g.Concurrency)
 
@@ -281,8 +336,8 @@ func (g *Group) start(ctx context.Context, nts func() []notifier.Notifier, rw *r
 			return
 		}
 
-		resolveDuration := getResolveDuration(g.Interval, *resendDelay, *maxResolveDuration)
-		errs := e.execConcurrently(ctx, g.Rules, ts, g.Concurrency, resolveDuration)
+		resolveDuration := getResolveDuration(g.Interval, getMinNotificationInterval(), *maxResolveDuration)
+		errs := e.execLevels(ctx, ruleLevels, ts, g.Concurrency, resolveDuration, g.Interval)
 		for err := range errs {
 			if err != nil {
 				logger.Errorf("group %q: %s", g.Name, err)
@@ -309,12 +364,19 @@ func (g *Group) start(ctx context.Context, nts func() []notifier.Notifier, rw *r
 			err := g.updateWith(ng)
 			if err != nil {
 				logger.Errorf("group %q: failed to update: %s", g.Name, err)
+				// the client for the previous remote_write_url may be closed after the update,
+				// so switch to the client from the new config even if the update has failed.
+				g.RemoteWriteURL = ng.RemoteWriteURL
+				g.recordingRW = ng.recordingRW
+				e.recordingRW = ng.recordingRW
 				g.mu.Unlock()
 				continue
 			}
 
 			// ensure that staleness is tracked or existing rules only
 			e.purgeStaleSeries(g.Rules)
+			ruleLevels = getRuleLevels(g.Rules)
+			e.recordingRW = g.recordingRW
 
 			if g.Interval != ng.Interval {
 				g.Interval = ng.Interval
@@ -348,9 +410,130 @@ func getResolveDuration(groupInterval, delta, maxDuration time.Duration) time.Du
 	return resolveDuration
 }
 
+// getMinNotificationInterval returns the minimum interval between
+// notifications for the same firing alert.
+func getMinNotificationInterval() time.Duration {
+	if *notificationDebounce > *resendDelay {
+		return *notificationDebounce
+	}
+	return *resendDelay
+}
+
+// getRuleLevels splits rules into levels according to dependencies between them.
+//
+// A rule depends on a recording rule if the rule expression refers to the metric name
+// produced by the recording rule. Rules at every level depend only on rules from the previous levels,
+// so evaluating levels one after another provides fresh results of recording rules to dependent rules
+// on the same evaluation. The original order of rules is preserved within every level.
+// Rules with cyclic dependencies are put into the last level.
+func getRuleLevels(rules []Rule) [][]Rule {
+	if len(rules) == 0 {
+		return nil
+	}
+	apiRules := make([]APIRule, len(rules))
+	recordingRules := make(map[string][]int)
+	for i, rule := range rules {
+		ar := rule.ToAPI()
+		apiRules[i] = ar
+		if ar.Type == "recording" {
+			recordingRules[ar.Name] = append(recordingRules[ar.Name], i)
+		}
+	}
+	if len(recordingRules) == 0 {
+		// fast path - there are no dependencies between rules
+		return [][]Rule{rules}
+	}
+
+	deps := make([][]int, len(rules))
+	for i, ar := range apiRules {
+		if ar.DatasourceType != "prometheus" {
+			continue
+		}
+		for _, metricName := range getMetricNames(ar.Query) {
+			for _, j := range recordingRules[metricName] {
+				// recording rules may refer to their own results, e.g. `record: foo` with `expr: foo offset 1h`
+				if j != i {
+					deps[i] = append(deps[i], j)
+				}
+			}
+		}
+	}
+
+	var levels [][]Rule
+	evaluated := make([]bool, len(rules))
+	remaining := len(rules)
+	for remaining > 0 {
+		var level []Rule
+		var levelIdxs []int
+		for i, rule := range rules {
+			if evaluated[i] || !isEvaluated(evaluated, deps[i]) {
+				continue
+			}
+			level = append(level, rule)
+			levelIdxs = append(levelIdxs, i)
+		}
+		if len(level) == 0 {
+			// the remaining rules have cyclic dependencies
+			for i, rule := range rules {
+				if !evaluated[i] {
+					logger.Warnf("rule %q has cyclic dependencies on recording rules in the group; "+
+						"it may use results from the previous evaluation of these rules", rule)
+					level = append(level, rule)
+				}
+			}
+			levels = append(levels, level)
+			break
+		}
+		for _, i := range levelIdxs {
+			evaluated[i] = true
+		}
+		remaining -= len(level)
+		levels = append(levels, level)
+	}
+	return levels
+}
+
+func isEvaluated(evaluated []bool, idxs []int) bool {
+	for _, i := range idxs {
+		if !evaluated[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// getMetricNames returns metric names referred by the given MetricsQL expr.
+//
+// Only metric names from exact `__name__` filters are returned.
+func getMetricNames(expr string) []string {
+	e, err := metricsql.Parse(expr)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	metricsql.VisitAll(e, func(expr metricsql.Expr) {
+		me, ok := expr.(*metricsql.MetricExpr)
+		if !ok {
+			return
+		}
+		for _, lf := range me.LabelFilters {
+			if lf.Label == "__name__" && !lf.IsRegexp && !lf.IsNegative {
+				names = append(names, lf.Value)
+			}
+		}
+	})
+	return names
+}
+
 type executor struct {
 	notifiers func() []notifier.Notifier
 	rw        *remotewrite.Client
+	// recordingRW is used for persisting recording rules results instead of rw if set.
+	recordingRW *remotewrite.Client
+
+	// dependencyDelay is the delay after sending results of recording rules to remote storage
+	// before evaluating dependent rules. See -rule.dependencyDelay.
+	dependencyDelay time.Duration
 
 	previouslySentSeriesToRWMu sync.Mutex
 	// previouslySentSeriesToRW stores series sent to RW on previous iteration
@@ -389,8 +572,68 @@ func (e *executor) execConcurrently(ctx context.Context, rules []Rule, ts time.T
 	return res
 }
 
+// execLevels executes rule levels obtained via getRuleLevels one after another.
+//
+// Rules at every level depend only on rules from the previous levels,
+// so the next level is executed only after the previous level is finished
+// and results of its recording rules are sent to the remote storage.
+// Sending the results is limited by flushTimeout. The next level is executed after e.dependencyDelay
+// since the results are sent, so the remote storage could make them available for querying.
+// This is best-effort, since the remote storage may need more time for this.
+// Rules within a level are executed with the given concurrency.
+func (e *executor) execLevels(ctx context.Context, levels [][]Rule, ts time.Time, concurrency int, resolveDuration, flushTimeout time.Duration) chan error {
+	if len(levels) == 1 {
+		// fast path
+		return e.execConcurrently(ctx, levels[0], ts, concurrency, resolveDuration)
+	}
+	res := make(chan error)
+	go func() {
+		for i, rules := range levels {
+			for err := range e.execConcurrently(ctx, rules, ts, concurrency, resolveDuration) {
+				res <- err
+			}
+			if i < len(levels)-1 {
+				if err := e.flushRecordingResults(ctx, flushTimeout); err != nil {
+					res <- fmt.Errorf("cannot send results of recording rules to remote storage before evaluating dependent rules; "+
+						"dependent rules may use stale results: %w", err)
+				}
+			}
+		}
+		close(res)
+	}()
+	return res
+}
+
+// flushRecordingResults sends all the pending results of recording rules to the remote storage
+// and then waits for e.dependencyDelay.
+func (e *executor) flushRecordingResults(ctx context.Context, timeout time.Duration) error {
+	rw := e.rw
+	if e.recordingRW != nil {
+		rw = e.recordingRW
+	}
+	if rw == nil {
+		return nil
+	}
+	flushCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := rw.Flush(flushCtx); err != nil {
+		return err
+	}
+	if e.dependencyDelay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(e.dependencyDelay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
 var (
-	alertsFired = metrics.NewCounter(`vmalert_alerts_fired_total`)
+	alertsFired     = metrics.NewCounter(`vmalert_alerts_fired_total`)
+	alertsDebounced = metrics.NewCounter(`vmalert_alerts_debounced_total`)
 
 	execTotal  = metrics.NewCounter(`vmalert_execution_total`)
 	execErrors = metrics.NewCounter(`vmalert_execution_errors_total`)
@@ -409,11 +652,15 @@ func (e *executor) exec(ctx context.Context, rule Rule, ts time.Time, resolveDur
 	}
 
 	errGr := new(utils.ErrGroup)
-	if e.rw != nil {
+	rw := e.rw
+	if _, ok := rule.(*RecordingRule); ok && e.recordingRW != nil {
+		rw = e.recordingRW
+	}
+	if rw != nil {
 		pushToRW := func(tss []prompbmarshal.TimeSeries) {
 			for _, ts := range tss {
 				remoteWriteTotal.Inc()
-				if err := e.rw.Push(ts); err != nil {
+				if err := rw.Push(ts); err != nil {
 					remoteWriteErrors.Inc()
 					errGr.Add(fmt.Errorf("rule %q: remote write failure: %w", rule, err))
 				}
@@ -429,7 +676,7 @@ func (e *executor) exec(ctx context.Context, rule Rule, ts time.Time, resolveDur
 		return nil
 	}
 
-	alerts := ar.alertsToSend(ts, resolveDuration, *resendDelay)
+	alerts := ar.alertsToSend(ts, resolveDuration, *resendDelay, *notificationDebounce)
 	if len(alerts) < 1 {
 		return nil
 	}
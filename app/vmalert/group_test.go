@@ -2,16 +2,24 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"sort"
+	"sync"
 	"testing"
 	"time"
 
+	"gopkg.in/yaml.v2"
+
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/config"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/notifier"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/remotewrite"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promutils"
 )
 
@@ -242,6 +250,277 @@ func TestGroupStart(t *testing.T) {
 	<-finished
 }
 
+func TestGetRuleLevels(t *testing.T) {
+	f := func(rules []Rule, levelsExpected [][]string) {
+		t.Helper()
+		var levels [][]string
+		for _, level := range getRuleLevels(rules) {
+			var names []string
+			for _, rule := range level {
+				names = append(names, fmt.Sprintf("%s", rule))
+			}
+			levels = append(levels, names)
+		}
+		if !reflect.DeepEqual(levels, levelsExpected) {
+			t.Fatalf("unexpected levels; got %q; want %q", levels, levelsExpected)
+		}
+	}
+
+	// no rules
+	f(nil, nil)
+
+	// no dependencies
+	f([]Rule{
+		&RecordingRule{Name: "a", Expr: "x"},
+		&AlertingRule{Name: "b", Expr: "y > 0"},
+		&RecordingRule{Name: "c", Expr: "z"},
+	}, [][]string{{"a", "b", "c"}})
+
+	// chained dependencies in reverse order
+	f([]Rule{
+		&AlertingRule{Name: "alert", Expr: "c > 0"},
+		&RecordingRule{Name: "c", Expr: "a + b"},
+		&RecordingRule{Name: "b", Expr: "rate(a[5m])"},
+		&RecordingRule{Name: "a", Expr: "x"},
+		&RecordingRule{Name: "d", Expr: `sum(y{job="foo"})`},
+	}, [][]string{{"a", "d"}, {"b"}, {"c"}, {"alert"}})
+
+	// self-dependency
+	f([]Rule{
+		&RecordingRule{Name: "b", Expr: "a"},
+		&RecordingRule{Name: "a", Expr: "a offset 1h"},
+	}, [][]string{{"a"}, {"b"}})
+
+	// regexp filters on metric names aren't considered as dependencies
+	f([]Rule{
+		&RecordingRule{Name: "b", Expr: `{__name__=~"a|x"}`},
+		&RecordingRule{Name: "a", Expr: "x"},
+	}, [][]string{{"b", "a"}})
+
+	// graphite expressions aren't considered as dependencies
+	f([]Rule{
+		&RecordingRule{Name: "b", Expr: "a", Type: datasource.NewGraphiteType()},
+		&RecordingRule{Name: "a", Expr: "x"},
+	}, [][]string{{"b", "a"}})
+
+	// cyclic dependencies
+	f([]Rule{
+		&RecordingRule{Name: "c", Expr: "b"},
+		&RecordingRule{Name: "b", Expr: "a"},
+		&RecordingRule{Name: "a", Expr: "b"},
+		&RecordingRule{Name: "d", Expr: "x"},
+	}, [][]string{{"d"}, {"c", "b", "a"}})
+}
+
+func TestExecLevelsDependencies(t *testing.T) {
+	f := func(concurrency int) {
+		t.Helper()
+		fs := newFakeStorage()
+		newRule := func(name, expr string) Rule {
+			return &fakeStorageRule{
+				RecordingRule: &RecordingRule{Name: name, Expr: expr, q: fs},
+				fs:            fs,
+			}
+		}
+		// rules are listed in reverse order of dependencies
+		rules := []Rule{
+			newRule("c", "a + b"),
+			newRule("b", "a + a"),
+			newRule("a", "x"),
+		}
+		levels := getRuleLevels(rules)
+		e := &executor{}
+		for i := 1; i <= 3; i++ {
+			x := float64(i)
+			fs.set("x", x)
+			errs := e.execLevels(context.Background(), levels, time.Now(), concurrency, time.Minute, time.Minute)
+			for err := range errs {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+			// c must be calculated from a and b obtained on the same evaluation
+			if a, b, c := fs.get("a"), fs.get("b"), fs.get("c"); a != x || b != 2*x || c != 3*x {
+				t.Fatalf("unexpected results on evaluation #%d; got a=%v, b=%v, c=%v; want a=%v, b=%v, c=%v", i, a, b, c, x, 2*x, 3*x)
+			}
+		}
+	}
+
+	f(1)
+	f(3)
+}
+
+func TestExecLevelsRemoteWriteFlush(t *testing.T) {
+	fs := newFakeStorage()
+	srv := newFakeStorageRWServer(t, fs)
+	defer srv.Close()
+
+	// results of recording rules are sent to the remote storage asynchronously,
+	// so dependent rules see fresh results only if they are flushed between levels
+	rw, err := remotewrite.NewClient(context.Background(), remotewrite.Config{
+		Addr:          srv.URL,
+		Concurrency:   2,
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("cannot create remote write client: %s", err)
+	}
+	defer func() { _ = rw.Close() }()
+
+	rules := []Rule{
+		&RecordingRule{RuleID: 1, Name: "c", Expr: "a + b", q: fs},
+		&RecordingRule{RuleID: 2, Name: "b", Expr: "a + a", q: fs},
+		&RecordingRule{RuleID: 3, Name: "a", Expr: "x", q: fs},
+	}
+	levels := getRuleLevels(rules)
+	dependencyDelay := 50 * time.Millisecond
+	e := &executor{
+		rw:                       rw,
+		dependencyDelay:          dependencyDelay,
+		previouslySentSeriesToRW: make(map[uint64]map[string][]prompbmarshal.Label),
+	}
+	for i := 1; i <= 3; i++ {
+		x := float64(i)
+		fs.set("x", x)
+		startTime := time.Now()
+		errs := e.execLevels(context.Background(), levels, time.Now(), 2, time.Minute, time.Minute)
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+		// dependent rules must be evaluated after the dependency delay since sending results for every level except of the last one
+		if d := time.Since(startTime); d < time.Duration(len(levels)-1)*dependencyDelay {
+			t.Fatalf("dependent rules are evaluated too early on evaluation #%d; the evaluation took %s", i, d)
+		}
+		if err := rw.Flush(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if a, b, c := fs.get("a"), fs.get("b"), fs.get("c"); a != x || b != 2*x || c != 3*x {
+			t.Fatalf("unexpected results on evaluation #%d; got a=%v, b=%v, c=%v; want a=%v, b=%v, c=%v", i, a, b, c, x, 2*x, 3*x)
+		}
+	}
+}
+
+func TestGroupEvalTimeout(t *testing.T) {
+	fq := &fakeQuerierWithDelay{
+		delays: map[string]time.Duration{"slow": time.Minute},
+	}
+	fq.add(metricWithValueAndLabels(t, 1, "__name__", "foo"))
+	rules := []config.Rule{
+		{Record: "slow_rule", Expr: "slow"},
+		{Record: "fast_rule", Expr: "fast"},
+		{Record: "override_rule", Expr: "fast", EvalTimeout: promutils.NewDuration(time.Second)},
+	}
+	for i := range rules {
+		rules[i].ID = config.HashRule(rules[i])
+	}
+	g := newGroup(config.Group{
+		Name:        "TestGroupEvalTimeout",
+		Rules:       rules,
+		EvalTimeout: promutils.NewDuration(50 * time.Millisecond),
+	}, fq, time.Minute, nil)
+	defer func() {
+		for _, r := range g.Rules {
+			r.Close()
+		}
+	}()
+
+	slowRule := g.Rules[0].(*RecordingRule)
+	if slowRule.EvalTimeout != 50*time.Millisecond {
+		t.Fatalf("expecting group eval_timeout to be applied; got %s", slowRule.EvalTimeout)
+	}
+	if d := g.Rules[2].(*RecordingRule).EvalTimeout; d != time.Second {
+		t.Fatalf("expecting rule eval_timeout to override group eval_timeout; got %s", d)
+	}
+
+	e := &executor{
+		notifiers:                func() []notifier.Notifier { return nil },
+		previouslySentSeriesToRW: make(map[uint64]map[string][]prompbmarshal.Label),
+	}
+	start := time.Now()
+	var errs []error
+	for err := range e.execConcurrently(context.Background(), g.Rules, start, len(g.Rules), time.Minute) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Fatalf("slow rule must be canceled after eval_timeout; evaluation took %s", d)
+	}
+	if len(errs) != 1 {
+		t.Fatalf("expecting a single evaluation error; got %v", errs)
+	}
+	if !errors.Is(errs[0], errEvalTimeout) {
+		t.Fatalf("expecting errEvalTimeout; got %s", errs[0])
+	}
+	if !errors.Is(slowRule.lastExecError, errEvalTimeout) {
+		t.Fatalf("expecting slow rule to be marked as failed; got %v", slowRule.lastExecError)
+	}
+	if n := slowRule.metrics.timeouts.Get(); n != 1 {
+		t.Fatalf("unexpected number of eval timeouts for the slow rule; got %d; want 1", n)
+	}
+	for _, r := range g.Rules[1:] {
+		rr := r.(*RecordingRule)
+		if rr.lastExecError != nil {
+			t.Fatalf("unexpected error for rule %q: %s", rr.Name, rr.lastExecError)
+		}
+		if rr.lastExecSamples != 1 {
+			t.Fatalf("unexpected number of samples for rule %q; got %d; want 1", rr.Name, rr.lastExecSamples)
+		}
+	}
+}
+
+func TestGroupHeaders(t *testing.T) {
+	var mu sync.Mutex
+	tenants := make(map[string]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("cannot parse form: %s", err)
+		}
+		mu.Lock()
+		tenants[r.Form.Get("query")] = r.Header.Get("X-Scope-OrgID")
+		mu.Unlock()
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	}))
+	defer srv.Close()
+
+	var cfg config.Group
+	data := `
+name: TestGroupHeaders
+headers:
+  - "X-Scope-OrgID: team-a"
+rules:
+  - record: group_tenant
+    expr: group_tenant_expr
+  - record: rule_tenant
+    expr: rule_tenant_expr
+    headers:
+      - "X-Scope-OrgID: team-b"
+`
+	if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
+		t.Fatalf("cannot parse group: %s", err)
+	}
+	qb := datasource.NewVMStorage(srv.URL, nil, 0, 0, false, srv.Client())
+	g := newGroup(cfg, qb, time.Minute, nil)
+	for _, r := range g.Rules {
+		if _, err := r.Exec(context.Background(), time.Now()); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		r.Close()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	exp := map[string]string{
+		"group_tenant_expr": "team-a",
+		"rule_tenant_expr":  "team-b",
+	}
+	if !reflect.DeepEqual(tenants, exp) {
+		t.Fatalf("unexpected headers received by datasource; got %v; want %v", tenants, exp)
+	}
+}
+
 func TestResolveDuration(t *testing.T) {
 	testCases := []struct {
 		groupInterval time.Duration
@@ -3,15 +3,21 @@ package main
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"sort"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/notifier"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/golang/snappy"
 )
 
 type fakeQuerier struct {
@@ -58,6 +64,123 @@ func (fq *fakeQuerier) Query(_ context.Context, _ string, _ time.Time) ([]dataso
 	return cp, nil
 }
 
+// fakeQuerierWithDelay delays responses for the given expressions
+// until the delay passes or the query context is canceled.
+type fakeQuerierWithDelay struct {
+	fakeQuerier
+	delays map[string]time.Duration
+}
+
+func (fqd *fakeQuerierWithDelay) BuildWithParams(_ datasource.QuerierParams) datasource.Querier {
+	return fqd
+}
+
+func (fqd *fakeQuerierWithDelay) Query(ctx context.Context, expr string, ts time.Time) ([]datasource.Metric, error) {
+	if d := fqd.delays[expr]; d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+	return fqd.fakeQuerier.Query(ctx, expr, ts)
+}
+
+// fakeStorage stores the last values of metrics.
+//
+// It evaluates queries in the form `a + b + ...`, where `a` and `b` are metric names,
+// and stores results of recording rules, which are executed via fakeStorageRule.
+type fakeStorage struct {
+	sync.Mutex
+	values map[string]float64
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{
+		values: make(map[string]float64),
+	}
+}
+
+func (fs *fakeStorage) set(metricName string, value float64) {
+	fs.Lock()
+	fs.values[metricName] = value
+	fs.Unlock()
+}
+
+func (fs *fakeStorage) get(metricName string) float64 {
+	fs.Lock()
+	defer fs.Unlock()
+	return fs.values[metricName]
+}
+
+func (fs *fakeStorage) BuildWithParams(_ datasource.QuerierParams) datasource.Querier {
+	return fs
+}
+
+func (fs *fakeStorage) QueryRange(ctx context.Context, q string, _, _ time.Time) ([]datasource.Metric, error) {
+	return fs.Query(ctx, q, time.Now())
+}
+
+func (fs *fakeStorage) Query(_ context.Context, expr string, ts time.Time) ([]datasource.Metric, error) {
+	var v float64
+	for _, metricName := range strings.Split(expr, " + ") {
+		v += fs.get(metricName)
+	}
+	return []datasource.Metric{{
+		Values:     []float64{v},
+		Timestamps: []int64{ts.Unix()},
+	}}, nil
+}
+
+// fakeStorageRule writes results of the wrapped RecordingRule into fakeStorage.
+type fakeStorageRule struct {
+	*RecordingRule
+	fs *fakeStorage
+}
+
+func (fsr *fakeStorageRule) Exec(ctx context.Context, ts time.Time) ([]prompbmarshal.TimeSeries, error) {
+	tss, err := fsr.RecordingRule.Exec(ctx, ts)
+	if err != nil {
+		return nil, err
+	}
+	for _, ts := range tss {
+		fsr.fs.set(fsr.Name, ts.Samples[0].Value)
+	}
+	return tss, nil
+}
+
+// newFakeStorageRWServer returns a server, which stores samples received via remote write protocol into fs.
+func newFakeStorageRWServer(t *testing.T, fs *fakeStorage) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		b, err := snappy.Decode(nil, data)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var wr prompb.WriteRequest
+		if err := wr.Unmarshal(b); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, ts := range wr.Timeseries {
+			for _, label := range ts.Labels {
+				if string(label.Name) == "__name__" && len(ts.Samples) > 0 {
+					fs.set(string(label.Value), ts.Samples[len(ts.Samples)-1].Value)
+				}
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
 type fakeNotifier struct {
 	sync.Mutex
 	alerts []notifier.Alert
@@ -23,6 +23,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querylint"
 	"github.com/VictoriaMetrics/metrics"
 )
 
@@ -55,7 +56,15 @@ absolute path to all .tpl files in root.`)
 	validateExpressions = flag.Bool("rule.validateExpressions", true, "Whether to validate rules expressions via MetricsQL engine")
 	maxResolveDuration  = flag.Duration("rule.maxResolveDuration", 0, "Limits the maximum duration for automatic alert expiration, "+
 		"which is by default equal to 3 evaluation intervals of the parent group.")
-	resendDelay = flag.Duration("rule.resendDelay", 0, "Minimum amount of time to wait before resending an alert to notifier")
+	resendDelay          = flag.Duration("rule.resendDelay", 0, "Minimum amount of time to wait before resending an alert to notifier")
+	notificationDebounce = flag.Duration("rule.notificationDebounce", 0, "Minimum amount of time between notifications for the same alert. "+
+		"Notifications for alerts flapping between firing and resolved states within this interval are suppressed, "+
+		"and the latest alert state is sent once the interval passes. Unlike -rule.resendDelay, "+
+		"it also applies to notifications for resolved alerts. Debouncing is disabled if set to zero")
+	ruleDependencyDelay = flag.Duration("rule.dependencyDelay", time.Second, "The delay between sending results of recording rules to remote storage "+
+		"and evaluating rules from the same group, which depend on these results. The delay gives the remote storage time for making the results "+
+		"available for querying. Dependent rules may still use stale results if the remote storage needs more time. "+
+		"See https://docs.victoriametrics.com/vmalert.html#chained-rules")
 
 	externalURL         = flag.String("external.url", "", "External URL is used as alert's source for sent alerts to the notifier")
 	externalAlertSource = flag.String("external.alert.source", "", `External Alert Source allows to override the Source link for alerts sent to AlertManager for cases where you want to build a custom link to Grafana, Prometheus or any other service.
@@ -94,6 +103,7 @@ func main() {
 		if len(groups) == 0 {
 			logger.Fatalf("No rules for validation. Please specify path to file(s) with alerting and/or recording rules using `-rule` flag")
 		}
+		lintGroups(groups)
 		return
 	}
 
@@ -350,3 +360,24 @@ func configsEqual(a, b []config.Group) bool {
 	}
 	return true
 }
+
+// lintGroups logs warnings for the known anti-patterns in expressions of rules with prometheus type.
+//
+// See https://docs.victoriametrics.com/MetricsQL.html#linting
+func lintGroups(groups []config.Group) {
+	for _, g := range groups {
+		if g.Type.String() != "prometheus" {
+			continue
+		}
+		for _, r := range g.Rules {
+			ws, err := querylint.Lint(r.Expr)
+			if err != nil {
+				// The expression has been already validated by config.Parse.
+				continue
+			}
+			for _, w := range ws {
+				logger.Warnf("group %q, rule %q in %q: %s", g.Name, r.Name(), g.File, w.String())
+			}
+		}
+	}
+}
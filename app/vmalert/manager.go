@@ -6,6 +6,7 @@ import (
 	"net/url"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/config"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
@@ -20,6 +21,9 @@ type manager struct {
 	notifiers      func() []notifier.Notifier
 
 	rw *remotewrite.Client
+	// groupRWs contains clients for groups with remote_write_url.
+	// The clients are shared among groups with the same remote_write_url.
+	groupRWs map[string]*remotewrite.Client
 	// remote read builder.
 	rr datasource.QuerierBuilder
 
@@ -28,6 +32,9 @@ type manager struct {
 
 	groupsMu sync.RWMutex
 	groups   map[uint64]*Group
+
+	// restoredAlerts contains alerts state loaded from -rule.stateFile on start.
+	restoredAlerts restoredAlerts
 }
 
 // AlertAPI generates APIAlert object from alert by its ID(hash)
@@ -52,17 +59,59 @@ func (m *manager) AlertAPI(gID, aID uint64) (*APIAlert, error) {
 }
 
 func (m *manager) start(ctx context.Context, groupsCfg []config.Group) error {
-	return m.update(ctx, groupsCfg, true)
+	if *stateFile != "" {
+		ra, err := loadAlertsState(*stateFile, *stateMaxAge, time.Now())
+		if err != nil {
+			logger.Errorf("cannot restore alerts state from -rule.stateFile: %s", err)
+		}
+		m.restoredAlerts = ra
+	}
+	if err := m.update(ctx, groupsCfg, true); err != nil {
+		return err
+	}
+	// the restored state is needed only on start
+	m.restoredAlerts = nil
+
+	m.wg.Add(1)
+	go func() {
+		m.runStateSaver(ctx)
+		m.wg.Done()
+	}()
+	return nil
 }
 
 func (m *manager) close() {
+	// wait for groups to stop before closing remote write clients,
+	// since groups may push to them during the last evaluation.
+	m.wg.Wait()
+	m.saveState()
 	if m.rw != nil {
 		err := m.rw.Close()
 		if err != nil {
 			logger.Fatalf("cannot stop the remotewrite: %s", err)
 		}
 	}
-	m.wg.Wait()
+	for addr, rw := range m.groupRWs {
+		if err := rw.Close(); err != nil {
+			logger.Fatalf("cannot stop the remotewrite for remote_write_url %q: %s", addr, err)
+		}
+	}
+}
+
+// getGroupRW returns remote write client for the given remote_write_url from group config.
+func (m *manager) getGroupRW(ctx context.Context, addr string) (*remotewrite.Client, error) {
+	if rw, ok := m.groupRWs[addr]; ok {
+		return rw, nil
+	}
+	rw, err := remotewrite.InitWithAddr(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	if m.groupRWs == nil {
+		m.groupRWs = make(map[string]*remotewrite.Client)
+	}
+	m.groupRWs[addr] = rw
+	return rw, nil
 }
 
 func (m *manager) startGroup(ctx context.Context, group *Group, restore bool) error {
@@ -75,6 +124,9 @@ func (m *manager) startGroup(ctx context.Context, group *Group, restore bool) er
 			logger.Errorf("error while restoring state for group %q: %s", group.Name, err)
 		}
 	}
+	if restore && m.restoredAlerts != nil {
+		group.restoreAlerts(m.restoredAlerts)
+	}
 
 	m.wg.Add(1)
 	id := group.ID()
@@ -89,12 +141,14 @@ func (m *manager) startGroup(ctx context.Context, group *Group, restore bool) er
 func (m *manager) update(ctx context.Context, groupsCfg []config.Group, restore bool) error {
 	var rrPresent, arPresent bool
 	groupsRegistry := make(map[uint64]*Group)
+	// usedRWs contains remote_write_url addresses referred by groupsCfg
+	usedRWs := make(map[string]struct{})
 	for _, cfg := range groupsCfg {
 		for _, r := range cfg.Rules {
 			if rrPresent && arPresent {
 				continue
 			}
-			if r.Record != "" {
+			if r.Record != "" && cfg.RemoteWriteURL == "" {
 				rrPresent = true
 			}
 			if r.Alert != "" {
@@ -102,6 +156,14 @@ func (m *manager) update(ctx context.Context, groupsCfg []config.Group, restore
 			}
 		}
 		ng := newGroup(cfg, m.querierBuilder, *evaluationInterval, m.labels)
+		if cfg.RemoteWriteURL != "" {
+			rw, err := m.getGroupRW(ctx, cfg.RemoteWriteURL)
+			if err != nil {
+				return fmt.Errorf("failed to init remote_write_url for group %q: %w", cfg.Name, err)
+			}
+			ng.recordingRW = rw
+			usedRWs[cfg.RemoteWriteURL] = struct{}{}
+		}
 		groupsRegistry[ng.ID()] = ng
 	}
 
@@ -109,7 +171,7 @@ func (m *manager) update(ctx context.Context, groupsCfg []config.Group, restore
 		return fmt.Errorf("config contains recording rules but `-remoteWrite.url` isn't set")
 	}
 	if arPresent && m.notifiers == nil {
-		return fmt.Errorf("config contains alerting rules but neither `-notifier.url` nor `-notifier.config` aren't set")
+		return fmt.Errorf("config contains alerting rules but none of `-notifier.url`, `-notifier.config` or `-notifier.webhook.url` are set")
 	}
 
 	type updateItem struct {
@@ -152,6 +214,19 @@ func (m *manager) update(ctx context.Context, groupsCfg []config.Group, restore
 		}
 		wg.Wait()
 	}
+
+	// close remote write clients for remote_write_url, which are no longer used by groups.
+	// It is safe to close them here, since removed groups are already stopped
+	// and updated groups already switched to the clients from the new config.
+	for addr, rw := range m.groupRWs {
+		if _, ok := usedRWs[addr]; ok {
+			continue
+		}
+		if err := rw.Close(); err != nil {
+			logger.Errorf("cannot stop the remotewrite for remote_write_url %q: %s", addr, err)
+		}
+		delete(m.groupRWs, addr)
+	}
 	return nil
 }
 
@@ -2,18 +2,26 @@ package main
 
 import (
 	"context"
+	"io/ioutil"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/golang/snappy"
+
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/config"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/notifier"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/remotewrite"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/templates"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 )
 
 func TestMain(m *testing.M) {
@@ -336,3 +344,169 @@ func loadCfg(t *testing.T, path []string, validateAnnotations, validateExpressio
 	}
 	return cfg
 }
+
+func TestManagerGroupRemoteWriteURL(t *testing.T) {
+	defaultSrv := newFakeRWServer()
+	defer defaultSrv.Close()
+	groupSrv := newFakeRWServer()
+	defer groupSrv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rw, err := remotewrite.InitWithAddr(ctx, defaultSrv.URL)
+	if err != nil {
+		t.Fatalf("failed to init remote write client: %s", err)
+	}
+	fq := &fakeQuerier{}
+	fq.add(metricWithValueAndLabels(t, 1, "job", "foo"))
+	m := &manager{
+		groups:         make(map[uint64]*Group),
+		querierBuilder: fq,
+		notifiers:      func() []notifier.Notifier { return []notifier.Notifier{&fakeNotifier{}} },
+		rw:             rw,
+	}
+	cfg := config.Group{
+		Name:           "TestGroup",
+		RemoteWriteURL: groupSrv.URL,
+		Rules: []config.Rule{
+			{Record: "job:up", Expr: "up"},
+			{Alert: "JobUp", Expr: "up > 0"},
+		},
+	}
+	for i := range cfg.Rules {
+		cfg.Rules[i].ID = config.HashRule(cfg.Rules[i])
+	}
+	if err := m.start(ctx, []config.Group{cfg}); err != nil {
+		t.Fatalf("failed to start manager: %s", err)
+	}
+	// wait for the first evaluation
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	// close flushes the pending series to remote write urls
+	m.close()
+
+	if names := groupSrv.getNames(); !reflect.DeepEqual(names, []string{"job:up"}) {
+		t.Fatalf("unexpected series at remote_write_url; got %q; want %q", names, []string{"job:up"})
+	}
+	for _, name := range defaultSrv.getNames() {
+		if name == "job:up" {
+			t.Fatalf("recording rule results mustn't be sent to -remoteWrite.url when remote_write_url is set; got %q", defaultSrv.getNames())
+		}
+	}
+	if names := defaultSrv.getNames(); len(names) == 0 {
+		t.Fatalf("expecting alerts state to be sent to -remoteWrite.url")
+	}
+
+	// recording rules with remote_write_url don't require -remoteWrite.url
+	m = &manager{
+		groups:         make(map[uint64]*Group),
+		querierBuilder: fq,
+	}
+	cfg.Rules = cfg.Rules[:1]
+	ctx, cancel = context.WithCancel(context.Background())
+	if err := m.update(ctx, []config.Group{cfg}, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	cancel()
+	m.close()
+}
+
+func TestManagerGroupRemoteWriteURLUpdate(t *testing.T) {
+	srv1 := newFakeRWServer()
+	defer srv1.Close()
+	srv2 := newFakeRWServer()
+	defer srv2.Close()
+
+	fq := &fakeQuerier{}
+	fq.add(metricWithValueAndLabels(t, 1, "job", "foo"))
+	m := &manager{
+		groups:         make(map[uint64]*Group),
+		querierBuilder: fq,
+	}
+	newCfg := func(name, addr string) config.Group {
+		cfg := config.Group{
+			Name:           name,
+			RemoteWriteURL: addr,
+			Rules:          []config.Rule{{Record: "job:up", Expr: "up"}},
+			// the checksum is calculated from the group config in real life
+			Checksum: addr,
+		}
+		cfg.Rules[0].ID = config.HashRule(cfg.Rules[0])
+		return cfg
+	}
+	f := func(groupsCfg []config.Group, addrsExpected []string) {
+		t.Helper()
+		if err := m.update(context.Background(), groupsCfg, false); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var addrs []string
+		for addr := range m.groupRWs {
+			addrs = append(addrs, addr)
+		}
+		sort.Strings(addrs)
+		if !reflect.DeepEqual(addrs, addrsExpected) {
+			t.Fatalf("unexpected remote write clients; got %q; want %q", addrs, addrsExpected)
+		}
+	}
+
+	addrs := []string{srv1.URL, srv2.URL}
+	sort.Strings(addrs)
+
+	f([]config.Group{newCfg("foo", srv1.URL)}, []string{srv1.URL})
+	// the client is shared between groups with the same remote_write_url
+	f([]config.Group{newCfg("foo", srv1.URL), newCfg("bar", srv1.URL)}, []string{srv1.URL})
+	f([]config.Group{newCfg("foo", srv1.URL), newCfg("bar", srv2.URL)}, addrs)
+	// the client for the removed group is closed
+	f([]config.Group{newCfg("foo", srv1.URL)}, []string{srv1.URL})
+	// the client for the updated group is closed
+	f([]config.Group{newCfg("foo", srv2.URL)}, []string{srv2.URL})
+	f(nil, nil)
+	m.close()
+}
+
+// fakeRWServer collects metric names for the received series.
+type fakeRWServer struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	names []string
+}
+
+func newFakeRWServer() *fakeRWServer {
+	rw := &fakeRWServer{}
+	rw.Server = httptest.NewServer(http.HandlerFunc(rw.handler))
+	return rw
+}
+
+func (rw *fakeRWServer) getNames() []string {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	return append([]string{}, rw.names...)
+}
+
+func (rw *fakeRWServer) handler(w http.ResponseWriter, r *http.Request) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	b, err := snappy.Decode(nil, data)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	wr := &prompb.WriteRequest{}
+	if err := wr.Unmarshal(b); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rw.mu.Lock()
+	for _, ts := range wr.Timeseries {
+		for _, label := range ts.Labels {
+			if string(label.Name) == "__name__" {
+				rw.names = append(rw.names, string(label.Value))
+			}
+		}
+	}
+	rw.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -16,6 +16,8 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discovery/consul"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discovery/dns"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discovery/http"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discovery/kubernetes"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promutils"
 )
 
@@ -33,6 +35,12 @@ type Config struct {
 	// DNSSDConfigs ontains list of settings for service discovery via DNS.
 	// See https://prometheus.io/docs/prometheus/latest/configuration/configuration/#dns_sd_config
 	DNSSDConfigs []dns.SDConfig `yaml:"dns_sd_configs,omitempty"`
+	// HTTPSDConfigs contains list of settings for service discovery via HTTP endpoint.
+	// See https://prometheus.io/docs/prometheus/latest/configuration/configuration/#http_sd_config
+	HTTPSDConfigs []http.SDConfig `yaml:"http_sd_configs,omitempty"`
+	// KubernetesSDConfigs contains list of settings for service discovery via Kubernetes API.
+	// See https://prometheus.io/docs/prometheus/latest/configuration/configuration/#kubernetes_sd_config
+	KubernetesSDConfigs []kubernetes.SDConfig `yaml:"kubernetes_sd_configs,omitempty"`
 
 	// StaticConfigs contains list of static targets
 	StaticConfigs []StaticConfig `yaml:"static_configs,omitempty"`
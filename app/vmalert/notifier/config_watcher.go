@@ -1,6 +1,7 @@
 package notifier
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
@@ -8,6 +9,8 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discovery/consul"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discovery/dns"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discovery/http"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discovery/kubernetes"
 )
 
 // configWatcher supports dynamic reload of Notifier objects
@@ -184,7 +187,7 @@ func (cw *configWatcher) start() error {
 			var labels []map[string]string
 			for i := range cw.cfg.ConsulSDConfigs {
 				sdc := &cw.cfg.ConsulSDConfigs[i]
-				targetLabels, err := sdc.GetLabels(cw.cfg.baseDir)
+				targetLabels, err := sdc.GetLabels(context.Background(), cw.cfg.baseDir)
 				if err != nil {
 					return nil, fmt.Errorf("got labels err: %s", err)
 				}
@@ -202,7 +205,7 @@ func (cw *configWatcher) start() error {
 			var labels []map[string]string
 			for i := range cw.cfg.DNSSDConfigs {
 				sdc := &cw.cfg.DNSSDConfigs[i]
-				targetLabels, err := sdc.GetLabels(cw.cfg.baseDir)
+				targetLabels, err := sdc.GetLabels(context.Background(), cw.cfg.baseDir)
 				if err != nil {
 					return nil, fmt.Errorf("got labels err: %s", err)
 				}
@@ -214,6 +217,54 @@ func (cw *configWatcher) start() error {
 			return fmt.Errorf("failed to start DNSSD discovery: %s", err)
 		}
 	}
+
+	if len(cw.cfg.HTTPSDConfigs) > 0 {
+		err := cw.add(TargetHTTP, *http.SDCheckInterval, func() ([]map[string]string, error) {
+			var labels []map[string]string
+			for i := range cw.cfg.HTTPSDConfigs {
+				sdc := &cw.cfg.HTTPSDConfigs[i]
+				targetLabels, err := sdc.GetLabels(context.Background(), cw.cfg.baseDir)
+				if err != nil {
+					return nil, fmt.Errorf("got labels err: %s", err)
+				}
+				labels = append(labels, targetLabels...)
+			}
+			return labels, nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to start HTTPSD discovery: %s", err)
+		}
+	}
+
+	if len(cw.cfg.KubernetesSDConfigs) > 0 {
+		for i := range cw.cfg.KubernetesSDConfigs {
+			sdc := &cw.cfg.KubernetesSDConfigs[i]
+			sdc.MustStart(cw.cfg.baseDir, func(metaLabels map[string]string) interface{} {
+				labels := make(map[string]string, len(metaLabels))
+				for k, v := range metaLabels {
+					labels[k] = v
+				}
+				return labels
+			})
+		}
+		err := cw.add(TargetKubernetes, *kubernetes.SDCheckInterval, func() ([]map[string]string, error) {
+			var labels []map[string]string
+			for i := range cw.cfg.KubernetesSDConfigs {
+				sdc := &cw.cfg.KubernetesSDConfigs[i]
+				swos, err := sdc.GetScrapeWorkObjects()
+				if err != nil {
+					return nil, fmt.Errorf("got labels err: %s", err)
+				}
+				for _, swo := range swos {
+					labels = append(labels, swo.(map[string]string))
+				}
+			}
+			return labels, nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to start KubernetesSD discovery: %s", err)
+		}
+	}
 	return nil
 }
 
@@ -233,6 +284,12 @@ func (cw *configWatcher) mustStop() {
 	for i := range cw.cfg.ConsulSDConfigs {
 		cw.cfg.ConsulSDConfigs[i].MustStop()
 	}
+	for i := range cw.cfg.HTTPSDConfigs {
+		cw.cfg.HTTPSDConfigs[i].MustStop()
+	}
+	for i := range cw.cfg.KubernetesSDConfigs {
+		cw.cfg.KubernetesSDConfigs[i].MustStop()
+	}
 	cw.cfg = nil
 }
 
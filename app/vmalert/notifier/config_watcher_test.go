@@ -1,12 +1,16 @@
 package notifier
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
+	"sort"
 	"sync"
 	"testing"
 )
@@ -299,3 +303,74 @@ func newFakeConsulServer() *httptest.Server {
 
 	return httptest.NewServer(mux)
 }
+
+func TestConfigWatcherHTTPSD(t *testing.T) {
+	var received []string
+	var receivedMu sync.Mutex
+	newFakeAM := func() *httptest.Server {
+		var srv *httptest.Server
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != alertManagerPath {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			var alerts []map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&alerts); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			receivedMu.Lock()
+			received = append(received, srv.Listener.Addr().String())
+			receivedMu.Unlock()
+		}))
+		return srv
+	}
+	am1 := newFakeAM()
+	defer am1.Close()
+	am2 := newFakeAM()
+	defer am2.Close()
+
+	httpSDServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `[{"targets":[%q,%q],"labels":{"env":"prod"}}]`, am1.Listener.Addr(), am2.Listener.Addr())
+	}))
+	defer httpSDServer.Close()
+
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	writeToFile(t, f.Name(), fmt.Sprintf(`
+http_sd_configs:
+  - url: %s
+`, httpSDServer.URL))
+
+	cw, err := newWatcher(f.Name(), func(alert Alert) string { return "" })
+	if err != nil {
+		t.Fatalf("failed to start config watcher: %s", err)
+	}
+	defer cw.mustStop()
+
+	ns := cw.notifiers()
+	if len(ns) != 2 {
+		t.Fatalf("expected to get 2 notifiers; got %d", len(ns))
+	}
+	for _, n := range ns {
+		if err := n.Send(context.Background(), []Alert{{Name: "alert", Labels: map[string]string{"alertname": "alert"}}}); err != nil {
+			t.Fatalf("unexpected error when sending alert to %q: %s", n.Addr(), err)
+		}
+	}
+	receivedMu.Lock()
+	defer receivedMu.Unlock()
+	sort.Strings(received)
+	exp := []string{am1.Listener.Addr().String(), am2.Listener.Addr().String()}
+	sort.Strings(exp)
+	if !reflect.DeepEqual(received, exp) {
+		t.Fatalf("unexpected alertmanagers received alerts; got %q; want %q", received, exp)
+	}
+	targets := cw.targets[TargetHTTP]
+	if len(targets) != 2 {
+		t.Fatalf("expected to get 2 targets discovered via http_sd_configs; got %d", len(targets))
+	}
+}
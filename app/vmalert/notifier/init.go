@@ -3,6 +3,7 @@ package notifier
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/url"
 	"strings"
 	"time"
@@ -44,6 +45,16 @@ var (
 		"If multiple args are set, then they are applied independently for the corresponding -notifier.url")
 	oauth2Scopes = flagutil.NewArray("notifier.oauth2.scopes", "Optional OAuth2 scopes to use for -notifier.url. Scopes must be delimited by ';'. "+
 		"If multiple args are set, then they are applied independently for the corresponding -notifier.url")
+
+	webhookAddrs = flagutil.NewArray("notifier.webhook.url", "Optional URL of generic webhook for sending alerts to, e.g. Slack or MS Teams incoming webhook. "+
+		"Webhooks may be used instead of or in addition to -notifier.url and -notifier.config. "+
+		"See https://docs.victoriametrics.com/vmalert.html#webhook-notifier")
+	webhookTemplateFile = flagutil.NewArray("notifier.webhook.templateFile", "Optional path to file with Go template for building the payload "+
+		"for the corresponding -notifier.webhook.url. By default alerts are sent as JSON object with alerts list")
+	webhookMaxRetries       = flag.Int("notifier.webhook.maxRetries", 3, "The maximum number of retries for failed requests to -notifier.webhook.url. Requests are retried on connection errors and 5xx responses")
+	webhookRetryMinInterval = flag.Duration("notifier.webhook.retryMinInterval", time.Second, "The minimum delay between retries of failed requests to -notifier.webhook.url. "+
+		"The delay is doubled after each retry")
+	webhookTimeout = flag.Duration("notifier.webhook.timeout", 10*time.Second, "Timeout for a single request to -notifier.webhook.url")
 )
 
 // cw holds a configWatcher for configPath configuration file
@@ -63,6 +74,9 @@ func Reload() error {
 
 var staticNotifiersFn func() []Notifier
 
+// webhookNotifiersFn returns notifiers configured via -notifier.webhook.url
+var webhookNotifiersFn func() []Notifier
+
 var (
 	// externalLabels is a global variable for holding external labels configured via flags
 	// It is supposed to be inited via Init function only.
@@ -92,13 +106,24 @@ func Init(gen AlertURLGenerator, extLabels map[string]string, extURL string) (fu
 
 	templates.UpdateWithFuncs(templates.FuncsWithExternalURL(eu))
 
-	if *configPath == "" && len(*addrs) == 0 {
-		return nil, nil
-	}
 	if *configPath != "" && len(*addrs) > 0 {
 		return nil, fmt.Errorf("only one of -notifier.config or -notifier.url flags must be specified")
 	}
 
+	webhooks, err := webhooksFromFlags(gen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook notifier from flag values: %s", err)
+	}
+	if len(webhooks) > 0 {
+		webhookNotifiersFn = func() []Notifier {
+			return webhooks
+		}
+	}
+
+	if *configPath == "" && len(*addrs) == 0 {
+		return webhookNotifiersFn, nil
+	}
+
 	if len(*addrs) > 0 {
 		notifiers, err := notifiersFromFlags(gen)
 		if err != nil {
@@ -107,14 +132,47 @@ func Init(gen AlertURLGenerator, extLabels map[string]string, extURL string) (fu
 		staticNotifiersFn = func() []Notifier {
 			return notifiers
 		}
-		return staticNotifiersFn, nil
+		return withWebhooks(staticNotifiersFn, webhooks), nil
 	}
 
 	cw, err = newWatcher(*configPath, gen)
 	if err != nil {
 		return nil, fmt.Errorf("failed to init config watcher: %s", err)
 	}
-	return cw.notifiers, nil
+	return withWebhooks(cw.notifiers, webhooks), nil
+}
+
+// withWebhooks returns a function which returns notifiers from fn together with webhooks
+func withWebhooks(fn func() []Notifier, webhooks []Notifier) func() []Notifier {
+	if len(webhooks) == 0 {
+		return fn
+	}
+	return func() []Notifier {
+		ns := fn()
+		result := make([]Notifier, 0, len(ns)+len(webhooks))
+		result = append(result, ns...)
+		return append(result, webhooks...)
+	}
+}
+
+func webhooksFromFlags(gen AlertURLGenerator) ([]Notifier, error) {
+	var notifiers []Notifier
+	for i, addr := range *webhookAddrs {
+		var tplText string
+		if path := webhookTemplateFile.GetOptionalArg(i); path != "" {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read -notifier.webhook.templateFile: %w", err)
+			}
+			tplText = string(data)
+		}
+		wh, err := NewWebhook(addr, gen, tplText, *webhookTimeout, *webhookMaxRetries, *webhookRetryMinInterval)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, wh)
+	}
+	return notifiers, nil
 }
 
 func notifiersFromFlags(gen AlertURLGenerator) ([]Notifier, error) {
@@ -171,6 +229,12 @@ const (
 	TargetConsul TargetType = "consulSD"
 	// TargetDNS is for targets discovered via DNS
 	TargetDNS TargetType = "DNSSD"
+	// TargetHTTP is for targets discovered via HTTP endpoint
+	TargetHTTP TargetType = "httpSD"
+	// TargetKubernetes is for targets discovered via Kubernetes API
+	TargetKubernetes TargetType = "kubernetesSD"
+	// TargetWebhook is for webhooks configured via flags
+	TargetWebhook TargetType = "webhook"
 )
 
 // GetTargets returns list of static or discovered targets
@@ -186,6 +250,14 @@ func GetTargets() map[TargetType][]Target {
 		}
 	}
 
+	if webhookNotifiersFn != nil {
+		for _, ns := range webhookNotifiersFn() {
+			targets[TargetWebhook] = append(targets[TargetWebhook], Target{
+				Notifier: ns,
+			})
+		}
+	}
+
 	if cw != nil {
 		cw.targetsMu.RLock()
 		for key, ns := range cw.targets {
@@ -0,0 +1,230 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	textTpl "text/template"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/templates"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/utils"
+)
+
+// defaultWebhookTemplate is used for building webhook payload
+// if no custom template is provided.
+const defaultWebhookTemplate = `{"alerts":[
+{{- range $i, $a := .Alerts -}}
+{{ if $i }},{{ end }}{
+"status":{{ toJSON $a.Status }},
+"name":{{ toJSON $a.Name }},
+"labels":{{ toJSON $a.Labels }},
+"annotations":{{ toJSON $a.Annotations }},
+"startsAt":{{ toJSON $a.Start }},
+"endsAt":{{ toJSON $a.End }},
+"generatorURL":{{ toJSON $a.GeneratorURL }}
+}
+{{- end -}}
+]}`
+
+// Webhook sends alerts to a generic webhook endpoint
+// with the payload built from a template.
+type Webhook struct {
+	url string
+	// addr contains only scheme and host from url,
+	// since webhook urls may contain secrets in path and query args
+	addr    string
+	argFunc AlertURLGenerator
+	client  *http.Client
+	timeout time.Duration
+	tpl     *textTpl.Template
+
+	maxRetries       int
+	retryMinInterval time.Duration
+
+	metrics *metrics
+}
+
+// WebhookData is the data passed to the webhook payload template
+type WebhookData struct {
+	// Alerts contains the list of alerts to send
+	Alerts []WebhookAlert
+	// ExternalURL is the value of -external.url flag
+	ExternalURL string
+	// ExternalLabels contains labels from -external.label flag
+	ExternalLabels map[string]string
+}
+
+// WebhookAlert is the Alert representation passed to the webhook payload template
+type WebhookAlert struct {
+	Alert
+	// Status is either "firing" or "resolved"
+	Status string
+	// GeneratorURL is the link to the alert
+	GeneratorURL string
+}
+
+// NewWebhook returns Webhook for the given webhookURL.
+//
+// The payload is built from tplText or from the default JSON template if tplText is empty.
+// Failed requests are retried up to maxRetries times with exponential backoff starting from retryMinInterval
+// on connection errors and 5xx responses.
+func NewWebhook(webhookURL string, fn AlertURLGenerator, tplText string, timeout time.Duration, maxRetries int, retryMinInterval time.Duration) (*Webhook, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse webhook url: %w", unwrapURLError(err))
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q in webhook url; supported schemes: http, https", u.Scheme)
+	}
+	if tplText == "" {
+		tplText = defaultWebhookTemplate
+	}
+	tpl, err := newWebhookTemplate(tplText)
+	if err != nil {
+		return nil, err
+	}
+	tr, err := utils.Transport(webhookURL, "", "", "", "", false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transport: %w", err)
+	}
+	addr := u.Scheme + "://" + u.Host
+	return &Webhook{
+		url:              webhookURL,
+		addr:             addr,
+		argFunc:          fn,
+		client:           &http.Client{Transport: tr},
+		timeout:          timeout,
+		tpl:              tpl,
+		maxRetries:       maxRetries,
+		retryMinInterval: retryMinInterval,
+		metrics:          newMetrics(addr),
+	}, nil
+}
+
+func newWebhookTemplate(text string) (*textTpl.Template, error) {
+	tmpl, err := templates.Get()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get templates: %w", err)
+	}
+	tmpl = tmpl.Funcs(textTpl.FuncMap{
+		// toJSON encodes v to JSON
+		"toJSON": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return "", err
+			}
+			return string(b), nil
+		},
+	})
+	tmpl, err = tmpl.Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse webhook template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// Close is a destructor method for Webhook
+func (wh *Webhook) Close() {
+	wh.metrics.alertsSent.Unregister()
+	wh.metrics.alertsSendErrors.Unregister()
+}
+
+// Addr returns address where alerts are sent.
+func (wh *Webhook) Addr() string { return wh.addr }
+
+// Send sends alerts to the webhook
+func (wh *Webhook) Send(ctx context.Context, alerts []Alert) error {
+	wh.metrics.alertsSent.Add(len(alerts))
+	err := wh.send(ctx, alerts)
+	if err != nil {
+		wh.metrics.alertsSendErrors.Add(len(alerts))
+	}
+	return err
+}
+
+func (wh *Webhook) send(ctx context.Context, alerts []Alert) error {
+	data := WebhookData{
+		ExternalURL:    externalURL,
+		ExternalLabels: externalLabels,
+	}
+	for _, a := range alerts {
+		wa := WebhookAlert{
+			Alert:  a,
+			Status: "firing",
+		}
+		if a.State == StateInactive {
+			wa.Status = "resolved"
+		}
+		if wh.argFunc != nil {
+			wa.GeneratorURL = wh.argFunc(a)
+		}
+		data.Alerts = append(data.Alerts, wa)
+	}
+	var b bytes.Buffer
+	if err := wh.tpl.Execute(&b, data); err != nil {
+		return fmt.Errorf("cannot execute webhook template for %q: %w", wh.addr, err)
+	}
+	payload := b.Bytes()
+
+	retryInterval := wh.retryMinInterval
+	for attempt := 0; ; attempt++ {
+		retryable, err := wh.do(ctx, payload)
+		if err == nil {
+			return nil
+		}
+		if !retryable || attempt >= wh.maxRetries {
+			return err
+		}
+		t := time.NewTimer(retryInterval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return fmt.Errorf("%s; retries canceled: %w", err, ctx.Err())
+		case <-t.C:
+		}
+		retryInterval *= 2
+	}
+}
+
+// do sends payload to the webhook.
+// It returns whether the request may be retried on error.
+func (wh *Webhook) do(ctx context.Context, payload []byte) (bool, error) {
+	req, err := http.NewRequest("POST", wh.url, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if wh.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, wh.timeout)
+		defer cancel()
+	}
+	resp, err := wh.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return true, fmt.Errorf("cannot send alerts to %q: %w", wh.addr, unwrapURLError(err))
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return true, fmt.Errorf("failed to read response from %q: %w", wh.addr, err)
+	}
+	return resp.StatusCode/100 == 5, fmt.Errorf("invalid SC %d from %q; response body: %s", resp.StatusCode, wh.addr, string(body))
+}
+
+// unwrapURLError returns the underlying error for *url.Error,
+// since *url.Error contains the full url, which may contain secrets.
+func unwrapURLError(err error) error {
+	if ue, ok := err.(*url.Error); ok {
+		return ue.Err
+	}
+	return err
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
@@ -24,6 +25,8 @@ type RecordingRule struct {
 	Expr    string
 	Labels  map[string]string
 	GroupID uint64
+	// EvalTimeout limits the duration of rule evaluation if set.
+	EvalTimeout time.Duration
 
 	q datasource.Querier
 
@@ -45,8 +48,9 @@ type RecordingRule struct {
 }
 
 type recordingRuleMetrics struct {
-	errors  *utils.Gauge
-	samples *utils.Gauge
+	errors   *utils.Gauge
+	samples  *utils.Gauge
+	timeouts *utils.Counter
 }
 
 // String implements Stringer interface
@@ -69,10 +73,13 @@ func newRecordingRule(qb datasource.QuerierBuilder, group *Group, cfg config.Rul
 		Labels:  cfg.Labels,
 		GroupID: group.ID(),
 		metrics: &recordingRuleMetrics{},
+
+		EvalTimeout: cfg.EvalTimeout.Duration(),
 		q: qb.BuildWithParams(datasource.QuerierParams{
 			DataSourceType:     &group.Type,
 			EvaluationInterval: group.Interval,
 			QueryParams:        group.Params,
+			Headers:            headersToMap(cfg.Headers),
 		}),
 	}
 
@@ -92,6 +99,7 @@ func newRecordingRule(qb datasource.QuerierBuilder, group *Group, cfg config.Rul
 			defer rr.mu.RUnlock()
 			return float64(rr.lastExecSamples)
 		})
+	rr.metrics.timeouts = utils.GetOrCreateCounter(fmt.Sprintf(`vmalert_recording_rules_eval_timeouts_total{%s}`, labels))
 	return rr
 }
 
@@ -99,6 +107,7 @@ func newRecordingRule(qb datasource.QuerierBuilder, group *Group, cfg config.Rul
 func (rr *RecordingRule) Close() {
 	rr.metrics.errors.Unregister()
 	rr.metrics.samples.Unregister()
+	rr.metrics.timeouts.Unregister()
 }
 
 // ExecRange executes recording rule on the given time range similarly to Exec.
@@ -125,7 +134,7 @@ func (rr *RecordingRule) ExecRange(ctx context.Context, start, end time.Time) ([
 
 // Exec executes RecordingRule expression via the given Querier.
 func (rr *RecordingRule) Exec(ctx context.Context, ts time.Time) ([]prompbmarshal.TimeSeries, error) {
-	qMetrics, err := rr.q.Query(ctx, rr.Expr, ts)
+	qMetrics, err := queryWithTimeout(ctx, rr.q, rr.Expr, ts, rr.EvalTimeout)
 	rr.mu.Lock()
 	defer rr.mu.Unlock()
 
@@ -134,6 +143,9 @@ func (rr *RecordingRule) Exec(ctx context.Context, ts time.Time) ([]prompbmarsha
 	rr.lastExecError = err
 	rr.lastExecSamples = len(qMetrics)
 	if err != nil {
+		if errors.Is(err, errEvalTimeout) {
+			rr.metrics.timeouts.Inc()
+		}
 		return nil, fmt.Errorf("failed to execute query %q: %w", rr.Expr, err)
 	}
 
@@ -192,6 +204,7 @@ func (rr *RecordingRule) UpdateWith(r Rule) error {
 	}
 	rr.Expr = nr.Expr
 	rr.Labels = nr.Labels
+	rr.EvalTimeout = nr.EvalTimeout
 	rr.q = nr.q
 	return nil
 }
@@ -35,6 +35,10 @@ type Client struct {
 	maxBatchSize  int
 	maxQueueSize  int
 
+	// flushChs contains a channel per each worker for passing flush requests to it.
+	// The worker closes the passed channel after sending all the pending data.
+	flushChs []chan chan struct{}
+
 	wg     sync.WaitGroup
 	doneCh chan struct{}
 }
@@ -114,7 +118,9 @@ func NewClient(ctx context.Context, cfg Config) (*Client, error) {
 	}
 
 	for i := 0; i < cc; i++ {
-		c.run(ctx)
+		flushCh := make(chan chan struct{})
+		c.flushChs = append(c.flushChs, flushCh)
+		c.run(ctx, flushCh)
 	}
 	return c, nil
 }
@@ -146,7 +152,34 @@ func (c *Client) Close() error {
 	return nil
 }
 
-func (c *Client) run(ctx context.Context) {
+// Flush sends all the time series pushed before the call to the remote storage.
+//
+// Flush waits until the time series are sent or until ctx is done.
+// Note that the sent time series may become available for querying at the remote storage after some delay.
+func (c *Client) Flush(ctx context.Context) error {
+	doneChs := make([]chan struct{}, 0, len(c.flushChs))
+	for _, flushCh := range c.flushChs {
+		doneCh := make(chan struct{})
+		select {
+		case flushCh <- doneCh:
+			doneChs = append(doneChs, doneCh)
+		case <-c.doneCh:
+			return fmt.Errorf("client is closed")
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	for _, doneCh := range doneChs {
+		select {
+		case <-doneCh:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (c *Client) run(ctx context.Context, flushCh chan chan struct{}) {
 	ticker := time.NewTicker(c.flushInterval)
 	wr := &prompbmarshal.WriteRequest{}
 	shutdown := func() {
@@ -171,6 +204,25 @@ func (c *Client) run(ctx context.Context) {
 				return
 			case <-ticker.C:
 				c.flush(ctx, wr)
+			case doneCh := <-flushCh:
+				// drain the time series, which were pushed before the flush request
+			drain:
+				for {
+					select {
+					case ts, ok := <-c.input:
+						if !ok {
+							break drain
+						}
+						wr.Timeseries = append(wr.Timeseries, ts)
+						if len(wr.Timeseries) >= c.maxBatchSize {
+							c.flush(ctx, wr)
+						}
+					default:
+						break drain
+					}
+				}
+				c.flush(ctx, wr)
+				close(doneCh)
 			case ts, ok := <-c.input:
 				if !ok {
 					continue
@@ -100,3 +100,37 @@ func (rw *rwServer) handler(w http.ResponseWriter, r *http.Request) {
 	atomic.AddUint64(&rw.acceptedRows, uint64(len(wr.Timeseries)))
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func TestClient_Flush(t *testing.T) {
+	testSrv := newRWServer()
+	cfg := Config{
+		Addr:          testSrv.URL,
+		Concurrency:   3,
+		FlushInterval: time.Hour,
+	}
+	client, err := NewClient(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("failed to create client: %s", err)
+	}
+	defer func() { _ = client.Close() }()
+	for i := 1; i <= 3; i++ {
+		for j := 0; j < 10; j++ {
+			s := prompbmarshal.TimeSeries{
+				Samples: []prompbmarshal.Sample{{
+					Value:     rand.Float64(),
+					Timestamp: time.Now().Unix(),
+				}},
+			}
+			if err := client.Push(s); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+		if err := client.Flush(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		// all the pushed series must be sent after Flush returns
+		if got := testSrv.accepted(); got != i*10 {
+			t.Fatalf("expected to have %d series; got %d", i*10, got)
+		}
+	}
+}
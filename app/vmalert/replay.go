@@ -87,7 +87,13 @@ func (g *Group) replay(start, end time.Time, rw *remotewrite.Client) int {
 		"\nrequests to make: \t%d"+
 		"\nmax range per request: \t%v\n",
 		g.Name, g.Interval, iterations, step)
-	for _, rule := range g.Rules {
+	// evaluate rules according to dependencies between them,
+	// so chained rules could be calculated correctly
+	var rules []Rule
+	for _, level := range getRuleLevels(g.Rules) {
+		rules = append(rules, level...)
+	}
+	for _, rule := range rules {
 		fmt.Printf("> Rule %q (ID: %d)\n", rule, rule.ID())
 		var bar *pb.ProgressBar
 		if !*disableProgressBar {
@@ -107,8 +113,13 @@ func (g *Group) replay(start, end time.Time, rw *remotewrite.Client) int {
 		if bar != nil {
 			bar.Finish()
 		}
-		// sleep to let remote storage to flush data on-disk
-		// so chained rules could be calculated correctly
+		// send all the rule results to remote storage and sleep to let remote storage
+		// to flush data on-disk, so chained rules could be calculated correctly
+		if rw != nil {
+			if err := rw.Flush(context.Background()); err != nil {
+				logger.Fatalf("rule %q: cannot send results to remote storage: %s", rule, err)
+			}
+		}
 		time.Sleep(*replayRulesDelay)
 	}
 	return total
@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
 )
 
@@ -30,3 +32,21 @@ type Rule interface {
 }
 
 var errDuplicate = errors.New("result contains metrics with the same labelset after applying rule labels")
+
+var errEvalTimeout = errors.New("rule evaluation timed out")
+
+// queryWithTimeout executes the given expr via q.
+// The query is canceled with errEvalTimeout error if it isn't finished during the given timeout.
+// Zero timeout means no timeout.
+func queryWithTimeout(ctx context.Context, q datasource.Querier, expr string, ts time.Time, timeout time.Duration) ([]datasource.Metric, error) {
+	if timeout <= 0 {
+		return q.Query(ctx, expr, ts)
+	}
+	tctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	res, err := q.Query(tctx, expr, ts)
+	if err != nil && ctx.Err() == nil && errors.Is(tctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%w after eval_timeout=%s: %s", errEvalTimeout, timeout, err)
+	}
+	return res, err
+}
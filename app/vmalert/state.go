@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/notifier"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	stateFile = flag.String("rule.stateFile", "", "Optional path to file for persisting the state of pending and firing alerts. "+
+		"The state is saved on graceful shutdown and every -rule.stateSaveInterval and is restored on startup, "+
+		"so the pending timers of alerting rules survive vmalert restarts. See https://docs.victoriametrics.com/vmalert.html#alerts-state-on-restarts")
+	stateSaveInterval = flag.Duration("rule.stateSaveInterval", time.Minute, "Interval for saving the state of alerts to -rule.stateFile. "+
+		"The state is saved only on graceful shutdown if set to zero")
+	stateMaxAge = flag.Duration("rule.stateMaxAge", time.Hour, "The maximum age of the state at -rule.stateFile, which can be restored on startup. "+
+		"Older state is ignored, since alerts could change their state while vmalert was down")
+)
+
+var (
+	stateSaves      = metrics.NewCounter(`vmalert_state_saves_total`)
+	stateSaveErrors = metrics.NewCounter(`vmalert_state_save_errors_total`)
+)
+
+// alertsState is the state of alerts persisted at -rule.stateFile.
+type alertsState struct {
+	// SavedAt is the time when the state has been saved.
+	SavedAt time.Time `json:"savedAt"`
+	// Alerts contains pending and firing alerts.
+	Alerts []alertState `json:"alerts"`
+}
+
+// alertState is the persisted state of a single alert.
+type alertState struct {
+	GroupID     uint64              `json:"groupID"`
+	RuleID      uint64              `json:"ruleID"`
+	ID          uint64              `json:"id"`
+	Name        string              `json:"name"`
+	Labels      map[string]string   `json:"labels"`
+	Annotations map[string]string   `json:"annotations"`
+	State       notifier.AlertState `json:"state"`
+	Expr        string              `json:"expr"`
+	ActiveAt    time.Time           `json:"activeAt"`
+	Start       time.Time           `json:"start"`
+	LastSent    time.Time           `json:"lastSent"`
+	Value       float64             `json:"value"`
+}
+
+// restoredAlerts contains alerts loaded from -rule.stateFile.
+//
+// map[groupID]map[ruleID][]alertState
+type restoredAlerts map[uint64]map[uint64][]alertState
+
+// getAlertsState returns the state of pending and firing alerts for the given groups.
+func getAlertsState(groups []*Group, now time.Time) *alertsState {
+	st := &alertsState{
+		SavedAt: now,
+	}
+	for _, g := range groups {
+		gID := g.ID()
+		g.mu.RLock()
+		for _, rule := range g.Rules {
+			ar, ok := rule.(*AlertingRule)
+			if !ok {
+				continue
+			}
+			ar.mu.RLock()
+			for _, a := range ar.alerts {
+				if a.State != notifier.StatePending && a.State != notifier.StateFiring {
+					continue
+				}
+				st.Alerts = append(st.Alerts, alertState{
+					GroupID:     gID,
+					RuleID:      ar.RuleID,
+					ID:          a.ID,
+					Name:        a.Name,
+					Labels:      a.Labels,
+					Annotations: a.Annotations,
+					State:       a.State,
+					Expr:        a.Expr,
+					ActiveAt:    a.ActiveAt,
+					Start:       a.Start,
+					LastSent:    a.LastSent,
+					Value:       a.Value,
+				})
+			}
+			ar.mu.RUnlock()
+		}
+		g.mu.RUnlock()
+	}
+	return st
+}
+
+// saveAlertsState atomically writes st to the file at path.
+func saveAlertsState(path string, st *alertsState) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("cannot marshal alerts state: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("cannot write alerts state to %q: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("cannot rename %q to %q: %w", tmpPath, path, err)
+	}
+	return nil
+}
+
+// loadAlertsState loads alerts state from the file at path.
+//
+// nil is returned if the file doesn't exist or if the state is older than maxAge.
+func loadAlertsState(path string, maxAge time.Duration, now time.Time) (restoredAlerts, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot read alerts state: %w", err)
+	}
+	var st alertsState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("cannot parse alerts state from %q: %w", path, err)
+	}
+	if age := now.Sub(st.SavedAt); age > maxAge {
+		logger.Warnf("ignoring alerts state from %q, since it is older than -rule.stateMaxAge=%s; state age: %s", path, maxAge, age)
+		return nil, nil
+	}
+	ra := make(restoredAlerts)
+	for _, as := range st.Alerts {
+		rules := ra[as.GroupID]
+		if rules == nil {
+			rules = make(map[uint64][]alertState)
+			ra[as.GroupID] = rules
+		}
+		rules[as.RuleID] = append(rules[as.RuleID], as)
+	}
+	return ra, nil
+}
+
+// restoreAlerts restores alerts state for g rules from ra.
+func (g *Group) restoreAlerts(ra restoredAlerts) {
+	rules := ra[g.ID()]
+	if len(rules) == 0 {
+		return
+	}
+	for _, rule := range g.Rules {
+		ar, ok := rule.(*AlertingRule)
+		if !ok {
+			continue
+		}
+		if alerts := rules[ar.RuleID]; len(alerts) > 0 {
+			ar.restoreAlerts(alerts)
+		}
+	}
+}
+
+// restoreAlerts restores the state of the given alerts for ar.
+//
+// It overrides the state restored via remote read.
+func (ar *AlertingRule) restoreAlerts(alerts []alertState) {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	for _, as := range alerts {
+		ar.alerts[as.ID] = &notifier.Alert{
+			GroupID:     ar.GroupID,
+			Name:        as.Name,
+			Labels:      as.Labels,
+			Annotations: as.Annotations,
+			State:       as.State,
+			Expr:        as.Expr,
+			ActiveAt:    as.ActiveAt,
+			Start:       as.Start,
+			LastSent:    as.LastSent,
+			Value:       as.Value,
+			ID:          as.ID,
+			Restored:    true,
+		}
+		logger.Infof("alert %q (%d) restored from -rule.stateFile to state %s active at %v", as.Name, as.ID, as.State, as.ActiveAt)
+	}
+}
+
+// saveState saves the state of alerts for m groups to -rule.stateFile.
+func (m *manager) saveState() {
+	if *stateFile == "" {
+		return
+	}
+	m.groupsMu.RLock()
+	groups := make([]*Group, 0, len(m.groups))
+	for _, g := range m.groups {
+		groups = append(groups, g)
+	}
+	m.groupsMu.RUnlock()
+
+	st := getAlertsState(groups, time.Now())
+	stateSaves.Inc()
+	if err := saveAlertsState(*stateFile, st); err != nil {
+		stateSaveErrors.Inc()
+		logger.Errorf("cannot save alerts state to -rule.stateFile: %s", err)
+	}
+}
+
+// runStateSaver periodically saves the state of alerts to -rule.stateFile until ctx is done.
+func (m *manager) runStateSaver(ctx context.Context) {
+	if *stateFile == "" || *stateSaveInterval <= 0 {
+		return
+	}
+	t := time.NewTicker(*stateSaveInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			m.saveState()
+		}
+	}
+}
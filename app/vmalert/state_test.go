@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/config"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/notifier"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promutils"
+)
+
+func newStateTestGroup(t *testing.T, fq *fakeQuerier) *Group {
+	t.Helper()
+	r := config.Rule{
+		Alert: "HighLatency",
+		Expr:  "latency > 1",
+		For:   promutils.NewDuration(time.Minute),
+	}
+	r.ID = config.HashRule(r)
+	cfg := config.Group{
+		Name:  "TestGroup",
+		Rules: []config.Rule{r},
+	}
+	return newGroup(cfg, fq, time.Second, nil)
+}
+
+func getAlertState(t *testing.T, g *Group) (notifier.AlertState, time.Time) {
+	t.Helper()
+	ar := g.Rules[0].(*AlertingRule)
+	if len(ar.alerts) != 1 {
+		t.Fatalf("expecting 1 alert; got %d", len(ar.alerts))
+	}
+	for _, a := range ar.alerts {
+		return a.State, a.ActiveAt
+	}
+	return 0, time.Time{}
+}
+
+func TestAlertsStateRestoreMidFor(t *testing.T) {
+	fq := &fakeQuerier{}
+	fq.add(metricWithValueAndLabels(t, 2, "__name__", "latency", "job", "foo"))
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	// the alert becomes pending before the restart
+	t0 := time.Now().Truncate(time.Second)
+	g := newStateTestGroup(t, fq)
+	if _, err := g.Rules[0].Exec(context.Background(), t0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if state, _ := getAlertState(t, g); state != notifier.StatePending {
+		t.Fatalf("unexpected alert state before restart; got %s; want %s", state, notifier.StatePending)
+	}
+	if err := saveAlertsState(path, getAlertsState([]*Group{g}, t0)); err != nil {
+		t.Fatalf("cannot save alerts state: %s", err)
+	}
+
+	// restart in the middle of `for` interval
+	ra, err := loadAlertsState(path, time.Hour, t0.Add(30*time.Second))
+	if err != nil {
+		t.Fatalf("cannot load alerts state: %s", err)
+	}
+	g = newStateTestGroup(t, fq)
+	g.restoreAlerts(ra)
+	state, activeAt := getAlertState(t, g)
+	if state != notifier.StatePending {
+		t.Fatalf("unexpected restored alert state; got %s; want %s", state, notifier.StatePending)
+	}
+	if !activeAt.Equal(t0) {
+		t.Fatalf("unexpected restored activeAt; got %s; want %s", activeAt, t0)
+	}
+
+	if _, err := g.Rules[0].Exec(context.Background(), t0.Add(40*time.Second)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if state, _ := getAlertState(t, g); state != notifier.StatePending {
+		t.Fatalf("unexpected alert state before `for` interval ends; got %s; want %s", state, notifier.StatePending)
+	}
+
+	// the timer resumes from the original activeAt, so the alert fires after `for` since t0
+	if _, err := g.Rules[0].Exec(context.Background(), t0.Add(time.Minute)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	state, activeAt = getAlertState(t, g)
+	if state != notifier.StateFiring {
+		t.Fatalf("unexpected alert state after `for` interval; got %s; want %s", state, notifier.StateFiring)
+	}
+	if !activeAt.Equal(t0) {
+		t.Fatalf("unexpected activeAt; got %s; want %s", activeAt, t0)
+	}
+}
+
+func TestAlertsStateRestoreStale(t *testing.T) {
+	fq := &fakeQuerier{}
+	fq.add(metricWithValueAndLabels(t, 2, "__name__", "latency", "job", "foo"))
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	t0 := time.Now()
+	g := newStateTestGroup(t, fq)
+	if _, err := g.Rules[0].Exec(context.Background(), t0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := saveAlertsState(path, getAlertsState([]*Group{g}, t0)); err != nil {
+		t.Fatalf("cannot save alerts state: %s", err)
+	}
+	ra, err := loadAlertsState(path, time.Hour, t0.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("cannot load alerts state: %s", err)
+	}
+	if ra != nil {
+		t.Fatalf("expecting stale alerts state to be ignored; got %v", ra)
+	}
+
+	// missing state file
+	ra, err = loadAlertsState(filepath.Join(t.TempDir(), "missing.json"), time.Hour, t0)
+	if err != nil {
+		t.Fatalf("unexpected error for missing state file: %s", err)
+	}
+	if ra != nil {
+		t.Fatalf("expecting nil state for missing state file; got %v", ra)
+	}
+}
@@ -19,6 +19,10 @@ type InsertCtx struct {
 	mrs            []storage.MetricRow
 	metricNamesBuf []byte
 
+	exemplarRows           []storage.ExemplarRow
+	exemplarTagsBuf        []storage.Tag
+	exemplarMetricNamesBuf []byte
+
 	relabelCtx relabel.Ctx
 }
 
@@ -41,6 +45,17 @@ func (ctx *InsertCtx) Reset(rowsLen int) {
 	}
 	ctx.mrs = ctx.mrs[:0]
 	ctx.metricNamesBuf = ctx.metricNamesBuf[:0]
+
+	for i := range ctx.exemplarRows {
+		ctx.exemplarRows[i] = storage.ExemplarRow{}
+	}
+	ctx.exemplarRows = ctx.exemplarRows[:0]
+	for i := range ctx.exemplarTagsBuf {
+		ctx.exemplarTagsBuf[i] = storage.Tag{}
+	}
+	ctx.exemplarTagsBuf = ctx.exemplarTagsBuf[:0]
+	ctx.exemplarMetricNamesBuf = ctx.exemplarMetricNamesBuf[:0]
+
 	ctx.relabelCtx.Reset()
 }
 
@@ -89,6 +104,27 @@ func (ctx *InsertCtx) addRow(metricNameRaw []byte, timestamp int64, value float6
 	return nil
 }
 
+// WriteExemplar writes exemplar with the given tags, value and timestamp for the series with the given metricNameRaw into ctx buffer.
+//
+// metricNameRaw must be obtained from WriteDataPointExt. tags must exist until ctx.FlushBufs is called.
+func (ctx *InsertCtx) WriteExemplar(metricNameRaw []byte, tags []storage.Tag, value float64, timestamp int64) {
+	// Copy metricNameRaw, since it may be overwritten if ctx.FlushBufs has been called inside WriteDataPointExt.
+	nameStart := len(ctx.exemplarMetricNamesBuf)
+	ctx.exemplarMetricNamesBuf = append(ctx.exemplarMetricNamesBuf, metricNameRaw...)
+	metricNameRaw = ctx.exemplarMetricNamesBuf[nameStart:]
+	tagsStart := len(ctx.exemplarTagsBuf)
+	ctx.exemplarTagsBuf = append(ctx.exemplarTagsBuf, tags...)
+	exemplarTags := ctx.exemplarTagsBuf[tagsStart:]
+	ctx.exemplarRows = append(ctx.exemplarRows, storage.ExemplarRow{
+		MetricNameRaw: metricNameRaw,
+		Exemplar: storage.Exemplar{
+			Tags:      exemplarTags[:len(exemplarTags):len(exemplarTags)],
+			Value:     value,
+			Timestamp: timestamp,
+		},
+	})
+}
+
 // AddLabelBytes adds (name, value) label to ctx.Labels.
 //
 // name and value must exist until ctx.Labels is used.
@@ -126,13 +162,25 @@ func (ctx *InsertCtx) AddLabel(name, value string) {
 }
 
 // ApplyRelabeling applies relabeling to ic.Labels.
+//
+// It must be used for metrics ingested via push protocols.
 func (ctx *InsertCtx) ApplyRelabeling() {
 	ctx.Labels = ctx.relabelCtx.ApplyRelabeling(ctx.Labels)
 }
 
+// ApplyRelabelingForScrapedData applies relabeling to ic.Labels for scraped metrics.
+//
+// -ingestion.relabelConfig isn't applied to scraped metrics.
+func (ctx *InsertCtx) ApplyRelabelingForScrapedData() {
+	ctx.Labels = ctx.relabelCtx.ApplyRelabelingForScrapedData(ctx.Labels)
+}
+
 // FlushBufs flushes buffered rows to the underlying storage.
 func (ctx *InsertCtx) FlushBufs() error {
 	err := vmstorage.AddRows(ctx.mrs)
+	if err == nil {
+		err = vmstorage.AddExemplars(ctx.exemplarRows)
+	}
 	ctx.Reset(0)
 	if err == nil {
 		return nil
@@ -142,3 +190,8 @@ func (ctx *InsertCtx) FlushBufs() error {
 		StatusCode: http.StatusServiceUnavailable,
 	}
 }
+
+// AddMetadata adds mds to the in-memory metadata storage.
+func AddMetadata(mds []storage.MetricMetadata) {
+	vmstorage.AddMetadata(mds)
+}
@@ -18,9 +18,11 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/prometheusimport"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/prompush"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/promremotewrite"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/pushgateway"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/relabel"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/vmimport"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/influxutils"
 	graphiteserver "github.com/VictoriaMetrics/VictoriaMetrics/lib/ingestserver/graphite"
@@ -46,6 +48,10 @@ var (
 	configAuthKey          = flag.String("configAuthKey", "", "Authorization key for accessing /config page. It must be passed via authKey query arg")
 	maxLabelsPerTimeseries = flag.Int("maxLabelsPerTimeseries", 30, "The maximum number of labels accepted per time series. Superfluous labels are dropped. In this case the vm_metrics_with_dropped_labels_total metric at /metrics page is incremented")
 	maxLabelValueLen       = flag.Int("maxLabelValueLen", 16*1024, "The maximum length of label values in the accepted time series. Longer label values are truncated. In this case the vm_too_long_label_values_total metric at /metrics page is incremented")
+	maxImportRequestSize   = flagutil.NewBytes("import.maxRequestSize", 0, "The maximum size in bytes of a single request to /api/v1/import, /api/v1/import/csv, /api/v1/import/prometheus, /api/v1/import/native and Pushgateway API at /metrics/job/... . "+
+		"Bigger requests are rejected with '413 Request Entity Too Large' response. There is no limit if the value is set to 0")
+	maxInfluxRequestSize = flagutil.NewBytes("influx.maxRequestSize", 0, "The maximum size in bytes of a single InfluxDB line protocol request sent over HTTP. "+
+		"Bigger requests are rejected with '413 Request Entity Too Large' response. There is no limit if the value is set to 0")
 )
 
 var (
@@ -74,11 +80,16 @@ func Init() {
 	if len(*opentsdbHTTPListenAddr) > 0 {
 		opentsdbhttpServer = opentsdbhttpserver.MustStart(*opentsdbHTTPListenAddr, opentsdbhttp.InsertHandler)
 	}
+	promscrape.SetMetadataHandler(prometheusimport.AddMetadata)
 	promscrape.Init(prompush.Push)
+	pushgateway.Init()
+	vmimport.Init()
 }
 
 // Stop stops vminsert.
 func Stop() {
+	vmimport.Stop()
+	pushgateway.Stop()
 	promscrape.Stop()
 	if len(*graphiteListenAddr) > 0 {
 		graphiteServer.MustStop()
@@ -101,6 +112,15 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 	defer requestDuration.UpdateDuration(startTime)
 
 	path := strings.Replace(r.URL.Path, "//", "/", -1)
+	httpserver.LimitRequestBody(r, getMaxRequestBodySize(path))
+	if pushgateway.IsPushgatewayPath(path) {
+		pushgatewayRequests.Inc()
+		if err := pushgateway.RequestHandler(w, r); err != nil {
+			pushgatewayErrors.Inc()
+			httpserver.Errorf(w, r, "%s", err)
+		}
+		return true
+	}
 	switch path {
 	case "/prometheus/api/v1/write", "/api/v1/write":
 		prometheusWriteRequests.Inc()
@@ -236,7 +256,7 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 		promscrapeStatusConfigRequests.Inc()
 		w.Header().Set("Content-Type", "application/json")
 		var bb bytesutil.ByteBuffer
-		promscrape.WriteConfigData(&bb)
+		promscrape.WriteEffectiveConfigData(&bb)
 		fmt.Fprintf(w, `{"status":"success","data":{"yaml":%q}}`, bb.B)
 		return true
 	case "/prometheus/-/reload", "/-/reload":
@@ -260,6 +280,26 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 	}
 }
 
+// getMaxRequestBodySize returns the maximum request body size for the given ingestion path.
+//
+// Zero is returned if the request body size isn't limited for the given path.
+func getMaxRequestBodySize(path string) int64 {
+	path = strings.TrimPrefix(path, "/")
+	path = strings.TrimPrefix(path, "prometheus/")
+	if strings.HasPrefix(path, "metrics/job") {
+		// Pushgateway API
+		return int64(maxImportRequestSize.N)
+	}
+	switch path {
+	case "api/v1/import", "api/v1/import/csv", "api/v1/import/prometheus", "api/v1/import/native":
+		return int64(maxImportRequestSize.N)
+	case "write", "api/v2/write", "influx/write", "influx/api/v2/write":
+		return int64(maxInfluxRequestSize.N)
+	default:
+		return 0
+	}
+}
+
 func addInfluxResponseHeaders(w http.ResponseWriter) {
 	// This is needed for some clients, which expect InfluxDB version header.
 	// See, for example, https://github.com/ntop/ntopng/issues/5449#issuecomment-1005347597
@@ -284,6 +324,9 @@ var (
 	nativeimportRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/import/native", protocol="nativeimport"}`)
 	nativeimportErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/import/native", protocol="nativeimport"}`)
 
+	pushgatewayRequests = metrics.NewCounter(`vm_http_requests_total{path="/metrics/job", protocol="pushgateway"}`)
+	pushgatewayErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/metrics/job", protocol="pushgateway"}`)
+
 	influxWriteRequests = metrics.NewCounter(`vm_http_requests_total{path="/influx/write", protocol="influx"}`)
 	influxWriteErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/influx/write", protocol="influx"}`)
 
@@ -5,9 +5,11 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/common"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/relabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
 	parserCommon "github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/common"
 	parser "github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/prometheus"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/writeconcurrencylimiter"
 	"github.com/VictoriaMetrics/metrics"
 )
@@ -29,17 +31,37 @@ func InsertHandler(req *http.Request) error {
 	}
 	return writeconcurrencylimiter.Do(func() error {
 		isGzipped := req.Header.Get("Content-Encoding") == "gzip"
-		return parser.ParseStream(req.Body, defaultTimestamp, isGzipped, func(rows []parser.Row) error {
+		return parser.ParseStreamWithMetadata(req.Body, defaultTimestamp, isGzipped, func(rows []parser.Row, mds []parser.Metadata) error {
+			AddMetadata(mds)
 			return insertRows(rows, extraLabels)
 		}, nil)
 	})
 }
 
+// AddMetadata adds TYPE, HELP and UNIT metadata from mds to the storage.
+func AddMetadata(mds []parser.Metadata) {
+	if len(mds) == 0 {
+		return
+	}
+	smds := make([]storage.MetricMetadata, len(mds))
+	for i := range mds {
+		md := &mds[i]
+		smds[i] = storage.MetricMetadata{
+			Metric: md.Metric,
+			Type:   md.Type,
+			Help:   md.Help,
+			Unit:   md.Unit,
+		}
+	}
+	common.AddMetadata(smds)
+}
+
 func insertRows(rows []parser.Row, extraLabels []prompbmarshal.Label) error {
 	ctx := common.GetInsertCtx()
 	defer common.PutInsertCtx(ctx)
 
 	ctx.Reset(len(rows))
+	var tagsBuf []storage.Tag
 	hasRelabeling := relabel.HasRelabeling()
 	for i := range rows {
 		r := &rows[i]
@@ -61,9 +83,25 @@ func insertRows(rows []parser.Row, extraLabels []prompbmarshal.Label) error {
 			continue
 		}
 		ctx.SortLabelsIfNeeded()
-		if err := ctx.WriteDataPoint(nil, ctx.Labels, r.Timestamp, r.Value); err != nil {
+		metricNameRaw, err := ctx.WriteDataPointExt(nil, ctx.Labels, r.Timestamp, r.Value)
+		if err != nil {
 			return err
 		}
+		if e := &r.Exemplar; len(e.Tags) > 0 {
+			tagsBuf = tagsBuf[:0]
+			for j := range e.Tags {
+				tag := &e.Tags[j]
+				tagsBuf = append(tagsBuf, storage.Tag{
+					Key:   bytesutil.ToUnsafeBytes(tag.Key),
+					Value: bytesutil.ToUnsafeBytes(tag.Value),
+				})
+			}
+			timestamp := e.Timestamp
+			if timestamp == 0 {
+				timestamp = r.Timestamp
+			}
+			ctx.WriteExemplar(metricNameRaw, tagsBuf, e.Value, timestamp)
+		}
 	}
 	rowsInserted.Add(len(rows))
 	rowsPerInsert.Update(float64(len(rows)))
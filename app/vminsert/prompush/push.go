@@ -57,7 +57,7 @@ func push(ctx *common.InsertCtx, tss []prompbmarshal.TimeSeries) {
 			label := &ts.Labels[j]
 			ctx.AddLabel(label.Name, label.Value)
 		}
-		ctx.ApplyRelabeling()
+		ctx.ApplyRelabelingForScrapedData()
 		if len(ctx.Labels) == 0 {
 			// Skip metric without labels.
 			continue
@@ -0,0 +1,457 @@
+package pushgateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	parser "github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/prometheus"
+)
+
+// groups contains metrics pushed via Pushgateway API per each grouping key.
+type groups struct {
+	// write must write tss to the storage.
+	write func(tss []prompbmarshal.TimeSeries) error
+
+	// addMetadata must store metadata for the pushed metrics.
+	addMetadata func(mds []parser.Metadata)
+
+	mu sync.Mutex
+
+	// m contains groups keyed by the marshaled grouping labels.
+	m map[string]*group
+
+	// seriesCount is the total number of series across all the groups in m.
+	seriesCount int
+
+	// maxGroups is the maximum number of groups, which can be stored in m. There is no limit if it is zero.
+	maxGroups int
+
+	// maxSeries is the maximum number of series across all the groups. There is no limit if it is zero.
+	maxSeries int
+
+	// changed is set to true when m is changed. It is used for saving groups only after changes.
+	changed bool
+}
+
+// group contains metrics pushed for a single grouping key.
+type group struct {
+	// labels contains grouping labels sorted by name.
+	labels []prompbmarshal.Label
+
+	// families contains pushed series per each metric family name.
+	families map[string][]*series
+
+	// pushTimestamp is the timestamp in milliseconds for the last push to the group.
+	pushTimestamp int64
+}
+
+// series is a single pushed series.
+type series struct {
+	// labels contains all the series labels including __name__ and grouping labels sorted by name.
+	labels []prompbmarshal.Label
+
+	value float64
+}
+
+func newGroups(write func(tss []prompbmarshal.TimeSeries) error, addMetadata func(mds []parser.Metadata)) *groups {
+	return &groups{
+		write:       write,
+		addMetadata: addMetadata,
+		m:           make(map[string]*group),
+	}
+}
+
+// push pushes rows to the group with the given groupingLabels at the given timestamp in milliseconds.
+//
+// All the previously pushed metrics for the group are replaced with rows if replaceAll is set.
+// Otherwise only metric families from rows are replaced.
+// Staleness markers are written for the replaced series missing in rows.
+func (gs *groups) push(groupingLabels []prompbmarshal.Label, rows []parser.Row, mds []parser.Metadata, replaceAll bool, timestamp int64) error {
+	families, err := newFamilies(groupingLabels, rows, mds)
+	if err != nil {
+		return err
+	}
+	key := marshalLabels(groupingLabels)
+
+	gs.mu.Lock()
+	g := gs.m[key]
+	if g == nil {
+		if gs.maxGroups > 0 && len(gs.m) >= gs.maxGroups {
+			gs.mu.Unlock()
+			return fmt.Errorf("cannot create a new group %s, since the number of groups reached -pushgateway.maxGroups=%d; "+
+				"delete unused groups or increase -pushgateway.maxGroups", key, gs.maxGroups)
+		}
+		g = &group{
+			labels:   groupingLabels,
+			families: make(map[string][]*series),
+		}
+	}
+	seriesDelta := g.getSeriesDelta(families, replaceAll)
+	if gs.maxSeries > 0 && seriesDelta > 0 && gs.seriesCount+seriesDelta > gs.maxSeries {
+		gs.mu.Unlock()
+		return fmt.Errorf("cannot push %d new series to the group %s, since the total number of series would exceed -pushgateway.maxSeries=%d; "+
+			"delete unused groups or increase -pushgateway.maxSeries", seriesDelta, key, gs.maxSeries)
+	}
+	gs.m[key] = g
+	gs.seriesCount += seriesDelta
+	var tss []prompbmarshal.TimeSeries
+	if replaceAll {
+		tss = g.appendStaleSeries(tss, families, nil, timestamp)
+		g.families = families
+	} else {
+		for name, ss := range families {
+			tss = g.appendStaleSeries(tss, families, g.families[name], timestamp)
+			g.families[name] = ss
+		}
+	}
+	g.pushTimestamp = timestamp
+	tss = g.appendTimeSeries(tss, timestamp)
+	gs.changed = true
+	gs.mu.Unlock()
+
+	gs.addMetadata(mds)
+	return gs.write(tss)
+}
+
+// delete deletes the group with the given groupingLabels and writes staleness markers for its series at the given timestamp.
+func (gs *groups) delete(groupingLabels []prompbmarshal.Label, timestamp int64) error {
+	key := marshalLabels(groupingLabels)
+
+	gs.mu.Lock()
+	g := gs.m[key]
+	if g == nil {
+		gs.mu.Unlock()
+		return nil
+	}
+	delete(gs.m, key)
+	gs.seriesCount -= g.seriesCount()
+	gs.changed = true
+	tss := g.appendStaleSeries(nil, nil, nil, timestamp)
+	tss = appendSample(tss, g.pushTimeLabels(), decimal.StaleNaN, timestamp)
+	gs.mu.Unlock()
+
+	return gs.write(tss)
+}
+
+// writeAll writes the current values for all the groups at the given timestamp in milliseconds.
+func (gs *groups) writeAll(timestamp int64) error {
+	gs.mu.Lock()
+	var tss []prompbmarshal.TimeSeries
+	for _, g := range gs.m {
+		tss = g.appendTimeSeries(tss, timestamp)
+	}
+	gs.mu.Unlock()
+
+	if len(tss) == 0 {
+		return nil
+	}
+	return gs.write(tss)
+}
+
+// len returns the number of groups in gs.
+func (gs *groups) len() int {
+	gs.mu.Lock()
+	n := len(gs.m)
+	gs.mu.Unlock()
+	return n
+}
+
+// seriesLen returns the total number of series in gs.
+func (gs *groups) seriesLen() int {
+	gs.mu.Lock()
+	n := gs.seriesCount
+	gs.mu.Unlock()
+	return n
+}
+
+// seriesCount returns the number of series in g.
+func (g *group) seriesCount() int {
+	n := 0
+	for _, ss := range g.families {
+		n += len(ss)
+	}
+	return n
+}
+
+// getSeriesDelta returns the change in the number of series in g after pushing the given families to it.
+func (g *group) getSeriesDelta(families map[string][]*series, replaceAll bool) int {
+	n := 0
+	for name, ss := range families {
+		n += len(ss)
+		if !replaceAll {
+			n -= len(g.families[name])
+		}
+	}
+	if replaceAll {
+		n -= g.seriesCount()
+	}
+	return n
+}
+
+// appendTimeSeries appends the current values for g series at the given timestamp to dst and returns the result.
+//
+// The series are appended in stable order.
+func (g *group) appendTimeSeries(dst []prompbmarshal.TimeSeries, timestamp int64) []prompbmarshal.TimeSeries {
+	names := make([]string, 0, len(g.families))
+	for name := range g.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, s := range g.families[name] {
+			dst = appendSample(dst, s.labels, s.value, timestamp)
+		}
+	}
+	return appendSample(dst, g.pushTimeLabels(), float64(g.pushTimestamp)/1e3, timestamp)
+}
+
+// appendStaleSeries appends staleness markers to dst for series from ss, which are missing in families.
+//
+// All the series from g are used if ss is nil.
+func (g *group) appendStaleSeries(dst []prompbmarshal.TimeSeries, families map[string][]*series, ss []*series, timestamp int64) []prompbmarshal.TimeSeries {
+	if ss == nil {
+		for _, familySeries := range g.families {
+			ss = append(ss, familySeries...)
+		}
+	}
+	newKeys := make(map[string]struct{})
+	for _, familySeries := range families {
+		for _, s := range familySeries {
+			newKeys[marshalLabels(s.labels)] = struct{}{}
+		}
+	}
+	for _, s := range ss {
+		if _, ok := newKeys[marshalLabels(s.labels)]; ok {
+			continue
+		}
+		dst = appendSample(dst, s.labels, decimal.StaleNaN, timestamp)
+	}
+	return dst
+}
+
+// pushTimeLabels returns labels for push_time_seconds metric for g.
+//
+// This metric contains the timestamp of the last push to g in the same way as Pushgateway does.
+func (g *group) pushTimeLabels() []prompbmarshal.Label {
+	labels := make([]prompbmarshal.Label, 0, len(g.labels)+1)
+	labels = append(labels, prompbmarshal.Label{
+		Name:  "__name__",
+		Value: "push_time_seconds",
+	})
+	return append(labels, g.labels...)
+}
+
+func appendSample(dst []prompbmarshal.TimeSeries, labels []prompbmarshal.Label, value float64, timestamp int64) []prompbmarshal.TimeSeries {
+	return append(dst, prompbmarshal.TimeSeries{
+		Labels: labels,
+		Samples: []prompbmarshal.Sample{{
+			Value:     value,
+			Timestamp: timestamp,
+		}},
+	})
+}
+
+// newFamilies returns series from rows grouped by metric family names.
+//
+// groupingLabels are added to every series.
+func newFamilies(groupingLabels []prompbmarshal.Label, rows []parser.Row, mds []parser.Metadata) (map[string][]*series, error) {
+	types := make(map[string]string, len(mds))
+	for _, md := range mds {
+		types[md.Metric] = md.Type
+	}
+	families := make(map[string][]*series)
+	for i := range rows {
+		r := &rows[i]
+		if r.Timestamp != 0 {
+			return nil, fmt.Errorf("pushed metrics mustn't contain timestamps; got timestamp %d for %q", r.Timestamp, r.Metric)
+		}
+		labels := make([]prompbmarshal.Label, 0, 1+len(r.Tags)+len(groupingLabels))
+		labels = append(labels, prompbmarshal.Label{
+			Name:  "__name__",
+			Value: r.Metric,
+		})
+		for _, tag := range r.Tags {
+			if v, ok := getLabelValue(groupingLabels, tag.Key); ok {
+				if v != tag.Value {
+					return nil, fmt.Errorf("label %s=%q for %q conflicts with the grouping label %s=%q", tag.Key, tag.Value, r.Metric, tag.Key, v)
+				}
+				continue
+			}
+			labels = append(labels, prompbmarshal.Label{
+				Name:  tag.Key,
+				Value: tag.Value,
+			})
+		}
+		labels = append(labels, groupingLabels...)
+		sortLabels(labels)
+		name := getFamilyName(r.Metric, types)
+		families[name] = append(families[name], &series{
+			labels: labels,
+			value:  r.Value,
+		})
+	}
+	return families, nil
+}
+
+// getFamilyName returns metric family name for the given metric according to types obtained from `# TYPE` lines.
+//
+// For example, `foo_bucket`, `foo_sum` and `foo_count` metrics belong to `foo` family if `foo` is a histogram.
+func getFamilyName(metric string, types map[string]string) string {
+	if _, ok := types[metric]; ok {
+		return metric
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count", "_total", "_created"} {
+		if !strings.HasSuffix(metric, suffix) {
+			continue
+		}
+		name := metric[:len(metric)-len(suffix)]
+		switch types[name] {
+		case "histogram", "summary", "counter":
+			return name
+		}
+	}
+	return metric
+}
+
+func getLabelValue(labels []prompbmarshal.Label, name string) (string, bool) {
+	for _, label := range labels {
+		if label.Name == name {
+			return label.Value, true
+		}
+	}
+	return "", false
+}
+
+func sortLabels(labels []prompbmarshal.Label) {
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+}
+
+// marshalLabels returns a string key for labels sorted by name.
+func marshalLabels(labels []prompbmarshal.Label) string {
+	var b []byte
+	for _, label := range labels {
+		b = strconv.AppendQuote(b, label.Name)
+		b = append(b, '=')
+		b = strconv.AppendQuote(b, label.Value)
+		b = append(b, ',')
+	}
+	return string(b)
+}
+
+// persistedGroup is used for saving groups to -pushgateway.persistenceFile.
+type persistedGroup struct {
+	Labels        map[string]string `json:"labels"`
+	PushTimestamp int64             `json:"push_timestamp"`
+	Series        []persistedSeries `json:"series"`
+}
+
+type persistedSeries struct {
+	Family string            `json:"family"`
+	Labels map[string]string `json:"labels"`
+
+	// Value is stored as a string, since JSON doesn't support NaN and Inf values.
+	Value string `json:"value"`
+}
+
+// marshalIfChanged marshals gs to JSON if it has been changed since the previous call.
+//
+// It returns nil if gs hasn't been changed.
+func (gs *groups) marshalIfChanged() ([]byte, error) {
+	gs.mu.Lock()
+	if !gs.changed {
+		gs.mu.Unlock()
+		return nil, nil
+	}
+	gs.changed = false
+	pgs := make([]persistedGroup, 0, len(gs.m))
+	for _, g := range gs.m {
+		pg := persistedGroup{
+			Labels:        labelsToMap(g.labels),
+			PushTimestamp: g.pushTimestamp,
+		}
+		for name, ss := range g.families {
+			for _, s := range ss {
+				pg.Series = append(pg.Series, persistedSeries{
+					Family: name,
+					Labels: labelsToMap(s.labels),
+					Value:  strconv.FormatFloat(s.value, 'g', -1, 64),
+				})
+			}
+		}
+		pgs = append(pgs, pg)
+	}
+	gs.mu.Unlock()
+
+	return json.Marshal(pgs)
+}
+
+// setChanged marks gs as changed, so it is returned by the next call to marshalIfChanged.
+func (gs *groups) setChanged() {
+	gs.mu.Lock()
+	gs.changed = true
+	gs.mu.Unlock()
+}
+
+// unmarshal loads groups from data obtained via marshalIfChanged.
+func (gs *groups) unmarshal(data []byte) error {
+	var pgs []persistedGroup
+	if err := json.Unmarshal(data, &pgs); err != nil {
+		return err
+	}
+	m := make(map[string]*group, len(pgs))
+	seriesCount := 0
+	for _, pg := range pgs {
+		g := &group{
+			labels:        mapToLabels(pg.Labels),
+			families:      make(map[string][]*series),
+			pushTimestamp: pg.PushTimestamp,
+		}
+		for _, ps := range pg.Series {
+			v, err := strconv.ParseFloat(ps.Value, 64)
+			if err != nil {
+				return fmt.Errorf("cannot parse value for %s: %w", ps.Labels, err)
+			}
+			g.families[ps.Family] = append(g.families[ps.Family], &series{
+				labels: mapToLabels(ps.Labels),
+				value:  v,
+			})
+		}
+		m[marshalLabels(g.labels)] = g
+		seriesCount += len(pg.Series)
+	}
+
+	gs.mu.Lock()
+	gs.m = m
+	gs.seriesCount = seriesCount
+	gs.changed = false
+	gs.mu.Unlock()
+	return nil
+}
+
+func labelsToMap(labels []prompbmarshal.Label) map[string]string {
+	m := make(map[string]string, len(labels))
+	for _, label := range labels {
+		m[label.Name] = label.Value
+	}
+	return m
+}
+
+func mapToLabels(m map[string]string) []prompbmarshal.Label {
+	labels := make([]prompbmarshal.Label, 0, len(m))
+	for name, value := range m {
+		labels = append(labels, prompbmarshal.Label{
+			Name:  name,
+			Value: value,
+		})
+	}
+	sortLabels(labels)
+	return labels
+}
@@ -0,0 +1,338 @@
+package pushgateway
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/prometheusimport"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/relabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	parserCommon "github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/common"
+	parser "github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/prometheus"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/writeconcurrencylimiter"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	writeInterval = flag.Duration("pushgateway.writeInterval", time.Minute, "Interval for re-writing the last pushed values for all the groups "+
+		"accepted via Pushgateway API at /metrics/job/... . This keeps pushed metrics visible to queries until the group is deleted. "+
+		"See https://docs.victoriametrics.com/#how-to-push-data-in-pushgateway-format")
+	persistenceFile = flag.String("pushgateway.persistenceFile", "", "Optional path to a file for persisting groups pushed via Pushgateway API, "+
+		"so they survive restarts. Groups aren't persisted if this flag isn't set")
+	maxGroups = flag.Int("pushgateway.maxGroups", 10000, "The maximum number of groups, which can be pushed via Pushgateway API. "+
+		"Pushes for new groups are rejected after reaching this limit. There is no limit if it is set to 0")
+	maxSeries = flag.Int("pushgateway.maxSeries", 1e6, "The maximum number of series across all the groups pushed via Pushgateway API. "+
+		"Pushes, which would exceed this limit, are rejected. There is no limit if it is set to 0")
+)
+
+var (
+	rowsInserted  = metrics.NewCounter(`vm_rows_inserted_total{type="pushgateway"}`)
+	rowsPerInsert = metrics.NewHistogram(`vm_rows_per_insert{type="pushgateway"}`)
+)
+
+var (
+	gsGlobal *groups
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+)
+
+// Init initializes Pushgateway API handler.
+//
+// Stop must be called when the handler is no longer needed.
+func Init() {
+	gsGlobal = newGroups(insertTimeSeries, prometheusimport.AddMetadata)
+	gsGlobal.maxGroups = *maxGroups
+	gsGlobal.maxSeries = *maxSeries
+	if *persistenceFile != "" {
+		mustLoadGroups(gsGlobal, *persistenceFile)
+	}
+	_ = metrics.NewGauge(`vm_pushgateway_groups`, func() float64 {
+		return float64(gsGlobal.len())
+	})
+	_ = metrics.NewGauge(`vm_pushgateway_series`, func() float64 {
+		return float64(gsGlobal.seriesLen())
+	})
+	stopCh = make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		runWriter(gsGlobal, *writeInterval, *persistenceFile)
+	}()
+}
+
+// Stop stops Pushgateway API handler.
+func Stop() {
+	close(stopCh)
+	wg.Wait()
+	if *persistenceFile != "" {
+		if err := saveGroups(gsGlobal, *persistenceFile); err != nil {
+			logger.Errorf("cannot save groups pushed via Pushgateway API to -pushgateway.persistenceFile=%q: %s", *persistenceFile, err)
+		}
+	}
+}
+
+func runWriter(gs *groups, interval time.Duration, path string) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			if err := gs.writeAll(time.Now().UnixNano() / 1e6); err != nil {
+				logger.Errorf("cannot write metrics pushed via Pushgateway API: %s", err)
+			}
+			if path != "" {
+				if err := saveGroups(gs, path); err != nil {
+					logger.Errorf("cannot save groups pushed via Pushgateway API to -pushgateway.persistenceFile=%q: %s", path, err)
+				}
+			}
+		}
+	}
+}
+
+func mustLoadGroups(gs *groups, path string) {
+	if !fs.IsPathExist(path) {
+		return
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		logger.Fatalf("cannot read -pushgateway.persistenceFile=%q: %s", path, err)
+	}
+	if err := gs.unmarshal(data); err != nil {
+		logger.Fatalf("cannot parse -pushgateway.persistenceFile=%q: %s", path, err)
+	}
+	logger.Infof("loaded %d groups from -pushgateway.persistenceFile=%q", gs.len(), path)
+}
+
+// saveGroups saves gs to the given path if gs has been changed since the previous call.
+//
+// gs is saved again on the next call if an error is returned.
+func saveGroups(gs *groups, path string) error {
+	data, err := gs.marshalIfChanged()
+	if err != nil {
+		gs.setChanged()
+		return fmt.Errorf("cannot marshal groups: %w", err)
+	}
+	if data == nil {
+		return nil
+	}
+	// Write data to a temporary file and then atomically rename it to path,
+	// so the previously saved groups remain intact on write errors.
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		gs.setChanged()
+		return fmt.Errorf("cannot write %q: %w", tmpPath, err)
+	}
+	fs.MustSyncPath(tmpPath)
+	if err := os.Rename(tmpPath, path); err != nil {
+		gs.setChanged()
+		return fmt.Errorf("cannot move %q to %q: %w", tmpPath, path, err)
+	}
+	return nil
+}
+
+// IsPushgatewayPath returns true if the given path belongs to Pushgateway API.
+func IsPushgatewayPath(path string) bool {
+	path = strings.TrimPrefix(path, "/prometheus")
+	return strings.HasPrefix(path, "/metrics/job/") || strings.HasPrefix(path, "/metrics/job@base64/")
+}
+
+// RequestHandler processes Pushgateway API requests at `/metrics/job/<job>{/<label>/<value>}`.
+//
+// See https://github.com/prometheus/pushgateway#api
+func RequestHandler(w http.ResponseWriter, r *http.Request) error {
+	return processRequest(gsGlobal, w, r)
+}
+
+func processRequest(gs *groups, w http.ResponseWriter, r *http.Request) error {
+	groupingLabels, err := parseGroupingLabels(r.URL.EscapedPath())
+	if err != nil {
+		return &httpserver.ErrorWithStatusCode{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	timestamp := time.Now().UnixNano() / 1e6
+	switch r.Method {
+	case http.MethodPut, http.MethodPost:
+		rows, mds, err := readRows(r)
+		if err != nil {
+			return &httpserver.ErrorWithStatusCode{
+				Err:        err,
+				StatusCode: http.StatusBadRequest,
+			}
+		}
+		if err := gs.push(groupingLabels, rows, mds, r.Method == http.MethodPut, timestamp); err != nil {
+			return &httpserver.ErrorWithStatusCode{
+				Err:        err,
+				StatusCode: http.StatusBadRequest,
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		return nil
+	case http.MethodDelete:
+		if err := gs.delete(groupingLabels, timestamp); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return nil
+	default:
+		w.Header().Set("Allow", "PUT, POST, DELETE")
+		return &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("unsupported method %q; supported methods: PUT, POST, DELETE", r.Method),
+			StatusCode: http.StatusMethodNotAllowed,
+		}
+	}
+}
+
+// parseGroupingLabels parses grouping labels from the escaped path `/metrics/job/<job>{/<label>/<value>}`.
+//
+// Label names with `@base64` suffix contain base64url-encoded values.
+// The returned labels are sorted by name.
+func parseGroupingLabels(path string) ([]prompbmarshal.Label, error) {
+	path = strings.TrimPrefix(path, "/prometheus")
+	if !strings.HasPrefix(path, "/metrics/") {
+		return nil, fmt.Errorf("missing /metrics/ prefix in the path %q", path)
+	}
+	s := path[len("/metrics/"):]
+	parts := strings.Split(s, "/")
+	if len(parts)%2 != 0 {
+		return nil, fmt.Errorf("odd number of path segments in %q; expecting /metrics/job/<job>{/<label>/<value>}", path)
+	}
+	var labels []prompbmarshal.Label
+	for i := 0; i < len(parts); i += 2 {
+		name, err := url.PathUnescape(parts[i])
+		if err != nil {
+			return nil, fmt.Errorf("cannot unescape label name %q: %w", parts[i], err)
+		}
+		value, err := url.PathUnescape(parts[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("cannot unescape value for label %q: %w", name, err)
+		}
+		if strings.HasSuffix(name, "@base64") {
+			name = name[:len(name)-len("@base64")]
+			b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+			if err != nil {
+				return nil, fmt.Errorf("cannot decode base64 value for label %q: %w", name, err)
+			}
+			value = string(b)
+		}
+		if i == 0 && name != "job" {
+			return nil, fmt.Errorf("the path %q must start with /metrics/job/", path)
+		}
+		if !isValidLabelName(name) {
+			return nil, fmt.Errorf("invalid label name %q", name)
+		}
+		if strings.HasPrefix(name, "__") {
+			return nil, fmt.Errorf("label name %q mustn't start with __", name)
+		}
+		if _, ok := getLabelValue(labels, name); ok {
+			return nil, fmt.Errorf("duplicate label %q in the path %q", name, path)
+		}
+		if name == "job" && value == "" {
+			return nil, fmt.Errorf("job label value cannot be empty")
+		}
+		labels = append(labels, prompbmarshal.Label{
+			Name:  name,
+			Value: value,
+		})
+	}
+	sortLabels(labels)
+	return labels, nil
+}
+
+func isValidLabelName(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9') {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// readRows reads and parses metrics in Prometheus text exposition format from r.
+func readRows(r *http.Request) ([]parser.Row, []parser.Metadata, error) {
+	var reader io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := parserCommon.GetGzipReader(reader)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot read gzipped data: %w", err)
+		}
+		defer parserCommon.PutGzipReader(zr)
+		reader = zr
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read request body: %w", err)
+	}
+	var parseErr error
+	var rs parser.Rows
+	rs.UnmarshalWithErrLogger(string(data), func(s string) {
+		if parseErr == nil {
+			parseErr = fmt.Errorf("%s", s)
+		}
+	})
+	if parseErr != nil {
+		return nil, nil, parseErr
+	}
+	return rs.Rows, rs.Metadata, nil
+}
+
+func insertTimeSeries(tss []prompbmarshal.TimeSeries) error {
+	return writeconcurrencylimiter.Do(func() error {
+		ctx := common.GetInsertCtx()
+		defer common.PutInsertCtx(ctx)
+
+		ctx.Reset(len(tss))
+		hasRelabeling := relabel.HasRelabeling()
+		for i := range tss {
+			ts := &tss[i]
+			ctx.Labels = ctx.Labels[:0]
+			for _, label := range ts.Labels {
+				name := label.Name
+				if name == "__name__" {
+					name = ""
+				}
+				ctx.AddLabel(name, label.Value)
+			}
+			if hasRelabeling {
+				ctx.ApplyRelabeling()
+			}
+			if len(ctx.Labels) == 0 {
+				// Skip metric without labels.
+				continue
+			}
+			ctx.SortLabelsIfNeeded()
+			for _, sample := range ts.Samples {
+				if err := ctx.WriteDataPoint(nil, ctx.Labels, sample.Timestamp, sample.Value); err != nil {
+					return err
+				}
+			}
+		}
+		rowsInserted.Add(len(tss))
+		rowsPerInsert.Update(float64(len(tss)))
+		return ctx.FlushBufs()
+	})
+}
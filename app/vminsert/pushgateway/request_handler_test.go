@@ -0,0 +1,258 @@
+package pushgateway
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	parser "github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/prometheus"
+)
+
+func TestParseGroupingLabelsSuccess(t *testing.T) {
+	f := func(path, resultExpected string) {
+		t.Helper()
+		labels, err := parseGroupingLabels(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result := marshalLabels(labels)
+		if result != resultExpected {
+			t.Fatalf("unexpected labels for %q; got %s; want %s", path, result, resultExpected)
+		}
+	}
+	f("/metrics/job/foo", `"job"="foo",`)
+	f("/prometheus/metrics/job/foo", `"job"="foo",`)
+	f("/metrics/job/foo/instance/bar", `"instance"="bar","job"="foo",`)
+	f("/metrics/job/foo/instance/", `"instance"="","job"="foo",`)
+	f("/metrics/job/foo/path/a%2Fb", `"job"="foo","path"="a/b",`)
+	f("/metrics/job@base64/Zm9vL2Jhcg/a@base64/YWI=", `"a"="ab","job"="foo/bar",`)
+}
+
+func TestParseGroupingLabelsFailure(t *testing.T) {
+	f := func(path string) {
+		t.Helper()
+		labels, err := parseGroupingLabels(path)
+		if err == nil {
+			t.Fatalf("expecting non-nil error for %q; got labels %s", path, marshalLabels(labels))
+		}
+	}
+	f("/api/v1/import")
+	f("/metrics/instance/foo")
+	f("/metrics/job/")
+	f("/metrics/job/foo/instance")
+	f("/metrics/job/foo/__name__/bar")
+	f("/metrics/job/foo/1abc/bar")
+	f("/metrics/job/foo/job/bar")
+	f("/metrics/job/foo/a@base64/!!!")
+}
+
+func TestPushOverwriteDelete(t *testing.T) {
+	var written []string
+	gs := newGroups(func(tss []prompbmarshal.TimeSeries) error {
+		for _, ts := range tss {
+			written = append(written, marshalTimeSeries(ts))
+		}
+		return nil
+	}, func(mds []parser.Metadata) {})
+	f := func(method, path, body string, statusCodeExpected int, writtenExpected []string) {
+		t.Helper()
+		written = nil
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		if err := processRequest(gs, w, r); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if w.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code; got %d; want %d", w.Code, statusCodeExpected)
+		}
+		sort.Strings(written)
+		sort.Strings(writtenExpected)
+		if !reflect.DeepEqual(written, writtenExpected) {
+			t.Fatalf("unexpected written series\ngot\n%s\nwant\n%s", strings.Join(written, "\n"), strings.Join(writtenExpected, "\n"))
+		}
+	}
+
+	// Push the initial metrics to the group.
+	f(http.MethodPut, "/metrics/job/foo/instance/bar", `
+# TYPE req histogram
+req_bucket{le="1"} 2
+req_bucket{le="+Inf"} 3
+req_sum 4
+req_count 3
+up 1
+`, http.StatusOK, []string{
+		`req_bucket{instance="bar",job="foo",le="+Inf"} 3`,
+		`req_bucket{instance="bar",job="foo",le="1"} 2`,
+		`req_count{instance="bar",job="foo"} 3`,
+		`req_sum{instance="bar",job="foo"} 4`,
+		`up{instance="bar",job="foo"} 1`,
+		`push_time_seconds{instance="bar",job="foo"} <ts>`,
+	})
+
+	// Push metrics to another group. This mustn't affect the first group.
+	f(http.MethodPut, "/metrics/job/foo/instance/baz", `up 0`, http.StatusOK, []string{
+		`up{instance="baz",job="foo"} 0`,
+		`push_time_seconds{instance="baz",job="foo"} <ts>`,
+	})
+
+	// POST replaces only the pushed metric families.
+	f(http.MethodPost, "/metrics/job/foo/instance/bar", `
+# TYPE req histogram
+req_bucket{le="+Inf"} 5
+req_sum 6
+req_count 5
+`, http.StatusOK, []string{
+		`req_bucket{instance="bar",job="foo",le="1"} stale`,
+		`req_bucket{instance="bar",job="foo",le="+Inf"} 5`,
+		`req_count{instance="bar",job="foo"} 5`,
+		`req_sum{instance="bar",job="foo"} 6`,
+		`up{instance="bar",job="foo"} 1`,
+		`push_time_seconds{instance="bar",job="foo"} <ts>`,
+	})
+
+	// PUT overwrites all the metrics in the group.
+	f(http.MethodPut, "/metrics/job/foo/instance/bar", `up 2`, http.StatusOK, []string{
+		`req_bucket{instance="bar",job="foo",le="+Inf"} stale`,
+		`req_count{instance="bar",job="foo"} stale`,
+		`req_sum{instance="bar",job="foo"} stale`,
+		`up{instance="bar",job="foo"} 2`,
+		`push_time_seconds{instance="bar",job="foo"} <ts>`,
+	})
+	if n := gs.len(); n != 2 {
+		t.Fatalf("unexpected number of groups; got %d; want 2", n)
+	}
+
+	// DELETE removes the group.
+	f(http.MethodDelete, "/metrics/job/foo/instance/bar", "", http.StatusAccepted, []string{
+		`up{instance="bar",job="foo"} stale`,
+		`push_time_seconds{instance="bar",job="foo"} stale`,
+	})
+	if n := gs.len(); n != 1 {
+		t.Fatalf("unexpected number of groups; got %d; want 1", n)
+	}
+
+	// DELETE for missing group is no-op.
+	f(http.MethodDelete, "/metrics/job/foo/instance/bar", "", http.StatusAccepted, nil)
+
+	// The remaining group is written periodically.
+	written = nil
+	if err := gs.writeAll(123); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	writtenExpected := []string{
+		`up{instance="baz",job="foo"} 0`,
+		`push_time_seconds{instance="baz",job="foo"} <ts>`,
+	}
+	if !reflect.DeepEqual(written, writtenExpected) {
+		t.Fatalf("unexpected written series\ngot\n%s\nwant\n%s", strings.Join(written, "\n"), strings.Join(writtenExpected, "\n"))
+	}
+
+	// Persisted groups must be restored.
+	data, err := gs.marshalIfChanged()
+	if err != nil {
+		t.Fatalf("cannot marshal groups: %s", err)
+	}
+	gsRestored := newGroups(gs.write, gs.addMetadata)
+	if err := gsRestored.unmarshal(data); err != nil {
+		t.Fatalf("cannot unmarshal groups: %s", err)
+	}
+	written = nil
+	if err := gsRestored.writeAll(123); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(written, writtenExpected) {
+		t.Fatalf("unexpected written series after restore\ngot\n%s\nwant\n%s", strings.Join(written, "\n"), strings.Join(writtenExpected, "\n"))
+	}
+}
+
+func TestPushFailure(t *testing.T) {
+	gs := newGroups(func(tss []prompbmarshal.TimeSeries) error {
+		return nil
+	}, func(mds []parser.Metadata) {})
+	f := func(method, path, body string) {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		if err := processRequest(gs, w, r); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if n := gs.len(); n != 0 {
+			t.Fatalf("unexpected number of groups; got %d; want 0", n)
+		}
+	}
+	f(http.MethodGet, "/metrics/job/foo", "")
+	f(http.MethodPut, "/metrics/instance/foo", "up 1")
+	f(http.MethodPut, "/metrics/job/foo", "up{ 1")
+	f(http.MethodPut, "/metrics/job/foo", "up 1 123456")
+	f(http.MethodPut, "/metrics/job/foo", `up{job="bar"} 1`)
+}
+
+func marshalTimeSeries(ts prompbmarshal.TimeSeries) string {
+	var name string
+	var labels []string
+	for _, label := range ts.Labels {
+		if label.Name == "__name__" {
+			name = label.Value
+			continue
+		}
+		labels = append(labels, fmt.Sprintf("%s=%q", label.Name, label.Value))
+	}
+	value := fmt.Sprintf("%g", ts.Samples[0].Value)
+	if decimal.IsStaleNaN(ts.Samples[0].Value) {
+		value = "stale"
+	} else if name == "push_time_seconds" && !math.IsNaN(ts.Samples[0].Value) {
+		value = "<ts>"
+	}
+	return fmt.Sprintf("%s{%s} %s", name, strings.Join(labels, ","), value)
+}
+
+func TestPushLimits(t *testing.T) {
+	gs := newGroups(func(tss []prompbmarshal.TimeSeries) error {
+		return nil
+	}, func(mds []parser.Metadata) {})
+	gs.maxGroups = 2
+	gs.maxSeries = 3
+	f := func(method, path, body string, resultExpected bool, groupsExpected, seriesExpected int) {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		err := processRequest(gs, w, r)
+		if resultExpected && err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !resultExpected && err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if n := gs.len(); n != groupsExpected {
+			t.Fatalf("unexpected number of groups; got %d; want %d", n, groupsExpected)
+		}
+		if n := gs.seriesLen(); n != seriesExpected {
+			t.Fatalf("unexpected number of series; got %d; want %d", n, seriesExpected)
+		}
+	}
+	f(http.MethodPut, "/metrics/job/foo", "up 1\nbar 2", true, 1, 2)
+	f(http.MethodPut, "/metrics/job/baz", "up 1", true, 2, 3)
+
+	// The number of groups exceeds the limit.
+	f(http.MethodPut, "/metrics/job/qwe", "up 1", false, 2, 3)
+
+	// The number of series exceeds the limit.
+	f(http.MethodPost, "/metrics/job/baz", "abc 1", false, 2, 3)
+	f(http.MethodPut, "/metrics/job/baz", "up 1\nabc 1", false, 2, 3)
+
+	// Replacing existing series doesn't increase the number of series.
+	f(http.MethodPost, "/metrics/job/foo", "up 0", true, 2, 3)
+	f(http.MethodPut, "/metrics/job/foo", "abc 1", true, 2, 2)
+	f(http.MethodPost, "/metrics/job/baz", "abc 1", true, 2, 3)
+
+	// Deleted groups free up the limits.
+	f(http.MethodDelete, "/metrics/job/foo", "", true, 1, 2)
+	f(http.MethodPut, "/metrics/job/qwe", "up 1", true, 2, 3)
+}
@@ -20,38 +20,61 @@ var (
 		"See https://docs.victoriametrics.com/#relabeling for details. The config is reloaded on SIGHUP signal")
 	relabelDebug = flag.Bool("relabelDebug", false, "Whether to log metrics before and after relabeling with -relabelConfig. If the -relabelDebug is enabled, "+
 		"then the metrics aren't sent to storage. This is useful for debugging the relabeling configs")
+	ingestionRelabelConfig = flag.String("ingestion.relabelConfig", "", "Optional path to a file with relabeling rules, which are applied uniformly to metrics ingested via all the supported push protocols "+
+		"such as Prometheus remote_write, InfluxDB line protocol, Graphite, OpenTSDB, DataDog and /api/v1/import*. These rules aren't applied to scraped metrics. "+
+		"The rules are applied before the rules from -relabelConfig. The path can point either to local file or to http url. "+
+		"See https://docs.victoriametrics.com/#relabeling for details. The config is reloaded on SIGHUP signal")
+	ingestionRelabelDebug = flag.Bool("ingestion.relabelDebug", false, "Whether to log metrics before and after relabeling with -ingestion.relabelConfig. If the -ingestion.relabelDebug is enabled, "+
+		"then the metrics aren't sent to storage. This is useful for debugging the relabeling configs")
 )
 
 // Init must be called after flag.Parse and before using the relabel package.
 func Init() {
-	// Register SIGHUP handler for config re-read just before loadRelabelConfig call.
-	// This guarantees that the config will be re-read if the signal arrives during loadRelabelConfig call.
+	// Register SIGHUP handler for config re-read just before loadRelabelConfigs call.
+	// This guarantees that the config will be re-read if the signal arrives during loadRelabelConfigs call.
 	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/1240
 	sighupCh := procutil.NewSighupChan()
 
-	pcs, err := loadRelabelConfig()
+	pcs, pcsIngestion, err := loadRelabelConfigs()
 	if err != nil {
 		logger.Fatalf("cannot load relabelConfig: %s", err)
 	}
 	pcsGlobal.Store(pcs)
-	if len(*relabelConfig) == 0 {
+	pcsIngestionGlobal.Store(pcsIngestion)
+	if len(*relabelConfig) == 0 && len(*ingestionRelabelConfig) == 0 {
 		return
 	}
 	go func() {
 		for range sighupCh {
-			logger.Infof("received SIGHUP; reloading -relabelConfig=%q...", *relabelConfig)
-			pcs, err := loadRelabelConfig()
+			logger.Infof("received SIGHUP; reloading -relabelConfig=%q and -ingestion.relabelConfig=%q...", *relabelConfig, *ingestionRelabelConfig)
+			pcs, pcsIngestion, err := loadRelabelConfigs()
 			if err != nil {
-				logger.Errorf("cannot load the updated relabelConfig: %s; preserving the previous config", err)
+				logger.Errorf("cannot load the updated relabel configs: %s; preserving the previous configs", err)
 				continue
 			}
 			pcsGlobal.Store(pcs)
-			logger.Infof("successfully reloaded -relabelConfig=%q", *relabelConfig)
+			pcsIngestionGlobal.Store(pcsIngestion)
+			logger.Infof("successfully reloaded -relabelConfig=%q and -ingestion.relabelConfig=%q", *relabelConfig, *ingestionRelabelConfig)
 		}
 	}()
 }
 
-var pcsGlobal atomic.Value
+var (
+	pcsGlobal          atomic.Value
+	pcsIngestionGlobal atomic.Value
+)
+
+func loadRelabelConfigs() (*promrelabel.ParsedConfigs, *promrelabel.ParsedConfigs, error) {
+	pcs, err := loadRelabelConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	pcsIngestion, err := loadIngestionRelabelConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	return pcs, pcsIngestion, nil
+}
 
 func loadRelabelConfig() (*promrelabel.ParsedConfigs, error) {
 	if len(*relabelConfig) == 0 {
@@ -64,10 +87,22 @@ func loadRelabelConfig() (*promrelabel.ParsedConfigs, error) {
 	return pcs, nil
 }
 
+func loadIngestionRelabelConfig() (*promrelabel.ParsedConfigs, error) {
+	if len(*ingestionRelabelConfig) == 0 {
+		return nil, nil
+	}
+	pcs, err := promrelabel.LoadRelabelConfigs(*ingestionRelabelConfig, *ingestionRelabelDebug)
+	if err != nil {
+		return nil, fmt.Errorf("error when reading -ingestion.relabelConfig=%q: %w", *ingestionRelabelConfig, err)
+	}
+	return pcs, nil
+}
+
 // HasRelabeling returns true if there is global relabeling.
 func HasRelabeling() bool {
 	pcs := pcsGlobal.Load().(*promrelabel.ParsedConfigs)
-	return pcs.Len() > 0
+	pcsIngestion := pcsIngestionGlobal.Load().(*promrelabel.ParsedConfigs)
+	return pcs.Len() > 0 || pcsIngestion.Len() > 0
 }
 
 // Ctx holds relabeling context.
@@ -82,12 +117,28 @@ func (ctx *Ctx) Reset() {
 	ctx.tmpLabels = ctx.tmpLabels[:0]
 }
 
-// ApplyRelabeling applies relabeling to the given labels and returns the result.
+// ApplyRelabeling applies relabeling from -ingestion.relabelConfig and -relabelConfig to the given labels and returns the result.
+//
+// It must be used for metrics ingested via push protocols.
 //
 // The returned labels are valid until the next call to ApplyRelabeling.
 func (ctx *Ctx) ApplyRelabeling(labels []prompb.Label) []prompb.Label {
+	pcsIngestion := pcsIngestionGlobal.Load().(*promrelabel.ParsedConfigs)
+	return ctx.applyRelabeling(labels, pcsIngestion)
+}
+
+// ApplyRelabelingForScrapedData applies relabeling from -relabelConfig to the given labels and returns the result.
+//
+// It must be used for scraped metrics.
+//
+// The returned labels are valid until the next call to ApplyRelabelingForScrapedData.
+func (ctx *Ctx) ApplyRelabelingForScrapedData(labels []prompb.Label) []prompb.Label {
+	return ctx.applyRelabeling(labels, nil)
+}
+
+func (ctx *Ctx) applyRelabeling(labels []prompb.Label, pcsIngestion *promrelabel.ParsedConfigs) []prompb.Label {
 	pcs := pcsGlobal.Load().(*promrelabel.ParsedConfigs)
-	if pcs.Len() == 0 {
+	if pcs.Len() == 0 && pcsIngestion.Len() == 0 {
 		// There are no relabeling rules.
 		return labels
 	}
@@ -106,7 +157,12 @@ func (ctx *Ctx) ApplyRelabeling(labels []prompb.Label) []prompb.Label {
 	}
 
 	// Apply relabeling
-	tmpLabels = pcs.Apply(tmpLabels, 0, true)
+	if pcsIngestion.Len() > 0 {
+		tmpLabels = pcsIngestion.Apply(tmpLabels, 0, false)
+	}
+	if len(tmpLabels) > 0 {
+		tmpLabels = pcs.Apply(tmpLabels, 0, true)
+	}
 	ctx.tmpLabels = tmpLabels
 	if len(tmpLabels) == 0 {
 		metricsDropped.Inc()
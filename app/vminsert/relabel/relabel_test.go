@@ -0,0 +1,128 @@
+package relabel
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+)
+
+func mustSetRelabelConfigs(t *testing.T, relabelConfig, ingestionRelabelConfig string) {
+	t.Helper()
+	pcs, err := promrelabel.ParseRelabelConfigsData([]byte(relabelConfig), false)
+	if err != nil {
+		t.Fatalf("cannot parse relabelConfig: %s", err)
+	}
+	pcsIngestion, err := promrelabel.ParseRelabelConfigsData([]byte(ingestionRelabelConfig), false)
+	if err != nil {
+		t.Fatalf("cannot parse ingestionRelabelConfig: %s", err)
+	}
+	pcsGlobal.Store(pcs)
+	pcsIngestionGlobal.Store(pcsIngestion)
+}
+
+func newLabels(metricName string, tags ...string) []prompb.Label {
+	// The metric name is passed with empty label name as all the ingestion protocols do.
+	labels := []prompb.Label{{
+		Value: []byte(metricName),
+	}}
+	for i := 0; i+1 < len(tags); i += 2 {
+		labels = append(labels, prompb.Label{
+			Name:  []byte(tags[i]),
+			Value: []byte(tags[i+1]),
+		})
+	}
+	return labels
+}
+
+func labelsString(labels []prompb.Label) string {
+	a := make([]string, 0, len(labels))
+	for _, label := range labels {
+		name := string(label.Name)
+		if name == "" {
+			name = "__name__"
+		}
+		a = append(a, fmt.Sprintf("%s=%q", name, label.Value))
+	}
+	sort.Strings(a)
+	return "{" + strings.Join(a, ",") + "}"
+}
+
+func TestIngestionRelabelingAllProtocols(t *testing.T) {
+	mustSetRelabelConfigs(t, "", `
+- action: drop
+  source_labels: [__name__]
+  regex: "drop_me.*"
+- target_label: env
+  replacement: prod
+- action: labeldrop
+  regex: "secret"
+`)
+	defer mustSetRelabelConfigs(t, "", "")
+
+	if !HasRelabeling() {
+		t.Fatalf("expecting non-empty relabeling")
+	}
+
+	f := func(protocol string, labels []prompb.Label, resultExpected string) {
+		t.Helper()
+		var ctx Ctx
+		labels = ctx.ApplyRelabeling(labels)
+		result := labelsString(labels)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for %s protocol\ngot\n%s\nwant\n%s", protocol, result, resultExpected)
+		}
+	}
+
+	// Labels are passed to relabeling in the form produced by the corresponding protocol parsers.
+
+	// Influx line protocol: `cpu,secret=x,host=h usage=1`
+	f("influx", newLabels("cpu_usage", "secret", "x", "host", "h", "db", "telegraf"),
+		`{__name__="cpu_usage",db="telegraf",env="prod",host="h"}`)
+	f("influx", newLabels("drop_me_usage", "host", "h", "db", "telegraf"), `{}`)
+
+	// Graphite plaintext protocol with tags: `cpu.usage;secret=x;host=h 1 123`
+	f("graphite", newLabels("cpu.usage", "secret", "x", "host", "h"),
+		`{__name__="cpu.usage",env="prod",host="h"}`)
+	f("graphite", newLabels("drop_me.usage", "host", "h"), `{}`)
+
+	// JSON line import: `{"metric":{"__name__":"cpu_usage","secret":"x","host":"h"},"values":[1],"timestamps":[123]}`
+	f("vmimport", newLabels("cpu_usage", "secret", "x", "host", "h"),
+		`{__name__="cpu_usage",env="prod",host="h"}`)
+	f("vmimport", newLabels("drop_me_usage", "host", "h"), `{}`)
+}
+
+func TestIngestionRelabelingSkippedForScrapedData(t *testing.T) {
+	mustSetRelabelConfigs(t, `
+- target_label: global
+  replacement: "1"
+`, `
+- target_label: ingestion
+  replacement: "1"
+- target_label: __tmp
+  replacement: "x"
+`)
+	defer mustSetRelabelConfigs(t, "", "")
+
+	var ctx Ctx
+
+	// Push protocols must be relabeled with both -ingestion.relabelConfig and -relabelConfig.
+	// Temporary labels set by -ingestion.relabelConfig must be removed.
+	labels := ctx.ApplyRelabeling(newLabels("foo", "job", "bar"))
+	result := labelsString(labels)
+	resultExpected := `{__name__="foo",global="1",ingestion="1",job="bar"}`
+	if result != resultExpected {
+		t.Fatalf("unexpected result for pushed data\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+
+	// Scraped data must be relabeled only with -relabelConfig.
+	labels = ctx.ApplyRelabelingForScrapedData(newLabels("foo", "job", "bar"))
+	result = labelsString(labels)
+	resultExpected = `{__name__="foo",global="1",job="bar"}`
+	if result != resultExpected {
+		t.Fatalf("unexpected result for scraped data\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+}
@@ -0,0 +1,155 @@
+package vmimport
+
+import (
+	"flag"
+	"math"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/workingsetcache"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	dedupWindow = flag.Duration("import.dedupWindow", 0, "The duration for remembering samples imported via /api/v1/import. "+
+		"Samples with the same labels, timestamp and value are skipped if they have been successfully imported during this duration, so retried imports don't write duplicate samples. "+
+		"Samples with the same labels and timestamp, but with another value, are written, so the last write wins. "+
+		"Samples with the same timestamp are de-duplicated within every imported series as well; the last sample wins. "+
+		"Imported samples are remembered in memory only, so they are forgotten after the restart. "+
+		"De-duplication for imported samples is disabled by default. See https://docs.victoriametrics.com/#deduplication-for-imported-samples")
+	dedupCacheSize = flagutil.NewBytes("import.dedupCacheSize", 0, "The maximum size in bytes for the cache of samples imported during -import.dedupWindow. "+
+		"By default it is limited by 1/16 of allowed memory. Samples may be forgotten before -import.dedupWindow if the cache is full")
+)
+
+var dedupsDuringImport = metrics.NewCounter(`vm_deduplicated_samples_total{type="import"}`)
+
+// sampleDeduper detects samples, which have been already imported during the dedup window.
+//
+// Imported samples are remembered in memory only, so they are lost on restart.
+type sampleDeduper struct {
+	// c maps metricNameRaw+timestamp keys to values for the successfully imported samples.
+	c *workingsetcache.Cache
+}
+
+func newSampleDeduper(maxBytes int, window time.Duration) *sampleDeduper {
+	return &sampleDeduper{
+		c: workingsetcache.NewWithExpire(maxBytes, window),
+	}
+}
+
+// MustStop stops sd.
+func (sd *sampleDeduper) MustStop() {
+	sd.c.Stop()
+}
+
+// deduplicateSamples removes duplicate samples from the given samples for the series with the given metricNameRaw.
+//
+// Samples with duplicate timestamps are removed from the given samples; the last sample wins.
+// Samples, which have been already imported with the same value during the dedup window, are removed as well.
+// Samples, which have been already imported with another value, are left, so the last write wins.
+//
+// The remaining samples are registered in ctx. They must be remembered via sd.commitSamples
+// after they are successfully written to the storage.
+func (sd *sampleDeduper) deduplicateSamples(ctx *pushCtx, metricNameRaw []byte, timestamps []int64, values []float64) ([]int64, []float64) {
+	srcLen := len(timestamps)
+	timestamps, values = deduplicateSeriesSamples(timestamps, values)
+	dstTimestamps := timestamps[:0]
+	dstValues := values[:0]
+	for i, ts := range timestamps {
+		v := values[i]
+		ctx.dedupKeyBuf = marshalDedupKey(ctx.dedupKeyBuf[:0], metricNameRaw, ts)
+		ctx.dedupValueBuf = sd.c.Get(ctx.dedupValueBuf[:0], ctx.dedupKeyBuf)
+		if len(ctx.dedupValueBuf) == 8 && encoding.UnmarshalUint64(ctx.dedupValueBuf) == math.Float64bits(v) {
+			continue
+		}
+		n := len(ctx.dedupPendingKeysBuf)
+		ctx.dedupPendingKeysBuf = append(ctx.dedupPendingKeysBuf, ctx.dedupKeyBuf...)
+		ctx.dedupPendingKeysOffsets = append(ctx.dedupPendingKeysOffsets, n)
+		ctx.dedupPendingValues = append(ctx.dedupPendingValues, v)
+		dstTimestamps = append(dstTimestamps, ts)
+		dstValues = append(dstValues, v)
+	}
+	dedupsDuringImport.Add(srcLen - len(dstTimestamps))
+	return dstTimestamps, dstValues
+}
+
+// commitSamples remembers samples registered in ctx by sd.deduplicateSamples,
+// so the subsequent import of these samples is detected as duplicate.
+//
+// It must be called only after the samples are successfully written to the storage,
+// so failed imports could be retried.
+func (sd *sampleDeduper) commitSamples(ctx *pushCtx) {
+	offsets := ctx.dedupPendingKeysOffsets
+	for i, n := range offsets {
+		end := len(ctx.dedupPendingKeysBuf)
+		if i+1 < len(offsets) {
+			end = offsets[i+1]
+		}
+		ctx.dedupValueBuf = encoding.MarshalUint64(ctx.dedupValueBuf[:0], math.Float64bits(ctx.dedupPendingValues[i]))
+		sd.c.Set(ctx.dedupPendingKeysBuf[n:end], ctx.dedupValueBuf)
+	}
+	ctx.resetDedupPendingKeys()
+}
+
+func marshalDedupKey(dst, metricNameRaw []byte, timestamp int64) []byte {
+	dst = append(dst, metricNameRaw...)
+	return encoding.MarshalInt64(dst, timestamp)
+}
+
+// deduplicateSeriesSamples removes samples with duplicate timestamps from the given series samples.
+//
+// The last sample wins for duplicate timestamps. The order of the remaining samples is preserved.
+func deduplicateSeriesSamples(timestamps []int64, values []float64) ([]int64, []float64) {
+	if !hasDuplicateTimestamps(timestamps) {
+		// Fast path - nothing to deduplicate
+		return timestamps, values
+	}
+	m := make(map[int64]int, len(timestamps))
+	dstTimestamps := timestamps[:0]
+	dstValues := values[:0]
+	for i, ts := range timestamps {
+		v := values[i]
+		if n, ok := m[ts]; ok {
+			dstValues[n] = v
+			continue
+		}
+		m[ts] = len(dstTimestamps)
+		dstTimestamps = append(dstTimestamps, ts)
+		dstValues = append(dstValues, v)
+	}
+	return dstTimestamps, dstValues
+}
+
+func hasDuplicateTimestamps(timestamps []int64) bool {
+	if len(timestamps) < 2 {
+		return false
+	}
+	isSorted := true
+	for i := 1; i < len(timestamps); i++ {
+		if timestamps[i] <= timestamps[i-1] {
+			isSorted = false
+			break
+		}
+	}
+	if isSorted {
+		// Fast path - imported timestamps are usually sorted in ascending order
+		return false
+	}
+	m := make(map[int64]struct{}, len(timestamps))
+	for _, ts := range timestamps {
+		if _, ok := m[ts]; ok {
+			return true
+		}
+		m[ts] = struct{}{}
+	}
+	return false
+}
+
+func getDedupCacheSize() int {
+	if n := dedupCacheSize.N; n > 0 {
+		return n
+	}
+	return memory.Allowed() / 16
+}
@@ -0,0 +1,141 @@
+package vmimport
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	parser "github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/vmimport"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+// importSamples returns samples, which must be written to the storage when importing data in vmimport format via sd.
+//
+// writeErr simulates failed write of the returned samples to the storage.
+func importSamples(sd *sampleDeduper, data string, writeErr bool) []string {
+	var rows parser.Rows
+	rows.Unmarshal(data)
+	ctx := getPushCtx()
+	defer putPushCtx(ctx)
+	var samples []string
+	for i := range rows.Rows {
+		r := &rows.Rows[i]
+		var labels []prompb.Label
+		var labelsStr []string
+		for _, tag := range r.Tags {
+			labels = append(labels, prompb.Label{
+				Name:  tag.Key,
+				Value: tag.Value,
+			})
+			labelsStr = append(labelsStr, fmt.Sprintf("%s=%q", tag.Key, tag.Value))
+		}
+		ctx.metricNameBuf = storage.MarshalMetricNameRaw(ctx.metricNameBuf[:0], labels)
+		timestamps, values := sd.deduplicateSamples(ctx, ctx.metricNameBuf, r.Timestamps, r.Values)
+		for j, ts := range timestamps {
+			samples = append(samples, fmt.Sprintf("{%s} %v %d", strings.Join(labelsStr, ","), values[j], ts))
+		}
+	}
+	if !writeErr {
+		sd.commitSamples(ctx)
+	}
+	return samples
+}
+
+func TestSampleDeduperImportTwice(t *testing.T) {
+	sd := newSampleDeduper(1024*1024, time.Hour)
+	defer sd.MustStop()
+
+	f := func(data string, samplesExpected []string) {
+		t.Helper()
+		samples := importSamples(sd, data, false)
+		if !reflect.DeepEqual(samples, samplesExpected) {
+			t.Fatalf("unexpected samples written to the storage;\ngot\n%q\nwant\n%q", samples, samplesExpected)
+		}
+	}
+
+	data := `{"metric":{"__name__":"foo","job":"a"},"values":[1,2,3],"timestamps":[1000,2000,3000]}
+{"metric":{"__name__":"foo","job":"b"},"values":[4,5],"timestamps":[1000,2000]}`
+
+	// The first import writes all the samples
+	f(data, []string{
+		`{__name__="foo",job="a"} 1 1000`,
+		`{__name__="foo",job="a"} 2 2000`,
+		`{__name__="foo",job="a"} 3 3000`,
+		`{__name__="foo",job="b"} 4 1000`,
+		`{__name__="foo",job="b"} 5 2000`,
+	})
+
+	// The second import of the same data doesn't write duplicate samples
+	f(data, nil)
+
+	// New samples and samples with changed values for already imported timestamps are written - the last write wins
+	f(`{"metric":{"__name__":"foo","job":"a"},"values":[1,20,3,4],"timestamps":[1000,2000,3000,4000]}
+{"metric":{"__name__":"foo","job":"c"},"values":[4],"timestamps":[1000]}`, []string{
+		`{__name__="foo",job="a"} 20 2000`,
+		`{__name__="foo",job="a"} 4 4000`,
+		`{__name__="foo",job="c"} 4 1000`,
+	})
+
+	// The changed value is remembered, so its retry is skipped, while the previous value is written again
+	f(`{"metric":{"__name__":"foo","job":"a"},"values":[20],"timestamps":[2000]}`, nil)
+	f(`{"metric":{"__name__":"foo","job":"a"},"values":[2],"timestamps":[2000]}`, []string{
+		`{__name__="foo",job="a"} 2 2000`,
+	})
+
+	// Duplicate timestamps within a series - the last sample wins
+	f(`{"metric":{"__name__":"bar"},"values":[1,2,3,4],"timestamps":[1000,2000,1000,3000]}`, []string{
+		`{__name__="bar"} 3 1000`,
+		`{__name__="bar"} 2 2000`,
+		`{__name__="bar"} 4 3000`,
+	})
+	f(`{"metric":{"__name__":"bar"},"values":[3,2,4],"timestamps":[1000,2000,3000]}`, nil)
+}
+
+func TestSampleDeduperRetryFailedImport(t *testing.T) {
+	sd := newSampleDeduper(1024*1024, time.Hour)
+	defer sd.MustStop()
+
+	f := func(data string, writeErr bool, samplesExpected []string) {
+		t.Helper()
+		samples := importSamples(sd, data, writeErr)
+		if !reflect.DeepEqual(samples, samplesExpected) {
+			t.Fatalf("unexpected samples written to the storage;\ngot\n%q\nwant\n%q", samples, samplesExpected)
+		}
+	}
+
+	data := `{"metric":{"__name__":"foo"},"values":[1,2],"timestamps":[1000,2000]}`
+	samplesExpected := []string{
+		`{__name__="foo"} 1 1000`,
+		`{__name__="foo"} 2 2000`,
+	}
+
+	// Samples from the failed import must be written again on retry
+	f(data, true, samplesExpected)
+	f(data, true, samplesExpected)
+
+	// The successful retry writes the samples, so they are skipped afterwards
+	f(data, false, samplesExpected)
+	f(data, false, nil)
+}
+
+func TestDeduplicateSeriesSamples(t *testing.T) {
+	f := func(timestamps []int64, values []float64, timestampsExpected []int64, valuesExpected []float64) {
+		t.Helper()
+		timestamps, values = deduplicateSeriesSamples(timestamps, values)
+		if !reflect.DeepEqual(timestamps, timestampsExpected) {
+			t.Fatalf("unexpected timestamps; got %v; want %v", timestamps, timestampsExpected)
+		}
+		if !reflect.DeepEqual(values, valuesExpected) {
+			t.Fatalf("unexpected values; got %v; want %v", values, valuesExpected)
+		}
+	}
+	f(nil, nil, nil, nil)
+	f([]int64{1}, []float64{1}, []int64{1}, []float64{1})
+	f([]int64{1, 2, 3}, []float64{1, 2, 3}, []int64{1, 2, 3}, []float64{1, 2, 3})
+	f([]int64{3, 1, 2}, []float64{1, 2, 3}, []int64{3, 1, 2}, []float64{1, 2, 3})
+	f([]int64{1, 1, 1}, []float64{1, 2, 3}, []int64{1}, []float64{3})
+	f([]int64{2, 1, 2, 3, 1}, []float64{1, 2, 3, 4, 5}, []int64{2, 1, 3}, []float64{3, 5, 4})
+}
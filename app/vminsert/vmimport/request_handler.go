@@ -21,6 +21,23 @@ var (
 	rowsPerInsert = metrics.NewHistogram(`vm_rows_per_insert{type="vmimport"}`)
 )
 
+var sdGlobal *sampleDeduper
+
+// Init initializes /api/v1/import handler.
+func Init() {
+	if *dedupWindow > 0 {
+		sdGlobal = newSampleDeduper(getDedupCacheSize(), *dedupWindow)
+	}
+}
+
+// Stop stops /api/v1/import handler.
+func Stop() {
+	if sdGlobal != nil {
+		sdGlobal.MustStop()
+		sdGlobal = nil
+	}
+}
+
 // InsertHandler processes `/api/v1/import` request.
 //
 // See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/6
@@ -49,6 +66,7 @@ func insertRows(rows []parser.Row, extraLabels []prompbmarshal.Label) error {
 	ic.Reset(rowsLen)
 	rowsTotal := 0
 	hasRelabeling := relabel.HasRelabeling()
+	sd := sdGlobal
 	for i := range rows {
 		r := &rows[i]
 		rowsTotal += len(r.Values)
@@ -75,6 +93,9 @@ func insertRows(rows []parser.Row, extraLabels []prompbmarshal.Label) error {
 		if len(timestamps) != len(values) {
 			logger.Panicf("BUG: len(timestamps)=%d must match len(values)=%d", len(timestamps), len(values))
 		}
+		if sd != nil {
+			timestamps, values = sd.deduplicateSamples(ctx, ctx.metricNameBuf, timestamps, values)
+		}
 		for j, value := range values {
 			timestamp := timestamps[j]
 			if err := ic.WriteDataPoint(ctx.metricNameBuf, nil, timestamp, value); err != nil {
@@ -84,17 +105,38 @@ func insertRows(rows []parser.Row, extraLabels []prompbmarshal.Label) error {
 	}
 	rowsInserted.Add(rowsTotal)
 	rowsPerInsert.Update(float64(rowsTotal))
-	return ic.FlushBufs()
+	if err := ic.FlushBufs(); err != nil {
+		return err
+	}
+	if sd != nil {
+		sd.commitSamples(ctx)
+	}
+	return nil
 }
 
 type pushCtx struct {
 	Common        common.InsertCtx
 	metricNameBuf []byte
+
+	dedupKeyBuf             []byte
+	dedupValueBuf           []byte
+	dedupPendingKeysBuf     []byte
+	dedupPendingKeysOffsets []int
+	dedupPendingValues      []float64
 }
 
 func (ctx *pushCtx) reset() {
 	ctx.Common.Reset(0)
 	ctx.metricNameBuf = ctx.metricNameBuf[:0]
+	ctx.dedupKeyBuf = ctx.dedupKeyBuf[:0]
+	ctx.dedupValueBuf = ctx.dedupValueBuf[:0]
+	ctx.resetDedupPendingKeys()
+}
+
+func (ctx *pushCtx) resetDedupPendingKeys() {
+	ctx.dedupPendingKeysBuf = ctx.dedupPendingKeysBuf[:0]
+	ctx.dedupPendingKeysOffsets = ctx.dedupPendingKeysOffsets[:0]
+	ctx.dedupPendingValues = ctx.dedupPendingValues[:0]
 }
 
 func getPushCtx() *pushCtx {
@@ -0,0 +1,366 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	federationBackends = flagutil.NewArray("search.federationBackend", "Optional URL of VictoriaMetrics instance for querying via /federated/api/v1/query "+
+		"and /federated/api/v1/query_range . The URL may be prefixed with name= in order to set the value for -search.federationSourceLabel , "+
+		"for example, eu=http://vm-eu:8428 . The URL host is used as the source label value by default. "+
+		"Pass multiple -search.federationBackend flags in order to query multiple instances. See https://docs.victoriametrics.com/#query-federation")
+	federationSourceLabel = flag.String("search.federationSourceLabel", "source", "The label name for the backend name, which returned the time series, "+
+		"in responses from /federated/api/v1/query and /federated/api/v1/query_range")
+	federationTimeout         = flag.Duration("search.federationTimeout", 30*time.Second, "The maximum duration for waiting for responses from -search.federationBackend")
+	federationMaxResponseSize = flagutil.NewBytes("search.federationMaxResponseSize", 64*1024*1024, "The maximum size of a response from -search.federationBackend. "+
+		"Bigger responses are treated as errors")
+)
+
+// maxErrorBodyLen is the maximum length of the backend response body included in error messages.
+const maxErrorBodyLen = 512
+
+var backendErrors = metrics.NewCounter(`vm_federation_backend_errors_total`)
+
+// Backend is a VictoriaMetrics instance, which is queried by QueryHandler.
+type Backend struct {
+	// Name is the value for -search.federationSourceLabel in time series returned from the backend.
+	Name string
+
+	// URL is the url of the backend without the trailing /api/v1/query path.
+	URL string
+}
+
+var (
+	backends     []Backend
+	backendsOnce sync.Once
+
+	client = &http.Client{}
+)
+
+func getBackends() []Backend {
+	backendsOnce.Do(func() {
+		bs, err := parseBackends(*federationBackends)
+		if err != nil {
+			logger.Fatalf("cannot parse -search.federationBackend: %s", err)
+		}
+		backends = bs
+	})
+	return backends
+}
+
+func parseBackends(ss []string) ([]Backend, error) {
+	var bs []Backend
+	for _, s := range ss {
+		if s == "" {
+			continue
+		}
+		name := ""
+		if n := strings.IndexByte(s, '='); n > 0 && !strings.ContainsAny(s[:n], ":/") {
+			name = s[:n]
+			s = s[n+1:]
+		}
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %q: %w", s, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("unsupported scheme in %q; supported schemes: http, https", s)
+		}
+		if name == "" {
+			name = u.Host
+		}
+		bs = append(bs, Backend{
+			Name: name,
+			URL:  strings.TrimSuffix(s, "/"),
+		})
+	}
+	return bs, nil
+}
+
+// QueryHandler processes /federated/api/v1/query and /federated/api/v1/query_range requests.
+//
+// path must contain either /api/v1/query or /api/v1/query_range.
+func QueryHandler(w http.ResponseWriter, r *http.Request, path string) error {
+	bs := getBackends()
+	if len(bs) == 0 {
+		return &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("missing -search.federationBackend command-line flag"),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	if err := r.ParseForm(); err != nil {
+		return fmt.Errorf("cannot parse request form values: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), *federationTimeout)
+	defer cancel()
+	resp, err := Query(ctx, client, bs, *federationSourceLabel, path, r.Form)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("cannot marshal response: %w", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+	return nil
+}
+
+// Response is the response for federated query.
+type Response struct {
+	Status    string       `json:"status"`
+	IsPartial bool         `json:"isPartial"`
+	Warnings  []string     `json:"warnings,omitempty"`
+	Data      ResponseData `json:"data"`
+}
+
+// ResponseData is the data for federated query response.
+type ResponseData struct {
+	ResultType string   `json:"resultType"`
+	Result     []Series `json:"result"`
+}
+
+// Series is a time series returned from the backend.
+//
+// Value is set for instant queries, while Values is set for range queries.
+type Series struct {
+	Metric map[string]string `json:"metric"`
+	Value  *Point            `json:"value,omitempty"`
+	Values []Point           `json:"values,omitempty"`
+}
+
+// Point is a `[timestamp, "value"]` pair.
+type Point [2]json.RawMessage
+
+func (p *Point) timestamp() float64 {
+	ts, err := strconv.ParseFloat(string(p[0]), 64)
+	if err != nil {
+		return 0
+	}
+	return ts
+}
+
+type backendResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// Query sends the query with the given args to the given path at all the bs in parallel and merges the responses.
+//
+// Every returned time series contains sourceLabel with the name of the backend, which returned it.
+// Time series with identical labels returned from multiple backends are merged into a single time series.
+// The name of the first backend in bs, which returned the time series, is used as sourceLabel value in this case.
+//
+// Partial response is returned if some of bs return errors. An error is returned if all the bs return errors.
+// Requests to bs are canceled when ctx is done.
+func Query(ctx context.Context, c *http.Client, bs []Backend, sourceLabel, path string, args url.Values) (*Response, error) {
+	results := make([]*backendResponse, len(bs))
+	errs := make([]error, len(bs))
+	var wg sync.WaitGroup
+	for i := range bs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = queryBackend(ctx, c, &bs[i], path, args)
+		}(i)
+	}
+	wg.Wait()
+
+	resp := &Response{
+		Status: "success",
+	}
+	m := newSeriesMerger(sourceLabel)
+	resultType := ""
+	successCount := 0
+	for i, br := range results {
+		err := errs[i]
+		if err == nil {
+			if resultType != "" && br.Data.ResultType != resultType {
+				err = fmt.Errorf("unexpected resultType=%q; want %q", br.Data.ResultType, resultType)
+			} else {
+				resultType = br.Data.ResultType
+				err = m.add(bs[i].Name, resultType, br.Data.Result)
+			}
+		}
+		if err != nil {
+			backendErrors.Inc()
+			resp.IsPartial = true
+			resp.Warnings = append(resp.Warnings, fmt.Sprintf("error when querying backend %q: %s", bs[i].Name, err))
+			continue
+		}
+		successCount++
+	}
+	if successCount == 0 {
+		return nil, &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("all the backends failed: %s", strings.Join(resp.Warnings, "; ")),
+			StatusCode: http.StatusBadGateway,
+		}
+	}
+	resp.Data.ResultType = resultType
+	resp.Data.Result = m.result()
+	return resp, nil
+}
+
+func queryBackend(ctx context.Context, c *http.Client, b *Backend, path string, args url.Values) (*backendResponse, error) {
+	u, err := url.Parse(b.URL)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse backend url: %w", err)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), strings.NewReader(args.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	maxSize := federationMaxResponseSize.N
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxSize)+1))
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read response: %w", err)
+	}
+	if len(data) > maxSize {
+		return nil, fmt.Errorf("the response exceeds -search.federationMaxResponseSize=%d bytes; "+
+			"either reduce the response size by narrowing down the query or increase -search.federationMaxResponseSize", maxSize)
+	}
+	var br backendResponse
+	if err := json.Unmarshal(data, &br); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status code %d; response: %q", resp.StatusCode, truncateBody(data))
+		}
+		return nil, fmt.Errorf("cannot parse response %q: %w", truncateBody(data), err)
+	}
+	if br.Status != "success" {
+		return nil, fmt.Errorf("unexpected status code %d; error: %s", resp.StatusCode, truncateBody([]byte(br.Error)))
+	}
+	return &br, nil
+}
+
+// truncateBody returns data truncated to maxErrorBodyLen bytes for including it in error messages.
+func truncateBody(data []byte) []byte {
+	if len(data) <= maxErrorBodyLen {
+		return data
+	}
+	b := append([]byte{}, data[:maxErrorBodyLen]...)
+	return append(b, "..."...)
+}
+
+// seriesMerger merges time series from multiple backends.
+type seriesMerger struct {
+	sourceLabel string
+	m           map[string]*Series
+	keys        []string
+}
+
+func newSeriesMerger(sourceLabel string) *seriesMerger {
+	return &seriesMerger{
+		sourceLabel: sourceLabel,
+		m:           make(map[string]*Series),
+	}
+}
+
+func (sm *seriesMerger) add(name, resultType string, result json.RawMessage) error {
+	switch resultType {
+	case "vector", "matrix":
+	default:
+		return fmt.Errorf("unsupported resultType=%q; supported values: vector, matrix", resultType)
+	}
+	var ss []Series
+	if err := json.Unmarshal(result, &ss); err != nil {
+		return fmt.Errorf("cannot parse result: %w", err)
+	}
+	for i := range ss {
+		s := &ss[i]
+		if s.Metric == nil {
+			s.Metric = make(map[string]string)
+		}
+		delete(s.Metric, sm.sourceLabel)
+		key := marshalMetric(s.Metric)
+		if sPrev := sm.m[key]; sPrev != nil {
+			sPrev.Values = mergePoints(sPrev.Values, s.Values)
+			continue
+		}
+		s.Metric[sm.sourceLabel] = name
+		sm.m[key] = s
+		sm.keys = append(sm.keys, key)
+	}
+	return nil
+}
+
+func (sm *seriesMerger) result() []Series {
+	sort.Strings(sm.keys)
+	result := make([]Series, 0, len(sm.keys))
+	for _, key := range sm.keys {
+		result = append(result, *sm.m[key])
+	}
+	return result
+}
+
+// mergePoints adds points from src, which are missing in dst, to dst.
+//
+// Points in dst take precedence over points in src with the same timestamps.
+func mergePoints(dst, src []Point) []Point {
+	if len(src) == 0 {
+		return dst
+	}
+	result := make([]Point, 0, len(dst)+len(src))
+	i, j := 0, 0
+	for i < len(dst) && j < len(src) {
+		tsDst := dst[i].timestamp()
+		tsSrc := src[j].timestamp()
+		switch {
+		case tsDst < tsSrc:
+			result = append(result, dst[i])
+			i++
+		case tsDst > tsSrc:
+			result = append(result, src[j])
+			j++
+		default:
+			result = append(result, dst[i])
+			i++
+			j++
+		}
+	}
+	result = append(result, dst[i:]...)
+	result = append(result, src[j:]...)
+	return result
+}
+
+func marshalMetric(m map[string]string) string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b []byte
+	for _, name := range names {
+		b = strconv.AppendQuote(b, name)
+		b = append(b, '=')
+		b = strconv.AppendQuote(b, m[name])
+		b = append(b, ',')
+	}
+	return string(b)
+}
@@ -0,0 +1,193 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newFakeBackend(t *testing.T, response string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query_range" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if q := r.FormValue("query"); q != "up" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"status":"error","error":"unexpected query %q"}`, q)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, "%s", response)
+	}))
+}
+
+func TestParseBackends(t *testing.T) {
+	f := func(ss []string, bsExpected []Backend) {
+		t.Helper()
+		bs, err := parseBackends(ss)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(bs, bsExpected) {
+			t.Fatalf("unexpected backends\ngot\n%v\nwant\n%v", bs, bsExpected)
+		}
+	}
+	f(nil, nil)
+	f([]string{"http://vm-eu:8428/"}, []Backend{{Name: "vm-eu:8428", URL: "http://vm-eu:8428"}})
+	f([]string{"eu=http://vm-eu:8428", "us=https://vm-us/prometheus?foo=bar"}, []Backend{
+		{Name: "eu", URL: "http://vm-eu:8428"},
+		{Name: "us", URL: "https://vm-us/prometheus?foo=bar"},
+	})
+
+	// invalid backends
+	for _, s := range []string{"vm-eu:8428", "eu=ftp://vm-eu", "eu="} {
+		if _, err := parseBackends([]string{s}); err == nil {
+			t.Fatalf("expecting non-nil error for %q", s)
+		}
+	}
+}
+
+func TestQueryOverlappingSeries(t *testing.T) {
+	eu := newFakeBackend(t, `{"status":"success","data":{"resultType":"matrix","result":[
+{"metric":{"__name__":"up","job":"a"},"values":[[1,"1"],[2,"1"]]},
+{"metric":{"__name__":"up","job":"b"},"values":[[1,"0"]]}
+]}}`)
+	defer eu.Close()
+	us := newFakeBackend(t, `{"status":"success","data":{"resultType":"matrix","result":[
+{"metric":{"__name__":"up","job":"a","source":"foo"},"values":[[2,"5"],[3,"1"]]},
+{"metric":{"__name__":"up","job":"c"},"values":[[3,"1"]]}
+]}}`)
+	defer us.Close()
+
+	bs := []Backend{
+		{Name: "eu", URL: eu.URL},
+		{Name: "us", URL: us.URL},
+	}
+	args := url.Values{
+		"query": {"up"},
+	}
+	resp, err := Query(context.Background(), http.DefaultClient, bs, "source", "/api/v1/query_range", args)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("cannot marshal response: %s", err)
+	}
+	resultExpected := `{"status":"success","isPartial":false,"data":{"resultType":"matrix","result":[` +
+		`{"metric":{"__name__":"up","job":"a","source":"eu"},"values":[[1,"1"],[2,"1"],[3,"1"]]},` +
+		`{"metric":{"__name__":"up","job":"b","source":"eu"},"values":[[1,"0"]]},` +
+		`{"metric":{"__name__":"up","job":"c","source":"us"},"values":[[3,"1"]]}]}}`
+	if string(data) != resultExpected {
+		t.Fatalf("unexpected response\ngot\n%s\nwant\n%s", data, resultExpected)
+	}
+}
+
+func TestQueryPartialFailure(t *testing.T) {
+	eu := newFakeBackend(t, `{"status":"success","data":{"resultType":"vector","result":[
+{"metric":{"__name__":"up","job":"a"},"value":[1,"1"]}
+]}}`)
+	defer eu.Close()
+	us := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer us.Close()
+
+	bs := []Backend{
+		{Name: "eu", URL: eu.URL},
+		{Name: "us", URL: us.URL},
+	}
+	args := url.Values{
+		"query": {"up"},
+	}
+	resp, err := Query(context.Background(), http.DefaultClient, bs, "region", "/api/v1/query_range", args)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !resp.IsPartial {
+		t.Fatalf("expecting partial response")
+	}
+	if len(resp.Warnings) != 1 {
+		t.Fatalf("unexpected number of warnings; got %d; want 1; warnings: %q", len(resp.Warnings), resp.Warnings)
+	}
+	if len(resp.Data.Result) != 1 {
+		t.Fatalf("unexpected number of series; got %d; want 1", len(resp.Data.Result))
+	}
+	metricExpected := map[string]string{
+		"__name__": "up",
+		"job":      "a",
+		"region":   "eu",
+	}
+	if !reflect.DeepEqual(resp.Data.Result[0].Metric, metricExpected) {
+		t.Fatalf("unexpected metric; got %v; want %v", resp.Data.Result[0].Metric, metricExpected)
+	}
+
+	// All the backends fail
+	if _, err := Query(context.Background(), http.DefaultClient, bs[1:], "region", "/api/v1/query_range", args); err == nil {
+		t.Fatalf("expecting non-nil error when all the backends fail")
+	}
+
+	// Backends return errors for invalid query
+	args.Set("query", "foo")
+	if _, err := Query(context.Background(), http.DefaultClient, bs, "region", "/api/v1/query_range", args); err == nil {
+		t.Fatalf("expecting non-nil error for invalid query")
+	}
+}
+
+func TestQueryBackendLimits(t *testing.T) {
+	args := url.Values{
+		"query": {"up"},
+	}
+
+	// Too big response
+	big := newFakeBackend(t, `{"status":"success","data":{"resultType":"vector","result":[]}}`+strings.Repeat(" ", 1024))
+	defer big.Close()
+	maxSizeOrig := federationMaxResponseSize.N
+	federationMaxResponseSize.N = 100
+	_, err := queryBackend(context.Background(), http.DefaultClient, &Backend{Name: "big", URL: big.URL}, "/api/v1/query_range", args)
+	federationMaxResponseSize.N = maxSizeOrig
+	if err == nil || !strings.Contains(err.Error(), "-search.federationMaxResponseSize") {
+		t.Fatalf("expecting error on too big response; got %v", err)
+	}
+
+	// Invalid response body must be truncated in the error message
+	invalid := newFakeBackend(t, strings.Repeat("x", 10*maxErrorBodyLen))
+	defer invalid.Close()
+	_, err = queryBackend(context.Background(), http.DefaultClient, &Backend{Name: "invalid", URL: invalid.URL}, "/api/v1/query_range", args)
+	if err == nil {
+		t.Fatalf("expecting non-nil error on invalid response")
+	}
+	if n := len(err.Error()); n > 2*maxErrorBodyLen {
+		t.Fatalf("too long error message; got %d bytes; want up to %d bytes", n, 2*maxErrorBodyLen)
+	}
+
+	// The request must be canceled when ctx is done
+	stopCh := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-stopCh:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(stopCh)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	startTime := time.Now()
+	_, err = queryBackend(ctx, http.DefaultClient, &Backend{Name: "slow", URL: slow.URL}, "/api/v1/query_range", args)
+	if err == nil {
+		t.Fatalf("expecting non-nil error on timeout")
+	}
+	if d := time.Since(startTime); d > 5*time.Second {
+		t.Fatalf("the request wasn't canceled on ctx timeout; it took %s", d)
+	}
+}
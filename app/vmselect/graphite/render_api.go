@@ -0,0 +1,168 @@
+package graphite
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/bufferedwriter"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/prometheus"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/promql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promutils"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var storageStep = flag.Duration("search.graphiteStorageStep", 10*time.Second, "The interval between datapoints stored in the database. "+
+	"It is used at Graphite Render API handler for normalizing the interval between datapoints in case it isn't normalized. "+
+	"It can be overridden by sending 'storage_step' query arg to /render API or by sending the desired interval via 'Storage-Step' http header during querying /render API")
+
+// RenderHandler implements /render endpoint from Graphite Render API.
+//
+// Graphite targets are translated to MetricsQL queries. Only a subset of Graphite functions is supported.
+//
+// See https://graphite.readthedocs.io/en/stable/render_api.html
+func RenderHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	deadline := searchutils.GetDeadlineForQuery(r, startTime)
+	if err := r.ParseForm(); err != nil {
+		return fmt.Errorf("cannot parse form values: %w", err)
+	}
+	targets := r.Form["target"]
+	if len(targets) == 0 {
+		return fmt.Errorf("missing `target` query arg")
+	}
+	format := r.FormValue("format")
+	if format != "" && format != "json" {
+		return fmt.Errorf("unsupported format=%q; supported values: json", format)
+	}
+	jsonp := r.FormValue("jsonp")
+	ct := startTime.UnixNano() / 1e6
+	from, err := getGraphiteTime(r, "from", ct-24*3600*1000, ct)
+	if err != nil {
+		return err
+	}
+	until, err := getGraphiteTime(r, "until", ct, ct)
+	if err != nil {
+		return err
+	}
+	if from >= until {
+		return fmt.Errorf("from=%d must be smaller than until=%d", from, until)
+	}
+	step, err := getStorageStep(r)
+	if err != nil {
+		return err
+	}
+	maxDataPoints, err := getInt(r, "maxDataPoints")
+	if err != nil {
+		return err
+	}
+	if maxDataPoints > 0 {
+		// Increase step to a multiple of the storage step, so the number of returned points doesn't exceed maxDataPoints.
+		if points := (until - from) / step; points > int64(maxDataPoints) {
+			n := (points + int64(maxDataPoints) - 1) / int64(maxDataPoints)
+			step *= n
+		}
+	}
+	// Align the time range to step as Graphite does.
+	start := from - from%step + step
+	end := until - until%step
+	if start > end {
+		start = end
+	}
+	if err := promql.ValidateMaxPointsPerTimeseries(start, end, step); err != nil {
+		return err
+	}
+	etfs, err := searchutils.GetExtraTagFilters(r)
+	if err != nil {
+		return fmt.Errorf("cannot setup tag filters: %w", err)
+	}
+	mayCache := !httputils.GetBool(r, "nocache")
+
+	var rss []netstorage.Result
+	for _, target := range targets {
+		expr, err := parseGraphiteExpr(target)
+		if err != nil {
+			return fmt.Errorf("cannot parse target: %w", err)
+		}
+		query, err := translateGraphiteExpr(expr, step)
+		if err != nil {
+			return fmt.Errorf("cannot translate target=%q to MetricsQL: %w", target, err)
+		}
+		ec := promql.EvalConfig{
+			Start:               start,
+			End:                 end,
+			Step:                step,
+			MaxSeries:           prometheus.GetMaxUniqueTimeseries(etfs),
+			QuotedRemoteAddr:    httpserver.GetQuotedRemoteAddr(r),
+			Deadline:            deadline,
+			MayCache:            mayCache,
+			RoundDigits:         100,
+			EnforcedTagFilterss: etfs,
+		}
+		result, err := promql.Exec(nil, &ec, query, false)
+		if err != nil {
+			return fmt.Errorf("cannot execute target=%q translated to MetricsQL query %q: %w", target, query, err)
+		}
+		rss = append(rss, result...)
+	}
+
+	contentType := getContentType(jsonp)
+	w.Header().Set("Content-Type", contentType)
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	WriteRenderResponse(bw, rss, jsonp)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	renderDuration.UpdateDuration(startTime)
+	return nil
+}
+
+var renderDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/render"}`)
+
+// getStorageStep returns the interval in milliseconds between datapoints stored in the database.
+func getStorageStep(r *http.Request) (int64, error) {
+	s := r.FormValue("storage_step")
+	if len(s) == 0 {
+		s = r.Header.Get("Storage-Step")
+	}
+	if len(s) == 0 {
+		step := storageStep.Milliseconds()
+		if step <= 0 {
+			return 0, fmt.Errorf("-search.graphiteStorageStep must be positive; got %s", *storageStep)
+		}
+		return step, nil
+	}
+	step, err := promutils.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse storage step %q: %w", s, err)
+	}
+	if step <= 0 {
+		return 0, fmt.Errorf("storage step must be positive; got %q", s)
+	}
+	return step.Milliseconds(), nil
+}
+
+// getGraphiteTime returns time in milliseconds from the given argKey query arg.
+//
+// It supports Graphite-specific time formats such as `now`, `-1h` and `now-10min` in addition to formats supported by searchutils.GetTime.
+// See https://graphite.readthedocs.io/en/stable/render_api.html#from-until
+func getGraphiteTime(r *http.Request, argKey string, defaultMs, ct int64) (int64, error) {
+	s := r.FormValue(argKey)
+	if s == "now" {
+		return ct, nil
+	}
+	if strings.HasPrefix(s, "now") || strings.HasPrefix(s, "-") {
+		d, err := parseGraphiteInterval(strings.TrimPrefix(s, "now"))
+		if err != nil {
+			return 0, fmt.Errorf("cannot parse %q=%q: %w", argKey, s, err)
+		}
+		return ct + d.Milliseconds(), nil
+	}
+	return httputils.GetTime(r, argKey, defaultMs)
+}
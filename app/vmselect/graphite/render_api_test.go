@@ -0,0 +1,275 @@
+package graphite
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+func TestParseGraphiteExprSuccess(t *testing.T) {
+	f := func(s, resultExpected string) {
+		t.Helper()
+		expr, err := parseGraphiteExpr(s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result := expr.String()
+		if result != resultExpected {
+			t.Fatalf("unexpected result for parseGraphiteExpr(%q); got %s; want %s", s, result, resultExpected)
+		}
+	}
+	f("foo.bar", "foo.bar")
+	f("foo.*.{bar,baz}", "foo.*.{bar,baz}")
+	f("1.5", "1.5")
+	f("'foo'", `"foo"`)
+	f(`"foo bar"`, `"foo bar"`)
+	f("alias(foo.bar, 'baz')", `alias(foo.bar,"baz")`)
+	f("sumSeries( foo.{a,b}.c , x.y )", "sumSeries(foo.{a,b}.c,x.y)")
+	f("movingAverage(scale(sumSeries(foo.*),2.5),'5min')", `movingAverage(scale(sumSeries(foo.*),2.5),"5min")`)
+	f("foo()", "foo()")
+}
+
+func TestParseGraphiteExprFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		expr, err := parseGraphiteExpr(s)
+		if err == nil {
+			t.Fatalf("expecting non-nil error for parseGraphiteExpr(%q); got %s", s, expr)
+		}
+	}
+	f("")
+	f("foo(")
+	f("foo(bar")
+	f("foo(bar baz)")
+	f("foo(,)")
+	f("foo('bar)")
+	f("foo) bar")
+}
+
+func TestTranslateGraphiteExprSuccess(t *testing.T) {
+	f := func(s, queryExpected string) {
+		t.Helper()
+		expr, err := parseGraphiteExpr(s)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", s, err)
+		}
+		query, err := translateGraphiteExpr(expr, 10e3)
+		if err != nil {
+			t.Fatalf("unexpected error when translating %q: %s", s, err)
+		}
+		if query != queryExpected {
+			t.Fatalf("unexpected query for %q\ngot\n%s\nwant\n%s", s, query, queryExpected)
+		}
+	}
+	f("foo.*.bar", `{__graphite__="foo.*.bar"}`)
+	f("alias(foo.bar,'baz')", `label_set(label_join({__graphite__="foo.bar"}, "__graphite_series__", ";", "__graphite_series__", "__name__"), "__name__", "baz")`)
+	f("sumSeries(foo.*)", `label_set(sum({__graphite__="foo.*"}), "__name__", "sumSeries(foo.*)")`)
+	f("sumSeries(foo.*,bar)", `label_set(sum(union({__graphite__="foo.*"}, {__graphite__="bar"})), "__name__", "sumSeries(foo.*,bar)")`)
+	f("scale(foo.bar,2)", `label_move((label_replace({__graphite__="foo.bar"}, "__graphite_name__", "scale(${1},2)", "__name__", "(.*)")) * 2, "__graphite_name__", "__name__")`)
+	f("movingAverage(foo.bar,3)", `label_replace(avg_over_time({__graphite__="foo.bar"}[30000ms]) keep_metric_names, "__name__", "movingAverage(${1},3)", "__name__", "(.*)")`)
+	f("movingAverage(foo.bar,'1min')", `label_replace(avg_over_time({__graphite__="foo.bar"}[60000ms]) keep_metric_names, "__name__", "movingAverage(${1},\"1min\")", "__name__", "(.*)")`)
+	f("movingAverage(sumSeries(foo.*),2)", `label_replace(avg_over_time((label_set(sum({__graphite__="foo.*"}), "__name__", "sumSeries(foo.*)"))[20000ms:10000ms]) keep_metric_names, "__name__", "movingAverage(${1},2)", "__name__", "(.*)")`)
+}
+
+func TestTranslateGraphiteExprFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		expr, err := parseGraphiteExpr(s)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", s, err)
+		}
+		query, err := translateGraphiteExpr(expr, 10e3)
+		if err == nil {
+			t.Fatalf("expecting non-nil error when translating %q; got %s", s, query)
+		}
+	}
+	f("'foo'")
+	f("123")
+	f("unknownFunc(foo)")
+	f("alias(foo)")
+	f("alias(foo,bar)")
+	f("sumSeries()")
+	f("sumSeries(foo,'bar')")
+	f("scale(foo,'bar')")
+	f("scale(foo)")
+	f("movingAverage(foo,0)")
+	f("movingAverage(foo,'5xyz')")
+	f("movingAverage(foo,bar)")
+}
+
+func TestParseGraphiteInterval(t *testing.T) {
+	f := func(s string, dExpected time.Duration) {
+		t.Helper()
+		d, err := parseGraphiteInterval(s)
+		if err != nil {
+			t.Fatalf("unexpected error in parseGraphiteInterval(%q): %s", s, err)
+		}
+		if d != dExpected {
+			t.Fatalf("unexpected interval for %q; got %s; want %s", s, d, dExpected)
+		}
+	}
+	f("10s", 10*time.Second)
+	f("5min", 5*time.Minute)
+	f("-1h", -time.Hour)
+	f("+2d", 48*time.Hour)
+	f("1w", 7*24*time.Hour)
+	f("3minutes", 3*time.Minute)
+
+	for _, s := range []string{"", "min", "5", "5m", "1.5h"} {
+		if _, err := parseGraphiteInterval(s); err == nil {
+			t.Fatalf("expecting non-nil error for parseGraphiteInterval(%q)", s)
+		}
+	}
+}
+
+func TestRenderHandler(t *testing.T) {
+	dataPath := "TestRenderHandler"
+	defer fs.MustRemoveAll(dataPath)
+	prevDataPath := *vmstorage.DataPath
+	*vmstorage.DataPath = dataPath
+	defer func() {
+		*vmstorage.DataPath = prevDataPath
+	}()
+	netstorage.InitTmpBlocksDir(dataPath)
+	vmstorage.InitWithoutMetrics(func(mrs []storage.MetricRow) {})
+	defer vmstorage.Stop()
+
+	// Ingest Graphite series with 10s interval between points.
+	const step = 10
+	base := time.Now().Add(-time.Hour).Unix()
+	base -= base % step
+	var mrs []storage.MetricRow
+	for i := 0; i < 10; i++ {
+		for _, s := range []struct {
+			name  string
+			value float64
+		}{
+			{"foo.a.cpu", float64(i)},
+			{"foo.b.cpu", float64(10 * i)},
+			{"bar.a.cpu", float64(100 * i)},
+		} {
+			labels := []prompb.Label{{
+				Name:  []byte("__name__"),
+				Value: []byte(s.name),
+			}}
+			mrs = append(mrs, storage.MetricRow{
+				MetricNameRaw: storage.MarshalMetricNameRaw(nil, labels),
+				Timestamp:     (base + int64(i)*step) * 1e3,
+				Value:         s.value,
+			})
+		}
+	}
+	if err := vmstorage.AddRows(mrs); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+	vmstorage.Storage.DebugFlush()
+
+	// datapoints returns Graphite datapoints for the range (base, base+60s] with values obtained from valueFunc for every point index.
+	datapoints := func(valueFunc func(i int) string) string {
+		var a []string
+		for i := 1; i <= 6; i++ {
+			a = append(a, fmt.Sprintf("[%s,%d]", valueFunc(i), base+int64(i)*step))
+		}
+		return "[" + strings.Join(a, ",") + "]"
+	}
+	series := func(name string, valueFunc func(i int) string) string {
+		return fmt.Sprintf(`{"target":%q,"tags":{"name":%q},"datapoints":%s}`, name, name, datapoints(valueFunc))
+	}
+	f := func(targets []string, responseExpected string) {
+		t.Helper()
+		args := url.Values{
+			"target": targets,
+			"from":   {fmt.Sprintf("%d", base)},
+			"until":  {fmt.Sprintf("%d", base+60)},
+			"format": {"json"},
+		}
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/render?"+args.Encode(), nil)
+		r.Header.Set("Storage-Step", "10s")
+		if err := RenderHandler(time.Now(), w, r); err != nil {
+			t.Fatalf("unexpected error for targets %q: %s", targets, err)
+		}
+		response := strings.TrimSpace(w.Body.String())
+		if response != responseExpected {
+			t.Fatalf("unexpected response for targets %q\ngot\n%s\nwant\n%s", targets, response, responseExpected)
+		}
+	}
+
+	f([]string{"foo.a.cpu"}, "["+series("foo.a.cpu", func(i int) string {
+		return fmt.Sprintf("%d", i)
+	})+"]")
+	f([]string{"foo.*.cpu"}, "["+series("foo.a.cpu", func(i int) string {
+		return fmt.Sprintf("%d", i)
+	})+","+series("foo.b.cpu", func(i int) string {
+		return fmt.Sprintf("%d", 10*i)
+	})+"]")
+	f([]string{"alias(foo.a.cpu,'cpu_a')"}, "["+series("cpu_a", func(i int) string {
+		return fmt.Sprintf("%d", i)
+	})+"]")
+	f([]string{"alias(foo.*.cpu,'cpu')"}, "["+series("cpu", func(i int) string {
+		return fmt.Sprintf("%d", i)
+	})+","+series("cpu", func(i int) string {
+		return fmt.Sprintf("%d", 10*i)
+	})+"]")
+	f([]string{"scale(alias(alias(foo.*.cpu,'cpu'),'total'),2)"}, "["+series("scale(total,2)", func(i int) string {
+		return fmt.Sprintf("%d", 2*i)
+	})+","+series("scale(total,2)", func(i int) string {
+		return fmt.Sprintf("%d", 20*i)
+	})+"]")
+	f([]string{"sumSeries(foo.*.cpu)"}, "["+series("sumSeries(foo.*.cpu)", func(i int) string {
+		return fmt.Sprintf("%d", 11*i)
+	})+"]")
+	f([]string{"sumSeries(foo.a.cpu,bar.*.cpu)"}, "["+series("sumSeries(foo.a.cpu,bar.*.cpu)", func(i int) string {
+		return fmt.Sprintf("%d", 101*i)
+	})+"]")
+	f([]string{"scale(foo.{a,b}.cpu,0.5)"}, "["+series("scale(foo.a.cpu,0.5)", func(i int) string {
+		return fmt.Sprintf("%g", 0.5*float64(i))
+	})+","+series("scale(foo.b.cpu,0.5)", func(i int) string {
+		return fmt.Sprintf("%d", 5*i)
+	})+"]")
+	f([]string{"movingAverage(foo.a.cpu,2)"}, "["+series("movingAverage(foo.a.cpu,2)", func(i int) string {
+		return fmt.Sprintf("%g", float64(i)-0.5)
+	})+"]")
+	f([]string{"movingAverage(sumSeries(foo.*.cpu),'20s')"}, "["+series(`movingAverage(sumSeries(foo.*.cpu),"20s")`, func(i int) string {
+		return fmt.Sprintf("%g", 11*float64(i)-5.5)
+	})+"]")
+	f([]string{"alias(scale(sumSeries(foo.*.cpu),2),'total')", "bar.a.cpu"}, "["+series("total", func(i int) string {
+		return fmt.Sprintf("%d", 22*i)
+	})+","+series("bar.a.cpu", func(i int) string {
+		return fmt.Sprintf("%d", 100*i)
+	})+"]")
+	f([]string{"missing.series"}, "[]")
+
+	// Invalid requests
+	fError := func(args url.Values) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/render?"+args.Encode(), nil)
+		if err := RenderHandler(time.Now(), w, r); err == nil {
+			t.Fatalf("expecting non-nil error for %q", args.Encode())
+		}
+	}
+	fError(url.Values{})
+	fError(url.Values{
+		"target": {"highestMax(foo.*.cpu,1)"},
+	})
+	fError(url.Values{
+		"target": {"foo.a.cpu"},
+		"format": {"csv"},
+	})
+	fError(url.Values{
+		"target": {"foo.a.cpu"},
+		"from":   {"-1h"},
+		"until":  {"-2h"},
+	})
+}
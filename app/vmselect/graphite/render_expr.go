@@ -0,0 +1,309 @@
+package graphite
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// graphiteExpr is a parsed Graphite target expression.
+//
+// See https://graphite.readthedocs.io/en/stable/render_api.html#target
+type graphiteExpr interface {
+	// String returns the original string representation of the expression.
+	String() string
+}
+
+// graphitePathExpr is a Graphite path expression such as `foo.*.bar`.
+type graphitePathExpr struct {
+	path string
+}
+
+func (pe *graphitePathExpr) String() string {
+	return pe.path
+}
+
+// graphiteFuncExpr is a Graphite function call such as `sumSeries(foo.*)`.
+type graphiteFuncExpr struct {
+	name string
+	args []graphiteExpr
+}
+
+func (fe *graphiteFuncExpr) String() string {
+	args := make([]string, len(fe.args))
+	for i, arg := range fe.args {
+		args[i] = arg.String()
+	}
+	return fe.name + "(" + strings.Join(args, ",") + ")"
+}
+
+// graphiteStringExpr is a quoted string such as `'foo'`.
+type graphiteStringExpr struct {
+	s string
+}
+
+func (se *graphiteStringExpr) String() string {
+	return strconv.Quote(se.s)
+}
+
+// graphiteNumberExpr is a number such as `1.5`.
+type graphiteNumberExpr struct {
+	n float64
+
+	// s is the original string representation of n.
+	s string
+}
+
+func (ne *graphiteNumberExpr) String() string {
+	return ne.s
+}
+
+// parseGraphiteExpr parses Graphite target expression s.
+func parseGraphiteExpr(s string) (graphiteExpr, error) {
+	expr, tail, err := parseGraphiteExprInternal(s)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %q: %w", s, err)
+	}
+	if tail = strings.TrimSpace(tail); len(tail) > 0 {
+		return nil, fmt.Errorf("cannot parse %q: unexpected tail %q", s, tail)
+	}
+	return expr, nil
+}
+
+func parseGraphiteExprInternal(s string) (graphiteExpr, string, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return nil, s, fmt.Errorf("missing expression")
+	}
+	if s[0] == '\'' || s[0] == '"' {
+		n := strings.IndexByte(s[1:], s[0])
+		if n < 0 {
+			return nil, s, fmt.Errorf("missing closing quote in %s", s)
+		}
+		return &graphiteStringExpr{
+			s: s[1 : n+1],
+		}, s[n+2:], nil
+	}
+
+	// Read the token until the end of the expression. Commas inside curly braces belong to path expression, e.g. `foo.{bar,baz}`.
+	braces := 0
+	n := 0
+	for n < len(s) {
+		c := s[n]
+		if c == '{' {
+			braces++
+		} else if c == '}' && braces > 0 {
+			braces--
+		} else if braces == 0 && (c == '(' || c == ')' || c == ',' || c == ' ') {
+			break
+		}
+		n++
+	}
+	token := s[:n]
+	tail := strings.TrimSpace(s[n:])
+	if len(token) == 0 {
+		return nil, s, fmt.Errorf("unexpected token at %q", s)
+	}
+	if !strings.HasPrefix(tail, "(") {
+		if f, err := strconv.ParseFloat(token, 64); err == nil {
+			return &graphiteNumberExpr{
+				n: f,
+				s: token,
+			}, tail, nil
+		}
+		return &graphitePathExpr{
+			path: token,
+		}, tail, nil
+	}
+
+	// Parse function call
+	fe := &graphiteFuncExpr{
+		name: token,
+	}
+	tail = strings.TrimSpace(tail[1:])
+	if strings.HasPrefix(tail, ")") {
+		return fe, tail[1:], nil
+	}
+	for {
+		arg, tailLocal, err := parseGraphiteExprInternal(tail)
+		if err != nil {
+			return nil, tail, fmt.Errorf("cannot parse arg #%d for %s(): %w", len(fe.args)+1, fe.name, err)
+		}
+		fe.args = append(fe.args, arg)
+		tail = strings.TrimSpace(tailLocal)
+		if strings.HasPrefix(tail, ")") {
+			return fe, tail[1:], nil
+		}
+		if !strings.HasPrefix(tail, ",") {
+			return nil, tail, fmt.Errorf("missing `,` or `)` after arg #%d for %s()", len(fe.args), fe.name)
+		}
+		tail = tail[1:]
+	}
+}
+
+// graphiteNameLabel is a temporary label for preserving Graphite series name across MetricsQL binary operations.
+const graphiteNameLabel = "__graphite_name__"
+
+// graphiteSeriesLabel is a hidden label, which keeps series distinct after they are renamed to the same name with alias().
+const graphiteSeriesLabel = "__graphite_series__"
+
+// translateGraphiteExpr translates Graphite expression to MetricsQL query.
+//
+// Every time series returned by the query has Graphite-compatible series name in `__name__` label.
+// step is the interval in milliseconds between points in the response. It is used for translating windows in points to durations.
+func translateGraphiteExpr(expr graphiteExpr, step int64) (string, error) {
+	switch t := expr.(type) {
+	case *graphitePathExpr:
+		return fmt.Sprintf("{__graphite__=%s}", strconv.Quote(t.path)), nil
+	case *graphiteFuncExpr:
+		return translateGraphiteFunc(t, step)
+	default:
+		return "", fmt.Errorf("expecting series list; got %s", expr)
+	}
+}
+
+func translateGraphiteFunc(fe *graphiteFuncExpr, step int64) (string, error) {
+	switch fe.name {
+	case "alias":
+		// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.alias
+		if len(fe.args) != 2 {
+			return "", fmt.Errorf("alias() expects 2 args; got %d args", len(fe.args))
+		}
+		q, err := translateGraphiteExpr(fe.args[0], step)
+		if err != nil {
+			return "", err
+		}
+		se, ok := fe.args[1].(*graphiteStringExpr)
+		if !ok {
+			return "", fmt.Errorf("alias() expects string as the second arg; got %s", fe.args[1])
+		}
+		// Series matching wildcards get the same name after alias(), so preserve the original series name in a hidden label.
+		// This keeps such series distinct. The hidden label isn't returned in the response.
+		q = fmt.Sprintf("label_join(%s, %q, \";\", %q, \"__name__\")", q, graphiteSeriesLabel, graphiteSeriesLabel)
+		return fmt.Sprintf("label_set(%s, \"__name__\", %s)", q, strconv.Quote(se.s)), nil
+	case "sumSeries", "sum":
+		// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.sumSeries
+		if len(fe.args) == 0 {
+			return "", fmt.Errorf("%s() expects at least one arg", fe.name)
+		}
+		qs := make([]string, len(fe.args))
+		for i, arg := range fe.args {
+			q, err := translateGraphiteExpr(arg, step)
+			if err != nil {
+				return "", err
+			}
+			qs[i] = q
+		}
+		q := qs[0]
+		if len(qs) > 1 {
+			q = "union(" + strings.Join(qs, ", ") + ")"
+		}
+		return fmt.Sprintf("label_set(sum(%s), \"__name__\", %s)", q, strconv.Quote(fe.String())), nil
+	case "scale":
+		// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.scale
+		if len(fe.args) != 2 {
+			return "", fmt.Errorf("scale() expects 2 args; got %d args", len(fe.args))
+		}
+		q, err := translateGraphiteExpr(fe.args[0], step)
+		if err != nil {
+			return "", err
+		}
+		ne, ok := fe.args[1].(*graphiteNumberExpr)
+		if !ok {
+			return "", fmt.Errorf("scale() expects number as the second arg; got %s", fe.args[1])
+		}
+		// Binary operations drop metric names, so store the series name in a temporary label and restore it after the operation.
+		q = renameGraphiteSeries(q, graphiteNameLabel, "scale(${1},"+strconv.FormatFloat(ne.n, 'g', -1, 64)+")")
+		return fmt.Sprintf("label_move((%s) * %s, %q, \"__name__\")", q, strconv.FormatFloat(ne.n, 'g', -1, 64), graphiteNameLabel), nil
+	case "movingAverage":
+		// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.movingAverage
+		if len(fe.args) != 2 {
+			return "", fmt.Errorf("movingAverage() expects 2 args; got %d args", len(fe.args))
+		}
+		q, err := translateGraphiteExpr(fe.args[0], step)
+		if err != nil {
+			return "", err
+		}
+		var window int64
+		switch t := fe.args[1].(type) {
+		case *graphiteNumberExpr:
+			// The window is set in points.
+			if t.n <= 0 {
+				return "", fmt.Errorf("movingAverage() window must be positive; got %s", t.s)
+			}
+			window = int64(t.n) * step
+		case *graphiteStringExpr:
+			d, err := parseGraphiteInterval(t.s)
+			if err != nil {
+				return "", fmt.Errorf("cannot parse movingAverage() window: %w", err)
+			}
+			window = d.Milliseconds()
+		default:
+			return "", fmt.Errorf("movingAverage() expects number or string as the second arg; got %s", fe.args[1])
+		}
+		if window <= 0 {
+			return "", fmt.Errorf("movingAverage() window must be positive; got %s", fe.args[1])
+		}
+		if _, ok := fe.args[0].(*graphitePathExpr); ok {
+			q = fmt.Sprintf("avg_over_time(%s[%dms]) keep_metric_names", q, window)
+		} else {
+			q = fmt.Sprintf("avg_over_time((%s)[%dms:%dms]) keep_metric_names", q, window, step)
+		}
+		return renameGraphiteSeries(q, "__name__", fmt.Sprintf("movingAverage(${1},%s)", fe.args[1])), nil
+	default:
+		return "", fmt.Errorf("unsupported function %s(); supported functions: alias, movingAverage, scale, sumSeries", fe.name)
+	}
+}
+
+// renameGraphiteSeries returns MetricsQL query, which puts to dstLabel the series name from q formatted according to the given template.
+//
+// The `${1}` in the template is substituted with the original series name.
+func renameGraphiteSeries(q, dstLabel, template string) string {
+	return fmt.Sprintf(`label_replace(%s, %q, %s, "__name__", "(.*)")`, q, dstLabel, strconv.Quote(template))
+}
+
+// parseGraphiteInterval parses Graphite interval such as `5min` or `-1h`.
+//
+// See https://graphite.readthedocs.io/en/stable/render_api.html#from-until
+func parseGraphiteInterval(s string) (time.Duration, error) {
+	sOrig := s
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+		s = s[1:]
+	} else if strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("missing number in interval %q", sOrig)
+	}
+	v, err := strconv.Atoi(s[:n])
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse number in interval %q: %w", sOrig, err)
+	}
+	var unit time.Duration
+	switch s[n:] {
+	case "s", "sec", "secs", "second", "seconds":
+		unit = time.Second
+	case "min", "mins", "minute", "minutes":
+		unit = time.Minute
+	case "h", "hour", "hours":
+		unit = time.Hour
+	case "d", "day", "days":
+		unit = 24 * time.Hour
+	case "w", "week", "weeks":
+		unit = 7 * 24 * time.Hour
+	case "mon", "month", "months":
+		unit = 30 * 24 * time.Hour
+	case "y", "year", "years":
+		unit = 365 * 24 * time.Hour
+	default:
+		return 0, fmt.Errorf("unsupported unit in interval %q; supported units: s, min, h, d, w, mon, y", sOrig)
+	}
+	return sign * time.Duration(v) * unit, nil
+}
@@ -482,6 +482,7 @@ func getSearchQueryForExprs(startTime time.Time, etfs [][]storage.TagFilter, exp
 	ct := startTime.UnixNano() / 1e6
 	tfss := joinTagFilterss(tfs, etfs)
 	sq := storage.NewSearchQuery(0, ct, tfss, maxMetrics)
+	sq.EnforcedTagFilterss = etfs
 	return sq, nil
 }
 
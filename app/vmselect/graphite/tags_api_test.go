@@ -0,0 +1,193 @@
+package graphite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+func TestParseFilterExpr(t *testing.T) {
+	f := func(expr, resultExpected string) {
+		t.Helper()
+		tf, err := parseFilterExpr(expr)
+		if err != nil {
+			t.Fatalf("unexpected error in parseFilterExpr(%q): %s", expr, err)
+		}
+		result := tf.String()
+		if result != resultExpected {
+			t.Fatalf("unexpected tag filter for %q; got %s; want %s", expr, result, resultExpected)
+		}
+	}
+	f("name=foo.bar", `__name__="foo.bar"`)
+	f("name!=foo", `__name__!="foo"`)
+	f("dc=east", `dc="east"`)
+	f("dc=", `dc=""`)
+	f("dc!=east", `dc!="east"`)
+	f("dc=~ea.+", `dc=~"^(?:ea.+).*"`)
+	f("dc!=~ea.+", `dc!~"^(?:ea.+).*"`)
+
+	// Missing tag value
+	if _, err := parseFilterExpr("foo"); err == nil {
+		t.Fatalf("expecting non-nil error for filter expression without tag value")
+	}
+}
+
+func TestTagsAPI(t *testing.T) {
+	dataPath := "TestTagsAPI"
+	defer fs.MustRemoveAll(dataPath)
+	prevDataPath := *vmstorage.DataPath
+	*vmstorage.DataPath = dataPath
+	defer func() {
+		*vmstorage.DataPath = prevDataPath
+	}()
+	netstorage.InitTmpBlocksDir(dataPath)
+	vmstorage.InitWithoutMetrics(func(mrs []storage.MetricRow) {})
+	defer vmstorage.Stop()
+
+	// Register series via /tags/tagMultiSeries in the same way as Graphite tooling does.
+	paths := []string{
+		"disk.used;rack=a1;datacenter=dc1;server=web01",
+		"disk.used;datacenter=dc1;rack=b1;server=web02",
+		"disk.free;datacenter=dc2;server=db01",
+		"cpu.load;server=web01;datacenter=dc1",
+	}
+	args := url.Values{
+		"path": paths,
+	}
+	response := doTagsRequest(t, TagsTagMultiSeriesHandler, args)
+	responseExpected := `["disk.used;datacenter=dc1;rack=a1;server=web01","disk.used;datacenter=dc1;rack=b1;server=web02",` +
+		`"disk.free;datacenter=dc2;server=db01","cpu.load;datacenter=dc1;server=web01"]`
+	if response != responseExpected {
+		t.Fatalf("unexpected response for /tags/tagMultiSeries\ngot\n%s\nwant\n%s", response, responseExpected)
+	}
+	vmstorage.Storage.DebugFlush()
+
+	t.Run("findSeries", func(t *testing.T) {
+		f := func(args url.Values, responseExpected string) {
+			t.Helper()
+			response := doTagsRequest(t, TagsFindSeriesHandler, args)
+			if response != responseExpected {
+				t.Fatalf("unexpected response for /tags/findSeries?%s\ngot\n%s\nwant\n%s", args.Encode(), response, responseExpected)
+			}
+		}
+		f(url.Values{
+			"expr": {"datacenter=dc1"},
+		}, `["cpu.load;datacenter=dc1;server=web01","disk.used;datacenter=dc1;rack=a1;server=web01","disk.used;datacenter=dc1;rack=b1;server=web02"]`)
+		f(url.Values{
+			"expr": {"name=disk.used", "server!=web02"},
+		}, `["disk.used;datacenter=dc1;rack=a1;server=web01"]`)
+		f(url.Values{
+			"expr": {"server=~web"},
+		}, `["cpu.load;datacenter=dc1;server=web01","disk.used;datacenter=dc1;rack=a1;server=web01","disk.used;datacenter=dc1;rack=b1;server=web02"]`)
+		f(url.Values{
+			"expr": {"name=~disk", "datacenter!=~dc1"},
+		}, `["disk.free;datacenter=dc2;server=db01"]`)
+		f(url.Values{
+			"expr": {"name=~disk", "rack="},
+		}, `["disk.free;datacenter=dc2;server=db01"]`)
+		f(url.Values{
+			"expr":  {"datacenter=~dc"},
+			"limit": {"2"},
+		}, `["cpu.load;datacenter=dc1;server=web01","disk.free;datacenter=dc2;server=db01"]`)
+		f(url.Values{
+			"expr": {"datacenter=dc3"},
+		}, `[]`)
+
+		// Missing expr
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/tags/findSeries", nil)
+		if err := TagsFindSeriesHandler(time.Now(), w, r); err == nil {
+			t.Fatalf("expecting non-nil error for /tags/findSeries without expr")
+		}
+	})
+
+	t.Run("autoCompleteTags", func(t *testing.T) {
+		f := func(args url.Values, responseExpected string) {
+			t.Helper()
+			response := doTagsRequest(t, TagsAutoCompleteTagsHandler, args)
+			if response != responseExpected {
+				t.Fatalf("unexpected response for /tags/autoComplete/tags?%s\ngot\n%s\nwant\n%s", args.Encode(), response, responseExpected)
+			}
+		}
+		f(nil, `["datacenter","name","rack","server"]`)
+		f(url.Values{
+			"tagPrefix": {"r"},
+		}, `["rack"]`)
+		f(url.Values{
+			"limit": {"2"},
+		}, `["datacenter","name"]`)
+		f(url.Values{
+			"expr": {"name=disk.free"},
+		}, `["datacenter","name","server"]`)
+		f(url.Values{
+			"expr":      {"name=~disk"},
+			"tagPrefix": {"s"},
+		}, `["server"]`)
+		f(url.Values{
+			"tagPrefix": {"da"},
+			"jsonp":     {"cb"},
+		}, `cb(["datacenter"])`)
+	})
+
+	t.Run("autoCompleteValues", func(t *testing.T) {
+		f := func(args url.Values, responseExpected string) {
+			t.Helper()
+			response := doTagsRequest(t, TagsAutoCompleteValuesHandler, args)
+			if response != responseExpected {
+				t.Fatalf("unexpected response for /tags/autoComplete/values?%s\ngot\n%s\nwant\n%s", args.Encode(), response, responseExpected)
+			}
+		}
+		f(url.Values{
+			"tag": {"server"},
+		}, `["db01","web01","web02"]`)
+		f(url.Values{
+			"tag":         {"server"},
+			"valuePrefix": {"web"},
+		}, `["web01","web02"]`)
+		f(url.Values{
+			"tag":   {"server"},
+			"limit": {"1"},
+		}, `["db01"]`)
+		f(url.Values{
+			"tag": {"name"},
+		}, `["cpu.load","disk.free","disk.used"]`)
+		f(url.Values{
+			"tag":         {"name"},
+			"valuePrefix": {"disk."},
+		}, `["disk.free","disk.used"]`)
+		f(url.Values{
+			"tag":  {"server"},
+			"expr": {"name=disk.used"},
+		}, `["web01","web02"]`)
+		f(url.Values{
+			"tag":         {"name"},
+			"expr":        {"server=web01"},
+			"valuePrefix": {"cpu"},
+		}, `["cpu.load"]`)
+
+		// Missing tag
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/tags/autoComplete/values", nil)
+		if err := TagsAutoCompleteValuesHandler(time.Now(), w, r); err == nil {
+			t.Fatalf("expecting non-nil error for /tags/autoComplete/values without tag")
+		}
+	})
+}
+
+func doTagsRequest(t *testing.T, handler func(startTime time.Time, w http.ResponseWriter, r *http.Request) error, args url.Values) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/?"+args.Encode(), nil)
+	if err := handler(time.Now(), w, r); err != nil {
+		t.Fatalf("unexpected error for %q: %s", args.Encode(), err)
+	}
+	return strings.TrimSpace(w.Body.String())
+}
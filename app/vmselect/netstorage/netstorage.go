@@ -6,6 +6,7 @@ import (
 	"flag"
 	"fmt"
 	"regexp"
+	"regexp/syntax"
 	"sort"
 	"sync"
 	"sync/atomic"
@@ -29,6 +30,10 @@ var (
 	maxTagValueSuffixesPerSearch = flag.Int("search.maxTagValueSuffixesPerSearch", 100e3, "The maximum number of tag value suffixes returned from /metrics/find")
 	maxSamplesPerSeries          = flag.Int("search.maxSamplesPerSeries", 30e6, "The maximum number of raw samples a single query can scan per each time series. This option allows limiting memory usage")
 	maxSamplesPerQuery           = flag.Int("search.maxSamplesPerQuery", 1e9, "The maximum number of raw samples a single query can process across all time series. This protects from heavy queries, which select unexpectedly high number of raw samples. See also -search.maxSamplesPerSeries")
+	maxRegexpLen                 = flag.Int("search.maxRegexpLen", 16*1024, "The maximum length in bytes of regular expressions in label filters such as {label=~\"regexp\"}. Zero disables the limit. See also -search.maxRegexpComplexity")
+	maxRegexpComplexity          = flag.Int("search.maxRegexpComplexity", 100e3, "The maximum complexity of regular expressions in label filters such as {label=~\"regexp\"}. "+
+		"The complexity is measured as the number of instructions in the compiled regular expression. Queries with too complex regular expressions are rejected, "+
+		"since they may result in high CPU usage when matching label values. Zero disables the limit. See also -search.maxRegexpLen")
 )
 
 // Result is a single timeseries result.
@@ -261,6 +266,96 @@ func (rss *Results) RunParallel(qt *querytracer.Tracer, f func(rs *Result, worke
 	return firstErr
 }
 
+// Iterator returns an iterator over results from rss.
+//
+// Unlike RunParallel, the iterator unpacks results lazily one by one in the caller goroutine,
+// so only a single time series is held in memory at any given time.
+// This is useful for processing big number of time series in a streaming manner.
+//
+// rss becomes unusable after the call to Iterator. The returned iterator must be closed via MustClose after the use.
+func (rss *Results) Iterator(qt *querytracer.Tracer) *ResultsIterator {
+	return &ResultsIterator{
+		qt:  qt.NewChild(),
+		rss: rss,
+	}
+}
+
+// ResultsIterator iterates over results from Results.
+//
+// See Results.Iterator for details.
+type ResultsIterator struct {
+	qt  *querytracer.Tracer
+	rss *Results
+	r   Result
+	err error
+
+	// idx is the index of the next packedTimeseries to unpack.
+	idx int
+
+	seriesProcessed int
+	rowsProcessed   int
+}
+
+// Next unpacks the next time series, which can be obtained via Result.
+//
+// It returns false when there are no more results or when an error occurs.
+// Call Error in order to check for the error after Next returns false.
+func (rsi *ResultsIterator) Next() bool {
+	if rsi.err != nil || rsi.rss == nil {
+		return false
+	}
+	rss := rsi.rss
+	for rsi.idx < len(rss.packedTimeseries) {
+		if rss.deadline.Exceeded() {
+			rsi.err = fmt.Errorf("timeout exceeded during query execution: %s", rss.deadline.String())
+			return false
+		}
+		pts := &rss.packedTimeseries[rsi.idx]
+		rsi.idx++
+		if err := pts.Unpack(&rsi.r, rss.tbf, rss.tr, rss.fetchData); err != nil {
+			rsi.err = fmt.Errorf("error during time series unpacking: %w", err)
+			return false
+		}
+		// Release the memory occupied by the unpacked time series.
+		*pts = packedTimeseries{}
+		rsi.seriesProcessed++
+		rsi.rowsProcessed += len(rsi.r.Values)
+		if len(rsi.r.Timestamps) > 0 || !rss.fetchData {
+			return true
+		}
+	}
+	return false
+}
+
+// Result returns the current time series.
+//
+// The returned result is valid until the next call to Next or MustClose.
+func (rsi *ResultsIterator) Result() *Result {
+	return &rsi.r
+}
+
+// Error returns the error occurred during the iteration.
+func (rsi *ResultsIterator) Error() error {
+	return rsi.err
+}
+
+// MustClose releases resources occupied by rsi.
+//
+// rsi becomes unusable after the call to MustClose.
+func (rsi *ResultsIterator) MustClose() {
+	if rsi.rss == nil {
+		return
+	}
+	rsi.rss.packedTimeseries = rsi.rss.packedTimeseries[:0]
+	rsi.rss.mustClose()
+	rsi.rss = nil
+	rsi.r = Result{}
+
+	perQueryRowsProcessed.Update(float64(rsi.rowsProcessed))
+	perQuerySeriesProcessed.Update(float64(rsi.seriesProcessed))
+	rsi.qt.Donef("iterate over fetched data: series=%d, samples=%d", rsi.seriesProcessed, rsi.rowsProcessed)
+}
+
 var perQueryRowsProcessed = metrics.NewHistogram(`vm_per_query_rows_processed_count`)
 var perQuerySeriesProcessed = metrics.NewHistogram(`vm_per_query_series_processed_count`)
 
@@ -925,6 +1020,10 @@ func ExportBlocks(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline sear
 	if err != nil {
 		return err
 	}
+	tc, err := newTenantChecker(sq)
+	if err != nil {
+		return err
+	}
 
 	vmstorage.WG.Add(1)
 	defer vmstorage.WG.Done()
@@ -966,6 +1065,7 @@ func ExportBlocks(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline sear
 	// Feed workers with work
 	blocksRead := 0
 	samples := 0
+	var errTenant error
 	for sr.NextMetricBlock() {
 		blocksRead++
 		if deadline.Exceeded() {
@@ -978,6 +1078,13 @@ func ExportBlocks(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline sear
 		if err := xw.mn.Unmarshal(sr.MetricBlockRef.MetricName); err != nil {
 			return fmt.Errorf("cannot unmarshal metricName for block #%d: %w", blocksRead, err)
 		}
+		if err := tc.check(&xw.mn); err != nil {
+			// Stop the workers before returning the error.
+			errTenant = err
+			xw.reset()
+			exportWorkPool.Put(xw)
+			break
+		}
 		br := sr.MetricBlockRef.BlockRef
 		br.MustReadBlock(&xw.b, true)
 		samples += br.RowsCount()
@@ -988,6 +1095,9 @@ func ExportBlocks(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline sear
 	// Wait for workers to finish.
 	wg.Wait()
 	qt.Printf("export blocks=%d, samples=%d", blocksRead, samples)
+	if errTenant != nil {
+		return errTenant
+	}
 
 	// Check errors.
 	err = sr.Error()
@@ -1040,13 +1150,92 @@ func SearchMetricNames(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline
 		return nil, err
 	}
 
+	tc, err := newTenantChecker(sq)
+	if err != nil {
+		return nil, err
+	}
+
 	mns, err := vmstorage.SearchMetricNames(qt, tfss, tr, sq.MaxMetrics, deadline.Deadline())
 	if err != nil {
 		return nil, fmt.Errorf("cannot find metric names: %w", err)
 	}
+	for i := range mns {
+		if err := tc.check(&mns[i]); err != nil {
+			return nil, err
+		}
+	}
 	return mns, nil
 }
 
+// SearchLastValues returns the last ingested values for series matching sq from the cache for the last values.
+//
+// false is returned if the last value for at least a single series matching sq
+// isn't cached on the [minTimestamp ... sq.MaxTimestamp] time range. The caller must use ProcessSearchQuery in this case.
+func SearchLastValues(qt *querytracer.Tracer, sq *storage.SearchQuery, minTimestamp int64, deadline searchutils.Deadline) ([]storage.LastValue, bool, error) {
+	qt = qt.NewChild()
+	defer qt.Donef("fetch the last values: %s", sq)
+	if deadline.Exceeded() {
+		return nil, false, fmt.Errorf("timeout exceeded before starting to search the last values: %s", deadline.String())
+	}
+
+	// Setup search.
+	tr := storage.TimeRange{
+		MinTimestamp: sq.MinTimestamp,
+		MaxTimestamp: sq.MaxTimestamp,
+	}
+	if err := vmstorage.CheckTimeRange(tr); err != nil {
+		return nil, false, err
+	}
+	tfss, err := setupTfss(tr, sq.TagFilterss, sq.MaxMetrics, deadline)
+	if err != nil {
+		return nil, false, err
+	}
+
+	tc, err := newTenantChecker(sq)
+	if err != nil {
+		return nil, false, err
+	}
+
+	lvs, ok, err := vmstorage.SearchLastValues(qt, tfss, tr, minTimestamp, sq.MaxMetrics, deadline.Deadline())
+	if err != nil {
+		return nil, false, fmt.Errorf("cannot find the last values: %w", err)
+	}
+	for i := range lvs {
+		if err := tc.check(&lvs[i].MetricName); err != nil {
+			return nil, false, err
+		}
+	}
+	return lvs, ok, nil
+}
+
+// SearchExemplars returns exemplars for series matching sq on the time range from sq.
+func SearchExemplars(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline searchutils.Deadline) ([]storage.SeriesExemplars, error) {
+	qt = qt.NewChild()
+	defer qt.Donef("fetch exemplars: %s", sq)
+	mns, err := SearchMetricNames(qt, sq, deadline)
+	if err != nil {
+		return nil, err
+	}
+	tr := storage.TimeRange{
+		MinTimestamp: sq.MinTimestamp,
+		MaxTimestamp: sq.MaxTimestamp,
+	}
+	ses := vmstorage.SearchExemplars(mns, tr)
+	qt.Printf("found exemplars for %d out of %d series", len(ses), len(mns))
+	return ses, nil
+}
+
+// SearchMetadata returns up to limit metadata entries for the given metric.
+//
+// Metadata for all the metrics is returned if metric is empty.
+func SearchMetadata(qt *querytracer.Tracer, metric string, limit int) []storage.MetricMetadata {
+	qt = qt.NewChild()
+	defer qt.Donef("fetch metadata: metric=%q, limit=%d", metric, limit)
+	mds := vmstorage.SearchMetadata(metric, limit)
+	qt.Printf("found metadata for %d metrics", len(mds))
+	return mds
+}
+
 // ProcessSearchQuery performs sq until the given deadline.
 //
 // Results.RunParallel or Results.Cancel must be called on the returned Results.
@@ -1069,6 +1258,10 @@ func ProcessSearchQuery(qt *querytracer.Tracer, sq *storage.SearchQuery, fetchDa
 	if err != nil {
 		return nil, err
 	}
+	tc, err := newTenantChecker(sq)
+	if err != nil {
+		return nil, err
+	}
 
 	vmstorage.WG.Add(1)
 	defer vmstorage.WG.Done()
@@ -1113,6 +1306,11 @@ func ProcessSearchQuery(qt *querytracer.Tracer, sq *storage.SearchQuery, fetchDa
 		if len(brs) > 1 {
 			m[string(metricName)] = brs
 		} else {
+			if err := tc.checkMetricNameRaw(metricName); err != nil {
+				putTmpBlocksFile(tbf)
+				putStorageSearch(sr)
+				return nil, err
+			}
 			// An optimization for big number of time series with long metricName values:
 			// use only a single copy of metricName for both orderedMetricNames and m.
 			orderedMetricNames = append(orderedMetricNames, string(metricName))
@@ -1177,6 +1375,11 @@ func setupTfss(tr storage.TimeRange, tagFilterss [][]storage.TagFilter, maxMetri
 				tfs.AddGraphiteQuery(query, paths, tf.IsNegative)
 				continue
 			}
+			if tf.IsRegexp {
+				if err := checkRegexpLimits(tf.Value); err != nil {
+					return nil, fmt.Errorf("cannot use tag filter %s: %w", tf, err)
+				}
+			}
 			if err := tfs.Add(tf.Key, tf.Value, tf.IsNegative, tf.IsRegexp); err != nil {
 				return nil, fmt.Errorf("cannot parse tag filter %s: %w", tf, err)
 			}
@@ -1186,6 +1389,46 @@ func setupTfss(tr storage.TimeRange, tagFilterss [][]storage.TagFilter, maxMetri
 	return tfss, nil
 }
 
+// checkRegexpLimits verifies whether the given regexp from tag filter fits -search.maxRegexpLen and -search.maxRegexpComplexity limits.
+func checkRegexpLimits(expr []byte) error {
+	if n := *maxRegexpLen; n > 0 && len(expr) > n {
+		regexpsRejectedByLimits.Inc()
+		return fmt.Errorf("too long regexp; got %d bytes; mustn't exceed -search.maxRegexpLen=%d bytes", len(expr), n)
+	}
+	maxComplexity := *maxRegexpComplexity
+	if maxComplexity <= 0 {
+		return nil
+	}
+	complexity, err := getRegexpComplexity(string(expr))
+	if err != nil {
+		return err
+	}
+	if complexity > maxComplexity {
+		regexpsRejectedByLimits.Inc()
+		return fmt.Errorf("too complex regexp; its complexity is %d; mustn't exceed -search.maxRegexpComplexity=%d; "+
+			"simplify the regexp or increase -search.maxRegexpComplexity", complexity, maxComplexity)
+	}
+	return nil
+}
+
+// getRegexpComplexity returns the complexity for the given regexp.
+//
+// The complexity is the number of instructions in the compiled RE2 program for the regexp.
+// RE2 matches regexps in linear time, so the matching cost is proportional to the complexity multiplied by the length of the input string.
+func getRegexpComplexity(expr string) (int, error) {
+	sre, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return 0, fmt.Errorf("invalid regexp %q: %w", expr, err)
+	}
+	prog, err := syntax.Compile(sre.Simplify())
+	if err != nil {
+		return 0, fmt.Errorf("cannot compile regexp %q: %w", expr, err)
+	}
+	return len(prog.Inst), nil
+}
+
+var regexpsRejectedByLimits = metrics.NewCounter(`vm_search_rejected_regexps_total`)
+
 func applyGraphiteRegexpFilter(filter string, ss []string) ([]string, error) {
 	// Anchor filter regexp to the beginning of the string as Graphite does.
 	// See https://github.com/graphite-project/graphite-web/blob/3ad279df5cb90b211953e39161df416e54a84948/webapp/graphite/tags/localdatabase.py#L157
@@ -0,0 +1,180 @@
+package netstorage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+func TestResultsIterator(t *testing.T) {
+	const seriesCount = 10000
+	const samplesPerSeries = 10
+
+	dataPath := "TestResultsIterator"
+	defer fs.MustRemoveAll(dataPath)
+	prevDataPath := *vmstorage.DataPath
+	*vmstorage.DataPath = dataPath
+	defer func() {
+		*vmstorage.DataPath = prevDataPath
+	}()
+	InitTmpBlocksDir(dataPath)
+	vmstorage.InitWithoutMetrics(func(mrs []storage.MetricRow) {})
+	defer vmstorage.Stop()
+
+	endTimestamp := time.Now().UnixNano() / 1e6
+	startTimestamp := endTimestamp - samplesPerSeries*1000
+	var mrs []storage.MetricRow
+	for i := 0; i < seriesCount; i++ {
+		metricNameRaw := storage.MarshalMetricNameRaw(nil, []prompb.Label{
+			{Name: []byte("__name__"), Value: []byte("foo")},
+			{Name: []byte("instance"), Value: []byte(fmt.Sprintf("host-%d", i))},
+		})
+		for j := 0; j < samplesPerSeries; j++ {
+			mrs = append(mrs, storage.MetricRow{
+				MetricNameRaw: metricNameRaw,
+				Timestamp:     startTimestamp + int64(j)*1000,
+				Value:         float64(i),
+			})
+		}
+	}
+	if err := vmstorage.AddRows(mrs); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+	vmstorage.Storage.DebugFlush()
+
+	f := func(fetchData bool, limit int) {
+		t.Helper()
+		tfs := [][]storage.TagFilter{{
+			{Key: nil, Value: []byte("foo")},
+		}}
+		sq := storage.NewSearchQuery(startTimestamp, endTimestamp, tfs, 0)
+		deadline := searchutils.NewDeadline(time.Now(), time.Minute, "")
+		rss, err := ProcessSearchQuery(nil, sq, fetchData, deadline)
+		if err != nil {
+			t.Fatalf("unexpected error in ProcessSearchQuery: %s", err)
+		}
+		if n := rss.Len(); n != seriesCount {
+			t.Fatalf("unexpected number of series; got %d; want %d", n, seriesCount)
+		}
+		rsi := rss.Iterator(nil)
+		defer rsi.MustClose()
+		var prev *Result
+		maxCap := 0
+		n := 0
+		instances := make(map[string]bool)
+		for rsi.Next() {
+			rs := rsi.Result()
+			// The iterator must reuse the same Result for all the time series in order to keep memory usage bounded.
+			if prev != nil && prev != rs {
+				t.Fatalf("the iterator must reuse the Result")
+			}
+			prev = rs
+			if string(rs.MetricName.MetricGroup) != "foo" {
+				t.Fatalf("unexpected metric name: %s", rs.MetricName.String())
+			}
+			instance := string(rs.MetricName.GetTagValue("instance"))
+			if instances[instance] {
+				t.Fatalf("duplicate series for instance %q", instance)
+			}
+			instances[instance] = true
+			if fetchData {
+				if len(rs.Values) != samplesPerSeries || len(rs.Timestamps) != samplesPerSeries {
+					t.Fatalf("unexpected number of samples for instance %q; got %d values and %d timestamps; want %d",
+						instance, len(rs.Values), len(rs.Timestamps), samplesPerSeries)
+				}
+			} else if len(rs.Values) != 0 {
+				t.Fatalf("unexpected samples for instance %q when fetchData=false: %v", instance, rs.Values)
+			}
+			if c := cap(rs.Values); c > maxCap {
+				maxCap = c
+			}
+			n++
+			if limit > 0 && n >= limit {
+				break
+			}
+		}
+		if err := rsi.Error(); err != nil {
+			t.Fatalf("unexpected error during iteration: %s", err)
+		}
+		nExpected := seriesCount
+		if limit > 0 {
+			nExpected = limit
+		}
+		if n != nExpected {
+			t.Fatalf("unexpected number of iterated series; got %d; want %d", n, nExpected)
+		}
+		// Memory usage for the unpacked samples mustn't depend on the number of series.
+		if maxCap > 4*samplesPerSeries {
+			t.Fatalf("too big capacity for the unpacked samples: %d; want up to %d", maxCap, 4*samplesPerSeries)
+		}
+	}
+
+	f(true, 0)
+	f(false, 0)
+
+	// Stop iteration in the middle.
+	f(true, 10)
+}
+
+func TestCheckRegexpLimits(t *testing.T) {
+	f := func(expr string, maxLen, maxComplexity int, resultExpected bool) {
+		t.Helper()
+		prevMaxLen := *maxRegexpLen
+		prevMaxComplexity := *maxRegexpComplexity
+		*maxRegexpLen = maxLen
+		*maxRegexpComplexity = maxComplexity
+		defer func() {
+			*maxRegexpLen = prevMaxLen
+			*maxRegexpComplexity = prevMaxComplexity
+		}()
+		err := checkRegexpLimits([]byte(expr))
+		if resultExpected && err != nil {
+			t.Fatalf("unexpected error for regexp %q: %s", expr, err)
+		}
+		if !resultExpected && err == nil {
+			t.Fatalf("expecting non-nil error for regexp %q", expr)
+		}
+	}
+
+	// Simple regexps
+	f("foo.*", 100, 100, true)
+	f("foo|bar|baz", 100, 100, true)
+	f("[a-z]+-[0-9]+", 100, 100, true)
+
+	// Too long regexp
+	f("foo|bar|baz", 10, 100, false)
+	f("foo|bar|baz", 0, 100, true)
+
+	// Expensive regexps with nested repetitions
+	f("(.*a){1000}", 0, 1000, false)
+	f("(.*.*.*.*.*.*.*.*.*.*){100}", 0, 1000, false)
+	f(".{1000}", 0, 1000, false)
+	f(".{1000}", 0, 0, true)
+	f(".{1000}", 0, 2000, true)
+
+	// Invalid regexp
+	f("foo(bar", 100, 100, false)
+}
+
+func TestGetRegexpComplexity(t *testing.T) {
+	f := func(expr string, complexityExpected int) {
+		t.Helper()
+		complexity, err := getRegexpComplexity(expr)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if complexity != complexityExpected {
+			t.Fatalf("unexpected complexity for %q; got %d; want %d", expr, complexity, complexityExpected)
+		}
+	}
+	f("foo", 5)
+	f("foo.*", 7)
+	f("(.*a){20}", 102)
+	f(".{1000}", 1002)
+}
@@ -0,0 +1,119 @@
+package netstorage
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var verifyTenantIsolation = flag.Bool("search.verifyTenantIsolation", false, "Whether to verify that every time series found during index lookups for a query "+
+	"belongs to the tenant enforced via extra_label and extra_filters[] query args. The query fails with an error on cross-tenant access. "+
+	"This option is intended for testing and debugging, since it slows down queries. See https://docs.victoriametrics.com/#prometheus-querying-api-enhancements")
+
+var tenantIsolationViolations = metrics.NewCounter(`vm_tenant_isolation_violations_total`)
+
+// tenantChecker verifies that time series found during index lookups belong to the tenant of the search query.
+type tenantChecker struct {
+	etfs [][]storage.TagFilter
+
+	// res contains compiled regexps for regexp filters from etfs.
+	res map[string]*regexp.Regexp
+}
+
+// newTenantChecker returns tenantChecker for sq.
+//
+// nil is returned if -search.verifyTenantIsolation isn't set or if sq isn't restricted to a tenant.
+func newTenantChecker(sq *storage.SearchQuery) (*tenantChecker, error) {
+	if !*verifyTenantIsolation || len(sq.EnforcedTagFilterss) == 0 {
+		return nil, nil
+	}
+	tc := &tenantChecker{
+		etfs: sq.EnforcedTagFilterss,
+		res:  make(map[string]*regexp.Regexp),
+	}
+	for _, tfs := range tc.etfs {
+		for _, tf := range tfs {
+			if !tf.IsRegexp {
+				continue
+			}
+			expr := string(tf.Value)
+			if _, ok := tc.res[expr]; ok {
+				continue
+			}
+			re, err := regexp.Compile("^(?:" + expr + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse regexp from the enforced tag filter %s: %w", tf.String(), err)
+			}
+			tc.res[expr] = re
+		}
+	}
+	return tc, nil
+}
+
+// check returns an error if mn doesn't belong to the tenant.
+//
+// mn belongs to the tenant if it matches all the filters from at least a single etfs item.
+func (tc *tenantChecker) check(mn *storage.MetricName) error {
+	if tc == nil {
+		return nil
+	}
+	for _, tfs := range tc.etfs {
+		if tc.matchTagFilters(mn, tfs) {
+			return nil
+		}
+	}
+	tenantIsolationViolations.Inc()
+	err := fmt.Errorf("BUG: cross-tenant access: the index lookup returned series %s, which doesn't match the enforced tag filters %s; "+
+		"see -search.verifyTenantIsolation", mn.String(), tagFilterssString(tc.etfs))
+	logger.Errorf("%s", err)
+	return err
+}
+
+func (tc *tenantChecker) matchTagFilters(mn *storage.MetricName, tfs []storage.TagFilter) bool {
+	for i := range tfs {
+		tf := &tfs[i]
+		key := string(tf.Key)
+		if key == "" {
+			key = "__name__"
+		}
+		value := mn.GetTagValue(key)
+		var ok bool
+		if tf.IsRegexp {
+			ok = tc.res[string(tf.Value)].Match(value)
+		} else {
+			ok = string(tf.Value) == string(value)
+		}
+		if ok == tf.IsNegative {
+			return false
+		}
+	}
+	return true
+}
+
+// checkMetricNameRaw is like check, but accepts marshaled metricName.
+func (tc *tenantChecker) checkMetricNameRaw(metricName []byte) error {
+	if tc == nil {
+		return nil
+	}
+	var mn storage.MetricName
+	if err := mn.Unmarshal(metricName); err != nil {
+		return fmt.Errorf("cannot unmarshal metricName %q: %w", metricName, err)
+	}
+	return tc.check(&mn)
+}
+
+func tagFilterssString(tfss [][]storage.TagFilter) string {
+	a := make([]string, len(tfss))
+	for i, tfs := range tfss {
+		b := make([]string, len(tfs))
+		for j := range tfs {
+			b[j] = tfs[j].String()
+		}
+		a[i] = fmt.Sprintf("%s", b)
+	}
+	return fmt.Sprintf("%s", a)
+}
@@ -0,0 +1,182 @@
+package netstorage
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+func TestTenantCheckerCheck(t *testing.T) {
+	f := func(etfs [][]storage.TagFilter, resultExpected bool) {
+		t.Helper()
+		prevVerifyTenantIsolation := *verifyTenantIsolation
+		*verifyTenantIsolation = true
+		defer func() {
+			*verifyTenantIsolation = prevVerifyTenantIsolation
+		}()
+		tc, err := newTenantChecker(&storage.SearchQuery{
+			EnforcedTagFilterss: etfs,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var mn storage.MetricName
+		mn.MetricGroup = []byte("foo")
+		mn.AddTag("tenant", "a")
+		mn.AddTag("team", "x")
+		err = tc.check(&mn)
+		if resultExpected && err != nil {
+			t.Fatalf("unexpected error for %s: %s", tagFilterssString(etfs), err)
+		}
+		if !resultExpected && err == nil {
+			t.Fatalf("expecting non-nil error for %s", tagFilterssString(etfs))
+		}
+	}
+
+	// Missing enforced filters
+	f(nil, true)
+
+	// Matching filters
+	f([][]storage.TagFilter{{
+		{Key: []byte("tenant"), Value: []byte("a")},
+	}}, true)
+	f([][]storage.TagFilter{{
+		{Key: []byte("tenant"), Value: []byte("a")},
+		{Key: []byte("team"), Value: []byte("x|y"), IsRegexp: true},
+		{Key: []byte("env"), Value: []byte("prod"), IsNegative: true},
+		{Key: nil, Value: []byte("foo")},
+	}}, true)
+	f([][]storage.TagFilter{
+		{{Key: []byte("tenant"), Value: []byte("b")}},
+		{{Key: []byte("tenant"), Value: []byte("a")}},
+	}, true)
+
+	// Non-matching filters
+	f([][]storage.TagFilter{{
+		{Key: []byte("tenant"), Value: []byte("b")},
+	}}, false)
+	f([][]storage.TagFilter{{
+		{Key: []byte("tenant"), Value: []byte("a")},
+		{Key: []byte("team"), Value: []byte("x"), IsNegative: true},
+	}}, false)
+	f([][]storage.TagFilter{{
+		// The regexp must match the whole label value.
+		{Key: []byte("tenant"), Value: []byte("a.+"), IsRegexp: true},
+	}}, false)
+	f([][]storage.TagFilter{{
+		{Key: []byte("env"), Value: []byte("prod")},
+	}}, false)
+	f([][]storage.TagFilter{
+		{{Key: []byte("tenant"), Value: []byte("b")}},
+		{{Key: []byte("tenant"), Value: []byte("c")}},
+	}, false)
+}
+
+func TestVerifyTenantIsolation(t *testing.T) {
+	dataPath := "TestVerifyTenantIsolation"
+	defer fs.MustRemoveAll(dataPath)
+	prevDataPath := *vmstorage.DataPath
+	*vmstorage.DataPath = dataPath
+	prevVerifyTenantIsolation := *verifyTenantIsolation
+	*verifyTenantIsolation = true
+	defer func() {
+		*vmstorage.DataPath = prevDataPath
+		*verifyTenantIsolation = prevVerifyTenantIsolation
+	}()
+	InitTmpBlocksDir(dataPath)
+	vmstorage.InitWithoutMetrics(func(mrs []storage.MetricRow) {})
+	defer vmstorage.Stop()
+
+	endTimestamp := time.Now().UnixNano() / 1e6
+	startTimestamp := endTimestamp - 3600*1000
+	var mrs []storage.MetricRow
+	for _, tenant := range []string{"a", "b"} {
+		metricNameRaw := storage.MarshalMetricNameRaw(nil, []prompb.Label{
+			{Name: []byte("__name__"), Value: []byte("foo")},
+			{Name: []byte("tenant"), Value: []byte(tenant)},
+		})
+		mrs = append(mrs, storage.MetricRow{
+			MetricNameRaw: metricNameRaw,
+			Timestamp:     endTimestamp - 1000,
+			Value:         1,
+		})
+	}
+	if err := vmstorage.AddRows(mrs); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+	vmstorage.Storage.DebugFlush()
+
+	// The enforced filters for tenant `a`, which are passed via `extra_label=tenant=a` query arg.
+	etfs := [][]storage.TagFilter{{
+		{Key: []byte("tenant"), Value: []byte("a")},
+	}}
+	deadline := searchutils.NewDeadline(time.Now(), time.Minute, "")
+
+	f := func(tfss [][]storage.TagFilter, seriesExpected int, errExpected bool) {
+		t.Helper()
+		sq := storage.NewSearchQuery(startTimestamp, endTimestamp, tfss, 0)
+		sq.EnforcedTagFilterss = etfs
+		checkErr := func(apiName string, err error) bool {
+			t.Helper()
+			if errExpected {
+				if err == nil {
+					t.Fatalf("expecting non-nil error from %s for cross-tenant query %s", apiName, sq)
+				}
+				if !strings.Contains(err.Error(), "cross-tenant access") {
+					t.Fatalf("unexpected error from %s: %s", apiName, err)
+				}
+				return false
+			}
+			if err != nil {
+				t.Fatalf("unexpected error from %s: %s", apiName, err)
+			}
+			return true
+		}
+
+		rss, err := ProcessSearchQuery(nil, sq, true, deadline)
+		if checkErr("ProcessSearchQuery", err) {
+			if n := rss.Len(); n != seriesExpected {
+				t.Fatalf("unexpected number of series returned from ProcessSearchQuery; got %d; want %d", n, seriesExpected)
+			}
+			rss.Cancel()
+		}
+
+		mns, err := SearchMetricNames(nil, sq, deadline)
+		if checkErr("SearchMetricNames", err) && len(mns) != seriesExpected {
+			t.Fatalf("unexpected number of series returned from SearchMetricNames; got %d; want %d", len(mns), seriesExpected)
+		}
+
+		err = ExportBlocks(nil, sq, deadline, func(mn *storage.MetricName, b *storage.Block, tr storage.TimeRange) error {
+			return nil
+		})
+		checkErr("ExportBlocks", err)
+	}
+
+	// The query properly joined with the enforced filters.
+	f(searchutils.JoinTagFilterss([][]storage.TagFilter{{
+		{Key: nil, Value: []byte("foo")},
+	}}, etfs), 1, false)
+
+	// A crafted query for tenant `b` joined with the enforced filters for tenant `a` doesn't return any series.
+	f(searchutils.JoinTagFilterss([][]storage.TagFilter{{
+		{Key: nil, Value: []byte("foo")},
+		{Key: []byte("tenant"), Value: []byte("b")},
+	}}, etfs), 0, false)
+
+	// A crafted query for tenant `b`, which bypasses the enforced filters for tenant `a`, must be blocked.
+	f([][]storage.TagFilter{{
+		{Key: nil, Value: []byte("foo")},
+		{Key: []byte("tenant"), Value: []byte("b")},
+	}}, 0, true)
+
+	// A query without the enforced filters selects series for all the tenants, so it must be blocked.
+	f([][]storage.TagFilter{{
+		{Key: nil, Value: []byte("foo")},
+	}}, 0, true)
+}
@@ -0,0 +1,121 @@
+package prometheus
+
+import (
+	"flag"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/promql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envtemplate"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/metrics"
+	"gopkg.in/yaml.v2"
+)
+
+var maxUniqueTimeseriesOverridesFile = flag.String("search.maxUniqueTimeseriesOverrides", "", "Optional path to a file with per-tenant overrides for -search.maxUniqueTimeseries . "+
+	"Tenants are identified by label filters enforced via extra_label and extra_filters[] query args. The path can point either to local file or to http url. "+
+	"See https://docs.victoriametrics.com/#per-tenant-limits . The file is reloaded on SIGHUP signal")
+
+// maxUniqueTimeseriesOverride is a per-tenant override for -search.maxUniqueTimeseries.
+type maxUniqueTimeseriesOverride struct {
+	// Tenant contains label filters, which must be enforced for the query in order to apply the override.
+	Tenant map[string]string `yaml:"tenant"`
+
+	// MaxUniqueTimeseries is the maximum number of unique time series the query for the tenant can select.
+	MaxUniqueTimeseries int `yaml:"max_unique_timeseries"`
+}
+
+// InitMaxUniqueTimeseriesOverrides must be called after flag.Parse and before serving queries.
+func InitMaxUniqueTimeseriesOverrides() {
+	if *maxUniqueTimeseriesOverridesFile == "" {
+		return
+	}
+	// Register SIGHUP handler for config re-read just before loadMaxUniqueTimeseriesOverrides call.
+	// This guarantees that the config will be re-read if the signal arrives during loadMaxUniqueTimeseriesOverrides call.
+	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/1240
+	sighupCh := procutil.NewSighupChan()
+
+	mos, err := loadMaxUniqueTimeseriesOverrides(*maxUniqueTimeseriesOverridesFile)
+	if err != nil {
+		logger.Fatalf("cannot load -search.maxUniqueTimeseriesOverrides=%q: %s", *maxUniqueTimeseriesOverridesFile, err)
+	}
+	maxUniqueTimeseriesOverrides.Store(mos)
+	go func() {
+		for range sighupCh {
+			logger.Infof("received SIGHUP; reloading -search.maxUniqueTimeseriesOverrides=%q...", *maxUniqueTimeseriesOverridesFile)
+			mos, err := loadMaxUniqueTimeseriesOverrides(*maxUniqueTimeseriesOverridesFile)
+			if err != nil {
+				logger.Errorf("cannot load the updated -search.maxUniqueTimeseriesOverrides=%q: %s; preserving the previous config", *maxUniqueTimeseriesOverridesFile, err)
+				continue
+			}
+			maxUniqueTimeseriesOverrides.Store(mos)
+			logger.Infof("successfully reloaded -search.maxUniqueTimeseriesOverrides=%q", *maxUniqueTimeseriesOverridesFile)
+		}
+	}()
+}
+
+var maxUniqueTimeseriesOverrides atomic.Value
+
+var maxUniqueTimeseriesOverridesApplied = metrics.NewCounter(`vm_search_max_unique_timeseries_overrides_applied_total`)
+
+func loadMaxUniqueTimeseriesOverrides(path string) ([]maxUniqueTimeseriesOverride, error) {
+	data, err := fs.ReadFileOrHTTP(path)
+	if err != nil {
+		return nil, err
+	}
+	data = envtemplate.Replace(data)
+	return parseMaxUniqueTimeseriesOverrides(data)
+}
+
+func parseMaxUniqueTimeseriesOverrides(data []byte) ([]maxUniqueTimeseriesOverride, error) {
+	var mos []maxUniqueTimeseriesOverride
+	if err := yaml.UnmarshalStrict(data, &mos); err != nil {
+		return nil, fmt.Errorf("cannot parse overrides: %w", err)
+	}
+	for i := range mos {
+		mo := &mos[i]
+		if len(mo.Tenant) == 0 {
+			return nil, fmt.Errorf("missing `tenant` labels in the override #%d", i+1)
+		}
+		if mo.MaxUniqueTimeseries <= 0 {
+			return nil, fmt.Errorf("`max_unique_timeseries` must be positive in the override #%d for tenant %v; got %d", i+1, mo.Tenant, mo.MaxUniqueTimeseries)
+		}
+	}
+	return mos, nil
+}
+
+// GetMaxUniqueTimeseries returns the maximum number of unique time series the query with the given enforced label filters can select.
+//
+// The first override from -search.maxUniqueTimeseriesOverrides, which matches label filters enforced via etfs, is used.
+// The -search.maxUniqueTimeseries value is returned if there are no matching overrides.
+func GetMaxUniqueTimeseries(etfs [][]storage.TagFilter) int {
+	v := maxUniqueTimeseriesOverrides.Load()
+	if v == nil || len(etfs) == 0 {
+		return *maxUniqueTimeseries
+	}
+	mos := v.([]maxUniqueTimeseriesOverride)
+	if len(mos) == 0 {
+		return *maxUniqueTimeseries
+	}
+	enforced := promql.GetEnforcedLabels(etfs)
+	for i := range mos {
+		mo := &mos[i]
+		if matchTenant(mo.Tenant, enforced) {
+			maxUniqueTimeseriesOverridesApplied.Inc()
+			return mo.MaxUniqueTimeseries
+		}
+	}
+	return *maxUniqueTimeseries
+}
+
+func matchTenant(tenant, enforced map[string]string) bool {
+	for name, value := range tenant {
+		if enforcedValue, ok := enforced[name]; !ok || enforcedValue != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,189 @@
+package prometheus
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/promql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+func TestParseMaxUniqueTimeseriesOverridesFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+		if _, err := parseMaxUniqueTimeseriesOverrides([]byte(data)); err == nil {
+			t.Fatalf("expecting non-nil error for %q", data)
+		}
+	}
+	// Invalid yaml
+	f("foo")
+
+	// Unknown field
+	f(`
+- tenant: {team: a}
+  max_unique_timeseries: 10
+  foo: bar
+`)
+
+	// Missing tenant
+	f(`
+- max_unique_timeseries: 10
+`)
+
+	// Missing max_unique_timeseries
+	f(`
+- tenant: {team: a}
+`)
+
+	// Negative max_unique_timeseries
+	f(`
+- tenant: {team: a}
+  max_unique_timeseries: -1
+`)
+}
+
+func TestGetMaxUniqueTimeseries(t *testing.T) {
+	mos, err := parseMaxUniqueTimeseriesOverrides([]byte(`
+- tenant: {team: big}
+  max_unique_timeseries: 1000000
+- tenant: {team: small, env: prod}
+  max_unique_timeseries: 100
+- tenant: {team: small}
+  max_unique_timeseries: 10
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	maxUniqueTimeseriesOverrides.Store(mos)
+	defer maxUniqueTimeseriesOverrides.Store([]maxUniqueTimeseriesOverride(nil))
+
+	f := func(extraArgs string, resultExpected int) {
+		t.Helper()
+		etfs := getTestExtraTagFilters(t, extraArgs)
+		result := GetMaxUniqueTimeseries(etfs)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for %q; got %d; want %d", extraArgs, result, resultExpected)
+		}
+	}
+
+	// No enforced filters
+	f("", *maxUniqueTimeseries)
+
+	// Unknown tenant
+	f("extra_label=team=foo", *maxUniqueTimeseries)
+	f("extra_label=user=big", *maxUniqueTimeseries)
+
+	// Known tenants
+	f("extra_label=team=big", 1000000)
+	f("extra_label=team=small", 10)
+	f("extra_label=team=small&extra_label=env=prod", 100)
+	f("extra_label=team=small&extra_label=env=dev", 10)
+	f(`extra_filters[]={team="big",job="foo"}`, 1000000)
+
+	// Non-exact filters mustn't match tenants
+	f(`extra_filters[]={team=~"big"}`, *maxUniqueTimeseries)
+	f(`extra_filters[]={team="big"}&extra_filters[]={team="small"}`, *maxUniqueTimeseries)
+}
+
+func TestMaxUniqueTimeseriesOverridesEnforcement(t *testing.T) {
+	const seriesPerTenant = 20
+
+	dataPath := "TestMaxUniqueTimeseriesOverridesEnforcement"
+	defer fs.MustRemoveAll(dataPath)
+	prevDataPath := *vmstorage.DataPath
+	*vmstorage.DataPath = dataPath
+	defer func() {
+		*vmstorage.DataPath = prevDataPath
+	}()
+	netstorage.InitTmpBlocksDir(dataPath)
+	vmstorage.InitWithoutMetrics(func(mrs []storage.MetricRow) {})
+	defer vmstorage.Stop()
+
+	timestamp := time.Now().UnixNano() / 1e6
+	var mrs []storage.MetricRow
+	for _, team := range []string{"big", "small"} {
+		for i := 0; i < seriesPerTenant; i++ {
+			mrs = append(mrs, storage.MetricRow{
+				MetricNameRaw: storage.MarshalMetricNameRaw(nil, []prompb.Label{
+					{Name: []byte("__name__"), Value: []byte("foo")},
+					{Name: []byte("team"), Value: []byte(team)},
+					{Name: []byte("instance"), Value: []byte(fmt.Sprintf("host-%d", i))},
+				}),
+				Timestamp: timestamp,
+				Value:     float64(i),
+			})
+		}
+	}
+	if err := vmstorage.AddRows(mrs); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+	vmstorage.Storage.DebugFlush()
+
+	mos, err := parseMaxUniqueTimeseriesOverrides([]byte(`
+- tenant: {team: big}
+  max_unique_timeseries: 100
+- tenant: {team: small}
+  max_unique_timeseries: 10
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	maxUniqueTimeseriesOverrides.Store(mos)
+	defer maxUniqueTimeseriesOverrides.Store([]maxUniqueTimeseriesOverride(nil))
+
+	f := func(extraArgs string, resultExpected bool) {
+		t.Helper()
+		etfs := getTestExtraTagFilters(t, extraArgs)
+		ec := &promql.EvalConfig{
+			Start:               timestamp,
+			End:                 timestamp,
+			Step:                defaultStep,
+			MaxSeries:           GetMaxUniqueTimeseries(etfs),
+			Deadline:            searchutils.NewDeadline(time.Now(), time.Minute, ""),
+			EnforcedTagFilterss: etfs,
+		}
+		result, err := promql.Exec(nil, ec, "foo", true)
+		if !resultExpected {
+			if err == nil {
+				t.Fatalf("expecting non-nil error for %q", extraArgs)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", extraArgs, err)
+		}
+		if len(result) != seriesPerTenant {
+			t.Fatalf("unexpected number of series for %q; got %d; want %d", extraArgs, len(result), seriesPerTenant)
+		}
+	}
+
+	// The big tenant fits its limit.
+	f("extra_label=team=big", true)
+
+	// The small tenant exceeds its limit.
+	f("extra_label=team=small", false)
+}
+
+func getTestExtraTagFilters(t *testing.T, extraArgs string) [][]storage.TagFilter {
+	t.Helper()
+	form, err := url.ParseQuery(extraArgs)
+	if err != nil {
+		t.Fatalf("cannot parse %q: %s", extraArgs, err)
+	}
+	r := &http.Request{
+		Form: form,
+	}
+	etfs, err := searchutils.GetExtraTagFilters(r)
+	if err != nil {
+		t.Fatalf("cannot obtain extra tag filters from %q: %s", extraArgs, err)
+	}
+	return etfs
+}
@@ -0,0 +1,98 @@
+// Code generated by qtc from "metadata_response.qtpl". DO NOT EDIT.
+// See https://github.com/valyala/quicktemplate for details.
+
+//line app/vmselect/prometheus/metadata_response.qtpl:1
+package prometheus
+
+//line app/vmselect/prometheus/metadata_response.qtpl:1
+import (
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+// MetadataResponse generates response for /api/v1/metadata.See https://prometheus.io/docs/prometheus/latest/querying/api/#querying-metric-metadata
+
+//line app/vmselect/prometheus/metadata_response.qtpl:9
+import (
+	qtio422016 "io"
+
+	qt422016 "github.com/valyala/quicktemplate"
+)
+
+//line app/vmselect/prometheus/metadata_response.qtpl:9
+var (
+	_ = qtio422016.Copy
+	_ = qt422016.AcquireByteBuffer
+)
+
+//line app/vmselect/prometheus/metadata_response.qtpl:9
+func StreamMetadataResponse(qw422016 *qt422016.Writer, mds []storage.MetricMetadata, qt *querytracer.Tracer, qtDone func()) {
+//line app/vmselect/prometheus/metadata_response.qtpl:9
+	qw422016.N().S(`{"status":"success","data":{`)
+//line app/vmselect/prometheus/metadata_response.qtpl:13
+	for i := range mds {
+//line app/vmselect/prometheus/metadata_response.qtpl:14
+		md := &mds[i]
+
+//line app/vmselect/prometheus/metadata_response.qtpl:15
+		qw422016.N().Q(md.Metric)
+//line app/vmselect/prometheus/metadata_response.qtpl:15
+		qw422016.N().S(`:[{"type":`)
+//line app/vmselect/prometheus/metadata_response.qtpl:17
+		qw422016.N().Q(md.Type)
+//line app/vmselect/prometheus/metadata_response.qtpl:17
+		qw422016.N().S(`,"help":`)
+//line app/vmselect/prometheus/metadata_response.qtpl:18
+		qw422016.N().Q(md.Help)
+//line app/vmselect/prometheus/metadata_response.qtpl:18
+		qw422016.N().S(`,"unit":`)
+//line app/vmselect/prometheus/metadata_response.qtpl:19
+		qw422016.N().Q(md.Unit)
+//line app/vmselect/prometheus/metadata_response.qtpl:19
+		qw422016.N().S(`}]`)
+//line app/vmselect/prometheus/metadata_response.qtpl:22
+		if i+1 < len(mds) {
+//line app/vmselect/prometheus/metadata_response.qtpl:22
+			qw422016.N().S(`,`)
+//line app/vmselect/prometheus/metadata_response.qtpl:22
+		}
+//line app/vmselect/prometheus/metadata_response.qtpl:23
+	}
+//line app/vmselect/prometheus/metadata_response.qtpl:23
+	qw422016.N().S(`}`)
+//line app/vmselect/prometheus/metadata_response.qtpl:26
+	qt.Printf("generate response for %d metrics", len(mds))
+	qtDone()
+
+//line app/vmselect/prometheus/metadata_response.qtpl:29
+	streamdumpQueryTrace(qw422016, qt)
+//line app/vmselect/prometheus/metadata_response.qtpl:29
+	qw422016.N().S(`}`)
+//line app/vmselect/prometheus/metadata_response.qtpl:31
+}
+
+//line app/vmselect/prometheus/metadata_response.qtpl:31
+func WriteMetadataResponse(qq422016 qtio422016.Writer, mds []storage.MetricMetadata, qt *querytracer.Tracer, qtDone func()) {
+//line app/vmselect/prometheus/metadata_response.qtpl:31
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line app/vmselect/prometheus/metadata_response.qtpl:31
+	StreamMetadataResponse(qw422016, mds, qt, qtDone)
+//line app/vmselect/prometheus/metadata_response.qtpl:31
+	qt422016.ReleaseWriter(qw422016)
+//line app/vmselect/prometheus/metadata_response.qtpl:31
+}
+
+//line app/vmselect/prometheus/metadata_response.qtpl:31
+func MetadataResponse(mds []storage.MetricMetadata, qt *querytracer.Tracer, qtDone func()) string {
+//line app/vmselect/prometheus/metadata_response.qtpl:31
+	qb422016 := qt422016.AcquireByteBuffer()
+//line app/vmselect/prometheus/metadata_response.qtpl:31
+	WriteMetadataResponse(qb422016, mds, qt, qtDone)
+//line app/vmselect/prometheus/metadata_response.qtpl:31
+	qs422016 := string(qb422016.B)
+//line app/vmselect/prometheus/metadata_response.qtpl:31
+	qt422016.ReleaseByteBuffer(qb422016)
+//line app/vmselect/prometheus/metadata_response.qtpl:31
+	return qs422016
+//line app/vmselect/prometheus/metadata_response.qtpl:31
+}
@@ -1,6 +1,7 @@
 package prometheus
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"math"
@@ -22,10 +23,13 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputils"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querylint"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 	"github.com/VictoriaMetrics/metrics"
+	"github.com/VictoriaMetrics/metricsql"
 	"github.com/valyala/fastjson/fastfloat"
 	"github.com/valyala/quicktemplate"
 )
@@ -43,12 +47,23 @@ var (
 		"See also '-search.maxLookback' flag, which has the same meaning due to historical reasons")
 	maxStepForPointsAdjustment = flag.Duration("search.maxStepForPointsAdjustment", time.Minute, "The maximum step when /api/v1/query_range handler adjusts "+
 		"points with timestamps closer than -search.latencyOffset to the current time. The adjustment is needed because such points may contain incomplete data")
+	alignStep = flag.Bool("search.alignStep", false, "Whether to align start and end args for /api/v1/query_range to values divisible by step counted from Unix epoch. "+
+		"This guarantees that points for dashboard panels with distinct steps have the same timestamps where the steps coincide. "+
+		"It can be enabled on per-query basis via align_step=1 query arg. See https://docs.victoriametrics.com/#prometheus-querying-api-enhancements")
+	prometheusExtrapolation = flag.Bool("search.prometheusExtrapolation", false, "Whether to use Prometheus-compatible extrapolation in rate(), increase() and delta() functions. "+
+		"By default these functions take into account the last sample before the lookbehind window and don't extrapolate the results. "+
+		"Prometheus ignores samples outside the lookbehind window and extrapolates the results to window boundaries unless there is a gap between the window boundary and the first or the last sample in the window. "+
+		"It can be enabled on per-query basis via prometheus_extrapolation=1 query arg. See also increase_prometheus() and delta_prometheus() functions")
 
 	maxUniqueTimeseries = flag.Int("search.maxUniqueTimeseries", 300e3, "The maximum number of unique time series, which can be selected during /api/v1/query and /api/v1/query_range queries. This option allows limiting memory usage")
 	maxFederateSeries   = flag.Int("search.maxFederateSeries", 300e3, "The maximum number of time series, which can be returned from /federate. This option allows limiting memory usage")
 	maxExportSeries     = flag.Int("search.maxExportSeries", 1e6, "The maximum number of time series, which can be returned from /api/v1/export* APIs. This option allows limiting memory usage")
 	maxTSDBStatusSeries = flag.Int("search.maxTSDBStatusSeries", 1e6, "The maximum number of time series, which can be processed during the call to /api/v1/status/tsdb. This option allows limiting memory usage")
 	maxSeriesLimit      = flag.Int("search.maxSeries", 10e3, "The maximum number of time series, which can be returned from /api/v1/series. This option allows limiting memory usage")
+
+	labelsDefaultLookback = flag.Duration("search.labelsDefaultLookback", 24*time.Hour, "The default time range for /api/v1/labels and /api/v1/label/.../values "+
+		"requests without start and end query args. Pass full_range=1 query arg in order to search over the whole retention. "+
+		"Set the flag to 0 in order to search over the whole retention by default")
 )
 
 // Default step used if not set.
@@ -69,11 +84,11 @@ func FederateHandler(startTime time.Time, w http.ResponseWriter, r *http.Request
 	if lookbackDelta <= 0 {
 		lookbackDelta = defaultStep
 	}
-	start, err := searchutils.GetTime(r, "start", ct-lookbackDelta)
+	start, err := httputils.GetTime(r, "start", ct-lookbackDelta)
 	if err != nil {
 		return err
 	}
-	end, err := searchutils.GetTime(r, "end", ct)
+	end, err := httputils.GetTime(r, "end", ct)
 	if err != nil {
 		return err
 	}
@@ -81,11 +96,12 @@ func FederateHandler(startTime time.Time, w http.ResponseWriter, r *http.Request
 	if start >= end {
 		start = end - defaultStep
 	}
-	tagFilterss, err := getTagFilterssFromRequest(r)
+	tagFilterss, etfs, err := getTagFilterssFromRequest(r)
 	if err != nil {
 		return err
 	}
 	sq := storage.NewSearchQuery(start, end, tagFilterss, *maxFederateSeries)
+	sq.EnforcedTagFilterss = etfs
 	rss, err := netstorage.ProcessSearchQuery(nil, sq, true, deadline)
 	if err != nil {
 		return fmt.Errorf("cannot fetch data for %q: %w", sq, err)
@@ -127,13 +143,14 @@ func ExportCSVHandler(startTime time.Time, w http.ResponseWriter, r *http.Reques
 		return fmt.Errorf("missing `format` arg; see https://docs.victoriametrics.com/#how-to-export-csv-data")
 	}
 	fieldNames := strings.Split(format, ",")
-	reduceMemUsage := searchutils.GetBool(r, "reduce_mem_usage")
+	reduceMemUsage := httputils.GetBool(r, "reduce_mem_usage")
 	ep, err := getExportParams(r, startTime)
 	if err != nil {
 		return err
 	}
 
 	sq := storage.NewSearchQuery(ep.start, ep.end, ep.filterss, *maxExportSeries)
+	sq.EnforcedTagFilterss = ep.etfs
 	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
 	bw := bufferedwriter.Get(w)
 	defer bufferedwriter.Put(bw)
@@ -222,6 +239,7 @@ func ExportNativeHandler(startTime time.Time, w http.ResponseWriter, r *http.Req
 	}
 
 	sq := storage.NewSearchQuery(ep.start, ep.end, ep.filterss, *maxExportSeries)
+	sq.EnforcedTagFilterss = ep.etfs
 	w.Header().Set("Content-Type", "VictoriaMetrics/native")
 	bw := bufferedwriter.Get(w)
 	defer bufferedwriter.Put(bw)
@@ -287,7 +305,7 @@ func ExportHandler(startTime time.Time, w http.ResponseWriter, r *http.Request)
 	}
 	format := r.FormValue("format")
 	maxRowsPerLine := int(fastfloat.ParseInt64BestEffort(r.FormValue("max_rows_per_line")))
-	reduceMemUsage := searchutils.GetBool(r, "reduce_mem_usage")
+	reduceMemUsage := httputils.GetBool(r, "reduce_mem_usage")
 	if err := exportHandler(nil, w, ep, format, maxRowsPerLine, reduceMemUsage); err != nil {
 		return fmt.Errorf("error when exporting data on the time range (start=%d, end=%d): %w", ep.start, ep.end, err)
 	}
@@ -350,6 +368,7 @@ func exportHandler(qt *querytracer.Tracer, w http.ResponseWriter, ep *exportPara
 	}
 
 	sq := storage.NewSearchQuery(ep.start, ep.end, ep.filterss, *maxExportSeries)
+	sq.EnforcedTagFilterss = ep.etfs
 	w.Header().Set("Content-Type", contentType)
 	bw := bufferedwriter.Get(w)
 	defer bufferedwriter.Put(bw)
@@ -449,7 +468,7 @@ func DeleteHandler(startTime time.Time, r *http.Request) error {
 	if r.FormValue("start") != "" || r.FormValue("end") != "" {
 		return fmt.Errorf("start and end aren't supported. Remove these args from the query in order to delete all the matching metrics")
 	}
-	tagFilterss, err := getTagFilterssFromRequest(r)
+	tagFilterss, _, err := getTagFilterssFromRequest(r)
 	if err != nil {
 		return err
 	}
@@ -484,26 +503,16 @@ func LabelValuesHandler(qt *querytracer.Tracer, startTime time.Time, labelName s
 	matches := getMatchesFromRequest(r)
 	var labelValues []string
 	if len(matches) == 0 && len(etfs) == 0 {
-		if len(r.Form["start"]) == 0 && len(r.Form["end"]) == 0 {
-			var err error
+		tr, isFullRange, err := getLabelsTimeRange(r, startTime)
+		if err != nil {
+			return err
+		}
+		if isFullRange {
 			labelValues, err = netstorage.GetLabelValues(qt, labelName, deadline)
 			if err != nil {
 				return fmt.Errorf(`cannot obtain label values for %q: %w`, labelName, err)
 			}
 		} else {
-			ct := startTime.UnixNano() / 1e6
-			end, err := searchutils.GetTime(r, "end", ct)
-			if err != nil {
-				return err
-			}
-			start, err := searchutils.GetTime(r, "start", end-defaultStep)
-			if err != nil {
-				return err
-			}
-			tr := storage.TimeRange{
-				MinTimestamp: start,
-				MaxTimestamp: end,
-			}
 			labelValues, err = netstorage.GetLabelValuesOnTimeRange(qt, labelName, tr, deadline)
 			if err != nil {
 				return fmt.Errorf(`cannot obtain label values on time range for %q: %w`, labelName, err)
@@ -518,11 +527,11 @@ func LabelValuesHandler(qt *querytracer.Tracer, startTime time.Time, labelName s
 			matches = []string{fmt.Sprintf("{%s!=''}", labelName)}
 		}
 		ct := startTime.UnixNano() / 1e6
-		end, err := searchutils.GetTime(r, "end", ct)
+		end, err := httputils.GetTime(r, "end", ct)
 		if err != nil {
 			return err
 		}
-		start, err := searchutils.GetTime(r, "start", end-defaultStep)
+		start, err := httputils.GetTime(r, "start", end-defaultStep)
 		if err != nil {
 			return err
 		}
@@ -572,6 +581,7 @@ func labelValuesWithMatches(qt *querytracer.Tracer, labelName string, matches []
 		logger.Panicf("BUG: tagFilterss must be non-empty")
 	}
 	sq := storage.NewSearchQuery(start, end, tagFilterss, *maxSeriesLimit)
+	sq.EnforcedTagFilterss = etfs
 	m := make(map[string]struct{})
 	if end-start > 24*3600*1000 {
 		// It is cheaper to call SearchMetricNames on time ranges exceeding a day.
@@ -742,26 +752,16 @@ func LabelsHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseW
 	matches := getMatchesFromRequest(r)
 	var labels []string
 	if len(matches) == 0 && len(etfs) == 0 {
-		if len(r.Form["start"]) == 0 && len(r.Form["end"]) == 0 {
-			var err error
+		tr, isFullRange, err := getLabelsTimeRange(r, startTime)
+		if err != nil {
+			return err
+		}
+		if isFullRange {
 			labels, err = netstorage.GetLabels(qt, deadline)
 			if err != nil {
 				return fmt.Errorf("cannot obtain labels: %w", err)
 			}
 		} else {
-			ct := startTime.UnixNano() / 1e6
-			end, err := searchutils.GetTime(r, "end", ct)
-			if err != nil {
-				return err
-			}
-			start, err := searchutils.GetTime(r, "start", end-defaultStep)
-			if err != nil {
-				return err
-			}
-			tr := storage.TimeRange{
-				MinTimestamp: start,
-				MaxTimestamp: end,
-			}
 			labels, err = netstorage.GetLabelsOnTimeRange(qt, tr, deadline)
 			if err != nil {
 				return fmt.Errorf("cannot obtain labels on time range: %w", err)
@@ -774,11 +774,11 @@ func LabelsHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseW
 			matches = []string{"{__name__!=''}"}
 		}
 		ct := startTime.UnixNano() / 1e6
-		end, err := searchutils.GetTime(r, "end", ct)
+		end, err := httputils.GetTime(r, "end", ct)
 		if err != nil {
 			return err
 		}
-		start, err := searchutils.GetTime(r, "start", end-defaultStep)
+		start, err := httputils.GetTime(r, "start", end-defaultStep)
 		if err != nil {
 			return err
 		}
@@ -814,6 +814,7 @@ func labelsWithMatches(qt *querytracer.Tracer, matches []string, etfs [][]storag
 		logger.Panicf("BUG: tagFilterss must be non-empty")
 	}
 	sq := storage.NewSearchQuery(start, end, tagFilterss, *maxSeriesLimit)
+	sq.EnforcedTagFilterss = etfs
 	m := make(map[string]struct{})
 	if end-start > 24*3600*1000 {
 		// It is cheaper to call SearchMetricNames on time ranges exceeding a day.
@@ -880,6 +881,116 @@ func SeriesCountHandler(startTime time.Time, w http.ResponseWriter, r *http.Requ
 
 var seriesCountDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/series/count"}`)
 
+// QueryExemplarsHandler processes /api/v1/query_exemplars request.
+//
+// See https://prometheus.io/docs/prometheus/latest/querying/api/#querying-exemplars
+func QueryExemplarsHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	defer queryExemplarsDuration.UpdateDuration(startTime)
+
+	ct := startTime.UnixNano() / 1e6
+	if err := r.ParseForm(); err != nil {
+		return fmt.Errorf("cannot parse form values: %w", err)
+	}
+	query := r.FormValue("query")
+	if len(query) == 0 {
+		return fmt.Errorf("missing `query` arg")
+	}
+	end, err := httputils.GetTime(r, "end", ct)
+	if err != nil {
+		return err
+	}
+	start, err := httputils.GetTime(r, "start", end-defaultStep)
+	if err != nil {
+		return err
+	}
+	if start >= end {
+		end = start + defaultStep
+	}
+	etfs, err := searchutils.GetExtraTagFilters(r)
+	if err != nil {
+		return err
+	}
+	tagFilterss, err := getTagFilterssFromQuery(query)
+	if err != nil {
+		return err
+	}
+	tagFilterss = searchutils.JoinTagFilterss(tagFilterss, etfs)
+	deadline := searchutils.GetDeadlineForQuery(r, startTime)
+	sq := storage.NewSearchQuery(start, end, tagFilterss, *maxSeriesLimit)
+	sq.EnforcedTagFilterss = etfs
+	ses, err := netstorage.SearchExemplars(qt, sq, deadline)
+	if err != nil {
+		return fmt.Errorf("cannot fetch exemplars for %q: %w", sq, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	qtDone := func() {
+		qt.Donef("/api/v1/query_exemplars: query=%s, start=%d, end=%d", query, start, end)
+	}
+	WriteQueryExemplarsResponse(bw, ses, qt, qtDone)
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("cannot flush exemplars to remote client: %w", err)
+	}
+	return nil
+}
+
+var queryExemplarsDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/query_exemplars"}`)
+
+// MetadataHandler processes /api/v1/metadata request.
+//
+// See https://prometheus.io/docs/prometheus/latest/querying/api/#querying-metric-metadata
+func MetadataHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	defer metadataDuration.UpdateDuration(startTime)
+
+	if err := r.ParseForm(); err != nil {
+		return fmt.Errorf("cannot parse form values: %w", err)
+	}
+	metric := r.FormValue("metric")
+	limit := 0
+	if limitStr := r.FormValue("limit"); len(limitStr) > 0 {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil {
+			return fmt.Errorf("cannot parse `limit` arg %q: %w", limitStr, err)
+		}
+		limit = n
+	}
+	mds := netstorage.SearchMetadata(qt, metric, limit)
+
+	w.Header().Set("Content-Type", "application/json")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	qtDone := func() {
+		qt.Donef("/api/v1/metadata: metric=%q, limit=%d", metric, limit)
+	}
+	WriteMetadataResponse(bw, mds, qt, qtDone)
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("cannot flush metadata to remote client: %w", err)
+	}
+	return nil
+}
+
+var metadataDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/metadata"}`)
+
+// getTagFilterssFromQuery returns tag filters for all the series selectors in the given MetricsQL query.
+func getTagFilterssFromQuery(query string) ([][]storage.TagFilter, error) {
+	e, err := metricsql.Parse(query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse query %q: %w", query, err)
+	}
+	var tagFilterss [][]storage.TagFilter
+	metricsql.VisitAll(e, func(expr metricsql.Expr) {
+		if me, ok := expr.(*metricsql.MetricExpr); ok && !me.IsEmpty() {
+			tagFilterss = append(tagFilterss, searchutils.ToTagFilters(me.LabelFilters))
+		}
+	})
+	if len(tagFilterss) == 0 {
+		return nil, fmt.Errorf("query %q must contain at least a single series selector", query)
+	}
+	return tagFilterss, nil
+}
+
 // SeriesHandler processes /api/v1/series request.
 //
 // See https://prometheus.io/docs/prometheus/latest/querying/api/#finding-series-by-label-matchers
@@ -890,7 +1001,7 @@ func SeriesHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseW
 	if err := r.ParseForm(); err != nil {
 		return fmt.Errorf("cannot parse form values: %w", err)
 	}
-	end, err := searchutils.GetTime(r, "end", ct)
+	end, err := httputils.GetTime(r, "end", ct)
 	if err != nil {
 		return err
 	}
@@ -899,13 +1010,13 @@ func SeriesHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseW
 	// which can take a lot of time for big storages.
 	// It is better setting start as end-defaultStep by default.
 	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/91
-	start, err := searchutils.GetTime(r, "start", end-defaultStep)
+	start, err := httputils.GetTime(r, "start", end-defaultStep)
 	if err != nil {
 		return err
 	}
 	deadline := searchutils.GetDeadlineForQuery(r, startTime)
 
-	tagFilterss, err := getTagFilterssFromRequest(r)
+	tagFilterss, etfs, err := getTagFilterssFromRequest(r)
 	if err != nil {
 		return err
 	}
@@ -913,6 +1024,7 @@ func SeriesHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseW
 		end = start + defaultStep
 	}
 	sq := storage.NewSearchQuery(start, end, tagFilterss, *maxSeriesLimit)
+	sq.EnforcedTagFilterss = etfs
 	qtDone := func() {
 		qt.Donef("/api/v1/series: start=%d, end=%d", start, end)
 	}
@@ -986,12 +1098,12 @@ func QueryHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseWr
 	defer queryDuration.UpdateDuration(startTime)
 
 	ct := startTime.UnixNano() / 1e6
-	mayCache := !searchutils.GetBool(r, "nocache")
+	mayCache := !httputils.GetBool(r, "nocache")
 	query := r.FormValue("query")
 	if len(query) == 0 {
 		return fmt.Errorf("missing `query` arg")
 	}
-	start, err := searchutils.GetTime(r, "time", ct)
+	start, err := httputils.GetTime(r, "time", ct)
 	if err != nil {
 		return err
 	}
@@ -1038,6 +1150,7 @@ func QueryHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseWr
 			start:    start,
 			end:      end,
 			filterss: filterss,
+			etfs:     etfs,
 		}
 		if err := exportHandler(qt, w, ep, "promapi", 0, false); err != nil {
 			return fmt.Errorf("error when exporting data for query=%q on the time range (start=%d, end=%d): %w", childQuery, start, end, err)
@@ -1063,7 +1176,7 @@ func QueryHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseWr
 	}
 
 	queryOffset := getLatencyOffsetMilliseconds()
-	if !searchutils.GetBool(r, "nocache") && ct-start < queryOffset && start-ct < queryOffset {
+	if !httputils.GetBool(r, "nocache") && ct-start < queryOffset && start-ct < queryOffset {
 		// Adjust start time only if `nocache` arg isn't set.
 		// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/241
 		startPrev := start
@@ -1076,13 +1189,16 @@ func QueryHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseWr
 		Start:               start,
 		End:                 start,
 		Step:                step,
-		MaxSeries:           *maxUniqueTimeseries,
+		MaxSeries:           GetMaxUniqueTimeseries(etfs),
 		QuotedRemoteAddr:    httpserver.GetQuotedRemoteAddr(r),
 		Deadline:            deadline,
 		MayCache:            mayCache,
 		LookbackDelta:       lookbackDelta,
 		RoundDigits:         getRoundDigits(r),
 		EnforcedTagFilterss: etfs,
+
+		PrometheusExtrapolation: *prometheusExtrapolation || httputils.GetBool(r, "prometheus_extrapolation"),
+		AllowPartialResponse:    httputils.GetBool(r, "allow_partial_response"),
 	}
 	result, err := promql.Exec(qt, &ec, query, true)
 	if err != nil {
@@ -1103,7 +1219,11 @@ func QueryHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseWr
 	qtDone := func() {
 		qt.Donef("/api/v1/query: query=%s, time=%d: series=%d", query, start, len(result))
 	}
-	WriteQueryResponse(bw, result, qt, qtDone)
+	isPartial := ec.IsPartialResponse()
+	if isPartial {
+		partialQueryResponses.Inc()
+	}
+	WriteQueryResponse(bw, result, isPartial, qt, qtDone)
 	if err := bw.Flush(); err != nil {
 		return fmt.Errorf("cannot flush query response to remote client: %w", err)
 	}
@@ -1112,6 +1232,9 @@ func QueryHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseWr
 
 var queryDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/query"}`)
 
+// partialQueryResponses counts responses with partial results returned because of timeout when `allow_partial_response` query arg is set.
+var partialQueryResponses = metrics.NewCounter(`vm_partial_query_responses_total`)
+
 // QueryRangeHandler processes /api/v1/query_range request.
 //
 // See https://prometheus.io/docs/prometheus/latest/querying/api/#range-queries
@@ -1123,11 +1246,11 @@ func QueryRangeHandler(qt *querytracer.Tracer, startTime time.Time, w http.Respo
 	if len(query) == 0 {
 		return fmt.Errorf("missing `query` arg")
 	}
-	start, err := searchutils.GetTime(r, "start", ct-defaultStep)
+	start, err := httputils.GetTime(r, "start", ct-defaultStep)
 	if err != nil {
 		return err
 	}
-	end, err := searchutils.GetTime(r, "end", ct)
+	end, err := httputils.GetTime(r, "end", ct)
 	if err != nil {
 		return err
 	}
@@ -1148,7 +1271,7 @@ func QueryRangeHandler(qt *querytracer.Tracer, startTime time.Time, w http.Respo
 func queryRangeHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseWriter, query string,
 	start, end, step int64, r *http.Request, ct int64, etfs [][]storage.TagFilter) error {
 	deadline := searchutils.GetDeadlineForQuery(r, startTime)
-	mayCache := !searchutils.GetBool(r, "nocache")
+	mayCache := !httputils.GetBool(r, "nocache")
 	lookbackDelta, err := getMaxLookback(r)
 	if err != nil {
 		return err
@@ -1164,7 +1287,9 @@ func queryRangeHandler(qt *querytracer.Tracer, startTime time.Time, w http.Respo
 	if err := promql.ValidateMaxPointsPerTimeseries(start, end, step); err != nil {
 		return err
 	}
-	if mayCache {
+	if *alignStep || httputils.GetBool(r, "align_step") {
+		start, end = promql.AlignStartEnd(start, end, step)
+	} else if mayCache {
 		start, end = promql.AdjustStartEnd(start, end, step)
 	}
 
@@ -1172,13 +1297,16 @@ func queryRangeHandler(qt *querytracer.Tracer, startTime time.Time, w http.Respo
 		Start:               start,
 		End:                 end,
 		Step:                step,
-		MaxSeries:           *maxUniqueTimeseries,
+		MaxSeries:           GetMaxUniqueTimeseries(etfs),
 		QuotedRemoteAddr:    httpserver.GetQuotedRemoteAddr(r),
 		Deadline:            deadline,
 		MayCache:            mayCache,
 		LookbackDelta:       lookbackDelta,
 		RoundDigits:         getRoundDigits(r),
 		EnforcedTagFilterss: etfs,
+
+		PrometheusExtrapolation: *prometheusExtrapolation || httputils.GetBool(r, "prometheus_extrapolation"),
+		AllowPartialResponse:    httputils.GetBool(r, "allow_partial_response"),
 	}
 	result, err := promql.Exec(qt, &ec, query, false)
 	if err != nil {
@@ -1201,7 +1329,11 @@ func queryRangeHandler(qt *querytracer.Tracer, startTime time.Time, w http.Respo
 	qtDone := func() {
 		qt.Donef("/api/v1/query_range: start=%d, end=%d, step=%d, query=%q: series=%d", start, end, step, query, len(result))
 	}
-	WriteQueryRangeResponse(bw, result, qt, qtDone)
+	isPartial := ec.IsPartialResponse()
+	if isPartial {
+		partialQueryResponses.Inc()
+	}
+	WriteQueryRangeResponse(bw, result, isPartial, qt, qtDone)
 	if err := bw.Flush(); err != nil {
 		return fmt.Errorf("cannot send query range response to remote client: %w", err)
 	}
@@ -1281,6 +1413,33 @@ func adjustLastPoints(tss []netstorage.Result, start, end int64) []netstorage.Re
 	return tss
 }
 
+// getLabelsTimeRange returns the time range for /api/v1/labels and /api/v1/label/.../values requests without match[] args.
+//
+// It returns true if the search must be performed over the whole retention.
+func getLabelsTimeRange(r *http.Request, startTime time.Time) (storage.TimeRange, bool, error) {
+	var tr storage.TimeRange
+	ct := startTime.UnixNano() / 1e6
+	if len(r.Form["start"]) == 0 && len(r.Form["end"]) == 0 {
+		if httputils.GetBool(r, "full_range") || *labelsDefaultLookback <= 0 {
+			return tr, true, nil
+		}
+		tr.MinTimestamp = ct - labelsDefaultLookback.Milliseconds()
+		tr.MaxTimestamp = ct
+		return tr, false, nil
+	}
+	end, err := httputils.GetTime(r, "end", ct)
+	if err != nil {
+		return tr, false, err
+	}
+	start, err := httputils.GetTime(r, "start", end-defaultStep)
+	if err != nil {
+		return tr, false, err
+	}
+	tr.MinTimestamp = start
+	tr.MaxTimestamp = end
+	return tr, false, nil
+}
+
 func getMaxLookback(r *http.Request) (int64, error) {
 	d := maxLookback.Milliseconds()
 	if d == 0 {
@@ -1301,21 +1460,25 @@ func getTagFilterssFromMatches(matches []string) ([][]storage.TagFilter, error)
 	return tagFilterss, nil
 }
 
-func getTagFilterssFromRequest(r *http.Request) ([][]storage.TagFilter, error) {
+// getTagFilterssFromRequest returns tag filters from `match[]` query args joined with the enforced tag filters
+// from `extra_label` and `extra_filters[]` query args.
+//
+// The enforced tag filters are returned in etfs.
+func getTagFilterssFromRequest(r *http.Request) (tagFilterss, etfs [][]storage.TagFilter, err error) {
 	matches := getMatchesFromRequest(r)
 	if len(matches) == 0 {
-		return nil, fmt.Errorf("missing `match[]` query arg")
+		return nil, nil, fmt.Errorf("missing `match[]` query arg")
 	}
-	tagFilterss, err := getTagFilterssFromMatches(matches)
+	tagFilterss, err = getTagFilterssFromMatches(matches)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	etfs, err := searchutils.GetExtraTagFilters(r)
+	etfs, err = searchutils.GetExtraTagFilters(r)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	tagFilterss = searchutils.JoinTagFilterss(tagFilterss, etfs)
-	return tagFilterss, nil
+	return tagFilterss, etfs, nil
 }
 
 func getMatchesFromRequest(r *http.Request) []string {
@@ -1386,17 +1549,20 @@ type exportParams struct {
 	start    int64
 	end      int64
 	filterss [][]storage.TagFilter
+
+	// etfs contains the enforced tag filters, which are already joined with filterss.
+	etfs [][]storage.TagFilter
 }
 
 // getExportParams obtains common params from r, which are used for /api/v1/export* handlers
 func getExportParams(r *http.Request, startTime time.Time) (*exportParams, error) {
 	deadline := searchutils.GetDeadlineForExport(r, startTime)
-	start, err := searchutils.GetTime(r, "start", 0)
+	start, err := httputils.GetTime(r, "start", 0)
 	if err != nil {
 		return nil, err
 	}
 	ct := startTime.UnixNano() / 1e6
-	end, err := searchutils.GetTime(r, "end", ct)
+	end, err := httputils.GetTime(r, "end", ct)
 	if err != nil {
 		return nil, err
 	}
@@ -1428,5 +1594,53 @@ func getExportParams(r *http.Request, startTime time.Time) (*exportParams, error
 		start:    start,
 		end:      end,
 		filterss: filterss,
+		etfs:     etfs,
 	}, nil
 }
+
+// LintHandler processes /api/v1/lint request.
+//
+// It returns warnings for the known anti-patterns in MetricsQL query passed via `query` arg.
+func LintHandler(w http.ResponseWriter, r *http.Request) error {
+	query := r.FormValue("query")
+	if len(query) == 0 {
+		return fmt.Errorf("missing `query` arg")
+	}
+	if len(query) > maxQueryLen.N {
+		return fmt.Errorf("too long query; got %d bytes; mustn't exceed `-search.maxQueryLen=%d` bytes", len(query), maxQueryLen.N)
+	}
+	ws, err := querylint.Lint(query)
+	if err != nil {
+		return &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("cannot parse query %q: %w", query, err),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	if ws == nil {
+		ws = []querylint.Warning{}
+	}
+	data, err := json.Marshal(ws)
+	if err != nil {
+		return fmt.Errorf("cannot marshal lint warnings: %w", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"status":"success","data":{"warnings":%s}}`, data)
+	return nil
+}
+
+// getSortedLabels returns labels from mn sorted by name, so they are returned in stable order in JSON responses.
+//
+// Labels obtained from the storage may be unsorted, since the storage puts commonly used labels such as `job` and `instance` first.
+// mn is left unchanged, since the caller may still rely on the original order of labels.
+func getSortedLabels(mn *storage.MetricName) []storage.Tag {
+	tags := mn.Tags
+	less := func(i, j int) bool {
+		return string(tags[i].Key) < string(tags[j].Key)
+	}
+	if sort.SliceIsSorted(tags, less) {
+		return tags
+	}
+	tags = append([]storage.Tag{}, tags...)
+	sort.Slice(tags, less)
+	return tags
+}
@@ -1,11 +1,23 @@
 package prometheus
 
 import (
+	"encoding/json"
+	"fmt"
 	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"regexp"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 )
 
 func TestRemoveEmptyValuesAndTimeseries(t *testing.T) {
@@ -195,3 +207,272 @@ func TestAdjustLastPoints(t *testing.T) {
 		},
 	})
 }
+
+func TestGetLabelsTimeRange(t *testing.T) {
+	startTime := time.Unix(1000000, 0)
+	ct := startTime.UnixNano() / 1e6
+	f := func(lookback time.Duration, query string, trExpected storage.TimeRange, isFullRangeExpected bool) {
+		t.Helper()
+		lookbackOrig := *labelsDefaultLookback
+		*labelsDefaultLookback = lookback
+		defer func() {
+			*labelsDefaultLookback = lookbackOrig
+		}()
+		q, err := url.ParseQuery(query)
+		if err != nil {
+			t.Fatalf("cannot parse query %q: %s", query, err)
+		}
+		r := &http.Request{
+			Form: q,
+		}
+		tr, isFullRange, err := getLabelsTimeRange(r, startTime)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if isFullRange != isFullRangeExpected {
+			t.Fatalf("unexpected isFullRange; got %v; want %v", isFullRange, isFullRangeExpected)
+		}
+		if tr != trExpected {
+			t.Fatalf("unexpected time range; got %+v; want %+v", tr, trExpected)
+		}
+	}
+
+	// The default lookback limits the searched time range
+	f(time.Hour, "", storage.TimeRange{
+		MinTimestamp: ct - 3600*1000,
+		MaxTimestamp: ct,
+	}, false)
+
+	// Explicitly requested full range
+	f(time.Hour, "full_range=1", storage.TimeRange{}, true)
+
+	// Zero lookback disables the default time range
+	f(0, "", storage.TimeRange{}, true)
+
+	// Explicitly set start and end
+	f(time.Hour, "start=100&end=200", storage.TimeRange{
+		MinTimestamp: 100000,
+		MaxTimestamp: 200000,
+	}, false)
+
+	// Explicitly set end
+	f(time.Hour, "end=2000", storage.TimeRange{
+		MinTimestamp: 2000000 - defaultStep,
+		MaxTimestamp: 2000000,
+	}, false)
+
+	// start and end take precedence over full_range
+	f(time.Hour, "start=100&end=200&full_range=1", storage.TimeRange{
+		MinTimestamp: 100000,
+		MaxTimestamp: 200000,
+	}, false)
+}
+
+func TestGetTagFilterssFromQuery(t *testing.T) {
+	f := func(query string, tfssExpected [][]storage.TagFilter) {
+		t.Helper()
+		tfss, err := getTagFilterssFromQuery(query)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(tfss, tfssExpected) {
+			t.Fatalf("unexpected tag filters\ngot\n%v\nwant\n%v", tfss, tfssExpected)
+		}
+	}
+	f(`foo`, [][]storage.TagFilter{{
+		{
+			Value: []byte("foo"),
+		},
+	}})
+	f(`rate(foo{job="a"}[5m]) / bar`, [][]storage.TagFilter{
+		{
+			{
+				Value: []byte("foo"),
+			},
+			{
+				Key:   []byte("job"),
+				Value: []byte("a"),
+			},
+		},
+		{
+			{
+				Value: []byte("bar"),
+			},
+		},
+	})
+
+	fError := func(query string) {
+		t.Helper()
+		if _, err := getTagFilterssFromQuery(query); err == nil {
+			t.Fatalf("expecting non-nil error for query %q", query)
+		}
+	}
+	fError(`foo{`)
+	fError(`1 + 2`)
+}
+
+func TestMetadataResponse(t *testing.T) {
+	f := func(mds []storage.MetricMetadata, resultExpected string) {
+		t.Helper()
+		result := MetadataResponse(mds, nil, func() {})
+		if result != resultExpected {
+			t.Fatalf("unexpected response\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+	f(nil, `{"status":"success","data":{}}`)
+	f([]storage.MetricMetadata{
+		{Metric: "foo", Type: "counter", Help: `Total "foo" bytes`, Unit: "bytes"},
+		{Metric: "http_request_duration_seconds", Type: "histogram", Unit: "seconds"},
+	}, `{"status":"success","data":{"foo":[{"type":"counter","help":"Total \"foo\" bytes","unit":"bytes"}],`+
+		`"http_request_duration_seconds":[{"type":"histogram","help":"","unit":"seconds"}]}}`)
+}
+
+func TestGetSortedLabels(t *testing.T) {
+	f := func(keys, keysExpected []string) {
+		t.Helper()
+		var mn storage.MetricName
+		for _, key := range keys {
+			mn.AddTag(key, "value")
+		}
+		tags := getSortedLabels(&mn)
+		var keysGot []string
+		for _, tag := range tags {
+			keysGot = append(keysGot, string(tag.Key))
+		}
+		if !reflect.DeepEqual(keysGot, keysExpected) {
+			t.Fatalf("unexpected sorted labels; got %q; want %q", keysGot, keysExpected)
+		}
+		// mn must be left unchanged.
+		var keysOrig []string
+		for _, tag := range mn.Tags {
+			keysOrig = append(keysOrig, string(tag.Key))
+		}
+		if !reflect.DeepEqual(keysOrig, keys) {
+			t.Fatalf("unexpected labels in mn after sorting; got %q; want %q", keysOrig, keys)
+		}
+	}
+	f(nil, nil)
+	f([]string{"a", "b"}, []string{"a", "b"})
+	f([]string{"job", "instance", "env"}, []string{"env", "instance", "job"})
+}
+
+func TestStableLabelsOrder(t *testing.T) {
+	defer initTestStorage("TestStableLabelsOrder")()
+
+	// Ingest series with labels in various orders. The storage puts commonly used labels such as job and instance first.
+	timestamp := time.Now().Add(-time.Hour).UnixNano() / 1e6
+	labelss := [][]prompb.Label{
+		{
+			{Name: []byte("zone"), Value: []byte("z1")},
+			{Name: []byte("job"), Value: []byte("j")},
+			{Name: []byte("__name__"), Value: []byte("foo")},
+			{Name: []byte("instance"), Value: []byte("i1")},
+			{Name: []byte("env"), Value: []byte("prod")},
+		},
+		{
+			{Name: []byte("instance"), Value: []byte("i2")},
+			{Name: []byte("env"), Value: []byte("dev")},
+			{Name: []byte("__name__"), Value: []byte("foo")},
+			{Name: []byte("zone"), Value: []byte("z2")},
+			{Name: []byte("job"), Value: []byte("j")},
+		},
+	}
+	var mrs []storage.MetricRow
+	for _, labels := range labelss {
+		mrs = append(mrs, storage.MetricRow{
+			MetricNameRaw: storage.MarshalMetricNameRaw(nil, labels),
+			Timestamp:     timestamp,
+			Value:         1,
+		})
+	}
+	if err := addTestRows(mrs); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+
+	labelsExpected := []map[string]string{
+		{"__name__": "foo", "env": "prod", "instance": "i1", "job": "j", "zone": "z1"},
+		{"__name__": "foo", "env": "dev", "instance": "i2", "job": "j", "zone": "z2"},
+	}
+	keysExpected := []string{"__name__", "env", "instance", "job", "zone"}
+	metricRe := regexp.MustCompile(`\{("__name__"[^{}]*)\}`)
+	keyRe := regexp.MustCompile(`"([^"]+)":"`)
+
+	f := func(handler func(w http.ResponseWriter, r *http.Request) error, args string) {
+		t.Helper()
+		var responsePrev string
+		for i := 0; i < 3; i++ {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/?"+args, nil)
+			if err := handler(w, r); err != nil {
+				t.Fatalf("unexpected error for %q: %s", args, err)
+			}
+			response := w.Body.String()
+			if i > 0 && response != responsePrev {
+				t.Fatalf("unexpected response for %q on repeated request;\ngot\n%s\nwant\n%s", args, response, responsePrev)
+			}
+			responsePrev = response
+		}
+		var labelsGot []map[string]string
+		for _, m := range metricRe.FindAllStringSubmatch(responsePrev, -1) {
+			// Labels must be returned in stable order: __name__ goes first, then the remaining labels sorted by name.
+			var keys []string
+			for _, km := range keyRe.FindAllStringSubmatch(m[1], -1) {
+				keys = append(keys, km[1])
+			}
+			if !reflect.DeepEqual(keys, keysExpected) {
+				t.Fatalf("unexpected labels order for %q; got %q; want %q", args, keys, keysExpected)
+			}
+			// Clients, which parse labels into maps, must obtain the same labels.
+			var labels map[string]string
+			if err := json.Unmarshal([]byte(m[0]), &labels); err != nil {
+				t.Fatalf("cannot unmarshal labels %q: %s", m[0], err)
+			}
+			labelsGot = append(labelsGot, labels)
+		}
+		sort.Slice(labelsGot, func(i, j int) bool {
+			return labelsGot[i]["instance"] < labelsGot[j]["instance"]
+		})
+		if !reflect.DeepEqual(labelsGot, labelsExpected) {
+			t.Fatalf("unexpected labels for %q; got %v; want %v", args, labelsGot, labelsExpected)
+		}
+	}
+
+	start := fmt.Sprintf("%d", timestamp/1e3-60)
+	end := fmt.Sprintf("%d", timestamp/1e3+60)
+	f(func(w http.ResponseWriter, r *http.Request) error {
+		return QueryHandler(nil, time.Now(), w, r)
+	}, "query=foo&time="+end)
+	f(func(w http.ResponseWriter, r *http.Request) error {
+		return QueryRangeHandler(nil, time.Now(), w, r)
+	}, "query=foo&start="+start+"&end="+end+"&step=60s")
+	f(func(w http.ResponseWriter, r *http.Request) error {
+		return ExportHandler(time.Now(), w, r)
+	}, "match[]=foo&start="+start+"&end="+end)
+	f(func(w http.ResponseWriter, r *http.Request) error {
+		return SeriesHandler(nil, time.Now(), w, r)
+	}, "match[]=foo&start="+start+"&end="+end)
+}
+
+// initTestStorage initializes vmstorage and the directory for temporary blocks at dataPath.
+//
+// The returned function must be called at the end of the test. It stops vmstorage and removes dataPath.
+func initTestStorage(dataPath string) func() {
+	prevDataPath := *vmstorage.DataPath
+	*vmstorage.DataPath = dataPath
+	netstorage.InitTmpBlocksDir(dataPath)
+	vmstorage.InitWithoutMetrics(func(mrs []storage.MetricRow) {})
+	return func() {
+		vmstorage.Stop()
+		*vmstorage.DataPath = prevDataPath
+		fs.MustRemoveAll(dataPath)
+	}
+}
+
+// addTestRows adds mrs to vmstorage initialized via initTestStorage and makes them visible for search.
+func addTestRows(mrs []storage.MetricRow) error {
+	if err := vmstorage.AddRows(mrs); err != nil {
+		return err
+	}
+	vmstorage.Storage.DebugFlush()
+	return nil
+}
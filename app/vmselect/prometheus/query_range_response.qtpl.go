@@ -26,7 +26,7 @@ var (
 )
 
 //line app/vmselect/prometheus/query_range_response.qtpl:9
-func StreamQueryRangeResponse(qw422016 *qt422016.Writer, rs []netstorage.Result, qt *querytracer.Tracer, qtDone func()) {
+func StreamQueryRangeResponse(qw422016 *qt422016.Writer, rs []netstorage.Result, isPartial bool, qt *querytracer.Tracer, qtDone func()) {
 //line app/vmselect/prometheus/query_range_response.qtpl:9
 	qw422016.N().S(`{`)
 //line app/vmselect/prometheus/query_range_response.qtpl:12
@@ -34,106 +34,114 @@ func StreamQueryRangeResponse(qw422016 *qt422016.Writer, rs []netstorage.Result,
 	pointsCount := 0
 
 //line app/vmselect/prometheus/query_range_response.qtpl:14
-	qw422016.N().S(`"status":"success","data":{"resultType":"matrix","result":[`)
-//line app/vmselect/prometheus/query_range_response.qtpl:19
+	qw422016.N().S(`"status":"success",`)
+//line app/vmselect/prometheus/query_range_response.qtpl:16
+	if isPartial {
+//line app/vmselect/prometheus/query_range_response.qtpl:16
+		qw422016.N().S(`"isPartial":true,`)
+//line app/vmselect/prometheus/query_range_response.qtpl:18
+	}
+//line app/vmselect/prometheus/query_range_response.qtpl:18
+	qw422016.N().S(`"data":{"resultType":"matrix","result":[`)
+//line app/vmselect/prometheus/query_range_response.qtpl:22
 	if len(rs) > 0 {
-//line app/vmselect/prometheus/query_range_response.qtpl:20
+//line app/vmselect/prometheus/query_range_response.qtpl:23
 		streamqueryRangeLine(qw422016, &rs[0])
-//line app/vmselect/prometheus/query_range_response.qtpl:21
+//line app/vmselect/prometheus/query_range_response.qtpl:24
 		pointsCount += len(rs[0].Values)
 
-//line app/vmselect/prometheus/query_range_response.qtpl:22
+//line app/vmselect/prometheus/query_range_response.qtpl:25
 		rs = rs[1:]
 
-//line app/vmselect/prometheus/query_range_response.qtpl:23
+//line app/vmselect/prometheus/query_range_response.qtpl:26
 		for i := range rs {
-//line app/vmselect/prometheus/query_range_response.qtpl:23
+//line app/vmselect/prometheus/query_range_response.qtpl:26
 			qw422016.N().S(`,`)
-//line app/vmselect/prometheus/query_range_response.qtpl:24
+//line app/vmselect/prometheus/query_range_response.qtpl:27
 			streamqueryRangeLine(qw422016, &rs[i])
-//line app/vmselect/prometheus/query_range_response.qtpl:25
+//line app/vmselect/prometheus/query_range_response.qtpl:28
 			pointsCount += len(rs[i].Values)
 
-//line app/vmselect/prometheus/query_range_response.qtpl:26
+//line app/vmselect/prometheus/query_range_response.qtpl:29
 		}
-//line app/vmselect/prometheus/query_range_response.qtpl:27
+//line app/vmselect/prometheus/query_range_response.qtpl:30
 	}
-//line app/vmselect/prometheus/query_range_response.qtpl:27
+//line app/vmselect/prometheus/query_range_response.qtpl:30
 	qw422016.N().S(`]}`)
-//line app/vmselect/prometheus/query_range_response.qtpl:31
+//line app/vmselect/prometheus/query_range_response.qtpl:34
 	qt.Printf("generate /api/v1/query_range response for series=%d, points=%d", seriesCount, pointsCount)
 	qtDone()
 
-//line app/vmselect/prometheus/query_range_response.qtpl:34
+//line app/vmselect/prometheus/query_range_response.qtpl:37
 	streamdumpQueryTrace(qw422016, qt)
-//line app/vmselect/prometheus/query_range_response.qtpl:34
+//line app/vmselect/prometheus/query_range_response.qtpl:37
 	qw422016.N().S(`}`)
-//line app/vmselect/prometheus/query_range_response.qtpl:36
+//line app/vmselect/prometheus/query_range_response.qtpl:39
 }
 
-//line app/vmselect/prometheus/query_range_response.qtpl:36
-func WriteQueryRangeResponse(qq422016 qtio422016.Writer, rs []netstorage.Result, qt *querytracer.Tracer, qtDone func()) {
-//line app/vmselect/prometheus/query_range_response.qtpl:36
+//line app/vmselect/prometheus/query_range_response.qtpl:39
+func WriteQueryRangeResponse(qq422016 qtio422016.Writer, rs []netstorage.Result, isPartial bool, qt *querytracer.Tracer, qtDone func()) {
+//line app/vmselect/prometheus/query_range_response.qtpl:39
 	qw422016 := qt422016.AcquireWriter(qq422016)
-//line app/vmselect/prometheus/query_range_response.qtpl:36
-	StreamQueryRangeResponse(qw422016, rs, qt, qtDone)
-//line app/vmselect/prometheus/query_range_response.qtpl:36
+//line app/vmselect/prometheus/query_range_response.qtpl:39
+	StreamQueryRangeResponse(qw422016, rs, isPartial, qt, qtDone)
+//line app/vmselect/prometheus/query_range_response.qtpl:39
 	qt422016.ReleaseWriter(qw422016)
-//line app/vmselect/prometheus/query_range_response.qtpl:36
+//line app/vmselect/prometheus/query_range_response.qtpl:39
 }
 
-//line app/vmselect/prometheus/query_range_response.qtpl:36
-func QueryRangeResponse(rs []netstorage.Result, qt *querytracer.Tracer, qtDone func()) string {
-//line app/vmselect/prometheus/query_range_response.qtpl:36
+//line app/vmselect/prometheus/query_range_response.qtpl:39
+func QueryRangeResponse(rs []netstorage.Result, isPartial bool, qt *querytracer.Tracer, qtDone func()) string {
+//line app/vmselect/prometheus/query_range_response.qtpl:39
 	qb422016 := qt422016.AcquireByteBuffer()
-//line app/vmselect/prometheus/query_range_response.qtpl:36
-	WriteQueryRangeResponse(qb422016, rs, qt, qtDone)
-//line app/vmselect/prometheus/query_range_response.qtpl:36
+//line app/vmselect/prometheus/query_range_response.qtpl:39
+	WriteQueryRangeResponse(qb422016, rs, isPartial, qt, qtDone)
+//line app/vmselect/prometheus/query_range_response.qtpl:39
 	qs422016 := string(qb422016.B)
-//line app/vmselect/prometheus/query_range_response.qtpl:36
+//line app/vmselect/prometheus/query_range_response.qtpl:39
 	qt422016.ReleaseByteBuffer(qb422016)
-//line app/vmselect/prometheus/query_range_response.qtpl:36
+//line app/vmselect/prometheus/query_range_response.qtpl:39
 	return qs422016
-//line app/vmselect/prometheus/query_range_response.qtpl:36
+//line app/vmselect/prometheus/query_range_response.qtpl:39
 }
 
-//line app/vmselect/prometheus/query_range_response.qtpl:38
+//line app/vmselect/prometheus/query_range_response.qtpl:41
 func streamqueryRangeLine(qw422016 *qt422016.Writer, r *netstorage.Result) {
-//line app/vmselect/prometheus/query_range_response.qtpl:38
+//line app/vmselect/prometheus/query_range_response.qtpl:41
 	qw422016.N().S(`{"metric":`)
-//line app/vmselect/prometheus/query_range_response.qtpl:40
+//line app/vmselect/prometheus/query_range_response.qtpl:43
 	streammetricNameObject(qw422016, &r.MetricName)
-//line app/vmselect/prometheus/query_range_response.qtpl:40
+//line app/vmselect/prometheus/query_range_response.qtpl:43
 	qw422016.N().S(`,"values":`)
-//line app/vmselect/prometheus/query_range_response.qtpl:41
+//line app/vmselect/prometheus/query_range_response.qtpl:44
 	streamvaluesWithTimestamps(qw422016, r.Values, r.Timestamps)
-//line app/vmselect/prometheus/query_range_response.qtpl:41
+//line app/vmselect/prometheus/query_range_response.qtpl:44
 	qw422016.N().S(`}`)
-//line app/vmselect/prometheus/query_range_response.qtpl:43
+//line app/vmselect/prometheus/query_range_response.qtpl:46
 }
 
-//line app/vmselect/prometheus/query_range_response.qtpl:43
+//line app/vmselect/prometheus/query_range_response.qtpl:46
 func writequeryRangeLine(qq422016 qtio422016.Writer, r *netstorage.Result) {
-//line app/vmselect/prometheus/query_range_response.qtpl:43
+//line app/vmselect/prometheus/query_range_response.qtpl:46
 	qw422016 := qt422016.AcquireWriter(qq422016)
-//line app/vmselect/prometheus/query_range_response.qtpl:43
+//line app/vmselect/prometheus/query_range_response.qtpl:46
 	streamqueryRangeLine(qw422016, r)
-//line app/vmselect/prometheus/query_range_response.qtpl:43
+//line app/vmselect/prometheus/query_range_response.qtpl:46
 	qt422016.ReleaseWriter(qw422016)
-//line app/vmselect/prometheus/query_range_response.qtpl:43
+//line app/vmselect/prometheus/query_range_response.qtpl:46
 }
 
-//line app/vmselect/prometheus/query_range_response.qtpl:43
+//line app/vmselect/prometheus/query_range_response.qtpl:46
 func queryRangeLine(r *netstorage.Result) string {
-//line app/vmselect/prometheus/query_range_response.qtpl:43
+//line app/vmselect/prometheus/query_range_response.qtpl:46
 	qb422016 := qt422016.AcquireByteBuffer()
-//line app/vmselect/prometheus/query_range_response.qtpl:43
+//line app/vmselect/prometheus/query_range_response.qtpl:46
 	writequeryRangeLine(qb422016, r)
-//line app/vmselect/prometheus/query_range_response.qtpl:43
+//line app/vmselect/prometheus/query_range_response.qtpl:46
 	qs422016 := string(qb422016.B)
-//line app/vmselect/prometheus/query_range_response.qtpl:43
+//line app/vmselect/prometheus/query_range_response.qtpl:46
 	qt422016.ReleaseByteBuffer(qb422016)
-//line app/vmselect/prometheus/query_range_response.qtpl:43
+//line app/vmselect/prometheus/query_range_response.qtpl:46
 	return qs422016
-//line app/vmselect/prometheus/query_range_response.qtpl:43
+//line app/vmselect/prometheus/query_range_response.qtpl:46
 }
@@ -26,83 +26,91 @@ var (
 )
 
 //line app/vmselect/prometheus/query_response.qtpl:9
-func StreamQueryResponse(qw422016 *qt422016.Writer, rs []netstorage.Result, qt *querytracer.Tracer, qtDone func()) {
+func StreamQueryResponse(qw422016 *qt422016.Writer, rs []netstorage.Result, isPartial bool, qt *querytracer.Tracer, qtDone func()) {
 //line app/vmselect/prometheus/query_response.qtpl:9
 	qw422016.N().S(`{`)
 //line app/vmselect/prometheus/query_response.qtpl:11
 	seriesCount := len(rs)
 
 //line app/vmselect/prometheus/query_response.qtpl:11
-	qw422016.N().S(`"status":"success","data":{"resultType":"vector","result":[`)
-//line app/vmselect/prometheus/query_response.qtpl:16
+	qw422016.N().S(`"status":"success",`)
+//line app/vmselect/prometheus/query_response.qtpl:13
+	if isPartial {
+//line app/vmselect/prometheus/query_response.qtpl:13
+		qw422016.N().S(`"isPartial":true,`)
+//line app/vmselect/prometheus/query_response.qtpl:15
+	}
+//line app/vmselect/prometheus/query_response.qtpl:15
+	qw422016.N().S(`"data":{"resultType":"vector","result":[`)
+//line app/vmselect/prometheus/query_response.qtpl:19
 	if len(rs) > 0 {
-//line app/vmselect/prometheus/query_response.qtpl:16
+//line app/vmselect/prometheus/query_response.qtpl:19
 		qw422016.N().S(`{"metric":`)
-//line app/vmselect/prometheus/query_response.qtpl:18
+//line app/vmselect/prometheus/query_response.qtpl:21
 		streammetricNameObject(qw422016, &rs[0].MetricName)
-//line app/vmselect/prometheus/query_response.qtpl:18
+//line app/vmselect/prometheus/query_response.qtpl:21
 		qw422016.N().S(`,"value":`)
-//line app/vmselect/prometheus/query_response.qtpl:19
+//line app/vmselect/prometheus/query_response.qtpl:22
 		streammetricRow(qw422016, rs[0].Timestamps[0], rs[0].Values[0])
-//line app/vmselect/prometheus/query_response.qtpl:19
+//line app/vmselect/prometheus/query_response.qtpl:22
 		qw422016.N().S(`}`)
-//line app/vmselect/prometheus/query_response.qtpl:21
+//line app/vmselect/prometheus/query_response.qtpl:24
 		rs = rs[1:]
 
-//line app/vmselect/prometheus/query_response.qtpl:22
+//line app/vmselect/prometheus/query_response.qtpl:25
 		for i := range rs {
-//line app/vmselect/prometheus/query_response.qtpl:23
+//line app/vmselect/prometheus/query_response.qtpl:26
 			r := &rs[i]
 
-//line app/vmselect/prometheus/query_response.qtpl:23
+//line app/vmselect/prometheus/query_response.qtpl:26
 			qw422016.N().S(`,{"metric":`)
-//line app/vmselect/prometheus/query_response.qtpl:25
+//line app/vmselect/prometheus/query_response.qtpl:28
 			streammetricNameObject(qw422016, &r.MetricName)
-//line app/vmselect/prometheus/query_response.qtpl:25
+//line app/vmselect/prometheus/query_response.qtpl:28
 			qw422016.N().S(`,"value":`)
-//line app/vmselect/prometheus/query_response.qtpl:26
+//line app/vmselect/prometheus/query_response.qtpl:29
 			streammetricRow(qw422016, r.Timestamps[0], r.Values[0])
-//line app/vmselect/prometheus/query_response.qtpl:26
+//line app/vmselect/prometheus/query_response.qtpl:29
 			qw422016.N().S(`}`)
-//line app/vmselect/prometheus/query_response.qtpl:28
+//line app/vmselect/prometheus/query_response.qtpl:31
 		}
-//line app/vmselect/prometheus/query_response.qtpl:29
+//line app/vmselect/prometheus/query_response.qtpl:32
 	}
-//line app/vmselect/prometheus/query_response.qtpl:29
+//line app/vmselect/prometheus/query_response.qtpl:32
 	qw422016.N().S(`]}`)
-//line app/vmselect/prometheus/query_response.qtpl:33
+//line app/vmselect/prometheus/query_response.qtpl:36
 	qt.Printf("generate /api/v1/query response for series=%d", seriesCount)
 	qtDone()
 
-//line app/vmselect/prometheus/query_response.qtpl:36
+//line app/vmselect/prometheus/query_response.qtpl:39
 	streamdumpQueryTrace(qw422016, qt)
-//line app/vmselect/prometheus/query_response.qtpl:36
+//line app/vmselect/prometheus/query_response.qtpl:39
 	qw422016.N().S(`}`)
-//line app/vmselect/prometheus/query_response.qtpl:38
+//line app/vmselect/prometheus/query_response.qtpl:41
 }
 
-//line app/vmselect/prometheus/query_response.qtpl:38
-func WriteQueryResponse(qq422016 qtio422016.Writer, rs []netstorage.Result, qt *querytracer.Tracer, qtDone func()) {
-//line app/vmselect/prometheus/query_response.qtpl:38
+//line app/vmselect/prometheus/query_response.qtpl:41
+func WriteQueryResponse(qq422016 qtio422016.Writer, rs []netstorage.Result, isPartial bool, qt *querytracer.Tracer, qtDone func()) {
+//line app/vmselect/prometheus/query_response.qtpl:41
 	qw422016 := qt422016.AcquireWriter(qq422016)
-//line app/vmselect/prometheus/query_response.qtpl:38
-	StreamQueryResponse(qw422016, rs, qt, qtDone)
-//line app/vmselect/prometheus/query_response.qtpl:38
+//line app/vmselect/prometheus/query_response.qtpl:41
+	StreamQueryResponse(qw422016, rs, isPartial, qt, qtDone)
+//line app/vmselect/prometheus/query_response.qtpl:41
 	qt422016.ReleaseWriter(qw422016)
-//line app/vmselect/prometheus/query_response.qtpl:38
+//line app/vmselect/prometheus/query_response.qtpl:41
 }
 
-//line app/vmselect/prometheus/query_response.qtpl:38
-func QueryResponse(rs []netstorage.Result, qt *querytracer.Tracer, qtDone func()) string {
-//line app/vmselect/prometheus/query_response.qtpl:38
+//line app/vmselect/prometheus/query_response.qtpl:41
+func QueryResponse(rs []netstorage.Result, isPartial bool, qt *querytracer.Tracer, qtDone func()) string {
+//line app/vmselect/prometheus/query_response.qtpl:41
 	qb422016 := qt422016.AcquireByteBuffer()
-//line app/vmselect/prometheus/query_response.qtpl:38
-	WriteQueryResponse(qb422016, rs, qt, qtDone)
-//line app/vmselect/prometheus/query_response.qtpl:38
+//line app/vmselect/prometheus/query_response.qtpl:41
+	WriteQueryResponse(qb422016, rs, isPartial, qt, qtDone)
+//line app/vmselect/prometheus/query_response.qtpl:41
 	qs422016 := string(qb422016.B)
-//line app/vmselect/prometheus/query_response.qtpl:38
+//line app/vmselect/prometheus/query_response.qtpl:41
 	qt422016.ReleaseByteBuffer(qb422016)
-//line app/vmselect/prometheus/query_response.qtpl:38
+//line app/vmselect/prometheus/query_response.qtpl:41
 	return qs422016
-//line app/vmselect/prometheus/query_response.qtpl:38
+//line app/vmselect/prometheus/query_response.qtpl:41
 }
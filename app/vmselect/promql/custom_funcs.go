@@ -0,0 +1,128 @@
+package promql
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/VictoriaMetrics/metricsql"
+)
+
+// Custom functions are stored separately from built-in functions, so built-in functions are never modified.
+//
+// The maps are modified only before the query execution starts - see closeCustomFunctionsRegistration.
+// So they can be read without locking during query execution.
+//
+// Custom functions should be registered in the MetricsQL parser via metricsql.RegisterFunction, so the parser
+// and the evaluator share the same set of functions. But the vendored github.com/VictoriaMetrics/metricsql v0.43.0
+// has no API for registering functions, so the parser treats custom functions as unknown functions:
+// they are parsed as ordinary function calls, while label filters aren't pushed down into their args.
+// The evaluator must stay consistent with this - custom rollup functions need special handling when searching
+// for rollup arg - see getRollupArgIdx.
+// Register custom functions in metricsql as well when it provides such an API.
+var (
+	customTransformFuncs = map[string]transformFunc{}
+	customRollupFuncs    = map[string]newRollupFunc{}
+)
+
+var (
+	customFuncsLock sync.Mutex
+
+	// customFuncsRegistrationClosed is set when the query execution may start, so custom functions cannot be registered anymore.
+	customFuncsRegistrationClosed bool
+)
+
+// closeCustomFunctionsRegistration prevents from registering custom functions after the query execution may start.
+func closeCustomFunctionsRegistration() {
+	customFuncsLock.Lock()
+	customFuncsRegistrationClosed = true
+	customFuncsLock.Unlock()
+}
+
+// RegisterTransformFunction registers transform function with the given name for using in MetricsQL queries.
+//
+// The registered function accepts a single arg and applies f to every value of every time series returned by the arg.
+// For example, `name(some_metric)` returns some_metric with f applied to its values.
+//
+// Built-in MetricsQL functions cannot be overridden, so an error is returned if the name clashes with built-in function
+// or with already registered function.
+//
+// RegisterTransformFunction must be called from init() function of the package with custom functions.
+// An error is returned if it is called after InitRollupResultCache.
+func RegisterTransformFunction(name string, f func(v float64) float64) error {
+	customFuncsLock.Lock()
+	defer customFuncsLock.Unlock()
+
+	name, err := checkCustomFunctionNameLocked(name)
+	if err != nil {
+		return err
+	}
+	customTransformFuncs[name] = newTransformFuncOneArg(f)
+	return nil
+}
+
+// RegisterRollupFunction registers rollup function with the given name for using in MetricsQL queries.
+//
+// The registered function accepts a single arg with optional lookbehind window in square brackets
+// and calculates f over raw samples on the window for every point on the graph like other rollup functions do.
+// For example, `name(some_metric[5m])` returns f results over some_metric samples on 5 minute windows.
+// values and timestamps passed to f have the same length and are sorted by timestamps. They are never empty.
+// f mustn't hold references to values and timestamps after returning.
+//
+// Built-in MetricsQL functions cannot be overridden, so an error is returned if the name clashes with built-in function
+// or with already registered function.
+//
+// RegisterRollupFunction must be called from init() function of the package with custom functions.
+// An error is returned if it is called after InitRollupResultCache.
+func RegisterRollupFunction(name string, f func(values []float64, timestamps []int64) float64) error {
+	customFuncsLock.Lock()
+	defer customFuncsLock.Unlock()
+
+	name, err := checkCustomFunctionNameLocked(name)
+	if err != nil {
+		return err
+	}
+	rf := func(rfa *rollupFuncArg) float64 {
+		// There is no need in handling NaNs here, since they must be cleaned up
+		// before calling rollup funcs.
+		if len(rfa.values) == 0 {
+			return nan
+		}
+		return f(rfa.values, rfa.timestamps)
+	}
+	customRollupFuncs[name] = newRollupFuncOneArg(rf)
+	return nil
+}
+
+// getRollupArgIdx returns the index of the arg for rollup function call fe.
+//
+// It takes into account functions registered via RegisterRollupFunction.
+func getRollupArgIdx(fe *metricsql.FuncExpr) int {
+	if customRollupFuncs[strings.ToLower(fe.Name)] != nil {
+		return 0
+	}
+	return metricsql.GetRollupArgIdx(fe)
+}
+
+func checkCustomFunctionNameLocked(name string) (string, error) {
+	if customFuncsRegistrationClosed {
+		return "", fmt.Errorf("cannot register function %q after the query execution is started; register it from init() function instead", name)
+	}
+	if name == "" {
+		return "", fmt.Errorf("function name cannot be empty")
+	}
+	for _, c := range name {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return "", fmt.Errorf("function name %q may contain only letters, digits and underscores", name)
+		}
+	}
+	if c := name[0]; c >= '0' && c <= '9' {
+		return "", fmt.Errorf("function name %q cannot start with digit", name)
+	}
+	name = strings.ToLower(name)
+	if rollupFuncs[name] != nil || transformFuncs[name] != nil || aggrFuncs[name] != nil ||
+		customRollupFuncs[name] != nil || customTransformFuncs[name] != nil {
+		return "", fmt.Errorf("cannot register function %q, since it clashes with the existing function", name)
+	}
+	return name, nil
+}
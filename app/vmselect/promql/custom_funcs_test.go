@@ -0,0 +1,142 @@
+package promql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/metricsql"
+)
+
+func init() {
+	if err := RegisterTransformFunction("test_custom_double", func(v float64) float64 { return 2 * v }); err != nil {
+		panic(err)
+	}
+	err := RegisterRollupFunction("test_custom_samples_count", func(values []float64, timestamps []int64) float64 {
+		return float64(len(values))
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRegisterFunctionFailure(t *testing.T) {
+	f := func(name string) {
+		t.Helper()
+		if err := RegisterTransformFunction(name, func(v float64) float64 { return v }); err == nil {
+			t.Fatalf("expecting non-nil error when registering transform function %q", name)
+		}
+		rf := func(values []float64, timestamps []int64) float64 { return 0 }
+		if err := RegisterRollupFunction(name, rf); err == nil {
+			t.Fatalf("expecting non-nil error when registering rollup function %q", name)
+		}
+	}
+	// Invalid names
+	f("")
+	f("1foo")
+	f("foo-bar")
+	f("foo bar")
+
+	// Built-in transform, label manipulation, rollup and aggregate functions
+	f("abs")
+	f("ABS")
+	f("label_set")
+	f("rate")
+	f("sum_over_time")
+	f("sum")
+	f("topk")
+
+	// Already registered functions
+	f("test_custom_double")
+	f("test_custom_samples_count")
+}
+
+func TestRegisterFunctionAfterRegistrationClosed(t *testing.T) {
+	customFuncsLock.Lock()
+	prevClosed := customFuncsRegistrationClosed
+	customFuncsLock.Unlock()
+	defer func() {
+		customFuncsLock.Lock()
+		customFuncsRegistrationClosed = prevClosed
+		customFuncsLock.Unlock()
+	}()
+
+	closeCustomFunctionsRegistration()
+	if err := RegisterTransformFunction("test_custom_closed", func(v float64) float64 { return v }); err == nil {
+		t.Fatalf("expecting non-nil error when registering transform function after the registration is closed")
+	}
+	rf := func(values []float64, timestamps []int64) float64 { return 0 }
+	if err := RegisterRollupFunction("test_custom_closed", rf); err == nil {
+		t.Fatalf("expecting non-nil error when registering rollup function after the registration is closed")
+	}
+	if getTransformFunc("test_custom_closed") != nil || getRollupFunc("test_custom_closed") != nil {
+		t.Fatalf("unexpected function registered after the registration is closed")
+	}
+}
+
+func TestExecCustomFunctions(t *testing.T) {
+	f := func(q string, resultExpected []netstorage.Result) {
+		t.Helper()
+		ec := &EvalConfig{
+			Start:       1000e3,
+			End:         2000e3,
+			Step:        200e3,
+			MaxSeries:   1000,
+			Deadline:    searchutils.NewDeadline(time.Now(), time.Minute, ""),
+			RoundDigits: 100,
+		}
+		result, err := Exec(nil, ec, q, false)
+		if err != nil {
+			t.Fatalf(`unexpected error when executing %q: %s`, q, err)
+		}
+		testResultsEqual(t, result, resultExpected)
+	}
+	timestampsExpected := []int64{1000e3, 1200e3, 1400e3, 1600e3, 1800e3, 2000e3}
+
+	f(`test_custom_double(time())`, []netstorage.Result{{
+		MetricName: storage.MetricName{},
+		Values:     []float64{2000, 2400, 2800, 3200, 3600, 4000},
+		Timestamps: timestampsExpected,
+	}})
+	f(`TEST_CUSTOM_DOUBLE(time() + 1)`, []netstorage.Result{{
+		MetricName: storage.MetricName{},
+		Values:     []float64{2002, 2402, 2802, 3202, 3602, 4002},
+		Timestamps: timestampsExpected,
+	}})
+	f(`test_custom_samples_count(time()[200s:50s])`, []netstorage.Result{{
+		MetricName: storage.MetricName{},
+		Values:     []float64{4, 4, 4, 4, 4, 4},
+		Timestamps: timestampsExpected,
+	}})
+	f(`test_custom_double(test_custom_samples_count(time()[200s:50s]))`, []netstorage.Result{{
+		MetricName: storage.MetricName{},
+		Values:     []float64{8, 8, 8, 8, 8, 8},
+		Timestamps: timestampsExpected,
+	}})
+}
+
+func TestCustomFunctionsParser(t *testing.T) {
+	f := func(q, resultExpected string, rollupArgIdxExpected int) {
+		t.Helper()
+		e, err := metricsql.Parse(q)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", q, err)
+		}
+		// Label filters mustn't be pushed down into args of custom functions, since the parser doesn't know their semantics.
+		if s := string(metricsql.Optimize(e).AppendString(nil)); s != resultExpected {
+			t.Fatalf("unexpected optimized query for %q;\ngot\n%s\nwant\n%s", q, s, resultExpected)
+		}
+		fe, ok := e.(*metricsql.BinaryOpExpr).Left.(*metricsql.FuncExpr)
+		if !ok {
+			t.Fatalf("expecting function call at the left side of %q", q)
+		}
+		if n := getRollupArgIdx(fe); n != rollupArgIdxExpected {
+			t.Fatalf("unexpected rollup arg index for %q; got %d; want %d", q, n, rollupArgIdxExpected)
+		}
+	}
+	f(`test_custom_samples_count(foo[5m]) + bar{x="y"}`, `test_custom_samples_count(foo[5m]) + bar{x="y"}`, 0)
+	f(`TEST_CUSTOM_SAMPLES_COUNT(foo[5m]) + bar{x="y"}`, `TEST_CUSTOM_SAMPLES_COUNT(foo[5m]) + bar{x="y"}`, 0)
+	f(`test_custom_double(foo) + bar{x="y"}`, `test_custom_double(foo) + bar{x="y"}`, -1)
+}
@@ -0,0 +1,90 @@
+package promql
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/metricsql"
+)
+
+// checkEnforcedTagFilters verifies that label filters in e don't conflict with the enforced label filters from etfs.
+//
+// Enforced label filters are set via `extra_label` and `extra_filters[]` query args by auth proxies
+// in order to restrict the query to the given tenant. They are added to every series selector in the query,
+// so a conflicting label filter such as `{team="Y"}` for enforced `{team="X"}` never selects any series.
+// Return an explicit error for such queries instead of silently returning empty results.
+func checkEnforcedTagFilters(e metricsql.Expr, etfs [][]storage.TagFilter) error {
+	enforced := GetEnforcedLabels(etfs)
+	if len(enforced) == 0 {
+		return nil
+	}
+	var err error
+	metricsql.VisitAll(e, func(expr metricsql.Expr) {
+		if err != nil {
+			return
+		}
+		me, ok := expr.(*metricsql.MetricExpr)
+		if !ok {
+			return
+		}
+		for i := range me.LabelFilters {
+			lf := &me.LabelFilters[i]
+			value, ok := enforced[lf.Label]
+			if !ok {
+				continue
+			}
+			if !matchLabelFilter(lf, value) {
+				err = fmt.Errorf("label filter %s in %s conflicts with the enforced label filter %s=%q",
+					lf.AppendString(nil), me.AppendString(nil), lf.Label, value)
+				return
+			}
+		}
+	})
+	return err
+}
+
+// GetEnforcedLabels returns label values, which are enforced with `name="value"` filters in every etfs item.
+func GetEnforcedLabels(etfs [][]storage.TagFilter) map[string]string {
+	if len(etfs) == 0 {
+		return nil
+	}
+	var m map[string]string
+	for i, tfs := range etfs {
+		mLocal := make(map[string]string)
+		for _, tf := range tfs {
+			if tf.IsNegative || tf.IsRegexp {
+				continue
+			}
+			key := string(tf.Key)
+			if key == "" {
+				key = "__name__"
+			}
+			value := string(tf.Value)
+			if i > 0 {
+				if prevValue, ok := m[key]; !ok || prevValue != value {
+					continue
+				}
+			}
+			mLocal[key] = value
+		}
+		m = mLocal
+	}
+	return m
+}
+
+// matchLabelFilter returns true if lf matches the given label value.
+func matchLabelFilter(lf *metricsql.LabelFilter, value string) bool {
+	var ok bool
+	if lf.IsRegexp {
+		re, err := regexp.Compile("^(?:" + lf.Value + ")$")
+		if err != nil {
+			// Invalid regexps are reported during the query execution.
+			return true
+		}
+		ok = re.MatchString(value)
+	} else {
+		ok = lf.Value == value
+	}
+	return ok != lf.IsNegative
+}
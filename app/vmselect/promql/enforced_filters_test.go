@@ -0,0 +1,102 @@
+package promql
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/metricsql"
+)
+
+func getEnforcedTagFilters(t *testing.T, extraLabels, extraFilters []string) [][]storage.TagFilter {
+	t.Helper()
+	r := &http.Request{
+		Form: url.Values{
+			"extra_label":     extraLabels,
+			"extra_filters[]": extraFilters,
+		},
+	}
+	etfs, err := searchutils.GetExtraTagFilters(r)
+	if err != nil {
+		t.Fatalf("unexpected error in GetExtraTagFilters: %s", err)
+	}
+	return etfs
+}
+
+func TestEnforcedTagFiltersInjected(t *testing.T) {
+	f := func(q string, extraLabels []string, resultExpected string) {
+		t.Helper()
+		etfs := getEnforcedTagFilters(t, extraLabels, nil)
+		tfs, err := searchutils.ParseMetricSelector(q)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", q, err)
+		}
+		tfss := searchutils.JoinTagFilterss([][]storage.TagFilter{tfs}, etfs)
+		if len(tfss) != 1 {
+			t.Fatalf("unexpected number of filter groups; got %d; want 1", len(tfss))
+		}
+		var result []byte
+		for _, tf := range tfss[0] {
+			result = append(result, tf.String()...)
+			result = append(result, ',')
+		}
+		if string(result) != resultExpected {
+			t.Fatalf("unexpected filters for %q with extra_label=%q;\ngot\n%s\nwant\n%s", q, extraLabels, result, resultExpected)
+		}
+	}
+	f(`foo`, []string{"team=X"}, `__name__="foo",team="X",`)
+	f(`foo{job="bar"}`, []string{"team=X"}, `__name__="foo",job="bar",team="X",`)
+
+	// Matching filter for the enforced label doesn't remove the enforced filter
+	f(`foo{team=~".*"}`, []string{"team=X"}, `__name__="foo",team=~".*",team="X",`)
+}
+
+func TestCheckEnforcedTagFiltersSuccess(t *testing.T) {
+	f := func(q string, extraLabels, extraFilters []string) {
+		t.Helper()
+		e, err := metricsql.Parse(q)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", q, err)
+		}
+		etfs := getEnforcedTagFilters(t, extraLabels, extraFilters)
+		if err := checkEnforcedTagFilters(e, etfs); err != nil {
+			t.Fatalf("unexpected error for %q: %s", q, err)
+		}
+	}
+	f(`foo`, nil, nil)
+	f(`foo{team="Y"}`, nil, nil)
+	f(`foo`, []string{"team=X"}, nil)
+	f(`foo{job="bar"}`, []string{"team=X"}, nil)
+	f(`foo{team="X"}`, []string{"team=X"}, nil)
+	f(`foo{team=~"X|Y"}`, []string{"team=X"}, nil)
+	f(`foo{team!="Y"}`, []string{"team=X"}, nil)
+	f(`foo{team!~"Y.*"}`, []string{"team=X"}, nil)
+	f(`sum(rate(foo{team="X"}[5m])) / sum(rate(bar[5m]))`, []string{"team=X"}, nil)
+
+	// Label filters from extra_filters[] with different values aren't enforced
+	f(`foo{env="dev"}`, nil, []string{`{env="prod"}`, `{env="staging"}`})
+}
+
+func TestCheckEnforcedTagFiltersFailure(t *testing.T) {
+	f := func(q string, extraLabels, extraFilters []string) {
+		t.Helper()
+		e, err := metricsql.Parse(q)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", q, err)
+		}
+		etfs := getEnforcedTagFilters(t, extraLabels, extraFilters)
+		if err := checkEnforcedTagFilters(e, etfs); err == nil {
+			t.Fatalf("expecting non-nil error for %q", q)
+		}
+	}
+	f(`foo{team="Y"}`, []string{"team=X"}, nil)
+	f(`foo{team=""}`, []string{"team=X"}, nil)
+	f(`foo{team!="X"}`, []string{"team=X"}, nil)
+	f(`foo{team=~"Y|Z"}`, []string{"team=X"}, nil)
+	f(`foo{team!~"X|Y"}`, []string{"team=X"}, nil)
+	f(`sum(rate(foo[5m])) / sum(rate(bar{team="Y"}[5m]))`, []string{"team=X"}, nil)
+	f(`foo{team="Y"}`, []string{"team=X"}, []string{`{env="prod"}`, `{env="dev"}`})
+	f(`foo{env="dev"}`, nil, []string{`{env="prod",team="X"}`})
+}
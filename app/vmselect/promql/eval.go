@@ -8,6 +8,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
@@ -65,6 +66,18 @@ func AdjustStartEnd(start, end, step int64) (int64, int64) {
 
 	// Round start and end to values divisible by step in order
 	// to enable response caching (see EvalConfig.mayCache).
+	return AlignStartEnd(start, end, step)
+}
+
+// AlignStartEnd aligns start and end to values divisible by step.
+//
+// The alignment anchor is Unix epoch (1970-01-01T00:00:00Z), so queries with distinct steps
+// return points with the same timestamps where the steps coincide. For example, every point for the query
+// with step=1m has a matching point for the query with step=30s.
+//
+// The number of points between the returned start and end doesn't exceed the initial number of points.
+func AlignStartEnd(start, end, step int64) (int64, int64) {
+	points := (end-start)/step + 1
 	start, end = alignStartEnd(start, end, step)
 
 	// Make sure that the new number of points is the same as the initial number of points.
@@ -112,9 +125,22 @@ type EvalConfig struct {
 	// How many decimal digits after the point to leave in response.
 	RoundDigits int
 
+	// PrometheusExtrapolation enables Prometheus-compatible extrapolation in rate(), increase() and delta() functions.
+	PrometheusExtrapolation bool
+
 	// EnforcedTagFilterss may contain additional label filters to use in the query.
 	EnforcedTagFilterss [][]storage.TagFilter
 
+	// AllowPartialResponse allows returning partial results instead of an error when Deadline is exceeded.
+	//
+	// Partial results contain only time series, which were processed before the Deadline.
+	AllowPartialResponse bool
+
+	// isPartialResponse is set to 1 if the query results are partial.
+	//
+	// It is shared among all the EvalConfig copies for the given query.
+	isPartialResponse *uint32
+
 	timestamps     []int64
 	timestampsOnce sync.Once
 }
@@ -130,7 +156,10 @@ func copyEvalConfig(src *EvalConfig) *EvalConfig {
 	ec.MayCache = src.MayCache
 	ec.LookbackDelta = src.LookbackDelta
 	ec.RoundDigits = src.RoundDigits
+	ec.PrometheusExtrapolation = src.PrometheusExtrapolation
 	ec.EnforcedTagFilterss = src.EnforcedTagFilterss
+	ec.AllowPartialResponse = src.AllowPartialResponse
+	ec.isPartialResponse = src.isPartialResponse
 
 	// do not copy src.timestamps - they must be generated again.
 	return &ec
@@ -145,6 +174,24 @@ func (ec *EvalConfig) validate() {
 	}
 }
 
+// IsPartialResponse returns true if the query results are partial because of exceeded Deadline.
+//
+// It may return true only if AllowPartialResponse is set.
+func (ec *EvalConfig) IsPartialResponse() bool {
+	return ec.isPartialResponse != nil && atomic.LoadUint32(ec.isPartialResponse) != 0
+}
+
+// mayReturnPartialResponse returns true if partial results can be returned instead of an error because of exceeded Deadline.
+//
+// It marks the query results as partial in this case.
+func (ec *EvalConfig) mayReturnPartialResponse() bool {
+	if !ec.AllowPartialResponse || ec.isPartialResponse == nil || !ec.Deadline.Exceeded() {
+		return false
+	}
+	atomic.StoreUint32(ec.isPartialResponse, 1)
+	return true
+}
+
 func (ec *EvalConfig) mayCache() bool {
 	if *disableCache {
 		return false
@@ -232,7 +279,7 @@ func evalExprInternal(qt *querytracer.Tracer, ec *EvalConfig, e metricsql.Expr)
 		return rv, nil
 	}
 	if fe, ok := e.(*metricsql.FuncExpr); ok {
-		nrf := getRollupFunc(fe.Name)
+		nrf := getRollupFuncExt(fe.Name, ec.PrometheusExtrapolation)
 		if nrf == nil {
 			qtChild := qt.NewChild()
 			rv, err := evalTransformFunc(qtChild, ec, fe)
@@ -305,7 +352,7 @@ func evalTransformFunc(qt *querytracer.Tracer, ec *EvalConfig, fe *metricsql.Fun
 
 func evalAggrFunc(qt *querytracer.Tracer, ec *EvalConfig, ae *metricsql.AggrFuncExpr) ([]*timeseries, error) {
 	if callbacks := getIncrementalAggrFuncCallbacks(ae.Name); callbacks != nil {
-		fe, nrf := tryGetArgRollupFuncWithMetricExpr(ae)
+		fe, nrf := tryGetArgRollupFuncWithMetricExpr(ec, ae)
 		if fe != nil {
 			// There is an optimized path for calculating metricsql.AggrFuncExpr over rollupFunc over metricsql.MetricExpr.
 			// The optimized path saves RAM for aggregates over big number of time series.
@@ -478,7 +525,7 @@ func joinRegexpValues(a []string) string {
 	return string(b)
 }
 
-func tryGetArgRollupFuncWithMetricExpr(ae *metricsql.AggrFuncExpr) (*metricsql.FuncExpr, newRollupFunc) {
+func tryGetArgRollupFuncWithMetricExpr(ec *EvalConfig, ae *metricsql.AggrFuncExpr) (*metricsql.FuncExpr, newRollupFunc) {
 	if len(ae.Args) != 1 {
 		return nil, nil
 	}
@@ -517,11 +564,11 @@ func tryGetArgRollupFuncWithMetricExpr(ae *metricsql.AggrFuncExpr) (*metricsql.F
 	if !ok {
 		return nil, nil
 	}
-	nrf := getRollupFunc(fe.Name)
+	nrf := getRollupFuncExt(fe.Name, ec.PrometheusExtrapolation)
 	if nrf == nil {
 		return nil, nil
 	}
-	rollupArgIdx := metricsql.GetRollupArgIdx(fe)
+	rollupArgIdx := getRollupArgIdx(fe)
 	if rollupArgIdx >= len(fe.Args) {
 		// Incorrect number of args for rollup func.
 		return nil, nil
@@ -561,7 +608,7 @@ func evalExprs(qt *querytracer.Tracer, ec *EvalConfig, es []metricsql.Expr) ([][
 
 func evalRollupFuncArgs(qt *querytracer.Tracer, ec *EvalConfig, fe *metricsql.FuncExpr) ([]interface{}, *metricsql.RollupExpr, error) {
 	var re *metricsql.RollupExpr
-	rollupArgIdx := metricsql.GetRollupArgIdx(fe)
+	rollupArgIdx := getRollupArgIdx(fe)
 	if len(fe.Args) <= rollupArgIdx {
 		return nil, nil, fmt.Errorf("expecting at least %d args to %q; got %d args; expr: %q", rollupArgIdx+1, fe.Name, len(fe.Args), fe.AppendString(nil))
 	}
@@ -849,6 +896,9 @@ var (
 	rollupResultCacheFullHits    = metrics.NewCounter(`vm_rollup_result_cache_full_hits_total`)
 	rollupResultCachePartialHits = metrics.NewCounter(`vm_rollup_result_cache_partial_hits_total`)
 	rollupResultCacheMiss        = metrics.NewCounter(`vm_rollup_result_cache_miss_total`)
+
+	lastValueCacheHits   = metrics.NewCounter(`vm_last_value_cache_hits_total`)
+	lastValueCacheMisses = metrics.NewCounter(`vm_last_value_cache_misses_total`)
 )
 
 func evalRollupFuncWithMetricExpr(qt *querytracer.Tracer, ec *EvalConfig, funcName string, rf rollupFunc,
@@ -863,6 +913,11 @@ func evalRollupFuncWithMetricExpr(qt *querytracer.Tracer, ec *EvalConfig, funcNa
 		return evalNumber(ec, nan), nil
 	}
 
+	// Try serving instant query from the cache for the last ingested values.
+	if tss, ok := evalRollupFromLastValues(qt, ec, funcName, me, iafc, window); ok {
+		return tss, nil
+	}
+
 	// Search for partial results in cache.
 	tssCached, start := rollupResultCacheV.Get(qt, ec, expr, window)
 	if start > ec.End {
@@ -894,9 +949,14 @@ func evalRollupFuncWithMetricExpr(qt *querytracer.Tracer, ec *EvalConfig, funcNa
 		minTimestamp -= ec.Step
 	}
 	sq := storage.NewSearchQuery(minTimestamp, ec.End, tfss, ec.MaxSeries)
+	sq.EnforcedTagFilterss = ec.EnforcedTagFilterss
 	rss, err := netstorage.ProcessSearchQuery(qt, sq, true, ec.Deadline)
 	if err != nil {
-		return nil, err
+		if !ec.mayReturnPartialResponse() {
+			return nil, err
+		}
+		qt.Printf("return partial results, since no series were fetched before the timeout: %s", err)
+		return mergeTimeseries(tssCached, nil, start, ec), nil
 	}
 	rssLen := rss.Len()
 	if rssLen == 0 {
@@ -949,14 +1009,89 @@ func evalRollupFuncWithMetricExpr(qt *querytracer.Tracer, ec *EvalConfig, funcNa
 	} else {
 		tss, err = evalRollupNoIncrementalAggregate(qt, funcName, keepMetricNames, rss, rcs, preFunc, sharedTimestamps)
 	}
+	isPartial := false
 	if err != nil {
-		return nil, err
+		if !ec.mayReturnPartialResponse() {
+			return nil, err
+		}
+		qt.Printf("return partial results with series processed before the timeout: %s", err)
+		isPartial = true
 	}
 	tss = mergeTimeseries(tssCached, tss, start, ec)
-	rollupResultCacheV.Put(qt, ec, expr, window, tss)
+	if !isPartial {
+		// Do not cache partial results, since they miss some series.
+		rollupResultCacheV.Put(qt, ec, expr, window, tss)
+	}
 	return tss, nil
 }
 
+// evalRollupFromLastValues evaluates default_rollup() over series matching me for instant query at ec.End
+// from the cache for the last ingested values.
+//
+// false is returned if the query cannot be served from the cache. The query must be evaluated in the regular way in this case.
+func evalRollupFromLastValues(qt *querytracer.Tracer, ec *EvalConfig, funcName string, me *metricsql.MetricExpr,
+	iafc *incrementalAggrFuncContext, window int64) ([]*timeseries, bool) {
+	if funcName != "default_rollup" || ec.Start != ec.End || !ec.MayCache {
+		return nil, false
+	}
+	qt = qt.NewChild()
+	defer qt.Donef("evaluate instant query from the cache for the last values")
+
+	tfs := searchutils.ToTagFilters(me.LabelFilters)
+	tfss := searchutils.JoinTagFilterss([][]storage.TagFilter{tfs}, ec.EnforcedTagFilterss)
+	minTimestamp := ec.Start - maxSilenceInterval
+	if window > ec.Step {
+		minTimestamp -= window
+	} else {
+		minTimestamp -= ec.Step
+	}
+	sq := storage.NewSearchQuery(minTimestamp, ec.End, tfss, ec.MaxSeries)
+	sq.EnforcedTagFilterss = ec.EnforcedTagFilterss
+
+	// The last value must be located inside the minimum window used by rollupConfig.doInternal for default_rollup().
+	// The window may be only extended there, so the last value inside the minimum window is the result of default_rollup().
+	if window <= 0 {
+		window = ec.Step
+		if ec.LookbackDelta > 0 && window > ec.LookbackDelta {
+			window = ec.LookbackDelta
+		}
+	}
+	lvs, ok, err := netstorage.SearchLastValues(qt, sq, ec.End-window+1, ec.Deadline)
+	if err != nil {
+		qt.Printf("cannot obtain the last values from the cache: %s", err)
+		return nil, false
+	}
+	if !ok {
+		lastValueCacheMisses.Inc()
+		return nil, false
+	}
+	lastValueCacheHits.Inc()
+
+	// The last value may be Prometheus staleness mark. It is returned as is in the same way as rollupDefault does,
+	// so the series is removed from the response.
+	sharedTimestamps := ec.getSharedTimestamps()
+	tss := make([]*timeseries, 0, len(lvs))
+	for i := range lvs {
+		lv := &lvs[i]
+		ts := &timeseries{
+			MetricName: lv.MetricName,
+			Values:     []float64{lv.Value},
+			Timestamps: sharedTimestamps,
+			denyReuse:  true,
+		}
+		if iafc != nil {
+			iafc.updateTimeseries(ts, 0)
+			continue
+		}
+		tss = append(tss, ts)
+	}
+	if iafc != nil {
+		tss = iafc.finalizeTimeseries()
+	}
+	qt.Printf("series: %d", len(tss))
+	return tss, true
+}
+
 var (
 	rollupMemoryLimiter     memoryLimiter
 	rollupMemoryLimiterOnce sync.Once
@@ -997,12 +1132,10 @@ func evalRollupWithIncrementalAggregate(qt *querytracer.Tracer, funcName string,
 		}
 		return nil
 	})
-	if err != nil {
-		return nil, err
-	}
+	// Return the series aggregated so far together with err, so they could be used as partial results.
 	tss := iafc.finalizeTimeseries()
 	qt.Printf("series after aggregation with %s(): %d", iafc.ae.Name, len(tss))
-	return tss, nil
+	return tss, err
 }
 
 func evalRollupNoIncrementalAggregate(qt *querytracer.Tracer, funcName string, keepMetricNames bool, rss *netstorage.Results, rcs []*rollupConfig,
@@ -1030,10 +1163,8 @@ func evalRollupNoIncrementalAggregate(qt *querytracer.Tracer, funcName string, k
 		}
 		return nil
 	})
-	if err != nil {
-		return nil, err
-	}
-	return tss, nil
+	// Return the series processed so far together with err, so they could be used as partial results.
+	return tss, err
 }
 
 func doRollupForTimeseries(funcName string, keepMetricNames bool, rc *rollupConfig, tsDst *timeseries, mnSrc *storage.MetricName,
@@ -1,8 +1,19 @@
 package promql
 
 import (
+	"flag"
+	"fmt"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/prometheus"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 	"github.com/VictoriaMetrics/metricsql"
@@ -48,3 +59,279 @@ m2{b="bar"} 1`, `{}`)
 	f(`m1{a="foo",b="bar"} 1
 m2{b="bar",c="x"} 1`, `{b="bar"}`)
 }
+
+func TestAlignStartEnd(t *testing.T) {
+	f := func(start, end, step, startExpected, endExpected int64) {
+		t.Helper()
+		startAligned, endAligned := AlignStartEnd(start, end, step)
+		if startAligned != startExpected || endAligned != endExpected {
+			t.Fatalf("unexpected result for AlignStartEnd(%d, %d, %d); got (%d, %d); want (%d, %d)",
+				start, end, step, startAligned, endAligned, startExpected, endExpected)
+		}
+	}
+
+	// Already aligned
+	f(1000, 5000, 1000, 1000, 5000)
+
+	// Unaligned start and end
+	f(1234, 5234, 1000, 1000, 5000)
+	f(1999, 5001, 1000, 1000, 4000)
+	f(1001, 5999, 1000, 1000, 5000)
+
+	// The number of points mustn't increase after the alignment
+	f(1500, 2500, 1000, 1000, 2000)
+	f(1500, 1500, 1000, 1000, 1000)
+}
+
+func TestAlignStartEndDistinctSteps(t *testing.T) {
+	f := func(start, end, step1, step2 int64) {
+		t.Helper()
+		start1, end1 := AlignStartEnd(start, end, step1)
+		start2, end2 := AlignStartEnd(start, end, step2)
+		timestamps1 := getTimestamps(start1, end1, step1)
+		timestamps2 := getTimestamps(start2, end2, step2)
+		m := make(map[int64]bool, len(timestamps1))
+		for _, ts := range timestamps1 {
+			m[ts] = true
+		}
+		// Every timestamp for the bigger step must have a matching timestamp for the smaller step
+		// on the common time range.
+		commonStart, commonEnd := start1, end1
+		if start2 > commonStart {
+			commonStart = start2
+		}
+		if end2 < commonEnd {
+			commonEnd = end2
+		}
+		matches := 0
+		for _, ts := range timestamps2 {
+			if ts < commonStart || ts > commonEnd {
+				continue
+			}
+			if !m[ts] {
+				t.Fatalf("timestamp %d for step=%d has no matching timestamp for step=%d; start=%d, end=%d", ts, step2, step1, start, end)
+			}
+			matches++
+		}
+		if matches == 0 {
+			t.Fatalf("expecting at least a single matching timestamp for step=%d and step=%d; start=%d, end=%d", step1, step2, start, end)
+		}
+	}
+
+	// Panels for the same dashboard with distinct steps: 15s, 30s, 1m, 5m and 1h
+	start := int64(1650000123456)
+	end := start + 24*3600*1000
+	f(start, end, 15e3, 30e3)
+	f(start, end, 15e3, 60e3)
+	f(start, end, 30e3, 60e3)
+	f(start, end, 60e3, 300e3)
+	f(start, end, 60e3, 3600e3)
+	f(start+7, end+13, 15e3, 3600e3)
+}
+
+func TestPartialResponseOnTimeout(t *testing.T) {
+	const seriesCount = 1000
+
+	dataPath := "TestPartialResponseOnTimeout"
+	defer fs.MustRemoveAll(dataPath)
+	prevDataPath := *vmstorage.DataPath
+	*vmstorage.DataPath = dataPath
+	defer func() {
+		*vmstorage.DataPath = prevDataPath
+	}()
+	netstorage.InitTmpBlocksDir(dataPath)
+	vmstorage.InitWithoutMetrics(func(mrs []storage.MetricRow) {})
+	defer vmstorage.Stop()
+
+	timestamp := time.Now().UnixNano() / 1e6
+	var mrs []storage.MetricRow
+	for i := 0; i < seriesCount; i++ {
+		mrs = append(mrs, storage.MetricRow{
+			MetricNameRaw: storage.MarshalMetricNameRaw(nil, []prompb.Label{
+				{Name: []byte("__name__"), Value: []byte("foo")},
+				{Name: []byte("instance"), Value: []byte(fmt.Sprintf("host-%d", i))},
+			}),
+			Timestamp: timestamp,
+			Value:     float64(i),
+		})
+	}
+	if err := vmstorage.AddRows(mrs); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+	vmstorage.Storage.DebugFlush()
+
+	newEvalConfig := func(deadline searchutils.Deadline, allowPartialResponse bool) *EvalConfig {
+		return &EvalConfig{
+			Start:                timestamp,
+			End:                  timestamp,
+			Step:                 60e3,
+			Deadline:             deadline,
+			RoundDigits:          100,
+			AllowPartialResponse: allowPartialResponse,
+		}
+	}
+	f := func(deadline searchutils.Deadline, allowPartialResponse bool, seriesCountExpected int, isPartialExpected bool) {
+		t.Helper()
+		ec := newEvalConfig(deadline, allowPartialResponse)
+		result, err := Exec(nil, ec, "foo", true)
+		if seriesCountExpected < 0 {
+			if err == nil {
+				t.Fatalf("expecting non-nil error")
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(result) != seriesCountExpected {
+			t.Fatalf("unexpected number of series; got %d; want %d", len(result), seriesCountExpected)
+		}
+		if isPartial := ec.IsPartialResponse(); isPartial != isPartialExpected {
+			t.Fatalf("unexpected isPartial; got %v; want %v", isPartial, isPartialExpected)
+		}
+	}
+
+	// The query fits the deadline.
+	f(searchutils.NewDeadline(time.Now(), time.Minute, ""), false, seriesCount, false)
+	f(searchutils.NewDeadline(time.Now(), time.Minute, ""), true, seriesCount, false)
+
+	// The deadline is exceeded before the query starts.
+	f(searchutils.NewDeadline(time.Now().Add(-time.Hour), time.Second, ""), false, -1, false)
+	f(searchutils.NewDeadline(time.Now().Add(-time.Hour), time.Second, ""), true, 0, true)
+
+	// Slow query must return series processed before the deadline.
+	const fastSeriesCount = 10
+	ec := newEvalConfig(searchutils.NewDeadline(time.Now(), time.Second, ""), true)
+	ec.isPartialResponse = new(uint32)
+	sq := storage.NewSearchQuery(timestamp-60e3, timestamp, [][]storage.TagFilter{{
+		{Key: nil, Value: []byte("foo")},
+	}}, 0)
+	rss, err := netstorage.ProcessSearchQuery(nil, sq, true, ec.Deadline)
+	if err != nil {
+		t.Fatalf("unexpected error in ProcessSearchQuery: %s", err)
+	}
+	sharedTimestamps := getTimestamps(ec.Start, ec.End, ec.Step)
+	expr := &metricsql.MetricExpr{}
+	preFunc, rcs, err := getRollupConfigs("default_rollup", rollupDefault, expr, ec.Start, ec.End, ec.Step, 0, 0, sharedTimestamps)
+	if err != nil {
+		t.Fatalf("cannot obtain rollup configs: %s", err)
+	}
+	var calls uint32
+	slowPreFunc := func(values []float64, timestamps []int64) {
+		// Stall processing after the first fastSeriesCount series, so the deadline is exceeded.
+		if atomic.AddUint32(&calls, 1) > fastSeriesCount {
+			time.Sleep(3500 * time.Millisecond)
+		}
+		preFunc(values, timestamps)
+	}
+	tss, err := evalRollupNoIncrementalAggregate(nil, "default_rollup", false, rss, rcs, slowPreFunc, sharedTimestamps)
+	if err == nil {
+		t.Fatalf("expecting non-nil error for the slow query")
+	}
+	if !ec.mayReturnPartialResponse() {
+		t.Fatalf("partial response must be allowed for the slow query")
+	}
+	if !ec.IsPartialResponse() {
+		t.Fatalf("the slow query response must be marked as partial")
+	}
+	if len(tss) < fastSeriesCount || len(tss) >= seriesCount {
+		t.Fatalf("unexpected number of series for the slow query; got %d; want [%d..%d)", len(tss), fastSeriesCount, seriesCount)
+	}
+}
+
+func TestEvalRollupFromLastValues(t *testing.T) {
+	dataPath := "TestEvalRollupFromLastValues"
+	defer fs.MustRemoveAll(dataPath)
+	prevDataPath := *vmstorage.DataPath
+	*vmstorage.DataPath = dataPath
+	defer func() {
+		*vmstorage.DataPath = prevDataPath
+	}()
+	if err := flag.Set("storage.lastValueCacheSize", "1000"); err != nil {
+		t.Fatalf("cannot set -storage.lastValueCacheSize: %s", err)
+	}
+	defer func() {
+		_ = flag.Set("storage.lastValueCacheSize", "0")
+	}()
+	netstorage.InitTmpBlocksDir(dataPath)
+	vmstorage.InitWithoutMetrics(func(mrs []storage.MetricRow) {})
+	defer vmstorage.Stop()
+
+	timestamp := time.Now().UnixNano() / 1e6
+	addRows := func(timestamp int64, values ...float64) {
+		t.Helper()
+		var mrs []storage.MetricRow
+		for i, v := range values {
+			mrs = append(mrs, storage.MetricRow{
+				MetricNameRaw: storage.MarshalMetricNameRaw(nil, []prompb.Label{
+					{Name: []byte("__name__"), Value: []byte("foo")},
+					{Name: []byte("instance"), Value: []byte(fmt.Sprintf("host-%d", i))},
+				}),
+				Timestamp: timestamp,
+				Value:     v,
+			})
+		}
+		if err := vmstorage.AddRows(mrs); err != nil {
+			t.Fatalf("cannot add rows: %s", err)
+		}
+		vmstorage.Storage.DebugFlush()
+	}
+	exec := func(q string, start int64, mayCache bool) string {
+		t.Helper()
+		ec := &EvalConfig{
+			Start:       start,
+			End:         start,
+			Step:        60e3,
+			Deadline:    searchutils.NewDeadline(time.Now(), time.Minute, ""),
+			MayCache:    mayCache,
+			RoundDigits: 100,
+		}
+		result, err := Exec(nil, ec, q, true)
+		if err != nil {
+			t.Fatalf("unexpected error when executing %q: %s", q, err)
+		}
+		var a []string
+		for _, r := range result {
+			a = append(a, fmt.Sprintf("%s %v", r.MetricName.String(), r.Values))
+		}
+		return strings.Join(a, ",")
+	}
+	f := func(q string, start int64, hit bool, resultExpected string) {
+		t.Helper()
+		hitsPrev := lastValueCacheHits.Get()
+		result := exec(q, start, true)
+		if hits := lastValueCacheHits.Get() - hitsPrev; hits != 0 != hit {
+			t.Fatalf("unexpected cache hits for %q; got %d; want hit=%v", q, hits, hit)
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected result for %q;\ngot\n%s\nwant\n%s", q, result, resultExpected)
+		}
+		// The result must match the result for the query without the cache.
+		if resultNoCache := exec(q, start, false); result != resultNoCache {
+			t.Fatalf("unexpected result for %q compared to the result without cache;\ngot\n%s\nwant\n%s", q, result, resultNoCache)
+		}
+	}
+
+	addRows(timestamp, 1, 2)
+	f("foo", timestamp, true, `foo{instance="host-0"} [1],foo{instance="host-1"} [2]`)
+	f("sum(foo)", timestamp, true, `{} [3]`)
+
+	// New writes must be reflected in the results.
+	addRows(timestamp+1000, 10, 20)
+	f("foo", timestamp+1000, true, `foo{instance="host-0"} [10],foo{instance="host-1"} [20]`)
+	f("sum(foo)", timestamp+1000, true, `{} [30]`)
+
+	// Queries at the time before the last sample cannot be served from the cache.
+	f("foo", timestamp, false, `foo{instance="host-0"} [1],foo{instance="host-1"} [2]`)
+
+	// Queries at the time outside the window for the last sample cannot be served from the cache.
+	f("foo", timestamp+1000+120e3, false, ``)
+
+	// Range queries and non-default rollup functions aren't served from the cache.
+	f("max_over_time(foo[1m])", timestamp+1000, false, `foo{instance="host-0"} [10],foo{instance="host-1"} [20]`)
+
+	// Series with the staleness mark as the last value must be removed from the results.
+	addRows(timestamp+2000, decimal.StaleNaN, 30)
+	f("foo", timestamp+2000, true, `foo{instance="host-1"} [30]`)
+	f("sum(foo)", timestamp+2000, true, `{} [30]`)
+}
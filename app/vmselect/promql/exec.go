@@ -39,7 +39,13 @@ func Exec(qt *querytracer.Tracer, ec *EvalConfig, q string, isFirstPointOnly boo
 	if err != nil {
 		return nil, err
 	}
+	if err := checkEnforcedTagFilters(e, ec.EnforcedTagFilterss); err != nil {
+		return nil, err
+	}
 
+	if ec.AllowPartialResponse && ec.isPartialResponse == nil {
+		ec.isPartialResponse = new(uint32)
+	}
 	qid := activeQueriesV.Add(ec, q)
 	rv, err := evalExpr(qt, ec, e)
 	activeQueriesV.Remove(qid)
@@ -1039,6 +1039,65 @@ func TestExecSuccess(t *testing.T) {
 		resultExpected := []netstorage.Result{r}
 		f(q, resultExpected)
 	})
+	t.Run("bytes_to_kib()", func(t *testing.T) {
+		t.Parallel()
+		q := `bytes_to_kib(alias(time()*1024, "foobar"))`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1000, 1200, 1400, 1600, 1800, 2000},
+			Timestamps: timestampsExpected,
+		}
+		r.MetricName.MetricGroup = []byte("foobar")
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
+	t.Run("bytes_to_gib()", func(t *testing.T) {
+		t.Parallel()
+		q := `bytes_to_gib(alias(time()*1024*1024*1024, "foobar"))`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1000, 1200, 1400, 1600, 1800, 2000},
+			Timestamps: timestampsExpected,
+		}
+		r.MetricName.MetricGroup = []byte("foobar")
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
+	t.Run("seconds_to_minutes()", func(t *testing.T) {
+		t.Parallel()
+		q := `seconds_to_minutes(alias(time()*60, "foobar"))`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1000, 1200, 1400, 1600, 1800, 2000},
+			Timestamps: timestampsExpected,
+		}
+		r.MetricName.MetricGroup = []byte("foobar")
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
+	t.Run("seconds_to_hours()", func(t *testing.T) {
+		t.Parallel()
+		q := `seconds_to_hours(time()*3600)`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1000, 1200, 1400, 1600, 1800, 2000},
+			Timestamps: timestampsExpected,
+		}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
+	t.Run("seconds_to_days()", func(t *testing.T) {
+		t.Parallel()
+		q := `seconds_to_days(alias(time(), "foobar"))`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{0.011574074074074073, 0.013888888888888888, 0.016203703703703703, 0.018518518518518517, 0.020833333333333332, 0.023148148148148147},
+			Timestamps: timestampsExpected,
+		}
+		r.MetricName.MetricGroup = []byte("foobar")
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
 	t.Run("time() @ 1h", func(t *testing.T) {
 		t.Parallel()
 		q := `time() @ 1h`
@@ -1171,6 +1230,50 @@ func TestExecSuccess(t *testing.T) {
 		resultExpected := []netstorage.Result{r}
 		f(q, resultExpected)
 	})
+	t.Run("now()-time()", func(t *testing.T) {
+		t.Parallel()
+		q := `now()-time()`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{0, 0, 0, 0, 0, 0},
+			Timestamps: timestampsExpected,
+		}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
+	t.Run("now() - 300", func(t *testing.T) {
+		t.Parallel()
+		q := `now() - 300`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{700, 900, 1100, 1300, 1500, 1700},
+			Timestamps: timestampsExpected,
+		}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
+	t.Run("now() @ 1h", func(t *testing.T) {
+		t.Parallel()
+		q := `now() @ 1h`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{3600, 3600, 3600, 3600, 3600, 3600},
+			Timestamps: timestampsExpected,
+		}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
+	t.Run("now() @ end() offset 10m", func(t *testing.T) {
+		t.Parallel()
+		q := `now() @ end() offset 10m`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1400, 1400, 1400, 1400, 1400, 1400},
+			Timestamps: timestampsExpected,
+		}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
 	t.Run("pi()", func(t *testing.T) {
 		t.Parallel()
 		q := `pi()`
@@ -2410,6 +2513,165 @@ func TestExecSuccess(t *testing.T) {
 		resultExpected := []netstorage.Result{r1, r2}
 		f(q, resultExpected)
 	})
+	t.Run(`sort(equal_values)`, func(t *testing.T) {
+		t.Parallel()
+		q := `sort((
+			label_set(1, "x", "c"),
+			label_set(1, "x", "a"),
+			label_set(0, "x", "d"),
+			label_set(1, "x", "b"),
+		))`
+		r1 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{0, 0, 0, 0, 0, 0},
+			Timestamps: timestampsExpected,
+		}
+		r1.MetricName.Tags = []storage.Tag{{
+			Key:   []byte("x"),
+			Value: []byte("d"),
+		}}
+		r2 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1, 1, 1, 1, 1, 1},
+			Timestamps: timestampsExpected,
+		}
+		r2.MetricName.Tags = []storage.Tag{{
+			Key:   []byte("x"),
+			Value: []byte("a"),
+		}}
+		r3 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1, 1, 1, 1, 1, 1},
+			Timestamps: timestampsExpected,
+		}
+		r3.MetricName.Tags = []storage.Tag{{
+			Key:   []byte("x"),
+			Value: []byte("b"),
+		}}
+		r4 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1, 1, 1, 1, 1, 1},
+			Timestamps: timestampsExpected,
+		}
+		r4.MetricName.Tags = []storage.Tag{{
+			Key:   []byte("x"),
+			Value: []byte("c"),
+		}}
+		resultExpected := []netstorage.Result{r1, r2, r3, r4}
+		f(q, resultExpected)
+	})
+	t.Run(`sort_desc(equal_values)`, func(t *testing.T) {
+		t.Parallel()
+		q := `sort_desc((
+			label_set(1, "x", "c"),
+			label_set(1, "x", "a"),
+			label_set(2, "x", "d"),
+			label_set(1, "x", "b"),
+		))`
+		r1 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{2, 2, 2, 2, 2, 2},
+			Timestamps: timestampsExpected,
+		}
+		r1.MetricName.Tags = []storage.Tag{{
+			Key:   []byte("x"),
+			Value: []byte("d"),
+		}}
+		r2 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1, 1, 1, 1, 1, 1},
+			Timestamps: timestampsExpected,
+		}
+		r2.MetricName.Tags = []storage.Tag{{
+			Key:   []byte("x"),
+			Value: []byte("a"),
+		}}
+		r3 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1, 1, 1, 1, 1, 1},
+			Timestamps: timestampsExpected,
+		}
+		r3.MetricName.Tags = []storage.Tag{{
+			Key:   []byte("x"),
+			Value: []byte("b"),
+		}}
+		r4 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1, 1, 1, 1, 1, 1},
+			Timestamps: timestampsExpected,
+		}
+		r4.MetricName.Tags = []storage.Tag{{
+			Key:   []byte("x"),
+			Value: []byte("c"),
+		}}
+		resultExpected := []netstorage.Result{r1, r2, r3, r4}
+		f(q, resultExpected)
+	})
+	t.Run(`sort(equal_values_multiple_labels)`, func(t *testing.T) {
+		t.Parallel()
+		q := `sort((
+			alias(label_set(1, "z", "1", "a", "2"), "yyy"),
+			alias(label_set(1, "z", "1", "a", "2"), "xxx"),
+			alias(label_set(1, "a", "2", "z", "0"), "xxx"),
+			alias(1, "xxx"),
+		))`
+		r1 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1, 1, 1, 1, 1, 1},
+			Timestamps: timestampsExpected,
+		}
+		r1.MetricName.MetricGroup = []byte("xxx")
+		r2 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1, 1, 1, 1, 1, 1},
+			Timestamps: timestampsExpected,
+		}
+		r2.MetricName.MetricGroup = []byte("xxx")
+		r2.MetricName.Tags = []storage.Tag{
+			{
+				Key:   []byte("a"),
+				Value: []byte("2"),
+			},
+			{
+				Key:   []byte("z"),
+				Value: []byte("0"),
+			},
+		}
+		r3 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1, 1, 1, 1, 1, 1},
+			Timestamps: timestampsExpected,
+		}
+		r3.MetricName.MetricGroup = []byte("xxx")
+		r3.MetricName.Tags = []storage.Tag{
+			{
+				Key:   []byte("a"),
+				Value: []byte("2"),
+			},
+			{
+				Key:   []byte("z"),
+				Value: []byte("1"),
+			},
+		}
+		r4 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1, 1, 1, 1, 1, 1},
+			Timestamps: timestampsExpected,
+		}
+		r4.MetricName.MetricGroup = []byte("yyy")
+		r4.MetricName.Tags = []storage.Tag{
+			{
+				Key:   []byte("a"),
+				Value: []byte("2"),
+			},
+			{
+				Key:   []byte("z"),
+				Value: []byte("1"),
+			},
+		}
+		resultExpected := []netstorage.Result{r1, r2, r3, r4}
+		f(q, resultExpected)
+	})
 	t.Run(`sort_by_label()`, func(t *testing.T) {
 		t.Parallel()
 		q := `sort_by_label((
@@ -3934,6 +4196,81 @@ func TestExecSuccess(t *testing.T) {
 		resultExpected := []netstorage.Result{r}
 		f(q, resultExpected)
 	})
+	t.Run(`histogram_fraction(normal-bucket-count)`, func(t *testing.T) {
+		t.Parallel()
+		q := `histogram_fraction(20, 35,
+			label_set(0, "foo", "bar", "le", "10")
+			or label_set(100, "foo", "bar", "le", "30")
+			or label_set(300, "foo", "bar", "le", "+Inf")
+		)`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{0.16666666666666666, 0.16666666666666666, 0.16666666666666666, 0.16666666666666666, 0.16666666666666666, 0.16666666666666666},
+			Timestamps: timestampsExpected,
+		}
+		r.MetricName.Tags = []storage.Tag{{
+			Key:   []byte("foo"),
+			Value: []byte("bar"),
+		}}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
+	t.Run(`histogram_fraction(vmrange)`, func(t *testing.T) {
+		t.Parallel()
+		q := `histogram_fraction(15, 25,
+			label_set(100, "foo", "bar", "vmrange", "10...20")
+			or label_set(300, "foo", "bar", "vmrange", "20...40")
+		)`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{0.3125, 0.3125, 0.3125, 0.3125, 0.3125, 0.3125},
+			Timestamps: timestampsExpected,
+		}
+		r.MetricName.Tags = []storage.Tag{{
+			Key:   []byte("foo"),
+			Value: []byte("bar"),
+		}}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
+	t.Run(`histogram_fraction(negative-lower)`, func(t *testing.T) {
+		t.Parallel()
+		q := `histogram_fraction(-5, 20,
+			label_set(0, "foo", "bar", "le", "10")
+			or label_set(100, "foo", "bar", "le", "30")
+			or label_set(300, "foo", "bar", "le", "+Inf")
+		)`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{0.16666666666666666, 0.16666666666666666, 0.16666666666666666, 0.16666666666666666, 0.16666666666666666, 0.16666666666666666},
+			Timestamps: timestampsExpected,
+		}
+		r.MetricName.Tags = []storage.Tag{{
+			Key:   []byte("foo"),
+			Value: []byte("bar"),
+		}}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
+	t.Run(`histogram_fraction(lower>upper)`, func(t *testing.T) {
+		t.Parallel()
+		q := `histogram_fraction(30, 10,
+			label_set(0, "foo", "bar", "le", "10")
+			or label_set(100, "foo", "bar", "le", "30")
+			or label_set(300, "foo", "bar", "le", "+Inf")
+		)`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{0, 0, 0, 0, 0, 0},
+			Timestamps: timestampsExpected,
+		}
+		r.MetricName.Tags = []storage.Tag{{
+			Key:   []byte("foo"),
+			Value: []byte("bar"),
+		}}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
 	t.Run(`histogram_quantile(normal-bucket-count, boundsLabel)`, func(t *testing.T) {
 		t.Parallel()
 		q := `sort(histogram_quantile(0.2,
@@ -4166,6 +4503,115 @@ func TestExecSuccess(t *testing.T) {
 		resultExpected := []netstorage.Result{r1, r2, r3}
 		f(q, resultExpected)
 	})
+	t.Run(`buckets_downsample(zero)`, func(t *testing.T) {
+		t.Parallel()
+		q := `count(buckets_downsample(0, (
+			alias(label_set(100, "le", "inf", "x", "y"), "metric"),
+			alias(label_set(52, "le", "200", "x", "y"), "metric"),
+			alias(label_set(50, "le", "120", "x", "y"), "metric"),
+			alias(label_set(20, "le", "70", "x", "y"), "metric"),
+		)))`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{4, 4, 4, 4, 4, 4},
+			Timestamps: timestampsExpected,
+		}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
+	t.Run(`buckets_downsample(used)`, func(t *testing.T) {
+		t.Parallel()
+		// The bucket with le=120 must be merged into the bucket with le=200, since 200/70 <= 1+2
+		q := `sort(label_value(buckets_downsample(2, (
+			alias(label_set(100, "le", "inf", "x", "y"), "metric"),
+			alias(label_set(98, "le", "300", "x", "y"), "metric"),
+			alias(label_set(52, "le", "200", "x", "y"), "metric"),
+			alias(label_set(50, "le", "120", "x", "y"), "metric"),
+			alias(label_set(20, "le", "70", "x", "y"), "metric"),
+			alias(label_set(10, "le", "30", "x", "y"), "metric"),
+			alias(label_set(9, "le", "10", "x", "y"), "metric"),
+		)), "le"))`
+		newResult := func(le float64, leStr string) netstorage.Result {
+			r := netstorage.Result{
+				MetricName: metricNameExpected,
+				Values:     []float64{le, le, le, le, le, le},
+				Timestamps: timestampsExpected,
+			}
+			r.MetricName.Tags = []storage.Tag{
+				{
+					Key:   []byte("le"),
+					Value: []byte(leStr),
+				},
+				{
+					Key:   []byte("x"),
+					Value: []byte("y"),
+				},
+			}
+			return r
+		}
+		resultExpected := []netstorage.Result{
+			newResult(10, "10"),
+			newResult(30, "30"),
+			newResult(70, "70"),
+			newResult(200, "200"),
+			newResult(300, "300"),
+			newResult(inf, "inf"),
+		}
+		f(q, resultExpected)
+	})
+	t.Run(`vmrange_buckets(buckets_per_decade)`, func(t *testing.T) {
+		t.Parallel()
+		// Buckets with le=0.5 and le=3 are merged into the bucket with the nearest upper bound 1
+		q := `sort_by_label(vmrange_buckets((
+			alias(label_set(100, "le", "+Inf", "x", "y"), "metric"),
+			alias(label_set(60, "le", "3", "x", "y"), "metric"),
+			alias(label_set(20, "le", "0.5", "x", "y"), "metric"),
+		), 1), "vmrange")`
+		newResult := func(v float64, vmrange string) netstorage.Result {
+			r := netstorage.Result{
+				MetricName: metricNameExpected,
+				Values:     []float64{v, v, v, v, v, v},
+				Timestamps: timestampsExpected,
+			}
+			r.MetricName.MetricGroup = []byte("metric")
+			r.MetricName.Tags = []storage.Tag{
+				{
+					Key:   []byte("vmrange"),
+					Value: []byte(vmrange),
+				},
+				{
+					Key:   []byte("x"),
+					Value: []byte("y"),
+				},
+			}
+			return r
+		}
+		resultExpected := []netstorage.Result{
+			newResult(40, "1.000e+00...+Inf"),
+			newResult(60, "1.000e-01...1.000e+00"),
+		}
+		f(q, resultExpected)
+	})
+	t.Run(`histogram_quantile(vmrange_buckets)`, func(t *testing.T) {
+		t.Parallel()
+		// `le` bounds match `vmrange` bounds, so the quantile is the same as for the original buckets
+		q := `histogram_quantile(0.5, vmrange_buckets((
+			alias(label_set(100, "le", "+Inf", "x", "y"), "metric"),
+			alias(label_set(100, "le", "10", "x", "y"), "metric"),
+			alias(label_set(20, "le", "1", "x", "y"), "metric"),
+		), 1))`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{4.375, 4.375, 4.375, 4.375, 4.375, 4.375},
+			Timestamps: timestampsExpected,
+		}
+		r.MetricName.Tags = []storage.Tag{{
+			Key:   []byte("x"),
+			Value: []byte("y"),
+		}}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
 	t.Run(`prometheus_buckets(missing-vmrange)`, func(t *testing.T) {
 		t.Parallel()
 		q := `sort(prometheus_buckets((
@@ -4205,7 +4651,7 @@ func TestExecSuccess(t *testing.T) {
 			},
 			{
 				Key:   []byte("le"),
-				Value: []byte("40"),
+				Value: []byte("+Inf"),
 			},
 		}
 		r3 := netstorage.Result{
@@ -4221,7 +4667,7 @@ func TestExecSuccess(t *testing.T) {
 			},
 			{
 				Key:   []byte("le"),
-				Value: []byte("+Inf"),
+				Value: []byte("40"),
 			},
 		}
 		r4 := netstorage.Result{
@@ -7072,7 +7518,7 @@ func TestExecSuccess(t *testing.T) {
 		}
 		r1.MetricName.Tags = []storage.Tag{{
 			Key:   []byte("rollup"),
-			Value: []byte("min"),
+			Value: []byte("avg"),
 		}}
 		r2 := netstorage.Result{
 			MetricName: metricNameExpected,
@@ -7090,7 +7536,7 @@ func TestExecSuccess(t *testing.T) {
 		}
 		r3.MetricName.Tags = []storage.Tag{{
 			Key:   []byte("rollup"),
-			Value: []byte("avg"),
+			Value: []byte("min"),
 		}}
 		resultExpected := []netstorage.Result{r1, r2, r3}
 		f(q, resultExpected)
@@ -7171,7 +7617,7 @@ func TestExecSuccess(t *testing.T) {
 		}
 		r1.MetricName.Tags = []storage.Tag{{
 			Key:   []byte("rollup"),
-			Value: []byte("min"),
+			Value: []byte("avg"),
 		}}
 		r2 := netstorage.Result{
 			MetricName: metricNameExpected,
@@ -7189,7 +7635,7 @@ func TestExecSuccess(t *testing.T) {
 		}
 		r3.MetricName.Tags = []storage.Tag{{
 			Key:   []byte("rollup"),
-			Value: []byte("avg"),
+			Value: []byte("min"),
 		}}
 		resultExpected := []netstorage.Result{r1, r2, r3}
 		f(q, resultExpected)
@@ -7791,6 +8237,8 @@ func TestExecError(t *testing.T) {
 	f(`vector()`)
 	f(`histogram_quantile()`)
 	f(`histogram_quantiles()`)
+	f(`histogram_fraction()`)
+	f(`histogram_fraction(1, 2)`)
 	f(`sum()`)
 	f(`count_values()`)
 	f(`quantile()`)
@@ -7872,6 +8320,15 @@ func TestExecError(t *testing.T) {
 	f(`prometheus_buckets()`)
 	f(`buckets_limit()`)
 	f(`buckets_limit(1)`)
+	f(`buckets_downsample()`)
+	f(`buckets_downsample(0.1)`)
+	f(`vmrange_buckets()`)
+	f(`vmrange_buckets(1, 2, 3)`)
+	f(`vmrange_buckets(1, 0)`)
+	f(`vmrange_buckets(1, 1e6)`)
+	f(`bytes_to_gib()`)
+	f(`bytes_to_gib(1, 2)`)
+	f(`seconds_to_hours()`)
 	f(`duration_over_time()`)
 	f(`share_le_over_time()`)
 	f(`share_gt_over_time()`)
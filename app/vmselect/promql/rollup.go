@@ -340,7 +340,29 @@ func getRollupConfigs(name string, rf rollupFunc, expr metricsql.Expr, start, en
 
 func getRollupFunc(funcName string) newRollupFunc {
 	funcName = strings.ToLower(funcName)
-	return rollupFuncs[funcName]
+	if rf := rollupFuncs[funcName]; rf != nil {
+		return rf
+	}
+	return customRollupFuncs[funcName]
+}
+
+// getRollupFuncExt returns rollup func for the given funcName.
+//
+// Rollup funcs with Prometheus-compatible extrapolation are returned if prometheusExtrapolation is set.
+func getRollupFuncExt(funcName string, prometheusExtrapolation bool) newRollupFunc {
+	if prometheusExtrapolation {
+		if rf := rollupFuncsPrometheusExtrapolation[strings.ToLower(funcName)]; rf != nil {
+			return rf
+		}
+	}
+	return getRollupFunc(funcName)
+}
+
+// rollupFuncsPrometheusExtrapolation contains rollup funcs, which are used instead of rollupFuncs if EvalConfig.PrometheusExtrapolation is set.
+var rollupFuncsPrometheusExtrapolation = map[string]newRollupFunc{
+	"delta":    newRollupFuncOneArg(rollupDeltaExtrapolated),
+	"increase": newRollupFuncOneArg(rollupIncreaseExtrapolated), // + rollupFuncsRemoveCounterResets
+	"rate":     newRollupFuncOneArg(rollupRateExtrapolated),     // + rollupFuncsRemoveCounterResets
 }
 
 type rollupFuncArg struct {
@@ -1524,6 +1546,69 @@ func rollupDeltaPrometheus(rfa *rollupFuncArg) float64 {
 	return values[len(values)-1] - values[0]
 }
 
+func rollupDeltaExtrapolated(rfa *rollupFuncArg) float64 {
+	return extrapolatedDelta(rfa, false, false)
+}
+
+func rollupIncreaseExtrapolated(rfa *rollupFuncArg) float64 {
+	return extrapolatedDelta(rfa, true, false)
+}
+
+func rollupRateExtrapolated(rfa *rollupFuncArg) float64 {
+	return extrapolatedDelta(rfa, true, true)
+}
+
+// extrapolatedDelta calculates delta between the first and the last samples on the window
+// and extrapolates it to window boundaries in the same way as Prometheus does.
+//
+// Samples outside the window are ignored. The delta is extrapolated to window boundary only if the distance between the boundary
+// and the closest sample doesn't exceed the average interval between samples by more than 10%.
+// Otherwise it is extrapolated by the half of the average interval, so gaps at window boundaries do not inflate the result.
+// See https://github.com/prometheus/prometheus/blob/main/promql/functions.go
+func extrapolatedDelta(rfa *rollupFuncArg, isCounter, isRate bool) float64 {
+	// There is no need in handling NaNs here, since they must be cleaned up
+	// before calling rollup funcs.
+	values := rfa.values
+	timestamps := rfa.timestamps
+	if len(values) < 2 {
+		return nan
+	}
+	firstValue := values[0]
+	delta := values[len(values)-1] - firstValue
+	windowStart := rfa.currTimestamp - rfa.window
+	durationToStart := float64(timestamps[0]-windowStart) / 1e3
+	durationToEnd := float64(rfa.currTimestamp-timestamps[len(timestamps)-1]) / 1e3
+	sampledInterval := float64(timestamps[len(timestamps)-1]-timestamps[0]) / 1e3
+	if sampledInterval <= 0 {
+		return nan
+	}
+	averageDurationBetweenSamples := sampledInterval / float64(len(values)-1)
+	if isCounter && delta > 0 && firstValue >= 0 {
+		// Counters cannot be negative, so do not extrapolate the start further than the point where the counter would be zero.
+		durationToZero := sampledInterval * (firstValue / delta)
+		if durationToZero < durationToStart {
+			durationToStart = durationToZero
+		}
+	}
+	extrapolationThreshold := averageDurationBetweenSamples * 1.1
+	extrapolateToInterval := sampledInterval
+	if durationToStart < extrapolationThreshold {
+		extrapolateToInterval += durationToStart
+	} else {
+		extrapolateToInterval += averageDurationBetweenSamples / 2
+	}
+	if durationToEnd < extrapolationThreshold {
+		extrapolateToInterval += durationToEnd
+	} else {
+		extrapolateToInterval += averageDurationBetweenSamples / 2
+	}
+	delta *= extrapolateToInterval / sampledInterval
+	if isRate {
+		delta /= float64(rfa.window) / 1e3
+	}
+	return delta
+}
+
 func rollupIdelta(rfa *rollupFuncArg) float64 {
 	// There is no need in handling NaNs here, since they must be cleaned up
 	// before calling rollup funcs.
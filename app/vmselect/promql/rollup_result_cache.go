@@ -11,6 +11,7 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/extcache"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
@@ -29,6 +30,11 @@ var (
 		"due to time synchronization issues between VictoriaMetrics and data sources. See also -search.disableAutoCacheReset")
 	disableAutoCacheReset = flag.Bool("search.disableAutoCacheReset", false, "Whether to disable automatic response cache reset if a sample with timestamp "+
 		"outside -search.cacheTimestampOffset is inserted into VictoriaMetrics")
+	rollupResultCacheTTL = flag.Duration("search.rollupResultCacheTTL", time.Hour, "The lifetime for cached results of queries with time ranges ending later than "+
+		"now-search.cacheTimestampOffset. See also -search.rollupResultCacheHistoricalTTL")
+	rollupResultCacheHistoricalTTL = flag.Duration("search.rollupResultCacheHistoricalTTL", 24*time.Hour, "The lifetime for cached results of queries "+
+		"with historical time ranges ending earlier than now-search.cacheTimestampOffset. Such results do not change over time, so they may be cached "+
+		"for longer time than the results for the queries touching the current time. See also -search.rollupResultCacheTTL")
 )
 
 // ResetRollupResultCacheIfNeeded resets rollup result cache if mrs contains timestamps outside `now - search.cacheTimestampOffset`.
@@ -105,7 +111,10 @@ var (
 //
 // ResetRollupResultCache must be called when the cache must be reset.
 // StopRollupResultCache must be called when the cache isn't needed anymore.
+//
+// Custom functions cannot be registered after InitRollupResultCache call.
 func InitRollupResultCache(cachePath string) {
+	closeCustomFunctionsRegistration()
 	rollupResultCachePath = cachePath
 	startTime := time.Now()
 	cacheSize := getRollupResultCacheSize()
@@ -121,6 +130,23 @@ func InitRollupResultCache(cachePath string) {
 	if *disableCache {
 		c.Reset()
 	}
+	var backend *rollupResultCacheBackend
+	if len(*rollupResultCacheBackendAddr) > 0 {
+		// Cache entries contain compressed rollup results, which occupy up to getRollupResultCacheSize()/4 bytes before the compression.
+		// Double this size in order to account for compression overhead on incompressible data.
+		maxEntrySize := getRollupResultCacheSize() / 2
+		client, err := extcache.NewClient(*rollupResultCacheBackendAddr, *rollupResultCacheBackendTimeout, maxEntrySize)
+		if err != nil {
+			logger.Fatalf("cannot initialize -search.rollupResultCacheBackend: %s", err)
+		}
+		backend = newRollupResultCacheBackend(client)
+		// The key prefix and the key suffix must be shared among vmselect replicas, which use the same backend.
+		// Random key suffix prevents from collisions among entries stored by distinct replicas.
+		backend.loadKeyPrefix()
+		atomic.StoreUint64(&rollupResultCacheKeySuffix, newRollupResultCacheKeyPrefix())
+		backend.startKeyPrefixReloader()
+		logger.Infof("using %s as rollupResult cache backend", client)
+	}
 
 	stats := &fastcache.Stats{}
 	var statsLock sync.Mutex
@@ -160,12 +186,17 @@ func InitRollupResultCache(cachePath string) {
 	})
 
 	rollupResultCacheV = &rollupResultCache{
-		c: c,
+		c:       c,
+		backend: backend,
 	}
 }
 
 // StopRollupResultCache closes the rollupResult cache.
 func StopRollupResultCache() {
+	if rollupResultCacheV.backend != nil {
+		rollupResultCacheV.backend.MustStop()
+		rollupResultCacheV.backend = nil
+	}
 	if len(rollupResultCachePath) == 0 {
 		rollupResultCacheV.c.Stop()
 		rollupResultCacheV.c = nil
@@ -188,6 +219,18 @@ func StopRollupResultCache() {
 
 type rollupResultCache struct {
 	c *workingsetcache.Cache
+
+	// backend is set if the cache entries must be stored in -search.rollupResultCacheBackend instead of c.
+	backend *rollupResultCacheBackend
+}
+
+func (rrc *rollupResultCache) storage() rollupResultCacheStorage {
+	if rrc.backend != nil {
+		return rrc.backend
+	}
+	return inmemoryRollupResultCacheStorage{
+		c: rrc.c,
+	}
 }
 
 var rollupResultCacheResets = metrics.NewCounter(`vm_cache_resets_total{type="promql/rollupResult"}`)
@@ -195,7 +238,11 @@ var rollupResultCacheResets = metrics.NewCounter(`vm_cache_resets_total{type="pr
 // ResetRollupResultCache resets rollup result cache.
 func ResetRollupResultCache() {
 	rollupResultCacheResets.Inc()
-	atomic.AddUint64(&rollupResultCacheKeyPrefix, 1)
+	prefix := atomic.AddUint64(&rollupResultCacheKeyPrefix, 1)
+	if backend := rollupResultCacheV.backend; backend != nil {
+		// Propagate the reset to other vmselect replicas, which use the same backend.
+		backend.storeKeyPrefix(prefix)
+	}
 	logger.Infof("rollupResult cache has been cleared")
 }
 
@@ -214,8 +261,8 @@ func (rrc *rollupResultCache) Get(qt *querytracer.Tracer, ec *EvalConfig, expr m
 	bb := bbPool.Get()
 	defer bbPool.Put(bb)
 
-	bb.B = marshalRollupResultCacheKey(bb.B[:0], expr, window, ec.Step, ec.EnforcedTagFilterss)
-	metainfoBuf := rrc.c.Get(nil, bb.B)
+	bb.B = marshalRollupResultCacheKey(bb.B[:0], expr, window, ec.Step, ec.EnforcedTagFilterss, ec.PrometheusExtrapolation)
+	metainfoBuf := rrc.storage().Get(nil, bb.B)
 	if len(metainfoBuf) == 0 {
 		qt.Printf("nothing found")
 		return nil, ec.Start
@@ -232,12 +279,12 @@ func (rrc *rollupResultCache) Get(qt *querytracer.Tracer, ec *EvalConfig, expr m
 	bb.B = key.Marshal(bb.B[:0])
 	compressedResultBuf := resultBufPool.Get()
 	defer resultBufPool.Put(compressedResultBuf)
-	compressedResultBuf.B = rrc.c.GetBig(compressedResultBuf.B[:0], bb.B)
+	compressedResultBuf.B = rrc.storage().GetBig(compressedResultBuf.B[:0], bb.B)
 	if len(compressedResultBuf.B) == 0 {
 		mi.RemoveKey(key)
 		metainfoBuf = mi.Marshal(metainfoBuf[:0])
-		bb.B = marshalRollupResultCacheKey(bb.B[:0], expr, window, ec.Step, ec.EnforcedTagFilterss)
-		rrc.c.Set(bb.B, metainfoBuf)
+		bb.B = marshalRollupResultCacheKey(bb.B[:0], expr, window, ec.Step, ec.EnforcedTagFilterss, ec.PrometheusExtrapolation)
+		rrc.storage().Set(bb.B, metainfoBuf, mi.GetTTL())
 		qt.Printf("missing cache entry")
 		return nil, ec.Start
 	}
@@ -331,14 +378,17 @@ func (rrc *rollupResultCache) Put(qt *querytracer.Tracer, ec *EvalConfig, expr m
 		tss = rvs
 	}
 
+	// Results for historical time ranges do not change over time, so they may be cached for longer time.
+	ttl := getRollupResultCacheTTL(ec.End, deadline)
+
 	// Store tss in the cache.
 	metainfoKey := bbPool.Get()
 	defer bbPool.Put(metainfoKey)
 	metainfoBuf := bbPool.Get()
 	defer bbPool.Put(metainfoBuf)
 
-	metainfoKey.B = marshalRollupResultCacheKey(metainfoKey.B[:0], expr, window, ec.Step, ec.EnforcedTagFilterss)
-	metainfoBuf.B = rrc.c.Get(metainfoBuf.B[:0], metainfoKey.B)
+	metainfoKey.B = marshalRollupResultCacheKey(metainfoKey.B[:0], expr, window, ec.Step, ec.EnforcedTagFilterss, ec.PrometheusExtrapolation)
+	metainfoBuf.B = rrc.storage().Get(metainfoBuf.B[:0], metainfoKey.B)
 	var mi rollupResultCacheMetainfo
 	if len(metainfoBuf.B) > 0 {
 		if err := mi.Unmarshal(metainfoBuf.B); err != nil {
@@ -368,15 +418,26 @@ func (rrc *rollupResultCache) Put(qt *querytracer.Tracer, ec *EvalConfig, expr m
 	qt.Printf("compress %d bytes into %d bytes", len(resultBuf.B), len(compressedResultBuf.B))
 
 	var key rollupResultCacheKey
-	key.prefix = rollupResultCacheKeyPrefix
+	key.prefix = atomic.LoadUint64(&rollupResultCacheKeyPrefix)
 	key.suffix = atomic.AddUint64(&rollupResultCacheKeySuffix, 1)
 	rollupResultKey := key.Marshal(nil)
-	rrc.c.SetBig(rollupResultKey, compressedResultBuf.B)
-	qt.Printf("store %d bytes in the cache", len(compressedResultBuf.B))
+	rrc.storage().SetBig(rollupResultKey, compressedResultBuf.B, ttl)
+	qt.Printf("store %d bytes in the cache with ttl=%s", len(compressedResultBuf.B), ttl)
 
-	mi.AddKey(key, timestamps[0], timestamps[len(timestamps)-1])
+	mi.AddKey(key, timestamps[0], timestamps[len(timestamps)-1], ttl)
 	metainfoBuf.B = mi.Marshal(metainfoBuf.B[:0])
-	rrc.c.Set(metainfoKey.B, metainfoBuf.B)
+	rrc.storage().Set(metainfoKey.B, metainfoBuf.B, mi.GetTTL())
+}
+
+// getRollupResultCacheTTL returns the lifetime for cached results of the query ending at the given end timestamp.
+//
+// deadline is the maximum timestamp for the cached results. The results of the query ending before the deadline
+// are historical, e.g. they do not change over time.
+func getRollupResultCacheTTL(end, deadline int64) time.Duration {
+	if end <= deadline {
+		return *rollupResultCacheHistoricalTTL
+	}
+	return *rollupResultCacheTTL
 }
 
 var (
@@ -425,13 +486,19 @@ func mustSaveRollupResultCacheKeyPrefix(path string) {
 var tooBigRollupResults = metrics.NewCounter("vm_too_big_rollup_results_total")
 
 // Increment this value every time the format of the cache changes.
-const rollupResultCacheVersion = 8
+const rollupResultCacheVersion = 10
 
-func marshalRollupResultCacheKey(dst []byte, expr metricsql.Expr, window, step int64, etfs [][]storage.TagFilter) []byte {
+func marshalRollupResultCacheKey(dst []byte, expr metricsql.Expr, window, step int64, etfs [][]storage.TagFilter, prometheusExtrapolation bool) []byte {
 	dst = append(dst, rollupResultCacheVersion)
-	dst = encoding.MarshalUint64(dst, rollupResultCacheKeyPrefix)
+	dst = encoding.MarshalUint64(dst, atomic.LoadUint64(&rollupResultCacheKeyPrefix))
 	dst = encoding.MarshalInt64(dst, window)
 	dst = encoding.MarshalInt64(dst, step)
+	// The results for rate(), increase() and delta() depend on prometheusExtrapolation.
+	if prometheusExtrapolation {
+		dst = append(dst, 1)
+	} else {
+		dst = append(dst, 0)
+	}
 	dst = expr.AppendString(dst)
 	for i, etf := range etfs {
 		for _, f := range etf {
@@ -566,8 +633,12 @@ func (mi *rollupResultCacheMetainfo) CoversTimeRange(start, end int64) bool {
 	if start > end {
 		logger.Panicf("BUG: start cannot exceed end; got %d vs %d", start, end)
 	}
+	currentTime := fasttime.UnixTimestamp()
 	for i := range mi.entries {
 		e := &mi.entries[i]
+		if e.isExpired(currentTime) {
+			continue
+		}
 		if start >= e.start && end <= e.end {
 			return true
 		}
@@ -581,9 +652,10 @@ func (mi *rollupResultCacheMetainfo) GetBestKey(start, end int64) rollupResultCa
 	}
 	var bestKey rollupResultCacheKey
 	dMax := int64(0)
+	currentTime := fasttime.UnixTimestamp()
 	for i := range mi.entries {
 		e := &mi.entries[i]
-		if start < e.start {
+		if start < e.start || e.isExpired(currentTime) {
 			continue
 		}
 		d := e.end - start
@@ -598,14 +670,26 @@ func (mi *rollupResultCacheMetainfo) GetBestKey(start, end int64) rollupResultCa
 	return bestKey
 }
 
-func (mi *rollupResultCacheMetainfo) AddKey(key rollupResultCacheKey, start, end int64) {
+func (mi *rollupResultCacheMetainfo) AddKey(key rollupResultCacheKey, start, end int64, ttl time.Duration) {
 	if start > end {
 		logger.Panicf("BUG: start cannot exceed end; got %d vs %d", start, end)
 	}
+	currentTime := fasttime.UnixTimestamp()
+
+	// Remove expired entries.
+	dst := mi.entries[:0]
+	for _, e := range mi.entries {
+		if !e.isExpired(currentTime) {
+			dst = append(dst, e)
+		}
+	}
+	mi.entries = dst
+
 	mi.entries = append(mi.entries, rollupResultCacheMetainfoEntry{
-		start: start,
-		end:   end,
-		key:   key,
+		start:    start,
+		end:      end,
+		deadline: currentTime + uint64(ttl.Seconds()),
+		key:      key,
 	})
 	if len(mi.entries) > 30 {
 		// Remove old entries.
@@ -613,6 +697,22 @@ func (mi *rollupResultCacheMetainfo) AddKey(key rollupResultCacheKey, start, end
 	}
 }
 
+// GetTTL returns the lifetime for mi, so it outlives all its entries.
+func (mi *rollupResultCacheMetainfo) GetTTL() time.Duration {
+	currentTime := fasttime.UnixTimestamp()
+	var deadlineMax uint64
+	for i := range mi.entries {
+		if d := mi.entries[i].deadline; d > deadlineMax {
+			deadlineMax = d
+		}
+	}
+	if deadlineMax <= currentTime {
+		// All the entries are expired, so there is no need in keeping mi for long time.
+		return time.Second
+	}
+	return time.Duration(deadlineMax-currentTime) * time.Second
+}
+
 func (mi *rollupResultCacheMetainfo) RemoveKey(key rollupResultCacheKey) {
 	for i := range mi.entries {
 		if mi.entries[i].key == key {
@@ -626,11 +726,19 @@ type rollupResultCacheMetainfoEntry struct {
 	start int64
 	end   int64
 	key   rollupResultCacheKey
+
+	// deadline is unix timestamp in seconds when the entry expires.
+	deadline uint64
+}
+
+func (mie *rollupResultCacheMetainfoEntry) isExpired(currentTime uint64) bool {
+	return currentTime >= mie.deadline
 }
 
 func (mie *rollupResultCacheMetainfoEntry) Marshal(dst []byte) []byte {
 	dst = encoding.MarshalInt64(dst, mie.start)
 	dst = encoding.MarshalInt64(dst, mie.end)
+	dst = encoding.MarshalUint64(dst, mie.deadline)
 	dst = encoding.MarshalUint64(dst, mie.key.prefix)
 	dst = encoding.MarshalUint64(dst, mie.key.suffix)
 	return dst
@@ -649,6 +757,12 @@ func (mie *rollupResultCacheMetainfoEntry) Unmarshal(src []byte) ([]byte, error)
 	mie.end = encoding.UnmarshalInt64(src)
 	src = src[8:]
 
+	if len(src) < 8 {
+		return src, fmt.Errorf("cannot unmarshal deadline from %d bytes; need at least %d bytes", len(src), 8)
+	}
+	mie.deadline = encoding.UnmarshalUint64(src)
+	src = src[8:]
+
 	if len(src) < 8 {
 		return src, fmt.Errorf("cannot unmarshal key prefix from %d bytes; need at least %d bytes", len(src), 8)
 	}
@@ -0,0 +1,205 @@
+package promql
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/extcache"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/workingsetcache"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	rollupResultCacheBackendAddr = flag.String("search.rollupResultCacheBackend", "", "Optional address of external cache for rollup results. "+
+		"The external cache may be shared among multiple vmselect replicas, so they don't re-compute the same queries. "+
+		"Supported formats: redis://host:port and memcached://host:port. The in-process cache is used if this flag isn't set. "+
+		"See https://docs.victoriametrics.com/#rollup-result-cache-backend")
+	rollupResultCacheBackendTimeout = flag.Duration("search.rollupResultCacheBackendTimeout", time.Second, "Timeout for requests to -search.rollupResultCacheBackend. "+
+		"Rollup results are re-computed if the backend doesn't respond in time")
+)
+
+// rollupResultCacheStorage is the storage for rollupResultCache entries.
+//
+// It is implemented by inmemoryRollupResultCacheStorage and by rollupResultCacheBackend.
+type rollupResultCacheStorage interface {
+	Get(dst, k []byte) []byte
+	Set(k, v []byte, ttl time.Duration)
+	GetBig(dst, k []byte) []byte
+	SetBig(k, v []byte, ttl time.Duration)
+}
+
+// inmemoryRollupResultCacheStorage stores rollupResultCache entries in the in-process cache.
+//
+// The ttl for entries is ignored, since the in-process cache evicts entries on its own,
+// while expired entries are skipped via rollupResultCacheMetainfo.
+type inmemoryRollupResultCacheStorage struct {
+	c *workingsetcache.Cache
+}
+
+// Get implements rollupResultCacheStorage interface.
+func (ims inmemoryRollupResultCacheStorage) Get(dst, k []byte) []byte {
+	return ims.c.Get(dst, k)
+}
+
+// GetBig implements rollupResultCacheStorage interface.
+func (ims inmemoryRollupResultCacheStorage) GetBig(dst, k []byte) []byte {
+	return ims.c.GetBig(dst, k)
+}
+
+// Set implements rollupResultCacheStorage interface.
+func (ims inmemoryRollupResultCacheStorage) Set(k, v []byte, ttl time.Duration) {
+	ims.c.Set(k, v)
+}
+
+// SetBig implements rollupResultCacheStorage interface.
+func (ims inmemoryRollupResultCacheStorage) SetBig(k, v []byte, ttl time.Duration) {
+	ims.c.SetBig(k, v)
+}
+
+// rollupResultCacheBackend stores rollupResultCache entries in external cache shared among multiple vmselect replicas.
+//
+// Errors from the external cache are logged and are treated as cache misses, so queries are re-computed.
+type rollupResultCacheBackend struct {
+	c extcache.Client
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newRollupResultCacheBackend(c extcache.Client) *rollupResultCacheBackend {
+	return &rollupResultCacheBackend{
+		c:      c,
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Get implements rollupResultCacheStorage interface.
+func (rb *rollupResultCacheBackend) Get(dst, k []byte) []byte {
+	return rb.get(dst, getRollupResultCacheBackendKey(k))
+}
+
+// GetBig implements rollupResultCacheStorage interface.
+func (rb *rollupResultCacheBackend) GetBig(dst, k []byte) []byte {
+	return rb.Get(dst, k)
+}
+
+// Set implements rollupResultCacheStorage interface.
+func (rb *rollupResultCacheBackend) Set(k, v []byte, ttl time.Duration) {
+	rb.set(getRollupResultCacheBackendKey(k), v, ttl)
+}
+
+// SetBig implements rollupResultCacheStorage interface.
+func (rb *rollupResultCacheBackend) SetBig(k, v []byte, ttl time.Duration) {
+	rb.Set(k, v, ttl)
+}
+
+func (rb *rollupResultCacheBackend) get(dst []byte, key string) []byte {
+	rollupResultCacheBackendGets.Inc()
+	dstLen := len(dst)
+	dst, ok, err := rb.c.Get(dst, key)
+	if err != nil {
+		rollupResultCacheBackendErrors.Inc()
+		rollupResultCacheBackendLogger.Warnf("cannot obtain rollup results from -search.rollupResultCacheBackend: %s", err)
+		return dst[:dstLen]
+	}
+	if !ok {
+		rollupResultCacheBackendMisses.Inc()
+	}
+	return dst
+}
+
+func (rb *rollupResultCacheBackend) set(key string, value []byte, ttl time.Duration) {
+	rollupResultCacheBackendSets.Inc()
+	if err := rb.c.Set(key, value, ttl); err != nil {
+		rollupResultCacheBackendErrors.Inc()
+		rollupResultCacheBackendLogger.Warnf("cannot store rollup results in -search.rollupResultCacheBackend: %s", err)
+	}
+}
+
+// loadKeyPrefix loads rollupResultCacheKeyPrefix shared among vmselect replicas from rb.
+//
+// A new prefix is generated and stored in rb if it is missing there.
+// The current prefix is left unchanged if rb is unavailable.
+func (rb *rollupResultCacheBackend) loadKeyPrefix() {
+	data, ok, err := rb.c.Get(nil, rollupResultCacheBackendKeyPrefixKey)
+	if err != nil {
+		rollupResultCacheBackendErrors.Inc()
+		rollupResultCacheBackendLogger.Warnf("cannot load rollupResult cache key prefix from -search.rollupResultCacheBackend: %s", err)
+		return
+	}
+	if ok && len(data) == 8 {
+		atomic.StoreUint64(&rollupResultCacheKeyPrefix, encoding.UnmarshalUint64(data))
+		return
+	}
+	if ok {
+		logger.Errorf("unexpected size of rollupResult cache key prefix at -search.rollupResultCacheBackend; got %d bytes; want 8 bytes; generating new prefix", len(data))
+	}
+	prefix := newRollupResultCacheKeyPrefix()
+	atomic.StoreUint64(&rollupResultCacheKeyPrefix, prefix)
+	rb.storeKeyPrefix(prefix)
+}
+
+// storeKeyPrefix stores the given rollupResultCacheKeyPrefix in rb, so it is picked up by other vmselect replicas.
+func (rb *rollupResultCacheBackend) storeKeyPrefix(prefix uint64) {
+	// The prefix mustn't expire, since this would invalidate all the entries in the cache.
+	// So store it with the maximum ttl.
+	data := encoding.MarshalUint64(nil, prefix)
+	if err := rb.c.Set(rollupResultCacheBackendKeyPrefixKey, data, 365*24*time.Hour); err != nil {
+		rollupResultCacheBackendErrors.Inc()
+		logger.Errorf("cannot store rollupResult cache key prefix at -search.rollupResultCacheBackend: %s", err)
+	}
+}
+
+// startKeyPrefixReloader starts periodic reloading of rollupResultCacheKeyPrefix from rb.
+//
+// This allows picking up cache resets made by other vmselect replicas.
+func (rb *rollupResultCacheBackend) startKeyPrefixReloader() {
+	rb.wg.Add(1)
+	go func() {
+		defer rb.wg.Done()
+		t := time.NewTicker(checkRollupResultCacheResetInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-rb.stopCh:
+				return
+			case <-t.C:
+				rb.loadKeyPrefix()
+			}
+		}
+	}()
+}
+
+// MustStop stops rb.
+func (rb *rollupResultCacheBackend) MustStop() {
+	close(rb.stopCh)
+	rb.wg.Wait()
+	rb.c.MustClose()
+}
+
+// rollupResultCacheBackendKeyPrefixKey is the key for storing rollupResultCacheKeyPrefix in the external cache.
+const rollupResultCacheBackendKeyPrefixKey = "vm:rollupResult:keyPrefix"
+
+// getRollupResultCacheBackendKey returns the key for the external cache for the given rollupResultCache key k.
+//
+// The key is hashed, since k is binary and may be too long for the external cache such as memcached.
+// The key is stable among vmselect replicas, since k depends only on the query and rollupResultCacheKeyPrefix.
+func getRollupResultCacheBackendKey(k []byte) string {
+	h := sha256.Sum256(k)
+	return "vm:rollupResult:" + hex.EncodeToString(h[:])
+}
+
+var (
+	rollupResultCacheBackendGets   = metrics.NewCounter(`vm_rollup_result_cache_backend_requests_total{type="get"}`)
+	rollupResultCacheBackendSets   = metrics.NewCounter(`vm_rollup_result_cache_backend_requests_total{type="set"}`)
+	rollupResultCacheBackendMisses = metrics.NewCounter(`vm_rollup_result_cache_backend_misses_total`)
+	rollupResultCacheBackendErrors = metrics.NewCounter(`vm_rollup_result_cache_backend_errors_total`)
+)
+
+var rollupResultCacheBackendLogger = logger.WithThrottler("rollupResultCacheBackend", 5*time.Second)
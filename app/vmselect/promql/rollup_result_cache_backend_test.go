@@ -0,0 +1,312 @@
+package promql
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/workingsetcache"
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/VictoriaMetrics/metricsql"
+)
+
+func TestRollupResultCacheBackendSharedAmongReplicas(t *testing.T) {
+	prefixOrig := atomic.LoadUint64(&rollupResultCacheKeyPrefix)
+	defer atomic.StoreUint64(&rollupResultCacheKeyPrefix, prefixOrig)
+
+	fc := newFakeExtCache()
+	newReplica := func() *rollupResultCache {
+		backend := newRollupResultCacheBackend(fc)
+		backend.loadKeyPrefix()
+		return &rollupResultCache{
+			c:       workingsetcache.New(1024 * 1024),
+			backend: backend,
+		}
+	}
+	rrc1 := newReplica()
+	defer rrc1.c.Stop()
+	rrc2 := newReplica()
+	defer rrc2.c.Stop()
+
+	window := int64(456)
+	ec := &EvalConfig{
+		Start: 1000,
+		End:   2000,
+		Step:  200,
+
+		MayCache: true,
+	}
+	fe := &metricsql.FuncExpr{
+		Name: "foo",
+		Args: []metricsql.Expr{&metricsql.MetricExpr{
+			LabelFilters: []metricsql.LabelFilter{{
+				Label: "aaa",
+				Value: "xxx",
+			}},
+		}},
+	}
+	tss := []*timeseries{
+		{
+			Timestamps: []int64{1000, 1200, 1400, 1600, 1800, 2000},
+			Values:     []float64{1, 2, 3, 4, 5, 6},
+		},
+	}
+	tss[0].MetricName.MetricGroup = []byte("foo")
+
+	// The second replica must miss the cache before the first replica stores the results.
+	tssResult, newStart := rrc2.Get(nil, ec, fe, window)
+	if newStart != ec.Start {
+		t.Fatalf("unexpected newStart; got %d; want %d", newStart, ec.Start)
+	}
+	if len(tssResult) != 0 {
+		t.Fatalf("got %d timeseries, while expecting zero", len(tssResult))
+	}
+
+	// The second replica must hit the cache after the first replica stores the results.
+	rrc1.Put(nil, ec, fe, window, tss)
+	tssResult, newStart = rrc2.Get(nil, ec, fe, window)
+	if newStart != 2200 {
+		t.Fatalf("unexpected newStart; got %d; want %d", newStart, 2200)
+	}
+	testTimeseriesEqual(t, tssResult, tss)
+
+	// The in-process caches mustn't be used when the backend is set.
+	var fcs fastcache.Stats
+	rrc1.c.UpdateStats(&fcs)
+	rrc2.c.UpdateStats(&fcs)
+	if fcs.EntriesCount != 0 {
+		t.Fatalf("unexpected number of entries in the in-process caches; got %d; want 0", fcs.EntriesCount)
+	}
+
+	// All the keys in the backend must be suitable for memcached.
+	for _, key := range fc.keys() {
+		if len(key) > 250 {
+			t.Fatalf("too long key in the backend: %d bytes", len(key))
+		}
+		for i := 0; i < len(key); i++ {
+			if c := key[i]; c <= ' ' || c >= 0x7f {
+				t.Fatalf("unexpected char %q in the key %q", c, key)
+			}
+		}
+	}
+
+	// The reset at the first replica must be picked up by the second replica.
+	prefix := atomic.AddUint64(&rollupResultCacheKeyPrefix, 1)
+	rrc1.backend.storeKeyPrefix(prefix)
+	atomic.StoreUint64(&rollupResultCacheKeyPrefix, prefix-1)
+	rrc2.backend.loadKeyPrefix()
+	if n := atomic.LoadUint64(&rollupResultCacheKeyPrefix); n != prefix {
+		t.Fatalf("unexpected key prefix after the reset; got %d; want %d", n, prefix)
+	}
+	tssResult, newStart = rrc2.Get(nil, ec, fe, window)
+	if newStart != ec.Start {
+		t.Fatalf("unexpected newStart after the reset; got %d; want %d", newStart, ec.Start)
+	}
+	if len(tssResult) != 0 {
+		t.Fatalf("got %d timeseries after the reset, while expecting zero", len(tssResult))
+	}
+
+	// Backend errors must be treated as cache misses.
+	rrc1.Put(nil, ec, fe, window, tss)
+	fc.setError(fmt.Errorf("cache is unavailable"))
+	tssResult, newStart = rrc2.Get(nil, ec, fe, window)
+	if newStart != ec.Start {
+		t.Fatalf("unexpected newStart on backend error; got %d; want %d", newStart, ec.Start)
+	}
+	if len(tssResult) != 0 {
+		t.Fatalf("got %d timeseries on backend error, while expecting zero", len(tssResult))
+	}
+
+	// The key prefix mustn't change when the backend is unavailable.
+	rrc2.backend.loadKeyPrefix()
+	if n := atomic.LoadUint64(&rollupResultCacheKeyPrefix); n != prefix {
+		t.Fatalf("unexpected key prefix on backend error; got %d; want %d", n, prefix)
+	}
+	fc.setError(nil)
+	tssResult, _ = rrc2.Get(nil, ec, fe, window)
+	testTimeseriesEqual(t, tssResult, tss)
+}
+
+func TestRollupResultCacheBackendLoadKeyPrefix(t *testing.T) {
+	prefixOrig := atomic.LoadUint64(&rollupResultCacheKeyPrefix)
+	defer atomic.StoreUint64(&rollupResultCacheKeyPrefix, prefixOrig)
+
+	fc := newFakeExtCache()
+	rb1 := newRollupResultCacheBackend(fc)
+	rb2 := newRollupResultCacheBackend(fc)
+
+	// The first replica must generate the prefix and store it in the backend.
+	rb1.loadKeyPrefix()
+	prefix := atomic.LoadUint64(&rollupResultCacheKeyPrefix)
+	data, ok, _ := fc.Get(nil, rollupResultCacheBackendKeyPrefixKey)
+	if !ok {
+		t.Fatalf("missing key prefix in the backend")
+	}
+	if n := encoding.UnmarshalUint64(data); n != prefix {
+		t.Fatalf("unexpected key prefix in the backend; got %d; want %d", n, prefix)
+	}
+
+	// The second replica must use the same prefix.
+	atomic.StoreUint64(&rollupResultCacheKeyPrefix, 0)
+	rb2.loadKeyPrefix()
+	if n := atomic.LoadUint64(&rollupResultCacheKeyPrefix); n != prefix {
+		t.Fatalf("unexpected key prefix at the second replica; got %d; want %d", n, prefix)
+	}
+
+	// The key for the backend must be stable.
+	k := []byte("foobar")
+	key1 := getRollupResultCacheBackendKey(k)
+	key2 := getRollupResultCacheBackendKey(k)
+	if key1 != key2 {
+		t.Fatalf("unstable key for the backend; got %q and %q", key1, key2)
+	}
+	if key := getRollupResultCacheBackendKey([]byte("foobaz")); key == key1 {
+		t.Fatalf("the same key %q for distinct inputs", key)
+	}
+}
+
+func TestRollupResultCacheBackendTTL(t *testing.T) {
+	prefixOrig := atomic.LoadUint64(&rollupResultCacheKeyPrefix)
+	defer atomic.StoreUint64(&rollupResultCacheKeyPrefix, prefixOrig)
+
+	fc := newFakeExtCache()
+	backend := newRollupResultCacheBackend(fc)
+	backend.loadKeyPrefix()
+	rrc := &rollupResultCache{
+		c:       workingsetcache.New(1024 * 1024),
+		backend: backend,
+	}
+	defer rrc.c.Stop()
+
+	fe := &metricsql.FuncExpr{
+		Name: "foo",
+		Args: []metricsql.Expr{&metricsql.MetricExpr{
+			LabelFilters: []metricsql.LabelFilter{{
+				Label: "aaa",
+				Value: "xxx",
+			}},
+		}},
+	}
+	window := int64(0)
+	f := func(start, end int64, ttlExpected time.Duration) {
+		t.Helper()
+
+		// Use distinct window per each call, so the results are stored under distinct metainfo keys.
+		window++
+
+		ec := &EvalConfig{
+			Start: start,
+			End:   end,
+			Step:  60e3,
+
+			MayCache: true,
+		}
+		ts := &timeseries{}
+		for timestamp := start; timestamp <= end; timestamp += ec.Step {
+			ts.Timestamps = append(ts.Timestamps, timestamp)
+			ts.Values = append(ts.Values, float64(timestamp))
+		}
+		rrc.Put(nil, ec, fe, window, []*timeseries{ts})
+
+		// Verify ttl for the stored results.
+		key := rollupResultCacheKey{
+			prefix: atomic.LoadUint64(&rollupResultCacheKeyPrefix),
+			suffix: atomic.LoadUint64(&rollupResultCacheKeySuffix),
+		}
+		resultKey := getRollupResultCacheBackendKey(key.Marshal(nil))
+		if ttl := fc.getTTL(resultKey); ttl != ttlExpected {
+			t.Fatalf("unexpected ttl for the results on the time range [%d..%d]; got %s; want %s", start, end, ttl, ttlExpected)
+		}
+
+		// The metainfo must outlive the stored results.
+		metainfoKey := getRollupResultCacheBackendKey(marshalRollupResultCacheKey(nil, fe, window, ec.Step, nil, false))
+		if ttl := fc.getTTL(metainfoKey); ttl < ttlExpected-time.Second || ttl > ttlExpected {
+			t.Fatalf("unexpected ttl for the metainfo on the time range [%d..%d]; got %s; want %s", start, end, ttl, ttlExpected)
+		}
+
+		// The stored results must be returned from the cache.
+		tss, newStart := rrc.Get(nil, ec, fe, window)
+		if len(tss) != 1 || newStart <= start {
+			t.Fatalf("missing cached results on the time range [%d..%d]", start, end)
+		}
+	}
+
+	now := time.Now().UnixNano() / 1e6
+	now -= now % 60e3
+	hour := time.Hour.Milliseconds()
+
+	// Historical time ranges ending before now-search.cacheTimestampOffset
+	f(now-3*hour, now-2*hour, *rollupResultCacheHistoricalTTL)
+	f(now-48*hour, now-24*hour, *rollupResultCacheHistoricalTTL)
+
+	// Time ranges touching the current time
+	f(now-3*hour, now, *rollupResultCacheTTL)
+	f(now-3*hour, now-cacheTimestampOffset.Milliseconds(), *rollupResultCacheTTL)
+}
+
+// fakeExtCache is an in-memory implementation of extcache.Client for tests.
+type fakeExtCache struct {
+	mu   sync.Mutex
+	m    map[string][]byte
+	ttls map[string]time.Duration
+	err  error
+}
+
+func newFakeExtCache() *fakeExtCache {
+	return &fakeExtCache{
+		m:    make(map[string][]byte),
+		ttls: make(map[string]time.Duration),
+	}
+}
+
+func (fc *fakeExtCache) Get(dst []byte, key string) ([]byte, bool, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.err != nil {
+		return dst, false, fc.err
+	}
+	v, ok := fc.m[key]
+	return append(dst, v...), ok, nil
+}
+
+func (fc *fakeExtCache) Set(key string, value []byte, ttl time.Duration) error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.err != nil {
+		return fc.err
+	}
+	fc.m[key] = append([]byte{}, value...)
+	fc.ttls[key] = ttl
+	return nil
+}
+
+func (fc *fakeExtCache) MustClose() {}
+
+func (fc *fakeExtCache) String() string {
+	return "fake"
+}
+
+func (fc *fakeExtCache) keys() []string {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	var keys []string
+	for key := range fc.m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (fc *fakeExtCache) getTTL(key string) time.Duration {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.ttls[key]
+}
+
+func (fc *fakeExtCache) setError(err error) {
+	fc.mu.Lock()
+	fc.err = err
+	fc.mu.Unlock()
+}
@@ -1,7 +1,9 @@
 package promql
 
 import (
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
@@ -87,6 +89,26 @@ func TestRollupResultCache(t *testing.T) {
 		}
 		testTimeseriesEqual(t, tss, tssExpected)
 	})
+	// Results for distinct prometheus_extrapolation values mustn't be mixed
+	t.Run("prometheus-extrapolation", func(t *testing.T) {
+		ResetRollupResultCache()
+		tss := []*timeseries{
+			{
+				Timestamps: []int64{1000, 1200},
+				Values:     []float64{1, 2},
+			},
+		}
+		rollupResultCacheV.Put(nil, ec, fe, window, tss)
+		ecExtrapolation := copyEvalConfig(ec)
+		ecExtrapolation.PrometheusExtrapolation = true
+		tss, newStart := rollupResultCacheV.Get(nil, ecExtrapolation, fe, window)
+		if newStart != ec.Start {
+			t.Fatalf("unexpected newStart; got %d; want %d", newStart, ec.Start)
+		}
+		if len(tss) != 0 {
+			t.Fatalf("got %d timeseries, while expecting zero", len(tss))
+		}
+	})
 	t.Run("start-overlap-with-ae", func(t *testing.T) {
 		ResetRollupResultCache()
 		tss := []*timeseries{
@@ -289,6 +311,70 @@ func TestRollupResultCache(t *testing.T) {
 
 }
 
+func TestGetRollupResultCacheTTL(t *testing.T) {
+	f := func(end, deadline int64, ttlExpected time.Duration) {
+		t.Helper()
+		ttl := getRollupResultCacheTTL(end, deadline)
+		if ttl != ttlExpected {
+			t.Fatalf("unexpected ttl for end=%d, deadline=%d; got %s; want %s", end, deadline, ttl, ttlExpected)
+		}
+	}
+
+	// Historical time ranges
+	f(1000, 2000, *rollupResultCacheHistoricalTTL)
+	f(2000, 2000, *rollupResultCacheHistoricalTTL)
+
+	// Time ranges touching the current time
+	f(2001, 2000, *rollupResultCacheTTL)
+	f(3000, 2000, *rollupResultCacheTTL)
+}
+
+func TestRollupResultCacheMetainfoExpiration(t *testing.T) {
+	var mi rollupResultCacheMetainfo
+	key1 := rollupResultCacheKey{prefix: 1, suffix: 1}
+	key2 := rollupResultCacheKey{prefix: 1, suffix: 2}
+
+	// Expired entries must be ignored.
+	mi.AddKey(key1, 1000, 2000, 0)
+	if mi.CoversTimeRange(1000, 2000) {
+		t.Fatalf("expired entry mustn't cover the time range")
+	}
+	if key := mi.GetBestKey(1000, 2000); key.prefix != 0 || key.suffix != 0 {
+		t.Fatalf("unexpected key returned for expired entry: %v", key)
+	}
+	if ttl := mi.GetTTL(); ttl != time.Second {
+		t.Fatalf("unexpected ttl for metainfo with expired entries; got %s; want %s", ttl, time.Second)
+	}
+
+	// Expired entries must be removed when adding new entries.
+	mi.AddKey(key2, 1000, 3000, time.Hour)
+	if len(mi.entries) != 1 || mi.entries[0].key != key2 {
+		t.Fatalf("unexpected entries after adding new entry: %v", mi.entries)
+	}
+	if !mi.CoversTimeRange(1000, 2000) {
+		t.Fatalf("non-expired entry must cover the time range")
+	}
+	if key := mi.GetBestKey(1000, 2000); key != key2 {
+		t.Fatalf("unexpected key; got %v; want %v", key, key2)
+	}
+
+	// The metainfo must outlive all its entries.
+	mi.AddKey(key1, 1000, 2000, 24*time.Hour)
+	if ttl := mi.GetTTL(); ttl < 24*time.Hour-time.Second || ttl > 24*time.Hour {
+		t.Fatalf("unexpected ttl for metainfo; got %s; want %s", ttl, 24*time.Hour)
+	}
+
+	// Deadlines must be preserved after marshaling.
+	data := mi.Marshal(nil)
+	var mi2 rollupResultCacheMetainfo
+	if err := mi2.Unmarshal(data); err != nil {
+		t.Fatalf("cannot unmarshal metainfo: %s", err)
+	}
+	if !reflect.DeepEqual(mi.entries, mi2.entries) {
+		t.Fatalf("unexpected entries after unmarshaling; got %v; want %v", mi2.entries, mi.entries)
+	}
+}
+
 func TestMergeTimeseries(t *testing.T) {
 	ec := &EvalConfig{
 		Start: 1000,
@@ -1293,3 +1293,87 @@ func TestRollupDelta(t *testing.T) {
 	f(1, nan, nan, nil, 0)
 	f(100, nan, nan, nil, 0)
 }
+
+func TestRollupPrometheusExtrapolation(t *testing.T) {
+	// Counter with 10s scrape interval and a gap between 40s and 90s because of missing scrapes.
+	srcValues := []float64{10, 20, 30, 40, 90, 100}
+	srcTimestamps := []int64{10e3, 20e3, 30e3, 40e3, 90e3, 100e3}
+	f := func(funcName string, prometheusExtrapolationValue bool, valuesExpected []float64) {
+		t.Helper()
+		nrf := getRollupFuncExt(funcName, prometheusExtrapolationValue)
+		if nrf == nil {
+			t.Fatalf("cannot find %q", funcName)
+		}
+		args := []interface{}{&metricsql.RollupExpr{Expr: &metricsql.MetricExpr{}}}
+		rf, err := nrf(args)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		rc := rollupConfig{
+			Func:   rf,
+			Start:  60e3,
+			End:    110e3,
+			Step:   50e3,
+			Window: 50e3,
+		}
+		rc.Timestamps = getTimestamps(rc.Start, rc.End, rc.Step)
+		values := rc.Do(nil, srcValues, srcTimestamps)
+		timestampsExpected := []int64{60e3, 110e3}
+		testRowsEqual(t, values, rc.Timestamps, valuesExpected, timestampsExpected)
+	}
+
+	// VictoriaMetrics takes into account the last sample before the window and doesn't extrapolate the result.
+	f("increase", false, []float64{30, 60})
+	f("delta", false, []float64{30, 60})
+	f("rate", false, []float64{1, 1})
+
+	// Prometheus ignores samples outside the window and extrapolates the result to window boundaries.
+	// The result is extrapolated by a half of the average interval between samples at the window boundary with a gap.
+	f("increase", true, []float64{35, 25})
+	f("delta", true, []float64{35, 25})
+	f("rate", true, []float64{0.7, 0.5})
+
+	// Functions without Prometheus extrapolation semantics aren't affected.
+	f("increase_prometheus", true, []float64{20, 10})
+	f("delta_prometheus", true, []float64{20, 10})
+}
+
+func TestRollupExtrapolatedDelta(t *testing.T) {
+	f := func(values []float64, timestamps []int64, isCounter, isRate bool, resultExpected float64) {
+		t.Helper()
+		rfa := &rollupFuncArg{
+			values:        values,
+			timestamps:    timestamps,
+			currTimestamp: 100e3,
+			window:        60e3,
+		}
+		result := extrapolatedDelta(rfa, isCounter, isRate)
+		if math.IsNaN(result) {
+			if !math.IsNaN(resultExpected) {
+				t.Fatalf("unexpected result; got %v; want %v", result, resultExpected)
+			}
+			return
+		}
+		if math.Abs(result-resultExpected) > 1e-9 {
+			t.Fatalf("unexpected result; got %v; want %v", result, resultExpected)
+		}
+	}
+
+	// Not enough samples
+	f(nil, nil, true, false, nan)
+	f([]float64{10}, []int64{50e3}, true, false, nan)
+
+	// Samples cover the whole window, so the result is extrapolated to window boundaries.
+	f([]float64{10, 20, 30, 40, 50, 60}, []int64{50e3, 60e3, 70e3, 80e3, 90e3, 100e3}, true, false, 60)
+	f([]float64{10, 20, 30, 40, 50}, []int64{50e3, 60e3, 70e3, 80e3, 90e3}, true, false, 60)
+	f([]float64{10, 20, 30, 40, 50}, []int64{50e3, 60e3, 70e3, 80e3, 90e3}, true, true, 1)
+
+	// Counter extrapolation at the window start is limited by zero value.
+	f([]float64{2, 12, 22}, []int64{50e3, 60e3, 70e3}, true, false, 27)
+
+	// Gauges are extrapolated below zero.
+	f([]float64{2, 12, 22}, []int64{50e3, 60e3, 70e3}, false, false, 35)
+
+	// Gaps at window boundaries are extrapolated by a half of the average interval between samples.
+	f([]float64{10, 20}, []int64{60e3, 70e3}, false, false, 20)
+}
@@ -31,7 +31,12 @@ var transformFuncs = map[string]transformFunc{
 	"bitmap_and":           newTransformBitmap(bitmapAnd),
 	"bitmap_or":            newTransformBitmap(bitmapOr),
 	"bitmap_xor":           newTransformBitmap(bitmapXor),
+	"buckets_downsample":   transformBucketsDownsample,
 	"buckets_limit":        transformBucketsLimit,
+	"bytes_to_gib":         newTransformFuncUnitConversion(1 << 30),
+	"bytes_to_kib":         newTransformFuncUnitConversion(1 << 10),
+	"bytes_to_mib":         newTransformFuncUnitConversion(1 << 20),
+	"bytes_to_tib":         newTransformFuncUnitConversion(1 << 40),
 	"ceil":                 newTransformFuncOneArg(transformCeil),
 	"clamp":                transformClamp,
 	"clamp_max":            transformClampMax,
@@ -47,6 +52,7 @@ var transformFuncs = map[string]transformFunc{
 	"exp":                  newTransformFuncOneArg(transformExp),
 	"floor":                newTransformFuncOneArg(transformFloor),
 	"histogram_avg":        transformHistogramAvg,
+	"histogram_fraction":   transformHistogramFraction,
 	"histogram_quantile":   transformHistogramQuantile,
 	"histogram_quantiles":  transformHistogramQuantiles,
 	"histogram_share":      transformHistogramShare,
@@ -98,6 +104,9 @@ var transformFuncs = map[string]transformFunc{
 	"running_min":          newTransformFuncRunning(runningMin),
 	"running_sum":          newTransformFuncRunning(runningSum),
 	"scalar":               transformScalar,
+	"seconds_to_days":      newTransformFuncUnitConversion(24 * 3600),
+	"seconds_to_hours":     newTransformFuncUnitConversion(3600),
+	"seconds_to_minutes":   newTransformFuncUnitConversion(60),
 	"sgn":                  transformSgn,
 	"sin":                  newTransformFuncOneArg(transformSin),
 	"sinh":                 newTransformFuncOneArg(transformSinh),
@@ -116,12 +125,17 @@ var transformFuncs = map[string]transformFunc{
 	"timezone_offset": transformTimezoneOffset,
 	"union":           transformUnion,
 	"vector":          transformVector,
+	"vmrange_buckets": transformVMRangeBuckets,
 	"year":            newTransformFuncDateTime(transformYear),
 }
 
 // These functions don't change physical meaning of input time series,
 // so they don't drop metric name
 var transformFuncsKeepMetricName = map[string]bool{
+	"bytes_to_gib":       true,
+	"bytes_to_kib":       true,
+	"bytes_to_mib":       true,
+	"bytes_to_tib":       true,
 	"ceil":               true,
 	"clamp":              true,
 	"clamp_max":          true,
@@ -140,12 +154,18 @@ var transformFuncsKeepMetricName = map[string]bool{
 	"running_avg":        true,
 	"running_max":        true,
 	"running_min":        true,
+	"seconds_to_days":    true,
+	"seconds_to_hours":   true,
+	"seconds_to_minutes": true,
 	"smooth_exponential": true,
 }
 
 func getTransformFunc(s string) transformFunc {
 	s = strings.ToLower(s)
-	return transformFuncs[s]
+	if tf := transformFuncs[s]; tf != nil {
+		return tf
+	}
+	return customTransformFuncs[s]
 }
 
 type transformFuncArg struct {
@@ -455,6 +475,87 @@ func transformBucketsLimit(tfa *transformFuncArg) ([]*timeseries, error) {
 	return rvs, nil
 }
 
+// transformBucketsDownsample merges adjacent histogram buckets while the ratio between the upper and the lower bound
+// of every merged bucket doesn't exceed 1+maxError.
+//
+// Both the original and the merged quantile estimates calculated by histogram_quantile() lie inside the same merged bucket,
+// so the relative error for quantiles over the merged buckets doesn't exceed maxError.
+func transformBucketsDownsample(tfa *transformFuncArg) ([]*timeseries, error) {
+	args := tfa.args
+	if err := expectTransformArgsNum(args, 2); err != nil {
+		return nil, err
+	}
+	maxErrors, err := getScalar(args[0], 0)
+	if err != nil {
+		return nil, err
+	}
+	maxError := float64(0)
+	if len(maxErrors) > 0 {
+		maxError = maxErrors[0]
+	}
+	tss := vmrangeBucketsToLE(args[1])
+	if len(tss) == 0 {
+		return nil, nil
+	}
+	if math.IsNaN(maxError) || maxError <= 0 {
+		// Nothing to merge.
+		return tss, nil
+	}
+	maxRatio := 1 + maxError
+
+	// Group timeseries by all MetricGroup+tags excluding `le` tag.
+	type x struct {
+		le float64
+		ts *timeseries
+	}
+	m := make(map[string][]x)
+	var b []byte
+	var mn storage.MetricName
+	for _, ts := range tss {
+		leStr := ts.MetricName.GetTagValue("le")
+		if len(leStr) == 0 {
+			// Skip time series without `le` tag.
+			continue
+		}
+		le, err := strconv.ParseFloat(string(leStr), 64)
+		if err != nil {
+			// Skip time series with invalid `le` tag.
+			continue
+		}
+		mn.CopyFrom(&ts.MetricName)
+		mn.RemoveTag("le")
+		b = marshalMetricNameSorted(b[:0], &mn)
+		m[string(b)] = append(m[string(b)], x{
+			le: le,
+			ts: ts,
+		})
+	}
+
+	// Merge buckets by dropping intermediate `le` bounds. Cumulative counters for the remaining `le` bounds stay unchanged.
+	rvs := make([]*timeseries, 0, len(tss))
+	for _, leGroup := range m {
+		sort.Slice(leGroup, func(i, j int) bool {
+			return leGroup[i].le < leGroup[j].le
+		})
+		// Always preserve the first and the last bucket for better accuracy for min and max values.
+		rvs = append(rvs, leGroup[0].ts)
+		prevLE := leGroup[0].le
+		for i := 1; i < len(leGroup)-1; i++ {
+			nextLE := leGroup[i+1].le
+			if prevLE > 0 && !math.IsInf(nextLE, 1) && nextLE/prevLE <= maxRatio {
+				// Merge (prevLE ... le] and (le ... nextLE] buckets into (prevLE ... nextLE] bucket.
+				continue
+			}
+			rvs = append(rvs, leGroup[i].ts)
+			prevLE = leGroup[i].le
+		}
+		if len(leGroup) > 1 {
+			rvs = append(rvs, leGroup[len(leGroup)-1].ts)
+		}
+	}
+	return rvs, nil
+}
+
 func transformPrometheusBuckets(tfa *transformFuncArg) ([]*timeseries, error) {
 	args := tfa.args
 	if err := expectTransformArgsNum(args, 1); err != nil {
@@ -464,6 +565,137 @@ func transformPrometheusBuckets(tfa *transformFuncArg) ([]*timeseries, error) {
 	return rvs, nil
 }
 
+// defaultBucketsPerDecade is the number of buckets per decimal order of magnitude in VictoriaMetrics histograms.
+//
+// See https://github.com/VictoriaMetrics/metrics/blob/master/histogram.go
+const defaultBucketsPerDecade = 18
+
+// maxBucketsPerDecade is the maximum number of buckets per decimal order of magnitude, which can be passed to vmrange_buckets.
+const maxBucketsPerDecade = 1000
+
+func transformVMRangeBuckets(tfa *transformFuncArg) ([]*timeseries, error) {
+	args := tfa.args
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf(`unexpected number of args: %d; want 1 or 2`, len(args))
+	}
+	bucketsPerDecade := defaultBucketsPerDecade
+	if len(args) == 2 {
+		n, err := getIntNumber(args[1], 1)
+		if err != nil {
+			return nil, err
+		}
+		bucketsPerDecade = n
+	}
+	if bucketsPerDecade < 1 || bucketsPerDecade > maxBucketsPerDecade {
+		return nil, fmt.Errorf("buckets_per_decade must be in the range [1...%d]; got %d", maxBucketsPerDecade, bucketsPerDecade)
+	}
+	rvs := leBucketsToVMRange(args[0], bucketsPerDecade)
+	return rvs, nil
+}
+
+// leBucketsToVMRange converts Prometheus histogram buckets with `le` labels in tss to VictoriaMetrics histogram buckets with `vmrange` labels.
+//
+// Every decimal order of magnitude is split into bucketsPerDecade buckets with logarithmically equal widths.
+// Every `le` bucket is assigned to the `vmrange` bucket with the upper bound nearest to `le`, so `le` bounds,
+// which do not match `vmrange` bounds, are shifted to the nearest `vmrange` bounds.
+func leBucketsToVMRange(tss []*timeseries, bucketsPerDecade int) []*timeseries {
+	rvs := make([]*timeseries, 0, len(tss))
+
+	// Group timeseries by MetricGroup+tags excluding `le` tag.
+	type x struct {
+		le float64
+		ts *timeseries
+	}
+	m := make(map[string][]x)
+	bb := bbPool.Get()
+	defer bbPool.Put(bb)
+	for _, ts := range tss {
+		leStr := ts.MetricName.GetTagValue("le")
+		if len(leStr) == 0 {
+			if vmrange := ts.MetricName.GetTagValue("vmrange"); len(vmrange) > 0 {
+				// Keep VictoriaMetrics buckets.
+				rvs = append(rvs, ts)
+			}
+			continue
+		}
+		le, err := strconv.ParseFloat(string(leStr), 64)
+		if err != nil || math.IsNaN(le) {
+			continue
+		}
+		ts.MetricName.RemoveTag("le")
+		bb.B = marshalMetricNameSorted(bb.B[:0], &ts.MetricName)
+		m[string(bb.B)] = append(m[string(bb.B)], x{
+			le: le,
+			ts: ts,
+		})
+	}
+
+	// Bucket bounds are enumerated by k, so the k-th bound equals to 10^(k/bucketsPerDecade).
+	// Buckets with non-positive `le` are put into `0...0` bucket, since VictoriaMetrics histograms
+	// contain only non-negative values.
+	const kZero = math.MinInt32
+	const kInf = math.MaxInt32
+	formatBound := func(k int) string {
+		switch k {
+		case kZero:
+			return "0"
+		case kInf:
+			return "+Inf"
+		default:
+			return fmt.Sprintf("%.3e", math.Pow(10, float64(k)/float64(bucketsPerDecade)))
+		}
+	}
+	for _, xss := range m {
+		sort.Slice(xss, func(i, j int) bool { return xss[i].le < xss[j].le })
+		var ks []int
+		bucketsByK := make(map[int]*timeseries, len(xss))
+		prevs := make([]float64, len(xss[0].ts.Values))
+		for _, xs := range xss {
+			k := kInf
+			if xs.le <= 0 {
+				k = kZero
+			} else if !math.IsInf(xs.le, 1) {
+				k = int(math.Round(math.Log10(xs.le) * float64(bucketsPerDecade)))
+			}
+			ts := bucketsByK[k]
+			if ts == nil {
+				ts = &timeseries{}
+				ts.CopyFromShallowTimestamps(xs.ts)
+				for i := range ts.Values {
+					ts.Values[i] = 0
+				}
+				bucketsByK[k] = ts
+				ks = append(ks, k)
+			}
+			// Convert cumulative counters for `le` buckets to per-bucket counters.
+			for i, v := range xs.ts.Values {
+				if math.IsNaN(v) {
+					continue
+				}
+				if count := v - prevs[i]; count > 0 {
+					ts.Values[i] += count
+					prevs[i] = v
+				}
+			}
+		}
+		for i, k := range ks {
+			start := "0"
+			switch {
+			case k == kInf:
+				if i > 0 {
+					start = formatBound(ks[i-1])
+				}
+			case k != kZero:
+				start = formatBound(k - 1)
+			}
+			ts := bucketsByK[k]
+			ts.MetricName.AddTag("vmrange", start+"..."+formatBound(k))
+			rvs = append(rvs, ts)
+		}
+	}
+	return rvs
+}
+
 func vmrangeBucketsToLE(tss []*timeseries) []*timeseries {
 	rvs := make([]*timeseries, 0, len(tss))
 
@@ -615,45 +847,6 @@ func transformHistogramShare(tfa *transformFuncArg) ([]*timeseries, error) {
 
 	// Group metrics by all tags excluding "le"
 	m := groupLeTimeseries(tss)
-
-	// Calculate share for les
-	share := func(i int, les []float64, xss []leTimeseries) (q, lower, upper float64) {
-		leReq := les[i]
-		if math.IsNaN(leReq) || len(xss) == 0 {
-			return nan, nan, nan
-		}
-		fixBrokenBuckets(i, xss)
-		if leReq < 0 {
-			return 0, 0, 0
-		}
-		if math.IsInf(leReq, 1) {
-			return 1, 1, 1
-		}
-		var vPrev, lePrev float64
-		for _, xs := range xss {
-			v := xs.ts.Values[i]
-			le := xs.le
-			if leReq >= le {
-				vPrev = v
-				lePrev = le
-				continue
-			}
-			// precondition: lePrev <= leReq < le
-			vLast := xss[len(xss)-1].ts.Values[i]
-			lower = vPrev / vLast
-			if math.IsInf(le, 1) {
-				return lower, lower, 1
-			}
-			if lePrev == leReq {
-				return lower, lower, lower
-			}
-			upper = v / vLast
-			q = lower + (v-vPrev)/vLast*(leReq-lePrev)/(le-lePrev)
-			return q, lower, upper
-		}
-		// precondition: leReq > leLast
-		return 1, 1, 1
-	}
 	rvs := make([]*timeseries, 0, len(m))
 	for _, xss := range m {
 		sort.Slice(xss, func(i, j int) bool {
@@ -672,7 +865,7 @@ func transformHistogramShare(tfa *transformFuncArg) ([]*timeseries, error) {
 			tsUpper.MetricName.AddTag(boundsLabel, "upper")
 		}
 		for i := range dst.Values {
-			q, lower, upper := share(i, les, xss)
+			q, lower, upper := shareForLeTimeseries(i, les[i], xss)
 			dst.Values[i] = q
 			if len(boundsLabel) > 0 {
 				tsLower.Values[i] = lower
@@ -688,6 +881,100 @@ func transformHistogramShare(tfa *transformFuncArg) ([]*timeseries, error) {
 	return rvs, nil
 }
 
+func transformHistogramFraction(tfa *transformFuncArg) ([]*timeseries, error) {
+	args := tfa.args
+	if err := expectTransformArgsNum(args, 3); err != nil {
+		return nil, err
+	}
+	lowers, err := getScalar(args[0], 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse lower: %w", err)
+	}
+	uppers, err := getScalar(args[1], 1)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse upper: %w", err)
+	}
+
+	// Convert buckets with `vmrange` labels to buckets with `le` labels.
+	tss := vmrangeBucketsToLE(args[2])
+
+	// Group metrics by all tags excluding "le"
+	m := groupLeTimeseries(tss)
+	rvs := make([]*timeseries, 0, len(m))
+	for _, xss := range m {
+		sort.Slice(xss, func(i, j int) bool {
+			return xss[i].le < xss[j].le
+		})
+		dst := xss[0].ts
+		for i := range dst.Values {
+			lower := lowers[i]
+			upper := uppers[i]
+			if math.IsNaN(lower) || math.IsNaN(upper) {
+				dst.Values[i] = nan
+				continue
+			}
+			if lower >= upper {
+				dst.Values[i] = 0
+				continue
+			}
+			if lower < 0 {
+				// Clamp negative lower bound to -Inf, so the share between -Inf and upper is returned.
+				lower = math.Inf(-1)
+			}
+			qLower := float64(0)
+			if !math.IsInf(lower, -1) {
+				qLower, _, _ = shareForLeTimeseries(i, lower, xss)
+			}
+			qUpper, _, _ := shareForLeTimeseries(i, upper, xss)
+			dst.Values[i] = qUpper - qLower
+		}
+		rvs = append(rvs, dst)
+	}
+	return rvs, nil
+}
+
+// shareForLeTimeseries returns the share of observations below leReq for xss at the point i.
+//
+// The share is linearly interpolated inside the bucket containing leReq.
+// lower and upper are the shares at the bounds of this bucket.
+// xss must be sorted by le.
+func shareForLeTimeseries(i int, leReq float64, xss []leTimeseries) (q, lower, upper float64) {
+	if math.IsNaN(leReq) || len(xss) == 0 {
+		return nan, nan, nan
+	}
+	fixBrokenBuckets(i, xss)
+	if leReq < 0 {
+		return 0, 0, 0
+	}
+	if math.IsInf(leReq, 1) {
+		return 1, 1, 1
+	}
+	var vPrev, lePrev float64
+	for _, xs := range xss {
+		v := xs.ts.Values[i]
+		le := xs.le
+		if leReq >= le {
+			vPrev = v
+			lePrev = le
+			continue
+		}
+		// precondition: lePrev <= leReq < le
+		vLast := xss[len(xss)-1].ts.Values[i]
+		lower = vPrev / vLast
+		if math.IsInf(le, 1) {
+			return lower, lower, 1
+		}
+		if lePrev == leReq {
+			return lower, lower, lower
+		}
+		upper = v / vLast
+		q = lower + (v-vPrev)/vLast*(leReq-lePrev)/(le-lePrev)
+		return q, lower, upper
+	}
+	// precondition: leReq > leLast
+	return 1, 1, 1
+}
+
 func transformHistogramAvg(tfa *transformFuncArg) ([]*timeseries, error) {
 	args := tfa.args
 	if err := expectTransformArgsNum(args, 1); err != nil {
@@ -1976,6 +2263,10 @@ func newTransformFuncSort(isDesc bool) transformFunc {
 			return nil, err
 		}
 		rvs := args[0]
+		for _, ts := range rvs {
+			// Tags must be sorted for metricNameLess.
+			sortMetricTags(ts.MetricName.Tags)
+		}
 		sort.Slice(rvs, func(i, j int) bool {
 			a := rvs[i].Values
 			b := rvs[j].Values
@@ -1994,7 +2285,9 @@ func newTransformFuncSort(isDesc bool) transformFunc {
 				n--
 			}
 			if n < 0 {
-				return false
+				// Series with equal values are sorted by labels in ascending order for both sort() and sort_desc(),
+				// so the order of such series remains stable between queries.
+				return metricNameLess(&rvs[i].MetricName, &rvs[j].MetricName)
 			}
 			if isDesc {
 				return b[n] < a[n]
@@ -2065,6 +2358,13 @@ func transformRad(v float64) float64 {
 	return v * math.Pi / 180
 }
 
+// newTransformFuncUnitConversion returns transform func, which converts values to another unit by dividing them by divisor.
+func newTransformFuncUnitConversion(divisor float64) transformFunc {
+	return newTransformFuncOneArg(func(v float64) float64 {
+		return v / divisor
+	})
+}
+
 func newTransformRand(newRandFunc func(r *rand.Rand) func() float64) transformFunc {
 	return func(tfa *transformFuncArg) ([]*timeseries, error) {
 		args := tfa.args
@@ -2118,8 +2418,9 @@ func transformNow(tfa *transformFuncArg) ([]*timeseries, error) {
 	if err := expectTransformArgsNum(tfa.args, 0); err != nil {
 		return nil, err
 	}
-	now := float64(time.Now().UnixNano()) / 1e9
-	return evalNumber(tfa.ec, now), nil
+	// now() returns the evaluation timestamp for each step in the same way as time() does,
+	// so it respects the query step and `@` modifier.
+	return evalTime(tfa.ec), nil
 }
 
 func bitmapAnd(a, b uint64) uint64 {
@@ -0,0 +1,425 @@
+package promql
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestTransformBucketsDownsampleQuantileAccuracy(t *testing.T) {
+	timestamps := []int64{1000}
+	newScalar := func(v float64) []*timeseries {
+		return []*timeseries{{
+			Values:     []float64{v},
+			Timestamps: timestamps,
+		}}
+	}
+	// Generate histogram buckets with 18 buckets per decade in the range [1 ... 1e4] like VictoriaMetrics histograms have.
+	newBuckets := func() []*timeseries {
+		var tss []*timeseries
+		addBucket := func(le string, count float64) {
+			ts := &timeseries{
+				Values:     []float64{count},
+				Timestamps: timestamps,
+			}
+			ts.MetricName.MetricGroup = []byte("request_duration_seconds_bucket")
+			ts.MetricName.AddTag("le", le)
+			tss = append(tss, ts)
+		}
+		const total = 1e6
+		for i := 0; i <= 72; i++ {
+			le := math.Pow(10, float64(i)/18)
+			// Exponential distribution with the mean 500
+			count := math.Round(total * (1 - math.Exp(-le/500)))
+			addBucket(fmt.Sprintf("%g", le), count)
+		}
+		addBucket("+Inf", total)
+		return tss
+	}
+	quantile := func(phi float64, tss []*timeseries) float64 {
+		t.Helper()
+		// histogram_quantile modifies the passed series, so pass their copies.
+		rvs, err := transformHistogramQuantile(&transformFuncArg{
+			args: [][]*timeseries{newScalar(phi), copyTimeseries(tss)},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(rvs) != 1 {
+			t.Fatalf("unexpected number of series returned from histogram_quantile; got %d; want 1", len(rvs))
+		}
+		return rvs[0].Values[0]
+	}
+
+	f := func(maxError float64) {
+		t.Helper()
+		tssOrig := newBuckets()
+		tss, err := transformBucketsDownsample(&transformFuncArg{
+			args: [][]*timeseries{newScalar(maxError), newBuckets()},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(tss) >= len(tssOrig) {
+			t.Fatalf("expecting less than %d buckets after downsampling with max_error=%g; got %d", len(tssOrig), maxError, len(tss))
+		}
+		for _, phi := range []float64{0.1, 0.5, 0.9, 0.99, 0.999} {
+			qOrig := quantile(phi, tssOrig)
+			q := quantile(phi, tss)
+			if relErr := math.Abs(q-qOrig) / qOrig; relErr > maxError {
+				t.Fatalf("too big relative error for phi=%g and max_error=%g: %g; original quantile: %g; quantile over %d merged buckets: %g",
+					phi, maxError, relErr, qOrig, len(tss), q)
+			}
+		}
+	}
+
+	f(0.3)
+	f(0.5)
+	f(1)
+	f(3)
+}
+
+func TestTransformHistogramStddevAccuracy(t *testing.T) {
+	timestamps := []int64{1000}
+	newBucket := func(labelName, labelValue string, count float64) *timeseries {
+		ts := &timeseries{
+			Values:     []float64{count},
+			Timestamps: timestamps,
+		}
+		ts.MetricName.MetricGroup = []byte("temperature_bucket")
+		ts.MetricName.AddTag(labelName, labelValue)
+		return ts
+	}
+	// newLEBuckets returns Prometheus histogram buckets with the given bounds for the distribution with the given cdf.
+	newLEBuckets := func(bounds []float64, cdf func(x float64) float64) []*timeseries {
+		const total = 1e6
+		var tss []*timeseries
+		for _, le := range bounds {
+			tss = append(tss, newBucket("le", fmt.Sprintf("%g", le), total*cdf(le)))
+		}
+		tss = append(tss, newBucket("le", "+Inf", total))
+		return tss
+	}
+	// newVMRangeBuckets returns VictoriaMetrics histogram buckets with the given bounds for the distribution with the given cdf.
+	newVMRangeBuckets := func(bounds []float64, cdf func(x float64) float64) []*timeseries {
+		const total = 1e6
+		var tss []*timeseries
+		for i := 1; i < len(bounds); i++ {
+			start, end := bounds[i-1], bounds[i]
+			vmrange := fmt.Sprintf("%g...%g", start, end)
+			tss = append(tss, newBucket("vmrange", vmrange, total*(cdf(end)-cdf(start))))
+		}
+		return tss
+	}
+	f := func(tss []*timeseries, stddevExpected, maxRelError float64) {
+		t.Helper()
+		fs := map[string]func(tfa *transformFuncArg) ([]*timeseries, error){
+			"histogram_stddev": transformHistogramStddev,
+			"histogram_stdvar": transformHistogramStdvar,
+		}
+		for funcName, f := range fs {
+			// The functions modify the passed series, so pass their copies.
+			rvs, err := f(&transformFuncArg{
+				args: [][]*timeseries{copyTimeseries(tss)},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error in %s: %s", funcName, err)
+			}
+			if len(rvs) != 1 {
+				t.Fatalf("unexpected number of series returned from %s; got %d; want 1", funcName, len(rvs))
+			}
+			v := rvs[0].Values[0]
+			vExpected := stddevExpected
+			if funcName == "histogram_stdvar" {
+				vExpected = stddevExpected * stddevExpected
+			}
+			if relErr := math.Abs(v-vExpected) / vExpected; relErr > maxRelError {
+				t.Fatalf("too big relative error for %s: %g; got %g; want %g", funcName, relErr, v, vExpected)
+			}
+		}
+	}
+	linearBounds := func(start, end, step float64) []float64 {
+		var bounds []float64
+		for x := start; x <= end; x += step {
+			bounds = append(bounds, x)
+		}
+		return bounds
+	}
+
+	// Uniform distribution in the range [0 ... 100]. The analytic stddev is 100/sqrt(12).
+	uniformCDF := func(x float64) float64 {
+		return math.Min(math.Max(x/100, 0), 1)
+	}
+	f(newLEBuckets(linearBounds(1, 100, 1), uniformCDF), 100/math.Sqrt(12), 0.001)
+	f(newVMRangeBuckets(linearBounds(0, 100, 1), uniformCDF), 100/math.Sqrt(12), 0.001)
+
+	// Normal distribution with the mean 50 and the stddev 10.
+	normalCDF := func(x float64) float64 {
+		return 0.5 * math.Erfc(-(x-50)/(10*math.Sqrt2))
+	}
+	f(newLEBuckets(linearBounds(1, 100, 1), normalCDF), 10, 0.01)
+	f(newVMRangeBuckets(linearBounds(0, 100, 1), normalCDF), 10, 0.01)
+
+	// Exponential distribution with the mean 500 and the stddev 500 over buckets with 18 buckets per decade
+	// in the range [1 ... 1e5] like VictoriaMetrics histograms have.
+	exponentialCDF := func(x float64) float64 {
+		return 1 - math.Exp(-x/500)
+	}
+	var logBounds []float64
+	for i := 0; i <= 90; i++ {
+		logBounds = append(logBounds, math.Pow(10, float64(i)/18))
+	}
+	f(newLEBuckets(logBounds, exponentialCDF), 500, 0.01)
+	f(newVMRangeBuckets(append([]float64{0}, logBounds...), exponentialCDF), 500, 0.01)
+}
+
+func TestTransformHistogramFractionAccuracy(t *testing.T) {
+	timestamps := []int64{1000}
+	newScalar := func(v float64) []*timeseries {
+		return []*timeseries{{
+			Values:     []float64{v},
+			Timestamps: timestamps,
+		}}
+	}
+	newBucket := func(labelName, labelValue string, count float64) *timeseries {
+		ts := &timeseries{
+			Values:     []float64{count},
+			Timestamps: timestamps,
+		}
+		ts.MetricName.MetricGroup = []byte("request_duration_bucket")
+		ts.MetricName.AddTag(labelName, labelValue)
+		return ts
+	}
+	// newLEBuckets returns Prometheus histogram buckets with the given bounds for the distribution with the given cdf.
+	newLEBuckets := func(bounds []float64, cdf func(x float64) float64) []*timeseries {
+		const total = 1e6
+		var tss []*timeseries
+		for _, le := range bounds {
+			tss = append(tss, newBucket("le", fmt.Sprintf("%g", le), total*cdf(le)))
+		}
+		tss = append(tss, newBucket("le", "+Inf", total))
+		return tss
+	}
+	// newVMRangeBuckets returns VictoriaMetrics histogram buckets with the given bounds for the distribution with the given cdf.
+	newVMRangeBuckets := func(bounds []float64, cdf func(x float64) float64) []*timeseries {
+		const total = 1e6
+		var tss []*timeseries
+		for i := 1; i < len(bounds); i++ {
+			start, end := bounds[i-1], bounds[i]
+			vmrange := fmt.Sprintf("%g...%g", start, end)
+			tss = append(tss, newBucket("vmrange", vmrange, total*(cdf(end)-cdf(start))))
+		}
+		return tss
+	}
+	f := func(tss []*timeseries, cdf func(x float64) float64, lower, upper, maxAbsError float64) {
+		t.Helper()
+		// The function modifies the passed series, so pass their copies.
+		rvs, err := transformHistogramFraction(&transformFuncArg{
+			args: [][]*timeseries{newScalar(lower), newScalar(upper), copyTimeseries(tss)},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(rvs) != 1 {
+			t.Fatalf("unexpected number of series returned; got %d; want 1", len(rvs))
+		}
+		v := rvs[0].Values[0]
+		vExpected := cdf(upper) - cdf(lower)
+		if absErr := math.Abs(v - vExpected); absErr > maxAbsError {
+			t.Fatalf("too big absolute error for histogram_fraction(%g, %g): %g; got %g; want %g", lower, upper, absErr, v, vExpected)
+		}
+	}
+	linearBounds := func(start, end, step float64) []float64 {
+		var bounds []float64
+		for x := start; x <= end; x += step {
+			bounds = append(bounds, x)
+		}
+		return bounds
+	}
+
+	// Uniform distribution in the range [0 ... 100]. Linear interpolation inside buckets must give exact results.
+	uniformCDF := func(x float64) float64 {
+		return math.Min(math.Max(x/100, 0), 1)
+	}
+	for _, tss := range [][]*timeseries{
+		newLEBuckets(linearBounds(10, 100, 10), uniformCDF),
+		newVMRangeBuckets(linearBounds(0, 100, 10), uniformCDF),
+	} {
+		f(tss, uniformCDF, 0, 100, 1e-9)
+		f(tss, uniformCDF, 25, 75, 1e-9)
+		f(tss, uniformCDF, 30, 40, 1e-9)
+		f(tss, uniformCDF, 33.3, 33.4, 1e-9)
+		f(tss, uniformCDF, -10, 5, 1e-9)
+		f(tss, uniformCDF, 95, math.Inf(1), 1e-9)
+		f(tss, uniformCDF, math.Inf(-1), math.Inf(1), 1e-9)
+	}
+
+	// Normal distribution with the mean 50 and the stddev 10.
+	normalCDF := func(x float64) float64 {
+		return 0.5 * math.Erfc(-(x-50)/(10*math.Sqrt2))
+	}
+	for _, tss := range [][]*timeseries{
+		newLEBuckets(linearBounds(1, 100, 1), normalCDF),
+		newVMRangeBuckets(linearBounds(0, 100, 1), normalCDF),
+	} {
+		// Fractions at bucket boundaries must be exact up to the tails outside [0 ... 100], which are missing in vmrange buckets.
+		f(tss, normalCDF, 40, 60, 1e-6)
+		f(tss, normalCDF, 30, 70, 1e-6)
+		// Fractions inside buckets are interpolated.
+		f(tss, normalCDF, 45.5, 52.3, 1e-3)
+		f(tss, normalCDF, 0, 50.5, 1e-3)
+	}
+
+	// Exponential distribution with the mean 500 over buckets with 18 buckets per decade
+	// in the range [1 ... 1e5] like VictoriaMetrics histograms have.
+	exponentialCDF := func(x float64) float64 {
+		return 1 - math.Exp(-math.Max(x, 0)/500)
+	}
+	var logBounds []float64
+	for i := 0; i <= 90; i++ {
+		logBounds = append(logBounds, math.Pow(10, float64(i)/18))
+	}
+	for _, tss := range [][]*timeseries{
+		newLEBuckets(logBounds, exponentialCDF),
+		newVMRangeBuckets(append([]float64{0}, logBounds...), exponentialCDF),
+	} {
+		f(tss, exponentialCDF, 100, 1000, 1e-3)
+		f(tss, exponentialCDF, 250, 300, 1e-3)
+		f(tss, exponentialCDF, 2000, math.Inf(1), 1e-3)
+	}
+}
+
+func TestLEBucketsToVMRange(t *testing.T) {
+	timestamps := []int64{1000, 2000}
+	// Classic histogram with `le` bounds, which do not match VictoriaMetrics histogram bounds.
+	newBuckets := func() []*timeseries {
+		var tss []*timeseries
+		addBucket := func(le string, counts ...float64) {
+			ts := &timeseries{
+				Values:     counts,
+				Timestamps: timestamps,
+			}
+			ts.MetricName.MetricGroup = []byte("request_duration_seconds_bucket")
+			ts.MetricName.AddTag("job", "foo")
+			ts.MetricName.AddTag("le", le)
+			tss = append(tss, ts)
+		}
+		addBucket("0", 1, 1)
+		addBucket("0.05", 2, 2)
+		addBucket("0.1", 5, 5)
+		addBucket("0.3", 9, nan)
+		addBucket("0.7", 14, 15)
+		addBucket("1.5", 20, 20)
+		addBucket("4", 22, 21)
+		addBucket("10", 23, 30)
+		addBucket("+Inf", 25, 30)
+		return tss
+	}
+	f := func(bucketsPerDecade int, resultExpected []string) {
+		t.Helper()
+		tss := leBucketsToVMRange(newBuckets(), bucketsPerDecade)
+		var result []string
+		for _, ts := range tss {
+			if ts.MetricName.GetTagValue("le") != nil {
+				t.Fatalf("unexpected `le` label in the converted bucket %s", ts.MetricName.String())
+			}
+			result = append(result, fmt.Sprintf("%s %v", ts.MetricName.String(), ts.Values))
+		}
+		if fmt.Sprintf("%q", result) != fmt.Sprintf("%q", resultExpected) {
+			t.Fatalf("unexpected result;\ngot\n%q\nwant\n%q", result, resultExpected)
+		}
+	}
+
+	// Every decade is a single bucket. Multiple `le` bounds are merged into the bucket with the nearest upper bound.
+	// NaN and decreasing cumulative counters do not produce negative counts.
+	f(1, []string{
+		`request_duration_seconds_bucket{job="foo",vmrange="0...0"} [1 1]`,
+		`request_duration_seconds_bucket{job="foo",vmrange="1.000e-02...1.000e-01"} [8 4]`,
+		`request_duration_seconds_bucket{job="foo",vmrange="1.000e-01...1.000e+00"} [11 15]`,
+		`request_duration_seconds_bucket{job="foo",vmrange="1.000e+00...1.000e+01"} [3 10]`,
+		`request_duration_seconds_bucket{job="foo",vmrange="1.000e+01...+Inf"} [2 0]`,
+	})
+
+	// The default resolution for VictoriaMetrics histograms. Every `le` bucket goes to a distinct `vmrange` bucket.
+	f(18, []string{
+		`request_duration_seconds_bucket{job="foo",vmrange="0...0"} [1 1]`,
+		`request_duration_seconds_bucket{job="foo",vmrange="4.642e-02...5.275e-02"} [1 1]`,
+		`request_duration_seconds_bucket{job="foo",vmrange="8.799e-02...1.000e-01"} [3 3]`,
+		`request_duration_seconds_bucket{job="foo",vmrange="2.783e-01...3.162e-01"} [4 0]`,
+		`request_duration_seconds_bucket{job="foo",vmrange="5.995e-01...6.813e-01"} [5 10]`,
+		`request_duration_seconds_bucket{job="foo",vmrange="1.292e+00...1.468e+00"} [6 5]`,
+		`request_duration_seconds_bucket{job="foo",vmrange="3.594e+00...4.084e+00"} [2 1]`,
+		`request_duration_seconds_bucket{job="foo",vmrange="8.799e+00...1.000e+01"} [1 9]`,
+		`request_duration_seconds_bucket{job="foo",vmrange="1.000e+01...+Inf"} [2 0]`,
+	})
+}
+
+func TestLEBucketsToVMRangePrecision(t *testing.T) {
+	timestamps := []int64{1000}
+	const total = 1e6
+	// Generate classic histogram buckets with arbitrary `le` bounds.
+	les := []float64{0.003, 0.0071, 0.02, 0.047, 0.13, 0.25, 0.61, 1.9, 3.3, 7.7, 12}
+	newBuckets := func() []*timeseries {
+		var tss []*timeseries
+		addBucket := func(le string, count float64) {
+			ts := &timeseries{
+				Values:     []float64{count},
+				Timestamps: timestamps,
+			}
+			ts.MetricName.MetricGroup = []byte("request_duration_seconds_bucket")
+			ts.MetricName.AddTag("le", le)
+			tss = append(tss, ts)
+		}
+		for _, le := range les {
+			// Exponential distribution with the mean 3
+			addBucket(fmt.Sprintf("%g", le), math.Round(total*(1-math.Exp(-le/3))))
+		}
+		addBucket("+Inf", total)
+		return tss
+	}
+
+	f := func(bucketsPerDecade int) {
+		t.Helper()
+		tss := leBucketsToVMRange(newBuckets(), bucketsPerDecade)
+		// Convert the buckets back to `le` buckets and verify that cumulative counters are preserved,
+		// while `le` bounds are shifted by up to a half of the bucket width in logarithmic scale.
+		tss = vmrangeBucketsToLE(tss)
+		counts := make(map[float64]float64)
+		var lesConverted []float64
+		for _, ts := range tss {
+			le, err := strconv.ParseFloat(string(ts.MetricName.GetTagValue("le")), 64)
+			if err != nil {
+				t.Fatalf("cannot parse le: %s", err)
+			}
+			counts[le] = ts.Values[0]
+			lesConverted = append(lesConverted, le)
+		}
+		maxLogError := 0.5 / float64(bucketsPerDecade)
+		for _, le := range les {
+			countExpected := math.Round(total * (1 - math.Exp(-le/3)))
+			found := false
+			for _, leConverted := range lesConverted {
+				if math.Abs(math.Log10(leConverted)-math.Log10(le)) > maxLogError+1e-3 {
+					continue
+				}
+				if counts[leConverted] >= countExpected {
+					found = true
+					break
+				}
+			}
+			if !found {
+				t.Fatalf("cannot find the bucket with le=%g shifted by up to %g decades and with the cumulative count %g for buckets_per_decade=%d; got buckets %v",
+					le, maxLogError, countExpected, bucketsPerDecade, counts)
+			}
+		}
+		if counts[math.Inf(1)] != total {
+			t.Fatalf("unexpected total count; got %g; want %g", counts[math.Inf(1)], float64(total))
+		}
+	}
+
+	f(1)
+	f(3)
+	f(18)
+	f(100)
+}
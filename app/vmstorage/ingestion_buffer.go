@@ -0,0 +1,281 @@
+package vmstorage
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/persistentqueue"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timerpool"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	insertBufferPath = flag.String("insert.bufferPath", "", "Optional path to a directory for buffering ingested samples when the storage cannot keep up with the ingestion rate. "+
+		"Up to -insert.bufferMaxInmemorySize of samples are buffered in memory, while the rest of samples are spilled to this directory. "+
+		"Samples are written directly to the storage if this flag isn't set. See https://docs.victoriametrics.com/#ingestion-buffer")
+	insertBufferMaxInmemorySize = flagutil.NewBytes("insert.bufferMaxInmemorySize", 64*1024*1024, "The maximum size of ingested samples to buffer in memory if -insert.bufferPath is set. "+
+		"Samples are spilled to -insert.bufferPath when the limit is reached")
+	insertBufferMaxDiskUsage = flagutil.NewBytes("insert.bufferMaxDiskUsage", 0, "The maximum disk usage at -insert.bufferPath. "+
+		"The oldest buffered samples are dropped when the limit is reached. Disk usage is unlimited if set to 0")
+	insertBufferMaxRowsPerSecond = flag.Int("insert.bufferMaxRowsPerSecond", 0, "Optional rate limit for samples written from -insert.bufferPath to the storage. "+
+		"Excess samples remain in the buffer until they can be written to the storage. The rate isn't limited if set to 0")
+)
+
+// maxIngestionBufferBlockSize is the maximum size of a block with marshaled rows in the ingestion buffer.
+const maxIngestionBufferBlockSize = 8 * 1024 * 1024
+
+// maxIngestionBufferInmemoryBlocks is the maximum number of blocks in the in-memory part of the ingestion buffer.
+//
+// The size of in-memory blocks is limited by -insert.bufferMaxInmemorySize.
+const maxIngestionBufferInmemoryBlocks = 10000
+
+// The minimum and the maximum delay between retries for writing buffered rows to the storage.
+const (
+	ingestionBufferRetryMinDelay = 100 * time.Millisecond
+	ingestionBufferRetryMaxDelay = 10 * time.Second
+)
+
+// ingestionBuffer is a bounded in-memory buffer for ingested rows, which spills rows to disk
+// when they cannot be written to the storage in a timely manner.
+type ingestionBuffer struct {
+	fq *persistentqueue.FastQueue
+
+	// addRows must write mrs to the storage.
+	addRows func(mrs []storage.MetricRow) error
+
+	rl ingestionRateLimiter
+
+	wg     sync.WaitGroup
+	stopCh chan struct{}
+
+	writeErrors *metrics.Counter
+}
+
+// ingestionBufferGlobal is non-nil if -insert.bufferPath is set.
+var ingestionBufferGlobal *ingestionBuffer
+
+func mustInitIngestionBuffer() {
+	if *insertBufferPath == "" {
+		return
+	}
+	ingestionBufferGlobal = mustOpenIngestionBuffer(*insertBufferPath, insertBufferMaxInmemorySize.N, insertBufferMaxDiskUsage.N,
+		*insertBufferMaxRowsPerSecond, cgroup.AvailableCPUs(), addRowsToStorage)
+}
+
+func mustStopIngestionBuffer() {
+	if ingestionBufferGlobal == nil {
+		return
+	}
+	ingestionBufferGlobal.MustStop()
+	ingestionBufferGlobal = nil
+}
+
+// mustOpenIngestionBuffer opens ingestion buffer at the given path.
+//
+// The buffered rows are written via addRows by the given number of workers.
+// Up to maxInmemorySize bytes of rows are buffered in memory, while the rest of rows are spilled to disk.
+func mustOpenIngestionBuffer(path string, maxInmemorySize, maxDiskUsage, maxRowsPerSecond, workers int, addRows func(mrs []storage.MetricRow) error) *ingestionBuffer {
+	if maxInmemorySize <= 0 {
+		maxInmemorySize = 1
+	}
+	ib := &ingestionBuffer{
+		fq:      persistentqueue.MustOpenFastQueueWithMaxInmemoryBytes(path, "ingestion_buffer", maxIngestionBufferInmemoryBlocks, maxInmemorySize, maxDiskUsage,
+			metrics.GetOrCreateCounter(`vm_insert_buffer_spilled_blocks_total`)),
+		addRows: addRows,
+		stopCh:  make(chan struct{}),
+		rl: ingestionRateLimiter{
+			perSecondLimit: int64(maxRowsPerSecond),
+			limitReached:   metrics.GetOrCreateCounter(`vm_insert_buffer_rate_limit_reached_total`),
+		},
+		writeErrors: metrics.GetOrCreateCounter(`vm_insert_buffer_write_errors_total`),
+	}
+	_ = metrics.GetOrCreateGauge(`vm_insert_buffer_pending_bytes`, func() float64 {
+		if ib := ingestionBufferGlobal; ib != nil {
+			return float64(ib.fq.GetPendingBytes())
+		}
+		return 0
+	})
+	_ = metrics.GetOrCreateGauge(`vm_insert_buffer_inmemory_blocks`, func() float64 {
+		if ib := ingestionBufferGlobal; ib != nil {
+			return float64(ib.fq.GetInmemoryQueueLen())
+		}
+		return 0
+	})
+	_ = metrics.GetOrCreateGauge(`vm_insert_buffer_inmemory_bytes`, func() float64 {
+		if ib := ingestionBufferGlobal; ib != nil {
+			return float64(ib.fq.GetInmemoryQueueBytes())
+		}
+		return 0
+	})
+	for i := 0; i < workers; i++ {
+		ib.wg.Add(1)
+		go func() {
+			defer ib.wg.Done()
+			ib.runWorker()
+		}()
+	}
+	logger.Infof("started %d workers for writing buffered samples from %q to the storage", workers, path)
+	return ib
+}
+
+// MustStop stops ib.
+//
+// Workers write the remaining buffered rows to the storage for a few seconds.
+// Rows, which weren't written to the storage, are persisted on disk and are written to the storage after the restart.
+//
+// It is expected that there are no new writers during and after the call.
+func (ib *ingestionBuffer) MustStop() {
+	close(ib.stopCh)
+	ib.fq.UnblockAllReaders()
+	ib.wg.Wait()
+	ib.fq.MustClose()
+}
+
+// MustAddRows adds mrs to ib.
+func (ib *ingestionBuffer) MustAddRows(mrs []storage.MetricRow) {
+	bb := ingestionBufferBlockPool.Get()
+	for i := range mrs {
+		bb.B = mrs[i].Marshal(bb.B)
+		if len(bb.B) >= maxIngestionBufferBlockSize {
+			ib.fq.MustWriteBlock(bb.B)
+			bb.Reset()
+		}
+	}
+	if len(bb.B) > 0 {
+		ib.fq.MustWriteBlock(bb.B)
+	}
+	ingestionBufferBlockPool.Put(bb)
+}
+
+var ingestionBufferBlockPool bytesutil.ByteBufferPool
+
+func (ib *ingestionBuffer) runWorker() {
+	var block []byte
+	var mrs []storage.MetricRow
+	for {
+		var ok bool
+		block, ok = ib.fq.MustReadBlock(block[:0])
+		if !ok {
+			return
+		}
+		var err error
+		mrs, err = unmarshalMetricRows(mrs[:0], block)
+		if err != nil {
+			logger.Panicf("FATAL: cannot unmarshal buffered samples: %s", err)
+		}
+		if !ib.rl.register(len(mrs), ib.stopCh) || !ib.addRowsWithRetries(mrs) {
+			// Return the rows, which weren't written to the storage, to the buffer, so they are persisted on disk
+			// and are written to the storage after the restart.
+			ib.fq.MustWriteBlock(block)
+			return
+		}
+	}
+}
+
+// addRowsWithRetries writes mrs to the storage.
+//
+// The write is retried with exponential backoff until it succeeds, since the client already received
+// successful response for mrs, so they mustn't be lost. For example, the storage may be in read-only mode
+// because of low free disk space.
+//
+// false is returned if ib is stopped before mrs are written to the storage.
+func (ib *ingestionBuffer) addRowsWithRetries(mrs []storage.MetricRow) bool {
+	retryDelay := ingestionBufferRetryMinDelay
+	for {
+		err := ib.addRows(mrs)
+		if err == nil {
+			return true
+		}
+		ib.writeErrors.Inc()
+		logger.WithThrottler("ingestionBufferWrite", 5*time.Second).Errorf("cannot write %d buffered samples to the storage: %s; retrying in %s", len(mrs), err, retryDelay)
+		t := timerpool.Get(retryDelay)
+		select {
+		case <-ib.stopCh:
+			timerpool.Put(t)
+			return false
+		case <-t.C:
+			timerpool.Put(t)
+		}
+		retryDelay *= 2
+		if retryDelay > ingestionBufferRetryMaxDelay {
+			retryDelay = ingestionBufferRetryMaxDelay
+		}
+	}
+}
+
+func unmarshalMetricRows(dst []storage.MetricRow, src []byte) ([]storage.MetricRow, error) {
+	for len(src) > 0 {
+		if len(dst) < cap(dst) {
+			dst = dst[:len(dst)+1]
+		} else {
+			dst = append(dst, storage.MetricRow{})
+		}
+		mr := &dst[len(dst)-1]
+		tail, err := mr.UnmarshalX(src)
+		if err != nil {
+			return dst, fmt.Errorf("cannot unmarshal sample #%d: %w", len(dst), err)
+		}
+		src = tail
+	}
+	return dst, nil
+}
+
+// ingestionRateLimiter limits the number of rows per second written from the ingestion buffer to the storage.
+type ingestionRateLimiter struct {
+	perSecondLimit int64
+
+	// mu protects budget and deadline from concurrent access.
+	mu sync.Mutex
+
+	// The current budget. It is increased by perSecondLimit every second.
+	budget int64
+
+	// The next deadline for increasing the budget by perSecondLimit
+	deadline time.Time
+
+	limitReached *metrics.Counter
+}
+
+// register waits until rowsLen rows can be written to the storage according to the rate limit.
+//
+// false is returned if stopCh is closed while waiting.
+func (rl *ingestionRateLimiter) register(rowsLen int, stopCh <-chan struct{}) bool {
+	limit := rl.perSecondLimit
+	if limit <= 0 {
+		return true
+	}
+	for {
+		rl.mu.Lock()
+		if rl.budget > 0 {
+			rl.budget -= int64(rowsLen)
+			rl.mu.Unlock()
+			return true
+		}
+		d := time.Until(rl.deadline)
+		if d <= 0 {
+			rl.budget += limit
+			rl.deadline = time.Now().Add(time.Second)
+			rl.mu.Unlock()
+			continue
+		}
+		rl.mu.Unlock()
+
+		// Wait for the next deadline without holding rl.mu, so concurrent workers could be stopped.
+		rl.limitReached.Inc()
+		t := timerpool.Get(d)
+		select {
+		case <-stopCh:
+			timerpool.Put(t)
+			return false
+		case <-t.C:
+			timerpool.Put(t)
+		}
+	}
+}
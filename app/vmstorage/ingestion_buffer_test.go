@@ -0,0 +1,244 @@
+package vmstorage
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+func TestIngestionBufferSpillsToDisk(t *testing.T) {
+	const path = "ingestion-buffer-spill"
+	const maxInmemorySize = 1000
+	const blocksCount = 100
+	const rowsPerBlock = 10
+	fs.MustRemoveAll(path)
+	defer fs.MustRemoveAll(path)
+
+	// Simulate slow storage, which doesn't accept rows until releaseCh is closed.
+	releaseCh := make(chan struct{})
+	var mu sync.Mutex
+	received := make(map[string]float64)
+	addRows := func(mrs []storage.MetricRow) error {
+		<-releaseCh
+		mu.Lock()
+		for i := range mrs {
+			mr := &mrs[i]
+			received[fmt.Sprintf("%s:%d", mr.MetricNameRaw, mr.Timestamp)] = mr.Value
+		}
+		mu.Unlock()
+		return nil
+	}
+	spilledBlocksStart := metrics.GetOrCreateCounter(`vm_insert_buffer_spilled_blocks_total`).Get()
+	ib := mustOpenIngestionBuffer(path, maxInmemorySize, 0, 0, 1, addRows)
+
+	expected := make(map[string]float64)
+	for i := 0; i < blocksCount; i++ {
+		mrs := make([]storage.MetricRow, rowsPerBlock)
+		for j := range mrs {
+			mr := &mrs[j]
+			mr.MetricNameRaw = []byte(fmt.Sprintf("metric_%d", j))
+			mr.Timestamp = int64(i)
+			mr.Value = float64(i*rowsPerBlock + j)
+			expected[fmt.Sprintf("%s:%d", mr.MetricNameRaw, mr.Timestamp)] = mr.Value
+		}
+		ib.MustAddRows(mrs)
+	}
+
+	// The in-memory part of the buffer must remain bounded, while the rest of blocks must be spilled to disk.
+	if n := ib.fq.GetInmemoryQueueBytes(); n > maxInmemorySize {
+		t.Fatalf("too big size of in-memory blocks; got %d bytes; want up to %d bytes", n, maxInmemorySize)
+	}
+	if n := metrics.GetOrCreateCounter(`vm_insert_buffer_spilled_blocks_total`).Get(); n <= spilledBlocksStart {
+		t.Fatalf("expecting non-zero number of spilled blocks")
+	}
+	if n := ib.fq.GetPendingBytes(); n == 0 {
+		t.Fatalf("expecting non-zero pending bytes in the buffer")
+	}
+
+	// All the buffered rows must be written to the storage after it becomes ready to accept them.
+	close(releaseCh)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		mu.Lock()
+		n := len(received)
+		mu.Unlock()
+		if n == len(expected) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout when waiting for buffered rows; got %d rows; want %d rows", n, len(expected))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	ib.MustStop()
+
+	for k, v := range expected {
+		if received[k] != v {
+			t.Fatalf("unexpected value for %q; got %v; want %v", k, received[k], v)
+		}
+	}
+}
+
+func TestIngestionBufferPersistsOnStop(t *testing.T) {
+	const path = "ingestion-buffer-persist"
+	fs.MustRemoveAll(path)
+	defer fs.MustRemoveAll(path)
+
+	// The storage cannot accept rows, so they must be persisted to disk on stop.
+	addRowsBroken := func(mrs []storage.MetricRow) error {
+		t.Fatalf("unexpected call to addRows")
+		return nil
+	}
+	ib := mustOpenIngestionBuffer(path, 1000, 0, 0, 0, addRowsBroken)
+	ib.MustAddRows([]storage.MetricRow{
+		{MetricNameRaw: []byte("foo"), Timestamp: 123, Value: 1},
+		{MetricNameRaw: []byte("bar"), Timestamp: 456, Value: 2},
+	})
+	ib.MustStop()
+
+	// The persisted rows must be written to the storage after the restart.
+	resultCh := make(chan []string, 1)
+	addRows := func(mrs []storage.MetricRow) error {
+		var result []string
+		for i := range mrs {
+			mr := &mrs[i]
+			result = append(result, fmt.Sprintf("%s:%d:%v", mr.MetricNameRaw, mr.Timestamp, mr.Value))
+		}
+		resultCh <- result
+		return nil
+	}
+	ib = mustOpenIngestionBuffer(path, 1000, 0, 0, 1, addRows)
+	select {
+	case result := <-resultCh:
+		resultExpected := "[foo:123:1 bar:456:2]"
+		if s := fmt.Sprintf("%s", result); s != resultExpected {
+			t.Fatalf("unexpected rows; got %s; want %s", s, resultExpected)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timeout when waiting for persisted rows")
+	}
+	ib.MustStop()
+}
+
+func TestIngestionBufferRetriesFailedWrites(t *testing.T) {
+	const path = "ingestion-buffer-retry"
+	fs.MustRemoveAll(path)
+	defer fs.MustRemoveAll(path)
+
+	// The storage fails the first writes, e.g. because it is in read-only mode.
+	var mu sync.Mutex
+	attempts := 0
+	resultCh := make(chan []string, 1)
+	addRows := func(mrs []storage.MetricRow) error {
+		mu.Lock()
+		attempts++
+		n := attempts
+		mu.Unlock()
+		if n <= 3 {
+			return fmt.Errorf("storage is in read-only mode")
+		}
+		var result []string
+		for i := range mrs {
+			mr := &mrs[i]
+			result = append(result, fmt.Sprintf("%s:%d:%v", mr.MetricNameRaw, mr.Timestamp, mr.Value))
+		}
+		resultCh <- result
+		return nil
+	}
+	ib := mustOpenIngestionBuffer(path, 1000, 0, 0, 1, addRows)
+	ib.MustAddRows([]storage.MetricRow{
+		{MetricNameRaw: []byte("foo"), Timestamp: 123, Value: 1},
+	})
+	select {
+	case result := <-resultCh:
+		resultExpected := "[foo:123:1]"
+		if s := fmt.Sprintf("%s", result); s != resultExpected {
+			t.Fatalf("unexpected rows; got %s; want %s", s, resultExpected)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timeout when waiting for rows")
+	}
+	ib.MustStop()
+	if n := ib.writeErrors.Get(); n < 3 {
+		t.Fatalf("unexpected number of write errors; got %d; want at least 3", n)
+	}
+}
+
+func TestIngestionBufferPersistsFailedWritesOnStop(t *testing.T) {
+	const path = "ingestion-buffer-persist-failed"
+	fs.MustRemoveAll(path)
+	defer fs.MustRemoveAll(path)
+
+	// The storage constantly fails writes, so the rows must be persisted to disk on stop instead of being dropped.
+	attemptCh := make(chan struct{}, 100)
+	addRowsBroken := func(mrs []storage.MetricRow) error {
+		attemptCh <- struct{}{}
+		return fmt.Errorf("storage is in read-only mode")
+	}
+	ib := mustOpenIngestionBuffer(path, 1000, 0, 0, 1, addRowsBroken)
+	ib.MustAddRows([]storage.MetricRow{
+		{MetricNameRaw: []byte("foo"), Timestamp: 123, Value: 1},
+	})
+	select {
+	case <-attemptCh:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timeout when waiting for write attempt")
+	}
+	ib.MustStop()
+
+	// The persisted rows must be written to the storage after the restart.
+	resultCh := make(chan []string, 1)
+	addRows := func(mrs []storage.MetricRow) error {
+		var result []string
+		for i := range mrs {
+			mr := &mrs[i]
+			result = append(result, fmt.Sprintf("%s:%d:%v", mr.MetricNameRaw, mr.Timestamp, mr.Value))
+		}
+		resultCh <- result
+		return nil
+	}
+	ib = mustOpenIngestionBuffer(path, 1000, 0, 0, 1, addRows)
+	select {
+	case result := <-resultCh:
+		resultExpected := "[foo:123:1]"
+		if s := fmt.Sprintf("%s", result); s != resultExpected {
+			t.Fatalf("unexpected rows; got %s; want %s", s, resultExpected)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timeout when waiting for persisted rows")
+	}
+	ib.MustStop()
+}
+
+func TestIngestionRateLimiter(t *testing.T) {
+	rl := &ingestionRateLimiter{
+		perSecondLimit: 100,
+		limitReached:   &metrics.Counter{},
+	}
+	stopCh := make(chan struct{})
+	startTime := time.Now()
+	for i := 0; i < 3; i++ {
+		if !rl.register(100, stopCh) {
+			t.Fatalf("unexpected false result from register")
+		}
+	}
+	// The first 100 rows are registered immediately, while the next 200 rows must wait for 2 seconds.
+	if d := time.Since(startTime); d < 1900*time.Millisecond {
+		t.Fatalf("rate limit isn't applied; registered 300 rows in %s with the limit 100 rows per second", d)
+	}
+
+	// Waiting for the rate limit must be interrupted by closing stopCh.
+	close(stopCh)
+	startTime = time.Now()
+	if rl.register(100, stopCh) {
+		t.Fatalf("expecting false result from register after stopCh is closed")
+	}
+	if d := time.Since(startTime); d > 500*time.Millisecond {
+		t.Fatalf("too long wait for the rate limit after stopCh is closed: %s", d)
+	}
+}
@@ -1,10 +1,12 @@
 package vmstorage
 
 import (
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -14,6 +16,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputils"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/mergeset"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
@@ -23,11 +26,14 @@ import (
 )
 
 var (
-	retentionPeriod   = flagutil.NewDuration("retentionPeriod", "1", "Data with timestamps outside the retentionPeriod is automatically deleted")
-	snapshotAuthKey   = flag.String("snapshotAuthKey", "", "authKey, which must be passed in query string to /snapshot* pages")
-	forceMergeAuthKey = flag.String("forceMergeAuthKey", "", "authKey, which must be passed in query string to /internal/force_merge pages")
-	forceFlushAuthKey = flag.String("forceFlushAuthKey", "", "authKey, which must be passed in query string to /internal/force_flush pages")
-	snapshotsMaxAge   = flagutil.NewDuration("snapshotsMaxAge", "0", "Automatically delete snapshots older than -snapshotsMaxAge if it is set to non-zero duration. Make sure that backup process has enough time to finish the backup before the corresponding snapshot is automatically deleted")
+	retentionPeriod       = flagutil.NewDuration("retentionPeriod", "1", "Data with timestamps outside the retentionPeriod is automatically deleted")
+	snapshotAuthKey       = flag.String("snapshotAuthKey", "", "authKey, which must be passed in query string to /snapshot* pages")
+	forceMergeAuthKey     = flag.String("forceMergeAuthKey", "", "authKey, which must be passed in query string to /internal/force_merge pages")
+	forceMergeConcurrency = flag.Int("forceMergeConcurrency", 1, "The maximum number of concurrently running forced merges initiated via /internal/force_merge. "+
+		"Additional forced merges wait until the running merges are finished. See https://docs.victoriametrics.com/#forced-merge")
+	forceFlushAuthKey     = flag.String("forceFlushAuthKey", "", "authKey, which must be passed in query string to /internal/force_flush pages")
+	newSeriesAuditAuthKey = flag.String("newSeriesAuditAuthKey", "", "authKey, which must be passed in query string to /api/v1/status/new_series_audit page")
+	snapshotsMaxAge       = flagutil.NewDuration("snapshotsMaxAge", "0", "Automatically delete snapshots older than -snapshotsMaxAge if it is set to non-zero duration. Make sure that backup process has enough time to finish the backup before the corresponding snapshot is automatically deleted")
 
 	precisionBits = flag.Int("precisionBits", 64, "The number of precision bits to store per each value. Lower precision bits improves data compression at the cost of precision loss")
 
@@ -37,7 +43,13 @@ var (
 	finalMergeDelay = flag.Duration("finalMergeDelay", 0, "The delay before starting final merge for per-month partition after no new data is ingested into it. "+
 		"Final merge may require additional disk IO and CPU resources. Final merge may increase query speed and reduce disk space usage in some cases. "+
 		"Zero value disables final merge")
-	bigMergeConcurrency     = flag.Int("bigMergeConcurrency", 0, "The maximum number of CPU cores to use for big merges. Default value is used if set to 0")
+	bigMergeConcurrency   = flag.Int("bigMergeConcurrency", 0, "The maximum number of CPU cores to use for big merges. Default value is used if set to 0")
+	bigMergeCompressLevel = flag.Int("bigMergeCompressLevel", 0, "Zstd compression level for data blocks in parts created by big merges. "+
+		"Higher levels result in smaller data on disk at the cost of higher CPU usage during background merges. "+
+		"Valid values are in the range 1..22. The compression level is selected automatically if set to 0. See also -bigMergeCompressLevelMinAge")
+	bigMergeCompressLevelMinAge = flag.Duration("bigMergeCompressLevelMinAge", 0, "The minimum age of the newest sample in the part created by big merge "+
+		"for applying -bigMergeCompressLevel to it. This allows applying higher compression only to cold data. "+
+		"-bigMergeCompressLevel is applied to all the parts created by big merges if set to 0")
 	smallMergeConcurrency   = flag.Int("smallMergeConcurrency", 0, "The maximum number of CPU cores to use for small merges. Default value is used if set to 0")
 	retentionTimezoneOffset = flag.Duration("retentionTimezoneOffset", 0, "The offset for performing indexdb rotation. "+
 		"If set to 0, then the indexdb rotation is performed at 4am UTC time per each -retentionPeriod. "+
@@ -52,6 +64,22 @@ var (
 		"Excess series are logged and dropped. This can be useful for limiting series cardinality. See also -storage.maxDailySeries")
 	maxDailySeries = flag.Int("storage.maxDailySeries", 0, "The maximum number of unique series can be added to the storage during the last 24 hours. "+
 		"Excess series are logged and dropped. This can be useful for limiting series churn rate. See also -storage.maxHourlySeries")
+	cardinalitySamplerThreshold = flag.Int("storage.cardinalitySamplerThreshold", 0, "The number of new series per minute, after which metric names and label names "+
+		"for new series are sampled into a report available at /api/v1/status/cardinality_sampler. This helps locating the source of cardinality spike "+
+		"without a full cardinality scan. The sampler is disabled if set to 0. See https://docs.victoriametrics.com/#cardinality-sampler")
+	newSeriesAuditBufferSize = flag.Int("storage.newSeriesAuditBufferSize", 0, "The maximum number of the last newly registered series to keep for streaming "+
+		"via /api/v1/status/new_series_audit. The audit of new series is disabled if set to 0. See https://docs.victoriametrics.com/#new-series-audit")
+	newSeriesAuditMaxRate = flag.Int("storage.newSeriesAuditMaxRate", 1000, "The maximum number of newly registered series per second to put into the audit log. "+
+		"Excess series aren't put into the audit log; they are counted in vm_new_series_audit_dropped_total metric. See also -storage.newSeriesAuditBufferSize")
+	lastValueCacheSize = flag.Int("storage.lastValueCacheSize", 0, "The maximum number of series to keep the last ingested values for in memory. "+
+		"Instant queries for the current values of series are served from this cache without reading data from disk. "+
+		"The cache is disabled if set to 0. See https://docs.victoriametrics.com/#last-value-cache")
+
+	maxExemplars = flag.Int("storage.maxExemplars", 100e3, "The maximum number of exemplars to keep in memory. The oldest exemplars are dropped when the limit is reached. "+
+		"Exemplars are lost on restart. Set to 0 for disabling exemplars storage. See https://prometheus.io/docs/prometheus/latest/querying/api/#querying-exemplars")
+	maxMetadataEntries = flag.Int("storage.maxMetadataEntries", 100e3, "The maximum number of metric families to keep TYPE, HELP and UNIT metadata for in memory. "+
+		"Metadata for new metric families is dropped when the limit is reached. Metadata is lost on restart. Set to 0 for disabling metadata storage. "+
+		"See https://prometheus.io/docs/prometheus/latest/querying/api/#querying-metric-metadata")
 
 	minFreeDiskSpaceBytes = flagutil.NewBytes("storage.minFreeDiskSpaceBytes", 10e6, "The minimum free disk space at -storageDataPath after which the storage stops accepting new data")
 
@@ -91,10 +119,33 @@ func InitWithoutMetrics(resetCacheIfNeeded func(mrs []storage.MetricRow)) {
 	}
 
 	resetResponseCacheIfNeeded = resetCacheIfNeeded
+	n := *forceMergeConcurrency
+	if n < 1 {
+		n = 1
+	}
+	forceMergeConcurrencyCh = make(chan struct{}, n)
 	storage.SetLogNewSeries(*logNewSeries)
+	cardinalitySamplerGlobal = nil
+	if *cardinalitySamplerThreshold > 0 {
+		cardinalitySamplerGlobal = storage.NewCardinalitySampler(*cardinalitySamplerThreshold)
+	}
+	storage.SetCardinalitySampler(cardinalitySamplerGlobal)
+	seriesAuditLogGlobal = nil
+	if *newSeriesAuditBufferSize > 0 {
+		if *newSeriesAuditMaxRate <= 0 {
+			logger.Fatalf("-storage.newSeriesAuditMaxRate must be positive; got %d", *newSeriesAuditMaxRate)
+		}
+		seriesAuditLogGlobal = storage.NewSeriesAuditLog(*newSeriesAuditBufferSize, *newSeriesAuditMaxRate)
+	}
+	storage.SetSeriesAuditLog(seriesAuditLogGlobal)
+	storage.SetLastValueCacheSize(*lastValueCacheSize)
 	storage.SetFinalMergeDelay(*finalMergeDelay)
 	storage.SetBigMergeWorkersCount(*bigMergeConcurrency)
 	storage.SetSmallMergeWorkersCount(*smallMergeConcurrency)
+	if *bigMergeCompressLevel < 0 || *bigMergeCompressLevel > 22 {
+		logger.Fatalf("-bigMergeCompressLevel must be in the range 0..22; got %d", *bigMergeCompressLevel)
+	}
+	storage.SetBigMergeCompressLevel(*bigMergeCompressLevel, *bigMergeCompressLevelMinAge)
 	storage.SetRetentionTimezoneOffset(*retentionTimezoneOffset)
 	storage.SetFreeDiskSpaceLimit(minFreeDiskSpaceBytes.N)
 	storage.SetTSIDCacheSize(cacheSizeStorageTSID.N)
@@ -113,7 +164,11 @@ func InitWithoutMetrics(resetCacheIfNeeded func(mrs []storage.MetricRow)) {
 		logger.Fatalf("cannot open a storage at %s with -retentionPeriod=%s: %s", *DataPath, retentionPeriod, err)
 	}
 	Storage = strg
+	exemplarStorage = storage.NewExemplarStorage(*maxExemplars)
+	metadataStorage = storage.NewMetadataStorage(*maxMetadataEntries)
 	initStaleSnapshotsRemover(strg)
+	mustInitTieredStorage(strg)
+	mustInitIngestionBuffer()
 
 	var m storage.Metrics
 	strg.UpdateMetrics(&m)
@@ -141,7 +196,20 @@ var WG syncwg.WaitGroup
 var resetResponseCacheIfNeeded func(mrs []storage.MetricRow)
 
 // AddRows adds mrs to the storage.
+//
+// mrs are written to the storage asynchronously via ingestion buffer if -insert.bufferPath is set.
 func AddRows(mrs []storage.MetricRow) error {
+	if Storage.IsReadOnly() {
+		return errReadOnly
+	}
+	if ib := ingestionBufferGlobal; ib != nil {
+		ib.MustAddRows(mrs)
+		return nil
+	}
+	return addRowsToStorage(mrs)
+}
+
+func addRowsToStorage(mrs []storage.MetricRow) error {
 	if Storage.IsReadOnly() {
 		return errReadOnly
 	}
@@ -162,6 +230,36 @@ func RegisterMetricNames(mrs []storage.MetricRow) error {
 	return err
 }
 
+// AddExemplars adds ers to the in-memory exemplars storage.
+func AddExemplars(ers []storage.ExemplarRow) error {
+	return exemplarStorage.AddRows(ers)
+}
+
+// SearchExemplars returns exemplars on the given tr for the series with the given mns.
+func SearchExemplars(mns []storage.MetricName, tr storage.TimeRange) []storage.SeriesExemplars {
+	return exemplarStorage.Search(mns, tr)
+}
+
+var exemplarStorage *storage.ExemplarStorage
+
+// AddMetadata adds mds to the in-memory metadata storage.
+func AddMetadata(mds []storage.MetricMetadata) {
+	metadataStorage.Add(mds)
+}
+
+// SearchMetadata returns up to limit metadata entries for the given metric.
+//
+// Metadata for all the metrics is returned if metric is empty.
+func SearchMetadata(metric string, limit int) []storage.MetricMetadata {
+	return metadataStorage.Search(metric, limit)
+}
+
+var metadataStorage *storage.MetadataStorage
+
+var cardinalitySamplerGlobal *storage.CardinalitySampler
+
+var seriesAuditLogGlobal *storage.SeriesAuditLog
+
 // DeleteMetrics deletes metrics matching tfss.
 //
 // Returns the number of deleted metrics.
@@ -180,6 +278,16 @@ func SearchMetricNames(qt *querytracer.Tracer, tfss []*storage.TagFilters, tr st
 	return mns, err
 }
 
+// SearchLastValues returns the last ingested values for series matching tfss on tr from the cache.
+//
+// See storage.Storage.SearchLastValues for details.
+func SearchLastValues(qt *querytracer.Tracer, tfss []*storage.TagFilters, tr storage.TimeRange, minTimestamp int64, maxMetrics int, deadline uint64) ([]storage.LastValue, bool, error) {
+	WG.Add(1)
+	lvs, ok, err := Storage.SearchLastValues(qt, tfss, tr, minTimestamp, maxMetrics, deadline)
+	WG.Done()
+	return lvs, ok, err
+}
+
 // SearchTagKeysOnTimeRange searches for tag keys on tr.
 func SearchTagKeysOnTimeRange(tr storage.TimeRange, maxTagKeys int, deadline uint64) ([]string, error) {
 	WG.Add(1)
@@ -266,9 +374,12 @@ func GetSeriesCount(deadline uint64) (uint64, error) {
 func Stop() {
 	logger.Infof("gracefully closing the storage at %s", *DataPath)
 	startTime := time.Now()
+	// The ingestion buffer must be stopped before the storage, since it writes the buffered samples to the storage.
+	mustStopIngestionBuffer()
 	WG.WaitAndBlock()
 	stopStaleSnapshotsRemover()
 	Storage.MustClose()
+	mustStopTieredStorage()
 	logger.Infof("successfully closed the storage in %.3f seconds", time.Since(startTime).Seconds())
 
 	logger.Infof("the storage has been stopped")
@@ -283,18 +394,41 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 			httpserver.Errorf(w, r, "invalid authKey %q. It must match the value from -forceMergeAuthKey command line flag", authKey)
 			return true
 		}
-		// Run force merge in background
 		partitionNamePrefix := r.FormValue("partition_prefix")
-		go func() {
-			activeForceMerges.Inc()
-			defer activeForceMerges.Dec()
-			logger.Infof("forced merge for partition_prefix=%q has been started", partitionNamePrefix)
-			startTime := time.Now()
-			if err := Storage.ForceMergePartitions(partitionNamePrefix); err != nil {
-				logger.Errorf("error in forced merge for partition_prefix=%q: %s", partitionNamePrefix, err)
-			}
-			logger.Infof("forced merge for partition_prefix=%q has been successfully finished in %.3f seconds", partitionNamePrefix, time.Since(startTime).Seconds())
-		}()
+		if r.FormValue("start") == "" && r.FormValue("end") == "" {
+			// Run force merge in background
+			go runForceMerge(fmt.Sprintf("partition_prefix=%q", partitionNamePrefix), func() error {
+				return Storage.ForceMergePartitions(partitionNamePrefix)
+			})
+			return true
+		}
+		if partitionNamePrefix != "" {
+			httpserver.Errorf(w, r, "partition_prefix cannot be used together with start and end query args")
+			return true
+		}
+		ct := time.Now().UnixNano() / 1e6
+		start, err := httputils.GetTime(r, "start", 0)
+		if err != nil {
+			httpserver.Errorf(w, r, "%s", err)
+			return true
+		}
+		end, err := httputils.GetTime(r, "end", ct)
+		if err != nil {
+			httpserver.Errorf(w, r, "%s", err)
+			return true
+		}
+		if start > end {
+			httpserver.Errorf(w, r, "start=%d cannot exceed end=%d", start, end)
+			return true
+		}
+		tr := storage.TimeRange{
+			MinTimestamp: start,
+			MaxTimestamp: end,
+		}
+		// Run force merge in background
+		go runForceMerge(fmt.Sprintf("time range %s", &tr), func() error {
+			return Storage.ForceMergePartitionsOnTimeRange(tr)
+		})
 		return true
 	}
 	if path == "/internal/force_flush" {
@@ -307,6 +441,37 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 		Storage.DebugFlush()
 		return true
 	}
+	if path == "/api/v1/status/cardinality_sampler" {
+		cs := cardinalitySamplerGlobal
+		if cs == nil {
+			httpserver.Errorf(w, r, "the cardinality sampler is disabled; set -storage.cardinalitySamplerThreshold command-line flag for enabling it")
+			return true
+		}
+		data, err := json.Marshal(cs.GetReport())
+		if err != nil {
+			httpserver.Errorf(w, r, "cannot marshal cardinality sampler report: %s", err)
+			return true
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"status":"success","data":%s}`, data)
+		return true
+	}
+	if path == "/api/v1/status/new_series_audit" {
+		authKey := r.FormValue("authKey")
+		if authKey != *newSeriesAuditAuthKey {
+			httpserver.Errorf(w, r, "invalid authKey %q. It must match the value from -newSeriesAuditAuthKey command line flag", authKey)
+			return true
+		}
+		sal := seriesAuditLogGlobal
+		if sal == nil {
+			httpserver.Errorf(w, r, "the audit of new series is disabled; set -storage.newSeriesAuditBufferSize command-line flag for enabling it")
+			return true
+		}
+		if err := writeNewSeriesAudit(w, r, sal); err != nil {
+			httpserver.Errorf(w, r, "%s", err)
+		}
+		return true
+	}
 	prometheusCompatibleResponse := false
 	if path == "/api/v1/admin/tsdb/snapshot" {
 		// Handle Prometheus API - https://prometheus.io/docs/prometheus/latest/querying/api/#snapshot .
@@ -422,7 +587,34 @@ var (
 	staleSnapshotsRemoverWG sync.WaitGroup
 )
 
-var activeForceMerges = metrics.NewCounter("vm_active_force_merges")
+var (
+	activeForceMerges  = metrics.NewCounter("vm_active_force_merges")
+	pendingForceMerges = metrics.NewCounter("vm_pending_force_merges")
+)
+
+// forceMergeConcurrencyCh limits the number of concurrently running forced merges to -forceMergeConcurrency.
+var forceMergeConcurrencyCh chan struct{}
+
+// runForceMerge runs forced merge f described by desc.
+//
+// It waits until the number of concurrently running forced merges drops below -forceMergeConcurrency.
+func runForceMerge(desc string, f func() error) {
+	pendingForceMerges.Inc()
+	forceMergeConcurrencyCh <- struct{}{}
+	pendingForceMerges.Dec()
+	activeForceMerges.Inc()
+	defer func() {
+		activeForceMerges.Dec()
+		<-forceMergeConcurrencyCh
+	}()
+	logger.Infof("forced merge for %s has been started", desc)
+	startTime := time.Now()
+	if err := f(); err != nil {
+		logger.Errorf("error in forced merge for %s: %s", desc, err)
+		return
+	}
+	logger.Infof("forced merge for %s has been successfully finished in %.3f seconds", desc, time.Since(startTime).Seconds())
+}
 
 func registerStorageMetrics(strg *storage.Storage) {
 	mCache := &storage.Metrics{}
@@ -456,6 +648,12 @@ func registerStorageMetrics(strg *storage.Storage) {
 	metrics.NewGauge(fmt.Sprintf(`vm_free_disk_space_limit_bytes{path=%q}`, *DataPath), func() float64 {
 		return float64(minFreeDiskSpaceBytes.N)
 	})
+	metrics.NewGauge(`vm_exemplars`, func() float64 {
+		return float64(exemplarStorage.Len())
+	})
+	metrics.NewGauge(`vm_metrics_metadata_entries`, func() float64 {
+		return float64(metadataStorage.Len())
+	})
 	metrics.NewGauge(fmt.Sprintf(`vm_storage_is_read_only{path=%q}`, *DataPath), func() float64 {
 		if strg.IsReadOnly() {
 			return 1
@@ -509,6 +707,19 @@ func registerStorageMetrics(strg *storage.Storage) {
 	metrics.NewGauge(`vm_references{type="storage", name="partitions"}`, func() float64 {
 		return float64(tm().PartitionsRefCount)
 	})
+	metrics.NewGauge(`vm_tiered_storage_cold_partitions`, func() float64 {
+		return float64(tm().ColdPartitions)
+	})
+	metrics.NewGauge(`vm_tiered_storage_cached_partitions`, func() float64 {
+		return float64(tm().CachedColdPartitions)
+	})
+	metrics.NewGauge(`vm_tiered_storage_downloads_total`, func() float64 {
+		return float64(tm().ColdPartitionDownloads)
+	})
+	metrics.NewGauge(`vm_tiered_storage_download_errors_total`, func() float64 {
+		return float64(tm().ColdPartitionDownloadErrors)
+	})
+
 	metrics.NewGauge(`vm_references{type="indexdb", name="objects"}`, func() float64 {
 		return float64(idbm().IndexDBRefCount)
 	})
@@ -701,6 +912,9 @@ func registerStorageMetrics(strg *storage.Storage) {
 	metrics.NewGauge(`vm_date_metric_id_cache_resets_total`, func() float64 {
 		return float64(m().DateMetricIDCacheResetsCount)
 	})
+	metrics.NewGauge(`vm_last_value_cache_evictions_total`, func() float64 {
+		return float64(m().LastValueCacheEvictions)
+	})
 
 	metrics.NewGauge(`vm_cache_entries{type="storage/tsid"}`, func() float64 {
 		return float64(m().TSIDCacheSize)
@@ -714,6 +928,9 @@ func registerStorageMetrics(strg *storage.Storage) {
 	metrics.NewGauge(`vm_cache_entries{type="storage/date_metricID"}`, func() float64 {
 		return float64(m().DateMetricIDCacheSize)
 	})
+	metrics.NewGauge(`vm_cache_entries{type="storage/last_value"}`, func() float64 {
+		return float64(m().LastValueCacheSize)
+	})
 	metrics.NewGauge(`vm_cache_entries{type="storage/hour_metric_ids"}`, func() float64 {
 		return float64(m().HourMetricIDCacheSize)
 	})
@@ -820,6 +1037,9 @@ func registerStorageMetrics(strg *storage.Storage) {
 	metrics.NewGauge(`vm_cache_requests_total{type="storage/metricName"}`, func() float64 {
 		return float64(m().MetricNameCacheRequests)
 	})
+	metrics.NewGauge(`vm_cache_requests_total{type="storage/last_value"}`, func() float64 {
+		return float64(m().LastValueCacheRequests)
+	})
 	metrics.NewGauge(`vm_cache_requests_total{type="storage/indexBlocks"}`, func() float64 {
 		return float64(tm().IndexBlocksCacheRequests)
 	})
@@ -848,6 +1068,9 @@ func registerStorageMetrics(strg *storage.Storage) {
 	metrics.NewGauge(`vm_cache_misses_total{type="storage/metricName"}`, func() float64 {
 		return float64(m().MetricNameCacheMisses)
 	})
+	metrics.NewGauge(`vm_cache_misses_total{type="storage/last_value"}`, func() float64 {
+		return float64(m().LastValueCacheMisses)
+	})
 	metrics.NewGauge(`vm_cache_misses_total{type="storage/indexBlocks"}`, func() float64 {
 		return float64(tm().IndexBlocksCacheMisses)
 	})
@@ -884,3 +1107,47 @@ func jsonResponseError(w http.ResponseWriter, err error) {
 	w.WriteHeader(http.StatusInternalServerError)
 	fmt.Fprintf(w, `{"status":"error","msg":%q}`, err)
 }
+
+// writeNewSeriesAudit writes entries from sal to w as JSON lines.
+//
+// Only entries with sequence numbers starting from `since` query arg are written.
+// If `follow=1` query arg is set, then new entries are streamed to w until the client closes the connection.
+func writeNewSeriesAudit(w http.ResponseWriter, r *http.Request, sal *storage.SeriesAuditLog) error {
+	var since uint64
+	if s := r.FormValue("since"); s != "" {
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("cannot parse `since` arg %q: %w", s, err)
+		}
+		since = n
+	}
+	follow := httputils.GetBool(r, "follow")
+	w.Header().Set("Content-Type", "application/stream+json")
+	var entries []storage.SeriesAuditEntry
+	for {
+		var notifyCh <-chan struct{}
+		entries, since, notifyCh = sal.GetEntries(entries[:0], since)
+		for i := range entries {
+			data, err := json.Marshal(&entries[i])
+			if err != nil {
+				return fmt.Errorf("cannot marshal new series audit entry: %w", err)
+			}
+			data = append(data, '\n')
+			if _, err := w.Write(data); err != nil {
+				// The client closed the connection.
+				return nil
+			}
+		}
+		if !follow {
+			return nil
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		select {
+		case <-notifyCh:
+		case <-r.Context().Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package vmstorage
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/actions"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fslocal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+var (
+	tieredStorageURL = flag.String("tieredStorage.url", "", "Optional URL of the backup made by vmbackup, which contains cold partitions missing in the local storage. "+
+		"For example, s3://bucket/path/to/backup, gs://bucket/path/to/backup or fs:///path/to/backup . Cold partitions are downloaded "+
+		"to -tieredStorage.cachePath on the first query, which needs them. See https://docs.victoriametrics.com/#tiered-storage")
+	tieredStorageCachePath = flag.String("tieredStorage.cachePath", "", "Path to local cache for cold partitions downloaded from -tieredStorage.url . "+
+		"By default the tiered-storage-cache directory inside -storageDataPath is used. The contents of the directory is removed on startup")
+	tieredStorageMaxCachedPartitions = flag.Int("tieredStorage.maxCachedPartitions", 2, "The maximum number of cold partitions to keep at -tieredStorage.cachePath . "+
+		"Least recently queried partitions are removed from the cache when the limit is exceeded")
+)
+
+// tieredStorageFS is the object storage with cold partitions. It is nil if -tieredStorage.url isn't set.
+var tieredStorageFS common.RemoteFS
+
+func mustInitTieredStorage(strg *storage.Storage) {
+	if *tieredStorageURL == "" {
+		return
+	}
+	rfs, err := actions.NewRemoteFS(*tieredStorageURL)
+	if err != nil {
+		logger.Fatalf("cannot parse -tieredStorage.url=%q: %s", *tieredStorageURL, err)
+	}
+	cachePath := *tieredStorageCachePath
+	if cachePath == "" {
+		cachePath = *DataPath + "/tiered-storage-cache"
+	}
+	ros := &remoteObjectStorage{
+		fs: rfs,
+	}
+	if err := strg.EnableTieredStorage(ros, cachePath, *tieredStorageMaxCachedPartitions); err != nil {
+		logger.Fatalf("cannot enable tiered storage for -tieredStorage.url=%q: %s", *tieredStorageURL, err)
+	}
+	tieredStorageFS = rfs
+}
+
+func mustStopTieredStorage() {
+	if tieredStorageFS == nil {
+		return
+	}
+	tieredStorageFS.MustStop()
+	tieredStorageFS = nil
+}
+
+// remoteObjectStorage implements storage.ObjectStorage on top of the backup made by vmbackup.
+type remoteObjectStorage struct {
+	fs common.RemoteFS
+
+	// parts contains backup parts per each partition name.
+	//
+	// It is initialized in ListPartitions, since the list of cold partitions is obtained only once on startup.
+	parts map[string][]common.Part
+}
+
+func (ros *remoteObjectStorage) ListPartitions() ([]string, error) {
+	parts, err := ros.fs.ListParts()
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string][]common.Part)
+	for _, p := range parts {
+		name, _ := getPartitionNameFromBackupPath(p.Path)
+		if name == "" {
+			continue
+		}
+		m[name] = append(m[name], p)
+	}
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ros.parts = m
+	return names, nil
+}
+
+func (ros *remoteObjectStorage) DownloadPartition(name, smallPartsPath, bigPartsPath string) error {
+	for _, dir := range []string{smallPartsPath, bigPartsPath} {
+		if err := fs.MkdirAllIfNotExist(dir); err != nil {
+			return err
+		}
+	}
+	parts := append([]common.Part{}, ros.parts[name]...)
+	// Sort parts in order to properly grow file size during downloading.
+	common.SortParts(parts)
+	for _, p := range parts {
+		_, partsType := getPartitionNameFromBackupPath(p.Path)
+		dst := &fslocal.FS{
+			Dir: smallPartsPath,
+		}
+		if partsType == "big" {
+			dst.Dir = bigPartsPath
+		}
+		dstPart := p
+		dstPart.Path = strings.TrimPrefix(p.Path, "data/"+partsType+"/"+name+"/")
+		wc, err := dst.NewWriteCloser(dstPart)
+		if err != nil {
+			return fmt.Errorf("cannot create writer for %s to %s: %w", &dstPart, dst, err)
+		}
+		if err := ros.fs.DownloadPart(p, wc); err != nil {
+			_ = wc.Close()
+			return fmt.Errorf("cannot download %s from %s: %w", &p, ros.fs, err)
+		}
+		if err := wc.Close(); err != nil {
+			return fmt.Errorf("cannot close writer for %s to %s: %w", &dstPart, dst, err)
+		}
+	}
+	return nil
+}
+
+func (ros *remoteObjectStorage) String() string {
+	return ros.fs.String()
+}
+
+// getPartitionNameFromBackupPath returns partition name and parts type (small or big) for the given path in the backup.
+//
+// Empty partition name is returned if the path doesn't belong to partition data.
+func getPartitionNameFromBackupPath(path string) (string, string) {
+	for _, partsType := range []string{"small", "big"} {
+		prefix := "data/" + partsType + "/"
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		tail := path[len(prefix):]
+		n := strings.IndexByte(tail, '/')
+		if n <= 0 || tail[:n] == "snapshots" {
+			return "", ""
+		}
+		return tail[:n], partsType
+	}
+	return "", ""
+}
@@ -1,6 +1,7 @@
 package awsapi
 
 import (
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
@@ -96,7 +97,9 @@ func NewConfig(region, roleARN, accessKey, secretKey, service string) (*Config,
 // This string can be obtained by calling GetFiltersQueryString().
 // See https://docs.aws.amazon.com/AWSEC2/latest/APIReference/API_DescribeInstances.html for examples.
 // See also https://docs.aws.amazon.com/AWSEC2/latest/APIReference/API_Filter.html
-func (cfg *Config) GetEC2APIResponse(action, filtersQueryString, nextPageToken string) ([]byte, error) {
+//
+// The request is canceled when ctx is canceled.
+func (cfg *Config) GetEC2APIResponse(ctx context.Context, action, filtersQueryString, nextPageToken string) ([]byte, error) {
 	ac, err := cfg.getFreshAPICredentials()
 	if err != nil {
 		return nil, err
@@ -113,7 +116,7 @@ func (cfg *Config) GetEC2APIResponse(action, filtersQueryString, nextPageToken s
 	if err != nil {
 		return nil, fmt.Errorf("cannot create signed request: %w", err)
 	}
-	resp, err := cfg.client.Do(req)
+	resp, err := cfg.client.Do(req.WithContext(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("cannot perform http request to %q: %w", apiURL, err)
 	}
@@ -66,7 +66,14 @@ func CheckPrecisionBits(precisionBits uint8) error {
 // precisionBits must be in the range [1...64], where 1 means 50% precision,
 // while 64 means 100% precision, i.e. lossless encoding.
 func MarshalTimestamps(dst []byte, timestamps []int64, precisionBits uint8) (result []byte, mt MarshalType, firstTimestamp int64) {
-	return marshalInt64Array(dst, timestamps, precisionBits)
+	return marshalInt64Array(dst, timestamps, precisionBits, 0)
+}
+
+// MarshalTimestampsWithCompressLevel works like MarshalTimestamps, but uses the given compressLevel for the compression.
+//
+// The compression level is selected automatically depending on the number of timestamps if compressLevel <= 0.
+func MarshalTimestampsWithCompressLevel(dst []byte, timestamps []int64, precisionBits uint8, compressLevel int) (result []byte, mt MarshalType, firstTimestamp int64) {
+	return marshalInt64Array(dst, timestamps, precisionBits, compressLevel)
 }
 
 // UnmarshalTimestamps unmarshals timestamps from src, appends them to dst
@@ -87,7 +94,14 @@ func UnmarshalTimestamps(dst []int64, src []byte, mt MarshalType, firstTimestamp
 // precisionBits must be in the range [1...64], where 1 means 50% precision,
 // while 64 means 100% precision, i.e. lossless encoding.
 func MarshalValues(dst []byte, values []int64, precisionBits uint8) (result []byte, mt MarshalType, firstValue int64) {
-	return marshalInt64Array(dst, values, precisionBits)
+	return marshalInt64Array(dst, values, precisionBits, 0)
+}
+
+// MarshalValuesWithCompressLevel works like MarshalValues, but uses the given compressLevel for the compression.
+//
+// The compression level is selected automatically depending on the number of values if compressLevel <= 0.
+func MarshalValuesWithCompressLevel(dst []byte, values []int64, precisionBits uint8, compressLevel int) (result []byte, mt MarshalType, firstValue int64) {
+	return marshalInt64Array(dst, values, precisionBits, compressLevel)
 }
 
 // UnmarshalValues unmarshals values from src, appends them to dst and returns
@@ -102,7 +116,7 @@ func UnmarshalValues(dst []int64, src []byte, mt MarshalType, firstValue int64,
 	return dst, nil
 }
 
-func marshalInt64Array(dst []byte, a []int64, precisionBits uint8) (result []byte, mt MarshalType, firstValue int64) {
+func marshalInt64Array(dst []byte, a []int64, precisionBits uint8, compressLevel int) (result []byte, mt MarshalType, firstValue int64) {
 	if len(a) == 0 {
 		logger.Panicf("BUG: a must contain at least one item")
 	}
@@ -136,7 +150,9 @@ func marshalInt64Array(dst []byte, a []int64, precisionBits uint8) (result []byt
 	// Try compressing the result.
 	dstOrig := dst
 	if len(bb.B) >= minCompressibleBlockSize {
-		compressLevel := getCompressLevel(len(a))
+		if compressLevel <= 0 {
+			compressLevel = getCompressLevel(len(a))
+		}
 		dst = CompressZSTDLevel(dst, bb.B, compressLevel)
 	}
 	if len(bb.B) < minCompressibleBlockSize || float64(len(dst)-len(dstOrig)) > 0.9*float64(len(bb.B)) {
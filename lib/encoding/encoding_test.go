@@ -92,7 +92,7 @@ func testEnsureNonDecreasingSequence(t *testing.T, a []int64, vMin, vMax int64,
 func testMarshalUnmarshalInt64Array(t *testing.T, va []int64, precisionBits uint8, mtExpected MarshalType) {
 	t.Helper()
 
-	b, mt, firstValue := marshalInt64Array(nil, va, precisionBits)
+	b, mt, firstValue := marshalInt64Array(nil, va, precisionBits, 0)
 	if mt != mtExpected {
 		t.Fatalf("unexpected MarshalType for va=%d, precisionBits=%d: got %d; expecting %d", va, precisionBits, mt, mtExpected)
 	}
@@ -116,7 +116,7 @@ func testMarshalUnmarshalInt64Array(t *testing.T, va []int64, precisionBits uint
 	}
 
 	bPrefix := []byte{1, 2, 3}
-	bNew, mtNew, firstValueNew := marshalInt64Array(bPrefix, va, precisionBits)
+	bNew, mtNew, firstValueNew := marshalInt64Array(bPrefix, va, precisionBits, 0)
 	if firstValueNew != firstValue {
 		t.Fatalf("unexpected firstValue for prefixed va=%d, precisionBits=%d; got %d; want %d", va, precisionBits, firstValueNew, firstValue)
 	}
@@ -206,10 +206,44 @@ func TestMarshalUnmarshalInt64ArrayGeneric(t *testing.T) {
 	testMarshalUnmarshalInt64Array(t, []int64{100, 100, 100, 100}, 4, MarshalTypeConst)
 }
 
+func TestMarshalInt64ArrayCompressLevel(t *testing.T) {
+	// Generate gauge values with daily-like seasonality and a bit of noise, which are typical for real-world metrics.
+	var va []int64
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 8*1024; i++ {
+		v := int64((i%288)*(288-i%288)) + int64(r.Intn(16))
+		va = append(va, v)
+	}
+	marshal := func(compressLevel int) []byte {
+		t.Helper()
+		b, mt, firstValue := marshalInt64Array(nil, va, 64, compressLevel)
+		if mt != MarshalTypeZSTDNearestDelta {
+			t.Fatalf("unexpected marshal type for compressLevel=%d; got %d; want %d", compressLevel, mt, MarshalTypeZSTDNearestDelta)
+		}
+		vaNew, err := unmarshalInt64Array(nil, b, mt, firstValue, len(va))
+		if err != nil {
+			t.Fatalf("cannot unmarshal data marshaled with compressLevel=%d: %s", compressLevel, err)
+		}
+		if !reflect.DeepEqual(vaNew, va) {
+			t.Fatalf("unexpected items unmarshaled from data with compressLevel=%d", compressLevel)
+		}
+		return b
+	}
+	bDefault := marshal(0)
+	bLow := marshal(1)
+	bHigh := marshal(19)
+	if len(bHigh) >= len(bLow) {
+		t.Fatalf("expecting smaller size for compressLevel=19 than for compressLevel=1; got %d vs %d bytes", len(bHigh), len(bLow))
+	}
+	if len(bHigh) >= len(bDefault) {
+		t.Fatalf("expecting smaller size for compressLevel=19 than for the default compressLevel; got %d vs %d bytes", len(bHigh), len(bDefault))
+	}
+}
+
 func testMarshalInt64ArraySize(t *testing.T, va []int64, precisionBits uint8, minSizeExpected, maxSizeExpected int) {
 	t.Helper()
 
-	b, _, _ := marshalInt64Array(nil, va, precisionBits)
+	b, _, _ := marshalInt64Array(nil, va, precisionBits, 0)
 	if len(b) > maxSizeExpected {
 		t.Fatalf("too big size for marshaled %d items with precisionBits %d: got %d; expecting %d", len(va), precisionBits, len(b), maxSizeExpected)
 	}
@@ -14,7 +14,7 @@ func BenchmarkMarshalGaugeArray(b *testing.B) {
 		var dst []byte
 		var mt MarshalType
 		for pb.Next() {
-			dst, mt, _ = marshalInt64Array(dst[:0], benchGaugeArray, 4)
+			dst, mt, _ = marshalInt64Array(dst[:0], benchGaugeArray, 4, 0)
 			if mt != MarshalTypeZSTDNearestDelta {
 				panic(fmt.Errorf("unexpected marshal type; got %d; expecting %d", mt, MarshalTypeZSTDNearestDelta))
 			}
@@ -52,7 +52,7 @@ var benchGaugeArray = func() []int64 {
 }()
 
 var benchMarshaledGaugeArray = func() []byte {
-	b, _, _ := marshalInt64Array(nil, benchGaugeArray, 4)
+	b, _, _ := marshalInt64Array(nil, benchGaugeArray, 4, 0)
 	return b
 }()
 
@@ -63,7 +63,7 @@ func BenchmarkMarshalDeltaConstArray(b *testing.B) {
 		var dst []byte
 		var mt MarshalType
 		for pb.Next() {
-			dst, mt, _ = marshalInt64Array(dst[:0], benchDeltaConstArray, 4)
+			dst, mt, _ = marshalInt64Array(dst[:0], benchDeltaConstArray, 4, 0)
 			if mt != MarshalTypeDeltaConst {
 				panic(fmt.Errorf("unexpected marshal type; got %d; expecting %d", mt, MarshalTypeDeltaConst))
 			}
@@ -99,7 +99,7 @@ var benchDeltaConstArray = func() []int64 {
 }()
 
 var benchMarshaledDeltaConstArray = func() []byte {
-	b, _, _ := marshalInt64Array(nil, benchDeltaConstArray, 4)
+	b, _, _ := marshalInt64Array(nil, benchDeltaConstArray, 4, 0)
 	return b
 }()
 
@@ -110,7 +110,7 @@ func BenchmarkMarshalConstArray(b *testing.B) {
 		var dst []byte
 		var mt MarshalType
 		for pb.Next() {
-			dst, mt, _ = marshalInt64Array(dst[:0], benchConstArray, 4)
+			dst, mt, _ = marshalInt64Array(dst[:0], benchConstArray, 4, 0)
 			if mt != MarshalTypeConst {
 				panic(fmt.Errorf("unexpected marshal type; got %d; expecting %d", mt, MarshalTypeConst))
 			}
@@ -144,7 +144,7 @@ var benchConstArray = func() []int64 {
 }()
 
 var benchMarshaledConstArray = func() []byte {
-	b, _, _ := marshalInt64Array(nil, benchConstArray, 4)
+	b, _, _ := marshalInt64Array(nil, benchConstArray, 4, 0)
 	return b
 }()
 
@@ -155,7 +155,7 @@ func BenchmarkMarshalZeroConstArray(b *testing.B) {
 		var dst []byte
 		var mt MarshalType
 		for pb.Next() {
-			dst, mt, _ = marshalInt64Array(dst[:0], benchZeroConstArray, 4)
+			dst, mt, _ = marshalInt64Array(dst[:0], benchZeroConstArray, 4, 0)
 			if mt != MarshalTypeConst {
 				panic(fmt.Errorf("unexpected marshal type; got %d; expecting %d", mt, MarshalTypeConst))
 			}
@@ -183,7 +183,7 @@ func BenchmarkUnmarshalZeroConstArray(b *testing.B) {
 var benchZeroConstArray = make([]int64, 8*1024)
 
 var benchMarshaledZeroConstArray = func() []byte {
-	b, _, _ := marshalInt64Array(nil, benchZeroConstArray, 4)
+	b, _, _ := marshalInt64Array(nil, benchZeroConstArray, 4, 0)
 	return b
 }()
 
@@ -194,7 +194,7 @@ func BenchmarkMarshalInt64Array(b *testing.B) {
 		var dst []byte
 		var mt MarshalType
 		for pb.Next() {
-			dst, mt, _ = marshalInt64Array(dst[:0], benchInt64Array, 4)
+			dst, mt, _ = marshalInt64Array(dst[:0], benchInt64Array, 4, 0)
 			if mt != benchMarshalType {
 				panic(fmt.Errorf("unexpected marshal type; got %d; expecting %d", mt, benchMarshalType))
 			}
@@ -203,6 +203,30 @@ func BenchmarkMarshalInt64Array(b *testing.B) {
 	})
 }
 
+func BenchmarkMarshalInt64ArrayCompressLevel(b *testing.B) {
+	for _, compressLevel := range []int{1, 5, 10, 19} {
+		b.Run(fmt.Sprintf("level_%d", compressLevel), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(benchSeasonalInt64Array)))
+			var dst []byte
+			for i := 0; i < b.N; i++ {
+				dst, _, _ = marshalInt64Array(dst[:0], benchSeasonalInt64Array, 64, compressLevel)
+			}
+			b.ReportMetric(float64(len(dst)), "compressed-bytes")
+		})
+	}
+}
+
+var benchSeasonalInt64Array = func() []int64 {
+	var a []int64
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 8*1024; i++ {
+		v := int64((i%288)*(288-i%288)) + int64(r.Intn(16))
+		a = append(a, v)
+	}
+	return a
+}()
+
 func BenchmarkUnmarshalInt64Array(b *testing.B) {
 	b.ReportAllocs()
 	b.SetBytes(int64(len(benchInt64Array)))
@@ -220,12 +244,12 @@ func BenchmarkUnmarshalInt64Array(b *testing.B) {
 }
 
 var benchMarshaledInt64Array = func() []byte {
-	b, _, _ := marshalInt64Array(nil, benchInt64Array, 4)
+	b, _, _ := marshalInt64Array(nil, benchInt64Array, 4, 0)
 	return b
 }()
 
 var benchMarshalType = func() MarshalType {
-	_, mt, _ := marshalInt64Array(nil, benchInt64Array, 4)
+	_, mt, _ := marshalInt64Array(nil, benchInt64Array, 4, 0)
 	return mt
 }()
 
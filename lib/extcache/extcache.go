@@ -0,0 +1,196 @@
+package extcache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/netutil"
+)
+
+// Client is a client for external cache, which may be shared among multiple processes.
+//
+// Call NewClient for creating new Client.
+type Client interface {
+	// Get appends the value for the given key to dst and returns the result.
+	//
+	// false is returned if the key is missing in the cache.
+	Get(dst []byte, key string) ([]byte, bool, error)
+
+	// Set stores the value under the given key in the cache for the given ttl.
+	Set(key string, value []byte, ttl time.Duration) error
+
+	// MustClose closes the client.
+	MustClose()
+
+	// String returns human-readable representation for the client.
+	String() string
+}
+
+// NewClient returns new client for the external cache at the given addr.
+//
+// The following addr formats are supported:
+//
+//   - redis://host:port
+//   - memcached://host:port
+//
+// timeout is used for establishing connections and for every request to the cache.
+// Values bigger than maxEntrySize bytes are rejected by Get and Set.
+func NewClient(addr string, timeout time.Duration, maxEntrySize int) (Client, error) {
+	n := strings.Index(addr, "://")
+	if n < 0 {
+		return nil, fmt.Errorf("missing scheme in %q; supported schemes: redis://, memcached://", addr)
+	}
+	scheme := addr[:n]
+	hostPort := addr[n+len("://"):]
+	if _, _, err := net.SplitHostPort(hostPort); err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	cp := newConnPool(hostPort, timeout)
+	switch scheme {
+	case "redis":
+		return &redisClient{
+			cp:           cp,
+			maxEntrySize: maxEntrySize,
+		}, nil
+	case "memcached":
+		return &memcachedClient{
+			cp:           cp,
+			maxEntrySize: maxEntrySize,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q in %q; supported schemes: redis://, memcached://", scheme, addr)
+	}
+}
+
+// maxIdleConns is the maximum number of idle connections to the external cache.
+const maxIdleConns = 16
+
+// connPool is a pool of connections to the external cache.
+type connPool struct {
+	addr    string
+	timeout time.Duration
+
+	mu    sync.Mutex
+	conns []*conn
+}
+
+type conn struct {
+	c  net.Conn
+	br *bufio.Reader
+	bw *bufio.Writer
+}
+
+func newConnPool(addr string, timeout time.Duration) *connPool {
+	return &connPool{
+		addr:    addr,
+		timeout: timeout,
+	}
+}
+
+// do calls f with the connection from cp.
+//
+// The connection is closed if f returns an error, since its state becomes unknown.
+func (cp *connPool) do(f func(c *conn) error) error {
+	c, err := cp.getConn()
+	if err != nil {
+		return err
+	}
+	if err := c.c.SetDeadline(time.Now().Add(cp.timeout)); err != nil {
+		_ = c.c.Close()
+		return fmt.Errorf("cannot set deadline for connection to %q: %w", cp.addr, err)
+	}
+	if err := f(c); err != nil {
+		_ = c.c.Close()
+		return err
+	}
+	cp.putConn(c)
+	return nil
+}
+
+func (cp *connPool) getConn() (*conn, error) {
+	cp.mu.Lock()
+	if n := len(cp.conns); n > 0 {
+		c := cp.conns[n-1]
+		cp.conns[n-1] = nil
+		cp.conns = cp.conns[:n-1]
+		cp.mu.Unlock()
+		return c, nil
+	}
+	cp.mu.Unlock()
+
+	nc, err := net.DialTimeout(netutil.GetTCPNetwork(), cp.addr, cp.timeout)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to %q: %w", cp.addr, err)
+	}
+	return &conn{
+		c:  nc,
+		br: bufio.NewReader(nc),
+		bw: bufio.NewWriter(nc),
+	}, nil
+}
+
+func (cp *connPool) putConn(c *conn) {
+	cp.mu.Lock()
+	if len(cp.conns) >= maxIdleConns {
+		cp.mu.Unlock()
+		_ = c.c.Close()
+		return
+	}
+	cp.conns = append(cp.conns, c)
+	cp.mu.Unlock()
+}
+
+func (cp *connPool) mustClose() {
+	cp.mu.Lock()
+	for _, c := range cp.conns {
+		_ = c.c.Close()
+	}
+	cp.conns = nil
+	cp.mu.Unlock()
+}
+
+// readLine reads a line terminated by "\r\n" from br.
+func readLine(br *bufio.Reader) (string, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasSuffix(line, "\r\n") {
+		return "", fmt.Errorf("missing \\r\\n at the end of line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
+
+// readValue reads the value with the given size terminated by "\r\n" from br and appends it to dst.
+//
+// An error is returned without reading the value if size exceeds maxSize.
+func readValue(dst []byte, br *bufio.Reader, size, maxSize int) ([]byte, error) {
+	if size > maxSize {
+		return dst, fmt.Errorf("too big value size: %d bytes; the maximum allowed size is %d bytes", size, maxSize)
+	}
+	dstLen := len(dst)
+	if n := dstLen + size + 2 - cap(dst); n > 0 {
+		dst = append(dst[:cap(dst)], make([]byte, n)...)
+	}
+	dst = dst[:dstLen+size+2]
+	if _, err := io.ReadFull(br, dst[dstLen:]); err != nil {
+		return dst[:dstLen], fmt.Errorf("cannot read value with size %d bytes: %w", size, err)
+	}
+	if string(dst[len(dst)-2:]) != "\r\n" {
+		return dst[:dstLen], fmt.Errorf("missing \\r\\n after the value with size %d bytes", size)
+	}
+	return dst[:len(dst)-2], nil
+}
+
+// checkValueSize returns an error if value size exceeds maxSize.
+func checkValueSize(value []byte, maxSize int) error {
+	if len(value) > maxSize {
+		return fmt.Errorf("too big value size: %d bytes; the maximum allowed size is %d bytes", len(value), maxSize)
+	}
+	return nil
+}
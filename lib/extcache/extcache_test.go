@@ -0,0 +1,368 @@
+package extcache
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testMaxEntrySize is the maximum entry size for clients in tests.
+const testMaxEntrySize = 2 * 1024 * 1024
+
+func TestNewClientFailure(t *testing.T) {
+	f := func(addr string) {
+		t.Helper()
+		c, err := NewClient(addr, time.Second, testMaxEntrySize)
+		if err == nil {
+			c.MustClose()
+			t.Fatalf("expecting non-nil error for addr=%q", addr)
+		}
+	}
+	f("")
+	f("localhost:6379")
+	f("http://localhost:6379")
+	f("redis://localhost")
+	f("memcached://")
+}
+
+func TestClientGetSet(t *testing.T) {
+	f := func(scheme string, handleConn func(fs *fakeServer, br *bufio.Reader, bw *bufio.Writer) error) {
+		t.Helper()
+		fs := newFakeServer(t, handleConn)
+		defer fs.close()
+		c, err := NewClient(scheme+"://"+fs.ln.Addr().String(), time.Second, testMaxEntrySize)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		defer c.MustClose()
+
+		// Missing key
+		data, ok, err := c.Get([]byte("prefix"), "missing")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if ok || string(data) != "prefix" {
+			t.Fatalf("unexpected result for missing key; got ok=%v, data=%q", ok, data)
+		}
+
+		// Binary values, including values with "\r\n" inside.
+		values := map[string][]byte{
+			"empty":  {},
+			"crlf":   []byte("foo\r\nEND\r\nbar"),
+			"binary": {0, 1, 2, 255, '\r', '\n', 0},
+			"big":    bytes.Repeat([]byte("x"), 1024*1024),
+		}
+		for key, value := range values {
+			if err := c.Set(key, value, time.Hour); err != nil {
+				t.Fatalf("unexpected error when setting %q: %s", key, err)
+			}
+		}
+		for key, value := range values {
+			data, ok, err := c.Get([]byte("prefix"), key)
+			if err != nil {
+				t.Fatalf("unexpected error when getting %q: %s", key, err)
+			}
+			if !ok {
+				t.Fatalf("missing value for %q", key)
+			}
+			if !bytes.Equal(data, append([]byte("prefix"), value...)) {
+				t.Fatalf("unexpected value for %q; got %d bytes; want %d bytes", key, len(data)-len("prefix"), len(value))
+			}
+		}
+		if ttl := fs.getTTL("crlf"); ttl != "3600" && ttl != "3600000" {
+			t.Fatalf("unexpected ttl passed to the server: %q", ttl)
+		}
+
+		// Concurrent access
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				key := fmt.Sprintf("key_%d", i)
+				value := []byte(fmt.Sprintf("value_%d", i))
+				if err := c.Set(key, value, time.Minute); err != nil {
+					t.Errorf("unexpected error: %s", err)
+					return
+				}
+				data, ok, err := c.Get(nil, key)
+				if err != nil || !ok || !bytes.Equal(data, value) {
+					t.Errorf("unexpected result for %q; got ok=%v, data=%q, err=%v", key, ok, data, err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		// Server errors
+		fs.setError("server failure")
+		if _, _, err := c.Get(nil, "crlf"); err == nil || !strings.Contains(err.Error(), "server failure") {
+			t.Fatalf("expecting error containing %q; got %v", "server failure", err)
+		}
+		if err := c.Set("foo", []byte("bar"), time.Minute); err == nil || !strings.Contains(err.Error(), "server failure") {
+			t.Fatalf("expecting error containing %q; got %v", "server failure", err)
+		}
+
+		// The client must recover after errors.
+		fs.setError("")
+		if _, ok, err := c.Get(nil, "crlf"); err != nil || !ok {
+			t.Fatalf("unexpected result after recovery; ok=%v, err=%v", ok, err)
+		}
+	}
+	f("memcached", handleMemcachedConn)
+	f("redis", handleRedisConn)
+}
+
+func TestClientTooBigValue(t *testing.T) {
+	f := func(scheme, response string) {
+		t.Helper()
+		// The server announces too big value without sending it.
+		fs := newFakeServer(t, func(fs *fakeServer, br *bufio.Reader, bw *bufio.Writer) error {
+			if _, err := br.ReadString('\n'); err != nil {
+				return err
+			}
+			fmt.Fprintf(bw, "%s", response)
+			return nil
+		})
+		defer fs.close()
+		c, err := NewClient(scheme+"://"+fs.ln.Addr().String(), time.Second, testMaxEntrySize)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		defer c.MustClose()
+
+		if _, _, err := c.Get(nil, "foo"); err == nil || !strings.Contains(err.Error(), "too big value size") {
+			t.Fatalf("expecting error on too big value; got %v", err)
+		}
+		if err := c.Set("foo", make([]byte, testMaxEntrySize+1), time.Minute); err == nil || !strings.Contains(err.Error(), "too big value size") {
+			t.Fatalf("expecting error on too big value; got %v", err)
+		}
+	}
+	f("memcached", "VALUE foo 0 1099511627776\r\n")
+	f("redis", "$1099511627776\r\n")
+}
+
+func TestClientUnavailable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %s", err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	for _, scheme := range []string{"redis", "memcached"} {
+		c, err := NewClient(scheme+"://"+addr, time.Second, testMaxEntrySize)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if _, _, err := c.Get(nil, "foo"); err == nil {
+			t.Fatalf("expecting non-nil error for unavailable %s", scheme)
+		}
+		if err := c.Set("foo", []byte("bar"), time.Minute); err == nil {
+			t.Fatalf("expecting non-nil error for unavailable %s", scheme)
+		}
+		c.MustClose()
+	}
+}
+
+func TestCheckMemcachedKey(t *testing.T) {
+	f := func(key string, okExpected bool) {
+		t.Helper()
+		err := checkMemcachedKey(key)
+		if ok := err == nil; ok != okExpected {
+			t.Fatalf("unexpected result for key %q; got %v; want %v", key, err, okExpected)
+		}
+	}
+	f("", false)
+	f("foo bar", false)
+	f("foo\r\n", false)
+	f(strings.Repeat("a", 251), false)
+	f("foo", true)
+	f("vm:rollupResult:0123456789abcdef", true)
+	f(strings.Repeat("a", 250), true)
+}
+
+// fakeServer is a fake in-memory cache server for tests.
+type fakeServer struct {
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu     sync.Mutex
+	values map[string][]byte
+	ttls   map[string]string
+	errMsg string
+}
+
+func newFakeServer(t *testing.T, handleConn func(fs *fakeServer, br *bufio.Reader, bw *bufio.Writer) error) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %s", err)
+	}
+	fs := &fakeServer{
+		ln:     ln,
+		values: make(map[string][]byte),
+		ttls:   make(map[string]string),
+	}
+	fs.wg.Add(1)
+	go func() {
+		defer fs.wg.Done()
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			fs.wg.Add(1)
+			go func() {
+				defer fs.wg.Done()
+				defer c.Close()
+				br := bufio.NewReader(c)
+				bw := bufio.NewWriter(c)
+				for {
+					if err := handleConn(fs, br, bw); err != nil {
+						return
+					}
+					if err := bw.Flush(); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return fs
+}
+
+func (fs *fakeServer) close() {
+	_ = fs.ln.Close()
+	fs.wg.Wait()
+}
+
+func (fs *fakeServer) get(key string) ([]byte, bool, string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	v, ok := fs.values[key]
+	return v, ok, fs.errMsg
+}
+
+func (fs *fakeServer) set(key string, value []byte, ttl string) string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.errMsg != "" {
+		return fs.errMsg
+	}
+	fs.values[key] = value
+	fs.ttls[key] = ttl
+	return ""
+}
+
+func (fs *fakeServer) getTTL(key string) string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.ttls[key]
+}
+
+func (fs *fakeServer) setError(errMsg string) {
+	fs.mu.Lock()
+	fs.errMsg = errMsg
+	fs.mu.Unlock()
+}
+
+func handleMemcachedConn(fs *fakeServer, br *bufio.Reader, bw *bufio.Writer) error {
+	line, err := readLine(br)
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(line)
+	switch {
+	case len(fields) == 2 && fields[0] == "get":
+		key := fields[1]
+		v, ok, errMsg := fs.get(key)
+		if errMsg != "" {
+			fmt.Fprintf(bw, "SERVER_ERROR %s\r\n", errMsg)
+			return nil
+		}
+		if ok {
+			fmt.Fprintf(bw, "VALUE %s 0 %d\r\n%s\r\n", key, len(v), v)
+		}
+		fmt.Fprintf(bw, "END\r\n")
+		return nil
+	case len(fields) == 5 && fields[0] == "set":
+		size, err := strconv.Atoi(fields[4])
+		if err != nil {
+			return err
+		}
+		v, err := readValue(nil, br, size, 1<<30)
+		if err != nil {
+			return err
+		}
+		if errMsg := fs.set(fields[1], v, fields[3]); errMsg != "" {
+			fmt.Fprintf(bw, "SERVER_ERROR %s\r\n", errMsg)
+			return nil
+		}
+		fmt.Fprintf(bw, "STORED\r\n")
+		return nil
+	default:
+		fmt.Fprintf(bw, "ERROR\r\n")
+		return nil
+	}
+}
+
+func handleRedisConn(fs *fakeServer, br *bufio.Reader, bw *bufio.Writer) error {
+	line, err := readLine(br)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return fmt.Errorf("unexpected command %q", line)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return err
+	}
+	var args [][]byte
+	for i := 0; i < n; i++ {
+		line, err := readLine(br)
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return fmt.Errorf("unexpected arg %q", line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return err
+		}
+		arg, err := readValue(nil, br, size, 1<<30)
+		if err != nil {
+			return err
+		}
+		args = append(args, arg)
+	}
+	switch {
+	case len(args) == 2 && string(args[0]) == "GET":
+		v, ok, errMsg := fs.get(string(args[1]))
+		if errMsg != "" {
+			fmt.Fprintf(bw, "-ERR %s\r\n", errMsg)
+			return nil
+		}
+		if !ok {
+			fmt.Fprintf(bw, "$-1\r\n")
+			return nil
+		}
+		fmt.Fprintf(bw, "$%d\r\n%s\r\n", len(v), v)
+		return nil
+	case len(args) == 5 && string(args[0]) == "SET" && string(args[3]) == "PX":
+		if errMsg := fs.set(string(args[1]), args[2], string(args[4])); errMsg != "" {
+			fmt.Fprintf(bw, "-ERR %s\r\n", errMsg)
+			return nil
+		}
+		fmt.Fprintf(bw, "+OK\r\n")
+		return nil
+	default:
+		fmt.Fprintf(bw, "-ERR unknown command\r\n")
+		return nil
+	}
+}
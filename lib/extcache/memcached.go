@@ -0,0 +1,132 @@
+package extcache
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// memcachedClient is a client for memcached.
+//
+// It uses text protocol described at https://github.com/memcached/memcached/blob/master/doc/protocol.txt
+type memcachedClient struct {
+	cp *connPool
+
+	maxEntrySize int
+}
+
+// maxMemcachedTTL is the maximum ttl, which may be passed as relative time to memcached.
+const maxMemcachedTTL = 30 * 24 * time.Hour
+
+// Get implements Client interface.
+func (mc *memcachedClient) Get(dst []byte, key string) ([]byte, bool, error) {
+	if err := checkMemcachedKey(key); err != nil {
+		return dst, false, err
+	}
+	found := false
+	err := mc.cp.do(func(c *conn) error {
+		if _, err := fmt.Fprintf(c.bw, "get %s\r\n", key); err != nil {
+			return err
+		}
+		if err := c.bw.Flush(); err != nil {
+			return err
+		}
+		line, err := readLine(c.br)
+		if err != nil {
+			return err
+		}
+		if line == "END" {
+			return nil
+		}
+		// VALUE <key> <flags> <bytes>
+		fields := strings.Fields(line)
+		if len(fields) != 4 || fields[0] != "VALUE" || fields[1] != key {
+			return fmt.Errorf("unexpected response from memcached: %q", line)
+		}
+		size, err := strconv.Atoi(fields[3])
+		if err != nil || size < 0 {
+			return fmt.Errorf("cannot parse value size in response from memcached: %q", line)
+		}
+		dst, err = readValue(dst, c.br, size, mc.maxEntrySize)
+		if err != nil {
+			return err
+		}
+		line, err = readLine(c.br)
+		if err != nil {
+			return err
+		}
+		if line != "END" {
+			return fmt.Errorf("unexpected response from memcached after the value: %q; want %q", line, "END")
+		}
+		found = true
+		return nil
+	})
+	if err != nil {
+		return dst, false, fmt.Errorf("cannot get %q from %s: %w", key, mc, err)
+	}
+	return dst, found, nil
+}
+
+// Set implements Client interface.
+func (mc *memcachedClient) Set(key string, value []byte, ttl time.Duration) error {
+	if err := checkMemcachedKey(key); err != nil {
+		return err
+	}
+	if err := checkValueSize(value, mc.maxEntrySize); err != nil {
+		return fmt.Errorf("cannot set %q at %s: %w", key, mc, err)
+	}
+	if ttl > maxMemcachedTTL {
+		ttl = maxMemcachedTTL
+	}
+	exptime := int64(ttl.Seconds())
+	err := mc.cp.do(func(c *conn) error {
+		if _, err := fmt.Fprintf(c.bw, "set %s 0 %d %d\r\n", key, exptime, len(value)); err != nil {
+			return err
+		}
+		if _, err := c.bw.Write(value); err != nil {
+			return err
+		}
+		if _, err := c.bw.WriteString("\r\n"); err != nil {
+			return err
+		}
+		if err := c.bw.Flush(); err != nil {
+			return err
+		}
+		line, err := readLine(c.br)
+		if err != nil {
+			return err
+		}
+		if line != "STORED" {
+			return fmt.Errorf("unexpected response from memcached: %q; want %q", line, "STORED")
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("cannot set %q at %s: %w", key, mc, err)
+	}
+	return nil
+}
+
+// MustClose implements Client interface.
+func (mc *memcachedClient) MustClose() {
+	mc.cp.mustClose()
+}
+
+// String implements Client interface.
+func (mc *memcachedClient) String() string {
+	return "memcached://" + mc.cp.addr
+}
+
+// checkMemcachedKey verifies whether the key may be used in memcached text protocol.
+func checkMemcachedKey(key string) error {
+	if len(key) == 0 || len(key) > 250 {
+		return fmt.Errorf("memcached key length must be in the range [1...250]; got %d", len(key))
+	}
+	for i := 0; i < len(key); i++ {
+		if c := key[i]; c <= ' ' || c == 0x7f {
+			return fmt.Errorf("memcached key cannot contain whitespace or control chars; got %q", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package extcache
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// redisClient is a client for Redis.
+//
+// It uses RESP protocol described at https://redis.io/docs/reference/protocol-spec/
+type redisClient struct {
+	cp *connPool
+
+	maxEntrySize int
+}
+
+// Get implements Client interface.
+func (rc *redisClient) Get(dst []byte, key string) ([]byte, bool, error) {
+	found := false
+	err := rc.cp.do(func(c *conn) error {
+		writeRedisCommand(c, "GET", []byte(key))
+		if err := c.bw.Flush(); err != nil {
+			return err
+		}
+		line, err := readLine(c.br)
+		if err != nil {
+			return err
+		}
+		if len(line) == 0 {
+			return fmt.Errorf("unexpected empty response from Redis")
+		}
+		switch line[0] {
+		case '-':
+			return fmt.Errorf("error response from Redis: %q", line[1:])
+		case '$':
+			size, err := strconv.Atoi(line[1:])
+			if err != nil {
+				return fmt.Errorf("cannot parse bulk string size in response from Redis: %q", line)
+			}
+			if size < 0 {
+				// Null bulk string is returned for missing key.
+				return nil
+			}
+			dst, err = readValue(dst, c.br, size, rc.maxEntrySize)
+			if err != nil {
+				return err
+			}
+			found = true
+			return nil
+		default:
+			return fmt.Errorf("unexpected response from Redis: %q", line)
+		}
+	})
+	if err != nil {
+		return dst, false, fmt.Errorf("cannot get %q from %s: %w", key, rc, err)
+	}
+	return dst, found, nil
+}
+
+// Set implements Client interface.
+func (rc *redisClient) Set(key string, value []byte, ttl time.Duration) error {
+	if err := checkValueSize(value, rc.maxEntrySize); err != nil {
+		return fmt.Errorf("cannot set %q at %s: %w", key, rc, err)
+	}
+	ttlMsecs := ttl.Milliseconds()
+	if ttlMsecs <= 0 {
+		ttlMsecs = 1
+	}
+	err := rc.cp.do(func(c *conn) error {
+		writeRedisCommand(c, "SET", []byte(key), value, []byte("PX"), strconv.AppendInt(nil, ttlMsecs, 10))
+		if err := c.bw.Flush(); err != nil {
+			return err
+		}
+		line, err := readLine(c.br)
+		if err != nil {
+			return err
+		}
+		if line != "+OK" {
+			return fmt.Errorf("unexpected response from Redis: %q; want %q", line, "+OK")
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("cannot set %q at %s: %w", key, rc, err)
+	}
+	return nil
+}
+
+// MustClose implements Client interface.
+func (rc *redisClient) MustClose() {
+	rc.cp.mustClose()
+}
+
+// String implements Client interface.
+func (rc *redisClient) String() string {
+	return "redis://" + rc.cp.addr
+}
+
+// writeRedisCommand writes the command with the given args to c as RESP array of bulk strings.
+//
+// Errors are returned from the subsequent c.bw.Flush call.
+func writeRedisCommand(c *conn, cmd string, args ...[]byte) {
+	bw := c.bw
+	fmt.Fprintf(bw, "*%d\r\n$%d\r\n%s\r\n", len(args)+1, len(cmd), cmd)
+	for _, arg := range args {
+		fmt.Fprintf(bw, "$%d\r\n", len(arg))
+		_, _ = bw.Write(arg)
+		_, _ = bw.WriteString("\r\n")
+	}
+}
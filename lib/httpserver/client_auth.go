@@ -0,0 +1,269 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envtemplate"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
+	"github.com/VictoriaMetrics/metrics"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	tlsClientCAFile = flag.String("tlsClientCAFile", "", "Optional path to file with CA certificates for verifying client certificates if -tls is set (aka mTLS). "+
+		"Clients without valid certificates signed by the given CA are rejected if this flag is set. See https://docs.victoriametrics.com/#mtls")
+	tlsClientAuthConfig = flag.String("tlsClientAuthConfig", "", "Optional path to a file with mapping from client certificate identities to tenants and allowed paths if -tlsClientCAFile is set. "+
+		"The path can point either to local file or to http url. See https://docs.victoriametrics.com/#mtls . The file is reloaded on SIGHUP signal")
+)
+
+// clientAuthRule maps client certificate identity to tenant and to the list of allowed paths.
+type clientAuthRule struct {
+	// CommonName must match the Subject Common Name of the client certificate.
+	CommonName string `yaml:"common_name,omitempty"`
+
+	// SAN must match one of Subject Alternative Names of the client certificate such as DNS name, email address, IP address or URI.
+	SAN string `yaml:"san,omitempty"`
+
+	// ExtraLabels contains tenant labels, which are enforced via `extra_label` query args for requests from the matching clients.
+	ExtraLabels map[string]string `yaml:"extra_labels,omitempty"`
+
+	// AllowedPaths contains regexps for paths, which can be requested by the matching clients.
+	//
+	// All the paths are allowed if AllowedPaths is empty.
+	AllowedPaths []*allowedPath `yaml:"allowed_paths,omitempty"`
+}
+
+// allowedPath represents an anchored regexp for the allowed path.
+type allowedPath struct {
+	sOriginal string
+	re        *regexp.Regexp
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (ap *allowedPath) UnmarshalYAML(f func(interface{}) error) error {
+	var s string
+	if err := f(&s); err != nil {
+		return err
+	}
+	sAnchored := "^(?:" + s + ")$"
+	re, err := regexp.Compile(sAnchored)
+	if err != nil {
+		return fmt.Errorf("cannot build regexp from %q: %w", s, err)
+	}
+	ap.sOriginal = s
+	ap.re = re
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (ap *allowedPath) MarshalYAML() (interface{}, error) {
+	return ap.sOriginal, nil
+}
+
+// applyClientCAFile configures tc for verifying client certificates with CA from -tlsClientCAFile.
+func applyClientCAFile(tc *tls.Config) error {
+	if *tlsClientCAFile == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(*tlsClientCAFile)
+	if err != nil {
+		return fmt.Errorf("cannot read -tlsClientCAFile=%q: %w", *tlsClientCAFile, err)
+	}
+	cp := x509.NewCertPool()
+	if !cp.AppendCertsFromPEM(data) {
+		return fmt.Errorf("cannot parse CA certificates from -tlsClientCAFile=%q", *tlsClientCAFile)
+	}
+	tc.ClientCAs = cp
+	tc.ClientAuth = tls.RequireAndVerifyClientCert
+	return nil
+}
+
+var initClientAuthRulesOnce sync.Once
+
+// initClientAuthRules loads -tlsClientAuthConfig and starts its reloading on SIGHUP.
+func initClientAuthRules() {
+	if *tlsClientAuthConfig == "" {
+		return
+	}
+	if *tlsClientCAFile == "" {
+		logger.Fatalf("-tlsClientAuthConfig requires -tlsClientCAFile to be set")
+	}
+	// Register SIGHUP handler for config re-read just before loadClientAuthRules call.
+	// This guarantees that the config will be re-read if the signal arrives during loadClientAuthRules call.
+	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/1240
+	sighupCh := procutil.NewSighupChan()
+
+	rules, err := loadClientAuthRules(*tlsClientAuthConfig)
+	if err != nil {
+		logger.Fatalf("cannot load -tlsClientAuthConfig=%q: %s", *tlsClientAuthConfig, err)
+	}
+	clientAuthRules.Store(rules)
+	go func() {
+		for range sighupCh {
+			logger.Infof("received SIGHUP; reloading -tlsClientAuthConfig=%q...", *tlsClientAuthConfig)
+			rules, err := loadClientAuthRules(*tlsClientAuthConfig)
+			if err != nil {
+				logger.Errorf("cannot load the updated -tlsClientAuthConfig=%q: %s; preserving the previous config", *tlsClientAuthConfig, err)
+				continue
+			}
+			clientAuthRules.Store(rules)
+			logger.Infof("successfully reloaded -tlsClientAuthConfig=%q", *tlsClientAuthConfig)
+		}
+	}()
+}
+
+// clientAuthRules contains []clientAuthRule loaded from -tlsClientAuthConfig.
+var clientAuthRules atomic.Value
+
+func loadClientAuthRules(path string) ([]clientAuthRule, error) {
+	data, err := fs.ReadFileOrHTTP(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseClientAuthRules(data)
+}
+
+func parseClientAuthRules(data []byte) ([]clientAuthRule, error) {
+	data = envtemplate.Replace(data)
+	var rules []clientAuthRule
+	if err := yaml.UnmarshalStrict(data, &rules); err != nil {
+		return nil, err
+	}
+	for i, rule := range rules {
+		if rule.CommonName == "" && rule.SAN == "" {
+			return nil, fmt.Errorf("missing `common_name` and `san` in the rule #%d; at least one of them must be set", i+1)
+		}
+		for name := range rule.ExtraLabels {
+			if name == "" {
+				return nil, fmt.Errorf("label name cannot be empty in `extra_labels` in the rule #%d", i+1)
+			}
+		}
+	}
+	return rules, nil
+}
+
+// checkClientAuth verifies whether the client certificate for r is allowed to access the requested path.
+//
+// It enforces tenant labels for the client by adding `extra_label` query args to r.
+// It returns false and sends an error to w if the request isn't allowed.
+func checkClientAuth(w http.ResponseWriter, r *http.Request) bool {
+	v := clientAuthRules.Load()
+	if v == nil {
+		// The mapping for client certificates is disabled.
+		return true
+	}
+	rules := v.([]clientAuthRule)
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		clientAuthRejectedRequests.Inc()
+		http.Error(w, "missing verified client certificate", http.StatusUnauthorized)
+		return false
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	rule := getClientAuthRule(rules, cert)
+	if rule == nil {
+		clientAuthRejectedRequests.Inc()
+		http.Error(w, fmt.Sprintf("client certificate with CN=%q isn't allowed by -tlsClientAuthConfig", cert.Subject.CommonName), http.StatusForbidden)
+		return false
+	}
+	if !rule.isPathAllowed(r.URL.Path) {
+		clientAuthRejectedRequests.Inc()
+		http.Error(w, fmt.Sprintf("client certificate with CN=%q isn't allowed to access %q", cert.Subject.CommonName, r.URL.Path), http.StatusForbidden)
+		return false
+	}
+	if len(rule.ExtraLabels) > 0 {
+		r.URL.RawQuery = enforceExtraLabels(r.URL.Query(), rule.ExtraLabels).Encode()
+	}
+	return true
+}
+
+func getClientAuthRule(rules []clientAuthRule, cert *x509.Certificate) *clientAuthRule {
+	for i := range rules {
+		rule := &rules[i]
+		if rule.CommonName != "" && rule.CommonName != cert.Subject.CommonName {
+			continue
+		}
+		if rule.SAN != "" && !hasSAN(cert, rule.SAN) {
+			continue
+		}
+		return rule
+	}
+	return nil
+}
+
+func hasSAN(cert *x509.Certificate, san string) bool {
+	for _, s := range cert.DNSNames {
+		if s == san {
+			return true
+		}
+	}
+	for _, s := range cert.EmailAddresses {
+		if s == san {
+			return true
+		}
+	}
+	for _, ip := range cert.IPAddresses {
+		if ip.String() == san {
+			return true
+		}
+	}
+	for _, u := range cert.URIs {
+		if u.String() == san {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule *clientAuthRule) isPathAllowed(path string) bool {
+	if len(rule.AllowedPaths) == 0 {
+		return true
+	}
+	for _, ap := range rule.AllowedPaths {
+		if ap.re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// enforceExtraLabels replaces `extra_label` query args for the given labels in q with the given label values.
+//
+// `extra_label` query args for other labels are left as is.
+func enforceExtraLabels(q url.Values, labels map[string]string) url.Values {
+	var extraLabels []string
+	for _, s := range q["extra_label"] {
+		n := strings.IndexByte(s, '=')
+		if n >= 0 {
+			if _, ok := labels[s[:n]]; ok {
+				// Drop the label provided by the client, since it is overridden by the enforced label.
+				continue
+			}
+		}
+		extraLabels = append(extraLabels, s)
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		extraLabels = append(extraLabels, name+"="+labels[name])
+	}
+	q["extra_label"] = extraLabels
+	return q
+}
+
+var clientAuthRejectedRequests = metrics.NewCounter(`vm_http_client_cert_rejected_requests_total`)
@@ -0,0 +1,263 @@
+package httpserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseClientAuthRulesFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+		rules, err := parseClientAuthRules([]byte(data))
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if rules != nil {
+			t.Fatalf("expecting nil rules; got %v", rules)
+		}
+	}
+
+	// Invalid yaml
+	f(`foo`)
+
+	// Unknown field
+	f(`
+- common_name: foo
+  foo: bar
+`)
+
+	// Missing client identity
+	f(`
+- extra_labels:
+    team: a
+`)
+
+	// Empty label name
+	f(`
+- common_name: foo
+  extra_labels:
+    "": a
+`)
+
+	// Invalid regexp for allowed_paths
+	f(`
+- common_name: foo
+  allowed_paths: ["/api/v1/(query"]
+`)
+}
+
+func TestClientAuth(t *testing.T) {
+	ca := newTestCA(t)
+
+	caFile, err := ioutil.TempFile("", "TestClientAuth-ca")
+	if err != nil {
+		t.Fatalf("cannot create CA file: %s", err)
+	}
+	defer func() {
+		_ = os.Remove(caFile.Name())
+	}()
+	if _, err := caFile.Write(ca.certPEM); err != nil {
+		t.Fatalf("cannot write CA file: %s", err)
+	}
+	_ = caFile.Close()
+	prevTLSClientCAFile := *tlsClientCAFile
+	*tlsClientCAFile = caFile.Name()
+	defer func() {
+		*tlsClientCAFile = prevTLSClientCAFile
+	}()
+
+	rules, err := parseClientAuthRules([]byte(`
+- common_name: team-a-client
+  extra_labels:
+    team: a
+- san: client@team-b.example.com
+  extra_labels:
+    team: b
+    env: prod
+  allowed_paths:
+  - "/api/v1/query(_range)?"
+- common_name: admin
+`))
+	if err != nil {
+		t.Fatalf("cannot parse client auth rules: %s", err)
+	}
+	prevRules := clientAuthRules.Load()
+	clientAuthRules.Store(rules)
+	defer func() {
+		if prevRules == nil {
+			clientAuthRules = atomic.Value{}
+		} else {
+			clientAuthRules.Store(prevRules)
+		}
+	}()
+
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !checkClientAuth(w, r) {
+			return
+		}
+		fmt.Fprintf(w, "%s", strings.Join(r.URL.Query()["extra_label"], ","))
+	}))
+	serverCert := ca.issueCert(t, "localhost", nil, x509.ExtKeyUsageServerAuth)
+	tc := &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+	}
+	if err := applyClientCAFile(tc); err != nil {
+		t.Fatalf("cannot apply -tlsClientCAFile: %s", err)
+	}
+	s.TLS = tc
+	s.StartTLS()
+	defer s.Close()
+
+	newClient := func(cert *tls.Certificate) *http.Client {
+		rootCAs := x509.NewCertPool()
+		rootCAs.AddCert(ca.cert)
+		tlsConfig := &tls.Config{
+			RootCAs: rootCAs,
+		}
+		if cert != nil {
+			tlsConfig.Certificates = []tls.Certificate{*cert}
+		}
+		return &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: tlsConfig,
+			},
+		}
+	}
+	f := func(c *http.Client, path string, statusCodeExpected int, responseExpected string) {
+		t.Helper()
+		resp, err := c.Get(s.URL + path)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		data, err := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			t.Fatalf("cannot read response body: %s", err)
+		}
+		if resp.StatusCode != statusCodeExpected {
+			t.Fatalf("unexpected status code; got %d; want %d; response body: %q", resp.StatusCode, statusCodeExpected, data)
+		}
+		if statusCodeExpected != http.StatusOK {
+			return
+		}
+		if string(data) != responseExpected {
+			t.Fatalf("unexpected response; got %q; want %q", data, responseExpected)
+		}
+	}
+
+	// The client from team a is mapped to team=a tenant by CN. The tenant label cannot be overridden by the client.
+	certA := ca.issueCert(t, "team-a-client", nil, x509.ExtKeyUsageClientAuth)
+	clientA := newClient(&certA)
+	f(clientA, "/api/v1/query?query=up", http.StatusOK, "team=a")
+	f(clientA, "/api/v1/import?extra_label=team=b&extra_label=foo=bar", http.StatusOK, "foo=bar,team=a")
+
+	// The client from team b is mapped to team=b,env=prod tenant by SAN. It can access only the allowed paths.
+	certB := ca.issueCert(t, "some-client", []string{"client@team-b.example.com"}, x509.ExtKeyUsageClientAuth)
+	clientB := newClient(&certB)
+	f(clientB, "/api/v1/query_range?query=up", http.StatusOK, "env=prod,team=b")
+	f(clientB, "/api/v1/import", http.StatusForbidden, "")
+
+	// The client without tenant labels is allowed to access all the data.
+	certAdmin := ca.issueCert(t, "admin", nil, x509.ExtKeyUsageClientAuth)
+	f(newClient(&certAdmin), "/api/v1/query?extra_label=team=a", http.StatusOK, "team=a")
+
+	// The client with unknown identity must be rejected.
+	certUnknown := ca.issueCert(t, "unknown", []string{"client@team-c.example.com"}, x509.ExtKeyUsageClientAuth)
+	f(newClient(&certUnknown), "/api/v1/query", http.StatusForbidden, "")
+
+	// The client without certificate must be rejected during TLS handshake.
+	if _, err := newClient(nil).Get(s.URL + "/api/v1/query"); err == nil {
+		t.Fatalf("expecting non-nil error for the client without certificate")
+	}
+
+	// The client with the certificate signed by unknown CA must be rejected during TLS handshake.
+	certOtherCA := newTestCA(t).issueCert(t, "team-a-client", nil, x509.ExtKeyUsageClientAuth)
+	if _, err := newClient(&certOtherCA).Get(s.URL + "/api/v1/query"); err == nil {
+		t.Fatalf("expecting non-nil error for the client with certificate signed by unknown CA")
+	}
+}
+
+type testCA struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate CA key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: "test CA",
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("cannot create CA cert: %s", err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		t.Fatalf("cannot parse CA cert: %s", err)
+	}
+	return &testCA{
+		cert:    cert,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}),
+		key:     key,
+	}
+}
+
+func (ca *testCA) issueCert(t *testing.T, commonName string, emailAddresses []string, extKeyUsage x509.ExtKeyUsage) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject: pkix.Name{
+			CommonName: commonName,
+		},
+		EmailAddresses: emailAddresses,
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{extKeyUsage},
+	}
+	if extKeyUsage == x509.ExtKeyUsageServerAuth {
+		template.DNSNames = []string{commonName}
+		template.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("cannot create cert: %s", err)
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{certDER},
+		PrivateKey:  key,
+	}
+}
@@ -26,13 +26,14 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/netutil"
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
 	"github.com/valyala/fastrand"
 )
 
 var (
 	tlsEnable       = flag.Bool("tls", false, "Whether to enable TLS for incoming HTTP requests at -httpListenAddr (aka https). -tlsCertFile and -tlsKeyFile must be set if -tls is set")
-	tlsCertFile     = flag.String("tlsCertFile", "", "Path to file with TLS certificate if -tls is set. Prefer ECDSA certs instead of RSA certs as RSA certs are slower. The provided certificate file is automatically re-read every second, so it can be dynamically updated")
-	tlsKeyFile      = flag.String("tlsKeyFile", "", "Path to file with TLS key if -tls is set. The provided key file is automatically re-read every second, so it can be dynamically updated")
+	tlsCertFile     = flag.String("tlsCertFile", "", "Path to file with TLS certificate if -tls is set. Prefer ECDSA certs instead of RSA certs as RSA certs are slower. The certificate is automatically reloaded when the file changes, so it can be rotated without restart")
+	tlsKeyFile      = flag.String("tlsKeyFile", "", "Path to file with TLS key if -tls is set. The key is automatically reloaded when the file changes, so it can be rotated without restart")
 	tlsCipherSuites = flagutil.NewArray("tlsCipherSuites", "Optional list of TLS cipher suites for incoming requests over HTTPS if -tls is set. See the list of supported cipher suites at https://pkg.go.dev/crypto/tls#pkg-constants")
 
 	pathPrefix = flag.String("http.pathPrefix", "", "An optional prefix to add to all the paths handled by http server. For example, if '-http.pathPrefix=/foo/bar' is set, "+
@@ -44,8 +45,12 @@ var (
 	pprofAuthKey     = flag.String("pprofAuthKey", "", "Auth key for /debug/pprof. It must be passed via authKey query arg. It overrides httpAuth.* settings")
 
 	disableResponseCompression  = flag.Bool("http.disableResponseCompression", false, "Disable compression of HTTP responses to save CPU resources. By default compression is enabled to save network bandwidth")
+	responseCompressionMinSize  = flagutil.NewBytes("http.responseCompressionMinSize", 1024, "The minimum size of HTTP response for applying gzip or zstd compression according to Accept-Encoding request header. Smaller responses are sent without compression, since the compression overhead isn't worth it for them. See also -http.disableResponseCompression")
 	maxGracefulShutdownDuration = flag.Duration("http.maxGracefulShutdownDuration", 7*time.Second, `The maximum duration for a graceful shutdown of the HTTP server. A highly loaded server may require increased value for a graceful shutdown`)
 	shutdownDelay               = flag.Duration("http.shutdownDelay", 0, `Optional delay before http server shutdown. During this delay, the server returns non-OK responses from /health page, so load balancers can route new requests to other servers`)
+	drainTimeout                = flag.Duration("http.drainTimeout", 0, "Optional timeout for draining in-flight requests on http server shutdown. During this timeout, new requests are rejected "+
+		"with '503 Service Unavailable' responses, while in-flight requests are allowed to complete. The drain starts after -http.shutdownDelay. "+
+		"The drain is disabled if the timeout is set to 0")
 	idleConnTimeout             = flag.Duration("http.idleConnTimeout", time.Minute, "Timeout for incoming idle http connections")
 	connTimeout                 = flag.Duration("http.connTimeout", 2*time.Minute, `Incoming http connections are closed after the configured timeout. This may help to spread the incoming load among a cluster of services behind a load balancer. Please note that the real timeout may be bigger by up to 10% as a protection against the thundering herd problem`)
 )
@@ -55,9 +60,42 @@ var (
 	serversLock sync.Mutex
 )
 
+// notReady is set to 1 while the app isn't ready to serve requests, e.g. during startup.
+//
+// See SetReady.
+var notReady int32
+
+// SetReady sets readiness state for all the http servers started via Serve.
+//
+// Apps must call SetReady(false) before starting http server if they need some time for initialization
+// and then call SetReady(true) after the initialization is complete.
+// /ready page returns non-OK responses while the app isn't ready,
+// and all the requests to the app-specific handlers are rejected with `503 Service Unavailable`.
+func SetReady(ready bool) {
+	n := int32(1)
+	if ready {
+		n = 0
+	}
+	atomic.StoreInt32(&notReady, n)
+}
+
+// IsReady returns true if the app is ready to serve requests.
+//
+// See SetReady.
+func IsReady() bool {
+	return atomic.LoadInt32(&notReady) == 0
+}
+
 type server struct {
 	shutdownDelayDeadline int64
-	s                     *http.Server
+
+	// inflightRequests is the number of requests currently served by s.
+	inflightRequests int64
+
+	// draining is set to 1 when s rejects new requests while waiting for in-flight requests to complete.
+	draining int32
+
+	s *http.Server
 }
 
 // RequestHandler must serve the given request r and write response to w.
@@ -97,7 +135,11 @@ func Serve(addr string, rh RequestHandler) {
 		if err != nil {
 			logger.Fatalf("cannot load TLS cert from -tlsCertFile=%q, -tlsKeyFile=%q: %s", *tlsCertFile, *tlsKeyFile, err)
 		}
+		if err := applyClientCAFile(tc); err != nil {
+			logger.Fatalf("cannot set up verification for client certificates: %s", err)
+		}
 		tlsConfig = tc
+		initClientAuthRulesOnce.Do(initClientAuthRules)
 	}
 	ln, err := netutil.NewTCPListener(scheme, addr, tlsConfig)
 	if err != nil {
@@ -178,6 +220,10 @@ func Stop(addr string) error {
 		logger.Infof("Starting shutdown for http server %q", addr)
 	}
 
+	if *drainTimeout > 0 {
+		s.drain(addr, *drainTimeout)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), *maxGracefulShutdownDuration)
 	defer cancel()
 	if err := s.s.Shutdown(ctx); err != nil {
@@ -187,13 +233,44 @@ func Stop(addr string) error {
 	return nil
 }
 
+// drain rejects new requests to s and waits until in-flight requests are complete or until the timeout expires.
+func (s *server) drain(addr string, timeout time.Duration) {
+	atomic.StoreInt32(&s.draining, 1)
+	logger.Infof("draining in-flight requests at http server %q for up to %.3fs", addr, timeout.Seconds())
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		n := atomic.LoadInt64(&s.inflightRequests)
+		if n <= 0 {
+			logger.Infof("all the in-flight requests at http server %q are complete", addr)
+			return
+		}
+		if time.Now().After(deadline) {
+			logger.Warnf("%d in-flight requests at http server %q weren't complete during -http.drainTimeout=%s", n, addr, timeout)
+			return
+		}
+		<-ticker.C
+	}
+}
+
 func gzipHandler(s *server, rh RequestHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w = maybeGzipResponseWriter(w, r)
+		// Increment the number of in-flight requests before checking for draining state,
+		// so the drain couldn't miss the request.
+		atomic.AddInt64(&s.inflightRequests, 1)
+		defer atomic.AddInt64(&s.inflightRequests, -1)
+		if atomic.LoadInt32(&s.draining) != 0 {
+			drainRejectedRequests.Inc()
+			w.Header().Set("Connection", "close")
+			http.Error(w, "The server is shutting down; try again later", http.StatusServiceUnavailable)
+			return
+		}
+		w = maybeCompressResponseWriter(w, r)
 		handlerWrapper(s, w, r, rh)
-		if zrw, ok := w.(*gzipResponseWriter); ok {
+		if zrw, ok := w.(*compressResponseWriter); ok {
 			if err := zrw.Close(); err != nil && !isTrivialNetworkError(err) {
-				logger.Warnf("gzipResponseWriter.Close: %s", err)
+				logger.Warnf("compressResponseWriter.Close: %s", err)
 			}
 		}
 	}
@@ -259,6 +336,25 @@ func handlerWrapper(s *server, w http.ResponseWriter, r *http.Request, rh Reques
 		errMsg := fmt.Sprintf("The server is in delayed shutdown mode, which will end in %.3fs", d.Seconds())
 		http.Error(w, errMsg, http.StatusServiceUnavailable)
 		return
+	case "/ready":
+		// Unlike /health, which is used for liveness checks, /ready returns non-OK responses
+		// during the app startup and during graceful shutdown, so load balancers do not route requests
+		// to the server while it cannot serve them.
+		if !IsReady() {
+			http.Error(w, "The server is starting up", http.StatusServiceUnavailable)
+			return
+		}
+		if deadline := atomic.LoadInt64(&s.shutdownDelayDeadline); deadline > 0 {
+			http.Error(w, "The server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		// The app may have its own readiness checks.
+		if rh(w, r) {
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("OK"))
+		return
 	case "/ping":
 		// This is needed for compatibility with InfluxDB agents.
 		// See https://docs.influxdata.com/influxdb/v1.7/tools/api/#ping-http-endpoint
@@ -312,6 +408,14 @@ func handlerWrapper(s *server, w http.ResponseWriter, r *http.Request, rh Reques
 		if !checkBasicAuth(w, r) {
 			return
 		}
+		if !checkClientAuth(w, r) {
+			return
+		}
+		if !IsReady() {
+			notReadyRequestErrors.Inc()
+			http.Error(w, "The server is starting up; try again later", http.StatusServiceUnavailable)
+			return
+		}
 		if rh(w, r) {
 			return
 		}
@@ -354,7 +458,7 @@ func checkBasicAuth(w http.ResponseWriter, r *http.Request) bool {
 	return false
 }
 
-func maybeGzipResponseWriter(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+func maybeCompressResponseWriter(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
 	if *disableResponseCompression {
 		return w
 	}
@@ -365,28 +469,60 @@ func maybeGzipResponseWriter(w http.ResponseWriter, r *http.Request) http.Respon
 	if ae == "" {
 		return w
 	}
-	ae = strings.ToLower(ae)
-	n := strings.Index(ae, "gzip")
-	if n < 0 {
-		// Do not apply gzip encoding to the response.
+	encoding := getResponseEncoding(ae)
+	if encoding == "" {
+		// Do not apply compression to the response.
 		return w
 	}
-	// Apply gzip encoding to the response.
-	zw := getGzipWriter(w)
-	bw := getBufioWriter(zw)
-	zrw := &gzipResponseWriter{
-		rw: w,
-		zw: zw,
-		bw: bw,
+	zrw := &compressResponseWriter{
+		rw:       w,
+		encoding: encoding,
 	}
 	return zrw
 }
 
+// getResponseEncoding returns the preferred supported encoding from the given Accept-Encoding header value.
+//
+// An empty string is returned if the client doesn't accept any of the supported encodings.
+func getResponseEncoding(ae string) string {
+	bestEncoding := ""
+	bestQ := 0.0
+	for _, s := range strings.Split(strings.ToLower(ae), ",") {
+		name := s
+		q := 1.0
+		if n := strings.IndexByte(s, ';'); n >= 0 {
+			name = s[:n]
+			param := strings.TrimSpace(s[n+1:])
+			if strings.HasPrefix(param, "q=") {
+				f, err := strconv.ParseFloat(param[len("q="):], 64)
+				if err != nil {
+					continue
+				}
+				q = f
+			}
+		}
+		name = strings.TrimSpace(name)
+		if name != "gzip" && name != "zstd" {
+			continue
+		}
+		if q <= 0 || q < bestQ {
+			continue
+		}
+		// Prefer zstd over gzip with the same q-value, since zstd is faster and provides better compression ratio.
+		if q == bestQ && name != "zstd" {
+			continue
+		}
+		bestEncoding = name
+		bestQ = q
+	}
+	return bestEncoding
+}
+
 // DisableResponseCompression disables response compression on w.
 //
 // The function must be called before the first w.Write* call.
 func DisableResponseCompression(w http.ResponseWriter) {
-	zrw, ok := w.(*gzipResponseWriter)
+	zrw, ok := w.(*compressResponseWriter)
 	if !ok {
 		return
 	}
@@ -402,6 +538,31 @@ func EnableCORS(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 }
 
+// compressWriter is a writer, which compresses data written to it.
+type compressWriter interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+func getCompressWriter(encoding string, w io.Writer) compressWriter {
+	if encoding == "zstd" {
+		return getZstdWriter(w)
+	}
+	return getGzipWriter(w)
+}
+
+func putCompressWriter(zw compressWriter) {
+	switch t := zw.(type) {
+	case *zstd.Encoder:
+		zstdWriterPool.Put(t)
+	case *gzip.Writer:
+		gzipWriterPool.Put(t)
+	default:
+		logger.Panicf("BUG: unexpected compress writer type: %T", zw)
+	}
+}
+
 func getGzipWriter(w io.Writer) *gzip.Writer {
 	v := gzipWriterPool.Get()
 	if v == nil {
@@ -416,29 +577,46 @@ func getGzipWriter(w io.Writer) *gzip.Writer {
 	return zw
 }
 
-func putGzipWriter(zw *gzip.Writer) {
-	gzipWriterPool.Put(zw)
+var gzipWriterPool sync.Pool
+
+func getZstdWriter(w io.Writer) *zstd.Encoder {
+	v := zstdWriterPool.Get()
+	if v == nil {
+		zw, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1), zstd.WithLowerEncoderMem(true))
+		if err != nil {
+			logger.Panicf("BUG: cannot create zstd writer: %s", err)
+		}
+		return zw
+	}
+	zw := v.(*zstd.Encoder)
+	zw.Reset(w)
+	return zw
 }
 
-var gzipWriterPool sync.Pool
+var zstdWriterPool sync.Pool
 
-type gzipResponseWriter struct {
+type compressResponseWriter struct {
 	rw         http.ResponseWriter
-	zw         *gzip.Writer
+	encoding   string
+	zw         compressWriter
 	bw         *bufio.Writer
 	statusCode int
 
+	// buf holds the beginning of the response until its size reaches -http.responseCompressionMinSize.
+	// This allows sending small responses without compression.
+	buf []byte
+
 	firstWriteDone     bool
 	disableCompression bool
 }
 
 // Implements http.ResponseWriter.Header method.
-func (zrw *gzipResponseWriter) Header() http.Header {
+func (zrw *compressResponseWriter) Header() http.Header {
 	return zrw.rw.Header()
 }
 
 // Implements http.ResponseWriter.Write method.
-func (zrw *gzipResponseWriter) Write(p []byte) (int, error) {
+func (zrw *compressResponseWriter) Write(p []byte) (int, error) {
 	if !zrw.firstWriteDone {
 		h := zrw.Header()
 		if zrw.statusCode == http.StatusNoContent {
@@ -447,17 +625,21 @@ func (zrw *gzipResponseWriter) Write(p []byte) (int, error) {
 		if h.Get("Content-Encoding") != "" {
 			zrw.disableCompression = true
 		}
-		if !zrw.disableCompression {
-			h.Set("Content-Encoding", "gzip")
-			h.Del("Content-Length")
-			if h.Get("Content-Type") == "" {
-				// Disable auto-detection of content-type, since it
-				// is incorrectly detected after the compression.
-				h.Set("Content-Type", "text/html; charset=utf-8")
+		if zrw.disableCompression {
+			if err := zrw.startResponse(false); err != nil {
+				return 0, err
 			}
+			return zrw.rw.Write(p)
 		}
-		zrw.writeHeader()
-		zrw.firstWriteDone = true
+		zrw.buf = append(zrw.buf, p...)
+		if len(zrw.buf) < responseCompressionMinSize.N {
+			// Postpone the decision on whether to compress the response until more data is written.
+			return len(p), nil
+		}
+		if err := zrw.startResponse(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
 	}
 	if zrw.disableCompression {
 		return zrw.rw.Write(p)
@@ -465,12 +647,46 @@ func (zrw *gzipResponseWriter) Write(p []byte) (int, error) {
 	return zrw.bw.Write(p)
 }
 
+// startResponse writes response headers and the buffered data.
+//
+// The response is compressed if mustCompress is set.
+func (zrw *compressResponseWriter) startResponse(mustCompress bool) error {
+	zrw.firstWriteDone = true
+	if !mustCompress {
+		zrw.disableCompression = true
+	} else {
+		h := zrw.Header()
+		h.Set("Content-Encoding", zrw.encoding)
+		h.Del("Content-Length")
+		if h.Get("Content-Type") == "" {
+			// Disable auto-detection of content-type, since it
+			// is incorrectly detected after the compression.
+			h.Set("Content-Type", "text/html; charset=utf-8")
+		}
+		zrw.zw = getCompressWriter(zrw.encoding, zrw.rw)
+		zrw.bw = getBufioWriter(zrw.zw)
+	}
+	zrw.writeHeader()
+	buf := zrw.buf
+	zrw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if zrw.disableCompression {
+		_, err = zrw.rw.Write(buf)
+	} else {
+		_, err = zrw.bw.Write(buf)
+	}
+	return err
+}
+
 // Implements http.ResponseWriter.WriteHeader method.
-func (zrw *gzipResponseWriter) WriteHeader(statusCode int) {
+func (zrw *compressResponseWriter) WriteHeader(statusCode int) {
 	zrw.statusCode = statusCode
 }
 
-func (zrw *gzipResponseWriter) writeHeader() {
+func (zrw *compressResponseWriter) writeHeader() {
 	if zrw.statusCode == 0 {
 		zrw.statusCode = http.StatusOK
 	}
@@ -478,16 +694,20 @@ func (zrw *gzipResponseWriter) writeHeader() {
 }
 
 // Implements http.Flusher
-func (zrw *gzipResponseWriter) Flush() {
+func (zrw *compressResponseWriter) Flush() {
 	if !zrw.firstWriteDone {
-		_, _ = zrw.Write(nil)
+		// The response is flushed before reaching -http.responseCompressionMinSize.
+		// This usually means the response is streamed, so it is likely to be big. Compress it.
+		if err := zrw.startResponse(!zrw.disableCompression); err != nil && !isTrivialNetworkError(err) {
+			logger.Warnf("compressResponseWriter.Flush (start): %s", err)
+		}
 	}
 	if !zrw.disableCompression {
 		if err := zrw.bw.Flush(); err != nil && !isTrivialNetworkError(err) {
-			logger.Warnf("gzipResponseWriter.Flush (buffer): %s", err)
+			logger.Warnf("compressResponseWriter.Flush (buffer): %s", err)
 		}
 		if err := zrw.zw.Flush(); err != nil && !isTrivialNetworkError(err) {
-			logger.Warnf("gzipResponseWriter.Flush (gzip): %s", err)
+			logger.Warnf("compressResponseWriter.Flush (%s): %s", zrw.encoding, err)
 		}
 	}
 	if fw, ok := zrw.rw.(http.Flusher); ok {
@@ -495,19 +715,22 @@ func (zrw *gzipResponseWriter) Flush() {
 	}
 }
 
-func (zrw *gzipResponseWriter) Close() error {
+func (zrw *compressResponseWriter) Close() error {
 	if !zrw.firstWriteDone {
-		_, _ = zrw.Write(nil)
+		// The whole response is smaller than -http.responseCompressionMinSize. Send it without compression.
+		if err := zrw.startResponse(false); err != nil {
+			return err
+		}
 	}
 	zrw.Flush()
 	var err error
 	if !zrw.disableCompression {
 		err = zrw.zw.Close()
+		putCompressWriter(zrw.zw)
+		zrw.zw = nil
+		putBufioWriter(zrw.bw)
+		zrw.bw = nil
 	}
-	putGzipWriter(zrw.zw)
-	zrw.zw = nil
-	putBufioWriter(zrw.bw)
-	zrw.bw = nil
 	return err
 }
 
@@ -570,6 +793,10 @@ var (
 	faviconRequests      = metrics.NewCounter(`vm_http_requests_total{path="/favicon.ico"}`)
 
 	unsupportedRequestErrors = metrics.NewCounter(`vm_http_request_errors_total{path="*", reason="unsupported"}`)
+	notReadyRequestErrors    = metrics.NewCounter(`vm_http_request_errors_total{path="*", reason="not_ready"}`)
+	drainRejectedRequests    = metrics.NewCounter(`vm_http_request_errors_total{path="*", reason="draining"}`)
+
+	requestBodyTooLargeErrors = metrics.NewCounter(`vm_http_request_errors_total{path="*", reason="too_large_body"}`)
 
 	requestsTotal = metrics.NewCounter(`vm_http_requests_all_total`)
 )
@@ -600,9 +827,79 @@ func Errorf(w http.ResponseWriter, r *http.Request, format string, args ...inter
 			break
 		}
 	}
+	if lrb, ok := r.Body.(*limitedRequestBody); ok && lrb.isExceeded() {
+		// The error may be caused by too big request body, even if the request handler didn't preserve the original error.
+		statusCode = http.StatusRequestEntityTooLarge
+	}
 	http.Error(w, errStr, statusCode)
 }
 
+// LimitRequestBody limits the size of r.Body to maxSize bytes.
+//
+// Reading more than maxSize bytes from r.Body results in an error.
+// Errorf responds with `413 Request Entity Too Large` status code if it is called for r after such an error.
+// The limit is disabled if maxSize <= 0.
+func LimitRequestBody(r *http.Request, maxSize int64) {
+	if maxSize <= 0 {
+		return
+	}
+	lrb := &limitedRequestBody{
+		rc:        r.Body,
+		maxSize:   maxSize,
+		remaining: maxSize,
+	}
+	if r.ContentLength > maxSize {
+		// Fail fast without reading the request body.
+		lrb.remaining = 0
+		lrb.forceExceeded = true
+	}
+	r.Body = lrb
+}
+
+type limitedRequestBody struct {
+	rc        io.ReadCloser
+	maxSize   int64
+	remaining int64
+
+	// forceExceeded is set if the Content-Length request header exceeds maxSize.
+	forceExceeded bool
+
+	exceeded uint32
+}
+
+func (lrb *limitedRequestBody) Read(p []byte) (int, error) {
+	if lrb.remaining <= 0 {
+		if !lrb.forceExceeded {
+			// Check whether the request body contains more data than maxSize.
+			var buf [1]byte
+			n, err := lrb.rc.Read(buf[:])
+			if n == 0 {
+				return 0, err
+			}
+		}
+		atomic.StoreUint32(&lrb.exceeded, 1)
+		requestBodyTooLargeErrors.Inc()
+		return 0, &ErrorWithStatusCode{
+			Err:        fmt.Errorf("too big request body; it mustn't exceed %d bytes", lrb.maxSize),
+			StatusCode: http.StatusRequestEntityTooLarge,
+		}
+	}
+	if int64(len(p)) > lrb.remaining {
+		p = p[:lrb.remaining]
+	}
+	n, err := lrb.rc.Read(p)
+	lrb.remaining -= int64(n)
+	return n, err
+}
+
+func (lrb *limitedRequestBody) Close() error {
+	return lrb.rc.Close()
+}
+
+func (lrb *limitedRequestBody) isExceeded() bool {
+	return atomic.LoadUint32(&lrb.exceeded) != 0
+}
+
 // ErrorWithStatusCode is error with HTTP status code.
 //
 // The given StatusCode is sent to client when the error is passed to Errorf.
@@ -0,0 +1,318 @@
+package httpserver
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestReadiness(t *testing.T) {
+	defer SetReady(true)
+
+	rhCalls := 0
+	rh := func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/api/v1/query" {
+			return false
+		}
+		rhCalls++
+		w.WriteHeader(http.StatusOK)
+		return true
+	}
+	var s server
+	f := func(path string, statusCodeExpected int) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		handlerWrapper(&s, w, r, rh)
+		if w.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code for %q; got %d; want %d; response body: %q", path, w.Code, statusCodeExpected, w.Body.String())
+		}
+	}
+
+	// Simulate startup
+	SetReady(false)
+	f("/health", http.StatusOK)
+	f("/ready", http.StatusServiceUnavailable)
+	f("/api/v1/query", http.StatusServiceUnavailable)
+	if rhCalls != 0 {
+		t.Fatalf("request handler mustn't be called during startup; got %d calls", rhCalls)
+	}
+
+	// The startup is complete
+	SetReady(true)
+	f("/health", http.StatusOK)
+	f("/ready", http.StatusOK)
+	f("/api/v1/query", http.StatusOK)
+	if rhCalls != 1 {
+		t.Fatalf("unexpected number of request handler calls; got %d; want 1", rhCalls)
+	}
+
+	// Simulate graceful shutdown
+	atomic.StoreInt64(&s.shutdownDelayDeadline, time.Now().Add(time.Minute).UnixNano())
+	f("/health", http.StatusServiceUnavailable)
+	f("/ready", http.StatusServiceUnavailable)
+}
+
+func TestReadinessCustomCheck(t *testing.T) {
+	pending := true
+	rh := func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/ready" || !pending {
+			return false
+		}
+		http.Error(w, "waiting for initialization", http.StatusTooEarly)
+		return true
+	}
+	var s server
+	f := func(statusCodeExpected int) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/ready", nil)
+		w := httptest.NewRecorder()
+		handlerWrapper(&s, w, r, rh)
+		if w.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code; got %d; want %d", w.Code, statusCodeExpected)
+		}
+	}
+	f(http.StatusTooEarly)
+	pending = false
+	f(http.StatusOK)
+}
+
+func TestStopDrainsInflightRequests(t *testing.T) {
+	origDrainTimeout := *drainTimeout
+	*drainTimeout = 10 * time.Second
+	defer func() {
+		*drainTimeout = origDrainTimeout
+	}()
+
+	requestStarted := make(chan struct{})
+	releaseRequest := make(chan struct{})
+	rh := func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/slow" {
+			return false
+		}
+		close(requestStarted)
+		<-releaseRequest
+		w.Write([]byte("done"))
+		return true
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot create listener: %s", err)
+	}
+	addr := "test-drain"
+	go serveWithListener(addr, ln, rh)
+	url := "http://" + ln.Addr().String()
+
+	// Start in-flight request
+	type result struct {
+		statusCode int
+		body       string
+		err        error
+	}
+	inflightResultCh := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(url + "/slow")
+		if err != nil {
+			inflightResultCh <- result{err: err}
+			return
+		}
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		inflightResultCh <- result{
+			statusCode: resp.StatusCode,
+			body:       string(body),
+			err:        err,
+		}
+	}()
+	<-requestStarted
+
+	stopErrCh := make(chan error, 1)
+	go func() {
+		stopErrCh <- Stop(addr)
+	}()
+
+	// Wait until the server starts draining
+	serversLock.Lock()
+	s := servers[addr]
+	serversLock.Unlock()
+	if s == nil {
+		t.Fatalf("cannot find server at %q", addr)
+	}
+	for atomic.LoadInt32(&s.draining) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// New requests must be rejected during the drain
+	resp, err := http.Get(url + "/health")
+	if err != nil {
+		t.Fatalf("unexpected error for the request during the drain: %s", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected status code for the request during the drain; got %d; want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+
+	// In-flight request must be completed
+	close(releaseRequest)
+	res := <-inflightResultCh
+	if res.err != nil {
+		t.Fatalf("unexpected error for in-flight request: %s", res.err)
+	}
+	if res.statusCode != http.StatusOK || res.body != "done" {
+		t.Fatalf("unexpected response for in-flight request; got status code %d with body %q; want status code %d with body %q", res.statusCode, res.body, http.StatusOK, "done")
+	}
+	if err := <-stopErrCh; err != nil {
+		t.Fatalf("unexpected error when stopping the server: %s", err)
+	}
+}
+
+func TestGetResponseEncoding(t *testing.T) {
+	f := func(ae, encodingExpected string) {
+		t.Helper()
+		encoding := getResponseEncoding(ae)
+		if encoding != encodingExpected {
+			t.Fatalf("unexpected encoding for Accept-Encoding=%q; got %q; want %q", ae, encoding, encodingExpected)
+		}
+	}
+	f("", "")
+	f("identity", "")
+	f("br, deflate", "")
+	f("gzip", "gzip")
+	f("GZIP", "gzip")
+	f("zstd", "zstd")
+	f("gzip, deflate, br, zstd", "zstd")
+	f("gzip;q=1.0, zstd;q=0.5", "gzip")
+	f("gzip;q=0.5, zstd", "zstd")
+	f("gzip;q=0", "")
+	f("zstd;q=0, gzip", "gzip")
+	f("zstd;q=foo, gzip;q=0.1", "gzip")
+}
+
+func TestResponseCompression(t *testing.T) {
+	bigResponse := strings.Repeat("foo bar baz ", 10000)
+	rh := func(w http.ResponseWriter, r *http.Request) bool {
+		switch r.URL.Path {
+		case "/api/v1/query_range":
+			w.Header().Set("Content-Type", "application/json")
+			for i := 0; i < len(bigResponse); i += 1000 {
+				w.Write([]byte(bigResponse[i : i+1000]))
+			}
+			return true
+		case "/api/v1/query":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"status":"success"}`))
+			return true
+		case "/api/v1/export":
+			// Streaming response
+			w.Write([]byte("foo"))
+			w.(http.Flusher).Flush()
+			w.Write([]byte("bar"))
+			return true
+		default:
+			return false
+		}
+	}
+	var s server
+	h := gzipHandler(&s, rh)
+	f := func(path, acceptEncoding, encodingExpected, responseExpected string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		h(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("unexpected status code; got %d; want %d", w.Code, http.StatusOK)
+		}
+		encoding := w.Header().Get("Content-Encoding")
+		if encoding != encodingExpected {
+			t.Fatalf("unexpected Content-Encoding; got %q; want %q", encoding, encodingExpected)
+		}
+		var r io.Reader = w.Body
+		switch encoding {
+		case "gzip":
+			zr, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatalf("cannot create gzip reader: %s", err)
+			}
+			r = zr
+		case "zstd":
+			zr, err := zstd.NewReader(w.Body)
+			if err != nil {
+				t.Fatalf("cannot create zstd reader: %s", err)
+			}
+			defer zr.Close()
+			r = zr
+		}
+		body, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("cannot read response body: %s", err)
+		}
+		if string(body) != responseExpected {
+			t.Fatalf("unexpected response body; got %d bytes; want %d bytes", len(body), len(responseExpected))
+		}
+		if w.Header().Get("Content-Type") != "application/json" && path != "/api/v1/export" {
+			t.Fatalf("unexpected Content-Type; got %q; want %q", w.Header().Get("Content-Type"), "application/json")
+		}
+	}
+
+	// Big responses must be compressed
+	f("/api/v1/query_range", "gzip", "gzip", bigResponse)
+	f("/api/v1/query_range", "gzip, zstd", "zstd", bigResponse)
+	f("/api/v1/query_range", "", "", bigResponse)
+	f("/api/v1/query_range", "br", "", bigResponse)
+
+	// Tiny responses mustn't be compressed
+	f("/api/v1/query", "gzip", "", `{"status":"success"}`)
+	f("/api/v1/query", "zstd", "", `{"status":"success"}`)
+
+	// Streamed responses must be compressed
+	f("/api/v1/export", "gzip", "gzip", "foobar")
+}
+
+func TestLimitRequestBody(t *testing.T) {
+	f := func(body string, contentLength int64, maxSize int64, statusCodeExpected int) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/import", strings.NewReader(body))
+		r.ContentLength = contentLength
+		LimitRequestBody(r, maxSize)
+		w := httptest.NewRecorder()
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			// Lose the original error type in the same way as some request handlers do.
+			Errorf(w, r, "cannot read request body: %s", err.Error())
+		} else {
+			if string(data) != body {
+				t.Fatalf("unexpected request body read; got %q; want %q", data, body)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+		if w.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code; got %d; want %d; response body: %q", w.Code, statusCodeExpected, w.Body.String())
+		}
+	}
+
+	body := strings.Repeat("foo 123\n", 100)
+
+	// No limit
+	f(body, int64(len(body)), 0, http.StatusNoContent)
+
+	// The body size is below the limit
+	f(body, int64(len(body)), int64(len(body)), http.StatusNoContent)
+	f(body, -1, int64(len(body)), http.StatusNoContent)
+
+	// Oversized body with Content-Length
+	f(body, int64(len(body)), int64(len(body)-1), http.StatusRequestEntityTooLarge)
+	f(body, int64(len(body)), 10, http.StatusRequestEntityTooLarge)
+
+	// Oversized body with chunked encoding
+	f(body, -1, int64(len(body)-1), http.StatusRequestEntityTooLarge)
+	f(body, -1, 10, http.StatusRequestEntityTooLarge)
+}
@@ -3,47 +3,137 @@ package netutil
 import (
 	"crypto/tls"
 	"fmt"
+	"os"
 	"strings"
 	"sync"
+	"time"
 
-	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
 )
 
 // GetServerTLSConfig returns TLS config for the server.
+//
+// The certificate is automatically re-read from tlsCertFile and tlsKeyFile when these files change,
+// so it can be rotated without restart. The previously loaded certificate is used until the updated files
+// contain valid certificate and key.
 func GetServerTLSConfig(tlsCertFile, tlsKeyFile string, tlsCipherSuites []string) (*tls.Config, error) {
-	var certLock sync.Mutex
-	var certDeadline uint64
-	var cert *tls.Certificate
-	c, err := tls.LoadX509KeyPair(tlsCertFile, tlsKeyFile)
+	cr, err := newCertReloader(tlsCertFile, tlsKeyFile)
 	if err != nil {
-		return nil, fmt.Errorf("cannot load TLS cert from certFile=%q, keyFile=%q: %w", tlsCertFile, tlsKeyFile, err)
+		return nil, err
 	}
 	cipherSuites, err := cipherSuitesFromNames(tlsCipherSuites)
 	if err != nil {
 		return nil, fmt.Errorf("cannot use TLS cipher suites from tlsCipherSuites=%q: %w", tlsCipherSuites, err)
 	}
-	cert = &c
 	cfg := &tls.Config{
 		MinVersion:               tls.VersionTLS12,
 		PreferServerCipherSuites: true,
 		GetCertificate: func(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
-			certLock.Lock()
-			defer certLock.Unlock()
-			if fasttime.UnixTimestamp() > certDeadline {
-				c, err = tls.LoadX509KeyPair(tlsCertFile, tlsKeyFile)
-				if err != nil {
-					return nil, fmt.Errorf("cannot load TLS cert from certFile=%q, keyFile=%q: %w", tlsCertFile, tlsKeyFile, err)
-				}
-				certDeadline = fasttime.UnixTimestamp() + 1
-				cert = &c
-			}
-			return cert, nil
+			return cr.getCertificate(), nil
 		},
 		CipherSuites: cipherSuites,
 	}
 	return cfg, nil
 }
 
+// certCheckInterval is the interval for checking whether cert and key files are changed.
+//
+// It is a variable in order to be able to change it in tests.
+var certCheckInterval = time.Second
+
+// certReloader holds TLS certificate loaded from certFile and keyFile.
+//
+// The certificate is re-loaded when certFile or keyFile changes.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	cert *tls.Certificate
+
+	// filesState contains the state of certFile and keyFile for the loaded cert.
+	filesState string
+
+	lastCheckTime time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	cr := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	filesState, err := cr.getFilesState()
+	if err != nil {
+		return nil, err
+	}
+	if err := cr.loadCert(filesState); err != nil {
+		return nil, err
+	}
+	cr.lastCheckTime = time.Now()
+	return cr, nil
+}
+
+// getCertificate returns the most recently loaded certificate.
+//
+// It checks whether cert and key files are changed at most once per certCheckInterval and re-loads the certificate if needed.
+func (cr *certReloader) getCertificate() *tls.Certificate {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	ct := time.Now()
+	if ct.Sub(cr.lastCheckTime) < certCheckInterval {
+		return cr.cert
+	}
+	cr.lastCheckTime = ct
+	filesState, err := cr.getFilesState()
+	if err == nil && filesState != cr.filesState {
+		err = cr.loadCert(filesState)
+		if err == nil {
+			tlsCertReloads.Inc()
+			logger.Infof("reloaded TLS cert from certFile=%q, keyFile=%q", cr.certFile, cr.keyFile)
+		}
+	}
+	if err != nil {
+		// Continue using the previously loaded cert, since cert and key files may be in the middle of update.
+		tlsCertReloadErrors.Inc()
+		logger.WithThrottler("tlsCertReload", 5*time.Second).Errorf("%s; continuing using the previously loaded TLS cert", err)
+	}
+	return cr.cert
+}
+
+func (cr *certReloader) loadCert(filesState string) error {
+	c, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("cannot load TLS cert from certFile=%q, keyFile=%q: %w", cr.certFile, cr.keyFile, err)
+	}
+	cr.cert = &c
+	cr.filesState = filesState
+	return nil
+}
+
+// getFilesState returns a string, which changes when cert or key file is modified.
+func (cr *certReloader) getFilesState() (string, error) {
+	var states []string
+	for _, path := range []string{cr.certFile, cr.keyFile} {
+		// os.Stat follows symlinks, so the change is detected when the file is updated via symlink swap
+		// such as in Kubernetes secrets mounted as volumes.
+		fi, err := os.Stat(path)
+		if err != nil {
+			return "", fmt.Errorf("cannot obtain info for TLS file %q: %w", path, err)
+		}
+		states = append(states, fmt.Sprintf("%d:%d", fi.ModTime().UnixNano(), fi.Size()))
+	}
+	return strings.Join(states, ","), nil
+}
+
+var (
+	tlsCertReloads      = metrics.NewCounter(`vm_tls_cert_reloads_total`)
+	tlsCertReloadErrors = metrics.NewCounter(`vm_tls_cert_reload_errors_total`)
+)
+
 func cipherSuitesFromNames(cipherSuiteNames []string) ([]uint16, error) {
 	if len(cipherSuiteNames) == 0 {
 		return nil, nil
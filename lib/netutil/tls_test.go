@@ -1,8 +1,20 @@
 package netutil
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestCipherSuitesFromNames(t *testing.T) {
@@ -76,3 +88,123 @@ func TestCipherSuitesFromNames(t *testing.T) {
 		})
 	}
 }
+
+func TestGetServerTLSConfigCertRotation(t *testing.T) {
+	prevCertCheckInterval := certCheckInterval
+	certCheckInterval = 0
+	defer func() {
+		certCheckInterval = prevCertCheckInterval
+	}()
+
+	dir, err := ioutil.TempDir("", "TestGetServerTLSConfigCertRotation")
+	if err != nil {
+		t.Fatalf("cannot create temporary dir: %s", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeFile := func(path string, data []byte) {
+		t.Helper()
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatalf("cannot write %q: %s", path, err)
+		}
+	}
+
+	certPEM, keyPEM := testGenerateCert(t, "first")
+	writeFile(certFile, certPEM)
+	writeFile(keyFile, keyPEM)
+	tlsConfig, err := GetServerTLSConfig(certFile, keyFile, nil)
+	if err != nil {
+		t.Fatalf("cannot create TLS config: %s", err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	if err != nil {
+		t.Fatalf("cannot start TLS listener: %s", err)
+	}
+	defer func() {
+		_ = ln.Close()
+	}()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = c.(*tls.Conn).Handshake()
+			_ = c.Close()
+		}
+	}()
+
+	f := func(cnExpected string) {
+		t.Helper()
+		c, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+			InsecureSkipVerify: true,
+		})
+		if err != nil {
+			t.Fatalf("cannot connect to TLS server: %s", err)
+		}
+		defer func() {
+			_ = c.Close()
+		}()
+		certs := c.ConnectionState().PeerCertificates
+		if len(certs) == 0 {
+			t.Fatalf("missing server certificate")
+		}
+		if cn := certs[0].Subject.CommonName; cn != cnExpected {
+			t.Fatalf("unexpected server certificate; got CN=%q; want CN=%q", cn, cnExpected)
+		}
+	}
+	f("first")
+
+	// New connections must use the rotated cert.
+	certPEM, keyPEM = testGenerateCert(t, "second-cert")
+	writeFile(certFile, certPEM)
+	writeFile(keyFile, keyPEM)
+	f("second-cert")
+
+	// The previous cert must be used while the key file isn't updated yet.
+	certPEM, keyPEM = testGenerateCert(t, "third")
+	writeFile(certFile, certPEM)
+	f("second-cert")
+	writeFile(keyFile, keyPEM)
+	f("third")
+
+	// The previous cert must be used if cert files are missing.
+	if err := os.Remove(certFile); err != nil {
+		t.Fatalf("cannot remove %q: %s", certFile, err)
+	}
+	f("third")
+}
+
+func testGenerateCert(t *testing.T, commonName string) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: commonName,
+		},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter:  time.Now().Add(time.Hour),
+		KeyUsage:  x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth,
+		},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("cannot create cert: %s", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("cannot marshal key: %s", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM
+}
@@ -29,6 +29,13 @@ type FastQueue struct {
 
 	pendingInmemoryBytes uint64
 
+	// maxInmemoryBytes is the maximum size of blocks in ch. It is unlimited if set to 0.
+	maxInmemoryBytes uint64
+
+	// spilledBlocks is incremented for each block written to pq, since readers didn't catch up with writers.
+	// It may be nil.
+	spilledBlocks *metrics.Counter
+
 	lastInmemoryBlockReadTime uint64
 
 	stopDeadline uint64
@@ -42,10 +49,20 @@ type FastQueue struct {
 // Otherwise its size is limited by maxPendingBytes. The oldest data is dropped when the queue
 // reaches maxPendingSize.
 func MustOpenFastQueue(path, name string, maxInmemoryBlocks, maxPendingBytes int) *FastQueue {
+	return MustOpenFastQueueWithMaxInmemoryBytes(path, name, maxInmemoryBlocks, 0, maxPendingBytes, nil)
+}
+
+// MustOpenFastQueueWithMaxInmemoryBytes works like MustOpenFastQueue, but it also limits the size of blocks held in memory by maxInmemoryBytes.
+//
+// The size of blocks held in memory is unlimited if maxInmemoryBytes is 0.
+// spilledBlocks is incremented for each block written to file, since readers didn't catch up with writers. It may be nil.
+func MustOpenFastQueueWithMaxInmemoryBytes(path, name string, maxInmemoryBlocks, maxInmemoryBytes, maxPendingBytes int, spilledBlocks *metrics.Counter) *FastQueue {
 	pq := mustOpen(path, name, maxPendingBytes)
 	fq := &FastQueue{
-		pq: pq,
-		ch: make(chan *bytesutil.ByteBuffer, maxInmemoryBlocks),
+		pq:               pq,
+		ch:               make(chan *bytesutil.ByteBuffer, maxInmemoryBlocks),
+		maxInmemoryBytes: uint64(maxInmemoryBytes),
+		spilledBlocks:    spilledBlocks,
 	}
 	fq.cond.L = &fq.mu
 	fq.lastInmemoryBlockReadTime = fasttime.UnixTimestamp()
@@ -105,6 +122,7 @@ func (fq *FastQueue) flushInmemoryBlocksToFileLocked() {
 	for len(fq.ch) > 0 {
 		bb := <-fq.ch
 		fq.pq.MustWriteBlock(bb.B)
+		fq.incSpilledBlocksLocked()
 		fq.pendingInmemoryBytes -= uint64(len(bb.B))
 		fq.lastInmemoryBlockReadTime = fasttime.UnixTimestamp()
 		blockBufPool.Put(bb)
@@ -113,6 +131,13 @@ func (fq *FastQueue) flushInmemoryBlocksToFileLocked() {
 	fq.cond.Broadcast()
 }
 
+func (fq *FastQueue) incSpilledBlocksLocked() {
+	// fq.mu must be locked by the caller.
+	if fq.spilledBlocks != nil {
+		fq.spilledBlocks.Inc()
+	}
+}
+
 // GetPendingBytes returns the number of pending bytes in the fq.
 func (fq *FastQueue) GetPendingBytes() uint64 {
 	fq.mu.Lock()
@@ -131,6 +156,14 @@ func (fq *FastQueue) GetInmemoryQueueLen() int {
 	return len(fq.ch)
 }
 
+// GetInmemoryQueueBytes returns the size of blocks in inmemory queue.
+func (fq *FastQueue) GetInmemoryQueueBytes() uint64 {
+	fq.mu.Lock()
+	defer fq.mu.Unlock()
+
+	return fq.pendingInmemoryBytes
+}
+
 // MustWriteBlock writes block to fq.
 func (fq *FastQueue) MustWriteBlock(block []byte) {
 	fq.mu.Lock()
@@ -144,12 +177,14 @@ func (fq *FastQueue) MustWriteBlock(block []byte) {
 			logger.Panicf("BUG: the in-memory queue must be empty when the file-based queue is non-empty; it contains %d pending bytes", n)
 		}
 		fq.pq.MustWriteBlock(block)
+		fq.incSpilledBlocksLocked()
 		return
 	}
-	if len(fq.ch) == cap(fq.ch) {
+	if len(fq.ch) == cap(fq.ch) || fq.maxInmemoryBytes > 0 && fq.pendingInmemoryBytes+uint64(len(block)) > fq.maxInmemoryBytes {
 		// There is no space in the in-memory queue. Put the data to file-based queue.
 		fq.flushInmemoryBlocksToFileLocked()
 		fq.pq.MustWriteBlock(block)
+		fq.incSpilledBlocksLocked()
 		return
 	}
 	// There is enough space in the in-memory queue.
@@ -165,12 +200,36 @@ func (fq *FastQueue) MustWriteBlock(block []byte) {
 
 // MustReadBlock reads the next block from fq to dst and returns it.
 func (fq *FastQueue) MustReadBlock(dst []byte) ([]byte, bool) {
+	dst, _, ok := fq.mustReadBlock(dst, false)
+	return dst, ok
+}
+
+// MustReadBlockForAck reads the next block from fq to dst and returns it together with blockID.
+//
+// The blockID must be passed to AckBlock after the block is processed, e.g. after it is sent to remote storage
+// or after it is written back to fq. The acknowledged blocks aren't read again after unclean shutdown.
+func (fq *FastQueue) MustReadBlockForAck(dst []byte) ([]byte, uint64, bool) {
+	return fq.mustReadBlock(dst, true)
+}
+
+// AckBlock acknowledges the block with the given blockID obtained via MustReadBlockForAck.
+func (fq *FastQueue) AckBlock(blockID uint64) {
+	if blockID == 0 {
+		// The block has been read from in-memory queue. There is no need in its acknowledgement.
+		return
+	}
+	fq.mu.Lock()
+	fq.pq.ackBlock(blockID)
+	fq.mu.Unlock()
+}
+
+func (fq *FastQueue) mustReadBlock(dst []byte, needAck bool) ([]byte, uint64, bool) {
 	fq.mu.Lock()
 	defer fq.mu.Unlock()
 
 	for {
 		if fq.stopDeadline > 0 && fasttime.UnixTimestamp() > fq.stopDeadline {
-			return dst, false
+			return dst, 0, false
 		}
 		if len(fq.ch) > 0 {
 			if n := fq.pq.GetPendingBytes(); n > 0 {
@@ -181,18 +240,25 @@ func (fq *FastQueue) MustReadBlock(dst []byte) ([]byte, bool) {
 			fq.lastInmemoryBlockReadTime = fasttime.UnixTimestamp()
 			dst = append(dst, bb.B...)
 			blockBufPool.Put(bb)
-			return dst, true
+			return dst, 0, true
 		}
 		if n := fq.pq.GetPendingBytes(); n > 0 {
-			data, ok := fq.pq.MustReadBlockNonblocking(dst)
+			var data []byte
+			var blockID uint64
+			var ok bool
+			if needAck {
+				data, blockID, ok = fq.pq.mustReadBlockNonblockingForAck(dst)
+			} else {
+				data, ok = fq.pq.MustReadBlockNonblocking(dst)
+			}
 			if ok {
-				return data, true
+				return data, blockID, true
 			}
 			dst = data
 			continue
 		}
 		if fq.stopDeadline > 0 {
-			return dst, false
+			return dst, 0, false
 		}
 		// There are no blocks. Wait for new block.
 		fq.pq.ResetIfEmpty()
@@ -278,3 +278,60 @@ func TestFastQueueReadWriteConcurrent(t *testing.T) {
 	fq.MustClose()
 	mustDeleteDir(path)
 }
+
+func TestFastQueueAckAfterUncleanShutdown(t *testing.T) {
+	path := "fast-queue-ack-after-unclean-shutdown"
+	mustDeleteDir(path)
+
+	// Zero capacity forces storing all the blocks in the file-based queue.
+	fq := MustOpenFastQueue(path, "foobar", 0, 0)
+	var blocks []string
+	for i := 0; i < 10; i++ {
+		block := fmt.Sprintf("block %d", i)
+		fq.MustWriteBlock([]byte(block))
+		blocks = append(blocks, block)
+	}
+
+	// Send and acknowledge the first 4 blocks. The 5th block is read, but isn't acknowledged,
+	// e.g. because vmagent crashes while sending it.
+	var sent []string
+	for i := 0; i < 4; i++ {
+		buf, blockID, ok := fq.MustReadBlockForAck(nil)
+		if !ok {
+			t.Fatalf("unexpected ok=false")
+		}
+		sent = append(sent, string(buf))
+		fq.AckBlock(blockID)
+	}
+	if _, _, ok := fq.MustReadBlockForAck(nil); !ok {
+		t.Fatalf("unexpected ok=false")
+	}
+
+	// Simulate unclean shutdown right after the acknowledgement.
+	fq.mu.Lock()
+	mustCloseQueueUnclean(fq.pq)
+	fq.mu.Unlock()
+
+	// Send the remaining blocks after the restart.
+	fq = MustOpenFastQueue(path, "foobar", 0, 0)
+	for fq.GetPendingBytes() > 0 {
+		buf, blockID, ok := fq.MustReadBlockForAck(nil)
+		if !ok {
+			t.Fatalf("unexpected ok=false")
+		}
+		sent = append(sent, string(buf))
+		fq.AckBlock(blockID)
+	}
+	fq.MustClose()
+	mustDeleteDir(path)
+
+	// Every block must be sent exactly once, while the unacknowledged block must be sent again after the restart.
+	if len(sent) != len(blocks) {
+		t.Fatalf("unexpected number of sent blocks; got %d; want %d; sent blocks: %q", len(sent), len(blocks), sent)
+	}
+	for i, block := range sent {
+		if block != blocks[i] {
+			t.Fatalf("unexpected block #%d sent; got %q; want %q", i, block, blocks[i])
+		}
+	}
+}
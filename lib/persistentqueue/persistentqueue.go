@@ -52,6 +52,21 @@ type queue struct {
 
 	lastMetainfoFlushTime uint64
 
+	// lastBlockOffset is the offset of the last block read via readBlock.
+	lastBlockOffset uint64
+
+	// inflightBlocks contains start offsets for blocks read via mustReadBlockNonblockingForAck,
+	// which aren't acknowledged yet.
+	//
+	// Reading is restarted from the smallest offset in inflightBlocks after unclean shutdown,
+	// so the blocks, which weren't acknowledged, are read again. See getAckedOffset.
+	inflightBlocks map[uint64]struct{}
+
+	// oldestChunkOffset is the offset of the oldest chunk file, which isn't removed yet.
+	//
+	// Chunk files are removed only after all the blocks in them are acknowledged.
+	oldestChunkOffset uint64
+
 	blocksDropped *metrics.Counter
 	bytesDropped  *metrics.Counter
 
@@ -70,6 +85,10 @@ func (q *queue) ResetIfEmpty() {
 		// The queue isn't empty.
 		return
 	}
+	if len(q.inflightBlocks) > 0 {
+		// The queue contains unacknowledged blocks, which must be read again after unclean shutdown.
+		return
+	}
 	if q.readerOffset < 16*1024*1024 {
 		// The file is too small to drop. Leave it as is in order to reduce filesystem load.
 		return
@@ -84,6 +103,10 @@ func (q *queue) mustResetFiles() {
 	q.reader.MustClose()
 	q.writer.MustClose()
 	fs.MustRemoveAll(q.readerPath)
+	// Remove chunk files with unacknowledged blocks. They cannot be read after the reset.
+	for offset := q.oldestChunkOffset; offset < q.readerOffset-q.readerOffset%q.chunkFileSize; offset += q.chunkFileSize {
+		fs.MustRemoveAll(q.chunkFilePath(offset))
+	}
 
 	q.writerOffset = 0
 	q.writerLocalOffset = 0
@@ -92,6 +115,8 @@ func (q *queue) mustResetFiles() {
 	q.readerOffset = 0
 	q.readerLocalOffset = 0
 
+	q.inflightBlocks = make(map[uint64]struct{})
+
 	q.writerPath = q.chunkFilePath(q.writerOffset)
 	w, err := filestream.Create(q.writerPath, false)
 	if err != nil {
@@ -105,6 +130,7 @@ func (q *queue) mustResetFiles() {
 		logger.Panicf("FATAL: cannot open chunk file %q: %s", q.readerPath, err)
 	}
 	q.reader = r
+	q.oldestChunkOffset = 0
 
 	if err := q.flushMetainfo(); err != nil {
 		logger.Panicf("FATAL: cannot flush metainfo: %s", err)
@@ -166,6 +192,7 @@ func tryOpeningQueue(path, name string, chunkFileSize, maxBlockSize, maxPendingB
 	q.maxPendingBytes = maxPendingBytes
 	q.dir = path
 	q.name = name
+	q.inflightBlocks = make(map[uint64]struct{})
 
 	q.blocksDropped = metrics.GetOrCreateCounter(fmt.Sprintf(`vm_persistentqueue_blocks_dropped_total{path=%q}`, path))
 	q.bytesDropped = metrics.GetOrCreateCounter(fmt.Sprintf(`vm_persistentqueue_bytes_dropped_total{path=%q}`, path))
@@ -271,6 +298,7 @@ func tryOpeningQueue(path, name string, chunkFileSize, maxBlockSize, maxPendingB
 			}
 			q.readerPath = filepath
 			q.readerOffset = mi.ReaderOffset
+			q.oldestChunkOffset = offset
 			q.readerLocalOffset = mi.ReaderOffset % q.chunkFileSize
 			if fileSize := fs.MustFileSize(q.readerPath); fileSize < q.readerLocalOffset {
 				logger.Errorf("chunk file %q size is too small for the given reader offset; file size %d bytes; reader offset: %d bytes; removing the file",
@@ -386,7 +414,7 @@ func (q *queue) MustWriteBlock(block []byte) {
 		bb := blockBufPool.Get()
 		for q.writerOffset-q.readerOffset > maxPendingBytes {
 			var err error
-			bb.B, err = q.readBlock(bb.B[:0])
+			bb.B, err = q.readBlock(bb.B[:0], false)
 			if err == errEmptyQueue {
 				break
 			}
@@ -468,6 +496,10 @@ func (q *queue) nextChunkFileForWrite() error {
 //
 // false is returned if q is empty.
 func (q *queue) MustReadBlockNonblocking(dst []byte) ([]byte, bool) {
+	return q.mustReadBlockNonblocking(dst, false)
+}
+
+func (q *queue) mustReadBlockNonblocking(dst []byte, forAck bool) ([]byte, bool) {
 	if q.readerOffset > q.writerOffset {
 		logger.Panicf("BUG: readerOffset=%d cannot exceed writerOffset=%d", q.readerOffset, q.writerOffset)
 	}
@@ -475,7 +507,7 @@ func (q *queue) MustReadBlockNonblocking(dst []byte) ([]byte, bool) {
 		return dst, false
 	}
 	var err error
-	dst, err = q.readBlock(dst)
+	dst, err = q.readBlock(dst, forAck)
 	if err != nil {
 		if err == errEmptyQueue {
 			return dst, false
@@ -485,7 +517,66 @@ func (q *queue) MustReadBlockNonblocking(dst []byte) ([]byte, bool) {
 	return dst, true
 }
 
-func (q *queue) readBlock(dst []byte) ([]byte, error) {
+// mustReadBlockNonblockingForAck works like MustReadBlockNonblocking, but it also returns blockID for the read block.
+//
+// The blockID must be passed to ackBlock after the block is processed.
+// The acknowledged blocks aren't read again after unclean shutdown.
+func (q *queue) mustReadBlockNonblockingForAck(dst []byte) ([]byte, uint64, bool) {
+	dst, ok := q.mustReadBlockNonblocking(dst, true)
+	if !ok {
+		return dst, 0, false
+	}
+	// Block ids start from 1, since zero blockID means there is no need in acknowledgement.
+	return dst, q.lastBlockOffset + 1, true
+}
+
+// ackBlock acknowledges the block with the given blockID obtained via mustReadBlockNonblockingForAck.
+func (q *queue) ackBlock(blockID uint64) {
+	offset := blockID - 1
+	if _, ok := q.inflightBlocks[offset]; !ok {
+		// The block has been already acknowledged or the queue has been reset since the block has been read.
+		return
+	}
+	ackedOffsetPrev := q.getAckedOffset()
+	delete(q.inflightBlocks, offset)
+	q.removeAckedChunkFiles()
+	if q.getAckedOffset() == ackedOffsetPrev {
+		// Older blocks aren't acknowledged yet, so the offset to restart reading from after unclean shutdown doesn't change.
+		return
+	}
+	// Persist the new offset before returning, so the acknowledged blocks aren't read again after unclean shutdown.
+	if err := q.flushMetainfo(); err != nil {
+		logger.Panicf("FATAL: cannot flush metainfo: %s", err)
+	}
+}
+
+// getAckedOffset returns the offset, which all the acknowledged blocks end before.
+//
+// Blocks read via MustReadBlockNonblocking are considered acknowledged.
+func (q *queue) getAckedOffset() uint64 {
+	ackedOffset := q.readerOffset
+	for offset := range q.inflightBlocks {
+		if offset < ackedOffset {
+			ackedOffset = offset
+		}
+	}
+	return ackedOffset
+}
+
+// removeAckedChunkFiles removes chunk files, which contain only acknowledged blocks.
+func (q *queue) removeAckedChunkFiles() {
+	ackedOffset := q.getAckedOffset()
+	readerChunkOffset := q.readerOffset - q.readerOffset%q.chunkFileSize
+	for q.oldestChunkOffset < readerChunkOffset && q.oldestChunkOffset+q.chunkFileSize <= ackedOffset {
+		fs.MustRemoveAll(q.chunkFilePath(q.oldestChunkOffset))
+		q.oldestChunkOffset += q.chunkFileSize
+	}
+}
+
+// readBlock appends the next block from q to dst and returns the result.
+//
+// The block is registered in q.inflightBlocks if forAck is set.
+func (q *queue) readBlock(dst []byte, forAck bool) ([]byte, error) {
 	startTime := time.Now()
 	defer func() {
 		readDurationSeconds.Add(time.Since(startTime).Seconds())
@@ -497,6 +588,8 @@ func (q *queue) readBlock(dst []byte) ([]byte, error) {
 	}
 
 again:
+	q.lastBlockOffset = q.readerOffset
+
 	// Read block len.
 	header := headerBufPool.Get()
 	header.B = bytesutil.ResizeNoCopyMayOverallocate(header.B, 8)
@@ -530,6 +623,10 @@ again:
 	}
 	q.blocksRead.Inc()
 	q.bytesRead.Add(int(blockLen))
+	if forAck {
+		// Register the block before flushing metainfo, so it is read again after unclean shutdown until it is acknowledged.
+		q.inflightBlocks[q.lastBlockOffset] = struct{}{}
+	}
 	if err := q.flushReaderMetainfoIfNeeded(); err != nil {
 		return dst, err
 	}
@@ -552,15 +649,15 @@ func (q *queue) skipBrokenChunkFile() error {
 var errEmptyQueue = fmt.Errorf("the queue is empty")
 
 func (q *queue) nextChunkFileForRead() error {
-	// Remove the current chunk and go to the next chunk.
+	// Go to the next chunk. The current chunk is removed after all the blocks in it are acknowledged.
 	q.reader.MustClose()
-	fs.MustRemoveAll(q.readerPath)
 	if n := q.readerOffset % q.chunkFileSize; n > 0 {
 		q.readerOffset += q.chunkFileSize - n
 	}
 	if err := q.checkReaderWriterOffsets(); err != nil {
 		return err
 	}
+	q.removeAckedChunkFiles()
 	q.readerLocalOffset = 0
 	q.readerPath = q.chunkFilePath(q.readerOffset)
 	r, err := filestream.Open(q.readerPath, true)
@@ -643,7 +740,8 @@ func (q *queue) flushWriterMetainfoIfNeeded() error {
 func (q *queue) flushMetainfo() error {
 	mi := &metainfo{
 		Name:         q.name,
-		ReaderOffset: q.readerOffset,
+		// Store the offset for the oldest unacknowledged block, so reading is restarted from it after unclean shutdown.
+		ReaderOffset: q.getAckedOffset(),
 		WriterOffset: q.writerOffset,
 	}
 	metainfoPath := q.metainfoPath()
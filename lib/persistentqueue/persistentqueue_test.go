@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"strconv"
 	"testing"
 )
@@ -396,3 +397,81 @@ func mustCreateEmptyMetainfo(path, name string) {
 		panic(fmt.Errorf("cannot create metainfo: %w", err))
 	}
 }
+
+func TestQueueAckAfterUncleanShutdown(t *testing.T) {
+	f := func(chunkFileSize uint64, blocksToRead int, blocksToAck []int, blocksExpected []int) {
+		t.Helper()
+		path := "queue-ack-after-unclean-shutdown"
+		mustDeleteDir(path)
+		defer mustDeleteDir(path)
+
+		var blocks []string
+		q := mustOpenInternal(path, "foobar", chunkFileSize, 16, 0)
+		for i := 0; i < 10; i++ {
+			block := fmt.Sprintf("block %d", i)
+			q.MustWriteBlock([]byte(block))
+			blocks = append(blocks, block)
+		}
+		q.MustClose()
+
+		q = mustOpenInternal(path, "foobar", chunkFileSize, 16, 0)
+		var blockIDs []uint64
+		for i := 0; i < blocksToRead; i++ {
+			buf, blockID, ok := q.mustReadBlockNonblockingForAck(nil)
+			if !ok {
+				t.Fatalf("unexpected ok=false returned from mustReadBlockNonblockingForAck")
+			}
+			if string(buf) != blocks[i] {
+				t.Fatalf("unexpected block read; got %q; want %q", buf, blocks[i])
+			}
+			if blockID == 0 {
+				t.Fatalf("blockID mustn't be zero")
+			}
+			blockIDs = append(blockIDs, blockID)
+		}
+		for _, n := range blocksToAck {
+			q.ackBlock(blockIDs[n])
+		}
+		// Simulate unclean shutdown right after the acknowledgement.
+		mustCloseQueueUnclean(q)
+
+		// The acknowledged blocks mustn't be read again, while the unacknowledged blocks must be read again.
+		q = mustOpenInternal(path, "foobar", chunkFileSize, 16, 0)
+		var blocksRead []string
+		for {
+			buf, ok := q.MustReadBlockNonblocking(nil)
+			if !ok {
+				break
+			}
+			blocksRead = append(blocksRead, string(buf))
+		}
+		q.MustClose()
+		var want []string
+		for _, n := range blocksExpected {
+			want = append(want, blocks[n])
+		}
+		if !reflect.DeepEqual(blocksRead, want) {
+			t.Fatalf("unexpected blocks read after unclean shutdown;\ngot\n%q\nwant\n%q", blocksRead, want)
+		}
+	}
+
+	// All the read blocks are acknowledged in out-of-order manner.
+	f(defaultChunkFileSize, 5, []int{1, 2, 0, 0, 4, 3}, []int{5, 6, 7, 8, 9})
+
+	// Unacknowledged blocks must be read again.
+	f(defaultChunkFileSize, 5, []int{1, 2, 0}, []int{3, 4, 5, 6, 7, 8, 9})
+	f(defaultChunkFileSize, 5, []int{1, 2, 3, 4}, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+
+	// The chunk file with unacknowledged blocks mustn't be removed when switching to the next chunk file.
+	f(64, 5, []int{1, 2, 3, 4}, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+	f(64, 5, []int{0, 1, 2, 4}, []int{3, 4, 5, 6, 7, 8, 9})
+	f(64, 5, []int{0, 1, 2, 3, 4}, []int{5, 6, 7, 8, 9})
+}
+
+func mustCloseQueueUnclean(q *queue) {
+	q.writer.MustClose()
+	q.reader.MustClose()
+	if err := q.flockF.Close(); err != nil {
+		panic(fmt.Errorf("cannot close flock file: %w", err))
+	}
+}
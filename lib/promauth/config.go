@@ -18,6 +18,7 @@ import (
 	xxhash "github.com/cespare/xxhash/v2"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/clientcredentials"
+	"gopkg.in/yaml.v2"
 )
 
 // Secret represents a string secret such as password or auth token.
@@ -78,6 +79,32 @@ type TLSConfig struct {
 	ServerName         string `yaml:"server_name,omitempty"`
 	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
 	MinVersion         string `yaml:"min_version,omitempty"`
+	MaxVersion         string `yaml:"max_version,omitempty"`
+}
+
+// MarshalYAML implements yaml.Marshaler interface.
+//
+// It hides the inline private key, since it is a secret.
+func (tlsConfig *TLSConfig) MarshalYAML() (interface{}, error) {
+	type tlsConfigNoMarshaler TLSConfig
+	tc := tlsConfigNoMarshaler(*tlsConfig)
+	if len(tc.Key) == 0 {
+		return &tc, nil
+	}
+	tc.Key = nil
+	data, err := yaml.Marshal(&tc)
+	if err != nil {
+		return nil, err
+	}
+	var ms yaml.MapSlice
+	if err := yaml.Unmarshal(data, &ms); err != nil {
+		return nil, err
+	}
+	ms = append(ms, yaml.MapItem{
+		Key:   "key",
+		Value: "<secret>",
+	})
+	return ms, nil
 }
 
 // String returns human-readable representation of tlsConfig
@@ -88,8 +115,34 @@ func (tlsConfig *TLSConfig) String() string {
 	caHash := xxhash.Sum64(tlsConfig.CA)
 	certHash := xxhash.Sum64(tlsConfig.Cert)
 	keyHash := xxhash.Sum64(tlsConfig.Key)
-	return fmt.Sprintf("hash(ca)=%d, ca_file=%q, hash(cert)=%d, cert_file=%q, hash(key)=%d, key_file=%q, server_name=%q, insecure_skip_verify=%v, min_version=%q",
-		caHash, tlsConfig.CAFile, certHash, tlsConfig.CertFile, keyHash, tlsConfig.KeyFile, tlsConfig.ServerName, tlsConfig.InsecureSkipVerify, tlsConfig.MinVersion)
+	return fmt.Sprintf("hash(ca)=%d, ca_file=%q, hash(cert)=%d, cert_file=%q, hash(key)=%d, key_file=%q, server_name=%q, insecure_skip_verify=%v, min_version=%q, max_version=%q",
+		caHash, tlsConfig.CAFile, certHash, tlsConfig.CertFile, keyHash, tlsConfig.KeyFile, tlsConfig.ServerName, tlsConfig.InsecureSkipVerify, tlsConfig.MinVersion, tlsConfig.MaxVersion)
+}
+
+// ParseVersions returns TLS versions for tlsConfig.MinVersion and tlsConfig.MaxVersion.
+//
+// Zero is returned for unset versions. An error is returned on unsupported versions or if MinVersion exceeds MaxVersion.
+func (tlsConfig *TLSConfig) ParseVersions() (uint16, uint16, error) {
+	minVersion := uint16(0)
+	if tlsConfig.MinVersion != "" {
+		v, err := parseTLSVersion(tlsConfig.MinVersion)
+		if err != nil {
+			return 0, 0, fmt.Errorf("cannot parse `min_version`: %w", err)
+		}
+		minVersion = v
+	}
+	maxVersion := uint16(0)
+	if tlsConfig.MaxVersion != "" {
+		v, err := parseTLSVersion(tlsConfig.MaxVersion)
+		if err != nil {
+			return 0, 0, fmt.Errorf("cannot parse `max_version`: %w", err)
+		}
+		maxVersion = v
+	}
+	if minVersion != 0 && maxVersion != 0 && minVersion > maxVersion {
+		return 0, 0, fmt.Errorf("`min_version`=%q cannot exceed `max_version`=%q", tlsConfig.MinVersion, tlsConfig.MaxVersion)
+	}
+	return minVersion, maxVersion, nil
 }
 
 // Authorization represents generic authorization config.
@@ -248,10 +301,14 @@ type Config struct {
 	TLSServerName         string
 	TLSInsecureSkipVerify bool
 	TLSMinVersion         uint16
+	TLSMaxVersion         uint16
 
 	getTLSCert    func(*tls.CertificateRequestInfo) (*tls.Certificate, error)
 	tlsCertDigest string
 
+	// tlsRootCAFile is set if root CA is loaded from local `ca_file`, which may change over time.
+	tlsRootCAFile *rootCAFile
+
 	getAuthHeader      func() string
 	authHeaderLock     sync.Mutex
 	authHeader         string
@@ -281,8 +338,8 @@ func (ac *Config) GetAuthHeader() string {
 // It is also used for comparing Config objects for equality. If two Config
 // objects have the same string representation, then they are considered equal.
 func (ac *Config) String() string {
-	return fmt.Sprintf("AuthDigest=%s, TLSRootCA=%s, TLSCertificate=%s, TLSServerName=%s, TLSInsecureSkipVerify=%v, TLSMinVersion=%d",
-		ac.authDigest, ac.tlsRootCAString(), ac.tlsCertDigest, ac.TLSServerName, ac.TLSInsecureSkipVerify, ac.TLSMinVersion)
+	return fmt.Sprintf("AuthDigest=%s, TLSRootCA=%s, TLSCertificate=%s, TLSServerName=%s, TLSInsecureSkipVerify=%v, TLSMinVersion=%d, TLSMaxVersion=%d",
+		ac.authDigest, ac.tlsRootCAString(), ac.tlsCertDigest, ac.TLSServerName, ac.TLSInsecureSkipVerify, ac.TLSMinVersion, ac.TLSMaxVersion)
 }
 
 func (ac *Config) tlsRootCAString() string {
@@ -293,6 +350,17 @@ func (ac *Config) tlsRootCAString() string {
 	return string(bytes.Join(data, []byte("\n")))
 }
 
+// getTLSRootCA returns the current root CA for ac.
+func (ac *Config) getTLSRootCA() *x509.CertPool {
+	if ac == nil {
+		return nil
+	}
+	if ac.tlsRootCAFile != nil {
+		return ac.tlsRootCAFile.getPool()
+	}
+	return ac.TLSRootCA
+}
+
 // NewTLSConfig returns new TLS config for the given ac.
 func (ac *Config) NewTLSConfig() *tls.Config {
 	tlsCfg := &tls.Config{
@@ -321,10 +389,11 @@ func (ac *Config) NewTLSConfig() *tls.Config {
 			return cert, nil
 		}
 	}
-	tlsCfg.RootCAs = ac.TLSRootCA
+	tlsCfg.RootCAs = ac.getTLSRootCA()
 	tlsCfg.ServerName = ac.TLSServerName
 	tlsCfg.InsecureSkipVerify = ac.TLSInsecureSkipVerify
 	tlsCfg.MinVersion = ac.TLSMinVersion
+	tlsCfg.MaxVersion = ac.TLSMaxVersion
 	return tlsCfg
 }
 
@@ -458,11 +527,13 @@ func NewConfig(baseDir string, az *Authorization, basicAuth *BasicAuthConfig, be
 		authDigest = fmt.Sprintf("oauth2(%s)", o.String())
 	}
 	var tlsRootCA *x509.CertPool
+	var tlsRootCAFile *rootCAFile
 	var getTLSCert func(*tls.CertificateRequestInfo) (*tls.Certificate, error)
 	tlsCertDigest := ""
 	tlsServerName := ""
 	tlsInsecureSkipVerify := false
 	tlsMinVersion := uint16(0)
+	tlsMaxVersion := uint16(0)
 	if tlsConfig != nil {
 		tlsServerName = tlsConfig.ServerName
 		tlsInsecureSkipVerify = tlsConfig.InsecureSkipVerify
@@ -498,6 +569,14 @@ func NewConfig(baseDir string, az *Authorization, basicAuth *BasicAuthConfig, be
 			if !tlsRootCA.AppendCertsFromPEM(tlsConfig.CA) {
 				return nil, fmt.Errorf("cannot parse data from `ca` value")
 			}
+		} else if tlsConfig.CAFile != "" && !isHTTPURL(tlsConfig.CAFile) {
+			path := fs.GetFilepath(baseDir, tlsConfig.CAFile)
+			rf, err := newRootCAFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("cannot load `ca_file` %q: %w", tlsConfig.CAFile, err)
+			}
+			tlsRootCA = rf.pool
+			tlsRootCAFile = rf
 		} else if tlsConfig.CAFile != "" {
 			path := fs.GetFilepath(baseDir, tlsConfig.CAFile)
 			data, err := fs.ReadFileOrHTTP(path)
@@ -509,22 +588,23 @@ func NewConfig(baseDir string, az *Authorization, basicAuth *BasicAuthConfig, be
 				return nil, fmt.Errorf("cannot parse data from `ca_file` %q", tlsConfig.CAFile)
 			}
 		}
-		if tlsConfig.MinVersion != "" {
-			v, err := parseTLSVersion(tlsConfig.MinVersion)
-			if err != nil {
-				return nil, fmt.Errorf("cannot parse `min_version`: %w", err)
-			}
-			tlsMinVersion = v
+		minVersion, maxVersion, err := tlsConfig.ParseVersions()
+		if err != nil {
+			return nil, err
 		}
+		tlsMinVersion = minVersion
+		tlsMaxVersion = maxVersion
 	}
 	ac := &Config{
 		TLSRootCA:             tlsRootCA,
 		TLSServerName:         tlsServerName,
 		TLSInsecureSkipVerify: tlsInsecureSkipVerify,
 		TLSMinVersion:         tlsMinVersion,
+		TLSMaxVersion:         tlsMaxVersion,
 
 		getTLSCert:    getTLSCert,
 		tlsCertDigest: tlsCertDigest,
+		tlsRootCAFile: tlsRootCAFile,
 
 		getAuthHeader: getAuthHeader,
 		authDigest:    authDigest,
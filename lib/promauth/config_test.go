@@ -1,9 +1,15 @@
 package promauth
 
 import (
+	"crypto/tls"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"gopkg.in/yaml.v2"
 )
 
 func TestNewConfig(t *testing.T) {
@@ -131,3 +137,129 @@ func TestNewConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestNewTLSConfigVersions(t *testing.T) {
+	f := func(minVersion, maxVersion string, minVersionExpected, maxVersionExpected uint16) {
+		t.Helper()
+		tlsConfig := &TLSConfig{
+			MinVersion: minVersion,
+			MaxVersion: maxVersion,
+		}
+		ac, err := NewConfig(".", nil, nil, "", "", nil, tlsConfig)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		tlsCfg := ac.NewTLSConfig()
+		if tlsCfg.MinVersion != minVersionExpected {
+			t.Fatalf("unexpected MinVersion; got %d; want %d", tlsCfg.MinVersion, minVersionExpected)
+		}
+		if tlsCfg.MaxVersion != maxVersionExpected {
+			t.Fatalf("unexpected MaxVersion; got %d; want %d", tlsCfg.MaxVersion, maxVersionExpected)
+		}
+	}
+	f("", "", 0, 0)
+	f("TLS13", "", tls.VersionTLS13, 0)
+	f("", "TLS12", 0, tls.VersionTLS12)
+	f("tls12", "TLS13", tls.VersionTLS12, tls.VersionTLS13)
+	f("TLS13", "TLS13", tls.VersionTLS13, tls.VersionTLS13)
+}
+
+func TestNewTLSConfigVersionsFailure(t *testing.T) {
+	f := func(minVersion, maxVersion string) {
+		t.Helper()
+		tlsConfig := &TLSConfig{
+			MinVersion: minVersion,
+			MaxVersion: maxVersion,
+		}
+		ac, err := NewConfig(".", nil, nil, "", "", nil, tlsConfig)
+		if err == nil {
+			t.Fatalf("expecting non-nil error for min_version=%q, max_version=%q", minVersion, maxVersion)
+		}
+		if ac != nil {
+			t.Fatalf("expecting nil config on error")
+		}
+	}
+	f("TLS14", "")
+	f("", "SSL30")
+	f("1.3", "")
+	f("TLS13", "TLS12")
+}
+
+func TestConfigGetAuthHeaderFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	writeFile := func(data string) {
+		t.Helper()
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatalf("cannot write %q: %s", path, err)
+		}
+	}
+	f := func(ac *Config, data, headerExpected string) {
+		t.Helper()
+		writeFile(data)
+		// Simulate expiration for the cached auth header.
+		ac.authHeaderDeadline = 0
+		if ah := ac.GetAuthHeader(); ah != headerExpected {
+			t.Fatalf("unexpected auth header; got %q; want %q", ah, headerExpected)
+		}
+	}
+
+	writeFile("token-1")
+	ac, err := NewConfig(".", nil, nil, "", path, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f(ac, "token-1\n", "Bearer token-1")
+	f(ac, "token-2\n", "Bearer token-2")
+
+	ac, err = NewConfig(".", &Authorization{CredentialsFile: path}, nil, "", "", nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f(ac, "creds-1", "Bearer creds-1")
+	f(ac, "creds-2", "Bearer creds-2")
+
+	// The auth header must be cached for a short duration in order to avoid reading the file on every request.
+	writeFile("token-3")
+	ac, err = NewConfig(".", nil, nil, "", path, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ah := ac.GetAuthHeader(); ah != "Bearer token-3" {
+		t.Fatalf("unexpected auth header; got %q; want %q", ah, "Bearer token-3")
+	}
+	writeFile("token-4")
+	if ah := ac.GetAuthHeader(); ah != "Bearer token-3" {
+		t.Fatalf("unexpected cached auth header; got %q; want %q", ah, "Bearer token-3")
+	}
+}
+
+func TestTLSConfigMarshalYAML(t *testing.T) {
+	f := func(tlsConfig *TLSConfig, resultExpected string) {
+		t.Helper()
+		data, err := yaml.Marshal(tlsConfig)
+		if err != nil {
+			t.Fatalf("cannot marshal tlsConfig: %s", err)
+		}
+		result := strings.TrimSpace(string(data))
+		if result != resultExpected {
+			t.Fatalf("unexpected result;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+	f(&TLSConfig{}, "{}")
+	f(&TLSConfig{
+		CertFile:   "/path/to/cert",
+		KeyFile:    "/path/to/key",
+		ServerName: "foo",
+	}, `cert_file: /path/to/cert
+key_file: /path/to/key
+server_name: foo`)
+
+	// The inline key must be hidden
+	f(&TLSConfig{
+		CertFile:           "/path/to/cert",
+		Key:                []byte("private key"),
+		InsecureSkipVerify: true,
+	}, `cert_file: /path/to/cert
+insecure_skip_verify: true
+key: <secret>`)
+}
@@ -0,0 +1,143 @@
+package promauth
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// rootCAFile holds root CA loaded from the file at path.
+//
+// The file is re-read when its modification time or size changes.
+// This allows rotating CA without restart. For example, Kubernetes may rotate API server CA.
+type rootCAFile struct {
+	path string
+
+	mu      sync.Mutex
+	pool    *x509.CertPool
+	modTime time.Time
+	size    int64
+
+	// checkDeadline is the unix timestamp in seconds until the file isn't checked for changes.
+	checkDeadline uint64
+}
+
+func newRootCAFile(path string) (*rootCAFile, error) {
+	rf := &rootCAFile{
+		path: path,
+	}
+	if err := rf.reloadIfNeeded(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// getPool returns the root CA pool from rf.
+//
+// The file is checked for changes at most once per second. The previously loaded pool is returned if the file cannot be loaded.
+func (rf *rootCAFile) getPool() *x509.CertPool {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if fasttime.UnixTimestamp() < rf.checkDeadline {
+		return rf.pool
+	}
+	if err := rf.reloadIfNeededLocked(); err != nil {
+		logger.Errorf("cannot reload `ca_file`; continue using the previously loaded CA: %s", err)
+	}
+	rf.checkDeadline = fasttime.UnixTimestamp() + 1
+	return rf.pool
+}
+
+func (rf *rootCAFile) reloadIfNeeded() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.reloadIfNeededLocked()
+}
+
+func (rf *rootCAFile) reloadIfNeededLocked() error {
+	fi, err := os.Stat(rf.path)
+	if err != nil {
+		return fmt.Errorf("cannot stat %q: %w", rf.path, err)
+	}
+	if rf.pool != nil && fi.ModTime().Equal(rf.modTime) && fi.Size() == rf.size {
+		return nil
+	}
+	data, err := ioutil.ReadFile(rf.path)
+	if err != nil {
+		return fmt.Errorf("cannot read %q: %w", rf.path, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return fmt.Errorf("cannot parse data from %q", rf.path)
+	}
+	rf.pool = pool
+	rf.modTime = fi.ModTime()
+	rf.size = fi.Size()
+	return nil
+}
+
+// NewRoundTripper returns http.RoundTripper for the given ac, which uses trBase as a base transport.
+//
+// trBase.TLSClientConfig is ignored. The TLS config is created via ac.NewTLSConfig.
+// The underlying transport is re-created with the updated TLS config when `ca_file` changes,
+// so new connections use the updated root CA without restart.
+func (ac *Config) NewRoundTripper(trBase *http.Transport) http.RoundTripper {
+	return &roundTripper{
+		ac:     ac,
+		trBase: trBase,
+	}
+}
+
+type roundTripper struct {
+	ac     *Config
+	trBase *http.Transport
+
+	mu     sync.Mutex
+	tr     *http.Transport
+	rootCA *x509.CertPool
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return rt.getTransport().RoundTrip(req)
+}
+
+// CloseIdleConnections closes idle connections for rt.
+//
+// It is called by http.Client.CloseIdleConnections.
+func (rt *roundTripper) CloseIdleConnections() {
+	rt.mu.Lock()
+	tr := rt.tr
+	rt.mu.Unlock()
+	if tr != nil {
+		tr.CloseIdleConnections()
+	}
+}
+
+func (rt *roundTripper) getTransport() *http.Transport {
+	rootCA := rt.ac.getTLSRootCA()
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.tr != nil && rootCA == rt.rootCA {
+		return rt.tr
+	}
+	tr := rt.trBase.Clone()
+	tr.TLSClientConfig = rt.ac.NewTLSConfig()
+	tr.TLSClientConfig.RootCAs = rootCA
+	if rt.tr != nil {
+		// Close idle connections established with the previous root CA.
+		rt.tr.CloseIdleConnections()
+	}
+	rt.tr = tr
+	rt.rootCA = rootCA
+	return tr
+}
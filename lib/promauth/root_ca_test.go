@@ -0,0 +1,144 @@
+package promauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRoundTripperRootCAFileRotation(t *testing.T) {
+	cert1, ca1 := newTestSelfSignedCert(t)
+	cert2, ca2 := newTestSelfSignedCert(t)
+	s1 := newTestTLSServer(cert1)
+	defer s1.Close()
+	s2 := newTestTLSServer(cert2)
+	defer s2.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	caFileModTime := time.Now()
+	writeCAFile := func(data []byte) {
+		t.Helper()
+		if err := ioutil.WriteFile(caFile, data, 0600); err != nil {
+			t.Fatalf("cannot write CA file: %s", err)
+		}
+		// Make sure the modification time changes, since it may have coarse resolution on some filesystems.
+		caFileModTime = caFileModTime.Add(time.Second)
+		if err := os.Chtimes(caFile, caFileModTime, caFileModTime); err != nil {
+			t.Fatalf("cannot update modification time for CA file: %s", err)
+		}
+	}
+	writeCAFile(ca1)
+
+	ac, err := NewConfig(".", nil, nil, "", "", nil, &TLSConfig{
+		CAFile: caFile,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	c := &http.Client{
+		Transport: ac.NewRoundTripper(&http.Transport{}),
+	}
+	f := func(serverURL string, okExpected bool) {
+		t.Helper()
+		resp, err := c.Get(serverURL)
+		if err != nil {
+			if okExpected {
+				t.Fatalf("unexpected error when querying %s: %s", serverURL, err)
+			}
+			return
+		}
+		_ = resp.Body.Close()
+		if !okExpected {
+			t.Fatalf("expecting non-nil error when querying %s", serverURL)
+		}
+	}
+	f(s1.URL, true)
+	f(s2.URL, false)
+
+	// Rotate the CA. Subsequent connections must use the new root CA.
+	writeCAFile(ca2)
+	ac.tlsRootCAFile.checkDeadline = 0
+	f(s2.URL, true)
+	f(s1.URL, false)
+
+	// The previously loaded root CA must be used if the updated CA file is invalid.
+	writeCAFile([]byte("invalid CA"))
+	ac.tlsRootCAFile.checkDeadline = 0
+	f(s2.URL, true)
+	f(s1.URL, false)
+}
+
+func TestNewConfigRootCAFileFailure(t *testing.T) {
+	dir := t.TempDir()
+	f := func(caFile string) {
+		t.Helper()
+		_, err := NewConfig(dir, nil, nil, "", "", nil, &TLSConfig{
+			CAFile: caFile,
+		})
+		if err == nil {
+			t.Fatalf("expecting non-nil error for ca_file=%q", caFile)
+		}
+	}
+	f("missing.crt")
+	invalidCAFile := filepath.Join(dir, "invalid.crt")
+	if err := ioutil.WriteFile(invalidCAFile, []byte("foobar"), 0600); err != nil {
+		t.Fatalf("cannot write CA file: %s", err)
+	}
+	f(invalidCAFile)
+}
+
+func newTestSelfSignedCert(t *testing.T) (tls.Certificate, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate key: %s", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("cannot create certificate: %s", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("cannot marshal key: %s", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("cannot load certificate: %s", err)
+	}
+	return cert, certPEM
+}
+
+func newTestTLSServer(cert tls.Certificate) *httptest.Server {
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	s.TLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+	s.StartTLS()
+	return s
+}
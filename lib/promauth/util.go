@@ -15,3 +15,7 @@ func readPasswordFromFile(path string) (string, error) {
 	pass := strings.TrimRightFunc(string(data), unicode.IsSpace)
 	return pass, nil
 }
+
+func isHTTPURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
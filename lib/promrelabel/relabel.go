@@ -5,10 +5,12 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/metrics"
 	xxhash "github.com/cespare/xxhash/v2"
 )
 
@@ -49,10 +51,11 @@ func (pcs *ParsedConfigs) Apply(labels []prompbmarshal.Label, labelsOffset int,
 		if relabelDebug {
 			inStr = labelsToString(labels[labelsOffset:])
 		}
-		for _, prc := range pcs.prcs {
+		for i, prc := range pcs.prcs {
 			tmp := prc.apply(labels, labelsOffset)
 			if len(tmp) == labelsOffset {
 				// All the labels have been removed.
+				incDropsCounter(prc.Action, i)
 				if pcs.relabelDebug {
 					logger.Infof("\nRelabel  In: %s\nRelabel Out: DROPPED - all labels removed", inStr)
 				}
@@ -83,6 +86,43 @@ func (pcs *ParsedConfigs) Apply(labels []prompbmarshal.Label, labelsOffset int,
 	return labels
 }
 
+// maxDropsRuleIndex is the maximum `rule_index` label value for vm_relabel_drops_total metric.
+//
+// Drops by rules with bigger indexes are counted with `rule_index="other"` in order to limit the number of time series for the metric.
+const maxDropsRuleIndex = 10
+
+type dropsCounterKey struct {
+	action    string
+	ruleIndex int
+}
+
+// dropsCounters contains *metrics.Counter values for dropsCounterKey keys.
+var dropsCounters sync.Map
+
+// incDropsCounter increments vm_relabel_drops_total metric for the relabeling rule with the given action and the given zero-based index,
+// which dropped the entry.
+func incDropsCounter(action string, ruleIndex int) {
+	// Rule indexes are reported starting from 1 in the same way as in error messages for `relabel_config`.
+	ruleIndex++
+	if ruleIndex > maxDropsRuleIndex {
+		ruleIndex = maxDropsRuleIndex + 1
+	}
+	key := dropsCounterKey{
+		action:    action,
+		ruleIndex: ruleIndex,
+	}
+	v, ok := dropsCounters.Load(key)
+	if !ok {
+		ruleIndexStr := strconv.Itoa(ruleIndex)
+		if ruleIndex > maxDropsRuleIndex {
+			ruleIndexStr = "other"
+		}
+		c := metrics.GetOrCreateCounter(fmt.Sprintf(`vm_relabel_drops_total{action=%q,rule_index=%q}`, action, ruleIndexStr))
+		v, _ = dropsCounters.LoadOrStore(key, c)
+	}
+	v.(*metrics.Counter).Inc()
+}
+
 func removeEmptyLabels(labels []prompbmarshal.Label, labelsOffset int) []prompbmarshal.Label {
 	src := labels[labelsOffset:]
 	needsRemoval := false
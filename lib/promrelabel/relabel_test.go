@@ -1,10 +1,13 @@
 package promrelabel
 
 import (
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/metrics"
 )
 
 func TestLabelsToString(t *testing.T) {
@@ -1639,6 +1642,95 @@ func TestApplyRelabelConfigs(t *testing.T) {
 	})
 }
 
+func TestApplyRelabelConfigsDropsCounter(t *testing.T) {
+	getDrops := func(action, ruleIndex string) uint64 {
+		return metrics.GetOrCreateCounter(fmt.Sprintf(`vm_relabel_drops_total{action=%q,rule_index=%q}`, action, ruleIndex)).Get()
+	}
+	f := func(config string, labels []prompbmarshal.Label, action, ruleIndex string) {
+		t.Helper()
+		pcs, err := ParseRelabelConfigsData([]byte(config), false)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", config, err)
+		}
+		dropsPrev := getDrops(action, ruleIndex)
+		result := pcs.Apply(labels, 0, false)
+		if len(result) != 0 {
+			t.Fatalf("expecting dropped labels; got %s", labelsToString(result))
+		}
+		if n := getDrops(action, ruleIndex) - dropsPrev; n != 1 {
+			t.Fatalf("unexpected increase for vm_relabel_drops_total{action=%q,rule_index=%q}; got %d; want 1", action, ruleIndex, n)
+		}
+	}
+	labels := []prompbmarshal.Label{
+		{
+			Name:  "__name__",
+			Value: "foo",
+		},
+		{
+			Name:  "job",
+			Value: "bar",
+		},
+	}
+	f(`
+- action: drop
+  source_labels: [job]
+  regex: bar
+`, labels, "drop", "1")
+	f(`
+- target_label: xxx
+  replacement: yyy
+- action: keep
+  source_labels: [job]
+  regex: baz
+`, labels, "keep", "2")
+	f(`
+- action: drop_metrics
+  regex: foo
+`, labels, "drop", "1")
+	f(`
+- action: labeldrop
+  regex: .+
+`, labels, "labeldrop", "1")
+	f(`
+- action: drop_if_equal
+  source_labels: [__name__, xxx]
+`, []prompbmarshal.Label{
+		{
+			Name:  "__name__",
+			Value: "foo",
+		},
+		{
+			Name:  "xxx",
+			Value: "foo",
+		},
+	}, "drop_if_equal", "1")
+
+	// Rules with big indexes are counted with rule_index="other"
+	var rules []string
+	for i := 0; i < maxDropsRuleIndex; i++ {
+		rules = append(rules, fmt.Sprintf("- target_label: label_%d\n  replacement: value_%d\n", i, i))
+	}
+	rules = append(rules, "- action: drop\n  source_labels: [job]\n")
+	f(strings.Join(rules, ""), labels, "drop", "other")
+
+	// Rules, which do not drop labels, mustn't increase the counter
+	pcs, err := ParseRelabelConfigsData([]byte(`
+- action: drop
+  source_labels: [job]
+  regex: baz
+`), false)
+	if err != nil {
+		t.Fatalf("cannot parse relabel configs: %s", err)
+	}
+	dropsPrev := getDrops("drop", "1")
+	if result := pcs.Apply(labels, 0, false); len(result) == 0 {
+		t.Fatalf("unexpected dropped labels")
+	}
+	if n := getDrops("drop", "1") - dropsPrev; n != 0 {
+		t.Fatalf("unexpected increase for vm_relabel_drops_total; got %d; want 0", n)
+	}
+}
+
 func TestFinalizeLabels(t *testing.T) {
 	f := func(labels, resultExpected []prompbmarshal.Label) {
 		t.Helper()
@@ -1,12 +1,15 @@
 package promscrape
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
@@ -15,6 +18,9 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/common"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/proxy"
 	"github.com/VictoriaMetrics/fasthttp"
 	"github.com/VictoriaMetrics/metrics"
@@ -22,7 +28,8 @@ import (
 
 var (
 	maxScrapeSize = flagutil.NewBytes("promscrape.maxScrapeSize", 16*1024*1024, "The maximum size of scrape response in bytes to process from Prometheus targets. "+
-		"Bigger responses are rejected")
+		"The limit is applied to the uncompressed response, so gzipped responses are rejected if their size after ungzipping exceeds the limit. "+
+		"Bigger responses are rejected. It is possible to set 'body_size_limit' individually per each 'scrape_config' section in '-promscrape.config' for fine grained control")
 	maxResponseHeadersSize = flagutil.NewBytes("promscrape.maxResponseHeadersSize", 4096, "The maximum size of http response headers from Prometheus scrape targets")
 	disableCompression     = flag.Bool("promscrape.disableCompression", false, "Whether to disable sending 'Accept-Encoding: gzip' request headers to all the scrape targets. "+
 		"This may reduce CPU usage on scrape targets at the cost of higher network bandwidth utilization. "+
@@ -31,11 +38,22 @@ var (
 		"This may be useful when targets has no support for HTTP keep-alive connection. "+
 		"It is possible to set 'disable_keepalive: true' individually per each 'scrape_config' section in '-promscrape.config' for fine grained control. "+
 		"Note that disabling HTTP keep-alive may increase load on both vmagent and scrape targets")
+	userAgent = flag.String("promscrape.userAgent", "vm_promscrape", "The User-Agent header to send to scrape targets. "+
+		"It is possible to override it individually per each 'scrape_config' section in '-promscrape.config' via 'headers' option")
 	streamParse = flag.Bool("promscrape.streamParse", false, "Whether to enable stream parsing for metrics obtained from scrape targets. This may be useful "+
 		"for reducing memory usage when millions of metrics are exposed per each scrape target. "+
 		"It is posible to set 'stream_parse: true' individually per each 'scrape_config' section in '-promscrape.config' for fine grained control")
 )
 
+// defaultAcceptHeader is sent to scrape targets if `scrape_protocols` isn't set.
+//
+// The following `Accept` header has been copied from Prometheus sources.
+// See https://github.com/prometheus/prometheus/blob/f9d21f10ecd2a343a381044f131ea4e46381ce09/scrape/scrape.go#L532 .
+// This is needed as a workaround for scraping stupid Java-based servers such as Spring Boot.
+// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/608 for details.
+// Do not bloat the `Accept` header with OpenMetrics shit, since it looks like dead standard now.
+const defaultAcceptHeader = "text/plain;version=0.0.4;q=1,*/*;q=0.1"
+
 type client struct {
 	// hc is the default client optimized for common case of scraping targets with moderate number of metrics.
 	hc *fasthttp.HostClient
@@ -45,7 +63,9 @@ type client struct {
 	sc *http.Client
 
 	scrapeURL               string
+	scrapeTimeout           time.Duration
 	scrapeTimeoutSecondsStr string
+	acceptHeader            string
 	host                    string
 	requestURI              string
 	getAuthHeader           func() string
@@ -53,12 +73,43 @@ type client struct {
 	denyRedirects           bool
 	disableCompression      bool
 	disableKeepAlive        bool
+
+	// maxScrapeSize is the maximum size of scrape response in bytes.
+	maxScrapeSize int
+
+	// hostLimiter limits the number of concurrent scrapes per targetHost.
+	// It is nil if -promscrape.maxConcurrentScrapesPerHost isn't set.
+	hostLimiter *hostConcurrencyLimiter
+	targetHost  string
+
+	// filePath is set to the path of the local file for `file://` scrape urls.
+	filePath string
+
+	// headers contains additional headers to send to scrape targets.
+	headers []prompbmarshal.Label
+
+	// responseHeaderLabels contains response header names with the corresponding label names sorted by label name.
+	responseHeaderLabels []prompbmarshal.Label
+
+	// headerLabels contains labels obtained from response headers during the last successful scrape.
+	headerLabels []prompbmarshal.Label
 }
 
 func newClient(sw *ScrapeWork) *client {
+	if strings.HasPrefix(sw.ScrapeURL, "file://") {
+		return &client{
+			scrapeURL:     sw.ScrapeURL,
+			maxScrapeSize: sw.getMaxScrapeSize(),
+			filePath:      strings.TrimPrefix(sw.ScrapeURL, "file://"),
+		}
+	}
 	var u fasthttp.URI
 	u.Update(sw.ScrapeURL)
 	host := string(u.Host())
+	targetHost := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		targetHost = h
+	}
 	requestURI := string(u.RequestURI())
 	isTLS := string(u.Scheme()) == "https"
 	var tlsCfg *tls.Config
@@ -95,16 +146,24 @@ func newClient(sw *ScrapeWork) *client {
 	if err != nil {
 		logger.Fatalf("cannot create dial func: %s", err)
 	}
+	acceptHeader := sw.AcceptHeader
+	if acceptHeader == "" {
+		acceptHeader = defaultAcceptHeader
+	}
+	idleConnTimeout := sw.IdleConnTimeout
+	if idleConnTimeout <= 0 {
+		idleConnTimeout = 2 * sw.ScrapeInterval
+	}
 	hc := &fasthttp.HostClient{
 		Addr:                         host,
 		Name:                         "vm_promscrape",
 		Dial:                         dialFunc,
 		IsTLS:                        isTLS,
 		TLSConfig:                    tlsCfg,
-		MaxIdleConnDuration:          2 * sw.ScrapeInterval,
+		MaxIdleConnDuration:          idleConnTimeout,
 		ReadTimeout:                  sw.ScrapeTimeout,
 		WriteTimeout:                 10 * time.Second,
-		MaxResponseBodySize:          maxScrapeSize.N,
+		MaxResponseBodySize:          sw.getMaxScrapeSize(),
 		MaxIdempotentRequestAttempts: 1,
 		ReadBufferSize:               maxResponseHeadersSize.N,
 	}
@@ -118,7 +177,7 @@ func newClient(sw *ScrapeWork) *client {
 			TLSClientConfig:        tlsCfg,
 			Proxy:                  proxyURLFunc,
 			TLSHandshakeTimeout:    10 * time.Second,
-			IdleConnTimeout:        2 * sw.ScrapeInterval,
+			IdleConnTimeout:        idleConnTimeout,
 			DisableCompression:     *disableCompression || sw.DisableCompression,
 			DisableKeepAlives:      *disableKeepAlive || sw.DisableKeepAlive,
 			DialContext:            statStdDial,
@@ -145,7 +204,9 @@ func newClient(sw *ScrapeWork) *client {
 		hc:                      hc,
 		sc:                      sc,
 		scrapeURL:               sw.ScrapeURL,
+		scrapeTimeout:           sw.ScrapeTimeout,
 		scrapeTimeoutSecondsStr: fmt.Sprintf("%.3f", sw.ScrapeTimeout.Seconds()),
+		acceptHeader:            acceptHeader,
 		host:                    host,
 		requestURI:              requestURI,
 		getAuthHeader:           sw.AuthConfig.GetAuthHeader,
@@ -153,23 +214,88 @@ func newClient(sw *ScrapeWork) *client {
 		denyRedirects:           sw.DenyRedirects,
 		disableCompression:      sw.DisableCompression,
 		disableKeepAlive:        sw.DisableKeepAlive,
+		maxScrapeSize:           sw.getMaxScrapeSize(),
+		hostLimiter:             getHostConcurrencyLimiter(),
+		targetHost:              targetHost,
+		headers:                 sw.Headers,
+		responseHeaderLabels:    newResponseHeaderLabels(sw.ResponseHeaderLabels),
+	}
+}
+
+// newResponseHeaderLabels returns labels with header names in Value for the given m, which maps header names to label names.
+func newResponseHeaderLabels(m map[string]string) []prompbmarshal.Label {
+	if len(m) == 0 {
+		return nil
+	}
+	labels := make([]prompbmarshal.Label, 0, len(m))
+	for header, label := range m {
+		labels = append(labels, prompbmarshal.Label{
+			Name:  label,
+			Value: header,
+		})
+	}
+	promrelabel.SortLabels(labels)
+	return labels
+}
+
+// GetResponseHeaderLabels returns labels obtained from response headers during the last successful scrape.
+//
+// The returned labels are valid until the next scrape.
+func (c *client) GetResponseHeaderLabels() []prompbmarshal.Label {
+	return c.headerLabels
+}
+
+func (c *client) updateHeaderLabels(getHeader func(name string) string) {
+	dst := c.headerLabels[:0]
+	for _, rhl := range c.responseHeaderLabels {
+		value := getHeader(rhl.Value)
+		if value == "" {
+			continue
+		}
+		dst = append(dst, prompbmarshal.Label{
+			Name:  rhl.Name,
+			Value: value,
+		})
+	}
+	c.headerLabels = dst
+}
+
+// acquireHostSlot waits for the scrape slot for c.targetHost during c.scrapeTimeout.
+//
+// releaseHostSlot must be called when the scrape is finished if nil error is returned.
+func (c *client) acquireHostSlot() error {
+	if c.hostLimiter == nil {
+		return nil
+	}
+	if !c.hostLimiter.acquire(c.targetHost, c.scrapeTimeout) {
+		return fmt.Errorf("cannot scrape %q: the scrape didn't start during scrape_timeout=%s because of -promscrape.maxConcurrentScrapesPerHost=%d limit for host %q",
+			c.scrapeURL, c.scrapeTimeout, c.hostLimiter.maxConcurrency, c.targetHost)
+	}
+	return nil
+}
+
+func (c *client) releaseHostSlot() {
+	if c.hostLimiter != nil {
+		c.hostLimiter.release(c.targetHost)
 	}
 }
 
 func (c *client) GetStreamReader() (*streamReader, error) {
+	if c.filePath != "" {
+		return c.getFileStreamReader()
+	}
+	if err := c.acquireHostSlot(); err != nil {
+		return nil, err
+	}
 	deadline := time.Now().Add(c.sc.Timeout)
 	ctx, cancel := context.WithDeadline(context.Background(), deadline)
 	req, err := http.NewRequestWithContext(ctx, "GET", c.scrapeURL, nil)
 	if err != nil {
 		cancel()
+		c.releaseHostSlot()
 		return nil, fmt.Errorf("cannot create request for %q: %w", c.scrapeURL, err)
 	}
-	// The following `Accept` header has been copied from Prometheus sources.
-	// See https://github.com/prometheus/prometheus/blob/f9d21f10ecd2a343a381044f131ea4e46381ce09/scrape/scrape.go#L532 .
-	// This is needed as a workaround for scraping stupid Java-based servers such as Spring Boot.
-	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/608 for details.
-	// Do not bloat the `Accept` header with OpenMetrics shit, since it looks like dead standard now.
-	req.Header.Set("Accept", "text/plain;version=0.0.4;q=1,*/*;q=0.1")
+	req.Header.Set("Accept", c.acceptHeader)
 	// Set X-Prometheus-Scrape-Timeout-Seconds like Prometheus does, since it is used by some exporters such as PushProx.
 	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/1179#issuecomment-813117162
 	req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", c.scrapeTimeoutSecondsStr)
@@ -179,9 +305,14 @@ func (c *client) GetStreamReader() (*streamReader, error) {
 	if ah := c.getProxyAuthHeader(); ah != "" {
 		req.Header.Set("Proxy-Authorization", ah)
 	}
+	req.Header.Set("User-Agent", *userAgent)
+	for _, h := range c.headers {
+		req.Header.Set(h.Name, h.Value)
+	}
 	resp, err := c.sc.Do(req)
 	if err != nil {
 		cancel()
+		c.releaseHostSlot()
 		return nil, fmt.Errorf("cannot scrape %q: %w", c.scrapeURL, err)
 	}
 	if resp.StatusCode != http.StatusOK {
@@ -189,15 +320,20 @@ func (c *client) GetStreamReader() (*streamReader, error) {
 		respBody, _ := ioutil.ReadAll(resp.Body)
 		_ = resp.Body.Close()
 		cancel()
+		c.releaseHostSlot()
 		return nil, fmt.Errorf("unexpected status code returned when scraping %q: %d; expecting %d; response body: %q",
 			c.scrapeURL, resp.StatusCode, http.StatusOK, respBody)
 	}
 	scrapesOK.Inc()
+	if len(c.responseHeaderLabels) > 0 {
+		c.updateHeaderLabels(resp.Header.Get)
+	}
 	return &streamReader{
 		r:           resp.Body,
 		cancel:      cancel,
 		scrapeURL:   c.scrapeURL,
-		maxBodySize: int64(c.hc.MaxResponseBodySize),
+		maxBodySize: int64(c.maxScrapeSize),
+		release:     c.releaseHostSlot,
 	}, nil
 }
 
@@ -211,16 +347,18 @@ func isStatusRedirect(statusCode int) bool {
 }
 
 func (c *client) ReadData(dst []byte) ([]byte, error) {
+	if c.filePath != "" {
+		return c.readFileData(dst)
+	}
+	if err := c.acquireHostSlot(); err != nil {
+		return dst, err
+	}
+	defer c.releaseHostSlot()
 	deadline := time.Now().Add(c.hc.ReadTimeout)
 	req := fasthttp.AcquireRequest()
 	req.SetRequestURI(c.requestURI)
 	req.Header.SetHost(c.host)
-	// The following `Accept` header has been copied from Prometheus sources.
-	// See https://github.com/prometheus/prometheus/blob/f9d21f10ecd2a343a381044f131ea4e46381ce09/scrape/scrape.go#L532 .
-	// This is needed as a workaround for scraping stupid Java-based servers such as Spring Boot.
-	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/608 for details.
-	// Do not bloat the `Accept` header with OpenMetrics shit, since it looks like dead standard now.
-	req.Header.Set("Accept", "text/plain;version=0.0.4;q=1,*/*;q=0.1")
+	req.Header.Set("Accept", c.acceptHeader)
 	// Set X-Prometheus-Scrape-Timeout-Seconds like Prometheus does, since it is used by some exporters such as PushProx.
 	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/1179#issuecomment-813117162
 	req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", c.scrapeTimeoutSecondsStr)
@@ -236,6 +374,10 @@ func (c *client) ReadData(dst []byte) ([]byte, error) {
 	if *disableKeepAlive || c.disableKeepAlive {
 		req.SetConnectionClose()
 	}
+	req.Header.SetUserAgent(*userAgent)
+	for _, h := range c.headers {
+		req.Header.Set(h.Name, h.Value)
+	}
 	resp := fasthttp.AcquireResponse()
 	swapResponseBodies := len(dst) == 0
 	if swapResponseBodies {
@@ -278,21 +420,24 @@ func (c *client) ReadData(dst []byte) ([]byte, error) {
 			return dst, fmt.Errorf("error when scraping %q with timeout %s: %w", c.scrapeURL, c.hc.ReadTimeout, err)
 		}
 		if err == fasthttp.ErrBodyTooLarge {
-			maxScrapeSizeExceeded.Inc()
-			return dst, fmt.Errorf("the response from %q exceeds -promscrape.maxScrapeSize=%d; "+
-				"either reduce the response size for the target or increase -promscrape.maxScrapeSize", c.scrapeURL, maxScrapeSize.N)
+			return dst, newMaxScrapeSizeError(c.scrapeURL, c.maxScrapeSize)
 		}
 		return dst, fmt.Errorf("error when scraping %q: %w", c.scrapeURL, err)
 	}
 	if ce := resp.Header.Peek("Content-Encoding"); string(ce) == "gzip" {
+		// The limit must be applied to the uncompressed response in the same way as in stream parsing mode.
 		var err error
 		if swapResponseBodies {
 			zb := gunzipBufPool.Get()
-			zb.B, err = fasthttp.AppendGunzipBytes(zb.B[:0], dst)
+			zb.B, err = appendGunzipBytes(zb.B[:0], dst, c.maxScrapeSize)
 			dst = append(dst[:0], zb.B...)
 			gunzipBufPool.Put(zb)
 		} else {
-			dst, err = fasthttp.AppendGunzipBytes(dst, resp.Body())
+			dst, err = appendGunzipBytes(dst, resp.Body(), c.maxScrapeSize)
+		}
+		if err == errMaxScrapeSizeExceeded {
+			fasthttp.ReleaseResponse(resp)
+			return dst, newMaxScrapeSizeError(c.scrapeURL, c.maxScrapeSize)
 		}
 		if err != nil {
 			fasthttp.ReleaseResponse(resp)
@@ -303,6 +448,11 @@ func (c *client) ReadData(dst []byte) ([]byte, error) {
 	} else if !swapResponseBodies {
 		dst = append(dst, resp.Body()...)
 	}
+	if statusCode == fasthttp.StatusOK && len(c.responseHeaderLabels) > 0 {
+		c.updateHeaderLabels(func(name string) string {
+			return string(resp.Header.Peek(name))
+		})
+	}
 	fasthttp.ReleaseResponse(resp)
 	if statusCode != fasthttp.StatusOK {
 		metrics.GetOrCreateCounter(fmt.Sprintf(`vm_promscrape_scrapes_total{status_code="%d"}`, statusCode)).Inc()
@@ -315,6 +465,37 @@ func (c *client) ReadData(dst []byte) ([]byte, error) {
 
 var gunzipBufPool bytesutil.ByteBufferPool
 
+// appendGunzipBytes appends ungzipped src to dst and returns the result.
+//
+// errMaxScrapeSizeExceeded is returned if the ungzipped src exceeds maxSize bytes.
+// Ungzipping stops as soon as maxSize is exceeded, so highly compressed responses cannot exhaust memory.
+func appendGunzipBytes(dst, src []byte, maxSize int) ([]byte, error) {
+	zr, err := common.GetGzipReader(bytes.NewReader(src))
+	if err != nil {
+		return dst, err
+	}
+	defer common.PutGzipReader(zr)
+	bb := bytes.NewBuffer(dst)
+	n, err := bb.ReadFrom(io.LimitReader(zr, int64(maxSize)+1))
+	dst = bb.Bytes()
+	if err != nil {
+		return dst, err
+	}
+	if n > int64(maxSize) {
+		return dst, errMaxScrapeSizeExceeded
+	}
+	return dst, nil
+}
+
+var errMaxScrapeSizeExceeded = errors.New("the maximum scrape size is exceeded")
+
+// newMaxScrapeSizeError returns an error for the response from scrapeURL, which exceeds maxScrapeSize bytes.
+func newMaxScrapeSizeError(scrapeURL string, maxScrapeSize int) error {
+	maxScrapeSizeExceeded.Inc()
+	return fmt.Errorf("the response from %q exceeds %d bytes; either reduce the response size for the target "+
+		"or increase `body_size_limit` in the corresponding `scrape_config` or -promscrape.maxScrapeSize command-line flag", scrapeURL, maxScrapeSize)
+}
+
 var (
 	maxScrapeSizeExceeded = metrics.NewCounter(`vm_promscrape_max_scrape_size_exceeded_errors_total`)
 	scrapesTimedout       = metrics.NewCounter(`vm_promscrape_scrapes_timed_out_total`)
@@ -322,6 +503,8 @@ var (
 	scrapesGunzipped      = metrics.NewCounter(`vm_promscrape_scrapes_gunziped_total`)
 	scrapesGunzipFailed   = metrics.NewCounter(`vm_promscrape_scrapes_gunzip_failed_total`)
 	scrapeRetries         = metrics.NewCounter(`vm_promscrape_scrape_retries_total`)
+	scrapesFileOK         = metrics.NewCounter(`vm_promscrape_file_scrapes_total`)
+	scrapesFileFailed     = metrics.NewCounter(`vm_promscrape_file_scrape_errors_total`)
 )
 
 func doRequestWithPossibleRetry(hc *fasthttp.HostClient, req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error {
@@ -356,15 +539,16 @@ type streamReader struct {
 	bytesRead   int64
 	scrapeURL   string
 	maxBodySize int64
+
+	// release is called when the reader is closed.
+	release func()
 }
 
 func (sr *streamReader) Read(p []byte) (int, error) {
 	n, err := sr.r.Read(p)
 	sr.bytesRead += int64(n)
 	if err == nil && sr.bytesRead > sr.maxBodySize {
-		maxScrapeSizeExceeded.Inc()
-		err = fmt.Errorf("the response from %q exceeds -promscrape.maxScrapeSize=%d; "+
-			"either reduce the response size for the target or increase -promscrape.maxScrapeSize", sr.scrapeURL, sr.maxBodySize)
+		err = newMaxScrapeSizeError(sr.scrapeURL, int(sr.maxBodySize))
 	}
 	return n, err
 }
@@ -374,4 +558,7 @@ func (sr *streamReader) MustClose() {
 	if err := sr.r.Close(); err != nil {
 		logger.Errorf("cannot close reader: %s", err)
 	}
+	if sr.release != nil {
+		sr.release()
+	}
 }
@@ -0,0 +1,440 @@
+package promscrape
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+func TestClientResponseHeaderLabels(t *testing.T) {
+	const data = "foo 123\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Prometheus-Version", "2.37.0")
+		w.Header().Set("X-Build-Hash", "abc123")
+		fmt.Fprintf(w, "%s", data)
+	}))
+	defer srv.Close()
+
+	c := newClient(&ScrapeWork{
+		ScrapeURL:       srv.URL + "/metrics",
+		ScrapeInterval:  time.Second,
+		ScrapeTimeout:   time.Second,
+		AuthConfig:      &promauth.Config{},
+		ProxyAuthConfig: &promauth.Config{},
+		ResponseHeaderLabels: map[string]string{
+			"X-Prometheus-Version": "version",
+			"x-build-hash":         "build_hash",
+			"X-Missing-Header":     "missing",
+		},
+	})
+	labelsExpected := []prompbmarshal.Label{
+		{
+			Name:  "build_hash",
+			Value: "abc123",
+		},
+		{
+			Name:  "version",
+			Value: "2.37.0",
+		},
+	}
+
+	// Read data in usual mode
+	result, err := c.ReadData(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(result) != data {
+		t.Fatalf("unexpected data read\ngot\n%s\nwant\n%s", result, data)
+	}
+	if labels := c.GetResponseHeaderLabels(); !reflect.DeepEqual(labels, labelsExpected) {
+		t.Fatalf("unexpected labels\ngot\n%v\nwant\n%v", labels, labelsExpected)
+	}
+
+	// Read data in stream mode
+	c.headerLabels = nil
+	sr, err := c.GetStreamReader()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	result, err = ioutil.ReadAll(sr)
+	sr.MustClose()
+	if err != nil {
+		t.Fatalf("unexpected error when reading stream: %s", err)
+	}
+	if string(result) != data {
+		t.Fatalf("unexpected stream data read\ngot\n%s\nwant\n%s", result, data)
+	}
+	if labels := c.GetResponseHeaderLabels(); !reflect.DeepEqual(labels, labelsExpected) {
+		t.Fatalf("unexpected labels in stream mode\ngot\n%v\nwant\n%v", labels, labelsExpected)
+	}
+}
+
+func TestClientIdleConnTimeout(t *testing.T) {
+	var connsMu sync.Mutex
+	conns := 0
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "foo 123\n")
+	}))
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connsMu.Lock()
+			conns++
+			connsMu.Unlock()
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	f := func(streamParse bool) {
+		t.Helper()
+		connsMu.Lock()
+		conns = 0
+		connsMu.Unlock()
+
+		c := newClient(&ScrapeWork{
+			ScrapeURL:       srv.URL + "/metrics",
+			ScrapeInterval:  time.Minute,
+			ScrapeTimeout:   time.Second,
+			IdleConnTimeout: 50 * time.Millisecond,
+			AuthConfig:      &promauth.Config{},
+			ProxyAuthConfig: &promauth.Config{},
+		})
+		scrape := func() {
+			t.Helper()
+			if streamParse {
+				sr, err := c.GetStreamReader()
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				_, err = ioutil.ReadAll(sr)
+				sr.MustClose()
+				if err != nil {
+					t.Fatalf("unexpected error when reading stream: %s", err)
+				}
+				return
+			}
+			if _, err := c.ReadData(nil); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+		expectConns := func(n int) {
+			t.Helper()
+			connsMu.Lock()
+			defer connsMu.Unlock()
+			if conns != n {
+				t.Fatalf("unexpected number of established connections; got %d; want %d", conns, n)
+			}
+		}
+
+		// The connection must be re-used within the idle timeout
+		scrape()
+		scrape()
+		expectConns(1)
+
+		// The connection must be re-established after the idle timeout
+		time.Sleep(300 * time.Millisecond)
+		scrape()
+		expectConns(2)
+	}
+
+	f(false)
+	f(true)
+}
+
+func TestClientAcceptHeader(t *testing.T) {
+	var acceptMu sync.Mutex
+	var accept string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptMu.Lock()
+		accept = r.Header.Get("Accept")
+		acceptMu.Unlock()
+		fmt.Fprintf(w, "foo 123\n")
+	}))
+	defer srv.Close()
+
+	f := func(scrapeProtocols []string, acceptExpected string) {
+		t.Helper()
+		acceptHeader, err := getAcceptHeader(scrapeProtocols)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		c := newClient(&ScrapeWork{
+			ScrapeURL:       srv.URL + "/metrics",
+			ScrapeInterval:  time.Second,
+			ScrapeTimeout:   time.Second,
+			AuthConfig:      &promauth.Config{},
+			ProxyAuthConfig: &promauth.Config{},
+			AcceptHeader:    acceptHeader,
+		})
+		expectAccept := func() {
+			t.Helper()
+			acceptMu.Lock()
+			defer acceptMu.Unlock()
+			if accept != acceptExpected {
+				t.Fatalf("unexpected Accept header\ngot\n%s\nwant\n%s", accept, acceptExpected)
+			}
+		}
+
+		// Read data in usual mode
+		if _, err := c.ReadData(nil); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		expectAccept()
+
+		// Read data in stream mode
+		sr, err := c.GetStreamReader()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		_, err = ioutil.ReadAll(sr)
+		sr.MustClose()
+		if err != nil {
+			t.Fatalf("unexpected error when reading stream: %s", err)
+		}
+		expectAccept()
+	}
+
+	f(nil, defaultAcceptHeader)
+	f([]string{"OpenMetricsText1.0.0", "PrometheusText0.0.4"},
+		"application/openmetrics-text;version=1.0.0;q=0.4,text/plain;version=0.0.4;q=0.3,*/*;q=0.2")
+}
+
+func TestClientMaxScrapeSize(t *testing.T) {
+	// The exporter streams up to bodySize bytes in chunks until the client stops reading the response.
+	const bodySize = 64 * 1024 * 1024
+	line := strings.Repeat("x", 99) + "\n"
+	bytesWrittenCh := make(chan int, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ww io.Writer = w
+		if r.URL.Query().Get("gzip") == "1" {
+			w.Header().Set("Content-Encoding", "gzip")
+			zw := gzip.NewWriter(w)
+			defer func() {
+				_ = zw.Close()
+			}()
+			ww = zw
+		}
+		n := 0
+		for n < bodySize {
+			if _, err := io.WriteString(ww, line); err != nil {
+				break
+			}
+			n += len(line)
+		}
+		select {
+		case bytesWrittenCh <- n:
+		default:
+		}
+	}))
+	defer srv.Close()
+
+	f := func(path string, maxScrapeSize int, streamParse bool) {
+		t.Helper()
+		for len(bytesWrittenCh) > 0 {
+			<-bytesWrittenCh
+		}
+		c := newClient(&ScrapeWork{
+			ScrapeURL:       srv.URL + path,
+			ScrapeInterval:  time.Second,
+			ScrapeTimeout:   10 * time.Second,
+			AuthConfig:      &promauth.Config{},
+			ProxyAuthConfig: &promauth.Config{},
+			MaxScrapeSize:   maxScrapeSize,
+		})
+		exceededBefore := maxScrapeSizeExceeded.Get()
+		if streamParse {
+			sr, err := c.GetStreamReader()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			_, err = ioutil.ReadAll(sr)
+			sr.MustClose()
+			if err == nil {
+				t.Fatalf("expecting non-nil error when reading the response bigger than %d bytes in stream mode", maxScrapeSize)
+			}
+		} else {
+			if _, err := c.ReadData(nil); err == nil {
+				t.Fatalf("expecting non-nil error when reading the response bigger than %d bytes", maxScrapeSize)
+			}
+		}
+		if n := maxScrapeSizeExceeded.Get() - exceededBefore; n != 1 {
+			t.Fatalf("unexpected number of max scrape size errors; got %d; want 1", n)
+		}
+		if path == "/metrics" {
+			// Verify the response reading is aborted before the whole response is sent by the exporter.
+			select {
+			case n := <-bytesWrittenCh:
+				if n >= bodySize {
+					t.Fatalf("the whole response with %d bytes is sent; the reading must be aborted after %d bytes", n, maxScrapeSize)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timeout when waiting for the exporter to stop sending the response")
+			}
+		}
+	}
+	f("/metrics", 10*1024, false)
+	f("/metrics", 10*1024, true)
+
+	// The limit is applied to uncompressed response.
+	f("/metrics?gzip=1", 10*1024, false)
+	f("/metrics?gzip=1", 10*1024, true)
+
+	// The response fits the limit.
+	srvSmall := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "foo 123\n")
+	}))
+	defer srvSmall.Close()
+	c := newClient(&ScrapeWork{
+		ScrapeURL:       srvSmall.URL + "/metrics",
+		ScrapeInterval:  time.Second,
+		ScrapeTimeout:   time.Second,
+		AuthConfig:      &promauth.Config{},
+		ProxyAuthConfig: &promauth.Config{},
+		MaxScrapeSize:   8,
+	})
+	result, err := c.ReadData(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(result) != "foo 123\n" {
+		t.Fatalf("unexpected data read; got %q; want %q", result, "foo 123\n")
+	}
+}
+
+func TestAppendGunzipBytes(t *testing.T) {
+	f := func(dataLen, maxSize int, errExpected error) {
+		t.Helper()
+		data := strings.Repeat("a", dataLen)
+		var bb bytes.Buffer
+		zw := gzip.NewWriter(&bb)
+		if _, err := zw.Write([]byte(data)); err != nil {
+			t.Fatalf("cannot compress data: %s", err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("cannot close gzip writer: %s", err)
+		}
+		dst, err := appendGunzipBytes([]byte("prefix"), bb.Bytes(), maxSize)
+		if err != errExpected {
+			t.Fatalf("unexpected error; got %v; want %v", err, errExpected)
+		}
+		if !strings.HasPrefix(string(dst), "prefix") {
+			t.Fatalf("missing prefix in the result")
+		}
+		if err != nil {
+			// Ungzipping must be stopped as soon as the limit is exceeded.
+			if n := len(dst) - len("prefix"); n > maxSize+1 {
+				t.Fatalf("too many bytes are ungzipped; got %d; want at most %d", n, maxSize+1)
+			}
+			return
+		}
+		if string(dst[len("prefix"):]) != data {
+			t.Fatalf("unexpected ungzipped data")
+		}
+	}
+	f(0, 0, nil)
+	f(1024, 1024, nil)
+	f(1025, 1024, errMaxScrapeSizeExceeded)
+	f(100*1024*1024, 1024, errMaxScrapeSizeExceeded)
+}
+
+func TestClientHeaders(t *testing.T) {
+	var headersMu sync.Mutex
+	var userAgentReceived, targetReceived string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headersMu.Lock()
+		userAgentReceived = r.Header.Get("User-Agent")
+		targetReceived = r.Header.Get("X-Target")
+		headersMu.Unlock()
+		fmt.Fprintf(w, "foo 123\n")
+	}))
+	defer srv.Close()
+
+	f := func(userAgentFlag string, headers []prompbmarshal.Label, userAgentExpected, targetExpected string) {
+		t.Helper()
+		prevUserAgent := *userAgent
+		*userAgent = userAgentFlag
+		defer func() {
+			*userAgent = prevUserAgent
+		}()
+		c := newClient(&ScrapeWork{
+			ScrapeURL:       srv.URL + "/metrics",
+			ScrapeInterval:  time.Second,
+			ScrapeTimeout:   time.Second,
+			AuthConfig:      &promauth.Config{},
+			ProxyAuthConfig: &promauth.Config{},
+			Headers:         headers,
+		})
+		expectHeaders := func() {
+			t.Helper()
+			headersMu.Lock()
+			defer headersMu.Unlock()
+			if userAgentReceived != userAgentExpected {
+				t.Fatalf("unexpected User-Agent header; got %q; want %q", userAgentReceived, userAgentExpected)
+			}
+			if targetReceived != targetExpected {
+				t.Fatalf("unexpected X-Target header; got %q; want %q", targetReceived, targetExpected)
+			}
+		}
+
+		// Read data in usual mode
+		if _, err := c.ReadData(nil); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		expectHeaders()
+
+		// Read data in stream mode
+		sr, err := c.GetStreamReader()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		_, err = ioutil.ReadAll(sr)
+		sr.MustClose()
+		if err != nil {
+			t.Fatalf("unexpected error when reading stream: %s", err)
+		}
+		expectHeaders()
+	}
+
+	f("vm_promscrape", nil, "vm_promscrape", "")
+	f("custom-agent/1.0", nil, "custom-agent/1.0", "")
+
+	// Headers are filled from target labels.
+	headers := fillHeaderTemplates(map[string]string{
+		"X-Target": "{{instance}}",
+	}, []prompbmarshal.Label{
+		{
+			Name:  "instance",
+			Value: "foo:1234",
+		},
+	})
+	f("custom-agent/1.0", headers, "custom-agent/1.0", "foo:1234")
+
+	// User-Agent from headers takes precedence over -promscrape.userAgent
+	headers = fillHeaderTemplates(map[string]string{
+		"User-Agent": "exporter-{{job}}",
+		"X-Target":   "{{instance}}",
+	}, []prompbmarshal.Label{
+		{
+			Name:  "instance",
+			Value: "foo:1234",
+		},
+		{
+			Name:  "job",
+			Value: "bar",
+		},
+	})
+	f("custom-agent/1.0", headers, "exporter-bar", "foo:1234")
+}
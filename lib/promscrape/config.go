@@ -1,7 +1,9 @@
 package promscrape
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"net/url"
@@ -56,6 +58,10 @@ var (
 		"Can be specified as pod name of Kubernetes StatefulSet - pod-name-Num, where Num is a numeric part of pod name")
 	clusterReplicationFactor = flag.Int("promscrape.cluster.replicationFactor", 1, "The number of members in the cluster, which scrape the same targets. "+
 		"If the replication factor is greater than 1, then the deduplication must be enabled at remote storage side. See https://docs.victoriametrics.com/#deduplication")
+	clusterConsistentHashing = flag.Bool("promscrape.cluster.consistentHashing", false, "Whether to spread scrape targets among cluster members with consistent hashing. "+
+		"This reduces the number of targets moved between members when -promscrape.cluster.membersCount changes to 1/N of all the targets. "+
+		"Note that enabling this option moves the majority of targets between members, so it must be enabled simultaneously on all the members. "+
+		"See https://docs.victoriametrics.com/vmagent.html#scraping-big-number-of-targets")
 	clusterName = flag.String("promscrape.cluster.name", "", "Optional name of the cluster. If multiple vmagent clusters scrape the same targets, "+
 		"then each cluster must have unique name in order to properly de-duplicate samples received from these clusters. "+
 		"See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/2679")
@@ -75,6 +81,9 @@ func mustInitClusterMemberID() {
 	if err != nil {
 		logger.Fatalf("cannot parse -promscrape.cluster.memberNum=%q: %s", *clusterMemberNum, err)
 	}
+	if *clusterMembersCount > 1 && (n < 0 || n >= *clusterMembersCount) {
+		logger.Fatalf("-promscrape.cluster.memberNum=%q must be in the range 0 ... %d", *clusterMemberNum, *clusterMembersCount-1)
+	}
 	clusterMemberID = n
 }
 
@@ -109,6 +118,38 @@ func (cfg *Config) marshal() []byte {
 	return data
 }
 
+// marshalEffective returns the effective cfg in YAML.
+//
+// Omitted options are filled with the values actually used for scraping,
+// e.g. the values from `global` section or the default values. Secrets are hidden.
+func (cfg *Config) marshalEffective() []byte {
+	globalCfg := cfg.Global
+	if globalCfg.ScrapeInterval.Duration() <= 0 {
+		globalCfg.ScrapeInterval = promutils.NewDuration(defaultScrapeInterval)
+	}
+	if globalCfg.ScrapeTimeout.Duration() <= 0 {
+		globalCfg.ScrapeTimeout = promutils.NewDuration(defaultScrapeTimeout)
+	}
+	cfgCopy := &Config{
+		Global:        globalCfg,
+		ScrapeConfigs: make([]*ScrapeConfig, 0, len(cfg.ScrapeConfigs)),
+	}
+	for _, sc := range cfg.ScrapeConfigs {
+		scCopy := sc.clone()
+		swc := sc.swc
+		scCopy.ScrapeInterval = promutils.NewDuration(swc.scrapeInterval)
+		scCopy.ScrapeTimeout = promutils.NewDuration(swc.scrapeTimeout)
+		scCopy.MetricsPath = swc.metricsPath
+		scCopy.Scheme = swc.scheme
+		honorTimestamps := swc.honorTimestamps
+		scCopy.HonorTimestamps = &honorTimestamps
+		followRedirects := !swc.denyRedirects
+		scCopy.FollowRedirects = &followRedirects
+		cfgCopy.ScrapeConfigs = append(cfgCopy.ScrapeConfigs, scCopy)
+	}
+	return cfgCopy.marshal()
+}
+
 func (cfg *Config) mustStart() {
 	startTime := time.Now()
 	logger.Infof("starting service discovery routines...")
@@ -227,6 +268,8 @@ type ScrapeConfig struct {
 	RelabelConfigs       []promrelabel.RelabelConfig `yaml:"relabel_configs,omitempty"`
 	MetricRelabelConfigs []promrelabel.RelabelConfig `yaml:"metric_relabel_configs,omitempty"`
 	SampleLimit          int                         `yaml:"sample_limit,omitempty"`
+	BodySizeLimit        *promutils.Bytes            `yaml:"body_size_limit,omitempty"`
+	ScrapeProtocols      []string                    `yaml:"scrape_protocols,omitempty"`
 
 	ConsulSDConfigs       []consul.SDConfig       `yaml:"consul_sd_configs,omitempty"`
 	DigitaloceanSDConfigs []digitalocean.SDConfig `yaml:"digitalocean_sd_configs,omitempty"`
@@ -247,12 +290,21 @@ type ScrapeConfig struct {
 	MetricRelabelDebug  bool                       `yaml:"metric_relabel_debug,omitempty"`
 	DisableCompression  bool                       `yaml:"disable_compression,omitempty"`
 	DisableKeepAlive    bool                       `yaml:"disable_keepalive,omitempty"`
+	IdleConnTimeout     *promutils.Duration        `yaml:"idle_conn_timeout,omitempty"`
 	StreamParse         bool                       `yaml:"stream_parse,omitempty"`
 	ScrapeAlignInterval *promutils.Duration        `yaml:"scrape_align_interval,omitempty"`
 	ScrapeOffset        *promutils.Duration        `yaml:"scrape_offset,omitempty"`
 	SeriesLimit         int                        `yaml:"series_limit,omitempty"`
 	ProxyClientConfig   promauth.ProxyClientConfig `yaml:",inline"`
 
+	// ResponseHeaderLabels maps response header names to label names,
+	// which must be added to the scraped metrics.
+	ResponseHeaderLabels map[string]string `yaml:"response_header_labels,omitempty"`
+
+	// Headers contains headers to send to scrape targets.
+	// Header values may contain `{{label_name}}` placeholders, which are substituted with target label values.
+	Headers map[string]string `yaml:"headers,omitempty"`
+
 	// This is set in loadConfig
 	swc *scrapeWorkConfig
 }
@@ -451,16 +503,20 @@ func getSWSByJob(sws []*ScrapeWork) map[string][]*ScrapeWork {
 }
 
 // getConsulSDScrapeWork returns `consul_sd_configs` ScrapeWork from cfg.
-func (cfg *Config) getConsulSDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
+func (cfg *Config) getConsulSDScrapeWork(ctx context.Context, prev []*ScrapeWork) []*ScrapeWork {
 	swsPrevByJob := getSWSByJob(prev)
 	dst := make([]*ScrapeWork, 0, len(prev))
 	for _, sc := range cfg.ScrapeConfigs {
 		dstLen := len(dst)
 		ok := true
 		for j := range sc.ConsulSDConfigs {
+			if isDiscoveryDeadlineExceeded(ctx, sc.swc, "consul_sd_configs") {
+				ok = false
+				break
+			}
 			sdc := &sc.ConsulSDConfigs[j]
 			var okLocal bool
-			dst, okLocal = appendSDScrapeWork(dst, sdc, cfg.baseDir, sc.swc, "consul_sd_config")
+			dst, okLocal = appendSDScrapeWork(ctx, dst, sdc, cfg.baseDir, sc.swc, "consul_sd_config")
 			if ok {
 				ok = okLocal
 			}
@@ -478,16 +534,20 @@ func (cfg *Config) getConsulSDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
 }
 
 // getDigitalOceanDScrapeWork returns `digitalocean_sd_configs` ScrapeWork from cfg.
-func (cfg *Config) getDigitalOceanDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
+func (cfg *Config) getDigitalOceanDScrapeWork(ctx context.Context, prev []*ScrapeWork) []*ScrapeWork {
 	swsPrevByJob := getSWSByJob(prev)
 	dst := make([]*ScrapeWork, 0, len(prev))
 	for _, sc := range cfg.ScrapeConfigs {
 		dstLen := len(dst)
 		ok := true
 		for j := range sc.DigitaloceanSDConfigs {
+			if isDiscoveryDeadlineExceeded(ctx, sc.swc, "digitalocean_sd_configs") {
+				ok = false
+				break
+			}
 			sdc := &sc.DigitaloceanSDConfigs[j]
 			var okLocal bool
-			dst, okLocal = appendSDScrapeWork(dst, sdc, cfg.baseDir, sc.swc, "digitalocean_sd_config")
+			dst, okLocal = appendSDScrapeWork(ctx, dst, sdc, cfg.baseDir, sc.swc, "digitalocean_sd_config")
 			if ok {
 				ok = okLocal
 			}
@@ -505,16 +565,20 @@ func (cfg *Config) getDigitalOceanDScrapeWork(prev []*ScrapeWork) []*ScrapeWork
 }
 
 // getDNSSDScrapeWork returns `dns_sd_configs` ScrapeWork from cfg.
-func (cfg *Config) getDNSSDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
+func (cfg *Config) getDNSSDScrapeWork(ctx context.Context, prev []*ScrapeWork) []*ScrapeWork {
 	swsPrevByJob := getSWSByJob(prev)
 	dst := make([]*ScrapeWork, 0, len(prev))
 	for _, sc := range cfg.ScrapeConfigs {
 		dstLen := len(dst)
 		ok := true
 		for j := range sc.DNSSDConfigs {
+			if isDiscoveryDeadlineExceeded(ctx, sc.swc, "dns_sd_configs") {
+				ok = false
+				break
+			}
 			sdc := &sc.DNSSDConfigs[j]
 			var okLocal bool
-			dst, okLocal = appendSDScrapeWork(dst, sdc, cfg.baseDir, sc.swc, "dns_sd_config")
+			dst, okLocal = appendSDScrapeWork(ctx, dst, sdc, cfg.baseDir, sc.swc, "dns_sd_config")
 			if ok {
 				ok = okLocal
 			}
@@ -532,16 +596,20 @@ func (cfg *Config) getDNSSDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
 }
 
 // getDockerSDScrapeWork returns `docker_sd_configs` ScrapeWork from cfg.
-func (cfg *Config) getDockerSDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
+func (cfg *Config) getDockerSDScrapeWork(ctx context.Context, prev []*ScrapeWork) []*ScrapeWork {
 	swsPrevByJob := getSWSByJob(prev)
 	dst := make([]*ScrapeWork, 0, len(prev))
 	for _, sc := range cfg.ScrapeConfigs {
 		dstLen := len(dst)
 		ok := true
 		for j := range sc.DockerSDConfigs {
+			if isDiscoveryDeadlineExceeded(ctx, sc.swc, "docker_sd_configs") {
+				ok = false
+				break
+			}
 			sdc := &sc.DockerSDConfigs[j]
 			var okLocal bool
-			dst, okLocal = appendSDScrapeWork(dst, sdc, cfg.baseDir, sc.swc, "docker_sd_config")
+			dst, okLocal = appendSDScrapeWork(ctx, dst, sdc, cfg.baseDir, sc.swc, "docker_sd_config")
 			if ok {
 				ok = okLocal
 			}
@@ -559,16 +627,20 @@ func (cfg *Config) getDockerSDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
 }
 
 // getDockerSwarmSDScrapeWork returns `dockerswarm_sd_configs` ScrapeWork from cfg.
-func (cfg *Config) getDockerSwarmSDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
+func (cfg *Config) getDockerSwarmSDScrapeWork(ctx context.Context, prev []*ScrapeWork) []*ScrapeWork {
 	swsPrevByJob := getSWSByJob(prev)
 	dst := make([]*ScrapeWork, 0, len(prev))
 	for _, sc := range cfg.ScrapeConfigs {
 		dstLen := len(dst)
 		ok := true
 		for j := range sc.DockerSwarmSDConfigs {
+			if isDiscoveryDeadlineExceeded(ctx, sc.swc, "dockerswarm_sd_configs") {
+				ok = false
+				break
+			}
 			sdc := &sc.DockerSwarmSDConfigs[j]
 			var okLocal bool
-			dst, okLocal = appendSDScrapeWork(dst, sdc, cfg.baseDir, sc.swc, "dockerswarm_sd_config")
+			dst, okLocal = appendSDScrapeWork(ctx, dst, sdc, cfg.baseDir, sc.swc, "dockerswarm_sd_config")
 			if ok {
 				ok = okLocal
 			}
@@ -586,16 +658,20 @@ func (cfg *Config) getDockerSwarmSDScrapeWork(prev []*ScrapeWork) []*ScrapeWork
 }
 
 // getEC2SDScrapeWork returns `ec2_sd_configs` ScrapeWork from cfg.
-func (cfg *Config) getEC2SDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
+func (cfg *Config) getEC2SDScrapeWork(ctx context.Context, prev []*ScrapeWork) []*ScrapeWork {
 	swsPrevByJob := getSWSByJob(prev)
 	dst := make([]*ScrapeWork, 0, len(prev))
 	for _, sc := range cfg.ScrapeConfigs {
 		dstLen := len(dst)
 		ok := true
 		for j := range sc.EC2SDConfigs {
+			if isDiscoveryDeadlineExceeded(ctx, sc.swc, "ec2_sd_configs") {
+				ok = false
+				break
+			}
 			sdc := &sc.EC2SDConfigs[j]
 			var okLocal bool
-			dst, okLocal = appendSDScrapeWork(dst, sdc, cfg.baseDir, sc.swc, "ec2_sd_config")
+			dst, okLocal = appendSDScrapeWork(ctx, dst, sdc, cfg.baseDir, sc.swc, "ec2_sd_config")
 			if ok {
 				ok = okLocal
 			}
@@ -613,16 +689,20 @@ func (cfg *Config) getEC2SDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
 }
 
 // getEurekaSDScrapeWork returns `eureka_sd_configs` ScrapeWork from cfg.
-func (cfg *Config) getEurekaSDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
+func (cfg *Config) getEurekaSDScrapeWork(ctx context.Context, prev []*ScrapeWork) []*ScrapeWork {
 	swsPrevByJob := getSWSByJob(prev)
 	dst := make([]*ScrapeWork, 0, len(prev))
 	for _, sc := range cfg.ScrapeConfigs {
 		dstLen := len(dst)
 		ok := true
 		for j := range sc.EurekaSDConfigs {
+			if isDiscoveryDeadlineExceeded(ctx, sc.swc, "eureka_sd_configs") {
+				ok = false
+				break
+			}
 			sdc := &sc.EurekaSDConfigs[j]
 			var okLocal bool
-			dst, okLocal = appendSDScrapeWork(dst, sdc, cfg.baseDir, sc.swc, "eureka_sd_config")
+			dst, okLocal = appendSDScrapeWork(ctx, dst, sdc, cfg.baseDir, sc.swc, "eureka_sd_config")
 			if ok {
 				ok = okLocal
 			}
@@ -662,16 +742,20 @@ func (cfg *Config) getFileSDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
 }
 
 // getGCESDScrapeWork returns `gce_sd_configs` ScrapeWork from cfg.
-func (cfg *Config) getGCESDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
+func (cfg *Config) getGCESDScrapeWork(ctx context.Context, prev []*ScrapeWork) []*ScrapeWork {
 	swsPrevByJob := getSWSByJob(prev)
 	dst := make([]*ScrapeWork, 0, len(prev))
 	for _, sc := range cfg.ScrapeConfigs {
 		dstLen := len(dst)
 		ok := true
 		for j := range sc.GCESDConfigs {
+			if isDiscoveryDeadlineExceeded(ctx, sc.swc, "gce_sd_configs") {
+				ok = false
+				break
+			}
 			sdc := &sc.GCESDConfigs[j]
 			var okLocal bool
-			dst, okLocal = appendSDScrapeWork(dst, sdc, cfg.baseDir, sc.swc, "gce_sd_config")
+			dst, okLocal = appendSDScrapeWork(ctx, dst, sdc, cfg.baseDir, sc.swc, "gce_sd_config")
 			if ok {
 				ok = okLocal
 			}
@@ -689,16 +773,20 @@ func (cfg *Config) getGCESDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
 }
 
 // getHTTPDScrapeWork returns `http_sd_configs` ScrapeWork from cfg.
-func (cfg *Config) getHTTPDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
+func (cfg *Config) getHTTPDScrapeWork(ctx context.Context, prev []*ScrapeWork) []*ScrapeWork {
 	swsPrevByJob := getSWSByJob(prev)
 	dst := make([]*ScrapeWork, 0, len(prev))
 	for _, sc := range cfg.ScrapeConfigs {
 		dstLen := len(dst)
 		ok := true
 		for j := range sc.HTTPSDConfigs {
+			if isDiscoveryDeadlineExceeded(ctx, sc.swc, "http_sd_configs") {
+				ok = false
+				break
+			}
 			sdc := &sc.HTTPSDConfigs[j]
 			var okLocal bool
-			dst, okLocal = appendSDScrapeWork(dst, sdc, cfg.baseDir, sc.swc, "http_sd_config")
+			dst, okLocal = appendSDScrapeWork(ctx, dst, sdc, cfg.baseDir, sc.swc, "http_sd_config")
 			if ok {
 				ok = okLocal
 			}
@@ -716,13 +804,17 @@ func (cfg *Config) getHTTPDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
 }
 
 // getKubernetesSDScrapeWork returns `kubernetes_sd_configs` ScrapeWork from cfg.
-func (cfg *Config) getKubernetesSDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
+func (cfg *Config) getKubernetesSDScrapeWork(ctx context.Context, prev []*ScrapeWork) []*ScrapeWork {
 	swsPrevByJob := getSWSByJob(prev)
 	dst := make([]*ScrapeWork, 0, len(prev))
 	for _, sc := range cfg.ScrapeConfigs {
 		dstLen := len(dst)
 		ok := true
 		for j := range sc.KubernetesSDConfigs {
+			if isDiscoveryDeadlineExceeded(ctx, sc.swc, "kubernetes_sd_configs") {
+				ok = false
+				break
+			}
 			sdc := &sc.KubernetesSDConfigs[j]
 			swos, err := sdc.GetScrapeWorkObjects()
 			if err != nil {
@@ -748,16 +840,20 @@ func (cfg *Config) getKubernetesSDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
 }
 
 // getOpenStackSDScrapeWork returns `openstack_sd_configs` ScrapeWork from cfg.
-func (cfg *Config) getOpenStackSDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
+func (cfg *Config) getOpenStackSDScrapeWork(ctx context.Context, prev []*ScrapeWork) []*ScrapeWork {
 	swsPrevByJob := getSWSByJob(prev)
 	dst := make([]*ScrapeWork, 0, len(prev))
 	for _, sc := range cfg.ScrapeConfigs {
 		dstLen := len(dst)
 		ok := true
 		for j := range sc.OpenStackSDConfigs {
+			if isDiscoveryDeadlineExceeded(ctx, sc.swc, "openstack_sd_configs") {
+				ok = false
+				break
+			}
 			sdc := &sc.OpenStackSDConfigs[j]
 			var okLocal bool
-			dst, okLocal = appendSDScrapeWork(dst, sdc, cfg.baseDir, sc.swc, "openstack_sd_config")
+			dst, okLocal = appendSDScrapeWork(ctx, dst, sdc, cfg.baseDir, sc.swc, "openstack_sd_config")
 			if ok {
 				ok = okLocal
 			}
@@ -828,8 +924,8 @@ func getScrapeWorkConfig(sc *ScrapeConfig, baseDir string, globalCfg *GlobalConf
 	if scheme == "" {
 		scheme = "http"
 	}
-	if scheme != "http" && scheme != "https" {
-		return nil, fmt.Errorf("unexpected `scheme` for `job_name` %q: %q; supported values: http or https", jobName, scheme)
+	if scheme != "http" && scheme != "https" && scheme != "file" {
+		return nil, fmt.Errorf("unexpected `scheme` for `job_name` %q: %q; supported values: http, https or file", jobName, scheme)
 	}
 	params := sc.Params
 	ac, err := sc.HTTPClientConfig.NewConfig(baseDir)
@@ -854,6 +950,32 @@ func getScrapeWorkConfig(sc *ScrapeConfig, baseDir string, globalCfg *GlobalConf
 	if (*streamParse || sc.StreamParse) && sc.SeriesLimit > 0 {
 		return nil, fmt.Errorf("cannot use stream parsing mode when `series_limit` is set for `job_name` %q", jobName)
 	}
+	acceptHeader, err := getAcceptHeader(sc.ScrapeProtocols)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse `scrape_protocols` for `job_name` %q: %w", jobName, err)
+	}
+	if sc.BodySizeLimit.Bytes() < 0 {
+		return nil, fmt.Errorf("`body_size_limit` cannot be negative for `job_name` %q; got %d", jobName, sc.BodySizeLimit.Bytes())
+	}
+	if sc.IdleConnTimeout.Duration() < 0 {
+		return nil, fmt.Errorf("`idle_conn_timeout` cannot be negative for `job_name` %q; got %s", jobName, sc.IdleConnTimeout.Duration())
+	}
+	for header, label := range sc.ResponseHeaderLabels {
+		if header == "" {
+			return nil, fmt.Errorf("header name cannot be empty in `response_header_labels` for `job_name` %q", jobName)
+		}
+		if !isValidLabelName(label) {
+			return nil, fmt.Errorf("invalid label name %q for header %q in `response_header_labels` for `job_name` %q", label, header, jobName)
+		}
+	}
+	for header, value := range sc.Headers {
+		if header == "" {
+			return nil, fmt.Errorf("header name cannot be empty in `headers` for `job_name` %q", jobName)
+		}
+		if err := validateHeaderTemplate(value); err != nil {
+			return nil, fmt.Errorf("invalid value for header %q in `headers` for `job_name` %q: %w", header, jobName, err)
+		}
+	}
 	swc := &scrapeWorkConfig{
 		scrapeInterval:       scrapeInterval,
 		scrapeIntervalString: scrapeInterval.String(),
@@ -873,16 +995,133 @@ func getScrapeWorkConfig(sc *ScrapeConfig, baseDir string, globalCfg *GlobalConf
 		relabelConfigs:       relabelConfigs,
 		metricRelabelConfigs: metricRelabelConfigs,
 		sampleLimit:          sc.SampleLimit,
+		maxScrapeSize:        sc.BodySizeLimit.Bytes(),
 		disableCompression:   sc.DisableCompression,
 		disableKeepAlive:     sc.DisableKeepAlive,
+		idleConnTimeout:      sc.IdleConnTimeout.Duration(),
 		streamParse:          sc.StreamParse,
 		scrapeAlignInterval:  sc.ScrapeAlignInterval.Duration(),
 		scrapeOffset:         sc.ScrapeOffset.Duration(),
 		seriesLimit:          sc.SeriesLimit,
+		responseHeaderLabels: sc.ResponseHeaderLabels,
+		headers:              sc.Headers,
+		acceptHeader:         acceptHeader,
 	}
 	return swc, nil
 }
 
+// scrapeProtocolHeaders maps the supported `scrape_protocols` values to media types for the `Accept` header.
+//
+// See https://prometheus.io/docs/prometheus/latest/configuration/configuration/#scrape_config
+var scrapeProtocolHeaders = map[string]string{
+	"PrometheusText0.0.4":  "text/plain;version=0.0.4",
+	"OpenMetricsText0.0.1": "application/openmetrics-text;version=0.0.1",
+	"OpenMetricsText1.0.0": "application/openmetrics-text;version=1.0.0",
+}
+
+// getAcceptHeader returns the `Accept` header with weights for the given scrapeProtocols in the order of preference.
+//
+// An empty string is returned if scrapeProtocols is empty, so defaultAcceptHeader is used.
+func getAcceptHeader(scrapeProtocols []string) (string, error) {
+	if len(scrapeProtocols) == 0 {
+		return "", nil
+	}
+	seen := make(map[string]bool, len(scrapeProtocols))
+	var b []byte
+	weight := len(scrapeProtocolHeaders) + 1
+	for _, sp := range scrapeProtocols {
+		if sp == "PrometheusProto" {
+			return "", fmt.Errorf("%q protocol isn't supported, since only text exposition formats can be parsed", sp)
+		}
+		h, ok := scrapeProtocolHeaders[sp]
+		if !ok {
+			return "", fmt.Errorf("unknown protocol %q; supported values: PrometheusText0.0.4, OpenMetricsText0.0.1, OpenMetricsText1.0.0", sp)
+		}
+		if seen[sp] {
+			return "", fmt.Errorf("duplicate protocol %q", sp)
+		}
+		seen[sp] = true
+		b = append(b, h...)
+		b = append(b, fmt.Sprintf(";q=0.%d,", weight)...)
+		weight--
+	}
+	// Accept any other content type with the lowest weight like Prometheus does.
+	b = append(b, fmt.Sprintf("*/*;q=0.%d", weight)...)
+	return string(b), nil
+}
+
+// validateHeaderTemplate verifies whether s contains valid `{{label_name}}` placeholders.
+func validateHeaderTemplate(s string) error {
+	for {
+		n := strings.Index(s, "{{")
+		if n < 0 {
+			return nil
+		}
+		s = s[n+2:]
+		n = strings.Index(s, "}}")
+		if n < 0 {
+			return fmt.Errorf("missing `}}` after `{{`")
+		}
+		labelName := strings.TrimSpace(s[:n])
+		if !isValidLabelName(labelName) {
+			return fmt.Errorf("invalid label name inside `{{%s}}`", s[:n])
+		}
+		s = s[n+2:]
+	}
+}
+
+// fillHeaderTemplates returns headers sorted by name for the given headerTemplates.
+//
+// `{{label_name}}` placeholders in header values are substituted with the corresponding values from labels.
+// Missing labels are substituted with empty strings.
+// headerTemplates must be validated with validateHeaderTemplate beforehand.
+func fillHeaderTemplates(headerTemplates map[string]string, labels []prompbmarshal.Label) []prompbmarshal.Label {
+	if len(headerTemplates) == 0 {
+		return nil
+	}
+	headers := make([]prompbmarshal.Label, 0, len(headerTemplates))
+	for name, template := range headerTemplates {
+		var b []byte
+		s := template
+		for {
+			n := strings.Index(s, "{{")
+			if n < 0 {
+				b = append(b, s...)
+				break
+			}
+			b = append(b, s[:n]...)
+			s = s[n+2:]
+			n = strings.Index(s, "}}")
+			labelName := strings.TrimSpace(s[:n])
+			b = append(b, promrelabel.GetLabelValueByName(labels, labelName)...)
+			s = s[n+2:]
+		}
+		headers = append(headers, prompbmarshal.Label{
+			Name:  name,
+			Value: string(b),
+		})
+	}
+	promrelabel.SortLabels(headers)
+	return headers
+}
+
+// isValidLabelName returns true if s is a valid Prometheus label name.
+//
+// See https://prometheus.io/docs/concepts/data_model/#metric-names-and-labels
+func isValidLabelName(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9') {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
 type scrapeWorkConfig struct {
 	scrapeInterval       time.Duration
 	scrapeIntervalString string
@@ -902,20 +1141,42 @@ type scrapeWorkConfig struct {
 	relabelConfigs       *promrelabel.ParsedConfigs
 	metricRelabelConfigs *promrelabel.ParsedConfigs
 	sampleLimit          int
+	maxScrapeSize        int
 	disableCompression   bool
 	disableKeepAlive     bool
+	idleConnTimeout      time.Duration
 	streamParse          bool
 	scrapeAlignInterval  time.Duration
 	scrapeOffset         time.Duration
 	seriesLimit          int
+	responseHeaderLabels map[string]string
+	headers              map[string]string
+	acceptHeader         string
+}
+
+// isDiscoveryDeadlineExceeded returns true if the deadline for the discovery of targets is exceeded in ctx.
+//
+// The discovery of targets for the job from swc must be skipped in this case,
+// and the previously discovered targets must be preserved for the job.
+func isDiscoveryDeadlineExceeded(ctx context.Context, swc *scrapeWorkConfig, discoveryType string) bool {
+	err := ctx.Err()
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		logger.Warnf("skipping %s targets for job_name %q because the discovery didn't finish in -promscrape.discovery.timeout; preserving the previous targets",
+			discoveryType, swc.jobName)
+		metrics.GetOrCreateCounter(fmt.Sprintf(`vm_promscrape_service_discovery_timeouts_total{type=%q,job=%q}`, discoveryType, swc.jobName)).Inc()
+	}
+	return true
 }
 
 type targetLabelsGetter interface {
-	GetLabels(baseDir string) ([]map[string]string, error)
+	GetLabels(ctx context.Context, baseDir string) ([]map[string]string, error)
 }
 
-func appendSDScrapeWork(dst []*ScrapeWork, sdc targetLabelsGetter, baseDir string, swc *scrapeWorkConfig, discoveryType string) ([]*ScrapeWork, bool) {
-	targetLabels, err := sdc.GetLabels(baseDir)
+func appendSDScrapeWork(ctx context.Context, dst []*ScrapeWork, sdc targetLabelsGetter, baseDir string, swc *scrapeWorkConfig, discoveryType string) ([]*ScrapeWork, bool) {
+	targetLabels, err := sdc.GetLabels(ctx, baseDir)
 	if err != nil {
 		logger.Errorf("skipping %s targets for job_name %q because of error: %s", discoveryType, swc.jobName, err)
 		return dst, false
@@ -1063,6 +1324,52 @@ func needSkipScrapeWork(key string, membersCount, replicasCount, memberNum int)
 	return true
 }
 
+// needSkipScrapeWorkConsistentHashing returns true if the target with the given key mustn't be scraped by the cluster member with the given memberNum.
+//
+// Targets are spread among cluster members with rendezvous hashing, e.g. every target is scraped by replicasCount members
+// with the highest scores for the target key. This guarantees that only 1/membersCount of targets are moved to other members
+// when members are added to the cluster or removed from the cluster.
+// See https://en.wikipedia.org/wiki/Rendezvous_hashing
+//
+// It is used instead of needSkipScrapeWork if -promscrape.cluster.consistentHashing is set.
+func needSkipScrapeWorkConsistentHashing(key string, membersCount, replicasCount, memberNum int) bool {
+	if membersCount <= 1 {
+		return false
+	}
+	if replicasCount < 1 {
+		replicasCount = 1
+	}
+	if replicasCount >= membersCount {
+		return false
+	}
+	h := xxhash.Sum64(bytesutil.ToUnsafeBytes(key))
+	memberScore := getMemberScore(h, memberNum)
+	// Count members with higher scores than memberNum has. Ties are broken by member number.
+	higherScores := 0
+	for i := 0; i < membersCount; i++ {
+		if i == memberNum {
+			continue
+		}
+		score := getMemberScore(h, i)
+		if score > memberScore || (score == memberScore && i < memberNum) {
+			higherScores++
+			if higherScores >= replicasCount {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getMemberScore returns rendezvous hashing score for the cluster member with the given memberNum and the given target key hash h.
+func getMemberScore(h uint64, memberNum int) uint64 {
+	// Mix h with memberNum via splitmix64 finalizer. See https://prng.di.unimi.it/splitmix64.c
+	x := h ^ (uint64(memberNum+1) * 0x9e3779b97f4a7c15)
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
 type labelsContext struct {
 	labels []prompbmarshal.Label
 }
@@ -1111,7 +1418,11 @@ func (swc *scrapeWorkConfig) getScrapeWork(target string, extraLabels, metaLabel
 	if *clusterMembersCount > 1 {
 		bb := scrapeWorkKeyBufPool.Get()
 		bb.B = appendScrapeWorkKey(bb.B[:0], labels)
-		needSkip := needSkipScrapeWork(bytesutil.ToUnsafeString(bb.B), *clusterMembersCount, *clusterReplicationFactor, clusterMemberID)
+		needSkipFunc := needSkipScrapeWork
+		if *clusterConsistentHashing {
+			needSkipFunc = needSkipScrapeWorkConsistentHashing
+		}
+		needSkip := needSkipFunc(bytesutil.ToUnsafeString(bb.B), *clusterMembersCount, *clusterReplicationFactor, clusterMemberID)
 		scrapeWorkKeyBufPool.Put(bb)
 		if needSkip {
 			return nil, nil
@@ -1132,6 +1443,11 @@ func (swc *scrapeWorkConfig) getScrapeWork(target string, extraLabels, metaLabel
 	if len(schemeRelabeled) == 0 {
 		schemeRelabeled = "http"
 	}
+	if schemeRelabeled == "file" && swc.scheme != "file" {
+		// Do not allow reading local files via `__scheme__` label, since it may be set from untrusted labels
+		// obtained from service discovery such as pod annotations.
+		return nil, fmt.Errorf("`__scheme__=file` cannot be set via relabeling for `job_name` %q; set `scheme: file` in the job config instead", swc.jobName)
+	}
 	addressRelabeled := promrelabel.GetLabelValueByName(labels, "__address__")
 	if len(addressRelabeled) == 0 {
 		// Drop target without scrape address.
@@ -1143,7 +1459,9 @@ func (swc *scrapeWorkConfig) getScrapeWork(target string, extraLabels, metaLabel
 		droppedTargetsMap.Register(originalLabels)
 		return nil, nil
 	}
-	addressRelabeled = addMissingPort(schemeRelabeled, addressRelabeled)
+	if schemeRelabeled != "file" {
+		addressRelabeled = addMissingPort(schemeRelabeled, addressRelabeled)
+	}
 	metricsPathRelabeled := promrelabel.GetLabelValueByName(labels, "__metrics_path__")
 	if metricsPathRelabeled == "" {
 		metricsPathRelabeled = "/metrics"
@@ -1158,6 +1476,11 @@ func (swc *scrapeWorkConfig) getScrapeWork(target string, extraLabels, metaLabel
 	}
 	paramsStr := url.Values(paramsRelabeled).Encode()
 	scrapeURL := fmt.Sprintf("%s://%s%s%s%s", schemeRelabeled, addressRelabeled, metricsPathRelabeled, optionalQuestion, paramsStr)
+	if schemeRelabeled == "file" {
+		// The metrics_path contains the path to the local file for `scheme: file`,
+		// while the address is used only for the `instance` label.
+		scrapeURL = "file://" + metricsPathRelabeled
+	}
 	if _, err := url.Parse(scrapeURL); err != nil {
 		return nil, fmt.Errorf("invalid url %q for scheme=%q (%q), target=%q (%q), metrics_path=%q (%q) for `job_name` %q: %w",
 			scrapeURL, swc.scheme, schemeRelabeled, target, addressRelabeled, swc.metricsPath, metricsPathRelabeled, swc.jobName, err)
@@ -1177,6 +1500,9 @@ func (swc *scrapeWorkConfig) getScrapeWork(target string, extraLabels, metaLabel
 		if err != nil {
 			return nil, fmt.Errorf("cannot parse __scrape_interval__=%q: %w", s, err)
 		}
+		if d <= 0 {
+			return nil, fmt.Errorf("__scrape_interval__=%q must be positive", s)
+		}
 		scrapeInterval = d
 	}
 	scrapeTimeout := swc.scrapeTimeout
@@ -1185,8 +1511,18 @@ func (swc *scrapeWorkConfig) getScrapeWork(target string, extraLabels, metaLabel
 		if err != nil {
 			return nil, fmt.Errorf("cannot parse __scrape_timeout__=%q: %w", s, err)
 		}
+		if d <= 0 {
+			return nil, fmt.Errorf("__scrape_timeout__=%q must be positive", s)
+		}
 		scrapeTimeout = d
 	}
+	if scrapeTimeout > scrapeInterval {
+		if scrapeTimeout != swc.scrapeTimeout {
+			return nil, fmt.Errorf("__scrape_timeout__=%s cannot exceed __scrape_interval__=%s", scrapeTimeout, scrapeInterval)
+		}
+		// Limit the `scrape_timeout` from the job with the `scrape_interval` overridden for the target in the same way as for the job.
+		scrapeTimeout = scrapeInterval
+	}
 	// Read series_limit option from __series_limit__ label.
 	// See https://docs.victoriametrics.com/vmagent.html#cardinality-limiter
 	seriesLimit := swc.seriesLimit
@@ -1207,6 +1543,7 @@ func (swc *scrapeWorkConfig) getScrapeWork(target string, extraLabels, metaLabel
 		}
 		streamParse = b
 	}
+	headers := fillHeaderTemplates(swc.headers, labels)
 	// Reduce memory usage by interning all the strings in labels.
 	internLabelStrings(labels)
 	sw := &ScrapeWork{
@@ -1223,12 +1560,17 @@ func (swc *scrapeWorkConfig) getScrapeWork(target string, extraLabels, metaLabel
 		AuthConfig:           swc.authConfig,
 		MetricRelabelConfigs: swc.metricRelabelConfigs,
 		SampleLimit:          swc.sampleLimit,
+		MaxScrapeSize:        swc.maxScrapeSize,
 		DisableCompression:   swc.disableCompression,
 		DisableKeepAlive:     swc.disableKeepAlive,
+		IdleConnTimeout:      swc.idleConnTimeout,
 		StreamParse:          streamParse,
 		ScrapeAlignInterval:  swc.scrapeAlignInterval,
 		ScrapeOffset:         swc.scrapeOffset,
 		SeriesLimit:          seriesLimit,
+		ResponseHeaderLabels: swc.responseHeaderLabels,
+		Headers:              headers,
+		AcceptHeader:         swc.acceptHeader,
 
 		jobNameOriginal: swc.jobName,
 	}
@@ -1,6 +1,7 @@
 package consul
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -29,15 +30,15 @@ func (ac *apiConfig) mustStop() {
 
 var configMap = discoveryutils.NewConfigMap()
 
-func getAPIConfig(sdc *SDConfig, baseDir string) (*apiConfig, error) {
-	v, err := configMap.Get(sdc, func() (interface{}, error) { return newAPIConfig(sdc, baseDir) })
+func getAPIConfig(ctx context.Context, sdc *SDConfig, baseDir string) (*apiConfig, error) {
+	v, err := configMap.Get(sdc, func() (interface{}, error) { return newAPIConfig(ctx, sdc, baseDir) })
 	if err != nil {
 		return nil, err
 	}
 	return v.(*apiConfig), nil
 }
 
-func newAPIConfig(sdc *SDConfig, baseDir string) (*apiConfig, error) {
+func newAPIConfig(ctx context.Context, sdc *SDConfig, baseDir string) (*apiConfig, error) {
 	hcc := sdc.HTTPClientConfig
 	token, err := getToken(sdc.Token)
 	if err != nil {
@@ -85,7 +86,7 @@ func newAPIConfig(sdc *SDConfig, baseDir string) (*apiConfig, error) {
 	if sdc.TagSeparator != nil {
 		tagSeparator = *sdc.TagSeparator
 	}
-	dc, err := getDatacenter(client, sdc.Datacenter)
+	dc, err := getDatacenter(ctx, client, sdc.Datacenter)
 	if err != nil {
 		return nil, err
 	}
@@ -120,12 +121,12 @@ func getToken(token *promauth.Secret) (string, error) {
 	return t, nil
 }
 
-func getDatacenter(client *discoveryutils.Client, dc string) (string, error) {
+func getDatacenter(ctx context.Context, client *discoveryutils.Client, dc string) (string, error) {
 	if dc != "" {
 		return dc, nil
 	}
 	// See https://www.consul.io/api/agent.html#read-configuration
-	data, err := client.GetAPIResponse("/v1/agent/self")
+	data, err := client.GetAPIResponse(ctx, "/v1/agent/self")
 	if err != nil {
 		return "", fmt.Errorf("cannot query consul agent info: %w", err)
 	}
@@ -1,6 +1,7 @@
 package digitalocean
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net/url"
@@ -30,12 +31,14 @@ type SDConfig struct {
 }
 
 // GetLabels returns Digital Ocean droplet labels according to sdc.
-func (sdc *SDConfig) GetLabels(baseDir string) ([]map[string]string, error) {
+func (sdc *SDConfig) GetLabels(ctx context.Context, baseDir string) ([]map[string]string, error) {
 	cfg, err := getAPIConfig(sdc, baseDir)
 	if err != nil {
 		return nil, fmt.Errorf("cannot get API config: %w", err)
 	}
-	droplets, err := getDroplets(cfg.client.GetAPIResponse)
+	droplets, err := getDroplets(func(path string) ([]byte, error) {
+		return cfg.client.GetAPIResponse(ctx, path)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
@@ -58,7 +59,7 @@ func newAPIConfig(sdc *SDConfig, baseDir string) (*apiConfig, error) {
 	return cfg, nil
 }
 
-func (cfg *apiConfig) getAPIResponse(path string) ([]byte, error) {
+func (cfg *apiConfig) getAPIResponse(ctx context.Context, path string) ([]byte, error) {
 	if len(cfg.filtersQueryArg) > 0 {
 		separator := "?"
 		if strings.Contains(path, "?") {
@@ -66,7 +67,7 @@ func (cfg *apiConfig) getAPIResponse(path string) ([]byte, error) {
 		}
 		path += separator + "filters=" + cfg.filtersQueryArg
 	}
-	return cfg.client.GetAPIResponse(path)
+	return cfg.client.GetAPIResponse(ctx, path)
 }
 
 func getFiltersQueryArg(filters []Filter) string {
@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -30,20 +31,20 @@ type container struct {
 	}
 }
 
-func getContainersLabels(cfg *apiConfig) ([]map[string]string, error) {
-	networkLabels, err := getNetworksLabelsByNetworkID(cfg)
+func getContainersLabels(ctx context.Context, cfg *apiConfig) ([]map[string]string, error) {
+	networkLabels, err := getNetworksLabelsByNetworkID(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
-	containers, err := getContainers(cfg)
+	containers, err := getContainers(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
 	return addContainersLabels(containers, networkLabels, cfg.port, cfg.hostNetworkingHost), nil
 }
 
-func getContainers(cfg *apiConfig) ([]container, error) {
-	resp, err := cfg.getAPIResponse("/containers/json")
+func getContainers(ctx context.Context, cfg *apiConfig) ([]container, error) {
+	resp, err := cfg.getAPIResponse(ctx, "/containers/json")
 	if err != nil {
 		return nil, fmt.Errorf("cannot query dockerd api for containers: %w", err)
 	}
@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"time"
@@ -36,12 +37,12 @@ type Filter struct {
 }
 
 // GetLabels returns docker labels according to sdc.
-func (sdc *SDConfig) GetLabels(baseDir string) ([]map[string]string, error) {
+func (sdc *SDConfig) GetLabels(ctx context.Context, baseDir string) ([]map[string]string, error) {
 	cfg, err := getAPIConfig(sdc, baseDir)
 	if err != nil {
 		return nil, fmt.Errorf("cannot get API config: %w", err)
 	}
-	return getContainersLabels(cfg)
+	return getContainersLabels(ctx, cfg)
 }
 
 // MustStop stops further usage for sdc.
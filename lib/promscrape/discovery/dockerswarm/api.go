@@ -1,6 +1,7 @@
 package dockerswarm
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
@@ -52,7 +53,7 @@ func newAPIConfig(sdc *SDConfig, baseDir string) (*apiConfig, error) {
 	return cfg, nil
 }
 
-func (cfg *apiConfig) getAPIResponse(path string) ([]byte, error) {
+func (cfg *apiConfig) getAPIResponse(ctx context.Context, path string) ([]byte, error) {
 	if len(cfg.filtersQueryArg) > 0 {
 		separator := "?"
 		if strings.Contains(path, "?") {
@@ -60,7 +61,7 @@ func (cfg *apiConfig) getAPIResponse(path string) ([]byte, error) {
 		}
 		path += separator + "filters=" + cfg.filtersQueryArg
 	}
-	return cfg.client.GetAPIResponse(path)
+	return cfg.client.GetAPIResponse(ctx, path)
 }
 
 func getFiltersQueryArg(filters []Filter) string {
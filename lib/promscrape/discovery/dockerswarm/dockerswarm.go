@@ -1,6 +1,7 @@
 package dockerswarm
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"time"
@@ -36,18 +37,18 @@ type Filter struct {
 }
 
 // GetLabels returns dockerswarm labels according to sdc.
-func (sdc *SDConfig) GetLabels(baseDir string) ([]map[string]string, error) {
+func (sdc *SDConfig) GetLabels(ctx context.Context, baseDir string) ([]map[string]string, error) {
 	cfg, err := getAPIConfig(sdc, baseDir)
 	if err != nil {
 		return nil, fmt.Errorf("cannot get API config: %w", err)
 	}
 	switch sdc.Role {
 	case "tasks":
-		return getTasksLabels(cfg)
+		return getTasksLabels(ctx, cfg)
 	case "services":
-		return getServicesLabels(cfg)
+		return getServicesLabels(ctx, cfg)
 	case "nodes":
-		return getNodesLabels(cfg)
+		return getNodesLabels(ctx, cfg)
 	default:
 		return nil, fmt.Errorf("unexpected `role`: %q; must be one of `tasks`, `services` or `nodes`; skipping it", sdc.Role)
 	}
@@ -1,6 +1,7 @@
 package dockerswarm
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -18,16 +19,16 @@ type network struct {
 	Labels   map[string]string
 }
 
-func getNetworksLabelsByNetworkID(cfg *apiConfig) (map[string]map[string]string, error) {
-	networks, err := getNetworks(cfg)
+func getNetworksLabelsByNetworkID(ctx context.Context, cfg *apiConfig) (map[string]map[string]string, error) {
+	networks, err := getNetworks(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
 	return getNetworkLabelsByNetworkID(networks), nil
 }
 
-func getNetworks(cfg *apiConfig) ([]network, error) {
-	resp, err := cfg.getAPIResponse("/networks")
+func getNetworks(ctx context.Context, cfg *apiConfig) ([]network, error) {
+	resp, err := cfg.getAPIResponse(ctx, "/networks")
 	if err != nil {
 		return nil, fmt.Errorf("cannot query dockerswarm api for networks: %w", err)
 	}
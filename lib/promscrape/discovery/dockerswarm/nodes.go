@@ -1,6 +1,7 @@
 package dockerswarm
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -37,16 +38,16 @@ type node struct {
 	}
 }
 
-func getNodesLabels(cfg *apiConfig) ([]map[string]string, error) {
-	nodes, err := getNodes(cfg)
+func getNodesLabels(ctx context.Context, cfg *apiConfig) ([]map[string]string, error) {
+	nodes, err := getNodes(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
 	return addNodeLabels(nodes, cfg.port), nil
 }
 
-func getNodes(cfg *apiConfig) ([]node, error) {
-	resp, err := cfg.getAPIResponse("/nodes")
+func getNodes(ctx context.Context, cfg *apiConfig) ([]node, error) {
+	resp, err := cfg.getAPIResponse(ctx, "/nodes")
 	if err != nil {
 		return nil, fmt.Errorf("cannot query dockerswarm api for nodes: %w", err)
 	}
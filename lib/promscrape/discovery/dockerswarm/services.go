@@ -1,6 +1,7 @@
 package dockerswarm
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
@@ -46,20 +47,20 @@ type portConfig struct {
 	PublishedPort int
 }
 
-func getServicesLabels(cfg *apiConfig) ([]map[string]string, error) {
-	services, err := getServices(cfg)
+func getServicesLabels(ctx context.Context, cfg *apiConfig) ([]map[string]string, error) {
+	services, err := getServices(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
-	networksLabels, err := getNetworksLabelsByNetworkID(cfg)
+	networksLabels, err := getNetworksLabelsByNetworkID(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
 	return addServicesLabels(services, networksLabels, cfg.port), nil
 }
 
-func getServices(cfg *apiConfig) ([]service, error) {
-	data, err := cfg.getAPIResponse("/services")
+func getServices(ctx context.Context, cfg *apiConfig) ([]service, error) {
+	data, err := cfg.getAPIResponse(ctx, "/services")
 	if err != nil {
 		return nil, fmt.Errorf("cannot query dockerswarm api for services: %w", err)
 	}
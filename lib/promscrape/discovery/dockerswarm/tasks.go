@@ -1,6 +1,7 @@
 package dockerswarm
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
@@ -35,29 +36,29 @@ type task struct {
 	Slot int
 }
 
-func getTasksLabels(cfg *apiConfig) ([]map[string]string, error) {
-	tasks, err := getTasks(cfg)
+func getTasksLabels(ctx context.Context, cfg *apiConfig) ([]map[string]string, error) {
+	tasks, err := getTasks(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
-	services, err := getServices(cfg)
+	services, err := getServices(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
-	networkLabels, err := getNetworksLabelsByNetworkID(cfg)
+	networkLabels, err := getNetworksLabelsByNetworkID(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
 	svcLabels := addServicesLabels(services, networkLabels, cfg.port)
-	nodeLabels, err := getNodesLabels(cfg)
+	nodeLabels, err := getNodesLabels(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
 	return addTasksLabels(tasks, nodeLabels, svcLabels, networkLabels, services, cfg.port), nil
 }
 
-func getTasks(cfg *apiConfig) ([]task, error) {
-	resp, err := cfg.getAPIResponse("/tasks")
+func getTasks(ctx context.Context, cfg *apiConfig) ([]task, error) {
+	resp, err := cfg.getAPIResponse(ctx, "/tasks")
 	if err != nil {
 		return nil, fmt.Errorf("cannot query dockerswarm api for tasks: %w", err)
 	}
@@ -1,6 +1,7 @@
 package ec2
 
 import (
+	"context"
 	"encoding/xml"
 	"fmt"
 
@@ -8,7 +9,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 )
 
-func getAZMap(cfg *apiConfig) map[string]string {
+func getAZMap(ctx context.Context, cfg *apiConfig) map[string]string {
 	cfg.azMapLock.Lock()
 	defer cfg.azMapLock.Unlock()
 
@@ -16,7 +17,11 @@ func getAZMap(cfg *apiConfig) map[string]string {
 		return cfg.azMap
 	}
 
-	azs, err := getAvailabilityZones(cfg)
+	azs, err := getAvailabilityZones(ctx, cfg)
+	if err != nil && ctx.Err() != nil {
+		// Do not cache the empty map if the discovery has been canceled, so availability zones are loaded on the next discovery.
+		return nil
+	}
 	cfg.azMap = make(map[string]string, len(azs))
 	if err != nil {
 		logger.Warnf("couldn't load availability zones map, so __meta_ec2_availability_zone_id label isn't set: %s", err)
@@ -28,10 +33,10 @@ func getAZMap(cfg *apiConfig) map[string]string {
 	return cfg.azMap
 }
 
-func getAvailabilityZones(cfg *apiConfig) ([]AvailabilityZone, error) {
+func getAvailabilityZones(ctx context.Context, cfg *apiConfig) ([]AvailabilityZone, error) {
 	// See https://docs.aws.amazon.com/AWSEC2/latest/APIReference/API_DescribeAvailabilityZones.html
 	azFilters := awsapi.GetFiltersQueryString(cfg.azFilters)
-	data, err := cfg.awsConfig.GetEC2APIResponse("DescribeAvailabilityZones", azFilters, "")
+	data, err := cfg.awsConfig.GetEC2APIResponse(ctx, "DescribeAvailabilityZones", azFilters, "")
 	if err != nil {
 		return nil, fmt.Errorf("cannot obtain availability zones: %w", err)
 	}
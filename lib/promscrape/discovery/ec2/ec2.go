@@ -1,6 +1,7 @@
 package ec2
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"time"
@@ -33,12 +34,12 @@ type SDConfig struct {
 }
 
 // GetLabels returns ec2 labels according to sdc.
-func (sdc *SDConfig) GetLabels(baseDir string) ([]map[string]string, error) {
+func (sdc *SDConfig) GetLabels(ctx context.Context, baseDir string) ([]map[string]string, error) {
 	cfg, err := getAPIConfig(sdc)
 	if err != nil {
 		return nil, fmt.Errorf("cannot get API config: %w", err)
 	}
-	ms, err := getInstancesLabels(cfg)
+	ms, err := getInstancesLabels(ctx, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("error when fetching instances data from EC2: %w", err)
 	}
@@ -1,6 +1,7 @@
 package ec2
 
 import (
+	"context"
 	"encoding/xml"
 	"fmt"
 	"strings"
@@ -10,12 +11,12 @@ import (
 )
 
 // getInstancesLabels returns labels for ec2 instances obtained from the given cfg
-func getInstancesLabels(cfg *apiConfig) ([]map[string]string, error) {
-	rs, err := getReservations(cfg)
+func getInstancesLabels(ctx context.Context, cfg *apiConfig) ([]map[string]string, error) {
+	rs, err := getReservations(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
-	azMap := getAZMap(cfg)
+	azMap := getAZMap(ctx, cfg)
 	var ms []map[string]string
 	for _, r := range rs {
 		for _, inst := range r.InstanceSet.Items {
@@ -25,13 +26,13 @@ func getInstancesLabels(cfg *apiConfig) ([]map[string]string, error) {
 	return ms, nil
 }
 
-func getReservations(cfg *apiConfig) ([]Reservation, error) {
+func getReservations(ctx context.Context, cfg *apiConfig) ([]Reservation, error) {
 	// See https://docs.aws.amazon.com/AWSEC2/latest/APIReference/API_DescribeInstances.html
 	var rs []Reservation
 	pageToken := ""
 	instanceFilters := awsapi.GetFiltersQueryString(cfg.instanceFilters)
 	for {
-		data, err := cfg.awsConfig.GetEC2APIResponse("DescribeInstances", instanceFilters, pageToken)
+		data, err := cfg.awsConfig.GetEC2APIResponse(ctx, "DescribeInstances", instanceFilters, pageToken)
 		if err != nil {
 			return nil, fmt.Errorf("cannot obtain instances: %w", err)
 		}
@@ -1,6 +1,7 @@
 package eureka
 
 import (
+	"context"
 	"encoding/xml"
 	"fmt"
 	"strings"
@@ -53,8 +54,8 @@ func getAPIConfig(sdc *SDConfig, baseDir string) (*apiConfig, error) {
 
 }
 
-func getAPIResponse(cfg *apiConfig, path string) ([]byte, error) {
-	return cfg.client.GetAPIResponse(path)
+func getAPIResponse(ctx context.Context, cfg *apiConfig, path string) ([]byte, error) {
+	return cfg.client.GetAPIResponse(ctx, path)
 }
 
 func parseAPIResponse(data []byte) (*applications, error) {
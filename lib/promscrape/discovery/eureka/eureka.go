@@ -1,6 +1,7 @@
 package eureka
 
 import (
+	"context"
 	"encoding/xml"
 	"flag"
 	"fmt"
@@ -82,12 +83,12 @@ type DataCenterInfo struct {
 }
 
 // GetLabels returns Eureka labels according to sdc.
-func (sdc *SDConfig) GetLabels(baseDir string) ([]map[string]string, error) {
+func (sdc *SDConfig) GetLabels(ctx context.Context, baseDir string) ([]map[string]string, error) {
 	cfg, err := getAPIConfig(sdc, baseDir)
 	if err != nil {
 		return nil, fmt.Errorf("cannot get API config: %w", err)
 	}
-	data, err := getAPIResponse(cfg, "/apps")
+	data, err := getAPIResponse(ctx, cfg, "/apps")
 	if err != nil {
 		return nil, err
 	}
@@ -24,17 +24,17 @@ type apiConfig struct {
 
 var configMap = discoveryutils.NewConfigMap()
 
-func getAPIConfig(sdc *SDConfig) (*apiConfig, error) {
-	v, err := configMap.Get(sdc, func() (interface{}, error) { return newAPIConfig(sdc) })
+func getAPIConfig(ctx context.Context, sdc *SDConfig) (*apiConfig, error) {
+	v, err := configMap.Get(sdc, func() (interface{}, error) { return newAPIConfig(ctx, sdc) })
 	if err != nil {
 		return nil, err
 	}
 	return v.(*apiConfig), nil
 }
 
-func newAPIConfig(sdc *SDConfig) (*apiConfig, error) {
-	ctx := context.Background()
-	client, err := google.DefaultClient(ctx, "https://www.googleapis.com/auth/compute.readonly")
+func newAPIConfig(ctx context.Context, sdc *SDConfig) (*apiConfig, error) {
+	// Do not pass ctx to google.DefaultClient, since the client refreshes oauth2 tokens with it after newAPIConfig returns.
+	client, err := google.DefaultClient(context.Background(), "https://www.googleapis.com/auth/compute.readonly")
 	if err != nil {
 		return nil, fmt.Errorf("cannot create oauth2 client for gce: %w", err)
 	}
@@ -58,7 +58,7 @@ func newAPIConfig(sdc *SDConfig) (*apiConfig, error) {
 		logger.Infof("autodetected the current GCE zone: %q", zone)
 	} else if len(zones) == 1 && zones[0] == "*" {
 		// Autodetect zones for project.
-		zs, err := getZonesForProject(client, project, sdc.Filter)
+		zs, err := getZonesForProject(ctx, client, project, sdc.Filter)
 		if err != nil {
 			return nil, fmt.Errorf("cannot obtain zones for project %q: %w", project, err)
 		}
@@ -83,10 +83,14 @@ func newAPIConfig(sdc *SDConfig) (*apiConfig, error) {
 	}, nil
 }
 
-func getAPIResponse(client *http.Client, apiURL, filter, pageToken string) ([]byte, error) {
+func getAPIResponse(ctx context.Context, client *http.Client, apiURL, filter, pageToken string) ([]byte, error) {
 	apiURL = appendNonEmptyQueryArg(apiURL, "filter", filter)
 	apiURL = appendNonEmptyQueryArg(apiURL, "pageToken", pageToken)
-	resp, err := client.Get(apiURL)
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request for %q: %w", apiURL, err)
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("cannot query %q: %w", apiURL, err)
 	}
@@ -1,6 +1,7 @@
 package gce
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"time"
@@ -60,12 +61,12 @@ func (z ZoneYAML) MarshalYAML() (interface{}, error) {
 }
 
 // GetLabels returns gce labels according to sdc.
-func (sdc *SDConfig) GetLabels(baseDir string) ([]map[string]string, error) {
-	cfg, err := getAPIConfig(sdc)
+func (sdc *SDConfig) GetLabels(ctx context.Context, baseDir string) ([]map[string]string, error) {
+	cfg, err := getAPIConfig(ctx, sdc)
 	if err != nil {
 		return nil, fmt.Errorf("cannot get API config: %w", err)
 	}
-	ms := getInstancesLabels(cfg)
+	ms := getInstancesLabels(ctx, cfg)
 	return ms, nil
 }
 
@@ -1,6 +1,7 @@
 package gce
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -11,8 +12,8 @@ import (
 )
 
 // getInstancesLabels returns labels for gce instances obtained from the given cfg
-func getInstancesLabels(cfg *apiConfig) []map[string]string {
-	insts := getInstances(cfg)
+func getInstancesLabels(ctx context.Context, cfg *apiConfig) []map[string]string {
+	insts := getInstances(ctx, cfg)
 	var ms []map[string]string
 	for _, inst := range insts {
 		ms = inst.appendTargetLabels(ms, cfg.project, cfg.tagSeparator, cfg.port)
@@ -20,7 +21,7 @@ func getInstancesLabels(cfg *apiConfig) []map[string]string {
 	return ms
 }
 
-func getInstances(cfg *apiConfig) []Instance {
+func getInstances(ctx context.Context, cfg *apiConfig) []Instance {
 	// Collect instances for each zone in parallel
 	type result struct {
 		zone  string
@@ -30,7 +31,7 @@ func getInstances(cfg *apiConfig) []Instance {
 	ch := make(chan result, len(cfg.zones))
 	for _, zone := range cfg.zones {
 		go func(zone string) {
-			insts, err := getInstancesForProjectAndZone(cfg.client, cfg.project, zone, cfg.filter)
+			insts, err := getInstancesForProjectAndZone(ctx, cfg.client, cfg.project, zone, cfg.filter)
 			ch <- result{
 				zone:  zone,
 				insts: insts,
@@ -50,13 +51,13 @@ func getInstances(cfg *apiConfig) []Instance {
 	return insts
 }
 
-func getInstancesForProjectAndZone(client *http.Client, project, zone, filter string) ([]Instance, error) {
+func getInstancesForProjectAndZone(ctx context.Context, client *http.Client, project, zone, filter string) ([]Instance, error) {
 	// See https://cloud.google.com/compute/docs/reference/rest/v1/instances/list
 	instsURL := fmt.Sprintf("https://compute.googleapis.com/compute/v1/projects/%s/zones/%s/instances", project, zone)
 	var insts []Instance
 	pageToken := ""
 	for {
-		data, err := getAPIResponse(client, instsURL, filter, pageToken)
+		data, err := getAPIResponse(ctx, client, instsURL, filter, pageToken)
 		if err != nil {
 			return nil, fmt.Errorf("cannot obtain instances: %w", err)
 		}
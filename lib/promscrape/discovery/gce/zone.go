@@ -1,18 +1,19 @@
 package gce
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 )
 
-func getZonesForProject(client *http.Client, project, filter string) ([]string, error) {
+func getZonesForProject(ctx context.Context, client *http.Client, project, filter string) ([]string, error) {
 	// See https://cloud.google.com/compute/docs/reference/rest/v1/zones
 	zonesURL := fmt.Sprintf("https://compute.googleapis.com/compute/v1/projects/%s/zones", project)
 	var zones []string
 	pageToken := ""
 	for {
-		data, err := getAPIResponse(client, zonesURL, filter, pageToken)
+		data, err := getAPIResponse(ctx, client, zonesURL, filter, pageToken)
 		if err != nil {
 			return nil, fmt.Errorf("cannot obtain zones: %w", err)
 		}
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
@@ -64,8 +65,8 @@ func getAPIConfig(sdc *SDConfig, baseDir string) (*apiConfig, error) {
 	return v.(*apiConfig), nil
 }
 
-func getHTTPTargets(cfg *apiConfig) ([]httpGroupTarget, error) {
-	data, err := cfg.client.GetAPIResponseWithReqParams(cfg.path, func(request *fasthttp.Request) {
+func getHTTPTargets(ctx context.Context, cfg *apiConfig) ([]httpGroupTarget, error) {
+	data, err := cfg.client.GetAPIResponseWithReqParams(ctx, cfg.path, func(request *fasthttp.Request) {
 		request.Header.Set("X-Prometheus-Refresh-Interval-Seconds", strconv.FormatFloat(SDCheckInterval.Seconds(), 'f', 0, 64))
 		request.Header.Set("Accept", "application/json")
 	})
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"time"
@@ -25,12 +26,12 @@ type SDConfig struct {
 }
 
 // GetLabels returns http service discovery labels according to sdc.
-func (sdc *SDConfig) GetLabels(baseDir string) ([]map[string]string, error) {
+func (sdc *SDConfig) GetLabels(ctx context.Context, baseDir string) ([]map[string]string, error) {
 	cfg, err := getAPIConfig(sdc, baseDir)
 	if err != nil {
 		return nil, fmt.Errorf("cannot get API config: %w", err)
 	}
-	hts, err := getHTTPTargets(cfg)
+	hts, err := getHTTPTargets(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
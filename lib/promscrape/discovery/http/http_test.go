@@ -1,8 +1,12 @@
 package http
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discoveryutils"
@@ -56,3 +60,30 @@ func Test_addHTTPTargetLabels(t *testing.T) {
 		})
 	}
 }
+
+func TestGetLabelsContextDeadline(t *testing.T) {
+	// The server hangs until the test is finished.
+	stopCh := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stopCh
+	}))
+	defer s.Close()
+	defer close(stopCh)
+
+	sdc := &SDConfig{
+		URL: s.URL + "/sd",
+	}
+	defer sdc.MustStop()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// The request must be aborted at the ctx deadline.
+	startTime := time.Now()
+	_, err := sdc.GetLabels(ctx, "")
+	if err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	if d := time.Since(startTime); d > 5*time.Second {
+		t.Fatalf("GetLabels must return at the ctx deadline; it returned in %s", d)
+	}
+}
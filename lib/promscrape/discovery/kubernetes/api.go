@@ -2,8 +2,7 @@ package kubernetes
 
 import (
 	"fmt"
-	"net"
-	"os"
+	"net/http"
 	"strings"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
@@ -21,44 +20,33 @@ func newAPIConfig(sdc *SDConfig, baseDir string, swcFunc ScrapeWorkConstructorFu
 		return nil, fmt.Errorf("cannot parse auth config: %w", err)
 	}
 	apiServer := sdc.APIServer
+	var ets *execTokenSource
+	var impersonateHeaders http.Header
+	var kubeConfigNamespace string
 
+	var kc *kubeConfig
 	if len(sdc.KubeConfig) > 0 {
-		fmt.Println("building")
-		kc, err := buildConfig(sdc)
+		kc, err = buildConfig(sdc)
 		if err != nil {
 			return nil, fmt.Errorf("cannot build kube config: %w", err)
 		}
-		ac, err = promauth.NewConfig(".", nil, kc.basicAuth, kc.token, kc.tokenFile, nil, kc.tlsConfig)
-		if err != nil {
-			return nil, fmt.Errorf("cannot initialize service account auth: %w; probably, `kubernetes_sd_config->api_server` is missing in Prometheus configs?", err)
-		}
-		apiServer = kc.server
 		sdc.ProxyURL = kc.proxyURL
-	}
-
-	if len(apiServer) == 0 {
+	} else if len(apiServer) == 0 {
 		// Assume we run at k8s pod.
-		// Discover apiServer and auth config according to k8s docs.
-		// See https://kubernetes.io/docs/reference/access-authn-authz/service-accounts-admin/#service-account-admission-controller
-		host := os.Getenv("KUBERNETES_SERVICE_HOST")
-		port := os.Getenv("KUBERNETES_SERVICE_PORT")
-		if len(host) == 0 {
-			return nil, fmt.Errorf("cannot find KUBERNETES_SERVICE_HOST env var; it must be defined when running in k8s; " +
-				"probably, `kubernetes_sd_config->api_server` is missing in Prometheus configs?")
-		}
-		if len(port) == 0 {
-			return nil, fmt.Errorf("cannot find KUBERNETES_SERVICE_PORT env var; it must be defined when running in k8s; "+
-				"KUBERNETES_SERVICE_HOST=%q", host)
-		}
-		apiServer = "https://" + net.JoinHostPort(host, port)
-		tlsConfig := promauth.TLSConfig{
-			CAFile: "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt",
+		kc, err = buildInClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("cannot build in-cluster config: %w", err)
 		}
-		acNew, err := promauth.NewConfig(".", nil, nil, "", "/var/run/secrets/kubernetes.io/serviceaccount/token", nil, &tlsConfig)
+	}
+	if kc != nil {
+		ac, err = promauth.NewConfig(".", nil, kc.basicAuth, kc.token, kc.tokenFile, nil, kc.tlsConfig)
 		if err != nil {
 			return nil, fmt.Errorf("cannot initialize service account auth: %w; probably, `kubernetes_sd_config->api_server` is missing in Prometheus configs?", err)
 		}
-		ac = acNew
+		apiServer = kc.server
+		ets = kc.execTokenSource
+		impersonateHeaders = kc.getImpersonateHeaders()
+		kubeConfigNamespace = kc.namespace
 	}
 	if !strings.Contains(apiServer, "://") {
 		proto := "http"
@@ -70,9 +58,13 @@ func newAPIConfig(sdc *SDConfig, baseDir string, swcFunc ScrapeWorkConstructorFu
 	for strings.HasSuffix(apiServer, "/") {
 		apiServer = apiServer[:len(apiServer)-1]
 	}
-	aw := newAPIWatcher(apiServer, ac, sdc, swcFunc)
+	if err := checkProxyURL(sdc.ProxyURL.GetURL()); err != nil {
+		return nil, fmt.Errorf("invalid `proxy_url`: %w", err)
+	}
+	aw := newAPIWatcher(apiServer, ac, ets, impersonateHeaders, sdc, kubeConfigNamespace, swcFunc)
 	cfg := &apiConfig{
-		aw: aw,
+		aw:              aw,
+		execTokenSource: ets,
 	}
 	return cfg, nil
 }
@@ -62,21 +62,14 @@ type apiWatcher struct {
 	swosCount *metrics.Counter
 }
 
-func newAPIWatcher(apiServer string, ac *promauth.Config, sdc *SDConfig, swcFunc ScrapeWorkConstructorFunc) *apiWatcher {
-	namespaces := sdc.Namespaces.Names
-	if len(namespaces) == 0 {
-		if sdc.Namespaces.OwnNamespace {
-			namespace, err := ioutil.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
-			if err != nil {
-				logger.Fatalf("cannot determine namespace for the current pod according to `own_namespace: true` option in kubernetes_sd_config: %s", err)
-			}
-			namespaces = []string{string(namespace)}
-		}
-	}
+func newAPIWatcher(apiServer string, ac *promauth.Config, ets *execTokenSource, impersonateHeaders http.Header, sdc *SDConfig, kubeConfigNamespace string, swcFunc ScrapeWorkConstructorFunc) *apiWatcher {
+	namespaces := getNamespaces(sdc, kubeConfigNamespace)
 	selectors := sdc.Selectors
 	attachNodeMetadata := sdc.AttachMetadata.Node
 	proxyURL := sdc.ProxyURL.GetURL()
-	gw := getGroupWatcher(apiServer, ac, namespaces, selectors, attachNodeMetadata, proxyURL)
+	// The explicitly set proxy url takes precedence over proxy from environment variables.
+	proxyFromEnvironment := sdc.ProxyFromEnvironment && proxyURL == nil
+	gw := getGroupWatcher(apiServer, ac, ets, impersonateHeaders, namespaces, selectors, attachNodeMetadata, proxyURL, proxyFromEnvironment)
 	role := sdc.role()
 	return &apiWatcher{
 		role:             role,
@@ -87,6 +80,27 @@ func newAPIWatcher(apiServer string, ac *promauth.Config, sdc *SDConfig, swcFunc
 	}
 }
 
+// getNamespaces returns namespaces to discover according to sdc.
+//
+// Namespaces from sdc take precedence over kubeConfigNamespace, which is the namespace from the kubeconfig context.
+// An empty result means all the namespaces must be discovered.
+func getNamespaces(sdc *SDConfig, kubeConfigNamespace string) []string {
+	if len(sdc.Namespaces.Names) > 0 {
+		return sdc.Namespaces.Names
+	}
+	if sdc.Namespaces.OwnNamespace {
+		namespace, err := ioutil.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+		if err != nil {
+			logger.Fatalf("cannot determine namespace for the current pod according to `own_namespace: true` option in kubernetes_sd_config: %s", err)
+		}
+		return []string{string(namespace)}
+	}
+	if kubeConfigNamespace != "" {
+		return []string{kubeConfigNamespace}
+	}
+	return nil
+}
+
 func (aw *apiWatcher) mustStart() {
 	aw.gw.startWatchersForRole(aw.role, aw)
 }
@@ -210,24 +224,38 @@ type groupWatcher struct {
 	getAuthHeader func() string
 	client        *http.Client
 
+	// impersonateHeaders contains `Impersonate-*` headers to send to apiServer.
+	// See https://kubernetes.io/docs/reference/access-authn-authz/authentication/#user-impersonation
+	impersonateHeaders http.Header
+
 	mu sync.Mutex
 	m  map[string]*urlWatcher
 }
 
-func newGroupWatcher(apiServer string, ac *promauth.Config, namespaces []string, selectors []Selector, attachNodeMetadata bool, proxyURL *url.URL) *groupWatcher {
-	var proxy func(*http.Request) (*url.URL, error)
-	if proxyURL != nil {
-		proxy = http.ProxyURL(proxyURL)
+func newGroupWatcher(apiServer string, ac *promauth.Config, ets *execTokenSource, impersonateHeaders http.Header, namespaces []string, selectors []Selector, attachNodeMetadata bool,
+	proxyURL *url.URL, proxyFromEnvironment bool) *groupWatcher {
+	tr := &http.Transport{
+		TLSHandshakeTimeout: 10 * time.Second,
+		IdleConnTimeout:     *apiServerTimeout,
+		MaxIdleConnsPerHost: 100,
+	}
+	if proxyURL != nil && proxyURL.Scheme == "socks5" {
+		dialContext, err := newSOCKS5DialContext(proxyURL)
+		if err != nil {
+			logger.Panicf("BUG: cannot create SOCKS5 dialer for Kubernetes API server: %s", err)
+		}
+		tr.DialContext = dialContext
+	} else {
+		tr.Proxy = newProxyFunc(proxyURL, proxyFromEnvironment)
 	}
 	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig:     ac.NewTLSConfig(),
-			Proxy:               proxy,
-			TLSHandshakeTimeout: 10 * time.Second,
-			IdleConnTimeout:     *apiServerTimeout,
-			MaxIdleConnsPerHost: 100,
-		},
-		Timeout: *apiServerTimeout,
+		// Use the round tripper, which picks up the rotated CA for Kubernetes API server without restart.
+		Transport: ac.NewRoundTripper(tr),
+		Timeout:   *apiServerTimeout,
+	}
+	getAuthHeader := ac.GetAuthHeader
+	if ets != nil {
+		getAuthHeader = ets.getAuthHeader
 	}
 	return &groupWatcher{
 		apiServer:          apiServer,
@@ -235,23 +263,44 @@ func newGroupWatcher(apiServer string, ac *promauth.Config, namespaces []string,
 		selectors:          selectors,
 		attachNodeMetadata: attachNodeMetadata,
 
-		getAuthHeader: ac.GetAuthHeader,
+		getAuthHeader: getAuthHeader,
 		client:        client,
 		m:             make(map[string]*urlWatcher),
+
+		impersonateHeaders: impersonateHeaders,
+	}
+}
+
+// newProxyFunc returns proxy func for http.Transport.
+//
+// The explicitly set proxyURL takes precedence over proxy from HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables,
+// which is used if proxyFromEnvironment is set. Requests are sent without proxy otherwise.
+func newProxyFunc(proxyURL *url.URL, proxyFromEnvironment bool) func(req *http.Request) (*url.URL, error) {
+	if proxyURL != nil {
+		return http.ProxyURL(proxyURL)
+	}
+	if proxyFromEnvironment {
+		return http.ProxyFromEnvironment
 	}
+	return nil
 }
 
-func getGroupWatcher(apiServer string, ac *promauth.Config, namespaces []string, selectors []Selector, attachNodeMetadata bool, proxyURL *url.URL) *groupWatcher {
+func getGroupWatcher(apiServer string, ac *promauth.Config, ets *execTokenSource, impersonateHeaders http.Header, namespaces []string, selectors []Selector, attachNodeMetadata bool,
+	proxyURL *url.URL, proxyFromEnvironment bool) *groupWatcher {
 	proxyURLStr := "<nil>"
 	if proxyURL != nil {
 		proxyURLStr = proxyURL.String()
 	}
-	key := fmt.Sprintf("apiServer=%s, namespaces=%s, selectors=%s, attachNodeMetadata=%v, proxyURL=%s, authConfig=%s",
-		apiServer, namespaces, selectorsKey(selectors), attachNodeMetadata, proxyURLStr, ac.String())
+	etsStr := "<nil>"
+	if ets != nil {
+		etsStr = ets.String()
+	}
+	key := fmt.Sprintf("apiServer=%s, namespaces=%s, selectors=%s, attachNodeMetadata=%v, proxyURL=%s, proxyFromEnvironment=%v, authConfig=%s, execTokenSource=%s, impersonateHeaders=%v",
+		apiServer, namespaces, selectorsKey(selectors), attachNodeMetadata, proxyURLStr, proxyFromEnvironment, ac.String(), etsStr, impersonateHeaders)
 	groupWatchersLock.Lock()
 	gw := groupWatchers[key]
 	if gw == nil {
-		gw = newGroupWatcher(apiServer, ac, namespaces, selectors, attachNodeMetadata, proxyURL)
+		gw = newGroupWatcher(apiServer, ac, ets, impersonateHeaders, namespaces, selectors, attachNodeMetadata, proxyURL, proxyFromEnvironment)
 		groupWatchers[key] = gw
 	}
 	groupWatchersLock.Unlock()
@@ -410,6 +459,9 @@ func (gw *groupWatcher) doRequest(requestURL string) (*http.Response, error) {
 	if ah := gw.getAuthHeader(); ah != "" {
 		req.Header.Set("Authorization", ah)
 	}
+	for name, values := range gw.impersonateHeaders {
+		req.Header[name] = values
+	}
 	resp, err := gw.client.Do(req)
 	if err != nil {
 		return nil, err
@@ -1,13 +1,23 @@
 package kubernetes
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/proxy"
 )
 
 func TestGetAPIPathsWithNamespaces(t *testing.T) {
@@ -166,6 +176,188 @@ func TestGetAPIPathsWithNamespaces(t *testing.T) {
 	})
 }
 
+func TestGetNamespaces(t *testing.T) {
+	f := func(names []string, kubeConfigNamespace string, expectedNamespaces []string) {
+		t.Helper()
+		sdc := &SDConfig{
+			Namespaces: Namespaces{
+				Names: names,
+			},
+		}
+		namespaces := getNamespaces(sdc, kubeConfigNamespace)
+		if !reflect.DeepEqual(namespaces, expectedNamespaces) {
+			t.Fatalf("unexpected namespaces; got %q; want %q", namespaces, expectedNamespaces)
+		}
+	}
+
+	// All the namespaces
+	f(nil, "", nil)
+
+	// Namespaces from kubernetes_sd_config
+	f([]string{"foo", "bar"}, "", []string{"foo", "bar"})
+
+	// Namespace from kubeconfig context
+	f(nil, "monitoring", []string{"monitoring"})
+
+	// Namespaces from kubernetes_sd_config take precedence over the namespace from kubeconfig context
+	f([]string{"foo"}, "monitoring", []string{"foo"})
+}
+
+func TestGroupWatcherDoRequestHeaders(t *testing.T) {
+	f := func(kc *kubeConfig, headersExpected map[string][]string) {
+		t.Helper()
+		var headers http.Header
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			headers = r.Header
+		}))
+		defer s.Close()
+		ac, err := promauth.NewConfig(".", nil, nil, "abc", "", nil, nil)
+		if err != nil {
+			t.Fatalf("cannot create auth config: %s", err)
+		}
+		gw := newGroupWatcher(s.URL, ac, nil, kc.getImpersonateHeaders(), nil, nil, false, nil, false)
+		resp, err := gw.doRequest(s.URL + "/api/v1/pods")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		_ = resp.Body.Close()
+		for name, valuesExpected := range headersExpected {
+			if values := headers[name]; !reflect.DeepEqual(values, valuesExpected) {
+				t.Fatalf("unexpected %s header; got %q; want %q", name, values, valuesExpected)
+			}
+		}
+	}
+	f(&kubeConfig{}, map[string][]string{
+		"Authorization":     {"Bearer abc"},
+		"Impersonate-User":  nil,
+		"Impersonate-Uid":   nil,
+		"Impersonate-Group": nil,
+	})
+	f(&kubeConfig{
+		impersonateUser: "team-a",
+	}, map[string][]string{
+		"Authorization":     {"Bearer abc"},
+		"Impersonate-User":  {"team-a"},
+		"Impersonate-Group": nil,
+	})
+	f(&kubeConfig{
+		impersonateUser: "team-a",
+		impersonateUID:  "1234",
+	}, map[string][]string{
+		"Authorization":    {"Bearer abc"},
+		"Impersonate-User": {"team-a"},
+		"Impersonate-Uid":  {"1234"},
+	})
+	f(&kubeConfig{
+		impersonateUser:   "team-a",
+		impersonateGroups: []string{"developers", "viewers"},
+		impersonateUserExtra: map[string][]string{
+			"scopes":                     {"view", "development"},
+			"acme.com/project":           {"foo"},
+			"example.org/some key%value": {"bar"},
+		},
+	}, map[string][]string{
+		"Authorization":                                      {"Bearer abc"},
+		"Impersonate-User":                                   {"team-a"},
+		"Impersonate-Group":                                  {"developers", "viewers"},
+		"Impersonate-Extra-Scopes":                           {"view", "development"},
+		"Impersonate-Extra-Acme.com%2fproject":               {"foo"},
+		"Impersonate-Extra-Example.org%2fsome%20key%25value": {"bar"},
+	})
+}
+
+func TestGroupWatcherDoRequestProxyURLPassword(t *testing.T) {
+	var proxyAuthHeader, requestURI string
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxyAuthHeader = r.Header.Get("Proxy-Authorization")
+		requestURI = r.RequestURI
+	}))
+	defer proxyServer.Close()
+
+	c := &Cluster{
+		ProxyURL:         proxy.MustNewURL(strings.Replace(proxyServer.URL, "http://", "http://proxy-user@", 1)),
+		ProxyURLPassword: "proxy-secret",
+	}
+	proxyURL, err := c.getProxyURL()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ac, err := promauth.NewConfig(".", nil, nil, "", "", nil, nil)
+	if err != nil {
+		t.Fatalf("cannot create auth config: %s", err)
+	}
+	apiServer := "http://some-server:8080"
+	gw := newGroupWatcher(apiServer, ac, nil, nil, nil, nil, false, proxyURL.GetURL(), false)
+	resp, err := gw.doRequest(apiServer + "/api/v1/pods")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_ = resp.Body.Close()
+	if requestURI != apiServer+"/api/v1/pods" {
+		t.Fatalf("the request must be sent via proxy; got request uri %q at proxy", requestURI)
+	}
+	authHeaderExpected := "Basic " + base64.StdEncoding.EncodeToString([]byte("proxy-user:proxy-secret"))
+	if proxyAuthHeader != authHeaderExpected {
+		t.Fatalf("unexpected Proxy-Authorization header; got %q; want %q", proxyAuthHeader, authHeaderExpected)
+	}
+}
+
+func TestGroupWatcherDoRequestTokenFileRotation(t *testing.T) {
+	var authHeaderLock sync.Mutex
+	var authHeader string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeaderLock.Lock()
+		authHeader = r.Header.Get("Authorization")
+		authHeaderLock.Unlock()
+	}))
+	defer s.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	writeToken := func(token string) {
+		t.Helper()
+		if err := ioutil.WriteFile(tokenFile, []byte(token), 0600); err != nil {
+			t.Fatalf("cannot write token file: %s", err)
+		}
+	}
+	writeToken("token-1")
+	kc := &kubeConfig{
+		server:    s.URL,
+		tokenFile: tokenFile,
+	}
+	ac, err := promauth.NewConfig(".", nil, kc.basicAuth, kc.token, kc.tokenFile, nil, kc.tlsConfig)
+	if err != nil {
+		t.Fatalf("cannot create auth config: %s", err)
+	}
+	gw := newGroupWatcher(s.URL, ac, nil, nil, nil, nil, false, nil, false)
+	waitForAuthHeader := func(authHeaderExpected string) {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			resp, err := gw.doRequest(s.URL + "/api/v1/pods")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			_ = resp.Body.Close()
+			authHeaderLock.Lock()
+			ah := authHeader
+			authHeaderLock.Unlock()
+			if ah == authHeaderExpected {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("unexpected Authorization header; got %q; want %q", ah, authHeaderExpected)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	waitForAuthHeader("Bearer token-1")
+
+	// Kubernetes periodically rotates the projected service account token.
+	// The rotated token must be picked up by the existing group watcher.
+	writeToken("token-2")
+	waitForAuthHeader("Bearer token-2")
+}
+
 func TestParseBookmark(t *testing.T) {
 	data := `{"kind": "Pod", "apiVersion": "v1", "metadata": {"resourceVersion": "12746"} }`
 	bm, err := parseBookmark([]byte(data))
@@ -1023,3 +1215,104 @@ func addAPIURLHandler(t *testing.T, mux *http.ServeMux, apiURL string, initObjec
 		_, _ = w.Write(initObjects)
 	})
 }
+
+func TestNewProxyFunc(t *testing.T) {
+	explicitProxyURL, err := url.Parse("http://explicit-proxy:3128")
+	if err != nil {
+		t.Fatalf("cannot parse proxy url: %s", err)
+	}
+	req, err := http.NewRequest(http.MethodGet, "https://kube-apiserver:6443", nil)
+	if err != nil {
+		t.Fatalf("cannot create request: %s", err)
+	}
+
+	// Proxy isn't used by default
+	if proxy := newProxyFunc(nil, false); proxy != nil {
+		t.Fatalf("unexpected proxy func when proxy isn't configured")
+	}
+
+	// Proxy from environment variables
+	if proxy := newProxyFunc(nil, true); proxy == nil {
+		t.Fatalf("missing proxy func for proxy from environment variables")
+	}
+
+	// The explicitly set proxy url takes precedence over environment variables
+	for _, proxyFromEnvironment := range []bool{false, true} {
+		proxy := newProxyFunc(explicitProxyURL, proxyFromEnvironment)
+		if proxy == nil {
+			t.Fatalf("missing proxy func for explicitly set proxy url")
+		}
+		pu, err := proxy(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if pu == nil || pu.String() != explicitProxyURL.String() {
+			t.Fatalf("unexpected proxy url for proxyFromEnvironment=%v; got %v; want %q", proxyFromEnvironment, pu, explicitProxyURL)
+		}
+	}
+}
+
+func TestNewProxyFuncFromEnvironment(t *testing.T) {
+	if os.Getenv("VM_TEST_NEW_PROXY_FUNC_FROM_ENVIRONMENT") == "" {
+		// http.ProxyFromEnvironment reads proxy environment variables only once per process,
+		// so run the test in a subprocess with the given proxy environment variables.
+		var env []string
+		for _, kv := range os.Environ() {
+			name := strings.ToUpper(kv)
+			if n := strings.IndexByte(name, '='); n >= 0 {
+				name = name[:n]
+			}
+			if name == "HTTP_PROXY" || name == "HTTPS_PROXY" || name == "NO_PROXY" || name == "REQUEST_METHOD" {
+				continue
+			}
+			env = append(env, kv)
+		}
+		env = append(env, "VM_TEST_NEW_PROXY_FUNC_FROM_ENVIRONMENT=1", "HTTPS_PROXY=http://env-proxy:3128", "NO_PROXY=no-proxy-host,.internal")
+		cmd := exec.Command(os.Args[0], "-test.run=^TestNewProxyFuncFromEnvironment$", "-test.count=1")
+		cmd.Env = env
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("unexpected error in the test subprocess: %s\n%s", err, out)
+		}
+		return
+	}
+
+	f := func(proxy func(req *http.Request) (*url.URL, error), reqURL, proxyURLExpected string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, reqURL, nil)
+		if err != nil {
+			t.Fatalf("cannot create request: %s", err)
+		}
+		pu, err := proxy(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		proxyURL := ""
+		if pu != nil {
+			proxyURL = pu.String()
+		}
+		if proxyURL != proxyURLExpected {
+			t.Fatalf("unexpected proxy url for %q; got %q; want %q", reqURL, proxyURL, proxyURLExpected)
+		}
+	}
+
+	proxy := newProxyFunc(nil, true)
+
+	// HTTPS_PROXY is used for https requests
+	f(proxy, "https://kube-apiserver:6443", "http://env-proxy:3128")
+
+	// NO_PROXY matches the host and the domain suffix
+	f(proxy, "https://no-proxy-host:6443", "")
+	f(proxy, "https://kube-apiserver.internal:6443", "")
+
+	// HTTP_PROXY isn't set, so http requests are sent without proxy
+	f(proxy, "http://kube-apiserver:8080", "")
+
+	// The explicitly set proxy url takes precedence over environment variables, including NO_PROXY
+	explicitProxyURL, err := url.Parse("http://explicit-proxy:3128")
+	if err != nil {
+		t.Fatalf("cannot parse proxy url: %s", err)
+	}
+	proxy = newProxyFunc(explicitProxyURL, true)
+	f(proxy, "https://kube-apiserver:6443", "http://explicit-proxy:3128")
+	f(proxy, "https://no-proxy-host:6443", "http://explicit-proxy:3128")
+}
@@ -1,8 +1,16 @@
 package kubernetes
 
 import (
+	"bytes"
 	"encoding/base64"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"gopkg.in/yaml.v2"
@@ -15,10 +23,17 @@ import (
 // apiConfig contains config for API server
 type apiConfig struct {
 	aw *apiWatcher
+
+	// execTokenSource is set if the token is obtained from exec plugin, auth-provider or `tokenEnv` configured in kubeconfig.
+	execTokenSource *execTokenSource
 }
 
 // Config represent configuration file for kubernetes API server connection
 // https://github.com/kubernetes/client-go/blob/master/tools/clientcmd/api/v1/types.go#L28
+//
+// VictoriaMetrics supports the following options, which are missing in kubectl:
+// `proxy-url-password`, `tls-min-version` and `tls-max-version` for clusters;
+// `client-key-password` and `tokenEnv` for users.
 type Config struct {
 	Kind       string `yaml:"kind,omitempty"`
 	APIVersion string `yaml:"apiVersion,omitempty"`
@@ -45,75 +60,170 @@ type Cluster struct {
 	CertificateAuthority     string     `yaml:"certificate-authority,omitempty"`
 	CertificateAuthorityData string     `yaml:"certificate-authority-data,omitempty"`
 	ProxyURL                 *proxy.URL `yaml:"proxy-url,omitempty"`
+
+	// ProxyURLPassword is the password for the user from ProxyURL.
+	//
+	// This is VictoriaMetrics extension, which allows keeping the password out of ProxyURL,
+	// so it cannot leak into logs and error messages together with the proxy url.
+	ProxyURLPassword string `yaml:"proxy-url-password,omitempty"`
+
+	// TLSMinVersion is the minimum TLS version for connections to Kubernetes API server.
+	// Supported values: TLS10, TLS11, TLS12, TLS13. The default minimum version from crypto/tls is used if it isn't set.
+	TLSMinVersion string `yaml:"tls-min-version,omitempty"`
+
+	// TLSMaxVersion is the maximum TLS version for connections to Kubernetes API server.
+	// It cannot be smaller than TLSMinVersion. The maximum version supported by crypto/tls is used if it isn't set.
+	TLSMaxVersion string `yaml:"tls-max-version,omitempty"`
+}
+
+// getProxyURL returns proxy url for c.
+//
+// The password from c.ProxyURLPassword is added to the returned url if it is set.
+func (c *Cluster) getProxyURL() (*proxy.URL, error) {
+	pu := c.ProxyURL.GetURL()
+	if err := checkProxyURL(pu); err != nil {
+		return nil, err
+	}
+	if len(c.ProxyURLPassword) == 0 {
+		return c.ProxyURL, nil
+	}
+	if pu == nil {
+		return nil, fmt.Errorf("`proxy-url-password` cannot be set without `proxy-url`")
+	}
+	if pu.User == nil || len(pu.User.Username()) == 0 {
+		return nil, fmt.Errorf("`proxy-url-password` requires username in `proxy-url`; for example, http://user@proxy:3128; got %s", pu.Redacted())
+	}
+	if _, ok := pu.User.Password(); ok {
+		return nil, fmt.Errorf("the password for `proxy-url` cannot be set simultaneously in `proxy-url` and in `proxy-url-password`")
+	}
+	puCopy := *pu
+	puCopy.User = url.UserPassword(pu.User.Username(), c.ProxyURLPassword)
+	return &proxy.URL{
+		URL: &puCopy,
+	}, nil
 }
 
 // AuthInfo contains information that describes identity information.  This is use to tell the kubernetes cluster who you are.
 type AuthInfo struct {
-	ClientCertificate     string `yaml:"client-certificate,omitempty"`
-	ClientCertificateData string `yaml:"client-certificate-data,omitempty"`
-	ClientKey             string `yaml:"client-key,omitempty"`
-	ClientKeyData         string `yaml:"client-key-data,omitempty"`
-	// TODO add support for it
-	Exec                 *ExecConfig `yaml:"exec,omitempty"`
-	Token                string      `yaml:"token,omitempty"`
-	TokenFile            string      `yaml:"tokenFile,omitempty"`
-	Impersonate          string      `yaml:"act-as,omitempty"`
-	ImpersonateUID       string      `yaml:"act-as-uid,omitempty"`
-	ImpersonateGroups    []string    `yaml:"act-as-groups,omitempty"`
-	ImpersonateUserExtra []string    `yaml:"act-as-user-extra,omitempty"`
-	Username             string      `yaml:"username,omitempty"`
-	Password             string      `yaml:"password,omitempty"`
+	ClientCertificate     string      `yaml:"client-certificate,omitempty"`
+	ClientCertificateData string      `yaml:"client-certificate-data,omitempty"`
+	ClientKey             string      `yaml:"client-key,omitempty"`
+	ClientKeyData         string      `yaml:"client-key-data,omitempty"`
+	Exec                  *ExecConfig `yaml:"exec,omitempty"`
+	Token                 string      `yaml:"token,omitempty"`
+	TokenFile             string      `yaml:"tokenFile,omitempty"`
+	Impersonate           string      `yaml:"act-as,omitempty"`
+	ImpersonateUID        string      `yaml:"act-as-uid,omitempty"`
+	ImpersonateGroups     []string    `yaml:"act-as-groups,omitempty"`
+	ImpersonateUserExtra  []string    `yaml:"act-as-user-extra,omitempty"`
+	Username              string      `yaml:"username,omitempty"`
+	Password              string      `yaml:"password,omitempty"`
+
+	// AuthProvider is the legacy auth-provider configuration. Only `gcp`, `oidc` and `azure` auth-providers are supported.
+	AuthProvider *AuthProviderConfig `yaml:"auth-provider,omitempty"`
+
+	// ClientKeyPassword is the password for the client key encrypted in PKCS#8 format.
+	// It is used for decrypting the key from ClientKey or ClientKeyData. The key must be unencrypted if ClientKeyPassword isn't set
+	// and it must be encrypted if ClientKeyPassword is set.
+	ClientKeyPassword string `yaml:"client-key-password,omitempty"`
+
+	// TokenEnv is the name of environment variable with bearer token.
+	// The token is read from the environment variable on every request, so token rotations are picked up without restart.
+	// It takes precedence over Token, while TokenFile takes precedence over it.
+	TokenEnv string `yaml:"tokenEnv,omitempty"`
 }
 
 func (au *AuthInfo) validate() error {
-	errContext := "field: %s is not supported currently, open an issue with feature request for it"
 	if au.Exec != nil {
-		return fmt.Errorf(errContext, "exec")
-	}
-	if len(au.ImpersonateUID) > 0 {
-		return fmt.Errorf(errContext, "act-as-uid")
+		if err := au.Exec.validate(); err != nil {
+			return err
+		}
 	}
-	if len(au.Impersonate) > 0 {
-		return fmt.Errorf(errContext, "act-as")
+	if au.AuthProvider != nil {
+		if au.Exec != nil {
+			return fmt.Errorf("`exec` and `auth-provider` cannot be set simultaneously")
+		}
+		if err := au.AuthProvider.validate(); err != nil {
+			return err
+		}
 	}
-	if len(au.ImpersonateGroups) > 0 {
-		return fmt.Errorf(errContext, "act-as-groups")
+	if len(au.ImpersonateUID) > 0 && len(au.Impersonate) == 0 {
+		return fmt.Errorf("`act-as-uid` requires `act-as` to be set, since uid cannot be impersonated without user")
 	}
-	if len(au.ImpersonateUserExtra) > 0 {
-		return fmt.Errorf(errContext, "act-as-user-extra")
+	if _, err := parseImpersonateUserExtra(au.ImpersonateUserExtra); err != nil {
+		return err
 	}
 	if len(au.Password) > 0 && len(au.Username) == 0 {
 		return fmt.Errorf("username cannot be empty, if password defined")
 	}
+	if credentials := au.getCredentialTypes(); len(credentials) > 1 {
+		return fmt.Errorf("mutually exclusive credentials are set: %s; only one of them can be used for authentication", strings.Join(credentials, ", "))
+	}
 	return nil
 }
 
+// getCredentialTypes returns the credential types set in au, which are sent in the Authorization header.
+//
+// Only a single credential type may be set, since otherwise it is non-obvious which of them is used for authentication.
+// Client certificate isn't returned, since it is used for TLS authentication and may be set together with the credentials
+// sent in the Authorization header.
+func (au *AuthInfo) getCredentialTypes() []string {
+	var credentials []string
+	if len(au.Username) > 0 || len(au.Password) > 0 {
+		credentials = append(credentials, "basic auth (`username`/`password`)")
+	}
+	if len(au.Token) > 0 || len(au.TokenEnv) > 0 || len(au.TokenFile) > 0 {
+		// The source for the bearer token is selected via au.getBearerTokenSource.
+		credentials = append(credentials, "bearer token (`token`/`tokenEnv`/`tokenFile`)")
+	}
+	if au.Exec != nil {
+		credentials = append(credentials, "`exec`")
+	}
+	if au.AuthProvider != nil {
+		credentials = append(credentials, "`auth-provider`")
+	}
+	return credentials
+}
+
+// getBearerTokenSource returns the source for bearer token from au.
+//
+// If multiple sources are set, then the following precedence is used: `tokenFile` > `tokenEnv` > `token`.
+func (au *AuthInfo) getBearerTokenSource() (token, tokenFile string, ets *execTokenSource) {
+	if au.TokenFile != "" {
+		return "", au.TokenFile, nil
+	}
+	if au.TokenEnv != "" {
+		return "", "", newEnvTokenSource(au.TokenEnv)
+	}
+	return au.Token, "", nil
+}
+
 // ExecConfig contains information about os.command, that returns auth token for kubernetes cluster connection
 type ExecConfig struct {
 	// Command to execute.
-	Command string `json:"command"`
+	Command string `yaml:"command"`
 	// Arguments to pass to the command when executing it.
-	Args []string `json:"args"`
+	Args []string `yaml:"args,omitempty"`
 	// Env defines additional environment variables to expose to the process. These
 	// are unioned with the host's environment, as well as variables client-go uses
 	// to pass argument to the plugin.
-	Env []ExecEnvVar `json:"env"`
+	Env []ExecEnvVar `yaml:"env,omitempty"`
 
 	// Preferred input version of the ExecInfo. The returned ExecCredentials MUST use
 	// the same encoding version as the input.
-	APIVersion string `json:"apiVersion,omitempty"`
+	APIVersion string `yaml:"apiVersion,omitempty"`
 
 	// This text is shown to the user when the executable doesn't seem to be
 	// present. For example, `brew install foo-cli` might be a good InstallHint for
 	// foo-cli on Mac OS systems.
-	InstallHint string `json:"installHint,omitempty"`
+	InstallHint string `yaml:"installHint,omitempty"`
 
 	// ProvideClusterInfo determines whether or not to provide cluster information,
 	// which could potentially contain very large CA data, to this exec plugin as a
 	// part of the KUBERNETES_EXEC_INFO environment variable. By default, it is set
 	// to false. Package k8s.io/client-go/tools/auth/exec provides helper methods for
 	// reading this environment variable.
-	ProvideClusterInfo bool `json:"provideClusterInfo"`
+	ProvideClusterInfo bool `yaml:"provideClusterInfo,omitempty"`
 
 	// InteractiveMode determines this plugin's relationship with standard input. Valid
 	// values are "Never" (this exec plugin never uses standard input), "IfAvailable" (this
@@ -125,59 +235,111 @@ type ExecConfig struct {
 	// client.authentication.k8s.io/v1beta1, then this field is optional and defaults
 	// to "IfAvailable" when unset. Otherwise, this field is required.
 	//+optional
-	InteractiveMode string `json:"interactiveMode,omitempty"`
+	InteractiveMode string `yaml:"interactiveMode,omitempty"`
+
+	// cluster is passed to the exec plugin in KUBERNETES_EXEC_INFO env var if ProvideClusterInfo is set.
+	cluster *ExecCluster
 }
 
 // ExecEnvVar is used for setting environment variables when executing an exec-based
 // credential plugin.
 type ExecEnvVar struct {
-	Name  string `json:"name"`
-	Value string `json:"value"`
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
 }
 
 // Context is a tuple of references to a cluster and AuthInfo
 type Context struct {
-	Cluster  string `yaml:"cluster"`
-	AuthInfo string `yaml:"user"`
+	Cluster   string `yaml:"cluster"`
+	AuthInfo  string `yaml:"user"`
+	Namespace string `yaml:"namespace,omitempty"`
 }
 
 type kubeConfig struct {
 	basicAuth *promauth.BasicAuthConfig
 	server    string
 	token     string
+
+	// tokenFile is the path to the file with bearer token.
+	//
+	// The file is periodically re-read by promauth.Config.GetAuthHeader,
+	// so the token rotated by Kubernetes is picked up without restart.
 	tokenFile string
+
 	tlsConfig *promauth.TLSConfig
 	proxyURL  *proxy.URL
+
+	// impersonateUser is the user to act as in requests to Kubernetes API server.
+	impersonateUser string
+
+	// impersonateUID is the uid of the user to act as in requests to Kubernetes API server.
+	impersonateUID string
+
+	// impersonateGroups are the groups to act as in requests to Kubernetes API server.
+	impersonateGroups []string
+
+	// impersonateUserExtra contains extra fields for the user to act as in requests to Kubernetes API server.
+	impersonateUserExtra map[string][]string
+
+	// execTokenSource is set if the token must be obtained from exec plugin, from auth-provider or from `tokenEnv`.
+	execTokenSource *execTokenSource
+
+	// namespace is the default namespace from the kubeconfig context.
+	//
+	// It is used for discovery if `namespaces` aren't set in kubernetes_sd_config.
+	namespace string
 }
 
 func buildConfig(sdc *SDConfig) (*kubeConfig, error) {
-
-	data, err := fs.ReadFileOrHTTP(sdc.KubeConfig)
-	if err != nil {
-		return nil, fmt.Errorf("cannot read kubeConfig from %q: %w", sdc.KubeConfig, err)
+	kubeConfigPaths := splitKubeConfigPaths(sdc.KubeConfig)
+	if len(kubeConfigPaths) == 0 {
+		return nil, fmt.Errorf("missing kubeconfig path in `kubeconfig_file` option")
 	}
-	var config Config
-	if err = yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("cannot parse %q: %w", sdc.KubeConfig, err)
+	configs := make([]*Config, 0, len(kubeConfigPaths))
+	for _, kubeConfigPath := range kubeConfigPaths {
+		config, err := readKubeConfig(kubeConfigPath)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, config)
 	}
 
+	// Merge kubeconfig files in the same way as kubectl does for KUBECONFIG env var:
+	// the first file, which sets the given cluster, user, context or current-context, wins.
 	authInfos := make(map[string]*AuthInfo)
-	for _, obj := range config.AuthInfos {
-		authInfos[obj.Name] = obj.AuthInfo
-	}
 	clusterInfos := make(map[string]*Cluster)
-	for _, obj := range config.Clusters {
-		clusterInfos[obj.Name] = obj.Cluster
-	}
 	contexts := make(map[string]*Context)
-	for _, obj := range config.Contexts {
-		contexts[obj.Name] = obj.Context
+	currentContext := ""
+	for _, config := range configs {
+		for _, obj := range config.AuthInfos {
+			if _, ok := authInfos[obj.Name]; !ok {
+				authInfos[obj.Name] = obj.AuthInfo
+			}
+		}
+		for _, obj := range config.Clusters {
+			if _, ok := clusterInfos[obj.Name]; !ok {
+				clusterInfos[obj.Name] = obj.Cluster
+			}
+		}
+		for _, obj := range config.Contexts {
+			if _, ok := contexts[obj.Name]; !ok {
+				contexts[obj.Name] = obj.Context
+			}
+		}
+		if currentContext == "" {
+			currentContext = config.CurrentContext
+		}
 	}
 
-	contextName := config.CurrentContext
+	contextName := currentContext
+	contextSource := "current-context"
+	if sdc.Context != "" {
+		contextName = sdc.Context
+		contextSource = "kubeconfig_context"
+	}
 	configContext := contexts[contextName]
 	if configContext == nil {
-		return nil, fmt.Errorf("context %q does not exist", contextName)
+		return nil, fmt.Errorf("context %q does not exist; it is set via `%s` option", contextName, contextSource)
 	}
 
 	clusterInfoName := configContext.Cluster
@@ -196,16 +358,30 @@ func buildConfig(sdc *SDConfig) (*kubeConfig, error) {
 		return nil, fmt.Errorf("auth info %q does not exist", authInfoName)
 	}
 
+	var err error
 	var tlsConfig *promauth.TLSConfig
 	var basicAuth *promauth.BasicAuthConfig
-	var token, tokenFile string
+	var token, tokenFile, impersonateUser, impersonateUID string
+	var impersonateGroups []string
+	var impersonateUserExtra map[string][]string
+	var ets *execTokenSource
 	isHTTPS := strings.HasPrefix(configClusterInfo.Server, "https://")
 
+	proxyURL, err := configClusterInfo.getProxyURL()
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy configuration for cluster %q: %w", clusterInfoName, err)
+	}
+
 	if isHTTPS {
 		tlsConfig = &promauth.TLSConfig{
 			CAFile:             configClusterInfo.CertificateAuthority,
 			ServerName:         configClusterInfo.TLSServerName,
 			InsecureSkipVerify: configClusterInfo.InsecureSkipTLSVerify,
+			MinVersion:         configClusterInfo.TLSMinVersion,
+			MaxVersion:         configClusterInfo.TLSMaxVersion,
+		}
+		if _, _, err := tlsConfig.ParseVersions(); err != nil {
+			return nil, fmt.Errorf("invalid `tls-min-version` or `tls-max-version` for cluster %q: %w", clusterInfoName, err)
 		}
 	}
 
@@ -236,6 +412,23 @@ func buildConfig(sdc *SDConfig) (*kubeConfig, error) {
 					return nil, fmt.Errorf("cannot base64-decode configAuthInfo.ClientKeyData %q: %w", configClusterInfo.CertificateAuthorityData, err)
 				}
 			}
+			if len(tlsConfig.Cert) > 0 && len(tlsConfig.Key) == 0 && tlsConfig.KeyFile == "" {
+				// client-certificate-data may contain both the certificate and the key.
+				if cert, key := splitCertKeyPEM(tlsConfig.Cert); len(key) > 0 {
+					tlsConfig.Cert = cert
+					tlsConfig.Key = key
+				}
+			}
+			if tlsConfig.CertFile != "" && tlsConfig.KeyFile == "" && len(tlsConfig.Key) == 0 {
+				// client-certificate may point to the file with both the certificate and the key.
+				// Use this file as the key file. tls.LoadX509KeyPair picks up only certificates from the certificate file
+				// and only the key from the key file, so there is no need in splitting the file contents.
+				// This also preserves re-reading the file on every TLS handshake, so rotated certificates are picked up.
+				tlsConfig.KeyFile = tlsConfig.CertFile
+			}
+			if err := decryptTLSClientKey(tlsConfig, configAuthInfo.ClientKeyPassword, authInfoName); err != nil {
+				return nil, fmt.Errorf("invalid user auth configuration for context: %s, err: %w", contextName, err)
+			}
 		}
 
 		if len(configAuthInfo.Username) > 0 || len(configAuthInfo.Password) > 0 {
@@ -244,8 +437,43 @@ func buildConfig(sdc *SDConfig) (*kubeConfig, error) {
 				Password: promauth.NewSecret(configAuthInfo.Password),
 			}
 		}
-		token = configAuthInfo.Token
-		tokenFile = configAuthInfo.TokenFile
+		token, tokenFile, ets = configAuthInfo.getBearerTokenSource()
+		if ets != nil {
+			// Obtain the token in order to verify the environment variable is set.
+			if _, err := ets.getToken(); err != nil {
+				return nil, fmt.Errorf("cannot obtain token for context: %s, err: %w", contextName, err)
+			}
+		}
+		impersonateUser = configAuthInfo.Impersonate
+		impersonateUID = configAuthInfo.ImpersonateUID
+		impersonateGroups = configAuthInfo.ImpersonateGroups
+		impersonateUserExtra, err = parseImpersonateUserExtra(configAuthInfo.ImpersonateUserExtra)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user auth configuration for context: %s, err: %w", contextName, err)
+		}
+		if configAuthInfo.Exec != nil {
+			if configAuthInfo.Exec.ProvideClusterInfo {
+				configAuthInfo.Exec.cluster, err = newExecCluster(configClusterInfo)
+				if err != nil {
+					return nil, fmt.Errorf("cannot obtain cluster info for exec plugin for context: %s, err: %w", contextName, err)
+				}
+			}
+			ets = newExecTokenSource(configAuthInfo.Exec)
+			// Obtain the token in order to verify the exec plugin works.
+			if _, err := ets.getToken(); err != nil {
+				return nil, fmt.Errorf("cannot obtain token for context: %s, err: %w", contextName, err)
+			}
+		}
+		if configAuthInfo.AuthProvider != nil {
+			ets, err = newAuthProviderTokenSource(configAuthInfo.AuthProvider)
+			if err != nil {
+				return nil, fmt.Errorf("cannot initialize auth-provider for context: %s, err: %w", contextName, err)
+			}
+			// Obtain the token in order to verify the auth-provider works.
+			if _, err := ets.getToken(); err != nil {
+				return nil, fmt.Errorf("cannot obtain token for context: %s, err: %w", contextName, err)
+			}
+		}
 	}
 
 	kc := kubeConfig{
@@ -254,8 +482,252 @@ func buildConfig(sdc *SDConfig) (*kubeConfig, error) {
 		token:     token,
 		tokenFile: tokenFile,
 		tlsConfig: tlsConfig,
-		proxyURL:  configClusterInfo.ProxyURL,
+		proxyURL:  proxyURL,
+
+		impersonateUser:      impersonateUser,
+		impersonateUID:       impersonateUID,
+		impersonateGroups:    impersonateGroups,
+		impersonateUserExtra: impersonateUserExtra,
+		execTokenSource:      ets,
+
+		namespace: configContext.Namespace,
 	}
 
 	return &kc, nil
 }
+
+// decryptTLSClientKey decrypts the client key at tlsConfig with the given password if the key is encrypted.
+//
+// The key from tlsConfig.KeyFile is loaded into tlsConfig.Key together with the certificate if it is encrypted,
+// since promauth cannot load encrypted keys. Such keys aren't re-read on rotation.
+func decryptTLSClientKey(tlsConfig *promauth.TLSConfig, password, authInfoName string) error {
+	if len(tlsConfig.Key) > 0 {
+		key, err := decryptClientKey(tlsConfig.Key, password, fmt.Sprintf("client-key-data for user %q", authInfoName))
+		if err != nil {
+			return err
+		}
+		tlsConfig.Key = key
+		return nil
+	}
+	if tlsConfig.KeyFile == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(tlsConfig.KeyFile)
+	if err != nil {
+		// Leave the error reporting to promauth.
+		return nil
+	}
+	key, err := decryptClientKey(data, password, fmt.Sprintf("%q", tlsConfig.KeyFile))
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(key, data) {
+		// The key isn't encrypted.
+		return nil
+	}
+	if len(tlsConfig.Cert) == 0 {
+		tlsConfig.Cert, err = ioutil.ReadFile(tlsConfig.CertFile)
+		if err != nil {
+			return fmt.Errorf("cannot read client certificate: %w", err)
+		}
+	}
+	tlsConfig.Key = key
+	tlsConfig.CertFile = ""
+	tlsConfig.KeyFile = ""
+	return nil
+}
+
+// splitCertKeyPEM splits PEM data with bundled certificate and private key into separate certificate and key PEM data.
+//
+// Empty key is returned if data doesn't contain private key.
+func splitCertKeyPEM(data []byte) ([]byte, []byte) {
+	var cert, key []byte
+	for {
+		block, rest := pem.Decode(data)
+		if block == nil {
+			return cert, key
+		}
+		if block.Type == "PRIVATE KEY" || strings.HasSuffix(block.Type, " PRIVATE KEY") {
+			key = append(key, pem.EncodeToMemory(block)...)
+		} else {
+			cert = append(cert, pem.EncodeToMemory(block)...)
+		}
+		data = rest
+	}
+}
+
+// inClusterServiceAccountDir is the directory with service account credentials mounted into Kubernetes pods.
+//
+// See https://kubernetes.io/docs/reference/access-authn-authz/service-accounts-admin/#service-account-admission-controller
+var inClusterServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// buildInClusterConfig returns kubeConfig for the service account of the Kubernetes pod vmagent runs in.
+//
+// The token is re-read from the projected service account token file, so its rotation is picked up automatically.
+func buildInClusterConfig() (*kubeConfig, error) {
+	host := os.Getenv("KUBERNETES_SERVICE_HOST")
+	port := os.Getenv("KUBERNETES_SERVICE_PORT")
+	if len(host) == 0 {
+		return nil, fmt.Errorf("cannot find KUBERNETES_SERVICE_HOST env var; it must be defined when running in k8s; " +
+			"`kubeconfig_file` or `api_server` option must be set in `kubernetes_sd_configs` when running outside k8s")
+	}
+	if len(port) == 0 {
+		return nil, fmt.Errorf("cannot find KUBERNETES_SERVICE_PORT env var; it must be defined when running in k8s; "+
+			"KUBERNETES_SERVICE_HOST=%q", host)
+	}
+	tokenFile := filepath.Join(inClusterServiceAccountDir, "token")
+	if _, err := os.Stat(tokenFile); err != nil {
+		return nil, fmt.Errorf("cannot find service account token for in-cluster config: %w", err)
+	}
+	kc := &kubeConfig{
+		server:    "https://" + net.JoinHostPort(host, port),
+		tokenFile: tokenFile,
+		tlsConfig: &promauth.TLSConfig{
+			CAFile: filepath.Join(inClusterServiceAccountDir, "ca.crt"),
+		},
+	}
+	return kc, nil
+}
+
+// splitKubeConfigPaths splits kubeConfigPaths list separated by OS-specific path list separator in the same way as KUBECONFIG env var is split.
+//
+// Empty entries are skipped. The host with optional port in http(s) urls may contain the path list separator, so it is skipped when searching for the separator.
+func splitKubeConfigPaths(kubeConfigPaths string) []string {
+	var paths []string
+	s := kubeConfigPaths
+	for len(s) > 0 {
+		n := 0
+		if strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") {
+			n = strings.Index(s, "://") + len("://")
+			m := strings.IndexByte(s[n:], '/')
+			if m < 0 {
+				m = len(s) - n
+			}
+			n += m
+		}
+		path := s
+		s = ""
+		if m := strings.IndexByte(path[n:], filepath.ListSeparator); m >= 0 {
+			s = path[n+m+1:]
+			path = path[:n+m]
+		}
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// readKubeConfig reads and parses kubeconfig from kubeConfigPath.
+//
+// Relative paths in the returned config are resolved against the directory with kubeConfigPath in the same way as kubectl does.
+func readKubeConfig(kubeConfigPath string) (*Config, error) {
+	data, err := fs.ReadFileOrHTTP(kubeConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read kubeConfig from %q: %w", kubeConfigPath, err)
+	}
+	var config Config
+	if err = yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("cannot parse %q: %w", kubeConfigPath, err)
+	}
+	kubeConfigDir := getKubeConfigDir(kubeConfigPath)
+	for _, obj := range config.Clusters {
+		if c := obj.Cluster; c != nil {
+			c.CertificateAuthority = resolveKubeConfigPath(kubeConfigDir, c.CertificateAuthority)
+		}
+	}
+	for _, obj := range config.AuthInfos {
+		if au := obj.AuthInfo; au != nil {
+			au.ClientCertificate = resolveKubeConfigPath(kubeConfigDir, au.ClientCertificate)
+			au.ClientKey = resolveKubeConfigPath(kubeConfigDir, au.ClientKey)
+		}
+	}
+	return &config, nil
+}
+
+// getKubeConfigDir returns the directory with kubeConfigPath for resolving relative paths in kubeconfig.
+//
+// An empty string is returned if kubeconfig is obtained via http(s), since it has no local directory.
+func getKubeConfigDir(kubeConfigPath string) string {
+	if strings.HasPrefix(kubeConfigPath, "http://") || strings.HasPrefix(kubeConfigPath, "https://") {
+		return ""
+	}
+	return filepath.Dir(kubeConfigPath)
+}
+
+// resolveKubeConfigPath returns path for the file referred from kubeconfig located at kubeConfigDir.
+//
+// Absolute paths and urls are returned as is.
+func resolveKubeConfigPath(kubeConfigDir, path string) string {
+	if kubeConfigDir == "" || path == "" {
+		return path
+	}
+	return fs.GetFilepath(kubeConfigDir, path)
+}
+
+// parseImpersonateUserExtra parses `act-as-user-extra` entries in the form `key=value`.
+func parseImpersonateUserExtra(extra []string) (map[string][]string, error) {
+	if len(extra) == 0 {
+		return nil, nil
+	}
+	m := make(map[string][]string, len(extra))
+	for _, kv := range extra {
+		n := strings.IndexByte(kv, '=')
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid `act-as-user-extra` entry %q; it must have `key=value` format", kv)
+		}
+		key := kv[:n]
+		m[key] = append(m[key], kv[n+1:])
+	}
+	return m, nil
+}
+
+// getImpersonateHeaders returns headers for impersonation in requests to Kubernetes API server.
+//
+// See https://kubernetes.io/docs/reference/access-authn-authz/authentication/#user-impersonation
+func (kc *kubeConfig) getImpersonateHeaders() http.Header {
+	h := make(http.Header)
+	if kc.impersonateUser != "" {
+		h.Set("Impersonate-User", kc.impersonateUser)
+	}
+	if kc.impersonateUID != "" {
+		h.Set("Impersonate-Uid", kc.impersonateUID)
+	}
+	for _, group := range kc.impersonateGroups {
+		h.Add("Impersonate-Group", group)
+	}
+	for key, values := range kc.impersonateUserExtra {
+		for _, value := range values {
+			h.Add("Impersonate-Extra-"+headerKeyEscape(key), value)
+		}
+	}
+	if len(h) == 0 {
+		return nil
+	}
+	return h
+}
+
+// headerKeyEscape escapes key for using it in `Impersonate-Extra-<key>` header name.
+//
+// Bytes, which aren't allowed in header names, and `%` are percent-encoded in the same way as Kubernetes does.
+// See https://github.com/kubernetes/kubernetes/blob/master/staging/src/k8s.io/client-go/transport/round_trippers.go
+func headerKeyEscape(key string) string {
+	var sb strings.Builder
+	for i := 0; i < len(key); i++ {
+		b := key[i]
+		if b == '%' || !isHeaderKeyByte(b) {
+			fmt.Fprintf(&sb, "%%%02X", b)
+			continue
+		}
+		sb.WriteByte(b)
+	}
+	return sb.String()
+}
+
+// isHeaderKeyByte returns true if b is allowed in header names according to https://datatracker.ietf.org/doc/html/rfc7230#section-3.2.6
+func isHeaderKeyByte(b byte) bool {
+	if b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' {
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", b) >= 0
+}
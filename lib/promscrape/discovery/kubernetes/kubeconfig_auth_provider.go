@@ -0,0 +1,71 @@
+package kubernetes
+
+import (
+	"fmt"
+	"time"
+)
+
+// AuthProviderConfig contains the configuration for auth-provider in kubeconfig.
+//
+// See https://github.com/kubernetes/client-go/blob/master/tools/clientcmd/api/v1/types.go
+type AuthProviderConfig struct {
+	Name   string            `yaml:"name"`
+	Config map[string]string `yaml:"config,omitempty"`
+}
+
+// authProviderRequestTimeout is the timeout for requests to identity providers made by auth-providers.
+const authProviderRequestTimeout = 10 * time.Second
+
+// authProvider obtains credentials for auth-provider configured in kubeconfig.
+type authProvider interface {
+	// getCredential returns new credential. It is called by execTokenSource when the previously obtained token is about to expire.
+	getCredential() (*ExecCredentialStatus, error)
+
+	// String returns human-readable description for the auth-provider.
+	String() string
+}
+
+func (ap *AuthProviderConfig) validate() error {
+	switch ap.Name {
+	case authProviderGCP:
+		return nil
+	case authProviderOIDC:
+		return ap.validateOIDC()
+	case authProviderAzure:
+		return ap.validateAzure()
+	case "":
+		return fmt.Errorf("missing `name` in `auth-provider` section")
+	default:
+		return fmt.Errorf("unsupported `auth-provider`: %q; only %q, %q and %q auth-providers are supported; "+
+			"use exec-based credential plugin in `exec` section instead; see https://kubernetes.io/docs/reference/access-authn-authz/authentication/#client-go-credential-plugins",
+			ap.Name, authProviderGCP, authProviderOIDC, authProviderAzure)
+	}
+}
+
+// newAuthProvider returns authProvider for the given ap.
+//
+// ap must be validated with ap.validate() before calling this function.
+func newAuthProvider(ap *AuthProviderConfig) (authProvider, error) {
+	switch ap.Name {
+	case authProviderGCP:
+		return newGCPAuthProvider(ap)
+	case authProviderOIDC:
+		return newOIDCAuthProvider(ap)
+	case authProviderAzure:
+		return newAzureAuthProvider(ap)
+	default:
+		return nil, fmt.Errorf("BUG: unexpected `auth-provider`: %q", ap.Name)
+	}
+}
+
+// newAuthProviderTokenSource returns token source for the auth-provider from ap.
+func newAuthProviderTokenSource(ap *AuthProviderConfig) (*execTokenSource, error) {
+	p, err := newAuthProvider(ap)
+	if err != nil {
+		return nil, err
+	}
+	return &execTokenSource{
+		getCredential: p.getCredential,
+		desc:          p.String(),
+	}, nil
+}
@@ -0,0 +1,201 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// authProviderAzure is the name of auth-provider, which is used in kubeconfig files for AKS clusters with Azure Active Directory integration.
+//
+// See https://github.com/kubernetes/client-go/blob/release-1.21/plugin/pkg/client/auth/azure/azure.go
+const authProviderAzure = "azure"
+
+// azureActiveDirectoryEndpoints contains Azure Active Directory endpoints for the supported Azure environments.
+//
+// See https://github.com/Azure/go-autorest/blob/master/autorest/azure/environments.go
+var azureActiveDirectoryEndpoints = map[string]string{
+	"azurepubliccloud":       "https://login.microsoftonline.com/",
+	"azurechinacloud":        "https://login.chinacloudapi.cn/",
+	"azureusgovernmentcloud": "https://login.microsoftonline.us/",
+	"azuregermancloud":       "https://login.microsoftonline.de/",
+}
+
+func (ap *AuthProviderConfig) validateAzure() error {
+	for _, key := range []string{"tenant-id", "client-id", "apiserver-id"} {
+		if ap.Config[key] == "" {
+			return fmt.Errorf("missing `%s` in `config` section of `auth-provider: %s`", key, authProviderAzure)
+		}
+	}
+	if ap.Config["access-token"] == "" && ap.Config["refresh-token"] == "" {
+		return fmt.Errorf("`access-token` or `refresh-token` must be set in `config` section of `auth-provider: %s`", authProviderAzure)
+	}
+	if _, err := ap.getAzureActiveDirectoryEndpoint(); err != nil {
+		return err
+	}
+	switch ap.Config["config-mode"] {
+	case "", "0", "1":
+	default:
+		return fmt.Errorf("unsupported `config-mode` in `config` section of `auth-provider: %s`: %q; supported values: 0, 1", authProviderAzure, ap.Config["config-mode"])
+	}
+	if s := ap.Config["expires-on"]; s != "" {
+		if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+			return fmt.Errorf("cannot parse `expires-on` in `config` section of `auth-provider: %s`: %w", authProviderAzure, err)
+		}
+	}
+	return nil
+}
+
+// getAzureActiveDirectoryEndpoint returns Azure Active Directory endpoint for the `environment` from ap.
+func (ap *AuthProviderConfig) getAzureActiveDirectoryEndpoint() (string, error) {
+	env := ap.Config["environment"]
+	if env == "" {
+		env = "AzurePublicCloud"
+	}
+	endpoint, ok := azureActiveDirectoryEndpoints[strings.ToLower(env)]
+	if !ok {
+		return "", fmt.Errorf("unsupported `environment` in `config` section of `auth-provider: %s`: %q; "+
+			"supported values: AzurePublicCloud, AzureChinaCloud, AzureUSGovernmentCloud, AzureGermanCloud", authProviderAzure, env)
+	}
+	return endpoint, nil
+}
+
+// azureAuthProvider obtains access tokens for azure auth-provider.
+//
+// The access token from kubeconfig is used until it expires. Then it is refreshed with the refresh token
+// at Azure Active Directory token endpoint. The refreshed tokens are kept in memory only,
+// e.g. they aren't written back to kubeconfig file unlike kubectl does.
+type azureAuthProvider struct {
+	tokenURL    string
+	clientID    string
+	apiserverID string
+	resource    string
+	client      *http.Client
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	accessToken  string
+	refreshToken string
+
+	// expiration is the expiration time for accessToken. Zero value means the accessToken must be refreshed.
+	expiration time.Time
+}
+
+func newAzureAuthProvider(ap *AuthProviderConfig) (*azureAuthProvider, error) {
+	cfg := ap.Config
+	endpoint, err := ap.getAzureActiveDirectoryEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	resource := cfg["apiserver-id"]
+	if cfg["config-mode"] != "1" {
+		// The default config mode requires `spn:` prefix for the resource.
+		resource = "spn:" + resource
+	}
+	p := &azureAuthProvider{
+		tokenURL:    endpoint + url.PathEscape(cfg["tenant-id"]) + "/oauth2/token?api-version=1.0",
+		clientID:    cfg["client-id"],
+		apiserverID: cfg["apiserver-id"],
+		resource:    resource,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+			},
+			Timeout: authProviderRequestTimeout,
+		},
+		accessToken:  cfg["access-token"],
+		refreshToken: cfg["refresh-token"],
+	}
+	if s := cfg["expires-on"]; s != "" {
+		expiresOn, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse `expires-on` in `config` section of `auth-provider: %s`: %w", authProviderAzure, err)
+		}
+		p.expiration = time.Unix(expiresOn, 0)
+	}
+	return p, nil
+}
+
+// getCredential implements authProvider interface.
+//
+// It returns the current access token if it isn't close to expiration. Otherwise the access token is refreshed.
+func (p *azureAuthProvider) getCredential() (*ExecCredentialStatus, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.accessToken == "" || !time.Now().Add(execTokenRefreshInterval).Before(p.expiration) {
+		if p.refreshToken == "" {
+			return nil, fmt.Errorf("cannot refresh expired `access-token`, since `refresh-token` is missing")
+		}
+		if err := p.refreshLocked(); err != nil {
+			return nil, err
+		}
+	}
+	expiration := p.expiration
+	return &ExecCredentialStatus{
+		Token:               p.accessToken,
+		ExpirationTimestamp: &expiration,
+	}, nil
+}
+
+// refreshLocked obtains new access token from Azure Active Directory with the refresh token.
+//
+// The refresh token is updated if Azure Active Directory returns new one.
+func (p *azureAuthProvider) refreshLocked() error {
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {p.clientID},
+		"refresh_token": {p.refreshToken},
+		"resource":      {p.resource},
+	}
+	resp, err := p.client.PostForm(p.tokenURL, form)
+	if err != nil {
+		return fmt.Errorf("cannot refresh access token: %w", err)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("cannot read response from %q: %w", p.tokenURL, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code returned from %q: %d; expecting %d; response body: %q", p.tokenURL, resp.StatusCode, http.StatusOK, data)
+	}
+	var token struct {
+		AccessToken  string      `json:"access_token"`
+		RefreshToken string      `json:"refresh_token"`
+		ExpiresIn    json.Number `json:"expires_in"`
+		ExpiresOn    json.Number `json:"expires_on"`
+	}
+	if err := json.Unmarshal(data, &token); err != nil {
+		return fmt.Errorf("cannot parse response from %q: %w", p.tokenURL, err)
+	}
+	if token.AccessToken == "" {
+		return fmt.Errorf("missing access_token in the response from %q", p.tokenURL)
+	}
+	var expiration time.Time
+	if expiresOn, err := token.ExpiresOn.Int64(); err == nil {
+		expiration = time.Unix(expiresOn, 0)
+	} else if expiresIn, err := token.ExpiresIn.Int64(); err == nil {
+		expiration = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	} else {
+		return fmt.Errorf("missing expires_on and expires_in in the response from %q", p.tokenURL)
+	}
+	p.accessToken = token.AccessToken
+	p.expiration = expiration
+	if token.RefreshToken != "" {
+		p.refreshToken = token.RefreshToken
+	}
+	return nil
+}
+
+// String implements authProvider interface.
+func (p *azureAuthProvider) String() string {
+	return fmt.Sprintf("auth-provider(name=%q, client-id=%q, apiserver-id=%q)", authProviderAzure, p.clientID, p.apiserverID)
+}
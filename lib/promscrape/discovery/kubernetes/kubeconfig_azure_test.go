@@ -0,0 +1,287 @@
+package kubernetes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAzureActiveDirectory is Azure Active Directory token endpoint for tests.
+type fakeAzureActiveDirectory struct {
+	s *httptest.Server
+
+	mu sync.Mutex
+
+	// expiresIn is the lifetime for access tokens issued by fad.
+	expiresIn time.Duration
+
+	// useExpiresIn instructs fad to return expires_in instead of expires_on.
+	useExpiresIn bool
+
+	refreshTokens []string
+	resources     []string
+}
+
+func newFakeAzureActiveDirectory(t *testing.T) *fakeAzureActiveDirectory {
+	fad := &fakeAzureActiveDirectory{
+		expiresIn: time.Hour,
+	}
+	fad.s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tenant1/oauth2/token" {
+			http.Error(w, fmt.Sprintf("unexpected path %q", r.URL.Path), http.StatusNotFound)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if gt := r.PostForm.Get("grant_type"); gt != "refresh_token" {
+			http.Error(w, fmt.Sprintf("unexpected grant_type=%q", gt), http.StatusBadRequest)
+			return
+		}
+		if clientID := r.PostForm.Get("client_id"); clientID != "client1" {
+			http.Error(w, fmt.Sprintf("unexpected client_id=%q", clientID), http.StatusBadRequest)
+			return
+		}
+		refreshToken := r.PostForm.Get("refresh_token")
+		if refreshToken == "revoked" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"error":"invalid_grant"}`)
+			return
+		}
+
+		fad.mu.Lock()
+		defer fad.mu.Unlock()
+		fad.refreshTokens = append(fad.refreshTokens, refreshToken)
+		fad.resources = append(fad.resources, r.PostForm.Get("resource"))
+		n := len(fad.refreshTokens)
+		expiresIn := int64(fad.expiresIn.Seconds())
+		w.Header().Set("Content-Type", "application/json")
+		if fad.useExpiresIn {
+			fmt.Fprintf(w, `{"token_type":"Bearer","access_token":"access-token%d","refresh_token":"refresh-token%d","expires_in":"%d"}`,
+				n, n+1, expiresIn)
+			return
+		}
+		fmt.Fprintf(w, `{"token_type":"Bearer","access_token":"access-token%d","refresh_token":"refresh-token%d","expires_in":"%d","expires_on":"%d"}`,
+			n, n+1, expiresIn, time.Now().Unix()+expiresIn)
+	}))
+	t.Cleanup(fad.s.Close)
+	return fad
+}
+
+func (fad *fakeAzureActiveDirectory) getRequests() ([]string, []string) {
+	fad.mu.Lock()
+	defer fad.mu.Unlock()
+	return append([]string{}, fad.refreshTokens...), append([]string{}, fad.resources...)
+}
+
+func newTestAzureTokenSource(t *testing.T, fad *fakeAzureActiveDirectory, config map[string]string) *execTokenSource {
+	t.Helper()
+	cfg := map[string]string{
+		"tenant-id":    "tenant1",
+		"client-id":    "client1",
+		"apiserver-id": "apiserver1",
+	}
+	for k, v := range config {
+		cfg[k] = v
+	}
+	ap := &AuthProviderConfig{
+		Name:   authProviderAzure,
+		Config: cfg,
+	}
+	if err := ap.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	p, err := newAzureAuthProvider(ap)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	p.tokenURL = fad.s.URL + "/tenant1/oauth2/token"
+	return &execTokenSource{
+		getCredential: p.getCredential,
+		desc:          p.String(),
+	}
+}
+
+func TestBuildConfigAuthProviderAzure(t *testing.T) {
+	kc, err := buildConfig(&SDConfig{
+		KubeConfig: "testdata/good_kubeconfig/with_auth_provider_azure.yaml",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ets := kc.execTokenSource
+	if ets == nil {
+		t.Fatalf("missing token source for azure auth-provider")
+	}
+	// The access-token from kubeconfig doesn't expire until 2100, so it must be used without refreshing.
+	if ah := ets.getAuthHeader(); ah != "Bearer azure-access-token" {
+		t.Fatalf("unexpected auth header; got %q; want %q", ah, "Bearer azure-access-token")
+	}
+	if kc.token != "" || kc.tokenFile != "" {
+		t.Fatalf("token and tokenFile must be empty; got token=%q, tokenFile=%q", kc.token, kc.tokenFile)
+	}
+	sExpected := `auth-provider(name="azure", client-id="80faf920-1908-4b52-b5ef-a8e7bedfc67a", apiserver-id="6dae42f8-4368-4678-94ff-3960e28e3630")`
+	if s := ets.String(); s != sExpected {
+		t.Fatalf("unexpected string representation for token source; got %s; want %s", s, sExpected)
+	}
+}
+
+func TestAzureTokenSourceRefresh(t *testing.T) {
+	fad := newFakeAzureActiveDirectory(t)
+	fad.expiresIn = 30 * time.Second
+	ets := newTestAzureTokenSource(t, fad, map[string]string{
+		"access-token":  "expired-access-token",
+		"refresh-token": "refresh-token1",
+		"expires-on":    fmt.Sprintf("%d", time.Now().Add(-time.Minute).Unix()),
+	})
+	f := func(tokenExpected string, refreshTokensExpected []string) {
+		t.Helper()
+		token, err := ets.getToken()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if token != tokenExpected {
+			t.Fatalf("unexpected token; got %q; want %q", token, tokenExpected)
+		}
+		refreshTokens, resources := fad.getRequests()
+		if strings.Join(refreshTokens, ",") != strings.Join(refreshTokensExpected, ",") {
+			t.Fatalf("unexpected refresh tokens passed to Azure Active Directory; got %q; want %q", refreshTokens, refreshTokensExpected)
+		}
+		for _, resource := range resources {
+			if resource != "spn:apiserver1" {
+				t.Fatalf("unexpected resource passed to Azure Active Directory; got %q; want %q", resource, "spn:apiserver1")
+			}
+		}
+	}
+
+	// The expired access-token must be refreshed.
+	// The access-token, which expires in less than a minute, must be refreshed with the refresh token returned by Azure Active Directory.
+	f("access-token1", []string{"refresh-token1"})
+	f("access-token2", []string{"refresh-token1", "refresh-token2"})
+
+	// The refreshed access-token must be cached until it is close to expiration.
+	fad.mu.Lock()
+	fad.expiresIn = time.Hour
+	fad.useExpiresIn = true
+	fad.mu.Unlock()
+	f("access-token3", []string{"refresh-token1", "refresh-token2", "refresh-token3"})
+	f("access-token3", []string{"refresh-token1", "refresh-token2", "refresh-token3"})
+}
+
+func TestAzureTokenSourceConfigMode(t *testing.T) {
+	fad := newFakeAzureActiveDirectory(t)
+	ets := newTestAzureTokenSource(t, fad, map[string]string{
+		"refresh-token": "refresh-token1",
+		"config-mode":   "1",
+	})
+	token, err := ets.getToken()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if token != "access-token1" {
+		t.Fatalf("unexpected token; got %q; want %q", token, "access-token1")
+	}
+	// The resource must be passed without `spn:` prefix in config-mode 1.
+	_, resources := fad.getRequests()
+	if len(resources) != 1 || resources[0] != "apiserver1" {
+		t.Fatalf("unexpected resources passed to Azure Active Directory; got %q; want %q", resources, []string{"apiserver1"})
+	}
+}
+
+func TestAzureTokenSourceFailure(t *testing.T) {
+	fad := newFakeAzureActiveDirectory(t)
+	f := func(config map[string]string, errExpected string) {
+		t.Helper()
+		ets := newTestAzureTokenSource(t, fad, config)
+		token, err := ets.getToken()
+		if err == nil {
+			t.Fatalf("expecting non-nil error; got token %q", token)
+		}
+		if !strings.Contains(err.Error(), errExpected) {
+			t.Fatalf("unexpected error; got %q; want it to contain %q", err, errExpected)
+		}
+	}
+	expiresOn := fmt.Sprintf("%d", time.Now().Add(-time.Minute).Unix())
+
+	// Missing refresh-token for expired access-token
+	f(map[string]string{
+		"access-token": "access-token",
+		"expires-on":   expiresOn,
+	}, "`refresh-token` is missing")
+
+	// Missing refresh-token for access-token without expires-on
+	f(map[string]string{
+		"access-token": "access-token",
+	}, "`refresh-token` is missing")
+
+	// Revoked refresh-token
+	f(map[string]string{
+		"access-token":  "access-token",
+		"refresh-token": "revoked",
+		"expires-on":    expiresOn,
+	}, "invalid_grant")
+}
+
+func TestAuthProviderAzureValidateFailure(t *testing.T) {
+	f := func(config map[string]string, errExpected string) {
+		t.Helper()
+		ap := &AuthProviderConfig{
+			Name:   authProviderAzure,
+			Config: config,
+		}
+		err := ap.validate()
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if !strings.Contains(err.Error(), errExpected) {
+			t.Fatalf("unexpected error; got %q; want it to contain %q", err, errExpected)
+		}
+	}
+	f(map[string]string{
+		"client-id":    "client1",
+		"apiserver-id": "apiserver1",
+		"access-token": "access-token",
+	}, "missing `tenant-id`")
+	f(map[string]string{
+		"tenant-id":    "tenant1",
+		"apiserver-id": "apiserver1",
+		"access-token": "access-token",
+	}, "missing `client-id`")
+	f(map[string]string{
+		"tenant-id":    "tenant1",
+		"client-id":    "client1",
+		"access-token": "access-token",
+	}, "missing `apiserver-id`")
+	f(map[string]string{
+		"tenant-id":    "tenant1",
+		"client-id":    "client1",
+		"apiserver-id": "apiserver1",
+	}, "`access-token` or `refresh-token` must be set")
+	f(map[string]string{
+		"tenant-id":    "tenant1",
+		"client-id":    "client1",
+		"apiserver-id": "apiserver1",
+		"access-token": "access-token",
+		"environment":  "AzureMarsCloud",
+	}, "unsupported `environment`")
+	f(map[string]string{
+		"tenant-id":    "tenant1",
+		"client-id":    "client1",
+		"apiserver-id": "apiserver1",
+		"access-token": "access-token",
+		"config-mode":  "2",
+	}, "unsupported `config-mode`")
+	f(map[string]string{
+		"tenant-id":    "tenant1",
+		"client-id":    "client1",
+		"apiserver-id": "apiserver1",
+		"access-token": "access-token",
+		"expires-on":   "tomorrow",
+	}, "cannot parse `expires-on`")
+}
@@ -0,0 +1,278 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// The list of supported API versions for exec-based credential plugins.
+//
+// See https://kubernetes.io/docs/reference/access-authn-authz/authentication/#client-go-credential-plugins
+const (
+	execAPIVersionV1Beta1 = "client.authentication.k8s.io/v1beta1"
+	execAPIVersionV1      = "client.authentication.k8s.io/v1"
+)
+
+// ExecCredential is used by exec-based credential plugins for passing credentials to the client.
+//
+// See https://github.com/kubernetes/client-go/blob/master/pkg/apis/clientauthentication/v1/types.go
+type ExecCredential struct {
+	Kind       string                `json:"kind"`
+	APIVersion string                `json:"apiVersion"`
+	Spec       ExecCredentialSpec    `json:"spec"`
+	Status     *ExecCredentialStatus `json:"status,omitempty"`
+}
+
+// ExecCredentialSpec holds request and runtime specific information provided by the client to exec plugin.
+type ExecCredentialSpec struct {
+	Interactive bool `json:"interactive"`
+
+	// Cluster is set only if `provideClusterInfo: true` is set in `exec` section.
+	Cluster *ExecCluster `json:"cluster,omitempty"`
+}
+
+// ExecCluster contains information about the Kubernetes cluster, which is passed to exec plugin.
+//
+// See https://github.com/kubernetes/client-go/blob/master/pkg/apis/clientauthentication/v1/types.go
+type ExecCluster struct {
+	Server                   string `json:"server"`
+	TLSServerName            string `json:"tls-server-name,omitempty"`
+	InsecureSkipTLSVerify    bool   `json:"insecure-skip-tls-verify,omitempty"`
+	CertificateAuthorityData []byte `json:"certificate-authority-data,omitempty"`
+	ProxyURL                 string `json:"proxy-url,omitempty"`
+}
+
+// newExecCluster returns cluster information for passing to exec plugin from the given c.
+func newExecCluster(c *Cluster) (*ExecCluster, error) {
+	ec := &ExecCluster{
+		Server:                c.Server,
+		TLSServerName:         c.TLSServerName,
+		InsecureSkipTLSVerify: c.InsecureSkipTLSVerify,
+	}
+	proxyURL, err := c.getProxyURL()
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL != nil {
+		ec.ProxyURL = proxyURL.String()
+	}
+	if len(c.CertificateAuthorityData) > 0 {
+		ca, err := base64.StdEncoding.DecodeString(c.CertificateAuthorityData)
+		if err != nil {
+			return nil, fmt.Errorf("cannot base64-decode certificate-authority-data %q: %w", c.CertificateAuthorityData, err)
+		}
+		ec.CertificateAuthorityData = ca
+	} else if len(c.CertificateAuthority) > 0 {
+		ca, err := ioutil.ReadFile(c.CertificateAuthority)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read certificate-authority: %w", err)
+		}
+		ec.CertificateAuthorityData = ca
+	}
+	return ec, nil
+}
+
+// ExecCredentialStatus holds credentials returned by exec plugin.
+type ExecCredentialStatus struct {
+	ExpirationTimestamp *time.Time `json:"expirationTimestamp,omitempty"`
+	Token               string     `json:"token,omitempty"`
+}
+
+// The list of supported values for ExecConfig.InteractiveMode.
+//
+// See https://kubernetes.io/docs/reference/config-api/client-authentication.v1/
+const (
+	execInteractiveModeNever       = "Never"
+	execInteractiveModeIfAvailable = "IfAvailable"
+	execInteractiveModeAlways      = "Always"
+)
+
+func (ec *ExecConfig) validate() error {
+	if len(ec.Command) == 0 {
+		return fmt.Errorf("missing `command` in `exec` section")
+	}
+	switch ec.InteractiveMode {
+	case "", execInteractiveModeNever, execInteractiveModeIfAvailable:
+	case execInteractiveModeAlways:
+		return fmt.Errorf("`interactiveMode: %s` isn't supported in `exec` section, since exec plugin %q cannot get standard input from terminal when running headless; "+
+			"use exec plugin, which can obtain credentials without user interaction", ec.InteractiveMode, ec.Command)
+	default:
+		return fmt.Errorf("unsupported `interactiveMode` in `exec` section: %q; supported values: %q, %q", ec.InteractiveMode, execInteractiveModeNever, execInteractiveModeIfAvailable)
+	}
+	switch ec.APIVersion {
+	case execAPIVersionV1Beta1, execAPIVersionV1:
+		return nil
+	case "":
+		return fmt.Errorf("missing `apiVersion` in `exec` section; supported values: %q, %q", execAPIVersionV1Beta1, execAPIVersionV1)
+	default:
+		return fmt.Errorf("unsupported `apiVersion` in `exec` section: %q; supported values: %q, %q", ec.APIVersion, execAPIVersionV1Beta1, execAPIVersionV1)
+	}
+}
+
+// execPluginTimeout is the maximum duration for the exec plugin execution.
+//
+// The plugin is killed if it doesn't finish in this time, so hanging plugin cannot block obtaining tokens forever.
+var execPluginTimeout = 30 * time.Second
+
+// getCredential executes the exec plugin from ec and returns the credential obtained from it.
+func (ec *ExecConfig) getCredential() (*ExecCredentialStatus, error) {
+	execInfo, err := json.Marshal(&ExecCredential{
+		Kind:       "ExecCredential",
+		APIVersion: ec.APIVersion,
+		Spec: ExecCredentialSpec{
+			// The exec plugin is always executed without terminal.
+			Interactive: false,
+			Cluster:     ec.cluster,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal ExecCredential for exec plugin: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), execPluginTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, ec.Command, ec.Args...)
+	cmd.Env = os.Environ()
+	for _, env := range ec.Env {
+		cmd.Env = append(cmd.Env, env.Name+"="+env.Value)
+	}
+	cmd.Env = append(cmd.Env, "KUBERNETES_EXEC_INFO="+string(execInfo))
+	// Standard input isn't available for exec plugin, so it must read EOF from it instead of waiting for user input.
+	cmd.Stdin = strings.NewReader("")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("the plugin didn't finish in %s", execPluginTimeout)
+		}
+		errMsg := fmt.Sprintf("cannot execute exec plugin %q: %s; stderr: %q", ec.Command, err, strings.TrimSpace(stderr.String()))
+		if len(ec.InstallHint) > 0 {
+			errMsg += "; " + ec.InstallHint
+		}
+		return nil, fmt.Errorf("%s", errMsg)
+	}
+
+	var cred ExecCredential
+	if err := json.Unmarshal(stdout.Bytes(), &cred); err != nil {
+		return nil, fmt.Errorf("cannot parse ExecCredential returned by exec plugin %q: %w", ec.Command, err)
+	}
+	if cred.Kind != "ExecCredential" {
+		return nil, fmt.Errorf("unexpected kind returned by exec plugin %q: %q; want %q", ec.Command, cred.Kind, "ExecCredential")
+	}
+	if cred.APIVersion != ec.APIVersion {
+		return nil, fmt.Errorf("exec plugin %q returned apiVersion=%q, while it must match the requested apiVersion=%q", ec.Command, cred.APIVersion, ec.APIVersion)
+	}
+	if cred.Status == nil || len(cred.Status.Token) == 0 {
+		return nil, fmt.Errorf("exec plugin %q didn't return `status.token`", ec.Command)
+	}
+	return cred.Status, nil
+}
+
+// execTokenRefreshInterval is the duration before token expiration when the exec plugin must be executed again.
+const execTokenRefreshInterval = time.Minute
+
+// execTokenSource caches the token returned by exec plugin, by auth-provider or from `tokenEnv` until it is close to expiration.
+type execTokenSource struct {
+	// getCredential obtains new credential from exec plugin or from auth-provider.
+	getCredential func() (*ExecCredentialStatus, error)
+
+	// desc is human-readable description for the source of credentials.
+	desc string
+
+	// mu prevents from concurrent execution of the exec plugin by multiple watchers.
+	//
+	// The exec plugin execution is limited by execPluginTimeout, so mu cannot be held forever.
+	mu sync.Mutex
+
+	token string
+
+	// expiration is the token expiration time. Zero value means the token never expires.
+	expiration time.Time
+}
+
+func newExecTokenSource(ec *ExecConfig) *execTokenSource {
+	// Environment variable values may contain secrets, so only their names are put into the description,
+	// which is used in logs.
+	envNames := make([]string, len(ec.Env))
+	for i, e := range ec.Env {
+		envNames[i] = e.Name
+	}
+	return &execTokenSource{
+		getCredential: ec.getCredential,
+		desc:          fmt.Sprintf("exec(command=%q, args=%q, envNames=%q, apiVersion=%q)", ec.Command, ec.Args, envNames, ec.APIVersion),
+	}
+}
+
+// newEnvTokenSource returns token source, which reads the token from the environment variable with the given envName.
+//
+// The token is read from the environment variable on every getToken call,
+// since the returned credential expires immediately.
+func newEnvTokenSource(envName string) *execTokenSource {
+	return &execTokenSource{
+		getCredential: func() (*ExecCredentialStatus, error) {
+			token := os.Getenv(envName)
+			if token == "" {
+				return nil, fmt.Errorf("missing token in %q environment variable set via `tokenEnv`", envName)
+			}
+			expiration := time.Now()
+			return &ExecCredentialStatus{
+				Token:               token,
+				ExpirationTimestamp: &expiration,
+			}, nil
+		},
+		desc: fmt.Sprintf("tokenEnv(%q)", envName),
+	}
+}
+
+// getToken returns the cached token or obtains a new token if the cached token is missing or is about to expire.
+//
+// The previously obtained token is returned if the new token cannot be obtained and the previous token isn't expired yet.
+func (ets *execTokenSource) getToken() (string, error) {
+	ets.mu.Lock()
+	defer ets.mu.Unlock()
+
+	now := time.Now()
+	if ets.token != "" && (ets.expiration.IsZero() || now.Add(execTokenRefreshInterval).Before(ets.expiration)) {
+		return ets.token, nil
+	}
+	status, err := ets.getCredential()
+	if err != nil {
+		if ets.token != "" && now.Before(ets.expiration) {
+			logger.Warnf("cannot refresh token; using the previously obtained token, which expires at %s: %s", ets.expiration.Format(time.RFC3339), err)
+			return ets.token, nil
+		}
+		return "", err
+	}
+	ets.token = status.Token
+	ets.expiration = time.Time{}
+	if status.ExpirationTimestamp != nil {
+		ets.expiration = *status.ExpirationTimestamp
+	}
+	return ets.token, nil
+}
+
+// getAuthHeader returns `Authorization` header value with the token obtained from ets.
+func (ets *execTokenSource) getAuthHeader() string {
+	token, err := ets.getToken()
+	if err != nil {
+		logger.Errorf("cannot obtain token from %s: %s", ets.desc, err)
+		return ""
+	}
+	return "Bearer " + token
+}
+
+// String returns human-readable representation for ets.
+func (ets *execTokenSource) String() string {
+	return ets.desc
+}
@@ -0,0 +1,91 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// authProviderGCP is the name of auth-provider, which is used in kubeconfig files generated by older versions of gcloud for GKE clusters.
+const authProviderGCP = "gcp"
+
+// defaultGCPScopes is the default list of scopes for access tokens obtained by gcp auth-provider.
+//
+// See https://github.com/kubernetes/client-go/blob/release-1.25/plugin/pkg/client/auth/gcp/gcp.go
+var defaultGCPScopes = []string{
+	"https://www.googleapis.com/auth/cloud-platform",
+	"https://www.googleapis.com/auth/userinfo.email",
+}
+
+// getGCPScopes returns scopes for gcp auth-provider.
+//
+// Scopes may be overridden via comma-separated `scopes` option in `config` section of `auth-provider`.
+func (ap *AuthProviderConfig) getGCPScopes() []string {
+	s := ap.Config["scopes"]
+	if s == "" {
+		return defaultGCPScopes
+	}
+	var scopes []string
+	for _, scope := range strings.Split(s, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// gcpAuthProvider obtains access tokens for gcp auth-provider.
+//
+// Access tokens are obtained from Google Application Default Credentials.
+// See https://cloud.google.com/docs/authentication/production
+type gcpAuthProvider struct {
+	ts     oauth2.TokenSource
+	scopes []string
+}
+
+func newGCPAuthProvider(ap *AuthProviderConfig) (*gcpAuthProvider, error) {
+	scopes := ap.getGCPScopes()
+	ts, err := newGCPOAuth2TokenSource(scopes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain Google Application Default Credentials for `auth-provider: %s`: %w", authProviderGCP, err)
+	}
+	return &gcpAuthProvider{
+		ts:     ts,
+		scopes: scopes,
+	}, nil
+}
+
+// getCredential implements authProvider interface.
+func (p *gcpAuthProvider) getCredential() (*ExecCredentialStatus, error) {
+	token, err := p.ts.Token()
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain access token from Google Application Default Credentials: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("empty access token returned from Google Application Default Credentials")
+	}
+	status := &ExecCredentialStatus{
+		Token: token.AccessToken,
+	}
+	if !token.Expiry.IsZero() {
+		expiry := token.Expiry
+		status.ExpirationTimestamp = &expiry
+	}
+	return status, nil
+}
+
+// String implements authProvider interface.
+func (p *gcpAuthProvider) String() string {
+	return fmt.Sprintf("auth-provider(name=%q, scopes=%q)", authProviderGCP, p.scopes)
+}
+
+// newGCPOAuth2TokenSource returns oauth2.TokenSource for Google Application Default Credentials with the given scopes.
+//
+// It may be overridden in tests.
+var newGCPOAuth2TokenSource = func(scopes []string) (oauth2.TokenSource, error) {
+	return google.DefaultTokenSource(context.Background(), scopes...)
+}
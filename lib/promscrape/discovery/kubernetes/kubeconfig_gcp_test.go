@@ -0,0 +1,181 @@
+package kubernetes
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// fakeTokenSource is oauth2.TokenSource for tests.
+type fakeTokenSource struct {
+	mu     sync.Mutex
+	token  *oauth2.Token
+	err    error
+	tokens int
+}
+
+func (fts *fakeTokenSource) Token() (*oauth2.Token, error) {
+	fts.mu.Lock()
+	defer fts.mu.Unlock()
+	fts.tokens++
+	if fts.err != nil {
+		return nil, fts.err
+	}
+	return fts.token, nil
+}
+
+func (fts *fakeTokenSource) set(accessToken string, expiry time.Time, err error) {
+	fts.mu.Lock()
+	fts.token = &oauth2.Token{
+		AccessToken: accessToken,
+		Expiry:      expiry,
+	}
+	fts.err = err
+	fts.mu.Unlock()
+}
+
+func (fts *fakeTokenSource) getTokens() int {
+	fts.mu.Lock()
+	defer fts.mu.Unlock()
+	return fts.tokens
+}
+
+func setFakeGCPTokenSource(t *testing.T, fts *fakeTokenSource, err error) *[]string {
+	t.Helper()
+	var scopes []string
+	prev := newGCPOAuth2TokenSource
+	newGCPOAuth2TokenSource = func(s []string) (oauth2.TokenSource, error) {
+		scopes = s
+		if err != nil {
+			return nil, err
+		}
+		return fts, nil
+	}
+	t.Cleanup(func() {
+		newGCPOAuth2TokenSource = prev
+	})
+	return &scopes
+}
+
+func TestBuildConfigAuthProviderGCP(t *testing.T) {
+	fts := &fakeTokenSource{}
+	fts.set("gcp-token", time.Now().Add(time.Hour), nil)
+	scopes := setFakeGCPTokenSource(t, fts, nil)
+
+	kc, err := buildConfig(&SDConfig{
+		KubeConfig: "testdata/good_kubeconfig/with_auth_provider_gcp.yaml",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	scopesExpected := []string{"https://www.googleapis.com/auth/cloud-platform", "https://www.googleapis.com/auth/compute"}
+	if !reflect.DeepEqual(*scopes, scopesExpected) {
+		t.Fatalf("unexpected scopes; got %q; want %q", *scopes, scopesExpected)
+	}
+	ets := kc.execTokenSource
+	if ets == nil {
+		t.Fatalf("missing token source for gcp auth-provider")
+	}
+	if ah := ets.getAuthHeader(); ah != "Bearer gcp-token" {
+		t.Fatalf("unexpected auth header; got %q; want %q", ah, "Bearer gcp-token")
+	}
+	if kc.token != "" || kc.tokenFile != "" {
+		t.Fatalf("token and tokenFile must be empty; got token=%q, tokenFile=%q", kc.token, kc.tokenFile)
+	}
+	if s := ets.String(); !strings.Contains(s, `auth-provider(name="gcp"`) {
+		t.Fatalf("unexpected string representation for token source: %s", s)
+	}
+}
+
+func TestBuildConfigAuthProviderFailure(t *testing.T) {
+	f := func(kubeConfigPath string, adcErr, tokenErr error, errExpected string) {
+		t.Helper()
+		fts := &fakeTokenSource{}
+		fts.set("gcp-token", time.Now().Add(time.Hour), tokenErr)
+		setFakeGCPTokenSource(t, fts, adcErr)
+		_, err := buildConfig(&SDConfig{
+			KubeConfig: kubeConfigPath,
+		})
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if !strings.Contains(err.Error(), errExpected) {
+			t.Fatalf("unexpected error; got %q; want it to contain %q", err, errExpected)
+		}
+	}
+
+	// Unsupported auth-provider
+	f("testdata/bad_kubeconfig/auth_provider_unsupported.yaml", nil, nil, "use exec-based credential plugin")
+
+	// auth-provider together with exec
+	f("testdata/bad_kubeconfig/auth_provider_with_exec.yaml", nil, nil, "`exec` and `auth-provider` cannot be set simultaneously")
+
+	// Missing Application Default Credentials
+	f("testdata/good_kubeconfig/with_auth_provider_gcp.yaml", fmt.Errorf("could not find default credentials"), nil, "could not find default credentials")
+
+	// Failure when obtaining the access token
+	f("testdata/good_kubeconfig/with_auth_provider_gcp.yaml", nil, fmt.Errorf("invalid_grant"), "invalid_grant")
+}
+
+func TestGCPTokenSourceRefresh(t *testing.T) {
+	fts := &fakeTokenSource{}
+	setFakeGCPTokenSource(t, fts, nil)
+	ets, err := newAuthProviderTokenSource(&AuthProviderConfig{
+		Name: authProviderGCP,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f := func(tokenExpected string, tokensExpected int) {
+		t.Helper()
+		token, err := ets.getToken()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if token != tokenExpected {
+			t.Fatalf("unexpected token; got %q; want %q", token, tokenExpected)
+		}
+		if n := fts.getTokens(); n != tokensExpected {
+			t.Fatalf("unexpected number of token requests; got %d; want %d", n, tokensExpected)
+		}
+	}
+
+	// The token isn't refreshed until it is close to expiration.
+	fts.set("token1", time.Now().Add(time.Hour), nil)
+	f("token1", 1)
+	fts.set("token2", time.Now().Add(time.Hour), nil)
+	f("token1", 1)
+
+	// The token, which expires in less than a minute, is refreshed before expiration.
+	ets.expiration = time.Now().Add(30 * time.Second)
+	f("token2", 2)
+
+	// The previous non-expired token is returned if the token cannot be refreshed.
+	ets.expiration = time.Now().Add(30 * time.Second)
+	fts.set("token3", time.Time{}, fmt.Errorf("network error"))
+	f("token2", 3)
+
+	// The error is returned if the previous token is expired.
+	ets.expiration = time.Now().Add(-time.Second)
+	token, err := ets.getToken()
+	if err == nil {
+		t.Fatalf("expecting non-nil error; got token %q", token)
+	}
+	if !strings.Contains(err.Error(), "network error") {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ah := ets.getAuthHeader(); ah != "" {
+		t.Fatalf("unexpected non-empty auth header: %q", ah)
+	}
+
+	// Default scopes must be used if scopes aren't set in auth-provider config.
+	scopes := (&AuthProviderConfig{Name: authProviderGCP}).getGCPScopes()
+	if !reflect.DeepEqual(scopes, defaultGCPScopes) {
+		t.Fatalf("unexpected default scopes; got %q; want %q", scopes, defaultGCPScopes)
+	}
+}
@@ -0,0 +1,211 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"golang.org/x/oauth2"
+)
+
+// authProviderOIDC is the name of auth-provider, which authenticates with OpenID Connect id token.
+//
+// See https://kubernetes.io/docs/reference/access-authn-authz/authentication/#using-kubectl
+const authProviderOIDC = "oidc"
+
+func (ap *AuthProviderConfig) validateOIDC() error {
+	if ap.Config["idp-issuer-url"] == "" {
+		return fmt.Errorf("missing `idp-issuer-url` in `config` section of `auth-provider: %s`", authProviderOIDC)
+	}
+	if ap.Config["client-id"] == "" {
+		return fmt.Errorf("missing `client-id` in `config` section of `auth-provider: %s`", authProviderOIDC)
+	}
+	if ap.Config["id-token"] == "" && ap.Config["refresh-token"] == "" {
+		return fmt.Errorf("`id-token` or `refresh-token` must be set in `config` section of `auth-provider: %s`", authProviderOIDC)
+	}
+	return nil
+}
+
+// oidcAuthProvider obtains id tokens for oidc auth-provider.
+//
+// The id token from kubeconfig is used until it expires. Then it is refreshed with the refresh token
+// at the token endpoint of the issuer. The refreshed tokens are kept in memory only,
+// e.g. they aren't written back to kubeconfig file unlike kubectl does.
+type oidcAuthProvider struct {
+	issuerURL    string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	idToken      string
+	refreshToken string
+
+	// tokenURL is the token endpoint obtained from the issuer via OpenID Connect discovery.
+	tokenURL string
+}
+
+func newOIDCAuthProvider(ap *AuthProviderConfig) (*oidcAuthProvider, error) {
+	cfg := ap.Config
+	tlsConfig := &promauth.TLSConfig{
+		CAFile: cfg["idp-certificate-authority"],
+	}
+	if s := cfg["idp-certificate-authority-data"]; s != "" {
+		ca, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("cannot base64-decode `idp-certificate-authority-data`: %w", err)
+		}
+		tlsConfig.CA = ca
+	}
+	ac, err := promauth.NewConfig(".", nil, nil, "", "", nil, tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot initialize TLS config for `auth-provider: %s`: %w", authProviderOIDC, err)
+	}
+	return &oidcAuthProvider{
+		issuerURL:    strings.TrimSuffix(cfg["idp-issuer-url"], "/"),
+		clientID:     cfg["client-id"],
+		clientSecret: cfg["client-secret"],
+		client: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: ac.NewTLSConfig(),
+				Proxy:           http.ProxyFromEnvironment,
+			},
+			Timeout: authProviderRequestTimeout,
+		},
+		idToken:      cfg["id-token"],
+		refreshToken: cfg["refresh-token"],
+	}, nil
+}
+
+// getCredential implements authProvider interface.
+//
+// It returns the current id token if it isn't close to expiration. Otherwise the id token is refreshed.
+func (p *oidcAuthProvider) getCredential() (*ExecCredentialStatus, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.idToken != "" {
+		expiration, err := getJWTExpiration(p.idToken)
+		if err == nil && time.Now().Add(execTokenRefreshInterval).Before(expiration) {
+			return &ExecCredentialStatus{
+				Token:               p.idToken,
+				ExpirationTimestamp: &expiration,
+			}, nil
+		}
+	}
+	if p.refreshToken == "" {
+		return nil, fmt.Errorf("cannot refresh expired `id-token`, since `refresh-token` is missing")
+	}
+	if err := p.refreshLocked(); err != nil {
+		return nil, err
+	}
+	expiration, err := getJWTExpiration(p.idToken)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse id_token returned from %q: %w", p.tokenURL, err)
+	}
+	return &ExecCredentialStatus{
+		Token:               p.idToken,
+		ExpirationTimestamp: &expiration,
+	}, nil
+}
+
+// refreshLocked obtains new id token from the issuer with the refresh token.
+//
+// The refresh token is updated if the issuer returns new one.
+func (p *oidcAuthProvider) refreshLocked() error {
+	if p.tokenURL == "" {
+		tokenURL, err := p.discoverTokenURL()
+		if err != nil {
+			return err
+		}
+		p.tokenURL = tokenURL
+	}
+	cfg := &oauth2.Config{
+		ClientID:     p.clientID,
+		ClientSecret: p.clientSecret,
+		Endpoint: oauth2.Endpoint{
+			TokenURL: p.tokenURL,
+		},
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, p.client)
+	token, err := cfg.TokenSource(ctx, &oauth2.Token{RefreshToken: p.refreshToken}).Token()
+	if err != nil {
+		return fmt.Errorf("cannot refresh id token at %q: %w", p.tokenURL, err)
+	}
+	idToken, _ := token.Extra("id_token").(string)
+	if idToken == "" {
+		return fmt.Errorf("missing id_token in the response from %q", p.tokenURL)
+	}
+	p.idToken = idToken
+	if token.RefreshToken != "" {
+		p.refreshToken = token.RefreshToken
+	}
+	return nil
+}
+
+// discoverTokenURL obtains token endpoint for the issuer via OpenID Connect discovery.
+//
+// See https://openid.net/specs/openid-connect-discovery-1_0.html
+func (p *oidcAuthProvider) discoverTokenURL() (string, error) {
+	discoveryURL := p.issuerURL + "/.well-known/openid-configuration"
+	resp, err := p.client.Get(discoveryURL)
+	if err != nil {
+		return "", fmt.Errorf("cannot obtain OpenID Connect configuration: %w", err)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return "", fmt.Errorf("cannot read OpenID Connect configuration from %q: %w", discoveryURL, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code returned from %q: %d; expecting %d; response body: %q", discoveryURL, resp.StatusCode, http.StatusOK, data)
+	}
+	var cfg struct {
+		TokenEndpoint string `json:"token_endpoint"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return "", fmt.Errorf("cannot parse OpenID Connect configuration from %q: %w", discoveryURL, err)
+	}
+	if cfg.TokenEndpoint == "" {
+		return "", fmt.Errorf("missing token_endpoint in OpenID Connect configuration from %q", discoveryURL)
+	}
+	return cfg.TokenEndpoint, nil
+}
+
+// String implements authProvider interface.
+func (p *oidcAuthProvider) String() string {
+	return fmt.Sprintf("auth-provider(name=%q, idp-issuer-url=%q, client-id=%q)", authProviderOIDC, p.issuerURL, p.clientID)
+}
+
+// getJWTExpiration returns expiration time from `exp` claim of the given JWT.
+//
+// The JWT signature isn't verified, since it is verified by Kubernetes API server.
+func getJWTExpiration(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("unexpected number of parts in JWT; got %d; want 3", len(parts))
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot base64-decode JWT payload: %w", err)
+	}
+	var claims struct {
+		Exp *float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("cannot parse JWT payload: %w", err)
+	}
+	if claims.Exp == nil {
+		return time.Time{}, fmt.Errorf("missing `exp` claim in JWT")
+	}
+	return time.Unix(int64(*claims.Exp), 0), nil
+}
@@ -23,7 +23,11 @@ type SDConfig struct {
 	// Use role() function for accessing the Role field
 	Role string `yaml:"role"`
 	// if defined any cluster connection information from HTTPClientConfig will be ignored
+	// It may contain multiple kubeconfig files separated by OS-specific path list separator in the same way as KUBECONFIG env var.
 	KubeConfig string `yaml:"kubeconfig_file"`
+	// Context overrides `current-context` from KubeConfig if set.
+	// This allows using a single kubeconfig file with multiple contexts for discovering targets in distinct clusters.
+	Context string `yaml:"kubeconfig_context,omitempty"`
 
 	HTTPClientConfig promauth.HTTPClientConfig `yaml:",inline"`
 	ProxyURL         *proxy.URL                `yaml:"proxy_url,omitempty"`
@@ -31,6 +35,10 @@ type SDConfig struct {
 	Selectors        []Selector                `yaml:"selectors,omitempty"`
 	AttachMetadata   AttachMetadata            `yaml:"attach_metadata,omitempty"`
 
+	// ProxyFromEnvironment instructs using proxy from HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
+	// for requests to Kubernetes API server if proxy_url isn't set and kubeconfig_file doesn't contain proxy-url.
+	ProxyFromEnvironment bool `yaml:"proxy_from_environment,omitempty"`
+
 	cfg      *apiConfig
 	startErr error
 }
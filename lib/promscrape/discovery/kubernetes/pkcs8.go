@@ -0,0 +1,212 @@
+package kubernetes
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// decryptClientKey returns keyPEM with decrypted private key if it is encrypted with the given password.
+//
+// keyPEM is returned as is if it doesn't contain encrypted private key and the password is empty.
+// An error is returned if the password is set for unencrypted key, since this usually means misconfiguration.
+// keySource is used in error messages for referring to the key.
+func decryptClientKey(keyPEM []byte, password, keySource string) ([]byte, error) {
+	var dst []byte
+	data := keyPEM
+	encrypted := false
+	for {
+		block, rest := pem.Decode(data)
+		if block == nil {
+			break
+		}
+		data = rest
+		if x509.IsEncryptedPEMBlock(block) {
+			return nil, fmt.Errorf("the client key at %s is encrypted in legacy PEM format, which isn't supported; "+
+				"convert it to encrypted PKCS#8 format with `openssl pkcs8 -topk8 -v2 aes-256-cbc`", keySource)
+		}
+		if block.Type != "ENCRYPTED PRIVATE KEY" {
+			dst = append(dst, pem.EncodeToMemory(block)...)
+			continue
+		}
+		encrypted = true
+		if password == "" {
+			return nil, fmt.Errorf("the client key at %s is encrypted; set `client-key-password` for the user in kubeconfig", keySource)
+		}
+		der, err := decryptPKCS8PrivateKey(block.Bytes, []byte(password))
+		if err != nil {
+			return nil, fmt.Errorf("cannot decrypt the client key at %s: %w", keySource, err)
+		}
+		dst = append(dst, pem.EncodeToMemory(&pem.Block{
+			Type:  "PRIVATE KEY",
+			Bytes: der,
+		})...)
+	}
+	if !encrypted {
+		if password != "" {
+			return nil, fmt.Errorf("the client key at %s isn't encrypted, while `client-key-password` is set for the user in kubeconfig; "+
+				"remove `client-key-password` or use the encrypted key", keySource)
+		}
+		return keyPEM, nil
+	}
+	return dst, nil
+}
+
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA224 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+// encryptedPrivateKeyInfo is defined in https://datatracker.ietf.org/doc/html/rfc5208#section-6
+type encryptedPrivateKeyInfo struct {
+	EncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedData       []byte
+}
+
+// pbes2Params is defined in https://datatracker.ietf.org/doc/html/rfc8018#appendix-A.4
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params is defined in https://datatracker.ietf.org/doc/html/rfc8018#appendix-A.2
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPKCS8PrivateKey decrypts PKCS#8 private key from der encrypted with the given password.
+//
+// Only PBES2 encryption scheme with PBKDF2 key derivation is supported, since it is used by default by OpenSSL.
+// The returned private key is in unencrypted PKCS#8 DER form.
+func decryptPKCS8PrivateKey(der, password []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if err := unmarshalASN1(der, &info); err != nil {
+		return nil, fmt.Errorf("cannot parse encrypted PKCS#8 private key: %w", err)
+	}
+	if !info.EncryptionAlgorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported encryption algorithm %s; only PBES2 is supported", info.EncryptionAlgorithm.Algorithm)
+	}
+	var params pbes2Params
+	if err := unmarshalASN1(info.EncryptionAlgorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("cannot parse PBES2 params: %w", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function %s; only PBKDF2 is supported", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdfParams pbkdf2Params
+	if err := unmarshalASN1(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, fmt.Errorf("cannot parse PBKDF2 params: %w", err)
+	}
+	newHash, err := getPBKDF2Hash(kdfParams.PRF.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	keyLen, newCipher, err := getPBES2Cipher(params.EncryptionScheme.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if kdfParams.KeyLength != 0 && kdfParams.KeyLength != keyLen {
+		return nil, fmt.Errorf("unexpected key length in PBKDF2 params; got %d; want %d", kdfParams.KeyLength, keyLen)
+	}
+	var iv []byte
+	if err := unmarshalASN1(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("cannot parse IV for %s: %w", params.EncryptionScheme.Algorithm, err)
+	}
+
+	key := pbkdf2.Key(password, kdfParams.Salt, kdfParams.IterationCount, keyLen, newHash)
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot initialize cipher: %w", err)
+	}
+	blockSize := block.BlockSize()
+	data := info.EncryptedData
+	if len(iv) != blockSize {
+		return nil, fmt.Errorf("unexpected IV length; got %d; want %d", len(iv), blockSize)
+	}
+	if len(data) == 0 || len(data)%blockSize != 0 {
+		return nil, fmt.Errorf("encrypted data length must be multiple of %d; got %d", blockSize, len(data))
+	}
+	plaintext := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, data)
+
+	// Remove PKCS#7 padding. Invalid padding usually means invalid password.
+	n := int(plaintext[len(plaintext)-1])
+	if n == 0 || n > blockSize || !bytes.Equal(plaintext[len(plaintext)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		return nil, fmt.Errorf("invalid password")
+	}
+	plaintext = plaintext[:len(plaintext)-n]
+	if _, err := x509.ParsePKCS8PrivateKey(plaintext); err != nil {
+		return nil, fmt.Errorf("cannot parse decrypted private key; probably, the password is invalid: %w", err)
+	}
+	return plaintext, nil
+}
+
+func unmarshalASN1(data []byte, dst interface{}) error {
+	rest, err := asn1.Unmarshal(data, dst)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("unexpected trailing data with length %d bytes", len(rest))
+	}
+	return nil
+}
+
+func getPBKDF2Hash(prf asn1.ObjectIdentifier) (func() hash.Hash, error) {
+	switch {
+	case len(prf) == 0, prf.Equal(oidHMACWithSHA1):
+		// hmacWithSHA1 is the default PRF according to https://datatracker.ietf.org/doc/html/rfc8018#appendix-A.2
+		return sha1.New, nil
+	case prf.Equal(oidHMACWithSHA224):
+		return sha256.New224, nil
+	case prf.Equal(oidHMACWithSHA256):
+		return sha256.New, nil
+	case prf.Equal(oidHMACWithSHA384):
+		return sha512.New384, nil
+	case prf.Equal(oidHMACWithSHA512):
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("unsupported PBKDF2 pseudorandom function %s", prf)
+	}
+}
+
+func getPBES2Cipher(scheme asn1.ObjectIdentifier) (int, func(key []byte) (cipher.Block, error), error) {
+	switch {
+	case scheme.Equal(oidAES128CBC):
+		return 16, aes.NewCipher, nil
+	case scheme.Equal(oidAES192CBC):
+		return 24, aes.NewCipher, nil
+	case scheme.Equal(oidAES256CBC):
+		return 32, aes.NewCipher, nil
+	case scheme.Equal(oidDESEDE3CBC):
+		return 24, des.NewTripleDESCipher, nil
+	default:
+		return 0, nil, fmt.Errorf("unsupported PBES2 encryption scheme %s", scheme)
+	}
+}
@@ -0,0 +1,89 @@
+package kubernetes
+
+import (
+	"bytes"
+	"encoding/pem"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestDecryptClientKeySuccess(t *testing.T) {
+	keyExpected, err := ioutil.ReadFile("testdata/pkcs8/client.key")
+	if err != nil {
+		t.Fatalf("cannot read key: %s", err)
+	}
+	f := func(keyFile, password string) {
+		t.Helper()
+		data, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			t.Fatalf("cannot read key: %s", err)
+		}
+		key, err := decryptClientKey(data, password, keyFile)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !bytes.Equal(key, keyExpected) {
+			t.Fatalf("unexpected key for %s;\ngot\n%s\nwant\n%s", keyFile, key, keyExpected)
+		}
+	}
+
+	// Unencrypted key is returned as is
+	f("testdata/pkcs8/client.key", "")
+
+	// Encrypted keys with various ciphers and PRFs
+	f("testdata/pkcs8/client_aes256_sha256.key", "secret")
+	f("testdata/pkcs8/client_aes128_sha1.key", "secret")
+	f("testdata/pkcs8/client_aes192_sha512.key", "secret")
+	f("testdata/pkcs8/client_des3_sha256.key", "secret")
+}
+
+func TestDecryptClientKeyFailure(t *testing.T) {
+	f := func(data []byte, password, errExpected string) {
+		t.Helper()
+		_, err := decryptClientKey(data, password, `"client.key"`)
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if !strings.Contains(err.Error(), errExpected) {
+			t.Fatalf("unexpected error; got %q; want it to contain %q", err, errExpected)
+		}
+		if !strings.Contains(err.Error(), `"client.key"`) {
+			t.Fatalf("the error must contain the key source; got %q", err)
+		}
+	}
+	mustReadFile := func(path string) []byte {
+		t.Helper()
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("cannot read %q: %s", path, err)
+		}
+		return data
+	}
+	encryptedKey := mustReadFile("testdata/pkcs8/client_aes256_sha256.key")
+
+	// Missing password
+	f(encryptedKey, "", "is encrypted; set `client-key-password`")
+
+	// Password for unencrypted key
+	f(mustReadFile("testdata/pkcs8/client.key"), "secret", "isn't encrypted, while `client-key-password` is set")
+
+	// Invalid password
+	f(encryptedKey, "invalid", "password")
+
+	// Unsupported PBES1 encryption
+	f(mustReadFile("testdata/pkcs8/client_pbes1.key"), "secret", "unsupported encryption algorithm")
+
+	// Corrupted encrypted key
+	f(pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: []byte("foobar")}), "secret", "cannot parse encrypted PKCS#8 private key")
+
+	// Legacy encrypted PEM
+	f(pem.EncodeToMemory(&pem.Block{
+		Type: "EC PRIVATE KEY",
+		Headers: map[string]string{
+			"Proc-Type": "4,ENCRYPTED",
+			"DEK-Info":  "AES-256-CBC,00000000000000000000000000000000",
+		},
+		Bytes: []byte("foobar"),
+	}), "secret", "legacy PEM format")
+}
@@ -0,0 +1,51 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/netutil"
+	netproxy "golang.org/x/net/proxy"
+)
+
+// checkProxyURL verifies whether pu can be used for connecting to Kubernetes API server.
+func checkProxyURL(pu *url.URL) error {
+	if pu == nil {
+		return nil
+	}
+	switch pu.Scheme {
+	case "http", "https", "socks5":
+		return nil
+	default:
+		return fmt.Errorf("unsupported scheme %q in proxy url %s; supported schemes: http, https, socks5", pu.Scheme, pu.Redacted())
+	}
+}
+
+// newSOCKS5DialContext returns dial func, which establishes connections via SOCKS5 proxy at pu.
+//
+// The username and the password from pu are used for authentication at SOCKS5 proxy if set.
+func newSOCKS5DialContext(pu *url.URL) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	var auth *netproxy.Auth
+	if pu.User != nil {
+		password, _ := pu.User.Password()
+		auth = &netproxy.Auth{
+			User:     pu.User.Username(),
+			Password: password,
+		}
+	}
+	proxyAddr := pu.Host
+	if pu.Port() == "" {
+		proxyAddr = net.JoinHostPort(pu.Hostname(), "1080")
+	}
+	d, err := netproxy.SOCKS5(netutil.GetTCPNetwork(), proxyAddr, auth, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create SOCKS5 dialer for proxy url %s: %w", pu.Redacted(), err)
+	}
+	cd, ok := d.(netproxy.ContextDialer)
+	if !ok {
+		return nil, fmt.Errorf("BUG: SOCKS5 dialer for proxy url %s must support dialing with context; got %T", pu.Redacted(), d)
+	}
+	return cd.DialContext, nil
+}
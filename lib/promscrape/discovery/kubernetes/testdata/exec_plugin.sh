@@ -0,0 +1,19 @@
+#!/bin/sh
+# Exec credential plugin for tests.
+# It returns the token from TEST_TOKEN env var using apiVersion from KUBERNETES_EXEC_INFO env var.
+# The optional TEST_EXPIRATION_TIMESTAMP env var sets status.expirationTimestamp in the returned credential.
+# Every execution is recorded in the file from the optional TEST_COUNTER_FILE env var.
+# The plugin fails if TEST_ERROR env var is set.
+if [ -n "$TEST_COUNTER_FILE" ]; then
+  echo "exec" >> "$TEST_COUNTER_FILE"
+fi
+if [ -n "$TEST_ERROR" ]; then
+  echo "$TEST_ERROR" >&2
+  exit 1
+fi
+api_version=$(echo "$KUBERNETES_EXEC_INFO" | sed -n 's/.*"apiVersion":"\([^"]*\)".*/\1/p')
+expiration=""
+if [ -n "$TEST_EXPIRATION_TIMESTAMP" ]; then
+  expiration=$(printf ',"expirationTimestamp":"%s"' "$TEST_EXPIRATION_TIMESTAMP")
+fi
+printf '{"kind":"ExecCredential","apiVersion":"%s","status":{"token":"%s"%s}}' "$api_version" "$TEST_TOKEN" "$expiration"
@@ -0,0 +1,5 @@
+#!/bin/sh
+# Exec credential plugin for tests.
+# It returns base64-encoded KUBERNETES_EXEC_INFO env var as the token, so tests can verify the information passed to the plugin.
+token=$(printf '%s' "$KUBERNETES_EXEC_INFO" | base64 | tr -d '\n')
+printf '{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1","status":{"token":"%s"}}' "$token"
@@ -0,0 +1,12 @@
+#!/bin/sh
+# Exec credential plugin for tests, which reads standard input.
+# It fails if standard input isn't closed or if it is requested to run interactively.
+if read -r line; then
+  echo "unexpected data at standard input: $line" >&2
+  exit 1
+fi
+if echo "$KUBERNETES_EXEC_INFO" | grep -q '"interactive":true'; then
+  echo "unexpected interactive mode" >&2
+  exit 1
+fi
+printf '{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1","status":{"token":"%s"}}' "$TEST_TOKEN"
@@ -2,6 +2,7 @@ package openstack
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -43,7 +44,7 @@ type apiConfig struct {
 	availability string
 }
 
-func (cfg *apiConfig) getFreshAPICredentials() (*apiCredentials, error) {
+func (cfg *apiConfig) getFreshAPICredentials(ctx context.Context) (*apiCredentials, error) {
 	cfg.tokenLock.Lock()
 	defer cfg.tokenLock.Unlock()
 
@@ -51,7 +52,7 @@ func (cfg *apiConfig) getFreshAPICredentials() (*apiCredentials, error) {
 		// Credentials aren't expired yet.
 		return cfg.creds, nil
 	}
-	newCreds, err := getCreds(cfg)
+	newCreds, err := getCreds(ctx, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("cannot refresh OpenStack api token: %w", err)
 	}
@@ -126,11 +127,16 @@ func newAPIConfig(sdc *SDConfig, baseDir string) (*apiConfig, error) {
 // getCreds makes a call to openstack keystone api and retrieves token and computeURL
 //
 // See https://docs.openstack.org/api-ref/identity/v3/
-func getCreds(cfg *apiConfig) (*apiCredentials, error) {
+func getCreds(ctx context.Context, cfg *apiConfig) (*apiCredentials, error) {
 	apiURL := *cfg.endpoint
 	apiURL.Path = path.Join(apiURL.Path, "auth", "tokens")
 
-	resp, err := cfg.client.Post(apiURL.String(), "application/json", bytes.NewBuffer(cfg.authTokenReq))
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL.String(), bytes.NewBuffer(cfg.authTokenReq))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create new request for openstack identity api url %s: %w", apiURL.String(), err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := cfg.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed query openstack identity api, url: %s, err: %w", apiURL.String(), err)
 	}
@@ -177,12 +183,12 @@ func readResponseBody(resp *http.Response, apiURL string) ([]byte, error) {
 }
 
 // getAPIResponse calls openstack apiURL and returns response body.
-func getAPIResponse(apiURL string, cfg *apiConfig) ([]byte, error) {
-	creds, err := cfg.getFreshAPICredentials()
+func getAPIResponse(ctx context.Context, apiURL string, cfg *apiConfig) ([]byte, error) {
+	creds, err := cfg.getFreshAPICredentials(ctx)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest("GET", apiURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create new request for openstack api url %s: %w", apiURL, err)
 	}
@@ -1,6 +1,7 @@
 package openstack
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"path"
@@ -35,8 +36,8 @@ func parseHypervisorDetail(data []byte) (*hypervisorDetail, error) {
 	return &hvsd, nil
 }
 
-func (cfg *apiConfig) getHypervisors() ([]hypervisor, error) {
-	creds, err := cfg.getFreshAPICredentials()
+func (cfg *apiConfig) getHypervisors(ctx context.Context) ([]hypervisor, error) {
+	creds, err := cfg.getFreshAPICredentials(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -45,7 +46,7 @@ func (cfg *apiConfig) getHypervisors() ([]hypervisor, error) {
 	nextLink := computeURL.String()
 	var hvs []hypervisor
 	for {
-		resp, err := getAPIResponse(nextLink, cfg)
+		resp, err := getAPIResponse(ctx, nextLink, cfg)
 		if err != nil {
 			return nil, err
 		}
@@ -79,8 +80,8 @@ func addHypervisorLabels(hvs []hypervisor, port int) []map[string]string {
 	return ms
 }
 
-func getHypervisorLabels(cfg *apiConfig) ([]map[string]string, error) {
-	hvs, err := cfg.getHypervisors()
+func getHypervisorLabels(ctx context.Context, cfg *apiConfig) ([]map[string]string, error) {
+	hvs, err := cfg.getHypervisors(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("cannot get hypervisors: %w", err)
 	}
@@ -1,6 +1,7 @@
 package openstack
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"path"
@@ -104,8 +105,8 @@ func addInstanceLabels(servers []server, port int) []map[string]string {
 	return ms
 }
 
-func (cfg *apiConfig) getServers() ([]server, error) {
-	creds, err := cfg.getFreshAPICredentials()
+func (cfg *apiConfig) getServers(ctx context.Context) ([]server, error) {
+	creds, err := cfg.getFreshAPICredentials(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -117,7 +118,7 @@ func (cfg *apiConfig) getServers() ([]server, error) {
 	nextLink := computeURL.String()
 	var servers []server
 	for {
-		resp, err := getAPIResponse(nextLink, cfg)
+		resp, err := getAPIResponse(ctx, nextLink, cfg)
 		if err != nil {
 			return nil, err
 		}
@@ -133,8 +134,8 @@ func (cfg *apiConfig) getServers() ([]server, error) {
 	}
 }
 
-func getInstancesLabels(cfg *apiConfig) ([]map[string]string, error) {
-	srv, err := cfg.getServers()
+func getInstancesLabels(ctx context.Context, cfg *apiConfig) ([]map[string]string, error) {
+	srv, err := cfg.getServers(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,7 @@
 package openstack
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"time"
@@ -39,16 +40,16 @@ type SDConfig struct {
 }
 
 // GetLabels returns OpenStack labels according to sdc.
-func (sdc *SDConfig) GetLabels(baseDir string) ([]map[string]string, error) {
+func (sdc *SDConfig) GetLabels(ctx context.Context, baseDir string) ([]map[string]string, error) {
 	cfg, err := getAPIConfig(sdc, baseDir)
 	if err != nil {
 		return nil, fmt.Errorf("cannot get API config: %w", err)
 	}
 	switch sdc.Role {
 	case "hypervisor":
-		return getHypervisorLabels(cfg)
+		return getHypervisorLabels(ctx, cfg)
 	case "instance":
-		return getInstancesLabels(cfg)
+		return getInstancesLabels(ctx, cfg)
 	default:
 		return nil, fmt.Errorf("unexpected `role`: %q; must be one of `instance` or `hypervisor`; skipping it", sdc.Role)
 	}
@@ -1,6 +1,7 @@
 package discoveryutils
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"fmt"
@@ -157,17 +158,21 @@ func (c *Client) Addr() string {
 
 // GetAPIResponseWithReqParams returns response for given absolute path with optional callback for request.
 // modifyRequestParams should never reference data from request.
-func (c *Client) GetAPIResponseWithReqParams(path string, modifyRequestParams func(request *fasthttp.Request)) ([]byte, error) {
-	return c.getAPIResponse(path, modifyRequestParams)
+//
+// The request doesn't last longer than the ctx deadline. It isn't retried after ctx is canceled.
+func (c *Client) GetAPIResponseWithReqParams(ctx context.Context, path string, modifyRequestParams func(request *fasthttp.Request)) ([]byte, error) {
+	return c.getAPIResponse(ctx, path, modifyRequestParams)
 }
 
 // GetAPIResponse returns response for the given absolute path.
-func (c *Client) GetAPIResponse(path string) ([]byte, error) {
-	return c.getAPIResponse(path, nil)
+//
+// The request doesn't last longer than the ctx deadline. It isn't retried after ctx is canceled.
+func (c *Client) GetAPIResponse(ctx context.Context, path string) ([]byte, error) {
+	return c.getAPIResponse(ctx, path, nil)
 }
 
 // GetAPIResponse returns response for the given absolute path with optional callback for request.
-func (c *Client) getAPIResponse(path string, modifyRequest func(request *fasthttp.Request)) ([]byte, error) {
+func (c *Client) getAPIResponse(ctx context.Context, path string, modifyRequest func(request *fasthttp.Request)) ([]byte, error) {
 	// Limit the number of concurrent API requests.
 	concurrencyLimitChOnce.Do(concurrencyLimitChInit)
 	t := timerpool.Get(*maxWaitTime)
@@ -178,19 +183,22 @@ func (c *Client) getAPIResponse(path string, modifyRequest func(request *fasthtt
 		timerpool.Put(t)
 		return nil, fmt.Errorf("too many outstanding requests to %q; try increasing -promscrape.discovery.concurrentWaitTime=%s or -promscrape.discovery.concurrency=%d",
 			c.apiServer, *maxWaitTime, *maxConcurrency)
+	case <-ctx.Done():
+		timerpool.Put(t)
+		return nil, fmt.Errorf("cannot send request to %q: %w", c.apiServer, ctx.Err())
 	}
 	defer func() { <-concurrencyLimitCh }()
-	return c.getAPIResponseWithParamsAndClient(c.hc, path, modifyRequest, nil)
+	return c.getAPIResponseWithParamsAndClient(ctx, c.hc, path, modifyRequest, nil)
 }
 
 // GetBlockingAPIResponse returns response for given absolute path with blocking client and optional callback for api response,
 // inspectResponse - should never reference data from response.
 func (c *Client) GetBlockingAPIResponse(path string, inspectResponse func(resp *fasthttp.Response)) ([]byte, error) {
-	return c.getAPIResponseWithParamsAndClient(c.blockingClient, path, nil, inspectResponse)
+	return c.getAPIResponseWithParamsAndClient(context.Background(), c.blockingClient, path, nil, inspectResponse)
 }
 
 // getAPIResponseWithParamsAndClient returns response for the given absolute path with optional callback for request and for response.
-func (c *Client) getAPIResponseWithParamsAndClient(client *fasthttp.HostClient, path string, modifyRequest func(req *fasthttp.Request), inspectResponse func(resp *fasthttp.Response)) ([]byte, error) {
+func (c *Client) getAPIResponseWithParamsAndClient(ctx context.Context, client *fasthttp.HostClient, path string, modifyRequest func(req *fasthttp.Request), inspectResponse func(resp *fasthttp.Response)) ([]byte, error) {
 	requestURL := c.apiServer + path
 	var u fasthttp.URI
 	u.Update(requestURL)
@@ -214,7 +222,10 @@ func (c *Client) getAPIResponseWithParamsAndClient(client *fasthttp.HostClient,
 
 	var resp fasthttp.Response
 	deadline := time.Now().Add(client.ReadTimeout)
-	if err := doRequestWithPossibleRetry(client, &req, &resp, deadline); err != nil {
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := doRequestWithPossibleRetry(ctx, client, &req, &resp, deadline); err != nil {
 		return nil, fmt.Errorf("cannot fetch %q: %w", requestURL, err)
 	}
 	var data []byte
@@ -238,7 +249,7 @@ func (c *Client) getAPIResponseWithParamsAndClient(client *fasthttp.HostClient,
 	return data, nil
 }
 
-func doRequestWithPossibleRetry(hc *fasthttp.HostClient, req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error {
+func doRequestWithPossibleRetry(ctx context.Context, hc *fasthttp.HostClient, req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error {
 	sleepTime := time.Second
 	discoveryRequests.Inc()
 	for {
@@ -248,6 +259,9 @@ func doRequestWithPossibleRetry(hc *fasthttp.HostClient, req *fasthttp.Request,
 		if err == nil {
 			return nil
 		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("%s: %w", err, ctxErr)
+		}
 		if err != fasthttp.ErrConnectionClosed && !strings.Contains(err.Error(), "broken pipe") {
 			return err
 		}
@@ -260,7 +274,14 @@ func doRequestWithPossibleRetry(hc *fasthttp.HostClient, req *fasthttp.Request,
 		if sleepTime > maxSleepTime {
 			sleepTime = maxSleepTime
 		}
-		time.Sleep(sleepTime)
+		t := timerpool.Get(sleepTime)
+		select {
+		case <-t.C:
+			timerpool.Put(t)
+		case <-ctx.Done():
+			timerpool.Put(t)
+			return fmt.Errorf("%s: %w", err, ctx.Err())
+		}
 		discoveryRetries.Inc()
 	}
 }
@@ -0,0 +1,90 @@
+package promscrape
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+)
+
+// readFileData appends the contents of c.filePath to dst.
+//
+// gzipped files are transparently decompressed.
+func (c *client) readFileData(dst []byte) ([]byte, error) {
+	r, err := c.openFile()
+	if err != nil {
+		return dst, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	bb := bytes.NewBuffer(dst)
+	n, err := bb.ReadFrom(io.LimitReader(r, int64(c.maxScrapeSize)+1))
+	dst = bb.Bytes()
+	if err != nil {
+		scrapesFileFailed.Inc()
+		return dst, fmt.Errorf("cannot read %q: %w", c.scrapeURL, err)
+	}
+	if n > int64(c.maxScrapeSize) {
+		return dst, newMaxScrapeSizeError(c.scrapeURL, c.maxScrapeSize)
+	}
+	scrapesFileOK.Inc()
+	return dst, nil
+}
+
+func (c *client) getFileStreamReader() (*streamReader, error) {
+	r, err := c.openFile()
+	if err != nil {
+		return nil, err
+	}
+	scrapesFileOK.Inc()
+	return &streamReader{
+		r:           r,
+		cancel:      func() {},
+		scrapeURL:   c.scrapeURL,
+		maxBodySize: int64(c.maxScrapeSize),
+	}, nil
+}
+
+// openFile opens c.filePath for reading.
+//
+// The returned reader decompresses the file contents if the file is gzipped.
+func (c *client) openFile() (io.ReadCloser, error) {
+	f, err := os.Open(c.filePath)
+	if err != nil {
+		scrapesFileFailed.Inc()
+		return nil, fmt.Errorf("cannot scrape %q: %w", c.scrapeURL, err)
+	}
+	br := bufio.NewReader(f)
+	// Detect gzipped files by magic bytes instead of file extension,
+	// since the file may be atomically replaced with the file in another format.
+	magic, _ := br.Peek(2)
+	if len(magic) < 2 || magic[0] != 0x1f || magic[1] != 0x8b {
+		return &fileReader{
+			Reader: br,
+			f:      f,
+		}, nil
+	}
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		_ = f.Close()
+		scrapesGunzipFailed.Inc()
+		return nil, fmt.Errorf("cannot ungzip %q: %w", c.scrapeURL, err)
+	}
+	scrapesGunzipped.Inc()
+	return &fileReader{
+		Reader: zr,
+		f:      f,
+	}, nil
+}
+
+type fileReader struct {
+	io.Reader
+	f *os.File
+}
+
+func (fr *fileReader) Close() error {
+	return fr.f.Close()
+}
@@ -0,0 +1,81 @@
+package promscrape
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClientReadFileData(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "promscrape-file-client")
+	if err != nil {
+		t.Fatalf("cannot create temporary dir: %s", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+
+	const data = "foo{bar=\"baz\"} 123\nfoo 456 789\n"
+	plainPath := filepath.Join(tmpDir, "metrics.prom")
+	if err := ioutil.WriteFile(plainPath, []byte(data), 0644); err != nil {
+		t.Fatalf("cannot write %q: %s", plainPath, err)
+	}
+	var bb bytes.Buffer
+	zw := gzip.NewWriter(&bb)
+	if _, err := zw.Write([]byte(data)); err != nil {
+		t.Fatalf("cannot gzip data: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close gzip writer: %s", err)
+	}
+	gzipPath := filepath.Join(tmpDir, "metrics.prom.gz")
+	if err := ioutil.WriteFile(gzipPath, bb.Bytes(), 0644); err != nil {
+		t.Fatalf("cannot write %q: %s", gzipPath, err)
+	}
+
+	f := func(path string) {
+		t.Helper()
+		c := newClient(&ScrapeWork{
+			ScrapeURL: "file://" + path,
+		})
+
+		// Read the file in usual mode
+		result, err := c.ReadData([]byte("prefix "))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(result) != "prefix "+data {
+			t.Fatalf("unexpected data read from %q\ngot\n%s\nwant\n%s", path, result, "prefix "+data)
+		}
+
+		// Read the file in stream mode
+		sr, err := c.GetStreamReader()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result, err = ioutil.ReadAll(sr)
+		sr.MustClose()
+		if err != nil {
+			t.Fatalf("unexpected error when reading stream: %s", err)
+		}
+		if string(result) != data {
+			t.Fatalf("unexpected stream data read from %q\ngot\n%s\nwant\n%s", path, result, data)
+		}
+	}
+	f(plainPath)
+	f(gzipPath)
+
+	// Missing file
+	c := newClient(&ScrapeWork{
+		ScrapeURL: "file://" + filepath.Join(tmpDir, "missing.prom"),
+	})
+	if _, err := c.ReadData(nil); err == nil {
+		t.Fatalf("expecting non-nil error when reading missing file")
+	}
+	if _, err := c.GetStreamReader(); err == nil {
+		t.Fatalf("expecting non-nil error when reading missing file")
+	}
+}
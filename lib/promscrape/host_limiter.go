@@ -0,0 +1,112 @@
+package promscrape
+
+import (
+	"flag"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timerpool"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var maxConcurrentScrapesPerHost = flag.Int("promscrape.maxConcurrentScrapesPerHost", 0, "The maximum number of concurrent scrapes for targets on the same host. "+
+	"Scrapes exceeding the limit are queued until the previous scrapes for the host are finished. "+
+	"Queued scrapes are skipped if they cannot start during the scrape_timeout for the target. "+
+	"This may be useful for protecting hosts with many scrape targets from load spikes. By default there is no limit")
+
+// hostConcurrencyLimiter limits the number of concurrent scrapes per host.
+type hostConcurrencyLimiter struct {
+	maxConcurrency int
+
+	mu sync.Mutex
+	m  map[string]*hostConcurrencyEntry
+}
+
+type hostConcurrencyEntry struct {
+	// ch holds a token per each in-flight scrape for the host.
+	ch chan struct{}
+
+	// refs is the number of scrapes, which hold or wait for a token in ch.
+	refs int
+}
+
+func newHostConcurrencyLimiter(maxConcurrency int) *hostConcurrencyLimiter {
+	return &hostConcurrencyLimiter{
+		maxConcurrency: maxConcurrency,
+		m:              make(map[string]*hostConcurrencyEntry),
+	}
+}
+
+// acquire blocks until the scrape for the given host is allowed or until the timeout expires.
+//
+// false is returned if the scrape isn't allowed during the timeout. The scrape must be skipped in this case.
+// Otherwise release must be called with the same host when the scrape is finished.
+func (hcl *hostConcurrencyLimiter) acquire(host string, timeout time.Duration) bool {
+	hcl.mu.Lock()
+	e := hcl.m[host]
+	if e == nil {
+		e = &hostConcurrencyEntry{
+			ch: make(chan struct{}, hcl.maxConcurrency),
+		}
+		hcl.m[host] = e
+	}
+	e.refs++
+	hcl.mu.Unlock()
+
+	select {
+	case e.ch <- struct{}{}:
+		return true
+	default:
+	}
+	scrapesQueuedByHostLimit.Inc()
+	t := timerpool.Get(timeout)
+	defer timerpool.Put(t)
+	select {
+	case e.ch <- struct{}{}:
+		return true
+	case <-t.C:
+		scrapesSkippedByHostLimit.Inc()
+		hcl.mu.Lock()
+		hcl.unrefLocked(host, e)
+		hcl.mu.Unlock()
+		return false
+	}
+}
+
+// release releases the scrape slot obtained via acquire for the given host.
+func (hcl *hostConcurrencyLimiter) release(host string) {
+	hcl.mu.Lock()
+	e := hcl.m[host]
+	<-e.ch
+	hcl.unrefLocked(host, e)
+	hcl.mu.Unlock()
+}
+
+func (hcl *hostConcurrencyLimiter) unrefLocked(host string, e *hostConcurrencyEntry) {
+	e.refs--
+	if e.refs == 0 {
+		delete(hcl.m, host)
+	}
+}
+
+var (
+	scrapesQueuedByHostLimit  = metrics.NewCounter(`vm_promscrape_scrapes_queued_by_host_limit_total`)
+	scrapesSkippedByHostLimit = metrics.NewCounter(`vm_promscrape_scrapes_skipped_by_host_limit_total`)
+)
+
+// getHostConcurrencyLimiter returns the global limiter for -promscrape.maxConcurrentScrapesPerHost.
+//
+// nil is returned if the limit isn't set.
+func getHostConcurrencyLimiter() *hostConcurrencyLimiter {
+	hostConcurrencyLimiterOnce.Do(func() {
+		if *maxConcurrentScrapesPerHost > 0 {
+			globalHostConcurrencyLimiter = newHostConcurrencyLimiter(*maxConcurrentScrapesPerHost)
+		}
+	})
+	return globalHostConcurrencyLimiter
+}
+
+var (
+	hostConcurrencyLimiterOnce   sync.Once
+	globalHostConcurrencyLimiter *hostConcurrencyLimiter
+)
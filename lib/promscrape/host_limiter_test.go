@@ -0,0 +1,85 @@
+package promscrape
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHostConcurrencyLimiter(t *testing.T) {
+	f := func(maxConcurrency, hostsCount, targetsPerHost int) {
+		t.Helper()
+		hcl := newHostConcurrencyLimiter(maxConcurrency)
+		concurrency := make([]int32, hostsCount)
+		maxSeen := make([]int32, hostsCount)
+		var wg sync.WaitGroup
+		for i := 0; i < hostsCount; i++ {
+			host := fmt.Sprintf("host-%d", i)
+			for j := 0; j < targetsPerHost; j++ {
+				wg.Add(1)
+				go func(hostIdx int) {
+					defer wg.Done()
+					for k := 0; k < 5; k++ {
+						if !hcl.acquire(host, time.Hour) {
+							t.Errorf("unexpected timeout when acquiring the slot for %q", host)
+							return
+						}
+						n := atomic.AddInt32(&concurrency[hostIdx], 1)
+						for {
+							m := atomic.LoadInt32(&maxSeen[hostIdx])
+							if n <= m || atomic.CompareAndSwapInt32(&maxSeen[hostIdx], m, n) {
+								break
+							}
+						}
+						time.Sleep(time.Millisecond)
+						atomic.AddInt32(&concurrency[hostIdx], -1)
+						hcl.release(host)
+					}
+				}(i)
+			}
+		}
+		wg.Wait()
+		for i, n := range maxSeen {
+			if n > int32(maxConcurrency) {
+				t.Fatalf("unexpected concurrency for host-%d; got %d; mustn't exceed %d", i, n, maxConcurrency)
+			}
+			if n == 0 {
+				t.Fatalf("no scrapes were made for host-%d", i)
+			}
+		}
+		hcl.mu.Lock()
+		entries := len(hcl.m)
+		hcl.mu.Unlock()
+		if entries != 0 {
+			t.Fatalf("unexpected number of entries left in the limiter; got %d; want 0", entries)
+		}
+	}
+	f(1, 1, 10)
+	f(2, 1, 10)
+	f(3, 4, 10)
+	f(5, 3, 2)
+}
+
+func TestHostConcurrencyLimiterTimeout(t *testing.T) {
+	hcl := newHostConcurrencyLimiter(1)
+	if !hcl.acquire("foo", time.Second) {
+		t.Fatalf("cannot acquire the slot for the host without in-flight scrapes")
+	}
+	if hcl.acquire("foo", 10*time.Millisecond) {
+		t.Fatalf("expecting timeout when acquiring the slot for the host with the limit exceeded")
+	}
+	if !hcl.acquire("bar", time.Second) {
+		t.Fatalf("cannot acquire the slot for another host")
+	}
+	hcl.release("bar")
+	hcl.release("foo")
+	if !hcl.acquire("foo", time.Second) {
+		t.Fatalf("cannot acquire the slot after its release")
+	}
+	hcl.release("foo")
+	if n := len(hcl.m); n != 0 {
+		t.Fatalf("unexpected number of entries left in the limiter; got %d; want 0", n)
+	}
+}
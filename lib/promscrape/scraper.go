@@ -2,6 +2,7 @@ package promscrape
 
 import (
 	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"io"
@@ -23,6 +24,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discovery/http"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discovery/kubernetes"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discovery/openstack"
+	parser "github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/prometheus"
 	"github.com/VictoriaMetrics/metrics"
 )
 
@@ -37,6 +39,9 @@ var (
 
 	fileSDCheckInterval = flag.Duration("promscrape.fileSDCheckInterval", 5*time.Minute, "Interval for checking for changes in 'file_sd_config'. "+
 		"See https://prometheus.io/docs/prometheus/latest/configuration/configuration/#file_sd_config for details")
+	discoveryTimeout = flag.Duration("promscrape.discovery.timeout", time.Minute, "The maximum duration for discovering targets per each *_sd_configs type. "+
+		"The previously discovered targets are kept for jobs, which weren't discovered in time, so slow service discovery doesn't block other *_sd_configs types and config reloads. "+
+		"See https://docs.victoriametrics.com/vmagent.html#troubleshooting")
 )
 
 // CheckConfig checks -promscrape.config for errors and unsupported options.
@@ -61,6 +66,16 @@ func Init(pushData func(wr *prompbmarshal.WriteRequest)) {
 	}()
 }
 
+// SetMetadataHandler sets f as the handler for TYPE, HELP and UNIT metadata obtained from scrape targets.
+//
+// f must copy the passed metadata if it needs to keep it after returning.
+// SetMetadataHandler must be called before Init.
+func SetMetadataHandler(f func(mds []parser.Metadata)) {
+	pushMetadata = f
+}
+
+var pushMetadata func(mds []parser.Metadata)
+
 // Stop stops Prometheus scraper.
 func Stop() {
 	close(globalStopChan)
@@ -76,6 +91,9 @@ var (
 
 	// configData contains -promscrape.config data
 	configData atomic.Value
+
+	// effectiveConfigData contains the effective config data for the currently loaded -promscrape.config
+	effectiveConfigData atomic.Value
 )
 
 // WriteConfigData writes -promscrape.config contents to w
@@ -89,6 +107,26 @@ func WriteConfigData(w io.Writer) {
 	_, _ = w.Write(*b)
 }
 
+// WriteEffectiveConfigData writes the effective config for the currently loaded -promscrape.config to w.
+//
+// The effective config contains the values actually used for scraping for omitted options. Secrets are hidden in it.
+func WriteEffectiveConfigData(w io.Writer) {
+	v := effectiveConfigData.Load()
+	if v == nil {
+		// Nothing to write to w
+		return
+	}
+	b := v.(*[]byte)
+	_, _ = w.Write(*b)
+}
+
+func storeConfigData(cfg *Config) {
+	marshaledData := cfg.marshal()
+	configData.Store(&marshaledData)
+	effectiveData := cfg.marshalEffective()
+	effectiveConfigData.Store(&effectiveData)
+}
+
 func runScraper(configFile string, pushData func(wr *prompbmarshal.WriteRequest), globalStopCh <-chan struct{}) {
 	if configFile == "" {
 		// Nothing to scrape.
@@ -105,24 +143,23 @@ func runScraper(configFile string, pushData func(wr *prompbmarshal.WriteRequest)
 	if err != nil {
 		logger.Fatalf("cannot read %q: %s", configFile, err)
 	}
-	marshaledData := cfg.marshal()
-	configData.Store(&marshaledData)
+	storeConfigData(cfg)
 	cfg.mustStart()
 
 	scs := newScrapeConfigs(pushData, globalStopCh)
-	scs.add("consul_sd_configs", *consul.SDCheckInterval, func(cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getConsulSDScrapeWork(swsPrev) })
-	scs.add("digitalocean_sd_configs", *digitalocean.SDCheckInterval, func(cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getDigitalOceanDScrapeWork(swsPrev) })
-	scs.add("dns_sd_configs", *dns.SDCheckInterval, func(cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getDNSSDScrapeWork(swsPrev) })
-	scs.add("docker_sd_configs", *docker.SDCheckInterval, func(cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getDockerSDScrapeWork(swsPrev) })
-	scs.add("dockerswarm_sd_configs", *dockerswarm.SDCheckInterval, func(cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getDockerSwarmSDScrapeWork(swsPrev) })
-	scs.add("ec2_sd_configs", *ec2.SDCheckInterval, func(cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getEC2SDScrapeWork(swsPrev) })
-	scs.add("eureka_sd_configs", *eureka.SDCheckInterval, func(cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getEurekaSDScrapeWork(swsPrev) })
-	scs.add("file_sd_configs", *fileSDCheckInterval, func(cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getFileSDScrapeWork(swsPrev) })
-	scs.add("gce_sd_configs", *gce.SDCheckInterval, func(cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getGCESDScrapeWork(swsPrev) })
-	scs.add("http_sd_configs", *http.SDCheckInterval, func(cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getHTTPDScrapeWork(swsPrev) })
-	scs.add("kubernetes_sd_configs", *kubernetes.SDCheckInterval, func(cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getKubernetesSDScrapeWork(swsPrev) })
-	scs.add("openstack_sd_configs", *openstack.SDCheckInterval, func(cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getOpenStackSDScrapeWork(swsPrev) })
-	scs.add("static_configs", 0, func(cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getStaticScrapeWork() })
+	scs.add("consul_sd_configs", *consul.SDCheckInterval, func(ctx context.Context, cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getConsulSDScrapeWork(ctx, swsPrev) })
+	scs.add("digitalocean_sd_configs", *digitalocean.SDCheckInterval, func(ctx context.Context, cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getDigitalOceanDScrapeWork(ctx, swsPrev) })
+	scs.add("dns_sd_configs", *dns.SDCheckInterval, func(ctx context.Context, cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getDNSSDScrapeWork(ctx, swsPrev) })
+	scs.add("docker_sd_configs", *docker.SDCheckInterval, func(ctx context.Context, cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getDockerSDScrapeWork(ctx, swsPrev) })
+	scs.add("dockerswarm_sd_configs", *dockerswarm.SDCheckInterval, func(ctx context.Context, cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getDockerSwarmSDScrapeWork(ctx, swsPrev) })
+	scs.add("ec2_sd_configs", *ec2.SDCheckInterval, func(ctx context.Context, cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getEC2SDScrapeWork(ctx, swsPrev) })
+	scs.add("eureka_sd_configs", *eureka.SDCheckInterval, func(ctx context.Context, cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getEurekaSDScrapeWork(ctx, swsPrev) })
+	scs.add("file_sd_configs", *fileSDCheckInterval, func(ctx context.Context, cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getFileSDScrapeWork(swsPrev) })
+	scs.add("gce_sd_configs", *gce.SDCheckInterval, func(ctx context.Context, cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getGCESDScrapeWork(ctx, swsPrev) })
+	scs.add("http_sd_configs", *http.SDCheckInterval, func(ctx context.Context, cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getHTTPDScrapeWork(ctx, swsPrev) })
+	scs.add("kubernetes_sd_configs", *kubernetes.SDCheckInterval, func(ctx context.Context, cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getKubernetesSDScrapeWork(ctx, swsPrev) })
+	scs.add("openstack_sd_configs", *openstack.SDCheckInterval, func(ctx context.Context, cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getOpenStackSDScrapeWork(ctx, swsPrev) })
+	scs.add("static_configs", 0, func(ctx context.Context, cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getStaticScrapeWork() })
 
 	var tickerCh <-chan time.Time
 	if *configCheckInterval > 0 {
@@ -148,8 +185,7 @@ func runScraper(configFile string, pushData func(wr *prompbmarshal.WriteRequest)
 			cfgNew.mustRestart(cfg)
 			cfg = cfgNew
 			data = dataNew
-			marshaledData = cfgNew.marshal()
-			configData.Store(&marshaledData)
+			storeConfigData(cfg)
 		case <-tickerCh:
 			cfgNew, dataNew, err := loadConfig(configFile)
 			if err != nil {
@@ -163,7 +199,7 @@ func runScraper(configFile string, pushData func(wr *prompbmarshal.WriteRequest)
 			cfgNew.mustRestart(cfg)
 			cfg = cfgNew
 			data = dataNew
-			configData.Store(&marshaledData)
+			storeConfigData(cfg)
 		case <-globalStopCh:
 			cfg.mustStop()
 			logger.Infof("stopping Prometheus scrapers")
@@ -195,13 +231,14 @@ func newScrapeConfigs(pushData func(wr *prompbmarshal.WriteRequest), globalStopC
 	}
 }
 
-func (scs *scrapeConfigs) add(name string, checkInterval time.Duration, getScrapeWork func(cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork) {
+func (scs *scrapeConfigs) add(name string, checkInterval time.Duration, getScrapeWork func(ctx context.Context, cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork) {
 	atomic.AddInt32(&PendingScrapeConfigs, 1)
 	scfg := &scrapeConfig{
 		name:          name,
 		pushData:      scs.pushData,
 		getScrapeWork: getScrapeWork,
 		checkInterval: checkInterval,
+		timeout:       *discoveryTimeout,
 		cfgCh:         make(chan *Config, 1),
 		stopCh:        scs.stopCh,
 
@@ -215,8 +252,16 @@ func (scs *scrapeConfigs) add(name string, checkInterval time.Duration, getScrap
 	scs.scfgs = append(scs.scfgs, scfg)
 }
 
+// updateConfig passes cfg to all the scs.scfgs.
+//
+// It doesn't block if some of scs.scfgs are busy with slow service discovery.
 func (scs *scrapeConfigs) updateConfig(cfg *Config) {
 	for _, scfg := range scs.scfgs {
+		// Drop the previous config if it isn't picked up yet, since it is superseded by cfg.
+		select {
+		case <-scfg.cfgCh:
+		default:
+		}
 		scfg.cfgCh <- cfg
 	}
 }
@@ -230,11 +275,14 @@ func (scs *scrapeConfigs) stop() {
 type scrapeConfig struct {
 	name          string
 	pushData      func(wr *prompbmarshal.WriteRequest)
-	getScrapeWork func(cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork
+	getScrapeWork func(ctx context.Context, cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork
 	checkInterval time.Duration
 	cfgCh         chan *Config
 	stopCh        <-chan struct{}
 
+	// timeout is the deadline for getScrapeWork call. It is passed to getScrapeWork via ctx.
+	timeout time.Duration
+
 	discoveryDuration *metrics.Histogram
 }
 
@@ -249,27 +297,89 @@ func (scfg *scrapeConfig) run(globalStopCh <-chan struct{}) {
 		tickerCh = ticker.C
 	}
 
-	cfg := <-scfg.cfgCh
+	var cfg *Config
+	select {
+	case <-scfg.stopCh:
+		atomic.AddInt32(&PendingScrapeConfigs, -1)
+		return
+	case cfg = <-scfg.cfgCh:
+	}
+
+	// Targets are discovered in background, so slow service discovery doesn't block config reloads.
+	// The previously discovered targets are kept until the discovery is finished.
+	// Only a single discovery may be in flight at any time. A config received during the discovery
+	// is applied after the discovery is finished, so slow service discovery doesn't pile up goroutines.
 	var swsPrev []*ScrapeWork
-	updateScrapeWork := func(cfg *Config) {
-		startTime := time.Now()
-		sws := scfg.getScrapeWork(cfg, swsPrev)
-		sg.update(sws)
-		swsPrev = sws
-		scfg.discoveryDuration.UpdateDuration(startTime)
+	var swsCh chan []*ScrapeWork
+	var pendingCfg *Config
+	var cancel context.CancelFunc
+	var timeoutCh <-chan struct{}
+	var startTime time.Time
+	isPending := true
+	markReady := func() {
+		if isPending {
+			isPending = false
+			atomic.AddInt32(&PendingScrapeConfigs, -1)
+		}
 	}
-	updateScrapeWork(cfg)
-	atomic.AddInt32(&PendingScrapeConfigs, -1)
+	defer markReady()
+	defer func() {
+		if cancel != nil {
+			cancel()
+		}
+	}()
+	startDiscovery := func(cfg *Config) {
+		if swsCh != nil {
+			pendingCfg = cfg
+			return
+		}
+		pendingCfg = nil
+		ctx, cancelLocal := context.WithCancel(context.Background())
+		if scfg.timeout > 0 {
+			ctx, cancelLocal = context.WithTimeout(context.Background(), scfg.timeout)
+		}
+		ch := make(chan []*ScrapeWork, 1)
+		swsPrevLocal := swsPrev
+		go func() {
+			ch <- scfg.getScrapeWork(ctx, cfg, swsPrevLocal)
+		}()
+		swsCh = ch
+		cancel = cancelLocal
+		timeoutCh = ctx.Done()
+		startTime = time.Now()
+	}
+	startDiscovery(cfg)
 
 	for {
-
 		select {
 		case <-scfg.stopCh:
 			return
 		case cfg = <-scfg.cfgCh:
+			startDiscovery(cfg)
 		case <-tickerCh:
+			if swsCh != nil {
+				// The previous discovery is still in progress.
+				continue
+			}
+			startDiscovery(cfg)
+		case sws := <-swsCh:
+			swsCh = nil
+			cancel()
+			cancel = nil
+			timeoutCh = nil
+			sg.update(sws)
+			swsPrev = sws
+			scfg.discoveryDuration.UpdateDuration(startTime)
+			markReady()
+			if pendingCfg != nil {
+				startDiscovery(pendingCfg)
+			}
+		case <-timeoutCh:
+			timeoutCh = nil
+			logger.Warnf("cannot discover targets for %s in %s; keeping the previously discovered %d targets until the discovery is finished; "+
+				"see -promscrape.discovery.timeout", scfg.name, scfg.timeout, len(swsPrev))
+			markReady()
 		}
-		updateScrapeWork(cfg)
 	}
 }
 
@@ -414,6 +524,9 @@ func newScraper(sw *ScrapeWork, group string, pushData func(wr *prompbmarshal.Wr
 	sc.sw.ScrapeGroup = group
 	sc.sw.ReadData = c.ReadData
 	sc.sw.GetStreamReader = c.GetStreamReader
+	if len(sw.ResponseHeaderLabels) > 0 {
+		sc.sw.GetResponseHeaderLabels = c.GetResponseHeaderLabels
+	}
 	sc.sw.PushData = pushData
 	return sc
 }
@@ -0,0 +1,109 @@
+package promscrape
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+func TestScrapeConfigsSlowDiscovery(t *testing.T) {
+	prevDiscoveryTimeout := *discoveryTimeout
+	*discoveryTimeout = 100 * time.Millisecond
+	defer func() {
+		*discoveryTimeout = prevDiscoveryTimeout
+	}()
+	pendingScrapeConfigsPrev := atomic.LoadInt32(&PendingScrapeConfigs)
+
+	globalStopCh := make(chan struct{})
+	defer close(globalStopCh)
+	scs := newScrapeConfigs(func(wr *prompbmarshal.WriteRequest) {}, globalStopCh)
+
+	// The service discovery, which ignores ctx and hangs until hangCh is closed.
+	hangCh := make(chan struct{})
+	slowCfgCh := make(chan *Config, 10)
+	scs.add("slow_sd_configs", 0, func(ctx context.Context, cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork {
+		if _, ok := ctx.Deadline(); !ok {
+			panic(fmt.Errorf("BUG: missing deadline in ctx passed to getScrapeWork"))
+		}
+		slowCfgCh <- cfg
+		<-hangCh
+		return nil
+	})
+	fastCfgCh := make(chan *Config, 10)
+	scs.add("fast_sd_configs", 0, func(ctx context.Context, cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork {
+		fastCfgCh <- cfg
+		return nil
+	})
+	defer scs.stop()
+
+	waitForConfig := func(cfgExpected *Config) {
+		t.Helper()
+		timer := time.NewTimer(5 * time.Second)
+		defer timer.Stop()
+		for {
+			select {
+			case cfg := <-fastCfgCh:
+				if cfg == cfgExpected {
+					return
+				}
+			case <-timer.C:
+				t.Fatalf("timeout when waiting for fast_sd_configs discovery")
+			}
+		}
+	}
+
+	// The fast discovery must proceed while the slow discovery hangs.
+	cfg1 := &Config{}
+	scs.updateConfig(cfg1)
+	waitForConfig(cfg1)
+
+	// Config reloads mustn't be blocked by the slow discovery.
+	cfg2 := &Config{}
+	doneCh := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			scs.updateConfig(cfg2)
+		}
+		close(doneCh)
+	}()
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("config reload is blocked by the slow discovery")
+	}
+	waitForConfig(cfg2)
+
+	// The slow discovery must time out, so it doesn't block vmagent readiness.
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&PendingScrapeConfigs) != pendingScrapeConfigsPrev {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout when waiting for slow_sd_configs discovery timeout; pendingScrapeConfigs=%d", atomic.LoadInt32(&PendingScrapeConfigs))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Only a single slow discovery must be in flight.
+	if cfg := <-slowCfgCh; cfg != cfg1 {
+		t.Fatalf("unexpected config passed to the first slow discovery")
+	}
+	select {
+	case <-slowCfgCh:
+		t.Fatalf("unexpected slow discovery started while the previous one is in flight")
+	default:
+	}
+
+	// The last config must be discovered after the in-flight discovery is finished.
+	close(hangCh)
+	select {
+	case cfg := <-slowCfgCh:
+		if cfg != cfg2 {
+			t.Fatalf("unexpected config passed to the second slow discovery")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout when waiting for the discovery of the pending config")
+	}
+}
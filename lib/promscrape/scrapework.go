@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bloomfilter"
@@ -101,12 +102,20 @@ type ScrapeWork struct {
 	// The maximum number of metrics to scrape after relabeling.
 	SampleLimit int
 
+	// The maximum size of scrape response in bytes. It is set via `body_size_limit` option.
+	// -promscrape.maxScrapeSize is used if it is zero.
+	MaxScrapeSize int
+
 	// Whether to disable response compression when querying ScrapeURL.
 	DisableCompression bool
 
 	// Whether to disable HTTP keep-alive when querying ScrapeURL.
 	DisableKeepAlive bool
 
+	// The maximum duration for keeping idle keep-alive connections to ScrapeURL.
+	// 2*ScrapeInterval is used if it isn't set.
+	IdleConnTimeout time.Duration
+
 	// Whether to parse target responses in a streaming manner.
 	StreamParse bool
 
@@ -119,6 +128,17 @@ type ScrapeWork struct {
 	// Optional limit on the number of unique series the scrape target can expose.
 	SeriesLimit int
 
+	// The value for the `Accept` request header. It is built from `scrape_protocols`.
+	// defaultAcceptHeader is used if it is empty.
+	AcceptHeader string
+
+	// Optional mapping from response header names to label names, which must be added to the scraped metrics.
+	ResponseHeaderLabels map[string]string
+
+	// Optional headers to send to ScrapeURL sorted by header name.
+	// Header values are obtained from `headers` templates in `scrape_config` for the given target labels.
+	Headers []prompbmarshal.Label
+
 	// The original 'job_name'
 	jobNameOriginal string
 }
@@ -129,6 +149,14 @@ func (sw *ScrapeWork) canSwitchToStreamParseMode() bool {
 	return sw.SampleLimit <= 0 && sw.SeriesLimit <= 0
 }
 
+// getMaxScrapeSize returns the maximum size of scrape response in bytes for sw.
+func (sw *ScrapeWork) getMaxScrapeSize() int {
+	if sw.MaxScrapeSize > 0 {
+		return sw.MaxScrapeSize
+	}
+	return maxScrapeSize.N
+}
+
 // key returns unique identifier for the given sw.
 //
 // It can be used for comparing for equality for two ScrapeWork objects.
@@ -136,12 +164,12 @@ func (sw *ScrapeWork) key() string {
 	// Do not take into account OriginalLabels, since they can be changed with relabeling.
 	// Take into account JobNameOriginal in order to capture the case when the original job_name is changed via relabeling.
 	key := fmt.Sprintf("JobNameOriginal=%s, ScrapeURL=%s, ScrapeInterval=%s, ScrapeTimeout=%s, HonorLabels=%v, HonorTimestamps=%v, DenyRedirects=%v, Labels=%s, "+
-		"ProxyURL=%s, ProxyAuthConfig=%s, AuthConfig=%s, MetricRelabelConfigs=%s, SampleLimit=%d, DisableCompression=%v, DisableKeepAlive=%v, StreamParse=%v, "+
-		"ScrapeAlignInterval=%s, ScrapeOffset=%s, SeriesLimit=%d",
+		"ProxyURL=%s, ProxyAuthConfig=%s, AuthConfig=%s, MetricRelabelConfigs=%s, SampleLimit=%d, MaxScrapeSize=%d, DisableCompression=%v, DisableKeepAlive=%v, IdleConnTimeout=%s, StreamParse=%v, "+
+		"ScrapeAlignInterval=%s, ScrapeOffset=%s, SeriesLimit=%d, AcceptHeader=%q, ResponseHeaderLabels=%v, Headers=%s",
 		sw.jobNameOriginal, sw.ScrapeURL, sw.ScrapeInterval, sw.ScrapeTimeout, sw.HonorLabels, sw.HonorTimestamps, sw.DenyRedirects, sw.LabelsString(),
 		sw.ProxyURL.String(), sw.ProxyAuthConfig.String(),
-		sw.AuthConfig.String(), sw.MetricRelabelConfigs.String(), sw.SampleLimit, sw.DisableCompression, sw.DisableKeepAlive, sw.StreamParse,
-		sw.ScrapeAlignInterval, sw.ScrapeOffset, sw.SeriesLimit)
+		sw.AuthConfig.String(), sw.MetricRelabelConfigs.String(), sw.SampleLimit, sw.MaxScrapeSize, sw.DisableCompression, sw.DisableKeepAlive, sw.IdleConnTimeout, sw.StreamParse,
+		sw.ScrapeAlignInterval, sw.ScrapeOffset, sw.SeriesLimit, sw.AcceptHeader, sw.ResponseHeaderLabels, promLabelsString(sw.Headers))
 	return key
 }
 
@@ -187,6 +215,10 @@ type scrapeWork struct {
 	// GetStreamReader is called if Config.StreamParse is set.
 	GetStreamReader func() (*streamReader, error)
 
+	// GetResponseHeaderLabels is called for obtaining labels from response headers of the last successful scrape.
+	// It may be nil if Config.ResponseHeaderLabels isn't set.
+	GetResponseHeaderLabels func() []prompbmarshal.Label
+
 	// PushData is called for pushing collected data.
 	PushData func(wr *prompbmarshal.WriteRequest)
 
@@ -196,6 +228,10 @@ type scrapeWork struct {
 
 	tmpRow parser.Row
 
+	// scrapeLabels contains Config.Labels plus labels obtained from response headers during the last successful scrape.
+	// It is nil if response header labels aren't configured.
+	scrapeLabels []prompbmarshal.Label
+
 	// This flag is set to true if series_limit is exceeded.
 	seriesLimitExceeded bool
 
@@ -231,6 +267,10 @@ type scrapeWork struct {
 
 	// errsSuppressedCount is the number of suppressed scrape errors since lastErrLogTimestamp
 	errsSuppressedCount int
+
+	// metadataHash is the hash of TYPE, HELP and UNIT metadata pushed during the last scrape.
+	// It is used for pushing metadata only when it changes, since it is rarely changed between scrapes.
+	metadataHash uint64
 }
 
 func (sw *scrapeWork) loadLastScrape() string {
@@ -366,6 +406,7 @@ func (sw *scrapeWork) logError(s string) {
 }
 
 func (sw *scrapeWork) scrapeAndLogError(scrapeTimestamp, realTimestamp int64) {
+	jobLastScrapeTimestamps.update(sw.Config.Job(), realTimestamp)
 	err := sw.scrapeInternal(scrapeTimestamp, realTimestamp)
 	if err == nil {
 		return
@@ -393,6 +434,45 @@ var (
 	pushDataDuration            = metrics.NewHistogram("vm_promscrape_push_data_duration_seconds")
 )
 
+// jobLastScrapeTimestamps tracks the timestamp of the last scrape per each scrape job.
+//
+// It is exposed via vm_promscrape_job_last_scrape_timestamp{job="..."} metric, which can be used
+// as a dead man's switch for detecting jobs, which silently stopped scraping.
+var jobLastScrapeTimestamps = &jobTimestamps{
+	m: make(map[string]*int64),
+}
+
+type jobTimestamps struct {
+	mu sync.Mutex
+	m  map[string]*int64
+}
+
+// update sets the last scrape timestamp in milliseconds for the given job.
+func (jt *jobTimestamps) update(job string, timestamp int64) {
+	jt.mu.Lock()
+	p := jt.m[job]
+	if p == nil {
+		p = new(int64)
+		jt.m[job] = p
+		metrics.NewGauge(fmt.Sprintf(`vm_promscrape_job_last_scrape_timestamp{job=%q}`, job), func() float64 {
+			return float64(atomic.LoadInt64(p)) / 1e3
+		})
+	}
+	jt.mu.Unlock()
+	atomic.StoreInt64(p, timestamp)
+}
+
+// get returns the last scrape timestamp in milliseconds for the given job.
+func (jt *jobTimestamps) get(job string) int64 {
+	jt.mu.Lock()
+	p := jt.m[job]
+	jt.mu.Unlock()
+	if p == nil {
+		return 0
+	}
+	return atomic.LoadInt64(p)
+}
+
 func (sw *scrapeWork) mustSwitchToStreamParseMode(responseSize int) bool {
 	if minResponseSizeForStreamParse.N <= 0 {
 		return false
@@ -442,13 +522,16 @@ func (sw *scrapeWork) scrapeInternal(scrapeTimestamp, realTimestamp int64) error
 		up = 0
 		scrapesFailed.Inc()
 	} else {
+		sw.updateScrapeLabels()
 		wc.rows.UnmarshalWithErrLogger(bodyString, sw.logError)
+		sw.pushMetadataIfChanged(wc.rows.Metadata)
 	}
 	srcRows := wc.rows.Rows
 	samplesScraped := len(srcRows)
 	scrapedSamples.Update(float64(samplesScraped))
+	scrapeLabels := sw.getScrapeLabels()
 	for i := range srcRows {
-		sw.addRowToTimeseries(wc, &srcRows[i], scrapeTimestamp, true)
+		sw.addRowToTimeseries(wc, &srcRows[i], scrapeLabels, scrapeTimestamp, true)
 	}
 	samplesPostRelabeling := len(wc.writeRequest.Timeseries)
 	if sw.Config.SampleLimit > 0 && samplesPostRelabeling > sw.Config.SampleLimit {
@@ -540,13 +623,20 @@ func (sw *scrapeWork) scrapeStream(scrapeTimestamp, realTimestamp int64) error {
 		err = fmt.Errorf("cannot read data: %s", err)
 	} else {
 		var mu sync.Mutex
+		var mdsScraped []parser.Metadata
+		sw.updateScrapeLabels()
+		scrapeLabels := sw.getScrapeLabels()
 		sbr.sr = sr
-		err = parser.ParseStream(sbr, scrapeTimestamp, false, func(rows []parser.Row) error {
+		err = parser.ParseStreamWithMetadata(sbr, scrapeTimestamp, false, func(rows []parser.Row, mds []parser.Metadata) error {
 			mu.Lock()
 			defer mu.Unlock()
+			if pushMetadata != nil {
+				// mds cannot be held after returning from the callback, so copy them.
+				mdsScraped = appendMetadataCopy(mdsScraped, mds)
+			}
 			samplesScraped += len(rows)
 			for i := range rows {
-				sw.addRowToTimeseries(wc, &rows[i], scrapeTimestamp, true)
+				sw.addRowToTimeseries(wc, &rows[i], scrapeLabels, scrapeTimestamp, true)
 			}
 			// Push the collected rows to sw before returning from the callback, since they cannot be held
 			// after returning from the callback - this will result in data race.
@@ -563,6 +653,9 @@ func (sw *scrapeWork) scrapeStream(scrapeTimestamp, realTimestamp int64) error {
 			return nil
 		}, sw.logError)
 		sr.MustClose()
+		if err == nil {
+			sw.pushMetadataIfChanged(mdsScraped)
+		}
 	}
 	lastScrape := sw.loadLastScrape()
 	bodyString := bytesutil.ToUnsafeString(sbr.body)
@@ -735,8 +828,9 @@ func (sw *scrapeWork) sendStaleSeries(lastScrape, currScrape string, timestamp i
 	if bodyString != "" {
 		wc.rows.Unmarshal(bodyString)
 		srcRows := wc.rows.Rows
+		scrapeLabels := sw.getScrapeLabels()
 		for i := range srcRows {
-			sw.addRowToTimeseries(wc, &srcRows[i], timestamp, true)
+			sw.addRowToTimeseries(wc, &srcRows[i], scrapeLabels, timestamp, true)
 		}
 	}
 	if addAutoSeries {
@@ -775,6 +869,52 @@ func (sw *scrapeWork) getLabelsHash(labels []prompbmarshal.Label) uint64 {
 	return xxhash.Sum64(b)
 }
 
+// pushMetadataIfChanged pushes mds if they differ from the metadata pushed during the previous scrape.
+func (sw *scrapeWork) pushMetadataIfChanged(mds []parser.Metadata) {
+	if pushMetadata == nil || len(mds) == 0 {
+		return
+	}
+	h := getMetadataHash(mds)
+	if h == sw.metadataHash {
+		return
+	}
+	pushMetadata(mds)
+	sw.metadataHash = h
+}
+
+// getMetadataHash returns the hash for mds.
+//
+// The hash doesn't depend on the order of mds, since metadata may be obtained in arbitrary order in stream parsing mode.
+func getMetadataHash(mds []parser.Metadata) uint64 {
+	var b []byte
+	h := uint64(0)
+	for i := range mds {
+		md := &mds[i]
+		b = append(b[:0], md.Metric...)
+		b = append(b, 0)
+		b = append(b, md.Type...)
+		b = append(b, 0)
+		b = append(b, md.Help...)
+		b = append(b, 0)
+		b = append(b, md.Unit...)
+		h += xxhash.Sum64(b)
+	}
+	return h
+}
+
+// appendMetadataCopy appends copies of mds to dst and returns the result.
+func appendMetadataCopy(dst, mds []parser.Metadata) []parser.Metadata {
+	for _, md := range mds {
+		dst = append(dst, parser.Metadata{
+			Metric: string(append([]byte(nil), md.Metric...)),
+			Type:   string(append([]byte(nil), md.Type...)),
+			Help:   string(append([]byte(nil), md.Help...)),
+			Unit:   string(append([]byte(nil), md.Unit...)),
+		})
+	}
+	return dst
+}
+
 // addAutoTimeseries adds automatically generated time series with the given name, value and timestamp.
 //
 // See https://prometheus.io/docs/concepts/jobs_instances/#automatically-generated-labels-and-time-series
@@ -783,12 +923,37 @@ func (sw *scrapeWork) addAutoTimeseries(wc *writeRequestCtx, name string, value
 	sw.tmpRow.Tags = nil
 	sw.tmpRow.Value = value
 	sw.tmpRow.Timestamp = timestamp
-	sw.addRowToTimeseries(wc, &sw.tmpRow, timestamp, false)
+	sw.addRowToTimeseries(wc, &sw.tmpRow, sw.Config.Labels, timestamp, false)
+}
+
+// updateScrapeLabels updates sw.scrapeLabels with the labels from response headers of the last successful scrape.
+//
+// Target labels take precedence over labels obtained from response headers with the same names.
+func (sw *scrapeWork) updateScrapeLabels() {
+	if sw.GetResponseHeaderLabels == nil {
+		return
+	}
+	dst := append(sw.scrapeLabels[:0], sw.Config.Labels...)
+	for _, label := range sw.GetResponseHeaderLabels() {
+		if promrelabel.GetLabelByName(sw.Config.Labels, label.Name) != nil {
+			continue
+		}
+		dst = append(dst, label)
+	}
+	sw.scrapeLabels = dst
+}
+
+// getScrapeLabels returns labels, which must be added to the scraped metrics.
+func (sw *scrapeWork) getScrapeLabels() []prompbmarshal.Label {
+	if sw.scrapeLabels == nil {
+		return sw.Config.Labels
+	}
+	return sw.scrapeLabels
 }
 
-func (sw *scrapeWork) addRowToTimeseries(wc *writeRequestCtx, r *parser.Row, timestamp int64, needRelabel bool) {
+func (sw *scrapeWork) addRowToTimeseries(wc *writeRequestCtx, r *parser.Row, extraLabels []prompbmarshal.Label, timestamp int64, needRelabel bool) {
 	labelsLen := len(wc.labels)
-	wc.labels = appendLabels(wc.labels, r.Metric, r.Tags, sw.Config.Labels, sw.Config.HonorLabels)
+	wc.labels = appendLabels(wc.labels, r.Metric, r.Tags, extraLabels, sw.Config.HonorLabels)
 	if needRelabel {
 		wc.labels = sw.Config.MetricRelabelConfigs.Apply(wc.labels, labelsLen, true)
 	} else {
@@ -2,6 +2,7 @@ package promscrape
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
 	parser "github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/prometheus"
+	"github.com/VictoriaMetrics/metrics"
 )
 
 func TestPromLabelsString(t *testing.T) {
@@ -471,3 +473,155 @@ func mustParseRelabelConfigs(config string) *promrelabel.ParsedConfigs {
 	}
 	return pcs
 }
+
+func TestJobLastScrapeTimestamp(t *testing.T) {
+	const job = "test_job_last_scrape_timestamp"
+	var sw scrapeWork
+	sw.Config = &ScrapeWork{
+		ScrapeTimeout: time.Second * 42,
+		Labels: []prompbmarshal.Label{{
+			Name:  "job",
+			Value: job,
+		}},
+	}
+	sw.ReadData = func(dst []byte) ([]byte, error) {
+		return append(dst, "foo 123\n"...), nil
+	}
+	sw.PushData = func(wr *prompbmarshal.WriteRequest) {}
+
+	f := func(timestampExpected int64) {
+		t.Helper()
+		if ts := jobLastScrapeTimestamps.get(job); ts != timestampExpected {
+			t.Fatalf("unexpected last scrape timestamp; got %d; want %d", ts, timestampExpected)
+		}
+		g := metrics.GetOrCreateGauge(fmt.Sprintf(`vm_promscrape_job_last_scrape_timestamp{job=%q}`, job), nil)
+		if v := g.Get(); v != float64(timestampExpected)/1e3 {
+			t.Fatalf("unexpected vm_promscrape_job_last_scrape_timestamp value; got %v; want %v", v, float64(timestampExpected)/1e3)
+		}
+	}
+
+	// The metric must advance on every scrape
+	sw.scrapeAndLogError(123000, 123000)
+	f(123000)
+	sw.scrapeAndLogError(138000, 138500)
+	f(138500)
+
+	// The metric must advance on failed scrapes too, since the job continues scraping
+	sw.ReadData = func(dst []byte) ([]byte, error) {
+		return dst, fmt.Errorf("error when reading data")
+	}
+	sw.scrapeAndLogError(153000, 153000)
+	f(153000)
+
+	// The metric must stay flat after the job is removed, e.g. when there are no more scrapes for the job
+	sw.Config.Labels[0].Value = "another_job"
+	sw.scrapeAndLogError(168000, 168000)
+	f(153000)
+}
+
+func TestScrapeWorkResponseHeaderLabels(t *testing.T) {
+	var sw scrapeWork
+	sw.Config = &ScrapeWork{
+		ScrapeTimeout: time.Second * 42,
+		Labels: []prompbmarshal.Label{{
+			Name:  "job",
+			Value: "foo",
+		}},
+	}
+	sw.ReadData = func(dst []byte) ([]byte, error) {
+		return append(dst, `foo{bar="baz"} 34.45`+"\n"...), nil
+	}
+	sw.GetResponseHeaderLabels = func() []prompbmarshal.Label {
+		return []prompbmarshal.Label{
+			{
+				Name:  "build_hash",
+				Value: "abc123",
+			},
+			// Target labels take precedence over labels from response headers
+			{
+				Name:  "job",
+				Value: "bar",
+			},
+		}
+	}
+	var tss []prompbmarshal.TimeSeries
+	sw.PushData = func(wr *prompbmarshal.WriteRequest) {
+		for _, ts := range wr.Timeseries {
+			tss = append(tss, prompbmarshal.TimeSeries{
+				Labels:  append([]prompbmarshal.Label{}, ts.Labels...),
+				Samples: append([]prompbmarshal.Sample{}, ts.Samples...),
+			})
+		}
+	}
+	timestamp := int64(123000)
+	if err := sw.scrapeInternal(timestamp, timestamp); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Labels from response headers are added only to the scraped metrics
+	tssExpected := parseData(`
+		foo{bar="baz",build_hash="abc123",job="foo"} 34.45 123
+		up{job="foo"} 1 123
+		scrape_samples_scraped{job="foo"} 1 123
+		scrape_duration_seconds{job="foo"} 0 123
+		scrape_samples_post_metric_relabeling{job="foo"} 1 123
+		scrape_series_added{job="foo"} 1 123
+		scrape_timeout_seconds{job="foo"} 42 123
+	`)
+	if err := expectEqualTimeseries(tss, tssExpected); err != nil {
+		t.Fatalf("unexpected data pushed: %s", err)
+	}
+}
+
+func TestScrapeWorkPushMetadataIfChanged(t *testing.T) {
+	var pushedMetadata [][]parser.Metadata
+	pushMetadataOrig := pushMetadata
+	pushMetadata = func(mds []parser.Metadata) {
+		pushedMetadata = append(pushedMetadata, appendMetadataCopy(nil, mds))
+	}
+	defer func() {
+		pushMetadata = pushMetadataOrig
+	}()
+
+	var sw scrapeWork
+	sw.Config = &ScrapeWork{
+		ScrapeTimeout: time.Second * 42,
+	}
+	sw.PushData = func(wr *prompbmarshal.WriteRequest) {}
+	f := func(data string, pushesExpected int) {
+		t.Helper()
+		sw.ReadData = func(dst []byte) ([]byte, error) {
+			return append(dst, data...), nil
+		}
+		timestamp := int64(123000)
+		if err := sw.scrapeInternal(timestamp, timestamp); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(pushedMetadata) != pushesExpected {
+			t.Fatalf("unexpected number of metadata pushes; got %d; want %d", len(pushedMetadata), pushesExpected)
+		}
+	}
+
+	// Metadata must be pushed on the first scrape
+	f("# TYPE foo counter\n# HELP foo some help\nfoo 1\n", 1)
+
+	// Unchanged metadata mustn't be pushed
+	f("# TYPE foo counter\n# HELP foo some help\nfoo 2\n", 1)
+	f("# HELP foo some help\n# TYPE foo counter\nfoo 3\n", 1)
+
+	// Responses without metadata mustn't change the last pushed metadata
+	f("foo 4\n", 1)
+	f("# TYPE foo counter\n# HELP foo some help\nfoo 5\n", 1)
+
+	// Changed metadata must be pushed
+	f("# TYPE foo counter\n# HELP foo another help\nfoo 6\n", 2)
+	f("# TYPE foo counter\n# HELP foo another help\n# TYPE bar gauge\nfoo 7\nbar 1\n", 3)
+	f("# TYPE foo counter\n# HELP foo another help\n# TYPE bar gauge\nfoo 8\nbar 2\n", 3)
+
+	mdsExpected := []parser.Metadata{
+		{Metric: "foo", Type: "counter", Help: "another help"},
+		{Metric: "bar", Type: "gauge"},
+	}
+	if !reflect.DeepEqual(pushedMetadata[2], mdsExpected) {
+		t.Fatalf("unexpected metadata pushed\ngot\n%+v\nwant\n%+v", pushedMetadata[2], mdsExpected)
+	}
+}
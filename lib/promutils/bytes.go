@@ -0,0 +1,57 @@
+package promutils
+
+import (
+	"strconv"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+)
+
+// Bytes is size in bytes, which can be used in Prometheus-compatible yaml configs.
+//
+// It supports the following optional suffixes for values: KB, MB, GB, KiB, MiB, GiB.
+type Bytes struct {
+	N int
+
+	valueString string
+}
+
+// NewBytes returns Bytes for the given n.
+func NewBytes(n int) *Bytes {
+	return &Bytes{
+		N: n,
+	}
+}
+
+// MarshalYAML implements yaml.Marshaler interface.
+func (b Bytes) MarshalYAML() (interface{}, error) {
+	if _, err := strconv.Atoi(b.valueString); err == nil || b.valueString == "" {
+		// Marshal sizes without suffixes as numbers.
+		return b.N, nil
+	}
+	return b.valueString, nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler interface.
+func (b *Bytes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	var fb flagutil.Bytes
+	if err := fb.Set(s); err != nil {
+		return err
+	}
+	b.N = fb.N
+	b.valueString = fb.String()
+	return nil
+}
+
+// Bytes returns the size in bytes for b.
+//
+// Zero is returned if b is nil.
+func (b *Bytes) Bytes() int {
+	if b == nil {
+		return 0
+	}
+	return b.N
+}
@@ -0,0 +1,54 @@
+package promutils
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestBytesUnmarshalYAMLSuccess(t *testing.T) {
+	f := func(s string, nExpected int, sExpected string) {
+		t.Helper()
+		var b Bytes
+		if err := yaml.UnmarshalStrict([]byte(s), &b); err != nil {
+			t.Fatalf("unexpected error when unmarshaling %q: %s", s, err)
+		}
+		if n := b.Bytes(); n != nExpected {
+			t.Fatalf("unexpected bytes for %q; got %d; want %d", s, n, nExpected)
+		}
+		data, err := yaml.Marshal(&b)
+		if err != nil {
+			t.Fatalf("unexpected error when marshaling %q: %s", s, err)
+		}
+		if string(data) != sExpected {
+			t.Fatalf("unexpected marshaled value for %q; got %q; want %q", s, data, sExpected)
+		}
+	}
+	f("1234", 1234, "1234\n")
+	f("10KB", 10*1000, "10KB\n")
+	f("1.5MiB", 1.5*1024*1024, "1.5MiB\n")
+	f("2gb", 2*1000*1000*1000, "2GB\n")
+}
+
+func TestBytesUnmarshalYAMLFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		var b Bytes
+		if err := yaml.UnmarshalStrict([]byte(s), &b); err == nil {
+			t.Fatalf("expecting non-nil error when unmarshaling %q", s)
+		}
+	}
+	f("foobar")
+	f("12XB")
+	f("[1]")
+}
+
+func TestBytesNil(t *testing.T) {
+	var b *Bytes
+	if n := b.Bytes(); n != 0 {
+		t.Fatalf("unexpected bytes for nil Bytes; got %d; want 0", n)
+	}
+	if n := NewBytes(123).Bytes(); n != 123 {
+		t.Fatalf("unexpected bytes; got %d; want 123", n)
+	}
+}
@@ -0,0 +1,173 @@
+package common
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	deadLetterDir = flag.String("deadLetter.dir", "", "Optional path to directory for storing raw payloads, which couldn't be parsed during data ingestion or scraping. "+
+		"By default such payloads are logged and dropped. See https://docs.victoriametrics.com/#dead-letter-queue")
+	deadLetterMaxDiskUsage = flagutil.NewBytes("deadLetter.maxDiskUsage", 100*1024*1024, "The maximum disk space, which can be occupied by files at -deadLetter.dir. "+
+		"The oldest payloads are dropped when the limit is reached")
+)
+
+// maxDeadLetterPayloadSize is the maximum size of a single payload stored at -deadLetter.dir.
+//
+// Bigger payloads are truncated.
+const maxDeadLetterPayloadSize = 64 * 1024
+
+const (
+	deadLetterFilename     = "deadletter.jsonl"
+	deadLetterPrevFilename = "deadletter.jsonl.1"
+)
+
+var (
+	deadLetterPayloads = metrics.NewCounter(`vm_deadletter_payloads_total`)
+	deadLetterErrors   = metrics.NewCounter(`vm_deadletter_errors_total`)
+)
+
+// WriteDeadLetter stores the given payload, which couldn't be parsed because of parseErr, at -deadLetter.dir.
+//
+// typ must contain the name of data ingestion protocol such as `prometheus` or `vmimport`.
+// It is no-op if -deadLetter.dir isn't set.
+func WriteDeadLetter(typ, payload string, parseErr error) {
+	dir := *deadLetterDir
+	if dir == "" {
+		return
+	}
+	truncated := false
+	if len(payload) > maxDeadLetterPayloadSize {
+		payload = payload[:maxDeadLetterPayloadSize]
+		truncated = true
+	}
+	r := DeadLetterRecord{
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		Type:      typ,
+		Error:     parseErr.Error(),
+		Payload:   payload,
+		Truncated: truncated,
+	}
+	data, err := json.Marshal(&r)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal dead-letter record: %s", err)
+	}
+	data = append(data, '\n')
+	if err := dlw.write(dir, data, int64(deadLetterMaxDiskUsage.N)); err != nil {
+		deadLetterErrors.Inc()
+		logger.Errorf("cannot write payload to -deadLetter.dir=%q: %s", dir, err)
+		return
+	}
+	deadLetterPayloads.Inc()
+}
+
+// DeadLetterRecord is a single record stored at -deadLetter.dir.
+//
+// Records are stored in JSON lines format.
+type DeadLetterRecord struct {
+	// Time is the time when the payload has been rejected in RFC3339 format.
+	Time string `json:"time"`
+
+	// Type is the data ingestion protocol for the payload.
+	Type string `json:"type"`
+
+	// Error is the parse error for the payload.
+	Error string `json:"error"`
+
+	// Payload is the raw payload, which couldn't be parsed.
+	Payload string `json:"payload"`
+
+	// Truncated is set to true if the Payload has been truncated to 64KB.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+var dlw deadLetterWriter
+
+// deadLetterWriter writes records to deadLetterFilename at the given dir.
+//
+// The file is rotated to deadLetterPrevFilename when it reaches the half of maxDiskUsage,
+// so the total size of the files at dir doesn't exceed maxDiskUsage.
+type deadLetterWriter struct {
+	mu   sync.Mutex
+	dir  string
+	f    *os.File
+	size int64
+}
+
+func (w *deadLetterWriter) write(dir string, data []byte, maxDiskUsage int64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f != nil && w.dir != dir {
+		w.closeLocked()
+	}
+	if w.f == nil {
+		if err := w.openLocked(dir); err != nil {
+			return err
+		}
+	}
+	maxFileSize := maxDiskUsage / 2
+	if int64(len(data)) > maxFileSize {
+		return fmt.Errorf("the record size %d bytes exceeds the half of -deadLetter.maxDiskUsage=%d bytes", len(data), maxDiskUsage)
+	}
+	if w.size+int64(len(data)) > maxFileSize {
+		if err := w.rotateLocked(); err != nil {
+			return err
+		}
+	}
+	n, err := w.f.Write(data)
+	w.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("cannot write to %q: %w", w.f.Name(), err)
+	}
+	return nil
+}
+
+func (w *deadLetterWriter) openLocked(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("cannot create directory: %w", err)
+	}
+	path := filepath.Join(dir, deadLetterFilename)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot open file: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("cannot stat %q: %w", path, err)
+	}
+	w.dir = dir
+	w.f = f
+	w.size = fi.Size()
+	return nil
+}
+
+func (w *deadLetterWriter) rotateLocked() error {
+	dir := w.dir
+	w.closeLocked()
+	path := filepath.Join(dir, deadLetterFilename)
+	prevPath := filepath.Join(dir, deadLetterPrevFilename)
+	if err := os.Rename(path, prevPath); err != nil {
+		return fmt.Errorf("cannot rename %q to %q: %w", path, prevPath, err)
+	}
+	return w.openLocked(dir)
+}
+
+func (w *deadLetterWriter) closeLocked() {
+	if err := w.f.Close(); err != nil {
+		logger.Errorf("cannot close %q: %s", w.f.Name(), err)
+	}
+	w.dir = ""
+	w.f = nil
+	w.size = 0
+}
@@ -0,0 +1,111 @@
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readDeadLetterRecords(t *testing.T, path string) []DeadLetterRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("cannot open %q: %s", path, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	var records []DeadLetterRecord
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1024*1024)
+	for sc.Scan() {
+		var r DeadLetterRecord
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			t.Fatalf("cannot unmarshal dead-letter record %q: %s", sc.Bytes(), err)
+		}
+		records = append(records, r)
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatalf("cannot read %q: %s", path, err)
+	}
+	return records
+}
+
+func mustSetDeadLetterFlags(t *testing.T, dir string, maxDiskUsage int) {
+	t.Helper()
+	if err := flag.Set("deadLetter.dir", dir); err != nil {
+		t.Fatalf("cannot set -deadLetter.dir: %s", err)
+	}
+	if err := flag.Set("deadLetter.maxDiskUsage", fmt.Sprintf("%d", maxDiskUsage)); err != nil {
+		t.Fatalf("cannot set -deadLetter.maxDiskUsage: %s", err)
+	}
+}
+
+func TestWriteDeadLetterDisabled(t *testing.T) {
+	mustSetDeadLetterFlags(t, "", 100*1024*1024)
+	payloadsBefore := deadLetterPayloads.Get()
+	WriteDeadLetter("prometheus", "foo{", fmt.Errorf("missing closing brace"))
+	if n := deadLetterPayloads.Get() - payloadsBefore; n != 0 {
+		t.Fatalf("unexpected number of stored payloads; got %d; want 0", n)
+	}
+}
+
+func TestWriteDeadLetter(t *testing.T) {
+	dir := t.TempDir()
+	mustSetDeadLetterFlags(t, dir, 100*1024*1024)
+	defer mustSetDeadLetterFlags(t, "", 100*1024*1024)
+
+	WriteDeadLetter("prometheus", "foo{", fmt.Errorf("missing closing brace"))
+	WriteDeadLetter("vmimport", strings.Repeat("x", maxDeadLetterPayloadSize+1), fmt.Errorf("cannot parse json"))
+
+	records := readDeadLetterRecords(t, filepath.Join(dir, deadLetterFilename))
+	if len(records) != 2 {
+		t.Fatalf("unexpected number of records; got %d; want 2", len(records))
+	}
+	r := records[0]
+	if r.Type != "prometheus" || r.Payload != "foo{" || r.Error != "missing closing brace" || r.Truncated || r.Time == "" {
+		t.Fatalf("unexpected record: %+v", r)
+	}
+	r = records[1]
+	if r.Type != "vmimport" || len(r.Payload) != maxDeadLetterPayloadSize || !r.Truncated {
+		t.Fatalf("unexpected truncated record: type=%q, payloadLen=%d, truncated=%v", r.Type, len(r.Payload), r.Truncated)
+	}
+}
+
+func TestWriteDeadLetterRotation(t *testing.T) {
+	dir := t.TempDir()
+	const maxDiskUsage = 4096
+	mustSetDeadLetterFlags(t, dir, maxDiskUsage)
+	defer mustSetDeadLetterFlags(t, "", 100*1024*1024)
+
+	payload := strings.Repeat("a", 100)
+	for i := 0; i < 1000; i++ {
+		WriteDeadLetter("graphite", payload, fmt.Errorf("error #%d", i))
+	}
+
+	var diskUsage int64
+	for _, filename := range []string{deadLetterFilename, deadLetterPrevFilename} {
+		fi, err := os.Stat(filepath.Join(dir, filename))
+		if err != nil {
+			t.Fatalf("cannot stat %q: %s", filename, err)
+		}
+		diskUsage += fi.Size()
+	}
+	if diskUsage > maxDiskUsage {
+		t.Fatalf("disk usage at -deadLetter.dir exceeds %d bytes: %d bytes", maxDiskUsage, diskUsage)
+	}
+
+	// The most recent record must be preserved.
+	records := readDeadLetterRecords(t, filepath.Join(dir, deadLetterFilename))
+	if len(records) == 0 {
+		t.Fatalf("missing records")
+	}
+	if r := records[len(records)-1]; r.Error != "error #999" {
+		t.Fatalf("unexpected last record: %+v", r)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/common"
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/valyala/fastjson/fastfloat"
 )
@@ -159,6 +160,7 @@ func unmarshalRow(dst []Row, s string, tagsPool []Tag) ([]Row, []Tag) {
 		dst = dst[:len(dst)-1]
 		logger.Errorf("cannot unmarshal Graphite line %q: %s", s, err)
 		invalidLines.Inc()
+		common.WriteDeadLetter("graphite", s, err)
 	}
 	return dst, tagsPool
 }
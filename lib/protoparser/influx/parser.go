@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/common"
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/valyala/fastjson/fastfloat"
 )
@@ -215,6 +216,7 @@ func unmarshalRow(dst []Row, s string, tagsPool []Tag, fieldsPool []Field, noEsc
 		dst = dst[:len(dst)-1]
 		logger.Errorf("cannot unmarshal InfluxDB line %q: %s; skipping it", s, err)
 		invalidLines.Inc()
+		common.WriteDeadLetter("influx", s, err)
 	}
 	return dst, tagsPool, fieldsPool
 }
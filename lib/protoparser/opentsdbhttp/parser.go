@@ -5,6 +5,7 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/common"
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/valyala/fastjson"
 	"github.com/valyala/fastjson/fastfloat"
@@ -135,6 +136,7 @@ func unmarshalRows(dst []Row, av *fastjson.Value, tagsPool []Tag) ([]Row, []Tag)
 	default:
 		logger.Errorf("OpenTSDB JSON must be either object or array; got %s; body=%s", av.Type(), av)
 		invalidLines.Inc()
+		common.WriteDeadLetter("opentsdbhttp", av.String(), fmt.Errorf("OpenTSDB JSON must be either object or array; got %s", av.Type()))
 		return dst, tagsPool
 	}
 }
@@ -152,6 +154,7 @@ func unmarshalRow(dst []Row, o *fastjson.Value, tagsPool []Tag) ([]Row, []Tag) {
 		dst = dst[:len(dst)-1]
 		logger.Errorf("cannot unmarshal OpenTSDB object %s: %s", o, err)
 		invalidLines.Inc()
+		common.WriteDeadLetter("opentsdbhttp", o.String(), err)
 	}
 	return dst, tagsPool
 }
@@ -8,6 +8,7 @@ import (
 	"sync"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/common"
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/valyala/fastjson/fastfloat"
 )
@@ -16,6 +17,9 @@ import (
 type Rows struct {
 	Rows []Row
 
+	// Metadata contains metadata for metrics from `# TYPE`, `# HELP` and `# UNIT` lines.
+	Metadata []Metadata
+
 	tagsPool []Tag
 }
 
@@ -28,6 +32,11 @@ func (rs *Rows) Reset() {
 	}
 	rs.Rows = rs.Rows[:0]
 
+	for i := range rs.Metadata {
+		rs.Metadata[i] = Metadata{}
+	}
+	rs.Metadata = rs.Metadata[:0]
+
 	for i := range rs.tagsPool {
 		rs.tagsPool[i].reset()
 	}
@@ -54,7 +63,97 @@ func stdErrLogger(s string) {
 // s shouldn't be modified while rs is in use.
 func (rs *Rows) UnmarshalWithErrLogger(s string, errLogger func(s string)) {
 	noEscapes := strings.IndexByte(s, '\\') < 0
-	rs.Rows, rs.tagsPool = unmarshalRows(rs.Rows[:0], s, rs.tagsPool[:0], noEscapes, errLogger)
+	rs.Rows, rs.Metadata, rs.tagsPool = unmarshalRows(rs.Rows[:0], rs.Metadata[:0], s, rs.tagsPool[:0], noEscapes, errLogger)
+}
+
+// Metadata contains metadata for the metric.
+//
+// See https://github.com/OpenObservability/OpenMetrics/blob/main/specification/OpenMetrics.md#metricfamily
+type Metadata struct {
+	// Metric is the metric family name.
+	Metric string
+
+	// Type is the metric type from `# TYPE` line, e.g. counter, gauge, histogram, summary.
+	Type string
+
+	// Help is the metric description from `# HELP` line.
+	Help string
+
+	// Unit is the metric unit from `# UNIT` line, e.g. seconds or bytes.
+	Unit string
+}
+
+// appendMetadata appends metadata from the comment line s to mds.
+//
+// It returns false if s isn't a comment line.
+// Comment lines other than `# TYPE`, `# HELP` and `# UNIT` are skipped.
+func appendMetadata(mds []Metadata, s string) ([]Metadata, bool) {
+	if len(s) > 0 && s[len(s)-1] == '\r' {
+		s = s[:len(s)-1]
+	}
+	s = skipLeadingWhitespace(s)
+	if len(s) == 0 || s[0] != '#' {
+		return mds, false
+	}
+	s = skipLeadingWhitespace(s[1:])
+	n := nextWhitespace(s)
+	if n < 0 {
+		return mds, true
+	}
+	kind := s[:n]
+	if kind != "TYPE" && kind != "HELP" && kind != "UNIT" {
+		return mds, true
+	}
+	s = skipLeadingWhitespace(s[n+1:])
+	metric := s
+	value := ""
+	if n := nextWhitespace(s); n >= 0 {
+		metric = s[:n]
+		value = skipTrailingWhitespace(skipLeadingWhitespace(s[n+1:]))
+	}
+	if len(metric) == 0 {
+		return mds, true
+	}
+	if len(mds) == 0 || mds[len(mds)-1].Metric != metric {
+		mds = append(mds, Metadata{
+			Metric: metric,
+		})
+	}
+	md := &mds[len(mds)-1]
+	switch kind {
+	case "TYPE":
+		md.Type = value
+	case "HELP":
+		md.Help = unescapeHelp(value)
+	case "UNIT":
+		md.Unit = value
+	}
+	return mds, true
+}
+
+// unescapeHelp unescapes `\\` and `\n` sequences in HELP text.
+func unescapeHelp(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case '\\':
+				b = append(b, '\\')
+				i++
+				continue
+			case 'n':
+				b = append(b, '\n')
+				i++
+				continue
+			}
+		}
+		b = append(b, c)
+	}
+	return string(b)
 }
 
 // Row is a single Prometheus row.
@@ -63,6 +162,9 @@ type Row struct {
 	Tags      []Tag
 	Value     float64
 	Timestamp int64
+
+	// Exemplar is an optional exemplar for the row.
+	Exemplar Exemplar
 }
 
 func (r *Row) reset() {
@@ -70,14 +172,65 @@ func (r *Row) reset() {
 	r.Tags = nil
 	r.Value = 0
 	r.Timestamp = 0
+	r.Exemplar.reset()
 }
 
-func skipTrailingComment(s string) string {
-	n := strings.IndexByte(s, '#')
-	if n < 0 {
-		return s
+// Exemplar is an exemplar attached to Prometheus row.
+//
+// See https://github.com/OpenObservability/OpenMetrics/blob/main/specification/OpenMetrics.md#exemplars
+type Exemplar struct {
+	// Tags contains exemplar labels. Exemplars without labels are ignored.
+	Tags []Tag
+
+	Value float64
+
+	// Timestamp is the exemplar timestamp in milliseconds. It is zero if the timestamp is missing.
+	Timestamp int64
+}
+
+func (e *Exemplar) reset() {
+	e.Tags = nil
+	e.Value = 0
+	e.Timestamp = 0
+}
+
+// unmarshal unmarshals exemplar from s in the form `{labels} value [timestamp]`.
+func (e *Exemplar) unmarshal(s string, tagsPool []Tag, noEscapes bool) ([]Tag, error) {
+	e.reset()
+	s = skipLeadingWhitespace(s)
+	if len(s) == 0 || s[0] != '{' {
+		return tagsPool, fmt.Errorf("missing exemplar labels")
+	}
+	tagsStart := len(tagsPool)
+	var err error
+	s, tagsPool, err = unmarshalTags(tagsPool, s[1:], noEscapes)
+	if err != nil {
+		return tagsPool[:tagsStart], fmt.Errorf("cannot unmarshal exemplar labels: %w", err)
+	}
+	s = skipTrailingWhitespace(skipLeadingWhitespace(s))
+	value := s
+	timestamp := ""
+	if n := nextWhitespace(s); n >= 0 {
+		value = s[:n]
+		timestamp = skipLeadingWhitespace(s[n+1:])
+	}
+	v, err := fastfloat.Parse(value)
+	if err != nil {
+		return tagsPool[:tagsStart], fmt.Errorf("cannot parse exemplar value %q: %w", value, err)
 	}
-	return s[:n]
+	var ts float64
+	if len(timestamp) > 0 {
+		ts, err = fastfloat.Parse(timestamp)
+		if err != nil {
+			return tagsPool[:tagsStart], fmt.Errorf("cannot parse exemplar timestamp %q: %w", timestamp, err)
+		}
+	}
+	tags := tagsPool[tagsStart:]
+	e.Tags = tags[:len(tags):len(tags)]
+	e.Value = v
+	// Exemplar timestamps are always in seconds according to OpenMetrics spec.
+	e.Timestamp = int64(ts * 1000)
+	return tagsPool, nil
 }
 
 func skipLeadingWhitespace(s string) string {
@@ -114,6 +267,12 @@ func (r *Row) unmarshal(s string, tagsPool []Tag, noEscapes bool) ([]Tag, error)
 	r.reset()
 	s = skipLeadingWhitespace(s)
 	n := strings.IndexByte(s, '{')
+	if n >= 0 {
+		if m := nextWhitespace(s); m >= 0 && m < n && len(skipLeadingWhitespace(s[m:n])) > 0 {
+			// The '{' belongs to exemplar labels after the value, e.g. `foo 123 # {trace_id="abc"} 1`
+			n = -1
+		}
+	}
 	if n >= 0 {
 		// Tags found. Parse them.
 		r.Metric = skipTrailingWhitespace(s[:n])
@@ -143,7 +302,12 @@ func (r *Row) unmarshal(s string, tagsPool []Tag, noEscapes bool) ([]Tag, error)
 		return tagsPool, fmt.Errorf("metric cannot be empty")
 	}
 	s = skipLeadingWhitespace(s)
-	s = skipTrailingComment(s)
+	if n := strings.IndexByte(s, '#'); n >= 0 {
+		// Try parsing exemplar after the value. Invalid exemplars are silently ignored
+		// in the same way as other trailing comments.
+		tagsPool, _ = r.Exemplar.unmarshal(s[n+1:], tagsPool, noEscapes)
+		s = s[:n]
+	}
 	if len(s) == 0 {
 		return tagsPool, fmt.Errorf("value cannot be empty")
 	}
@@ -187,20 +351,26 @@ func (r *Row) unmarshal(s string, tagsPool []Tag, noEscapes bool) ([]Tag, error)
 
 var rowsReadScrape = metrics.NewCounter(`vm_protoparser_rows_read_total{type="promscrape"}`)
 
-func unmarshalRows(dst []Row, s string, tagsPool []Tag, noEscapes bool, errLogger func(s string)) ([]Row, []Tag) {
+func unmarshalRows(dst []Row, mds []Metadata, s string, tagsPool []Tag, noEscapes bool, errLogger func(s string)) ([]Row, []Metadata, []Tag) {
 	dstLen := len(dst)
 	for len(s) > 0 {
+		line := s
 		n := strings.IndexByte(s, '\n')
 		if n < 0 {
 			// The last line.
-			dst, tagsPool = unmarshalRow(dst, s, tagsPool, noEscapes, errLogger)
-			break
+			s = ""
+		} else {
+			line = s[:n]
+			s = s[n+1:]
 		}
-		dst, tagsPool = unmarshalRow(dst, s[:n], tagsPool, noEscapes, errLogger)
-		s = s[n+1:]
+		var ok bool
+		if mds, ok = appendMetadata(mds, line); ok {
+			continue
+		}
+		dst, tagsPool = unmarshalRow(dst, line, tagsPool, noEscapes, errLogger)
 	}
 	rowsReadScrape.Add(len(dst) - dstLen)
-	return dst, tagsPool
+	return dst, mds, tagsPool
 }
 
 func unmarshalRow(dst []Row, s string, tagsPool []Tag, noEscapes bool, errLogger func(s string)) ([]Row, []Tag) {
@@ -231,6 +401,7 @@ func unmarshalRow(dst []Row, s string, tagsPool []Tag, noEscapes bool, errLogger
 			errLogger(msg)
 		}
 		invalidLines.Inc()
+		common.WriteDeadLetter("prometheus", s, err)
 	}
 	return dst, tagsPool
 }
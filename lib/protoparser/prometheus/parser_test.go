@@ -1,9 +1,16 @@
 package prometheus
 
 import (
+	"encoding/json"
+	"flag"
 	"math"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/common"
 )
 
 func TestGetRowsDiff(t *testing.T) {
@@ -376,6 +383,16 @@ cassandra_token_ownership_ratio 78.9`, &Rows{
 					},
 				},
 				Value: 17,
+				Exemplar: Exemplar{
+					Tags: []Tag{
+						{
+							Key:   "trace_id",
+							Value: "oHg5SJ#YRHA0",
+						},
+					},
+					Value:     9.8,
+					Timestamp: 1520879607789,
+				},
 			},
 			{
 				Metric:    "abc",
@@ -389,6 +406,35 @@ cassandra_token_ownership_ratio 78.9`, &Rows{
 		},
 	})
 
+	// Exemplar without timestamp
+	f(`foo 12 # {trace_id="abc",span_id="x"} 3`, &Rows{
+		Rows: []Row{{
+			Metric: "foo",
+			Value:  12,
+			Exemplar: Exemplar{
+				Tags: []Tag{
+					{
+						Key:   "trace_id",
+						Value: "abc",
+					},
+					{
+						Key:   "span_id",
+						Value: "x",
+					},
+				},
+				Value: 3,
+			},
+		}},
+	})
+
+	// Invalid exemplar must be ignored
+	f(`foo 12 # {trace_id="abc"} bar`, &Rows{
+		Rows: []Row{{
+			Metric: "foo",
+			Value:  12,
+		}},
+	})
+
 	// "Infinity" word - this has been added in OpenMetrics.
 	// See https://github.com/OpenObservability/OpenMetrics/blob/master/OpenMetrics.md
 	// Checks for https://github.com/VictoriaMetrics/VictoriaMetrics/issues/924
@@ -568,3 +614,85 @@ cassandra_token_ownership_ratio 78.9`, &Rows{
 		},
 	})
 }
+
+func TestRowsUnmarshalDeadLetter(t *testing.T) {
+	dir := t.TempDir()
+	if err := flag.Set("deadLetter.dir", dir); err != nil {
+		t.Fatalf("cannot set -deadLetter.dir: %s", err)
+	}
+	defer func() {
+		_ = flag.Set("deadLetter.dir", "")
+	}()
+
+	var rows Rows
+	rows.Unmarshal("foo 1\nbar{baz=\"x\" 2\nqux 3\nfoobar abc\n")
+	if len(rows.Rows) != 2 {
+		t.Fatalf("unexpected number of parsed rows; got %d; want 2", len(rows.Rows))
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "deadletter.jsonl"))
+	if err != nil {
+		t.Fatalf("cannot read dead-letter file: %s", err)
+	}
+	var payloads []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var r common.DeadLetterRecord
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("cannot unmarshal dead-letter record %q: %s", line, err)
+		}
+		if r.Type != "prometheus" || r.Error == "" {
+			t.Fatalf("unexpected dead-letter record: %+v", r)
+		}
+		payloads = append(payloads, r.Payload)
+	}
+	payloadsExpected := []string{`bar{baz="x" 2`, `foobar abc`}
+	if !reflect.DeepEqual(payloads, payloadsExpected) {
+		t.Fatalf("unexpected dead-letter payloads;\ngot\n%q\nwant\n%q", payloads, payloadsExpected)
+	}
+}
+
+func TestRowsUnmarshalMetadata(t *testing.T) {
+	f := func(s string, mdsExpected []Metadata) {
+		t.Helper()
+		var rows Rows
+		rows.Unmarshal(s)
+		if !reflect.DeepEqual(rows.Metadata, mdsExpected) {
+			t.Fatalf("unexpected metadata;\ngot\n%+v\nwant\n%+v", rows.Metadata, mdsExpected)
+		}
+		// Try unmarshaling again
+		rows.Unmarshal(s)
+		if !reflect.DeepEqual(rows.Metadata, mdsExpected) {
+			t.Fatalf("unexpected metadata on second unmarshal;\ngot\n%+v\nwant\n%+v", rows.Metadata, mdsExpected)
+		}
+		rows.Reset()
+		if len(rows.Metadata) != 0 {
+			t.Fatalf("non-empty metadata after reset: %+v", rows.Metadata)
+		}
+	}
+
+	// No metadata
+	f("", nil)
+	f("foo 1\n# some comment\nbar 2", nil)
+
+	// OpenMetrics metadata with unit
+	f(`# TYPE http_request_duration_seconds histogram
+# UNIT http_request_duration_seconds seconds
+# HELP http_request_duration_seconds Duration of HTTP requests.
+http_request_duration_seconds_bucket{le="1"} 1
+# TYPE process_resident_memory_bytes gauge
+# UNIT process_resident_memory_bytes bytes
+process_resident_memory_bytes 123
+# EOF
+`, []Metadata{
+		{Metric: "http_request_duration_seconds", Type: "histogram", Help: "Duration of HTTP requests.", Unit: "seconds"},
+		{Metric: "process_resident_memory_bytes", Type: "gauge", Unit: "bytes"},
+	})
+
+	// Prometheus metadata with escaped help, whitespace and CRLF
+	f("  #  HELP foo Line\\\\1\\nline 2 \r\n# TYPE  foo\tcounter\r\nfoo 1", []Metadata{
+		{Metric: "foo", Type: "counter", Help: "Line\\1\nline 2"},
+	})
+
+	// Empty metadata value
+	f("# UNIT foo", []Metadata{{Metric: "foo"}})
+}
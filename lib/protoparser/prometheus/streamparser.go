@@ -19,6 +19,19 @@ import (
 //
 // callback shouldn't hold rows after returning.
 func ParseStream(r io.Reader, defaultTimestamp int64, isGzipped bool, callback func(rows []Row) error, errLogger func(string)) error {
+	return ParseStreamWithMetadata(r, defaultTimestamp, isGzipped, func(rows []Row, _ []Metadata) error {
+		return callback(rows)
+	}, errLogger)
+}
+
+// ParseStreamWithMetadata parses lines with Prometheus exposition format from r and calls callback for the parsed rows
+// and metrics metadata.
+//
+// The callback can be called concurrently multiple times for streamed data from r.
+// Metadata for the same metric may be split among multiple callback calls.
+//
+// callback shouldn't hold rows and mds after returning.
+func ParseStreamWithMetadata(r io.Reader, defaultTimestamp int64, isGzipped bool, callback func(rows []Row, mds []Metadata) error, errLogger func(string)) error {
 	if isGzipped {
 		zr, err := common.GetGzipReader(r)
 		if err != nil {
@@ -133,7 +146,7 @@ var streamContextPoolCh = make(chan *streamContext, cgroup.AvailableCPUs())
 type unmarshalWork struct {
 	rows             Rows
 	ctx              *streamContext
-	callback         func(rows []Row) error
+	callback         func(rows []Row, mds []Metadata) error
 	errLogger        func(string)
 	defaultTimestamp int64
 	reqBuf           []byte
@@ -148,9 +161,9 @@ func (uw *unmarshalWork) reset() {
 	uw.reqBuf = uw.reqBuf[:0]
 }
 
-func (uw *unmarshalWork) runCallback(rows []Row) {
+func (uw *unmarshalWork) runCallback(rows []Row, mds []Metadata) {
 	ctx := uw.ctx
-	if err := uw.callback(rows); err != nil {
+	if err := uw.callback(rows, mds); err != nil {
 		ctx.callbackErrLock.Lock()
 		if ctx.callbackErr == nil {
 			ctx.callbackErr = fmt.Errorf("error when processing imported data: %w", err)
@@ -182,7 +195,7 @@ func (uw *unmarshalWork) Unmarshal() {
 		}
 	}
 
-	uw.runCallback(rows)
+	uw.runCallback(rows, uw.rows.Metadata)
 	putUnmarshalWork(uw)
 }
 
@@ -0,0 +1,35 @@
+package promremotewrite
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+func TestParseStreamTooBigRequest(t *testing.T) {
+	origMaxInsertRequestSize := maxInsertRequestSize.N
+	maxInsertRequestSize.N = 1024
+	defer func() {
+		maxInsertRequestSize.N = origMaxInsertRequestSize
+	}()
+
+	data := bytes.Repeat([]byte("x"), 2048)
+	err := ParseStream(bytes.NewReader(data), func(tss []prompb.TimeSeries) error {
+		t.Fatalf("unexpected callback call for too big request")
+		return nil
+	})
+	if err == nil {
+		t.Fatalf("expecting non-nil error for too big request")
+	}
+	var esc *httpserver.ErrorWithStatusCode
+	if !errors.As(err, &esc) {
+		t.Fatalf("expecting httpserver.ErrorWithStatusCode error; got %T: %s", err, err)
+	}
+	if esc.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("unexpected status code; got %d; want %d", esc.StatusCode, http.StatusRequestEntityTooLarge)
+	}
+}
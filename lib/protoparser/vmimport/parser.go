@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/common"
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/valyala/fastjson"
 )
@@ -195,6 +196,7 @@ func unmarshalRow(dst []Row, s string, tu *tagsUnmarshaler) []Row {
 		dst = dst[:len(dst)-1]
 		logger.Errorf("cannot unmarshal json line %q: %s; skipping it", s, err)
 		invalidLines.Inc()
+		common.WriteDeadLetter("vmimport", s, err)
 	}
 	return dst
 }
@@ -1,9 +1,16 @@
 package vmimport
 
 import (
+	"encoding/json"
+	"flag"
 	"math"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/common"
 )
 
 func TestRowsUnmarshalFailure(t *testing.T) {
@@ -229,3 +236,45 @@ garbage here
 		},
 	})
 }
+
+func TestRowsUnmarshalDeadLetter(t *testing.T) {
+	dir := t.TempDir()
+	if err := flag.Set("deadLetter.dir", dir); err != nil {
+		t.Fatalf("cannot set -deadLetter.dir: %s", err)
+	}
+	defer func() {
+		_ = flag.Set("deadLetter.dir", "")
+	}()
+
+	var rows Rows
+	rows.Unmarshal(`{"metric":{"__name__":"foo"},"values":[1],"timestamps":[2]}
+{"metric":{"__name__":"bar"},"values":[1,2],"timestamps":[2]}
+{"metric":{"__name__":"baz"
+`)
+	if len(rows.Rows) != 1 {
+		t.Fatalf("unexpected number of parsed rows; got %d; want 1", len(rows.Rows))
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "deadletter.jsonl"))
+	if err != nil {
+		t.Fatalf("cannot read dead-letter file: %s", err)
+	}
+	var payloads []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var r common.DeadLetterRecord
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("cannot unmarshal dead-letter record %q: %s", line, err)
+		}
+		if r.Type != "vmimport" || r.Error == "" {
+			t.Fatalf("unexpected dead-letter record: %+v", r)
+		}
+		payloads = append(payloads, r.Payload)
+	}
+	payloadsExpected := []string{
+		`{"metric":{"__name__":"bar"},"values":[1,2],"timestamps":[2]}`,
+		`{"metric":{"__name__":"baz"`,
+	}
+	if !reflect.DeepEqual(payloads, payloadsExpected) {
+		t.Fatalf("unexpected dead-letter payloads;\ngot\n%q\nwant\n%q", payloads, payloadsExpected)
+	}
+}
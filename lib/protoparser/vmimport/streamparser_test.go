@@ -0,0 +1,170 @@
+package vmimport
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/common"
+)
+
+// jsonLinesReader generates JSON lines for /api/v1/import on the fly,
+// so the whole stream is never held in memory.
+//
+// Every Read call returns a random number of bytes in order to split lines at arbitrary boundaries.
+type jsonLinesReader struct {
+	linesCount int
+	linesRead  int
+	buf        []byte
+	rnd        *rand.Rand
+}
+
+func (r *jsonLinesReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.linesRead >= r.linesCount {
+			return 0, io.EOF
+		}
+		line := fmt.Sprintf(`{"metric":{"__name__":"foo","line":"%d"},"values":[%d,%d],"timestamps":[1000,2000]}`+"\n", r.linesRead, r.linesRead, r.linesRead+1)
+		r.buf = append(r.buf, line...)
+		r.linesRead++
+	}
+	n := 1 + r.rnd.Intn(4096)
+	if n > len(p) {
+		n = len(p)
+	}
+	n = copy(p[:n], r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func TestParseStreamLargeStream(t *testing.T) {
+	common.StartUnmarshalWorkers()
+	defer common.StopUnmarshalWorkers()
+
+	const linesCount = 500000
+	r := &jsonLinesReader{
+		linesCount: linesCount,
+		rnd:        rand.New(rand.NewSource(1)),
+	}
+
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	heapInuseStart := ms.HeapInuse
+
+	var lock sync.Mutex
+	seen := make([]bool, linesCount)
+	rowsCount := 0
+	maxRowsPerCallback := 0
+	maxHeapInuse := heapInuseStart
+	callbacks := 0
+	err := ParseStream(r, false, func(rows []Row) error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		callbacks++
+		if callbacks%100 == 0 {
+			var ms runtime.MemStats
+			runtime.ReadMemStats(&ms)
+			if ms.HeapInuse > maxHeapInuse {
+				maxHeapInuse = ms.HeapInuse
+			}
+		}
+		if len(rows) > maxRowsPerCallback {
+			maxRowsPerCallback = len(rows)
+		}
+		for i := range rows {
+			row := &rows[i]
+			if len(row.Tags) != 2 || string(row.Tags[1].Key) != "line" {
+				return fmt.Errorf("unexpected tags: %v", row.Tags)
+			}
+			var n int
+			if _, err := fmt.Sscanf(string(row.Tags[1].Value), "%d", &n); err != nil {
+				return fmt.Errorf("cannot parse line number from %q: %w", row.Tags[1].Value, err)
+			}
+			if n < 0 || n >= linesCount || seen[n] {
+				return fmt.Errorf("unexpected line number %d", n)
+			}
+			seen[n] = true
+			if len(row.Values) != 2 || row.Values[0] != float64(n) || row.Values[1] != float64(n+1) {
+				return fmt.Errorf("unexpected values for line %d: %v", n, row.Values)
+			}
+			rowsCount++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if rowsCount != linesCount {
+		t.Fatalf("unexpected number of rows; got %d; want %d", rowsCount, linesCount)
+	}
+
+	// The stream must be processed in small blocks.
+	if maxRowsPerCallback > 1000 {
+		t.Fatalf("too many rows passed to a single callback call: %d", maxRowsPerCallback)
+	}
+
+	// The memory usage must be bounded regardless of the stream size, which exceeds 40MB.
+	if d := int64(maxHeapInuse) - int64(heapInuseStart); d > 32*1024*1024 {
+		t.Fatalf("too big memory usage growth during the import: %d bytes", d)
+	}
+}
+
+func TestParseStreamPartialLines(t *testing.T) {
+	common.StartUnmarshalWorkers()
+	defer common.StopUnmarshalWorkers()
+
+	f := func(data string, rowsExpected int) {
+		t.Helper()
+		for seed := int64(0); seed < 10; seed++ {
+			r := &chunkedReader{
+				data: []byte(data),
+				rnd:  rand.New(rand.NewSource(seed)),
+			}
+			var lock sync.Mutex
+			rows := 0
+			err := ParseStream(r, false, func(rs []Row) error {
+				lock.Lock()
+				rows += len(rs)
+				lock.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if rows != rowsExpected {
+				t.Fatalf("unexpected number of rows for seed=%d; got %d; want %d", seed, rows, rowsExpected)
+			}
+		}
+	}
+
+	line := `{"metric":{"__name__":"foo","job":"bar"},"values":[1,2,3],"timestamps":[1,2,3]}`
+	f(line, 1)
+	f(line+"\n", 1)
+	f(line+"\n"+line, 2)
+	f(line+"\n\n"+line+"\n", 2)
+	f(line+"\r\n"+line+"\r\n", 2)
+}
+
+// chunkedReader returns data in chunks of random size.
+type chunkedReader struct {
+	data []byte
+	rnd  *rand.Rand
+}
+
+func (r *chunkedReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	n := 1 + r.rnd.Intn(16)
+	if n > len(p) {
+		n = len(p)
+	}
+	n = copy(p[:n], r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
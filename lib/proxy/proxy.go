@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"crypto/tls"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/url"
@@ -17,7 +19,7 @@ import (
 	"golang.org/x/net/proxy"
 )
 
-// URL implements YAML.Marshaler and yaml.Unmarshaler interfaces for url.URL.
+// URL implements YAML.Marshaler, yaml.Unmarshaler, json.Marshaler and json.Unmarshaler interfaces for url.URL.
 type URL struct {
 	URL *url.URL
 }
@@ -78,11 +80,13 @@ func (u *URL) GetAuthHeader(ac *promauth.Config) string {
 }
 
 // MarshalYAML implements yaml.Marshaler interface.
+//
+// The password from u is hidden, since it is a secret.
 func (u *URL) MarshalYAML() (interface{}, error) {
 	if u.URL == nil {
 		return nil, nil
 	}
-	return u.URL.String(), nil
+	return u.URL.Redacted(), nil
 }
 
 // UnmarshalYAML implements yaml.Unmarshaler interface.
@@ -91,14 +95,66 @@ func (u *URL) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if err := unmarshal(&s); err != nil {
 		return err
 	}
-	parsedURL, err := url.Parse(s)
+	parsedURL, err := parseURL(s)
 	if err != nil {
-		return fmt.Errorf("cannot parse proxy_url=%q as *url.URL: %w", s, err)
+		return err
+	}
+	u.URL = parsedURL
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler interface.
+//
+// The password isn't hidden, since the marshaled JSON is used for copying configs with proxy urls.
+func (u *URL) MarshalJSON() ([]byte, error) {
+	if u.URL == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(u.URL.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (u *URL) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsedURL, err := parseURL(s)
+	if err != nil {
+		return err
 	}
 	u.URL = parsedURL
 	return nil
 }
 
+func parseURL(s string) (*url.URL, error) {
+	pu, err := url.Parse(s)
+	if err != nil {
+		// Do not put s into the error message, since it may contain the password for proxy.
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			err = ue.Err
+		}
+		return nil, fmt.Errorf("cannot parse proxy_url=%q as *url.URL: %w", redactUserInfo(s), err)
+	}
+	return pu, nil
+}
+
+// redactUserInfo replaces user info in s with `xxxxx`.
+//
+// It is used for s, which cannot be parsed as url, so url.URL.Redacted cannot be used.
+func redactUserInfo(s string) string {
+	n := strings.LastIndexByte(s, '@')
+	if n < 0 {
+		return s
+	}
+	prefix := ""
+	if m := strings.Index(s[:n], "://"); m >= 0 {
+		prefix = s[:m+len("://")]
+	}
+	return prefix + "xxxxx" + s[n:]
+}
+
 // NewDialFunc returns dial func for the given u and ac.
 func (u *URL) NewDialFunc(ac *promauth.Config) (fasthttp.DialFunc, error) {
 	if u == nil || u.URL == nil {
@@ -0,0 +1,220 @@
+package querylint
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/VictoriaMetrics/metricsql"
+)
+
+// Warning is a warning for MetricsQL query returned by Lint.
+type Warning struct {
+	// Expr is the part of the query, which triggered the warning.
+	Expr string `json:"expr"`
+
+	// Message is human-readable description of the warning.
+	Message string `json:"message"`
+}
+
+// String returns string representation for w.
+func (w *Warning) String() string {
+	return fmt.Sprintf("%s: %s", w.Expr, w.Message)
+}
+
+// Lint parses MetricsQL query q and returns warnings for the known anti-patterns in it.
+//
+// An error is returned if q cannot be parsed.
+func Lint(q string) ([]Warning, error) {
+	e, err := metricsql.Parse(q)
+	if err != nil {
+		return nil, err
+	}
+	var ws []Warning
+	metricsql.VisitAll(e, func(expr metricsql.Expr) {
+		switch t := expr.(type) {
+		case *metricsql.MetricExpr:
+			ws = lintMetricExpr(ws, t)
+		case *metricsql.FuncExpr:
+			ws = lintFuncExpr(ws, t)
+		}
+	})
+	return ws, nil
+}
+
+func newWarning(e metricsql.Expr, format string, args ...interface{}) Warning {
+	return Warning{
+		Expr:    string(e.AppendString(nil)),
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// counterFuncs contains functions, which must be applied to counters.
+var counterFuncs = map[string]bool{
+	"increase":            true,
+	"increase_prometheus": true,
+	"increase_pure":       true,
+	"irate":               true,
+	"rate":                true,
+	"rollup_increase":     true,
+	"rollup_rate":         true,
+}
+
+// gaugeFuncs contains functions, which must be applied to gauges.
+var gaugeFuncs = map[string]bool{
+	"delta":            true,
+	"delta_prometheus": true,
+	"deriv":            true,
+	"deriv_fast":       true,
+	"idelta":           true,
+	"ideriv":           true,
+	"rollup_delta":     true,
+	"rollup_deriv":     true,
+	"predict_linear":   true,
+	"holt_winters":     true,
+}
+
+func lintFuncExpr(ws []Warning, fe *metricsql.FuncExpr) []Warning {
+	name := strings.ToLower(fe.Name)
+	switch {
+	case counterFuncs[name]:
+		arg := getRollupArg(fe)
+		if arg == nil {
+			return ws
+		}
+		if me := getMetricExpr(arg); me != nil {
+			if metricName := getMetricName(me); metricName != "" && !isCounterName(metricName) {
+				ws = append(ws, newWarning(fe, "%s() must be applied to counters, while %q doesn't look like a counter, since it has no _total, _count, _sum or _bucket suffix; "+
+					"use deriv() or delta() for gauges", name, metricName))
+			}
+		}
+		if isAggrArg(arg) {
+			ws = append(ws, newWarning(fe, "%s() is applied to the result of aggregate function, so counter resets cannot be detected properly; "+
+				"apply %s() before the aggregation, e.g. sum(%s(m[5m]))", name, name, name))
+		}
+		if isMissingWindow(arg) {
+			ws = append(ws, newWarning(fe, "%s() has no lookbehind window in square brackets, so the window is calculated automatically depending on the step; "+
+				"specify the window explicitly, e.g. %s(m[5m]), for predictable results", name, name))
+		}
+	case gaugeFuncs[name]:
+		arg := getRollupArg(fe)
+		if arg == nil {
+			return ws
+		}
+		if me := getMetricExpr(arg); me != nil {
+			if metricName := getMetricName(me); metricName != "" && isCounterName(metricName) {
+				ws = append(ws, newWarning(fe, "%s() must be applied to gauges, while %q looks like a counter; use rate() or increase() for counters", name, metricName))
+			}
+		}
+	case name == "histogram_quantile":
+		if len(fe.Args) != 2 {
+			return ws
+		}
+		if ae, ok := fe.Args[1].(*metricsql.AggrFuncExpr); ok && !keepsLabel(&ae.Modifier, "le") {
+			ws = append(ws, newWarning(fe, "histogram_quantile() arg is aggregated without `le` label, so the histogram buckets are lost; "+
+				"add `le` to `by (...)` clause, e.g. histogram_quantile(0.99, sum(rate(m_bucket[5m])) by (le))"))
+		}
+	}
+	return ws
+}
+
+func lintMetricExpr(ws []Warning, me *metricsql.MetricExpr) []Warning {
+	for _, lf := range me.LabelFilters {
+		if isRestrictiveFilter(&lf) {
+			return ws
+		}
+	}
+	return append(ws, newWarning(me, "the series selector has no filters limiting the number of matching series, "+
+		"so it may select huge number of time series; add metric name or label filters with specific values"))
+}
+
+// isRestrictiveFilter returns true if lf limits the number of matching series.
+func isRestrictiveFilter(lf *metricsql.LabelFilter) bool {
+	if lf.IsNegative {
+		return false
+	}
+	if !lf.IsRegexp {
+		return lf.Value != ""
+	}
+	switch lf.Value {
+	case "", ".*", ".+":
+		return false
+	default:
+		return true
+	}
+}
+
+// getRollupArg returns the arg of rollup function fe, which contains series for the rollup.
+func getRollupArg(fe *metricsql.FuncExpr) metricsql.Expr {
+	idx := metricsql.GetRollupArgIdx(fe)
+	if idx < 0 || idx >= len(fe.Args) {
+		return nil
+	}
+	return fe.Args[idx]
+}
+
+func getMetricExpr(arg metricsql.Expr) *metricsql.MetricExpr {
+	if re, ok := arg.(*metricsql.RollupExpr); ok {
+		arg = re.Expr
+	}
+	me, _ := arg.(*metricsql.MetricExpr)
+	return me
+}
+
+func getMetricName(me *metricsql.MetricExpr) string {
+	for _, lf := range me.LabelFilters {
+		if lf.Label == "__name__" && !lf.IsNegative && !lf.IsRegexp {
+			return lf.Value
+		}
+	}
+	return ""
+}
+
+func isAggrArg(arg metricsql.Expr) bool {
+	if re, ok := arg.(*metricsql.RollupExpr); ok {
+		arg = re.Expr
+	}
+	_, ok := arg.(*metricsql.AggrFuncExpr)
+	return ok
+}
+
+func isMissingWindow(arg metricsql.Expr) bool {
+	switch t := arg.(type) {
+	case *metricsql.MetricExpr:
+		return true
+	case *metricsql.RollupExpr:
+		_, ok := t.Expr.(*metricsql.MetricExpr)
+		return ok && t.Window == nil
+	default:
+		return false
+	}
+}
+
+func isCounterName(metricName string) bool {
+	for _, suffix := range []string{"_total", "_count", "_sum", "_bucket"} {
+		if strings.HasSuffix(metricName, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// keepsLabel returns true if the aggregate with the given modifier keeps the given label.
+func keepsLabel(me *metricsql.ModifierExpr, label string) bool {
+	switch strings.ToLower(me.Op) {
+	case "by":
+		return hasString(me.Args, label)
+	case "without":
+		return !hasString(me.Args, label)
+	default:
+		return false
+	}
+}
+
+func hasString(a []string, s string) bool {
+	for _, x := range a {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package querylint
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLintFailure(t *testing.T) {
+	f := func(q string) {
+		t.Helper()
+		ws, err := Lint(q)
+		if err == nil {
+			t.Fatalf("expecting non-nil error for Lint(%q)", q)
+		}
+		if ws != nil {
+			t.Fatalf("expecting nil warnings for Lint(%q); got %v", q, ws)
+		}
+	}
+	f("")
+	f("rate(foo[5m]")
+	f("sum(foo) by")
+}
+
+func TestLintSuccess(t *testing.T) {
+	f := func(q string, warningsExpected []string) {
+		t.Helper()
+		ws, err := Lint(q)
+		if err != nil {
+			t.Fatalf("unexpected error in Lint(%q): %s", q, err)
+		}
+		if len(ws) != len(warningsExpected) {
+			t.Fatalf("unexpected number of warnings for %q; got %d; want %d; warnings:\n%v", q, len(ws), len(warningsExpected), ws)
+		}
+		for i, w := range ws {
+			// Verify only the expression and the beginning of the message in order to keep the test readable.
+			s := w.String()
+			if !strings.HasPrefix(s, warningsExpected[i]) {
+				t.Fatalf("unexpected warning #%d for %q;\ngot\n%s\nwant prefix\n%s", i, q, s, warningsExpected[i])
+			}
+		}
+	}
+
+	// Good queries
+	f(`foo`, nil)
+	f(`rate(http_requests_total[5m])`, nil)
+	f(`sum(rate(http_requests_total{job="api"}[5m])) by (instance)`, nil)
+	f(`deriv(node_memory_free_bytes[10m])`, nil)
+	f(`histogram_quantile(0.99, sum(rate(http_request_duration_seconds_bucket[5m])) by (le, job))`, nil)
+	f(`histogram_quantile(0.99, sum(rate(http_request_duration_seconds_bucket[5m])) without (instance))`, nil)
+	f(`{job=~"api|db"}`, nil)
+	f(`1 + 2`, nil)
+
+	// rate() on a gauge
+	f(`rate(node_memory_free_bytes[5m])`, []string{
+		`rate(node_memory_free_bytes[5m]): rate() must be applied to counters, while "node_memory_free_bytes" doesn't look like a counter`,
+	})
+	f(`IRATE(temperature[1m])`, []string{
+		`IRATE(temperature[1m]): irate() must be applied to counters`,
+	})
+
+	// deriv() on a counter
+	f(`delta(http_requests_total[5m])`, []string{
+		`delta(http_requests_total[5m]): delta() must be applied to gauges, while "http_requests_total" looks like a counter`,
+	})
+
+	// missing [range]
+	f(`rate(http_requests_total)`, []string{
+		`rate(http_requests_total): rate() has no lookbehind window in square brackets`,
+	})
+	f(`increase(http_requests_total offset 1h)`, []string{
+		`increase(http_requests_total offset 1h): increase() has no lookbehind window in square brackets`,
+	})
+
+	// rate() over aggregate
+	f(`rate(sum(http_requests_total)[5m:])`, []string{
+		`rate(sum(http_requests_total)[5m:]): rate() is applied to the result of aggregate function`,
+	})
+
+	// histogram_quantile() without le
+	f(`histogram_quantile(0.9, sum(rate(http_request_duration_seconds_bucket[5m])) by (job))`, []string{
+		`histogram_quantile(0.9, sum(rate(http_request_duration_seconds_bucket[5m])) by (job)): histogram_quantile() arg is aggregated without ` + "`le`",
+	})
+	f(`histogram_quantile(0.9, sum(rate(http_request_duration_seconds_bucket[5m])) without (le))`, []string{
+		`histogram_quantile(0.9, sum(rate(http_request_duration_seconds_bucket[5m])) without (le)): histogram_quantile() arg is aggregated without ` + "`le`",
+	})
+
+	// huge cardinality selectors
+	f(`{__name__=~".*"}`, []string{
+		`{__name__=~".*"}: the series selector has no filters limiting the number of matching series`,
+	})
+	f(`count({job!="api"})`, []string{
+		`{job!="api"}: the series selector has no filters limiting the number of matching series`,
+	})
+	f(`{__name__=~".+", job=~".*"}`, []string{
+		`{__name__=~".+", job=~".*"}: the series selector has no filters limiting the number of matching series`,
+	})
+
+	// multiple warnings
+	f(`rate(foo) + deriv(bar_total[5m])`, []string{
+		`rate(foo): rate() must be applied to counters`,
+		`rate(foo): rate() has no lookbehind window in square brackets`,
+		`deriv(bar_total[5m]): deriv() must be applied to gauges`,
+	})
+}
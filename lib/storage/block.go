@@ -185,6 +185,13 @@ func (b *Block) rowsCount() int {
 
 // MarshalData marshals the block into binary representation.
 func (b *Block) MarshalData(timestampsBlockOffset, valuesBlockOffset uint64) ([]byte, []byte, []byte) {
+	return b.marshalDataWithCompressLevel(timestampsBlockOffset, valuesBlockOffset, 0)
+}
+
+// marshalDataWithCompressLevel works like MarshalData, but uses the given compressLevel for unmarshaled block data.
+//
+// The compression level is selected automatically if compressLevel <= 0.
+func (b *Block) marshalDataWithCompressLevel(timestampsBlockOffset, valuesBlockOffset uint64, compressLevel int) ([]byte, []byte, []byte) {
 	if len(b.values) == 0 {
 		// The data has been already marshaled.
 
@@ -225,12 +232,12 @@ func (b *Block) MarshalData(timestampsBlockOffset, valuesBlockOffset uint64) ([]
 		logger.Panicf("BUG: the number of values must match the number of timestamps; got %d vs %d", len(values), len(timestamps))
 	}
 
-	b.valuesData, b.bh.ValuesMarshalType, b.bh.FirstValue = encoding.MarshalValues(b.valuesData[:0], values, b.bh.PrecisionBits)
+	b.valuesData, b.bh.ValuesMarshalType, b.bh.FirstValue = encoding.MarshalValuesWithCompressLevel(b.valuesData[:0], values, b.bh.PrecisionBits, compressLevel)
 	b.bh.ValuesBlockOffset = valuesBlockOffset
 	b.bh.ValuesBlockSize = uint32(len(b.valuesData))
 	b.values = b.values[:0]
 
-	b.timestampsData, b.bh.TimestampsMarshalType, b.bh.MinTimestamp = encoding.MarshalTimestamps(b.timestampsData[:0], timestamps, b.bh.PrecisionBits)
+	b.timestampsData, b.bh.TimestampsMarshalType, b.bh.MinTimestamp = encoding.MarshalTimestampsWithCompressLevel(b.timestampsData[:0], timestamps, b.bh.PrecisionBits, compressLevel)
 	b.bh.TimestampsBlockOffset = timestampsBlockOffset
 	b.bh.TimestampsBlockSize = uint32(len(b.timestampsData))
 	b.bh.MaxTimestamp = timestamps[len(timestamps)-1]
@@ -19,6 +19,12 @@ type blockStreamWriter struct {
 	compressLevel int
 	path          string
 
+	// dataCompressLevel is the compression level for timestamps and values blocks.
+	//
+	// If it is positive, then all the written blocks are re-compressed with this level.
+	// Otherwise the compression level is selected automatically and the already compressed blocks are written as is.
+	dataCompressLevel int
+
 	// Use io.Writer type for timestampsWriter and valuesWriter
 	// in order to remove I2I conversion in WriteExternalBlock
 	// when passing them to fs.MustWriteData
@@ -57,6 +63,7 @@ func (bsw *blockStreamWriter) assertWriteClosers() {
 func (bsw *blockStreamWriter) reset() {
 	bsw.compressLevel = 0
 	bsw.path = ""
+	bsw.dataCompressLevel = 0
 
 	bsw.timestampsWriter = nil
 	bsw.valuesWriter = nil
@@ -187,7 +194,14 @@ func (bsw *blockStreamWriter) MustClose() {
 func (bsw *blockStreamWriter) WriteExternalBlock(b *Block, ph *partHeader, rowsMerged *uint64) {
 	atomic.AddUint64(rowsMerged, uint64(b.rowsCount()))
 	b.deduplicateSamplesDuringMerge()
-	headerData, timestampsData, valuesData := b.MarshalData(bsw.timestampsBlockOffset, bsw.valuesBlockOffset)
+	if bsw.dataCompressLevel > 0 && b.bh.PrecisionBits >= 64 {
+		// Unmarshal the block, so it is re-compressed with bsw.dataCompressLevel below.
+		// Blocks with lossy compression aren't re-compressed, since this may result in additional precision loss.
+		if err := b.UnmarshalData(); err != nil {
+			logger.Panicf("FATAL: cannot unmarshal block for re-compression with compressLevel=%d: %s", bsw.dataCompressLevel, err)
+		}
+	}
+	headerData, timestampsData, valuesData := b.marshalDataWithCompressLevel(bsw.timestampsBlockOffset, bsw.valuesBlockOffset, bsw.dataCompressLevel)
 	usePrevTimestamps := len(bsw.prevTimestampsData) > 0 && bytes.Equal(timestampsData, bsw.prevTimestampsData)
 	if usePrevTimestamps {
 		// The current timestamps block equals to the previous timestamps block.
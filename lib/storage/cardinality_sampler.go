@@ -0,0 +1,344 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	xxhash "github.com/cespare/xxhash/v2"
+)
+
+const (
+	// cardinalitySamplerWindow is the window for measuring the rate of new series in CardinalitySampler.
+	cardinalitySamplerWindow = time.Minute
+
+	// cardinalitySamplerMaxMetrics is the maximum number of metric names tracked by CardinalitySampler per window.
+	cardinalitySamplerMaxMetrics = 1000
+
+	// cardinalitySamplerMaxLabels is the maximum number of label names tracked by CardinalitySampler per metric name.
+	cardinalitySamplerMaxLabels = 100
+
+	// cardinalitySamplerMaxValues is the maximum number of unique label values tracked by CardinalitySampler per label.
+	cardinalitySamplerMaxValues = 10000
+
+	// cardinalitySamplerMaxTotalValues is the maximum number of unique label values tracked by CardinalitySampler
+	// across all the metric names and label names per window.
+	//
+	// This limits memory usage for the sampler, since the per-metric and per-label limits alone allow tracking
+	// cardinalitySamplerMaxMetrics*cardinalitySamplerMaxLabels*cardinalitySamplerMaxValues label values.
+	cardinalitySamplerMaxTotalValues = 200000
+
+	// cardinalitySamplerTopN is the number of the top metric names and label names in CardinalityReport.
+	cardinalitySamplerTopN = 10
+)
+
+// CardinalitySampler samples metric names and label names for new series when the rate of new series exceeds the configured threshold.
+//
+// This allows locating the source of cardinality spike without a full scan of the index.
+// Memory usage is bounded, since only a limited number of metric names, label names and label values is tracked.
+// The total number of tracked label values per window is limited by cardinalitySamplerMaxTotalValues.
+type CardinalitySampler struct {
+	// Atomically updated fields must go first in the struct, so they are properly aligned to 8 bytes on 32-bit architectures.
+
+	// newSeries is the number of new series in the current window.
+	newSeries int64
+
+	// windowStart is the start of the current window in unix nanoseconds.
+	windowStart int64
+
+	// triggeredAt is the time in unix nanoseconds when the threshold has been crossed in the current window.
+	triggeredAt int64
+
+	// metricsCount is the number of tracked metric names across all the shards in the current window.
+	metricsCount int64
+
+	// valuesCount is the number of tracked label values across all the shards in the current window.
+	valuesCount int64
+
+	// threshold is the number of new series per cardinalitySamplerWindow, after which new series are sampled.
+	threshold int
+
+	// mu serializes window rotations and protects last.
+	mu sync.Mutex
+
+	// last is the report for the last window, where the threshold has been crossed.
+	last *CardinalityReport
+
+	// shards contain samples for the current window.
+	//
+	// Metric names are spread among shards, so concurrent registration of new series doesn't contend on a single lock.
+	shards [cardinalitySamplerShards]cardinalitySamplerShard
+
+	// currentTime is used for obtaining the current time. It may be overridden in tests.
+	currentTime func() time.Time
+}
+
+// cardinalitySamplerShards is the number of shards in CardinalitySampler.
+const cardinalitySamplerShards = 16
+
+type cardinalitySamplerShard struct {
+	mu sync.Mutex
+
+	sampledSeries int
+
+	// metrics contains samples for metric names in the shard. It is nil until the threshold is crossed in the current window.
+	metrics map[string]*metricSample
+}
+
+// CardinalityReport contains the top metric names and label names for new series sampled by CardinalitySampler.
+type CardinalityReport struct {
+	// Threshold is the number of new series per minute, after which new series are sampled.
+	Threshold int `json:"threshold"`
+
+	// WindowStart is the start of the one-minute window in unix seconds.
+	WindowStart int64 `json:"windowStart"`
+
+	// TriggeredAt is the time in unix seconds when the threshold has been crossed in the window.
+	TriggeredAt int64 `json:"triggeredAt"`
+
+	// NewSeries is the number of new series in the window.
+	NewSeries int `json:"newSeries"`
+
+	// SampledSeries is the number of new series sampled after the threshold has been crossed.
+	SampledSeries int `json:"sampledSeries"`
+
+	// ValuesLimitReached is set if the limit on the total number of tracked label values has been reached in the window.
+	//
+	// UniqueValues in TopMetrics may be smaller than the real number of unique values in this case.
+	ValuesLimitReached bool `json:"valuesLimitReached"`
+
+	// TopMetrics contains metric names with the biggest number of sampled series.
+	TopMetrics []CardinalityReportMetric `json:"topMetrics"`
+}
+
+// CardinalityReportMetric contains stats for new series with the given metric name.
+type CardinalityReportMetric struct {
+	Name string `json:"name"`
+
+	// SampledSeries is the number of sampled series with the given metric name.
+	SampledSeries int `json:"sampledSeries"`
+
+	// TopLabels contains labels with the biggest number of unique values.
+	TopLabels []CardinalityReportLabel `json:"topLabels"`
+}
+
+// CardinalityReportLabel contains stats for the label in new series.
+type CardinalityReportLabel struct {
+	Name string `json:"name"`
+
+	// UniqueValues is the number of unique label values in sampled series.
+	//
+	// The number is capped, so it may be smaller than the real number of unique values.
+	UniqueValues int `json:"uniqueValues"`
+}
+
+type metricSample struct {
+	sampledSeries int
+
+	// labels contains hashes of unique values per each label name.
+	labels map[string]map[uint64]struct{}
+}
+
+// NewCardinalitySampler returns new CardinalitySampler, which starts sampling new series after threshold new series per minute.
+func NewCardinalitySampler(threshold int) *CardinalitySampler {
+	return &CardinalitySampler{
+		threshold:   threshold,
+		currentTime: time.Now,
+	}
+}
+
+// RegisterNewSeries registers the new series with the given mn in cs.
+func (cs *CardinalitySampler) RegisterNewSeries(mn *MetricName) {
+	now := cs.currentTime()
+	if now.UnixNano()-atomic.LoadInt64(&cs.windowStart) >= int64(cardinalitySamplerWindow) {
+		cs.rotateWindow(now)
+	}
+	n := atomic.AddInt64(&cs.newSeries, 1)
+	if n <= int64(cs.threshold) {
+		return
+	}
+	if n == int64(cs.threshold)+1 {
+		atomic.StoreInt64(&cs.triggeredAt, now.UnixNano())
+	}
+	shard := &cs.shards[xxhash.Sum64(mn.MetricGroup)%cardinalitySamplerShards]
+	shard.mu.Lock()
+	cs.addLocked(shard, mn)
+	shard.mu.Unlock()
+}
+
+// rotateWindow starts new window at now if the current window is over.
+//
+// The report for the current window is saved in cs.last if the threshold has been crossed in it.
+func (cs *CardinalitySampler) rotateWindow(now time.Time) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if now.UnixNano()-atomic.LoadInt64(&cs.windowStart) < int64(cardinalitySamplerWindow) {
+		// The window has been already rotated by concurrent goroutine.
+		return
+	}
+	if r := cs.getReportLocked(); r != nil {
+		cs.last = r
+	}
+	for i := range cs.shards {
+		shard := &cs.shards[i]
+		shard.mu.Lock()
+		shard.sampledSeries = 0
+		shard.metrics = nil
+		shard.mu.Unlock()
+	}
+	atomic.StoreInt64(&cs.newSeries, 0)
+	atomic.StoreInt64(&cs.triggeredAt, 0)
+	atomic.StoreInt64(&cs.metricsCount, 0)
+	atomic.StoreInt64(&cs.valuesCount, 0)
+	atomic.StoreInt64(&cs.windowStart, now.Truncate(cardinalitySamplerWindow).UnixNano())
+}
+
+// addLocked adds mn to the given shard.
+//
+// shard.mu must be locked by the caller.
+func (cs *CardinalitySampler) addLocked(shard *cardinalitySamplerShard, mn *MetricName) {
+	shard.sampledSeries++
+	if shard.metrics == nil {
+		shard.metrics = make(map[string]*metricSample)
+	}
+	ms := shard.metrics[string(mn.MetricGroup)]
+	if ms == nil {
+		if !tryIncLimitedCounter(&cs.metricsCount, cardinalitySamplerMaxMetrics) {
+			return
+		}
+		ms = &metricSample{
+			labels: make(map[string]map[uint64]struct{}),
+		}
+		shard.metrics[string(mn.MetricGroup)] = ms
+	}
+	ms.sampledSeries++
+	for i := range mn.Tags {
+		tag := &mn.Tags[i]
+		values := ms.labels[string(tag.Key)]
+		if values == nil {
+			if len(ms.labels) >= cardinalitySamplerMaxLabels {
+				continue
+			}
+			values = make(map[uint64]struct{})
+			ms.labels[string(tag.Key)] = values
+		}
+		if len(values) >= cardinalitySamplerMaxValues {
+			continue
+		}
+		h := xxhash.Sum64(tag.Value)
+		if _, ok := values[h]; ok {
+			continue
+		}
+		if !tryIncLimitedCounter(&cs.valuesCount, cardinalitySamplerMaxTotalValues) {
+			continue
+		}
+		values[h] = struct{}{}
+	}
+}
+
+// tryIncLimitedCounter atomically increments the counter at p if it doesn't exceed the limit after the increment.
+//
+// false is returned if the counter cannot be incremented because of the limit.
+func tryIncLimitedCounter(p *int64, limit int64) bool {
+	if atomic.AddInt64(p, 1) <= limit {
+		return true
+	}
+	atomic.AddInt64(p, -1)
+	return false
+}
+
+// GetReport returns the report for the current window if the threshold has been crossed in it.
+//
+// Otherwise the report for the last window, where the threshold has been crossed, is returned.
+// nil is returned if the threshold has been never crossed.
+func (cs *CardinalitySampler) GetReport() *CardinalityReport {
+	now := cs.currentTime()
+	if now.UnixNano()-atomic.LoadInt64(&cs.windowStart) >= int64(cardinalitySamplerWindow) {
+		cs.rotateWindow(now)
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if r := cs.getReportLocked(); r != nil {
+		return r
+	}
+	return cs.last
+}
+
+// getReportLocked returns the report for the current window.
+//
+// nil is returned if the threshold hasn't been crossed in the current window.
+// cs.mu must be locked by the caller.
+func (cs *CardinalitySampler) getReportLocked() *CardinalityReport {
+	newSeries := atomic.LoadInt64(&cs.newSeries)
+	if newSeries <= int64(cs.threshold) {
+		return nil
+	}
+	sampledSeries := 0
+	var topMetrics []CardinalityReportMetric
+	for i := range cs.shards {
+		shard := &cs.shards[i]
+		shard.mu.Lock()
+		sampledSeries += shard.sampledSeries
+		for name, ms := range shard.metrics {
+			topMetrics = append(topMetrics, ms.getReportMetric(name))
+		}
+		shard.mu.Unlock()
+	}
+	sort.Slice(topMetrics, func(i, j int) bool {
+		a, b := &topMetrics[i], &topMetrics[j]
+		if a.SampledSeries != b.SampledSeries {
+			return a.SampledSeries > b.SampledSeries
+		}
+		return a.Name < b.Name
+	})
+	if len(topMetrics) > cardinalitySamplerTopN {
+		topMetrics = topMetrics[:cardinalitySamplerTopN]
+	}
+	return &CardinalityReport{
+		Threshold:          cs.threshold,
+		WindowStart:        atomic.LoadInt64(&cs.windowStart) / 1e9,
+		TriggeredAt:        atomic.LoadInt64(&cs.triggeredAt) / 1e9,
+		NewSeries:          int(newSeries),
+		SampledSeries:      sampledSeries,
+		ValuesLimitReached: atomic.LoadInt64(&cs.valuesCount) >= cardinalitySamplerMaxTotalValues,
+		TopMetrics:         topMetrics,
+	}
+}
+
+func (ms *metricSample) getReportMetric(name string) CardinalityReportMetric {
+	topLabels := make([]CardinalityReportLabel, 0, len(ms.labels))
+	for labelName, values := range ms.labels {
+		topLabels = append(topLabels, CardinalityReportLabel{
+			Name:         labelName,
+			UniqueValues: len(values),
+		})
+	}
+	sort.Slice(topLabels, func(i, j int) bool {
+		a, b := &topLabels[i], &topLabels[j]
+		if a.UniqueValues != b.UniqueValues {
+			return a.UniqueValues > b.UniqueValues
+		}
+		return a.Name < b.Name
+	})
+	if len(topLabels) > cardinalitySamplerTopN {
+		topLabels = topLabels[:cardinalitySamplerTopN]
+	}
+	return CardinalityReportMetric{
+		Name:          name,
+		SampledSeries: ms.sampledSeries,
+		TopLabels:     topLabels,
+	}
+}
+
+// SetCardinalitySampler sets cs for sampling new series.
+//
+// This function must be called before any calling any storage functions.
+func SetCardinalitySampler(cs *CardinalitySampler) {
+	cardinalitySampler = cs
+}
+
+var cardinalitySampler *CardinalitySampler
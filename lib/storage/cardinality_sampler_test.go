@@ -0,0 +1,261 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCardinalitySamplerRegisterNewSeries(t *testing.T) {
+	cs := NewCardinalitySampler(100)
+	currentTime := time.Unix(1650000000, 0)
+	cs.currentTime = func() time.Time {
+		return currentTime
+	}
+	registerSeries := func(metricName, labelName string, labelValues int) {
+		t.Helper()
+		for i := 0; i < labelValues; i++ {
+			var mn MetricName
+			mn.MetricGroup = []byte(metricName)
+			mn.AddTag("job", "webservice")
+			mn.AddTag(labelName, fmt.Sprintf("value_%d", i))
+			cs.RegisterNewSeries(&mn)
+		}
+	}
+
+	// The report is missing while the number of new series doesn't exceed the threshold.
+	registerSeries("foo", "instance", 50)
+	registerSeries("bar", "instance", 50)
+	if r := cs.GetReport(); r != nil {
+		t.Fatalf("unexpected non-nil report before crossing the threshold: %+v", r)
+	}
+
+	// Spray high-cardinality series. The report must identify the culprit metric and label.
+	registerSeries("http_requests_total", "user_id", 5000)
+	registerSeries("foo", "instance", 20)
+	r := cs.GetReport()
+	if r == nil {
+		t.Fatalf("expecting non-nil report after crossing the threshold")
+	}
+	if r.NewSeries != 5120 {
+		t.Fatalf("unexpected number of new series; got %d; want %d", r.NewSeries, 5120)
+	}
+	if r.SampledSeries != 5020 {
+		t.Fatalf("unexpected number of sampled series; got %d; want %d", r.SampledSeries, 5020)
+	}
+	if len(r.TopMetrics) != 2 {
+		t.Fatalf("unexpected number of top metrics; got %d; want 2; report: %+v", len(r.TopMetrics), r)
+	}
+	m := &r.TopMetrics[0]
+	if m.Name != "http_requests_total" || m.SampledSeries != 5000 {
+		t.Fatalf("unexpected top metric; got %+v; want http_requests_total with 5000 series", m)
+	}
+	if len(m.TopLabels) != 2 {
+		t.Fatalf("unexpected number of top labels; got %d; want 2; labels: %+v", len(m.TopLabels), m.TopLabels)
+	}
+	if l := m.TopLabels[0]; l.Name != "user_id" || l.UniqueValues != 5000 {
+		t.Fatalf("unexpected top label; got %+v; want user_id with 5000 unique values", l)
+	}
+	if l := m.TopLabels[1]; l.Name != "job" || l.UniqueValues != 1 {
+		t.Fatalf("unexpected second label; got %+v; want job with 1 unique value", l)
+	}
+	if m := &r.TopMetrics[1]; m.Name != "foo" || m.SampledSeries != 20 {
+		t.Fatalf("unexpected second metric; got %+v; want foo with 20 series", m)
+	}
+
+	// The report for the last window with the crossed threshold must be returned after the window is over.
+	currentTime = currentTime.Add(cardinalitySamplerWindow)
+	registerSeries("baz", "instance", 10)
+	r = cs.GetReport()
+	if r == nil || r.TopMetrics[0].Name != "http_requests_total" {
+		t.Fatalf("unexpected report for the last window: %+v", r)
+	}
+
+	// The report must be updated when the threshold is crossed in the new window.
+	registerSeries("baz", "pod", 200)
+	r = cs.GetReport()
+	if r == nil || r.TopMetrics[0].Name != "baz" || r.TopMetrics[0].TopLabels[0].Name != "pod" {
+		t.Fatalf("unexpected report for the new window: %+v", r)
+	}
+}
+
+func TestCardinalitySamplerBoundedMemory(t *testing.T) {
+	cs := NewCardinalitySampler(0)
+	for i := 0; i < 2*cardinalitySamplerMaxMetrics; i++ {
+		var mn MetricName
+		mn.MetricGroup = []byte(fmt.Sprintf("metric_%d", i))
+		for j := 0; j < 2*cardinalitySamplerMaxLabels; j++ {
+			mn.AddTag(fmt.Sprintf("label_%d", j), "value")
+		}
+		cs.RegisterNewSeries(&mn)
+	}
+	for i := 0; i < 2*cardinalitySamplerMaxValues; i++ {
+		var mn MetricName
+		mn.MetricGroup = []byte("metric_0")
+		mn.AddTag("label_0", fmt.Sprintf("value_%d", i))
+		cs.RegisterNewSeries(&mn)
+	}
+	sampledMetrics := getSampledMetrics(cs)
+	if n := len(sampledMetrics); n != cardinalitySamplerMaxMetrics {
+		t.Fatalf("unexpected number of tracked metrics; got %d; want %d", n, cardinalitySamplerMaxMetrics)
+	}
+	ms := sampledMetrics["metric_0"]
+	if n := len(ms.labels); n != cardinalitySamplerMaxLabels {
+		t.Fatalf("unexpected number of tracked labels; got %d; want %d", n, cardinalitySamplerMaxLabels)
+	}
+	if n := len(ms.labels["label_0"]); n != cardinalitySamplerMaxValues {
+		t.Fatalf("unexpected number of tracked label values; got %d; want %d", n, cardinalitySamplerMaxValues)
+	}
+	r := cs.GetReport()
+	if len(r.TopMetrics) != cardinalitySamplerTopN {
+		t.Fatalf("unexpected number of top metrics; got %d; want %d", len(r.TopMetrics), cardinalitySamplerTopN)
+	}
+	if len(r.TopMetrics[0].TopLabels) != cardinalitySamplerTopN {
+		t.Fatalf("unexpected number of top labels; got %d; want %d", len(r.TopMetrics[0].TopLabels), cardinalitySamplerTopN)
+	}
+}
+
+func TestCardinalitySamplerMaxTotalValues(t *testing.T) {
+	cs := NewCardinalitySampler(0)
+	metricsCount := 2 * cardinalitySamplerMaxTotalValues / cardinalitySamplerMaxValues
+	for i := 0; i < metricsCount; i++ {
+		for j := 0; j < cardinalitySamplerMaxValues; j++ {
+			var mn MetricName
+			mn.MetricGroup = []byte(fmt.Sprintf("metric_%d", i))
+			mn.AddTag("id", fmt.Sprintf("value_%d", j))
+			cs.RegisterNewSeries(&mn)
+		}
+	}
+	valuesCount := 0
+	for _, ms := range getSampledMetrics(cs) {
+		for _, values := range ms.labels {
+			valuesCount += len(values)
+		}
+	}
+	if valuesCount != cardinalitySamplerMaxTotalValues {
+		t.Fatalf("unexpected total number of tracked label values; got %d; want %d", valuesCount, cardinalitySamplerMaxTotalValues)
+	}
+	r := cs.GetReport()
+	if !r.ValuesLimitReached {
+		t.Fatalf("expecting ValuesLimitReached in the report")
+	}
+	if r.SampledSeries != metricsCount*cardinalitySamplerMaxValues {
+		t.Fatalf("unexpected number of sampled series; got %d; want %d", r.SampledSeries, metricsCount*cardinalitySamplerMaxValues)
+	}
+}
+
+func TestCardinalitySamplerConcurrent(t *testing.T) {
+	cs := NewCardinalitySampler(1000)
+	currentTime := time.Unix(1650000000, 0)
+	cs.currentTime = func() time.Time {
+		return currentTime
+	}
+	const workers = 8
+	const seriesPerWorker = 10000
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(workerID int) {
+			defer wg.Done()
+			for j := 0; j < seriesPerWorker; j++ {
+				var mn MetricName
+				mn.MetricGroup = []byte(fmt.Sprintf("metric_%d", j%20))
+				mn.AddTag("worker", fmt.Sprintf("worker_%d", workerID))
+				mn.AddTag("id", fmt.Sprintf("id_%d", j))
+				cs.RegisterNewSeries(&mn)
+			}
+		}(i)
+	}
+	wg.Wait()
+	r := cs.GetReport()
+	if r == nil {
+		t.Fatalf("expecting non-nil report after crossing the threshold")
+	}
+	if r.NewSeries != workers*seriesPerWorker {
+		t.Fatalf("unexpected number of new series; got %d; want %d", r.NewSeries, workers*seriesPerWorker)
+	}
+	if r.SampledSeries != workers*seriesPerWorker-1000 {
+		t.Fatalf("unexpected number of sampled series; got %d; want %d", r.SampledSeries, workers*seriesPerWorker-1000)
+	}
+	if len(r.TopMetrics) != cardinalitySamplerTopN {
+		t.Fatalf("unexpected number of top metrics; got %d; want %d", len(r.TopMetrics), cardinalitySamplerTopN)
+	}
+	if l := r.TopMetrics[0].TopLabels[1]; l.Name != "worker" || l.UniqueValues != workers {
+		t.Fatalf("unexpected second label; got %+v; want worker with %d unique values", l, workers)
+	}
+}
+
+// getSampledMetrics returns samples for metric names from all the shards of cs.
+func getSampledMetrics(cs *CardinalitySampler) map[string]*metricSample {
+	m := make(map[string]*metricSample)
+	for i := range cs.shards {
+		for name, ms := range cs.shards[i].metrics {
+			m[name] = ms
+		}
+	}
+	return m
+}
+
+func TestStorageCardinalitySampler(t *testing.T) {
+	path := "TestStorageCardinalitySampler"
+	cs := NewCardinalitySampler(1000)
+	// Pin the current time, so new series aren't split among distinct windows.
+	currentTime := time.Now()
+	cs.currentTime = func() time.Time {
+		return currentTime
+	}
+	SetCardinalitySampler(cs)
+	defer SetCardinalitySampler(nil)
+	s, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer func() {
+		s.MustClose()
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+
+	timestamp := currentTime.UnixNano() / 1e6
+	addRows := func(metricName string, n int) {
+		t.Helper()
+		var mrs []MetricRow
+		for i := 0; i < n; i++ {
+			var mn MetricName
+			mn.MetricGroup = []byte(metricName)
+			mn.AddTag("job", "webservice")
+			mn.AddTag("session_id", fmt.Sprintf("session_%d", i))
+			mrs = append(mrs, MetricRow{
+				MetricNameRaw: mn.marshalRaw(nil),
+				Timestamp:     timestamp,
+				Value:         float64(i),
+			})
+		}
+		if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+			t.Fatalf("unexpected error when adding rows: %s", err)
+		}
+	}
+	addRows("process_cpu_seconds_total", 10)
+	addRows("app_sessions_active", 3000)
+
+	// Re-adding the existing series mustn't be counted as new series.
+	addRows("app_sessions_active", 3000)
+
+	r := cs.GetReport()
+	if r == nil {
+		t.Fatalf("expecting non-nil report after spraying high-cardinality series")
+	}
+	if r.NewSeries != 3010 {
+		t.Fatalf("unexpected number of new series; got %d; want %d", r.NewSeries, 3010)
+	}
+	m := &r.TopMetrics[0]
+	if m.Name != "app_sessions_active" {
+		t.Fatalf("unexpected top metric; got %q; want %q", m.Name, "app_sessions_active")
+	}
+	if l := m.TopLabels[0]; l.Name != "session_id" || l.UniqueValues != 2010 {
+		t.Fatalf("unexpected top label; got %+v; want session_id with 2010 unique values", l)
+	}
+}
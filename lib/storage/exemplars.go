@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Exemplar is an exemplar attached to a sample.
+//
+// See https://github.com/OpenObservability/OpenMetrics/blob/main/specification/OpenMetrics.md#exemplars
+type Exemplar struct {
+	// Tags contains exemplar labels such as trace_id.
+	Tags []Tag
+
+	// Value is the exemplar value.
+	Value float64
+
+	// Timestamp is the exemplar timestamp in milliseconds.
+	Timestamp int64
+}
+
+func (e *Exemplar) copyFrom(src *Exemplar) {
+	e.Tags = copyTags(e.Tags[:0], src.Tags)
+	e.Value = src.Value
+	e.Timestamp = src.Timestamp
+}
+
+func (e *Exemplar) equal(x *Exemplar) bool {
+	if e.Value != x.Value || e.Timestamp != x.Timestamp || len(e.Tags) != len(x.Tags) {
+		return false
+	}
+	for i := range e.Tags {
+		if !e.Tags[i].Equal(&x.Tags[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ExemplarRow is an exemplar for the series with the given MetricNameRaw.
+type ExemplarRow struct {
+	// MetricNameRaw contains raw metric name, which must be decoded
+	// with MetricName.UnmarshalRaw.
+	MetricNameRaw []byte
+
+	Exemplar Exemplar
+}
+
+// SeriesExemplars contains exemplars for a single series.
+type SeriesExemplars struct {
+	MetricName MetricName
+
+	// Exemplars are sorted by timestamp.
+	Exemplars []Exemplar
+}
+
+// ExemplarStorage is an in-memory storage for exemplars.
+//
+// It holds up to maxExemplars the most recently added exemplars in a circular buffer
+// in the same way as Prometheus does. Exemplars are lost on restart.
+type ExemplarStorage struct {
+	mu sync.Mutex
+
+	maxExemplars int
+
+	// entries is a circular buffer of exemplars.
+	entries []exemplarEntry
+
+	// next is the index of the next entry to overwrite in entries.
+	next int
+
+	// lastEntries maps series key to the index of the last added entry for the series in entries.
+	lastEntries map[string]int
+}
+
+type exemplarEntry struct {
+	seriesKey string
+	exemplar  Exemplar
+}
+
+// NewExemplarStorage returns new ExemplarStorage, which holds up to maxExemplars exemplars.
+func NewExemplarStorage(maxExemplars int) *ExemplarStorage {
+	if maxExemplars < 0 {
+		maxExemplars = 0
+	}
+	return &ExemplarStorage{
+		maxExemplars: maxExemplars,
+		lastEntries:  make(map[string]int),
+	}
+}
+
+// Len returns the number of exemplars in es.
+func (es *ExemplarStorage) Len() int {
+	es.mu.Lock()
+	n := len(es.entries)
+	es.mu.Unlock()
+	return n
+}
+
+// AddRows adds rows to es.
+//
+// Exemplars identical to the last exemplar for the same series are skipped, since they are usually
+// exposed multiple times by the scraped targets. Exemplars older than the last exemplar for the same series
+// are skipped too.
+func (es *ExemplarStorage) AddRows(rows []ExemplarRow) error {
+	if es.maxExemplars == 0 || len(rows) == 0 {
+		return nil
+	}
+	mn := GetMetricName()
+	defer PutMetricName(mn)
+	var keyBuf []byte
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	for i := range rows {
+		row := &rows[i]
+		if err := mn.UnmarshalRaw(row.MetricNameRaw); err != nil {
+			return fmt.Errorf("cannot unmarshal MetricNameRaw %q: %w", row.MetricNameRaw, err)
+		}
+		mn.sortTags()
+		keyBuf = mn.Marshal(keyBuf[:0])
+		es.addLocked(keyBuf, &row.Exemplar)
+	}
+	return nil
+}
+
+func (es *ExemplarStorage) addLocked(seriesKey []byte, e *Exemplar) {
+	idx, ok := es.lastEntries[string(seriesKey)]
+	if ok {
+		last := &es.entries[idx].exemplar
+		if e.Timestamp < last.Timestamp || last.equal(e) {
+			return
+		}
+	}
+	if len(es.entries) < es.maxExemplars {
+		es.entries = append(es.entries, exemplarEntry{})
+		idx = len(es.entries) - 1
+	} else {
+		idx = es.next
+		es.next++
+		if es.next >= len(es.entries) {
+			es.next = 0
+		}
+		oldKey := es.entries[idx].seriesKey
+		if lastIdx, ok := es.lastEntries[oldKey]; ok && lastIdx == idx {
+			delete(es.lastEntries, oldKey)
+		}
+	}
+	ee := &es.entries[idx]
+	ee.seriesKey = string(seriesKey)
+	ee.exemplar.copyFrom(e)
+	es.lastEntries[ee.seriesKey] = idx
+}
+
+// Search returns exemplars on the given tr for the series with the given mns.
+//
+// Series without exemplars on the given tr are skipped.
+func (es *ExemplarStorage) Search(mns []MetricName, tr TimeRange) []SeriesExemplars {
+	m := make(map[string]int, len(mns))
+	var keyBuf []byte
+	var mnCopy MetricName
+	for i := range mns {
+		mnCopy.CopyFrom(&mns[i])
+		mnCopy.sortTags()
+		keyBuf = mnCopy.Marshal(keyBuf[:0])
+		m[string(keyBuf)] = i
+	}
+	seriesExemplars := make([][]Exemplar, len(mns))
+	es.mu.Lock()
+	visit := func(entries []exemplarEntry) {
+		for i := range entries {
+			ee := &entries[i]
+			e := &ee.exemplar
+			if e.Timestamp < tr.MinTimestamp || e.Timestamp > tr.MaxTimestamp {
+				continue
+			}
+			idx, ok := m[ee.seriesKey]
+			if !ok {
+				continue
+			}
+			var eCopy Exemplar
+			eCopy.copyFrom(e)
+			seriesExemplars[idx] = append(seriesExemplars[idx], eCopy)
+		}
+	}
+	// Visit entries from the oldest to the newest.
+	visit(es.entries[es.next:])
+	visit(es.entries[:es.next])
+	es.mu.Unlock()
+
+	var result []SeriesExemplars
+	for i, exemplars := range seriesExemplars {
+		if len(exemplars) == 0 {
+			continue
+		}
+		sort.SliceStable(exemplars, func(i, j int) bool {
+			return exemplars[i].Timestamp < exemplars[j].Timestamp
+		})
+		result = append(result, SeriesExemplars{})
+		se := &result[len(result)-1]
+		se.MetricName.CopyFrom(&mns[i])
+		se.Exemplars = exemplars
+	}
+	return result
+}
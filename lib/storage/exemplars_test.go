@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExemplarStorage(t *testing.T) {
+	newMetricName := func(metricGroup, job string) MetricName {
+		var mn MetricName
+		mn.MetricGroup = []byte(metricGroup)
+		mn.AddTag("job", job)
+		return mn
+	}
+	newExemplar := func(traceID string, value float64, timestamp int64) Exemplar {
+		return Exemplar{
+			Tags: []Tag{{
+				Key:   []byte("trace_id"),
+				Value: []byte(traceID),
+			}},
+			Value:     value,
+			Timestamp: timestamp,
+		}
+	}
+	newRow := func(mn MetricName, e Exemplar) ExemplarRow {
+		return ExemplarRow{
+			MetricNameRaw: mn.marshalRaw(nil),
+			Exemplar:      e,
+		}
+	}
+
+	foo := newMetricName("foo", "a")
+	bar := newMetricName("bar", "a")
+	baz := newMetricName("baz", "b")
+
+	es := NewExemplarStorage(5)
+	rows := []ExemplarRow{
+		newRow(foo, newExemplar("t1", 1, 1000)),
+		newRow(bar, newExemplar("t2", 2, 1500)),
+		newRow(foo, newExemplar("t3", 3, 2000)),
+		// Duplicate exemplar must be skipped
+		newRow(foo, newExemplar("t3", 3, 2000)),
+		// Out of order exemplar must be skipped
+		newRow(foo, newExemplar("t4", 4, 500)),
+		newRow(foo, newExemplar("t5", 5, 3000)),
+	}
+	if err := es.AddRows(rows); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := es.Len(); n != 4 {
+		t.Fatalf("unexpected number of exemplars; got %d; want %d", n, 4)
+	}
+
+	f := func(mns []MetricName, tr TimeRange, resultExpected []SeriesExemplars) {
+		t.Helper()
+		result := es.Search(mns, tr)
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected result\ngot\n%v\nwant\n%v", result, resultExpected)
+		}
+	}
+
+	// All the exemplars for foo
+	f([]MetricName{foo}, TimeRange{MinTimestamp: 0, MaxTimestamp: 5000}, []SeriesExemplars{{
+		MetricName: foo,
+		Exemplars: []Exemplar{
+			newExemplar("t1", 1, 1000),
+			newExemplar("t3", 3, 2000),
+			newExemplar("t5", 5, 3000),
+		},
+	}})
+
+	// Time filtering
+	f([]MetricName{foo, bar}, TimeRange{MinTimestamp: 1200, MaxTimestamp: 2000}, []SeriesExemplars{
+		{
+			MetricName: foo,
+			Exemplars:  []Exemplar{newExemplar("t3", 3, 2000)},
+		},
+		{
+			MetricName: bar,
+			Exemplars:  []Exemplar{newExemplar("t2", 2, 1500)},
+		},
+	})
+
+	// Series without exemplars
+	f([]MetricName{baz}, TimeRange{MinTimestamp: 0, MaxTimestamp: 5000}, nil)
+
+	// The oldest exemplars must be evicted when the storage is full
+	rows = []ExemplarRow{
+		newRow(baz, newExemplar("t6", 6, 4000)),
+		newRow(baz, newExemplar("t7", 7, 5000)),
+		newRow(baz, newExemplar("t8", 8, 6000)),
+	}
+	if err := es.AddRows(rows); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := es.Len(); n != 5 {
+		t.Fatalf("unexpected number of exemplars; got %d; want %d", n, 5)
+	}
+	f([]MetricName{foo, bar, baz}, TimeRange{MinTimestamp: 0, MaxTimestamp: 10000}, []SeriesExemplars{
+		{
+			MetricName: foo,
+			Exemplars: []Exemplar{
+				newExemplar("t3", 3, 2000),
+				newExemplar("t5", 5, 3000),
+			},
+		},
+		{
+			MetricName: baz,
+			Exemplars: []Exemplar{
+				newExemplar("t6", 6, 4000),
+				newExemplar("t7", 7, 5000),
+				newExemplar("t8", 8, 6000),
+			},
+		},
+	})
+}
+
+func TestExemplarStorageDisabled(t *testing.T) {
+	es := NewExemplarStorage(0)
+	var mn MetricName
+	mn.MetricGroup = []byte("foo")
+	rows := []ExemplarRow{{
+		MetricNameRaw: mn.marshalRaw(nil),
+		Exemplar: Exemplar{
+			Value:     1,
+			Timestamp: 1000,
+		},
+	}}
+	if err := es.AddRows(rows); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := es.Len(); n != 0 {
+		t.Fatalf("unexpected number of exemplars; got %d; want 0", n)
+	}
+}
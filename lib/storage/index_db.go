@@ -584,6 +584,12 @@ func (db *indexDB) createTSIDByName(dst *TSID, metricName []byte) error {
 		if logNewSeries {
 			logger.Infof("new series created: %s", mn.String())
 		}
+		if cs := cardinalitySampler; cs != nil {
+			cs.RegisterNewSeries(mn)
+		}
+		if sal := seriesAuditLog; sal != nil {
+			sal.RegisterNewSeries(mn)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// lastValueCache holds the last searchable value per each series.
+//
+// It is used for serving instant queries for the current values without reading data blocks.
+// The cache is filled from in-memory parts after they become visible for search,
+// so the cached values match the values returned by the regular search.
+type lastValueCache struct {
+	// Atomic counters must go at the top of the structure in order to properly align by 8 bytes on 32-bit archs.
+	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/212 .
+	requests  uint64
+	misses    uint64
+	evictions uint64
+
+	shards []lastValueCacheShard
+}
+
+type lastValueCacheShard struct {
+	mu sync.Mutex
+
+	// m maps metricID to the last value for the series.
+	m map[uint64]lastValue
+
+	maxEntries int
+
+	// minTimestamp is the minimum timestamp for samples, which may add new entries to m.
+	//
+	// Older samples cannot be cached, since the storage may already contain newer samples
+	// for the same series, which have been ingested before the cache creation or which have been evicted from the shard.
+	minTimestamp int64
+}
+
+type lastValue struct {
+	timestamp int64
+	value     float64
+
+	// isAmbiguous is set if the storage contains samples with distinct values at the timestamp,
+	// so the search may return any of these values.
+	isAmbiguous bool
+}
+
+// lastValueEntry is the last value for the series with the given metricID.
+type lastValueEntry struct {
+	metricID uint64
+	lastValue
+}
+
+// lastValueCacheEvictionSamples is the number of entries to check when searching for the entry to evict.
+//
+// The entry with the oldest timestamp among these entries is evicted.
+const lastValueCacheEvictionSamples = 8
+
+// newLastValueCache returns new cache for up to maxEntries series split into shardsCount shards.
+func newLastValueCache(maxEntries, shardsCount int) *lastValueCache {
+	if shardsCount <= 0 {
+		shardsCount = 1
+	}
+	maxShardEntries := (maxEntries + shardsCount - 1) / shardsCount
+	minTimestamp := time.Now().UnixNano() / 1e6
+	shards := make([]lastValueCacheShard, shardsCount)
+	for i := range shards {
+		shard := &shards[i]
+		shard.m = make(map[uint64]lastValue)
+		shard.maxEntries = maxShardEntries
+		shard.minTimestamp = minTimestamp
+	}
+	return &lastValueCache{
+		shards: shards,
+	}
+}
+
+// getLastValueCacheShardsCount returns the number of shards for lastValueCache.
+//
+// The cache is sharded in order to reduce lock contention between concurrent searches and updates.
+func getLastValueCacheShardsCount() int {
+	return cgroup.AvailableCPUs() * 4
+}
+
+func (lvc *lastValueCache) getShard(metricID uint64) *lastValueCacheShard {
+	return &lvc.shards[metricID%uint64(len(lvc.shards))]
+}
+
+// update updates lvc with the given entries.
+//
+// The entries must be obtained via appendLastValueEntries from the part, which is already visible for search.
+func (lvc *lastValueCache) update(lves []lastValueEntry) {
+	for i := range lves {
+		lve := &lves[i]
+		shard := lvc.getShard(lve.metricID)
+		shard.mu.Lock()
+		if shard.updateLocked(lve) {
+			atomic.AddUint64(&lvc.evictions, 1)
+		}
+		shard.mu.Unlock()
+	}
+}
+
+// updateLocked updates shard with lve.
+//
+// It returns true if an entry has been evicted from the shard.
+func (shard *lastValueCacheShard) updateLocked(lve *lastValueEntry) bool {
+	lv, ok := shard.m[lve.metricID]
+	if !ok {
+		if lve.timestamp < shard.minTimestamp {
+			return false
+		}
+		evicted := false
+		if len(shard.m) >= shard.maxEntries {
+			shard.evictLocked()
+			evicted = true
+		}
+		shard.m[lve.metricID] = lve.lastValue
+		return evicted
+	}
+	if lve.timestamp < lv.timestamp {
+		return false
+	}
+	isAmbiguous := lve.isAmbiguous
+	if lve.timestamp == lv.timestamp {
+		// The storage may return any of the samples with duplicate timestamps.
+		isAmbiguous = isAmbiguous || lv.isAmbiguous || math.Float64bits(lve.value) != math.Float64bits(lv.value)
+	}
+	shard.m[lve.metricID] = lastValue{
+		timestamp:   lve.timestamp,
+		value:       lve.value,
+		isAmbiguous: isAmbiguous,
+	}
+	return false
+}
+
+// evictLocked evicts the entry with the oldest timestamp among a few entries from the shard.
+func (shard *lastValueCacheShard) evictLocked() {
+	var metricIDToEvict uint64
+	timestampToEvict := int64(math.MaxInt64)
+	n := 0
+	for metricID, lv := range shard.m {
+		if lv.timestamp < timestampToEvict {
+			metricIDToEvict = metricID
+			timestampToEvict = lv.timestamp
+		}
+		n++
+		if n >= lastValueCacheEvictionSamples {
+			break
+		}
+	}
+	if n == 0 {
+		return
+	}
+	delete(shard.m, metricIDToEvict)
+	// The storage contains samples with timestamps up to timestampToEvict for the evicted series,
+	// so older samples cannot add new entries to the shard after that.
+	if timestampToEvict >= shard.minTimestamp {
+		shard.minTimestamp = timestampToEvict + 1
+	}
+}
+
+// getValues appends the last values for the given tsids to dst and returns the result.
+//
+// false is returned if the last value for at least a single series from tsids isn't cached,
+// if it is outside [minTimestamp ... maxTimestamp] range or if it is ambiguous.
+func (lvc *lastValueCache) getValues(dst []lastValue, tsids []TSID, minTimestamp, maxTimestamp int64) ([]lastValue, bool) {
+	atomic.AddUint64(&lvc.requests, uint64(len(tsids)))
+
+	for i := range tsids {
+		metricID := tsids[i].MetricID
+		shard := lvc.getShard(metricID)
+		shard.mu.Lock()
+		lv, ok := shard.m[metricID]
+		shard.mu.Unlock()
+		if !ok || lv.isAmbiguous || lv.timestamp < minTimestamp || lv.timestamp > maxTimestamp {
+			atomic.AddUint64(&lvc.misses, uint64(len(tsids)-i))
+			return dst, false
+		}
+		dst = append(dst, lv)
+	}
+	return dst, true
+}
+
+// entriesCount returns the number of entries in lvc.
+func (lvc *lastValueCache) entriesCount() int {
+	n := 0
+	for i := range lvc.shards {
+		shard := &lvc.shards[i]
+		shard.mu.Lock()
+		n += len(shard.m)
+		shard.mu.Unlock()
+	}
+	return n
+}
+
+// appendLastValueEntries appends the last values per each series from mp to dst and returns the result.
+//
+// The values are read from mp in the same way as the search reads them,
+// so they account for the precision loss during data encoding.
+func appendLastValueEntries(dst []lastValueEntry, mp *inmemoryPart) []lastValueEntry {
+	bsr := getBlockStreamReader()
+	defer putBlockStreamReader(bsr)
+	bsr.InitFromInmemoryPart(mp)
+	var values []float64
+	for bsr.NextBlock() {
+		b := &bsr.Block
+		if err := b.UnmarshalData(); err != nil {
+			logger.Panicf("BUG: cannot unmarshal block from in-memory part: %s", err)
+		}
+		n := len(b.timestamps)
+		if n == 0 {
+			continue
+		}
+		values = decimal.AppendDecimalToFloat(values[:0], b.values[n-1:], b.bh.Scale)
+		lve := lastValueEntry{
+			metricID: b.bh.TSID.MetricID,
+			lastValue: lastValue{
+				timestamp: b.timestamps[n-1],
+				value:     values[0],
+			},
+		}
+		if n > 1 && b.timestamps[n-2] == lve.timestamp && b.values[n-2] != b.values[n-1] {
+			// The storage may return any of the samples with duplicate timestamps.
+			lve.isAmbiguous = true
+		}
+		if len(dst) > 0 && dst[len(dst)-1].metricID == lve.metricID {
+			// Blocks for the same series are sorted by timestamps.
+			prev := &dst[len(dst)-1]
+			if prev.timestamp == lve.timestamp && math.Float64bits(prev.value) != math.Float64bits(lve.value) {
+				lve.isAmbiguous = true
+			}
+			*prev = lve
+			continue
+		}
+		dst = append(dst, lve)
+	}
+	if err := bsr.Error(); err != nil {
+		logger.Panicf("BUG: cannot read blocks from in-memory part: %s", err)
+	}
+	return dst
+}
+
+// SetLastValueCacheSize sets the maximum number of series to keep in the cache for the last ingested values.
+//
+// The cache is disabled if maxEntries <= 0.
+//
+// This function must be called before OpenStorage.
+func SetLastValueCacheSize(maxEntries int) {
+	maxLastValueCacheSize = maxEntries
+}
+
+var maxLastValueCacheSize int
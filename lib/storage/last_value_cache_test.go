@@ -0,0 +1,361 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
+)
+
+func TestLastValueCache(t *testing.T) {
+	lvc := newLastValueCache(3, 1)
+	minTimestamp := lvc.shards[0].minTimestamp
+	newEntry := func(metricID uint64, timestamp int64, value float64) lastValueEntry {
+		return lastValueEntry{
+			metricID: metricID,
+			lastValue: lastValue{
+				timestamp: minTimestamp + timestamp,
+				value:     value,
+			},
+		}
+	}
+	f := func(metricID uint64, okExpected bool, timestampExpected int64, valueExpected float64) {
+		t.Helper()
+		lvs, ok := lvc.getValues(nil, []TSID{{MetricID: metricID}}, minTimestamp, minTimestamp+1000)
+		if ok != okExpected {
+			t.Fatalf("unexpected ok for metricID=%d; got %v; want %v", metricID, ok, okExpected)
+		}
+		if !ok {
+			return
+		}
+		lv := lvs[0]
+		if lv.timestamp != minTimestamp+timestampExpected {
+			t.Fatalf("unexpected timestamp for metricID=%d; got %d; want %d", metricID, lv.timestamp-minTimestamp, timestampExpected)
+		}
+		if math.Float64bits(lv.value) != math.Float64bits(valueExpected) {
+			t.Fatalf("unexpected value for metricID=%d; got %v; want %v", metricID, lv.value, valueExpected)
+		}
+	}
+
+	lvc.update([]lastValueEntry{
+		newEntry(1, 20, 2),
+		newEntry(2, 10, 3),
+	})
+	f(1, true, 20, 2)
+	f(2, true, 10, 3)
+	f(3, false, 0, 0)
+
+	// Newer samples replace the cached values, while out-of-order samples are ignored.
+	lvc.update([]lastValueEntry{
+		newEntry(1, 15, 4),
+		newEntry(2, 30, decimal.StaleNaN),
+	})
+	f(1, true, 20, 2)
+	f(2, true, 30, decimal.StaleNaN)
+
+	// Values outside the requested time range cannot be served from the cache.
+	lvc.update([]lastValueEntry{
+		newEntry(2, 2000, 5),
+	})
+	f(2, false, 0, 0)
+
+	// Samples with duplicate timestamps and distinct values are ambiguous until newer sample.
+	lvc.update([]lastValueEntry{
+		newEntry(1, 20, 6),
+	})
+	f(1, false, 0, 0)
+	lvc.update([]lastValueEntry{
+		newEntry(1, 40, 7),
+	})
+	f(1, true, 40, 7)
+
+	// Duplicate samples with the same value aren't ambiguous.
+	lvc.update([]lastValueEntry{
+		newEntry(1, 40, 7),
+	})
+	f(1, true, 40, 7)
+
+	// Ambiguous entries stay ambiguous until newer sample.
+	lve := newEntry(1, 50, 8)
+	lve.isAmbiguous = true
+	lvc.update([]lastValueEntry{lve})
+	f(1, false, 0, 0)
+	lvc.update([]lastValueEntry{
+		newEntry(1, 50, 8),
+	})
+	f(1, false, 0, 0)
+	lvc.update([]lastValueEntry{
+		newEntry(1, 60, 9),
+	})
+	f(1, true, 60, 9)
+
+	// Samples older than the cache creation cannot add new entries.
+	lvc.update([]lastValueEntry{
+		newEntry(3, -1, 10),
+	})
+	f(3, false, 0, 0)
+
+	// The entry with the oldest timestamp is evicted on overflow.
+	lvc.update([]lastValueEntry{
+		newEntry(3, 100, 11),
+		newEntry(4, 200, 12),
+	})
+	if n := lvc.entriesCount(); n != 3 {
+		t.Fatalf("unexpected number of entries after the eviction; got %d; want 3", n)
+	}
+	if lvc.evictions != 1 {
+		t.Fatalf("unexpected number of evictions; got %d; want 1", lvc.evictions)
+	}
+	f(1, false, 0, 0)
+	f(3, true, 100, 11)
+	f(4, true, 200, 12)
+
+	// Samples older than the evicted entry cannot add new entries after the eviction.
+	lvc.update([]lastValueEntry{
+		newEntry(1, 50, 13),
+	})
+	f(1, false, 0, 0)
+	if lvc.evictions != 1 {
+		t.Fatalf("unexpected number of evictions; got %d; want 1", lvc.evictions)
+	}
+
+	// Newer samples for cached series don't evict entries.
+	lvc.update([]lastValueEntry{
+		newEntry(3, 300, 14),
+	})
+	f(3, true, 300, 14)
+	if lvc.evictions != 1 {
+		t.Fatalf("unexpected number of evictions; got %d; want 1", lvc.evictions)
+	}
+}
+
+func TestLastValueCacheShards(t *testing.T) {
+	lvc := newLastValueCache(4, 2)
+	minTimestamp := lvc.shards[0].minTimestamp
+	var lves []lastValueEntry
+	for metricID := uint64(0); metricID < 6; metricID += 2 {
+		lves = append(lves, lastValueEntry{
+			metricID: metricID,
+			lastValue: lastValue{
+				timestamp: minTimestamp + int64(metricID),
+				value:     float64(metricID),
+			},
+		})
+	}
+	lvc.update(lves)
+
+	// All the entries go to the first shard, so it evicts the oldest entry.
+	if n := len(lvc.shards[0].m); n != 2 {
+		t.Fatalf("unexpected number of entries in the first shard; got %d; want 2", n)
+	}
+	if n := len(lvc.shards[1].m); n != 0 {
+		t.Fatalf("unexpected number of entries in the second shard; got %d; want 0", n)
+	}
+	if lvc.evictions != 1 {
+		t.Fatalf("unexpected number of evictions; got %d; want 1", lvc.evictions)
+	}
+	if _, ok := lvc.getValues(nil, []TSID{{MetricID: 0}}, minTimestamp, minTimestamp+1000); ok {
+		t.Fatalf("expecting missing entry for the evicted series")
+	}
+	lvs, ok := lvc.getValues(nil, []TSID{{MetricID: 2}, {MetricID: 4}}, minTimestamp, minTimestamp+1000)
+	if !ok {
+		t.Fatalf("expecting cached entries for non-evicted series")
+	}
+	if lvs[0].value != 2 || lvs[1].value != 4 {
+		t.Fatalf("unexpected values; got %v, %v; want 2, 4", lvs[0].value, lvs[1].value)
+	}
+
+	// The eviction in the first shard doesn't affect the second shard.
+	lvc.update([]lastValueEntry{{
+		metricID: 1,
+		lastValue: lastValue{
+			timestamp: minTimestamp,
+			value:     1,
+		},
+	}})
+	if _, ok := lvc.getValues(nil, []TSID{{MetricID: 1}}, minTimestamp, minTimestamp+1000); !ok {
+		t.Fatalf("expecting cached entry in the second shard")
+	}
+}
+
+func TestAppendLastValueEntries(t *testing.T) {
+	newRow := func(metricID uint64, timestamp int64, value float64) rawRow {
+		var r rawRow
+		r.TSID.MetricID = metricID
+		r.Timestamp = timestamp
+		r.Value = value
+		r.PrecisionBits = 64
+		return r
+	}
+	rows := []rawRow{
+		newRow(1, 10, 1),
+		newRow(1, 30, 2),
+		newRow(1, 20, 3),
+		newRow(2, 10, 4),
+		newRow(2, 10, 5),
+		newRow(3, 10, 6),
+		newRow(3, 10, 6),
+	}
+	var mp inmemoryPart
+	mp.InitFromRows(rows)
+	lves := appendLastValueEntries(nil, &mp)
+	lvesExpected := []lastValueEntry{
+		{
+			metricID: 1,
+			lastValue: lastValue{
+				timestamp: 30,
+				value:     2,
+			},
+		},
+		{
+			metricID: 2,
+			lastValue: lastValue{
+				timestamp:   10,
+				value:       lves[1].value,
+				isAmbiguous: true,
+			},
+		},
+		{
+			metricID: 3,
+			lastValue: lastValue{
+				timestamp: 10,
+				value:     6,
+			},
+		},
+	}
+	if !reflect.DeepEqual(lves, lvesExpected) {
+		t.Fatalf("unexpected entries\ngot\n%+v\nwant\n%+v", lves, lvesExpected)
+	}
+}
+
+func TestStorageSearchLastValues(t *testing.T) {
+	path := "TestStorageSearchLastValues"
+	SetLastValueCacheSize(1000)
+	defer SetLastValueCacheSize(0)
+	s, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer func() {
+		s.MustClose()
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+
+	timestamp := time.Now().UnixNano() / 1e6
+	addRows := func(metricName string, n int, timestamp int64, value float64) {
+		t.Helper()
+		var mrs []MetricRow
+		for i := 0; i < n; i++ {
+			var mn MetricName
+			mn.MetricGroup = []byte(metricName)
+			mn.AddTag("instance", fmt.Sprintf("host_%d", i))
+			mrs = append(mrs, MetricRow{
+				MetricNameRaw: mn.marshalRaw(nil),
+				Timestamp:     timestamp,
+				Value:         value,
+			})
+		}
+		if err := s.AddRows(mrs, 64); err != nil {
+			t.Fatalf("unexpected error when adding rows: %s", err)
+		}
+		s.DebugFlush()
+	}
+	tr := TimeRange{
+		MinTimestamp: timestamp - 3600*1000,
+		MaxTimestamp: timestamp + 3600*1000,
+	}
+	f := func(metricName string, okExpected bool, seriesExpected int, timestampExpected int64, valueExpected float64) {
+		t.Helper()
+		tfs := NewTagFilters()
+		if err := tfs.Add(nil, []byte(metricName), false, false); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+		lvs, ok, err := s.SearchLastValues(nil, []*TagFilters{tfs}, tr, timestamp-60*1000, 1e5, noDeadline)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if ok != okExpected {
+			t.Fatalf("unexpected ok; got %v; want %v", ok, okExpected)
+		}
+		if len(lvs) != seriesExpected {
+			t.Fatalf("unexpected number of series; got %d; want %d", len(lvs), seriesExpected)
+		}
+		for _, lv := range lvs {
+			if string(lv.MetricName.MetricGroup) != metricName {
+				t.Fatalf("unexpected metric name; got %q; want %q", lv.MetricName.MetricGroup, metricName)
+			}
+			if lv.Timestamp != timestampExpected {
+				t.Fatalf("unexpected timestamp; got %d; want %d", lv.Timestamp, timestampExpected)
+			}
+			if math.Float64bits(lv.Value) != math.Float64bits(valueExpected) {
+				t.Fatalf("unexpected value; got %v; want %v", lv.Value, valueExpected)
+			}
+		}
+	}
+
+	addRows("foo", 5, timestamp, 1)
+	f("foo", true, 5, timestamp, 1)
+	f("bar", true, 0, 0, 0)
+
+	// New writes must be reflected in the returned values.
+	addRows("foo", 5, timestamp+1000, 2)
+	f("foo", true, 5, timestamp+1000, 2)
+
+	// Staleness marks must be returned as is.
+	addRows("foo", 5, timestamp+2000, decimal.StaleNaN)
+	f("foo", true, 5, timestamp+2000, decimal.StaleNaN)
+
+	// The series with the last value outside the time range cannot be served from the cache.
+	addRows("foo", 6, timestamp+3600*1000+1, 3)
+	f("foo", false, 0, 0, 0)
+
+	// Values stored with reduced precision must match the values returned by the regular search.
+	var mn MetricName
+	mn.MetricGroup = []byte("bar")
+	var mrs []MetricRow
+	for i := 0; i < 10; i++ {
+		mrs = append(mrs, MetricRow{
+			MetricNameRaw: mn.marshalRaw(nil),
+			Timestamp:     timestamp - int64(9-i)*1000,
+			Value:         123.456 * float64(i*i+1),
+		})
+	}
+	if err := s.AddRows(mrs, 4); err != nil {
+		t.Fatalf("unexpected error when adding rows: %s", err)
+	}
+	s.DebugFlush()
+	tfs := NewTagFilters()
+	if err := tfs.Add(nil, []byte("bar"), false, false); err != nil {
+		t.Fatalf("cannot add tag filter: %s", err)
+	}
+	var sr Search
+	sr.Init(nil, s, []*TagFilters{tfs}, tr, 1e5, noDeadline)
+	var timestamps []int64
+	var values []float64
+	for sr.NextMetricBlock() {
+		var b Block
+		sr.MetricBlockRef.BlockRef.MustReadBlock(&b, true)
+		if err := b.UnmarshalData(); err != nil {
+			t.Fatalf("cannot unmarshal block: %s", err)
+		}
+		timestamps, values = b.AppendRowsWithTimeRangeFilter(timestamps, values, tr)
+	}
+	if err := sr.Error(); err != nil {
+		t.Fatalf("search error: %s", err)
+	}
+	sr.MustClose()
+	if len(values) != len(mrs) {
+		t.Fatalf("unexpected number of values found via the regular search; got %d; want %d", len(values), len(mrs))
+	}
+	n := len(values) - 1
+	if values[n] == mrs[n].Value {
+		t.Fatalf("expecting precision loss for the value stored with reduced precision")
+	}
+	f("bar", true, 1, timestamps[n], values[n])
+}
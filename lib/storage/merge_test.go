@@ -3,6 +3,7 @@ package storage
 import (
 	"errors"
 	"math/rand"
+	"reflect"
 	"testing"
 )
 
@@ -462,3 +463,55 @@ func testMergeBlockStreams(t *testing.T, bsrs []*blockStreamReader, expectedBloc
 		t.Fatalf("unexpected rows read from merged stream; got %d; want %d", rowsCount, expectedRowsCount)
 	}
 }
+
+func TestMergeBlockStreamsDataCompressLevel(t *testing.T) {
+	// Generate rows with daily-like seasonality and a bit of noise, which are typical for real-world metrics.
+	var rows []rawRow
+	var r rawRow
+	r.PrecisionBits = 64
+	for i := 0; i < 4*maxRowsPerBlock; i++ {
+		r.Timestamp = int64(i) * 15e3
+		r.Value = float64((i%288)*(288-i%288) + rand.Intn(16))
+		rows = append(rows, r)
+	}
+
+	f := func(dataCompressLevel int) (int, []int64) {
+		t.Helper()
+		var mp inmemoryPart
+		var bsw blockStreamWriter
+		bsw.InitFromInmemoryPart(&mp)
+		bsw.dataCompressLevel = dataCompressLevel
+		bsrs := []*blockStreamReader{newTestBlockStreamReader(t, rows)}
+		var rowsMerged, rowsDeleted uint64
+		if err := mergeBlockStreams(&mp.ph, &bsw, bsrs, nil, nil, 0, &rowsMerged, &rowsDeleted); err != nil {
+			t.Fatalf("unexpected error in mergeBlockStreams: %s", err)
+		}
+		if mp.ph.RowsCount != uint64(len(rows)) {
+			t.Fatalf("unexpected rows count for dataCompressLevel=%d; got %d; want %d", dataCompressLevel, mp.ph.RowsCount, len(rows))
+		}
+
+		var values []int64
+		var bsr blockStreamReader
+		bsr.InitFromInmemoryPart(&mp)
+		for bsr.NextBlock() {
+			if err := bsr.Block.UnmarshalData(); err != nil {
+				t.Fatalf("cannot unmarshal block for dataCompressLevel=%d: %s", dataCompressLevel, err)
+			}
+			values = append(values, bsr.Block.values...)
+		}
+		if err := bsr.Error(); err != nil {
+			t.Fatalf("unexpected error when reading merged stream for dataCompressLevel=%d: %s", dataCompressLevel, err)
+		}
+		size := len(mp.timestampsData.B) + len(mp.valuesData.B)
+		return size, values
+	}
+
+	sizeDefault, valuesDefault := f(0)
+	sizeHigh, valuesHigh := f(19)
+	if sizeHigh >= sizeDefault {
+		t.Fatalf("expecting smaller part for dataCompressLevel=19 than for the default compression level; got %d vs %d bytes", sizeHigh, sizeDefault)
+	}
+	if !reflect.DeepEqual(valuesHigh, valuesDefault) {
+		t.Fatalf("unexpected values after the merge with dataCompressLevel=19")
+	}
+}
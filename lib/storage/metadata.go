@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// MetricMetadata contains metadata for the metric family.
+//
+// See https://prometheus.io/docs/prometheus/latest/querying/api/#querying-metric-metadata
+type MetricMetadata struct {
+	// Metric is the metric family name.
+	Metric string
+
+	// Type is the metric type such as counter, gauge, histogram or summary.
+	Type string
+
+	// Help is the metric description.
+	Help string
+
+	// Unit is the metric unit such as seconds or bytes.
+	Unit string
+}
+
+// MetadataStorage is an in-memory storage for metrics metadata.
+//
+// It holds metadata for up to maxEntries metric families. Metadata for new metric families
+// is dropped when the limit is reached. Metadata is lost on restart.
+type MetadataStorage struct {
+	mu sync.Mutex
+
+	maxEntries int
+
+	m map[string]*MetricMetadata
+
+	droppedEntries uint64
+}
+
+// NewMetadataStorage returns new MetadataStorage, which holds metadata for up to maxEntries metric families.
+func NewMetadataStorage(maxEntries int) *MetadataStorage {
+	if maxEntries < 0 {
+		maxEntries = 0
+	}
+	return &MetadataStorage{
+		maxEntries: maxEntries,
+		m:          make(map[string]*MetricMetadata),
+	}
+}
+
+// Len returns the number of metric families with metadata in ms.
+func (ms *MetadataStorage) Len() int {
+	ms.mu.Lock()
+	n := len(ms.m)
+	ms.mu.Unlock()
+	return n
+}
+
+// DroppedEntries returns the number of metric families, which metadata was dropped because of the maxEntries limit.
+func (ms *MetadataStorage) DroppedEntries() uint64 {
+	ms.mu.Lock()
+	n := ms.droppedEntries
+	ms.mu.Unlock()
+	return n
+}
+
+var metadataDroppedTotal = metrics.GetOrCreateCounter(`vm_metrics_metadata_dropped_total`)
+
+// Add adds mds to ms.
+//
+// Empty fields in mds don't override the existing metadata for the same metric,
+// since TYPE, HELP and UNIT may be passed separately.
+// mds may refer to the original request buffer, so they are copied if needed.
+func (ms *MetadataStorage) Add(mds []MetricMetadata) {
+	if ms.maxEntries == 0 || len(mds) == 0 {
+		return
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for i := range mds {
+		md := &mds[i]
+		if md.Metric == "" {
+			continue
+		}
+		e := ms.m[md.Metric]
+		if e == nil {
+			if len(ms.m) >= ms.maxEntries {
+				ms.droppedEntries++
+				metadataDroppedTotal.Inc()
+				continue
+			}
+			e = &MetricMetadata{
+				Metric: cloneString(md.Metric),
+			}
+			ms.m[e.Metric] = e
+		}
+		if md.Type != "" && md.Type != e.Type {
+			e.Type = cloneString(md.Type)
+		}
+		if md.Help != "" && md.Help != e.Help {
+			e.Help = cloneString(md.Help)
+		}
+		if md.Unit != "" && md.Unit != e.Unit {
+			e.Unit = cloneString(md.Unit)
+		}
+	}
+}
+
+// Search returns metadata sorted by metric name.
+//
+// Only metadata for the given metric is returned if metric isn't empty.
+// Up to limit entries are returned if limit is positive.
+func (ms *MetadataStorage) Search(metric string, limit int) []MetricMetadata {
+	ms.mu.Lock()
+	var result []MetricMetadata
+	if metric != "" {
+		if e := ms.m[metric]; e != nil {
+			result = append(result, *e)
+		}
+	} else {
+		result = make([]MetricMetadata, 0, len(ms.m))
+		for _, e := range ms.m {
+			result = append(result, *e)
+		}
+	}
+	ms.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Metric < result[j].Metric
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+func cloneString(s string) string {
+	return string(append([]byte(nil), s...))
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMetadataStorage(t *testing.T) {
+	ms := NewMetadataStorage(2)
+	ms.Add([]MetricMetadata{
+		{Metric: "http_request_duration_seconds", Type: "histogram", Help: "Request duration", Unit: "seconds"},
+		{Metric: "foo", Type: "counter"},
+		// Empty fields must not override the existing metadata
+		{Metric: "http_request_duration_seconds", Help: "HTTP request duration"},
+		// Metadata for new metrics must be dropped when the limit is reached
+		{Metric: "bar", Type: "gauge"},
+		// Metadata without metric name must be ignored
+		{Type: "gauge"},
+	})
+	if n := ms.Len(); n != 2 {
+		t.Fatalf("unexpected number of entries; got %d; want %d", n, 2)
+	}
+	if n := ms.DroppedEntries(); n != 1 {
+		t.Fatalf("unexpected number of dropped entries; got %d; want %d", n, 1)
+	}
+	// Metadata for the existing metrics must be updated after the limit is reached
+	ms.Add([]MetricMetadata{{Metric: "foo", Unit: "bytes"}})
+
+	f := func(metric string, limit int, resultExpected []MetricMetadata) {
+		t.Helper()
+		result := ms.Search(metric, limit)
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected result\ngot\n%v\nwant\n%v", result, resultExpected)
+		}
+	}
+
+	all := []MetricMetadata{
+		{Metric: "foo", Type: "counter", Unit: "bytes"},
+		{Metric: "http_request_duration_seconds", Type: "histogram", Help: "HTTP request duration", Unit: "seconds"},
+	}
+	f("", 0, all)
+	f("", 1, all[:1])
+	f("http_request_duration_seconds", 0, all[1:])
+	f("bar", 0, nil)
+
+	// Disabled storage
+	ms = NewMetadataStorage(0)
+	ms.Add([]MetricMetadata{{Metric: "foo", Type: "counter"}})
+	if n := ms.Len(); n != 0 {
+		t.Fatalf("unexpected number of entries for disabled storage; got %d; want 0", n)
+	}
+}
@@ -130,6 +130,10 @@ type partition struct {
 	// Background merge is stopped in read-only mode.
 	isReadOnly *uint32
 
+	// lastValueCache is updated with the last values from newly added parts.
+	// It is nil if the cache is disabled.
+	lastValueCache *lastValueCache
+
 	// Name is the name of the partition in the form YYYY_MM.
 	name string
 
@@ -244,6 +248,22 @@ func (pt *partition) Drop() {
 
 // openPartition opens the existing partition from the given paths.
 func openPartition(smallPartsPath, bigPartsPath string, getDeletedMetricIDs func() *uint64set.Set, retentionMsecs int64, isReadOnly *uint32) (*partition, error) {
+	pt, err := openPartitionParts(smallPartsPath, bigPartsPath, getDeletedMetricIDs, retentionMsecs, isReadOnly)
+	if err != nil {
+		return nil, err
+	}
+	pt.startMergeWorkers()
+	pt.startRawRowsFlusher()
+	pt.startInmemoryPartsFlusher()
+	pt.startStalePartsRemover()
+
+	return pt, nil
+}
+
+// openPartitionParts opens partition parts from the given paths without starting background workers.
+//
+// Such a partition may be used only for searching, e.g. for cold partitions from tiered storage.
+func openPartitionParts(smallPartsPath, bigPartsPath string, getDeletedMetricIDs func() *uint64set.Set, retentionMsecs int64, isReadOnly *uint32) (*partition, error) {
 	smallPartsPath = filepath.Clean(smallPartsPath)
 	bigPartsPath = filepath.Clean(bigPartsPath)
 
@@ -273,11 +293,6 @@ func openPartition(smallPartsPath, bigPartsPath string, getDeletedMetricIDs func
 	if err := pt.tr.fromPartitionName(name); err != nil {
 		return nil, fmt.Errorf("cannot obtain partition time range from smallPartsPath %q: %w", smallPartsPath, err)
 	}
-	pt.startMergeWorkers()
-	pt.startRawRowsFlusher()
-	pt.startInmemoryPartsFlusher()
-	pt.startStalePartsRemover()
-
 	return pt, nil
 }
 
@@ -551,10 +566,22 @@ func (pt *partition) addRowsPart(rows []rawRow) {
 		refCount: 1,
 	}
 
+	var lves []lastValueEntry
+	lvc := pt.lastValueCache
+	if lvc != nil {
+		lves = appendLastValueEntries(nil, mp)
+	}
+
 	pt.partsLock.Lock()
 	pt.smallParts = append(pt.smallParts, pw)
 	ok := len(pt.smallParts) <= maxSmallPartsPerPartition
 	pt.partsLock.Unlock()
+
+	if lvc != nil {
+		// Update the cache only after the part becomes visible for search,
+		// so the cache never returns values, which cannot be found via the regular search.
+		lvc.update(lves)
+	}
 	if ok {
 		return
 	}
@@ -986,6 +1013,38 @@ func SetFinalMergeDelay(delay time.Duration) {
 	finalMergeDelaySeconds = uint64(delay.Seconds() + 1)
 }
 
+var (
+	bigMergeCompressLevel            = 0
+	bigMergeCompressLevelMinAgeMsecs = int64(0)
+)
+
+// SetBigMergeCompressLevel sets the compression level for timestamps and values blocks in parts created by big merges.
+//
+// The compressLevel is applied only to parts with all the samples older than minAge.
+// Higher compressLevel results in smaller parts at the cost of higher CPU usage during merges.
+// The compression level is selected automatically if compressLevel <= 0.
+//
+// This function may be called only before Storage initialization.
+func SetBigMergeCompressLevel(compressLevel int, minAge time.Duration) {
+	bigMergeCompressLevel = compressLevel
+	bigMergeCompressLevelMinAgeMsecs = minAge.Milliseconds()
+}
+
+// getDataCompressLevelForMerge returns the compression level for timestamps and values blocks in the part
+// with the given maxTimestamp created by the merge.
+//
+// Zero is returned if the compression level must be selected automatically.
+func getDataCompressLevelForMerge(isBigPart bool, maxTimestamp, currentTimestamp int64) int {
+	if !isBigPart || bigMergeCompressLevel <= 0 {
+		return 0
+	}
+	if maxTimestamp >= currentTimestamp-bigMergeCompressLevelMinAgeMsecs {
+		// The part contains too recent samples.
+		return 0
+	}
+	return bigMergeCompressLevel
+}
+
 func getMaxOutBytes(path string, workersCount int) uint64 {
 	n := fs.MustGetFreeSpace(path)
 	// Do not substract freeDiskSpaceLimitBytes from n before calculating the maxOutBytes,
@@ -1150,10 +1209,14 @@ func (pt *partition) mergeParts(pws []*partWrapper, stopCh <-chan struct{}) erro
 	outSize := uint64(0)
 	outRowsCount := uint64(0)
 	outBlocksCount := uint64(0)
+	outMaxTimestamp := int64(-1 << 63)
 	for _, pw := range pws {
 		outSize += pw.p.size
 		outRowsCount += pw.p.ph.RowsCount
 		outBlocksCount += pw.p.ph.BlocksCount
+		if pw.p.ph.MaxTimestamp > outMaxTimestamp {
+			outMaxTimestamp = pw.p.ph.MaxTimestamp
+		}
 	}
 	isBigPart := outSize > maxSmallPartSize()
 	nocache := isBigPart
@@ -1171,6 +1234,7 @@ func (pt *partition) mergeParts(pws []*partWrapper, stopCh <-chan struct{}) erro
 	if err := bsw.InitFromFilePart(tmpPartPath, nocache, compressLevel); err != nil {
 		return fmt.Errorf("cannot create destination part %q: %w", tmpPartPath, err)
 	}
+	bsw.dataCompressLevel = getDataCompressLevelForMerge(isBigPart, outMaxTimestamp, int64(fasttime.UnixTimestamp())*1000)
 
 	// Merge parts.
 	dmis := pt.getDeletedMetricIDs()
@@ -4,6 +4,7 @@ import (
 	"math/rand"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestPartitionGetMaxOutBytes(t *testing.T) {
@@ -13,6 +14,35 @@ func TestPartitionGetMaxOutBytes(t *testing.T) {
 	}
 }
 
+func TestGetDataCompressLevelForMerge(t *testing.T) {
+	f := func(compressLevel int, minAge time.Duration, isBigPart bool, maxTimestamp int64, resultExpected int) {
+		t.Helper()
+		SetBigMergeCompressLevel(compressLevel, minAge)
+		defer SetBigMergeCompressLevel(0, 0)
+		currentTimestamp := int64(10 * 24 * 3600 * 1000)
+		result := getDataCompressLevelForMerge(isBigPart, maxTimestamp, currentTimestamp)
+		if result != resultExpected {
+			t.Fatalf("unexpected compress level; got %d; want %d", result, resultExpected)
+		}
+	}
+	day := int64(24 * 3600 * 1000)
+
+	// The compress level isn't set
+	f(0, 0, true, day, 0)
+
+	// Small parts aren't re-compressed
+	f(10, 0, false, day, 0)
+
+	// No age limit
+	f(10, 0, true, 9*day, 10)
+
+	// The part is old enough
+	f(10, 7*24*time.Hour, true, 2*day, 10)
+
+	// The part contains too recent samples
+	f(10, 7*24*time.Hour, true, 5*day, 0)
+}
+
 func TestAppendPartsToMerge(t *testing.T) {
 	testAppendPartsToMerge(t, 2, []uint64{}, nil)
 	testAppendPartsToMerge(t, 2, []uint64{123}, nil)
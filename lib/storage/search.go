@@ -160,7 +160,7 @@ func (s *Search) Init(qt *querytracer.Tracer, storage *Storage, tfss []*TagFilte
 	// It is ok to call Init on error from storage.searchTSIDs.
 	// Init must be called before returning because it will fail
 	// on Seach.MustClose otherwise.
-	s.ts.Init(storage.tb, tsids, tr)
+	s.ts.Init(storage.tb, tsids, tr, deadline)
 	qt.Printf("search for parts with data for %d series", len(tsids))
 	if err != nil {
 		s.err = err
@@ -239,6 +239,12 @@ type SearchQuery struct {
 
 	// The maximum number of time series the search query can return.
 	MaxMetrics int
+
+	// EnforcedTagFilterss contains tag filters, which restrict the search query to the tenant of the request.
+	//
+	// They must be already joined with TagFilterss. They are used only for verifying that all the found
+	// time series belong to the tenant. They aren't marshaled.
+	EnforcedTagFilterss [][]TagFilter
 }
 
 // NewSearchQuery creates new search query for the given args.
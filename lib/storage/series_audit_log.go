@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// seriesAuditLogRateWindow is the window for limiting the rate of entries in SeriesAuditLog.
+const seriesAuditLogRateWindow = time.Second
+
+// SeriesAuditLog keeps label sets for newly registered series for audit consumers.
+//
+// Only series names are kept - sample values aren't kept. Memory usage is bounded, since the log is a ring buffer
+// with the limited number of entries. The rate of new entries is limited, so cardinality spikes cannot flush
+// the log in an instant. Entries above the rate limit are dropped and are counted in DroppedEntries.
+type SeriesAuditLog struct {
+	mu sync.Mutex
+
+	// entries is a ring buffer with the last entries. The entry with seq is stored at entries[seq%len(entries)].
+	entries []SeriesAuditEntry
+
+	// nextSeq is the sequence number for the next entry.
+	nextSeq uint64
+
+	// maxRate is the maximum number of entries per seriesAuditLogRateWindow.
+	maxRate     int
+	windowStart time.Time
+	windowCount int
+
+	dropped uint64
+
+	// notifyCh is closed when new entries are added to the log.
+	notifyCh chan struct{}
+
+	// currentTime is used for obtaining the current time. It may be overridden in tests.
+	currentTime func() time.Time
+}
+
+// SeriesAuditEntry is an entry in SeriesAuditLog for a newly registered series.
+type SeriesAuditEntry struct {
+	// Seq is the sequence number of the entry. It may be used for resuming reading the log after the entry.
+	Seq uint64 `json:"seq"`
+
+	// Timestamp is the time in milliseconds when the series has been registered.
+	Timestamp int64 `json:"timestamp"`
+
+	// Metric contains labels for the series. The metric name is stored in `__name__` label.
+	Metric map[string]string `json:"metric"`
+}
+
+// NewSeriesAuditLog returns new SeriesAuditLog, which keeps up to bufferSize last entries and accepts up to maxRate new entries per second.
+func NewSeriesAuditLog(bufferSize, maxRate int) *SeriesAuditLog {
+	return &SeriesAuditLog{
+		entries:     make([]SeriesAuditEntry, bufferSize),
+		maxRate:     maxRate,
+		notifyCh:    make(chan struct{}),
+		currentTime: time.Now,
+	}
+}
+
+// RegisterNewSeries adds the new series with the given mn to sal.
+func (sal *SeriesAuditLog) RegisterNewSeries(mn *MetricName) {
+	sal.mu.Lock()
+	defer sal.mu.Unlock()
+
+	now := sal.currentTime()
+	if now.Sub(sal.windowStart) >= seriesAuditLogRateWindow {
+		sal.windowStart = now.Truncate(seriesAuditLogRateWindow)
+		sal.windowCount = 0
+	}
+	if sal.windowCount >= sal.maxRate {
+		sal.dropped++
+		seriesAuditDroppedTotal.Inc()
+		return
+	}
+	sal.windowCount++
+
+	metric := make(map[string]string, len(mn.Tags)+1)
+	metric["__name__"] = string(mn.MetricGroup)
+	for i := range mn.Tags {
+		tag := &mn.Tags[i]
+		metric[string(tag.Key)] = string(tag.Value)
+	}
+	sal.entries[sal.nextSeq%uint64(len(sal.entries))] = SeriesAuditEntry{
+		Seq:       sal.nextSeq,
+		Timestamp: now.UnixNano() / 1e6,
+		Metric:    metric,
+	}
+	sal.nextSeq++
+	seriesAuditEntriesTotal.Inc()
+
+	// Notify consumers waiting for new entries.
+	close(sal.notifyCh)
+	sal.notifyCh = make(chan struct{})
+}
+
+// GetEntries appends entries with sequence numbers starting from since to dst and returns the result.
+//
+// Only the entries, which are still kept in the log, are returned. The sequence number for the next entry is returned
+// together with the channel, which is closed when new entries are added to the log after the call.
+// The returned sequence number may be passed to the next GetEntries call in order to get only new entries.
+//
+// If since exceeds the sequence number for the next entry (for example, after the restart), then the entries
+// are returned starting from the oldest entry kept in the log.
+func (sal *SeriesAuditLog) GetEntries(dst []SeriesAuditEntry, since uint64) ([]SeriesAuditEntry, uint64, <-chan struct{}) {
+	sal.mu.Lock()
+	defer sal.mu.Unlock()
+
+	var minSeq uint64
+	if n := uint64(len(sal.entries)); sal.nextSeq > n {
+		// The entries before sal.nextSeq-n have been already evicted from the log.
+		minSeq = sal.nextSeq - n
+	}
+	start := since
+	if start < minSeq || start > sal.nextSeq {
+		start = minSeq
+	}
+	for seq := start; seq < sal.nextSeq; seq++ {
+		dst = append(dst, sal.entries[seq%uint64(len(sal.entries))])
+	}
+	return dst, sal.nextSeq, sal.notifyCh
+}
+
+// Len returns the number of entries registered in sal since its creation.
+func (sal *SeriesAuditLog) Len() uint64 {
+	sal.mu.Lock()
+	n := sal.nextSeq
+	sal.mu.Unlock()
+	return n
+}
+
+// DroppedEntries returns the number of entries dropped because of the rate limit.
+func (sal *SeriesAuditLog) DroppedEntries() uint64 {
+	sal.mu.Lock()
+	n := sal.dropped
+	sal.mu.Unlock()
+	return n
+}
+
+// SetSeriesAuditLog sets sal for registering new series.
+//
+// This function must be called before any calling any storage functions.
+func SetSeriesAuditLog(sal *SeriesAuditLog) {
+	seriesAuditLog = sal
+}
+
+var seriesAuditLog *SeriesAuditLog
+
+var (
+	seriesAuditEntriesTotal = metrics.NewCounter(`vm_new_series_audit_entries_total`)
+	seriesAuditDroppedTotal = metrics.NewCounter(`vm_new_series_audit_dropped_total`)
+)
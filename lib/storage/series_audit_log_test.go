@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSeriesAuditLogRegisterNewSeries(t *testing.T) {
+	sal := NewSeriesAuditLog(3, 4)
+	currentTime := time.Unix(1650000000, 0)
+	sal.currentTime = func() time.Time {
+		return currentTime
+	}
+	registerSeries := func(metricName string, n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			var mn MetricName
+			mn.MetricGroup = []byte(metricName)
+			mn.AddTag("instance", fmt.Sprintf("host_%d", i))
+			sal.RegisterNewSeries(&mn)
+		}
+	}
+	f := func(since uint64, namesExpected []string, nextSeqExpected uint64) {
+		t.Helper()
+		entries, nextSeq, _ := sal.GetEntries(nil, since)
+		var names []string
+		for _, e := range entries {
+			names = append(names, fmt.Sprintf("%d:%s{instance=%q}", e.Seq, e.Metric["__name__"], e.Metric["instance"]))
+		}
+		if fmt.Sprintf("%q", names) != fmt.Sprintf("%q", namesExpected) {
+			t.Fatalf("unexpected entries; got %q; want %q", names, namesExpected)
+		}
+		if nextSeq != nextSeqExpected {
+			t.Fatalf("unexpected next seq; got %d; want %d", nextSeq, nextSeqExpected)
+		}
+	}
+
+	// Empty log
+	f(0, nil, 0)
+
+	registerSeries("foo", 2)
+	f(0, []string{`0:foo{instance="host_0"}`, `1:foo{instance="host_1"}`}, 2)
+	f(1, []string{`1:foo{instance="host_1"}`}, 2)
+	f(2, nil, 2)
+
+	// The oldest entries are evicted from the log when it is full.
+	_, _, notifyCh := sal.GetEntries(nil, 2)
+	registerSeries("bar", 2)
+	select {
+	case <-notifyCh:
+	default:
+		t.Fatalf("the notify channel must be closed after registering new series")
+	}
+	f(0, []string{`1:foo{instance="host_1"}`, `2:bar{instance="host_0"}`, `3:bar{instance="host_1"}`}, 4)
+	f(3, []string{`3:bar{instance="host_1"}`}, 4)
+
+	// The entries are returned from the oldest kept entry if since exceeds the next seq, e.g. after the restart.
+	f(100, []string{`1:foo{instance="host_1"}`, `2:bar{instance="host_0"}`, `3:bar{instance="host_1"}`}, 4)
+	f(4, nil, 4)
+
+	// Series above the rate limit are dropped.
+	registerSeries("baz", 3)
+	f(4, nil, 4)
+	if n := sal.DroppedEntries(); n != 3 {
+		t.Fatalf("unexpected number of dropped entries; got %d; want 3", n)
+	}
+
+	// The rate limit is reset in the next window.
+	currentTime = currentTime.Add(seriesAuditLogRateWindow)
+	registerSeries("baz", 1)
+	f(4, []string{`4:baz{instance="host_0"}`}, 5)
+	if n := sal.Len(); n != 5 {
+		t.Fatalf("unexpected number of registered entries; got %d; want 5", n)
+	}
+}
+
+func TestStorageSeriesAuditLog(t *testing.T) {
+	path := "TestStorageSeriesAuditLog"
+	sal := NewSeriesAuditLog(1000, 1000)
+	SetSeriesAuditLog(sal)
+	defer SetSeriesAuditLog(nil)
+	s, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer func() {
+		s.MustClose()
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+
+	timestamp := time.Now().UnixNano() / 1e6
+	addRows := func(metricName string, n int) {
+		t.Helper()
+		var mrs []MetricRow
+		for i := 0; i < n; i++ {
+			var mn MetricName
+			mn.MetricGroup = []byte(metricName)
+			mn.AddTag("job", "webservice")
+			mn.AddTag("instance", fmt.Sprintf("host_%d", i))
+			mrs = append(mrs, MetricRow{
+				MetricNameRaw: mn.marshalRaw(nil),
+				Timestamp:     timestamp,
+				Value:         float64(i),
+			})
+		}
+		if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+			t.Fatalf("unexpected error when adding rows: %s", err)
+		}
+	}
+	addRows("foo", 10)
+	addRows("bar", 5)
+
+	// Re-adding the existing series mustn't put them to the audit log again.
+	addRows("foo", 10)
+	addRows("bar", 5)
+
+	entries, nextSeq, _ := sal.GetEntries(nil, 0)
+	if nextSeq != 15 {
+		t.Fatalf("unexpected next seq; got %d; want 15", nextSeq)
+	}
+	seen := make(map[string]int)
+	for _, e := range entries {
+		if e.Metric["job"] != "webservice" {
+			t.Fatalf("unexpected job label in %+v", e)
+		}
+		seen[fmt.Sprintf("%s{instance=%q}", e.Metric["__name__"], e.Metric["instance"])]++
+	}
+	if len(seen) != 15 {
+		t.Fatalf("unexpected number of unique series in the audit log; got %d; want 15", len(seen))
+	}
+	for name, n := range seen {
+		if n != 1 {
+			t.Fatalf("series %s must appear in the audit log once; got %d times", name, n)
+		}
+	}
+}
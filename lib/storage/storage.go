@@ -86,6 +86,10 @@ type Storage struct {
 	// dateMetricIDCache is (Date, MetricID) cache.
 	dateMetricIDCache *dateMetricIDCache
 
+	// lastValueCache is MetricID -> the last searchable value cache.
+	// It is nil if the cache is disabled via SetLastValueCacheSize.
+	lastValueCache *lastValueCache
+
 	// Fast cache for MetricID values occurred during the current hour.
 	currHourMetricIDs atomic.Value
 
@@ -209,6 +213,9 @@ func OpenStorage(path string, retentionMsecs int64, maxHourlySeries, maxDailySer
 	s.metricIDCache = s.mustLoadCache("MetricID->TSID", "metricID_tsid", mem/16)
 	s.metricNameCache = s.mustLoadCache("MetricID->MetricName", "metricID_metricName", mem/10)
 	s.dateMetricIDCache = newDateMetricIDCache()
+	if maxLastValueCacheSize > 0 {
+		s.lastValueCache = newLastValueCache(maxLastValueCacheSize, getLastValueCacheShardsCount())
+	}
 
 	hour := fasttime.UnixHour()
 	hmCurr := s.mustLoadHourMetricIDs(hour, "curr_hour_metric_ids")
@@ -265,6 +272,9 @@ func OpenStorage(path string, retentionMsecs int64, maxHourlySeries, maxDailySer
 		return nil, fmt.Errorf("cannot open table at %q: %w", tablePath, err)
 	}
 	s.tb = tb
+	if s.lastValueCache != nil {
+		tb.setLastValueCache(s.lastValueCache)
+	}
 
 	s.startCurrHourMetricIDsUpdater()
 	s.startNextDayMetricIDsUpdater()
@@ -500,6 +510,11 @@ type Metrics struct {
 	DateMetricIDCacheSyncsCount  uint64
 	DateMetricIDCacheResetsCount uint64
 
+	LastValueCacheSize      uint64
+	LastValueCacheRequests  uint64
+	LastValueCacheMisses    uint64
+	LastValueCacheEvictions uint64
+
 	HourMetricIDCacheSize      uint64
 	HourMetricIDCacheSizeBytes uint64
 
@@ -581,6 +596,13 @@ func (s *Storage) UpdateMetrics(m *Metrics) {
 	m.DateMetricIDCacheSyncsCount += atomic.LoadUint64(&s.dateMetricIDCache.syncsCount)
 	m.DateMetricIDCacheResetsCount += atomic.LoadUint64(&s.dateMetricIDCache.resetsCount)
 
+	if lvc := s.lastValueCache; lvc != nil {
+		m.LastValueCacheSize += uint64(lvc.entriesCount())
+		m.LastValueCacheRequests += atomic.LoadUint64(&lvc.requests)
+		m.LastValueCacheMisses += atomic.LoadUint64(&lvc.misses)
+		m.LastValueCacheEvictions += atomic.LoadUint64(&lvc.evictions)
+	}
+
 	hmCurr := s.currHourMetricIDs.Load().(*hourMetricIDs)
 	hmPrev := s.prevHourMetricIDs.Load().(*hourMetricIDs)
 	hourMetricIDsLen := hmPrev.m.Len()
@@ -1102,6 +1124,76 @@ func (s *Storage) SearchMetricNames(qt *querytracer.Tracer, tfss []*TagFilters,
 	return mns, nil
 }
 
+// LastValue is the last ingested value for the series with MetricName.
+type LastValue struct {
+	MetricName MetricName
+	Timestamp  int64
+	Value      float64
+}
+
+// SearchLastValues returns the last searchable values for series matching tfss on tr.
+//
+// The values are returned from the cache for the last searchable values, which is enabled via SetLastValueCacheSize.
+// false is returned if the last value for at least a single matching series cannot be obtained from the cache,
+// e.g. if it is missing in the cache or if its timestamp is outside [minTimestamp ... tr.MaxTimestamp] range.
+// The caller must use the regular search in this case.
+//
+// The returned values may contain Prometheus staleness marks.
+func (s *Storage) SearchLastValues(qt *querytracer.Tracer, tfss []*TagFilters, tr TimeRange, minTimestamp int64, maxMetrics int, deadline uint64) ([]LastValue, bool, error) {
+	qt = qt.NewChild()
+	defer qt.Donef("search for the last values of matching series in the cache")
+	lvc := s.lastValueCache
+	if lvc == nil {
+		qt.Printf("the cache for the last values is disabled")
+		return nil, false, nil
+	}
+	tsids, err := s.searchTSIDs(qt, tfss, tr, maxMetrics, deadline)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(tsids) == 0 {
+		return nil, true, nil
+	}
+	lvs, ok := lvc.getValues(nil, tsids, minTimestamp, tr.MaxTimestamp)
+	if !ok {
+		qt.Printf("the last values for some of %d matching series are missing in the cache", len(tsids))
+		return nil, false, nil
+	}
+	if err = s.prefetchMetricNames(qt, tsids, deadline); err != nil {
+		return nil, false, err
+	}
+	idb := s.idb()
+	dst := make([]LastValue, 0, len(tsids))
+	var metricName []byte
+	for i := range tsids {
+		if i&paceLimiterSlowIterationsMask == 0 {
+			if err := checkSearchDeadlineAndPace(deadline); err != nil {
+				return nil, false, err
+			}
+		}
+		metricID := tsids[i].MetricID
+		var err error
+		metricName, err = idb.searchMetricNameWithCache(metricName[:0], metricID)
+		if err != nil {
+			if err == io.EOF {
+				// Skip missing metricName for metricID.
+				// It should be automatically fixed. See indexDB.searchMetricName for details.
+				continue
+			}
+			return nil, false, fmt.Errorf("error when searching metricName for metricID=%d: %w", metricID, err)
+		}
+		dst = dst[:len(dst)+1]
+		lv := &dst[len(dst)-1]
+		if err = lv.MetricName.Unmarshal(metricName); err != nil {
+			return nil, false, fmt.Errorf("cannot unmarshal metricName=%q: %w", metricName, err)
+		}
+		lv.Timestamp = lvs[i].timestamp
+		lv.Value = lvs[i].value
+	}
+	qt.Printf("found the last values for %d series in the cache", len(dst))
+	return dst, true, nil
+}
+
 // searchTSIDs returns sorted TSIDs for the given tfss and the given tr.
 func (s *Storage) searchTSIDs(qt *querytracer.Tracer, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) ([]TSID, error) {
 	qt = qt.NewChild()
@@ -1583,6 +1675,13 @@ func (s *Storage) ForceMergePartitions(partitionNamePrefix string) error {
 	return s.tb.ForceMergePartitions(partitionNamePrefix)
 }
 
+// ForceMergePartitionsOnTimeRange force-merges partitions in s, which overlap with the given tr.
+//
+// Partitions are merged sequentially in order to reduce load on the system.
+func (s *Storage) ForceMergePartitionsOnTimeRange(tr TimeRange) error {
+	return s.tb.ForceMergePartitionsOnTimeRange(tr)
+}
+
 var rowsAddedTotal uint64
 
 // AddRows adds the given mrs to s.
@@ -890,6 +890,83 @@ func TestStorageAddRowsSerial(t *testing.T) {
 	}
 }
 
+func TestStorageForceMergePartitionsOnTimeRange(t *testing.T) {
+	path := "TestStorageForceMergePartitionsOnTimeRange"
+	s, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+
+	// Add rows to two distinct per-month partitions. Flush them after every addition in order to create multiple parts per partition.
+	var trJan, trFeb TimeRange
+	trJan.fromPartitionTime(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	trFeb.fromPartitionTime(time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC))
+	const rowsPerAdd = 1e3
+	const addsCount = 5
+	for i := 0; i < addsCount; i++ {
+		for _, tr := range []TimeRange{trJan, trFeb} {
+			mrs := testGenerateMetricRows(rowsPerAdd, tr.MinTimestamp, tr.MaxTimestamp)
+			if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+				t.Fatalf("unexpected error when adding mrs: %s", err)
+			}
+		}
+		s.DebugFlush()
+	}
+
+	getPartsCount := func(partitionName string) int {
+		t.Helper()
+		ptws := s.tb.GetPartitions(nil)
+		defer s.tb.PutPartitions(ptws)
+		for _, ptw := range ptws {
+			if ptw.pt.name == partitionName {
+				pws := ptw.pt.GetParts(nil)
+				n := len(pws)
+				ptw.pt.PutParts(pws)
+				return n
+			}
+		}
+		t.Fatalf("cannot find partition %q", partitionName)
+		return 0
+	}
+
+	// Force merge only the partition for January.
+	tr := TimeRange{
+		MinTimestamp: trJan.MinTimestamp + 3600*1000,
+		MaxTimestamp: trJan.MinTimestamp + 2*3600*1000,
+	}
+	if err := s.ForceMergePartitionsOnTimeRange(tr); err != nil {
+		t.Fatalf("unexpected error when force merging partitions: %s", err)
+	}
+	if n := getPartsCount("2020_01"); n != 1 {
+		t.Fatalf("unexpected number of parts in the partition after the forced merge; got %d; want 1", n)
+	}
+
+	// Force merge the rest of partitions.
+	tr = TimeRange{
+		MinTimestamp: trJan.MinTimestamp,
+		MaxTimestamp: trFeb.MaxTimestamp,
+	}
+	if err := s.ForceMergePartitionsOnTimeRange(tr); err != nil {
+		t.Fatalf("unexpected error when force merging partitions: %s", err)
+	}
+	if n := getPartsCount("2020_02"); n != 1 {
+		t.Fatalf("unexpected number of parts in the partition after the forced merge; got %d; want 1", n)
+	}
+
+	// Verify that no rows are lost during the forced merge.
+	var m Metrics
+	s.UpdateMetrics(&m)
+	rowsCount := m.TableMetrics.SmallRowsCount + m.TableMetrics.BigRowsCount
+	if rowsExpected := uint64(2 * rowsPerAdd * addsCount); rowsCount != rowsExpected {
+		t.Fatalf("unexpected number of rows after the forced merge; got %d; want %d", rowsCount, rowsExpected)
+	}
+
+	s.MustClose()
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatalf("cannot remove %q: %s", path, err)
+	}
+}
+
 func TestStorageAddRowsConcurrent(t *testing.T) {
 	path := "TestStorageAddRowsConcurrent"
 	s, err := OpenStorage(path, 0, 1e5, 1e5)
@@ -28,6 +28,12 @@ type table struct {
 	ptws     []*partitionWrapper
 	ptwsLock sync.Mutex
 
+	// tiered is non-nil if tiered storage is enabled via Storage.EnableTieredStorage.
+	tiered *tieredStorage
+
+	// lastValueCache is non-nil if the cache for the last values is enabled via SetLastValueCacheSize.
+	lastValueCache *lastValueCache
+
 	flockF *os.File
 
 	stop chan struct{}
@@ -184,6 +190,18 @@ func (tb *table) MustDeleteSnapshot(snapshotName string) {
 	fs.MustRemoveAll(bigDir)
 }
 
+// setLastValueCache sets lvc as the cache for the last values from newly added parts.
+//
+// It must be called before adding rows to tb.
+func (tb *table) setLastValueCache(lvc *lastValueCache) {
+	tb.ptwsLock.Lock()
+	tb.lastValueCache = lvc
+	for _, ptw := range tb.ptws {
+		ptw.pt.lastValueCache = lvc
+	}
+	tb.ptwsLock.Unlock()
+}
+
 func (tb *table) addPartitionNolock(pt *partition) {
 	ptw := &partitionWrapper{
 		pt:       pt,
@@ -211,6 +229,10 @@ func (tb *table) MustClose() {
 		ptw.decRef()
 	}
 
+	if tb.tiered != nil {
+		tb.tiered.MustClose()
+	}
+
 	// Release exclusive lock on the table.
 	if err := tb.flockF.Close(); err != nil {
 		logger.Panicf("FATAL: cannot release lock on %q: %s", tb.flockF.Name(), err)
@@ -234,6 +256,11 @@ type TableMetrics struct {
 	partitionMetrics
 
 	PartitionsRefCount uint64
+
+	ColdPartitions              uint64
+	CachedColdPartitions        uint64
+	ColdPartitionDownloads      uint64
+	ColdPartitionDownloadErrors uint64
 }
 
 // UpdateMetrics updates m with metrics from tb.
@@ -244,16 +271,33 @@ func (tb *table) UpdateMetrics(m *TableMetrics) {
 		m.PartitionsRefCount += atomic.LoadUint64(&ptw.refCount)
 	}
 	tb.ptwsLock.Unlock()
+
+	if tb.tiered != nil {
+		tb.tiered.UpdateMetrics(m)
+	}
 }
 
 // ForceMergePartitions force-merges partitions in tb with names starting from the given partitionNamePrefix.
 //
 // Partitions are merged sequentially in order to reduce load on the system.
 func (tb *table) ForceMergePartitions(partitionNamePrefix string) error {
+	return tb.forceMergePartitions(func(pt *partition) bool {
+		return strings.HasPrefix(pt.name, partitionNamePrefix)
+	})
+}
+
+// ForceMergePartitionsOnTimeRange force-merges partitions in tb, which overlap with the given tr.
+func (tb *table) ForceMergePartitionsOnTimeRange(tr TimeRange) error {
+	return tb.forceMergePartitions(func(pt *partition) bool {
+		return pt.tr.overlapsWith(tr)
+	})
+}
+
+func (tb *table) forceMergePartitions(needMerge func(pt *partition) bool) error {
 	ptws := tb.GetPartitions(nil)
 	defer tb.PutPartitions(ptws)
 	for _, ptw := range ptws {
-		if !strings.HasPrefix(ptw.pt.name, partitionNamePrefix) {
+		if !needMerge(ptw.pt) {
 			continue
 		}
 		logger.Infof("starting forced merge for partition %q", ptw.pt.name)
@@ -367,6 +411,7 @@ func (tb *table) AddRows(rows []rawRow) error {
 			tb.ptwsLock.Unlock()
 			return fmt.Errorf("errors while adding rows to table %q: %w", tb.path, err)
 		}
+		pt.lastValueCache = tb.lastValueCache
 		pt.AddRows(missingRows[i : i+1])
 		tb.addPartitionNolock(pt)
 	}
@@ -57,8 +57,10 @@ func (ts *tableSearch) reset() {
 // tsids must be sorted.
 // tsids cannot be modified after the Init call, since it is owned by ts.
 //
+// deadline is used for downloading cold partitions from tiered storage.
+//
 // MustClose must be called then the tableSearch is done.
-func (ts *tableSearch) Init(tb *table, tsids []TSID, tr TimeRange) {
+func (ts *tableSearch) Init(tb *table, tsids []TSID, tr TimeRange, deadline uint64) {
 	if ts.needClosing {
 		logger.Panicf("BUG: missing MustClose call before the next call to Init")
 	}
@@ -82,6 +84,14 @@ func (ts *tableSearch) Init(tb *table, tsids []TSID, tr TimeRange) {
 	}
 
 	ts.ptws = tb.GetPartitions(ts.ptws[:0])
+	if tb.tiered != nil {
+		ptws, err := tb.tiered.appendPartitions(ts.ptws, tr, deadline)
+		ts.ptws = ptws
+		if err != nil {
+			ts.err = fmt.Errorf("cannot obtain cold partitions from tiered storage: %w", err)
+			return
+		}
+	}
 
 	// Initialize the ptsPool.
 	if n := len(ts.ptws) - cap(ts.ptsPool); n > 0 {
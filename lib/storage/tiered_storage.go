@@ -0,0 +1,394 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timerpool"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/uint64set"
+)
+
+// ObjectStorage is an object storage with cold partitions, which can be queried via tiered storage.
+//
+// See Storage.EnableTieredStorage for details.
+type ObjectStorage interface {
+	// ListPartitions must return names in the form YYYY_MM for all the partitions stored in the object storage.
+	ListPartitions() ([]string, error)
+
+	// DownloadPartition must download small and big parts for the partition with the given name
+	// to the given smallPartsPath and bigPartsPath directories.
+	//
+	// Directories may be missing at the time of the call.
+	DownloadPartition(name, smallPartsPath, bigPartsPath string) error
+
+	// String must return human-readable description for the object storage.
+	String() string
+}
+
+// tieredStorage provides access to cold partitions, which are stored in object storage.
+//
+// Cold partitions are downloaded to local cache on the first access and are kept there
+// until they are evicted by more recently accessed partitions.
+type tieredStorage struct {
+	// Atomic counters must be at the top of struct for proper 8-byte alignment on 32-bit archs.
+	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/212
+
+	downloads      uint64
+	downloadErrors uint64
+
+	ots                 ObjectStorage
+	cachePath           string
+	maxCachedPartitions int
+
+	getDeletedMetricIDs func() *uint64set.Set
+	retentionMsecs      int64
+
+	// isReadOnly is always set to 1, since cold partitions mustn't be modified.
+	isReadOnly uint32
+
+	// mu protects cps state. Cold partitions are downloaded without holding mu.
+	mu sync.Mutex
+
+	// downloadsWG waits for in-flight downloads on MustClose.
+	downloadsWG sync.WaitGroup
+
+	// cps contains cold partitions sorted by name. The list itself is immutable.
+	cps []*coldPartition
+
+	// accessIdx is incremented on every access to cold partitions. It is used for determining the least recently accessed partitions.
+	accessIdx uint64
+}
+
+// coldPartition is a partition stored in object storage.
+type coldPartition struct {
+	name string
+	tr   TimeRange
+
+	// The following fields are protected by tieredStorage.mu.
+
+	// ptw is non-nil if the partition is cached locally.
+	ptw *partitionWrapper
+
+	// download is non-nil while the partition is being downloaded.
+	download *coldPartitionDownload
+
+	lastAccessIdx uint64
+}
+
+// coldPartitionDownload is an in-flight download for cold partition.
+//
+// It is shared among concurrent searches, which need the same cold partition.
+type coldPartitionDownload struct {
+	// doneCh is closed when the download is finished.
+	doneCh chan struct{}
+
+	// err is the download error. It may be read only after doneCh is closed.
+	err error
+}
+
+// EnableTieredStorage enables querying cold partitions from ots.
+//
+// Partitions from ots, which are missing in the local storage, are downloaded to cachePath on the first access
+// and are queried transparently together with local partitions.
+// Up to maxCachedPartitions downloaded partitions are kept at cachePath.
+// Least recently accessed partitions are removed from cachePath when the limit is exceeded.
+//
+// The index for cold partitions must be available in the local storage, e.g. the storage must be restored
+// from the backup containing cold partitions and then the cold partitions must be removed from the local storage.
+//
+// EnableTieredStorage must be called before querying s.
+func (s *Storage) EnableTieredStorage(ots ObjectStorage, cachePath string, maxCachedPartitions int) error {
+	return s.tb.enableTieredStorage(ots, cachePath, maxCachedPartitions)
+}
+
+func (tb *table) enableTieredStorage(ots ObjectStorage, cachePath string, maxCachedPartitions int) error {
+	if tb.tiered != nil {
+		return fmt.Errorf("tiered storage is already enabled for %q", tb.path)
+	}
+	if maxCachedPartitions <= 0 {
+		return fmt.Errorf("maxCachedPartitions must be positive; got %d", maxCachedPartitions)
+	}
+	names, err := ots.ListPartitions()
+	if err != nil {
+		return fmt.Errorf("cannot list partitions at %s: %w", ots, err)
+	}
+	sort.Strings(names)
+
+	localNames := make(map[string]bool)
+	ptws := tb.GetPartitions(nil)
+	for _, ptw := range ptws {
+		localNames[ptw.pt.name] = true
+	}
+	tb.PutPartitions(ptws)
+
+	var cps []*coldPartition
+	for i, name := range names {
+		if i > 0 && names[i-1] == name {
+			continue
+		}
+		if localNames[name] {
+			// Local partitions have priority over cold partitions.
+			continue
+		}
+		cp := &coldPartition{
+			name: name,
+		}
+		if err := cp.tr.fromPartitionName(name); err != nil {
+			return fmt.Errorf("unexpected partition name at %s: %w", ots, err)
+		}
+		cps = append(cps, cp)
+	}
+
+	// Remove partitions left in the cache from the previous run, since they may be incomplete.
+	cachePath = filepath.Clean(cachePath)
+	fs.MustRemoveAll(cachePath)
+	if err := fs.MkdirAllIfNotExist(cachePath); err != nil {
+		return fmt.Errorf("cannot create directory for tiered storage cache: %w", err)
+	}
+
+	tb.tiered = &tieredStorage{
+		ots:                 ots,
+		cachePath:           cachePath,
+		maxCachedPartitions: maxCachedPartitions,
+
+		getDeletedMetricIDs: tb.getDeletedMetricIDs,
+		retentionMsecs:      tb.retentionMsecs,
+		isReadOnly:          1,
+
+		cps: cps,
+	}
+	logger.Infof("enabled tiered storage with %d cold partitions at %s; cachePath=%q, maxCachedPartitions=%d", len(cps), ots, cachePath, maxCachedPartitions)
+	return nil
+}
+
+// appendPartitions appends cold partitions overlapping tr to dst and returns the result.
+//
+// Cold partitions are downloaded to local cache if needed. Concurrent calls share downloads for the same partitions.
+// ErrDeadlineExceeded is returned if the needed partitions cannot be downloaded until the given deadline in unix seconds.
+// The download continues in background in this case, so subsequent calls may use the downloaded partition.
+//
+// The returned partitions must be released with decRef call when no longer needed.
+func (ts *tieredStorage) appendPartitions(dst []*partitionWrapper, tr TimeRange, deadline uint64) ([]*partitionWrapper, error) {
+	if !ts.hasPartitionsOnTimeRange(tr) {
+		// Fast path - there are no cold partitions on the given time range.
+		return dst, nil
+	}
+
+	for {
+		ts.mu.Lock()
+		downloads := ts.startDownloadsLocked(tr)
+		if len(downloads) == 0 {
+			dst = ts.appendCachedPartitionsLocked(dst, tr)
+			ts.mu.Unlock()
+			return dst, nil
+		}
+		ts.mu.Unlock()
+
+		for _, d := range downloads {
+			if err := waitForDownload(d, deadline); err != nil {
+				return dst, err
+			}
+		}
+		// Re-check the partitions, since they could be evicted by concurrent searches after the download.
+	}
+}
+
+// startDownloadsLocked starts downloads for cold partitions overlapping tr, which are missing in local cache.
+//
+// It returns in-flight downloads for such partitions.
+func (ts *tieredStorage) startDownloadsLocked(tr TimeRange) []*coldPartitionDownload {
+	var downloads []*coldPartitionDownload
+	for _, cp := range ts.cps {
+		if !cp.tr.overlapsWith(tr) || cp.ptw != nil {
+			continue
+		}
+		if cp.download == nil {
+			d := &coldPartitionDownload{
+				doneCh: make(chan struct{}),
+			}
+			cp.download = d
+			ts.downloadsWG.Add(1)
+			go func(cp *coldPartition) {
+				defer ts.downloadsWG.Done()
+				ts.downloadPartition(cp, d)
+			}(cp)
+		}
+		downloads = append(downloads, cp.download)
+	}
+	return downloads
+}
+
+func (ts *tieredStorage) appendCachedPartitionsLocked(dst []*partitionWrapper, tr TimeRange) []*partitionWrapper {
+	ts.accessIdx++
+	for _, cp := range ts.cps {
+		if !cp.tr.overlapsWith(tr) {
+			continue
+		}
+		cp.lastAccessIdx = ts.accessIdx
+		cp.ptw.incRef()
+		dst = append(dst, cp.ptw)
+	}
+	ts.evictPartitionsLocked()
+	return dst
+}
+
+func waitForDownload(d *coldPartitionDownload, deadline uint64) error {
+	select {
+	case <-d.doneCh:
+		return d.err
+	default:
+	}
+	currentTime := fasttime.UnixTimestamp()
+	if currentTime >= deadline {
+		return ErrDeadlineExceeded
+	}
+	timeout := deadline - currentTime
+	if timeout > maxDownloadWaitSeconds {
+		timeout = maxDownloadWaitSeconds
+	}
+	t := timerpool.Get(time.Duration(timeout) * time.Second)
+	defer timerpool.Put(t)
+	select {
+	case <-d.doneCh:
+		return d.err
+	case <-t.C:
+		return ErrDeadlineExceeded
+	}
+}
+
+// maxDownloadWaitSeconds limits the wait time for searches without deadline.
+const maxDownloadWaitSeconds = 365 * 24 * 3600
+
+func (ts *tieredStorage) hasPartitionsOnTimeRange(tr TimeRange) bool {
+	for _, cp := range ts.cps {
+		if cp.tr.overlapsWith(tr) {
+			return true
+		}
+	}
+	return false
+}
+
+// downloadPartition downloads cp to local cache and notifies waiters for d when the download is finished.
+func (ts *tieredStorage) downloadPartition(cp *coldPartition, d *coldPartitionDownload) {
+	pt, err := ts.downloadPartitionData(cp.name)
+
+	ts.mu.Lock()
+	if err == nil {
+		cp.ptw = &partitionWrapper{
+			pt:       pt,
+			refCount: 1,
+		}
+		ts.accessIdx++
+		cp.lastAccessIdx = ts.accessIdx
+	}
+	cp.download = nil
+	ts.mu.Unlock()
+
+	d.err = err
+	close(d.doneCh)
+}
+
+func (ts *tieredStorage) downloadPartitionData(name string) (*partition, error) {
+	smallPartsPath := ts.cachePath + "/small/" + name
+	bigPartsPath := ts.cachePath + "/big/" + name
+	// Remove partially downloaded data from the previous failed attempt.
+	fs.MustRemoveAll(smallPartsPath)
+	fs.MustRemoveAll(bigPartsPath)
+
+	logger.Infof("downloading cold partition %q from %s to %q", name, ts.ots, ts.cachePath)
+	startTime := time.Now()
+	atomic.AddUint64(&ts.downloads, 1)
+	if err := ts.ots.DownloadPartition(name, smallPartsPath, bigPartsPath); err != nil {
+		atomic.AddUint64(&ts.downloadErrors, 1)
+		return nil, fmt.Errorf("cannot download cold partition %q from %s: %w", name, ts.ots, err)
+	}
+	pt, err := openPartitionParts(smallPartsPath, bigPartsPath, ts.getDeletedMetricIDs, ts.retentionMsecs, &ts.isReadOnly)
+	if err != nil {
+		atomic.AddUint64(&ts.downloadErrors, 1)
+		return nil, fmt.Errorf("cannot open cold partition %q downloaded from %s: %w", name, ts.ots, err)
+	}
+	logger.Infof("downloaded cold partition %q from %s in %.3f seconds", name, ts.ots, time.Since(startTime).Seconds())
+	return pt, nil
+}
+
+// evictPartitionsLocked removes the least recently accessed partitions from local cache
+// if the number of cached partitions exceeds ts.maxCachedPartitions.
+//
+// Partitions, which are in use by searches, aren't evicted. They are evicted on subsequent calls.
+func (ts *tieredStorage) evictPartitionsLocked() {
+	var cached []*coldPartition
+	for _, cp := range ts.cps {
+		if cp.ptw != nil {
+			cached = append(cached, cp)
+		}
+	}
+	if len(cached) <= ts.maxCachedPartitions {
+		return
+	}
+	sort.Slice(cached, func(i, j int) bool {
+		return cached[i].lastAccessIdx < cached[j].lastAccessIdx
+	})
+	n := len(cached) - ts.maxCachedPartitions
+	for _, cp := range cached {
+		if n <= 0 {
+			return
+		}
+		// New references to cp.ptw are obtained only under ts.mu, so refCount=1 means that the partition isn't in use.
+		if atomic.LoadUint64(&cp.ptw.refCount) != 1 {
+			continue
+		}
+		logger.Infof("evicting cold partition %q from tiered storage cache at %q", cp.name, ts.cachePath)
+		cp.ptw.scheduleToDrop()
+		cp.ptw.decRef()
+		cp.ptw = nil
+		n--
+	}
+}
+
+// MustClose closes all the cached partitions and removes them from local cache.
+//
+// It is expected that all the pending searches are finished before calling MustClose.
+// MustClose waits until in-flight downloads are finished.
+func (ts *tieredStorage) MustClose() {
+	ts.downloadsWG.Wait()
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	for _, cp := range ts.cps {
+		if cp.ptw == nil {
+			continue
+		}
+		if n := atomic.LoadUint64(&cp.ptw.refCount); n != 1 {
+			logger.Panicf("BUG: unexpected refCount=%d when closing the cold partition %q; probably there are pending searches", n, cp.name)
+		}
+		cp.ptw.scheduleToDrop()
+		cp.ptw.decRef()
+		cp.ptw = nil
+	}
+}
+
+// UpdateMetrics updates m with metrics from ts.
+func (ts *tieredStorage) UpdateMetrics(m *TableMetrics) {
+	m.ColdPartitions += uint64(len(ts.cps))
+	m.ColdPartitionDownloads += atomic.LoadUint64(&ts.downloads)
+	m.ColdPartitionDownloadErrors += atomic.LoadUint64(&ts.downloadErrors)
+
+	ts.mu.Lock()
+	for _, cp := range ts.cps {
+		if cp.ptw == nil {
+			continue
+		}
+		m.CachedColdPartitions++
+		cp.ptw.pt.UpdateMetrics(&m.partitionMetrics)
+		m.PartitionsRefCount += atomic.LoadUint64(&cp.ptw.refCount)
+	}
+	ts.mu.Unlock()
+}
@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+// testObjectStorage is a mock object storage, which holds partitions in the local directory.
+type testObjectStorage struct {
+	path string
+
+	// unblockCh blocks downloads until it is closed if it isn't nil.
+	unblockCh chan struct{}
+
+	downloads uint64
+}
+
+func (tos *testObjectStorage) ListPartitions() ([]string, error) {
+	var names []string
+	for _, dir := range []string{"small", "big"} {
+		fis, err := ioutil.ReadDir(tos.path + "/" + dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, fi := range fis {
+			names = append(names, fi.Name())
+		}
+	}
+	return names, nil
+}
+
+func (tos *testObjectStorage) DownloadPartition(name, smallPartsPath, bigPartsPath string) error {
+	atomic.AddUint64(&tos.downloads, 1)
+	if tos.unblockCh != nil {
+		<-tos.unblockCh
+	}
+	if err := testCopyDirRecursive(tos.path+"/small/"+name, smallPartsPath); err != nil {
+		return err
+	}
+	return testCopyDirRecursive(tos.path+"/big/"+name, bigPartsPath)
+}
+
+func (tos *testObjectStorage) String() string {
+	return "test:" + tos.path
+}
+
+func testCopyDirRecursive(srcPath, dstPath string) error {
+	if err := fs.CopyDirectory(srcPath, dstPath); err != nil {
+		return err
+	}
+	fis, err := ioutil.ReadDir(srcPath)
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+		if err := testCopyDirRecursive(srcPath+"/"+fi.Name(), dstPath+"/"+fi.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// testMustCreateTieredStorage creates the storage at path with January and February 2020 partitions moved to the object storage.
+//
+// It returns time ranges for the moved partitions.
+func testMustCreateTieredStorage(t *testing.T, path, objectStoragePath string, rowsPerPartition int) (TimeRange, TimeRange) {
+	t.Helper()
+	s, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	var trJan, trFeb TimeRange
+	trJan.fromPartitionTime(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	trFeb.fromPartitionTime(time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC))
+	for _, tr := range []TimeRange{trJan, trFeb} {
+		mrs := testGenerateMetricRows(uint64(rowsPerPartition), tr.MinTimestamp, tr.MaxTimestamp)
+		if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+			t.Fatalf("unexpected error when adding mrs: %s", err)
+		}
+	}
+	s.DebugFlush()
+	s.MustClose()
+
+	// Move partitions to the object storage. The index for these partitions remains in the local storage.
+	for _, dir := range []string{"small", "big"} {
+		dstDir := objectStoragePath + "/" + dir
+		if err := fs.MkdirAllIfNotExist(dstDir); err != nil {
+			t.Fatalf("cannot create %q: %s", dstDir, err)
+		}
+		for _, name := range []string{"2020_01", "2020_02"} {
+			srcPath := path + "/data/" + dir + "/" + name
+			if err := os.Rename(srcPath, dstDir+"/"+name); err != nil {
+				t.Fatalf("cannot move %q to the object storage: %s", srcPath, err)
+			}
+		}
+	}
+	return trJan, trFeb
+}
+
+func TestStorageTieredStorage(t *testing.T) {
+	path := "TestStorageTieredStorage"
+	objectStoragePath := path + "-object-storage"
+	defer fs.MustRemoveAll(objectStoragePath)
+
+	const rowsPerPartition = 1e3
+	trJan, trFeb := testMustCreateTieredStorage(t, path, objectStoragePath, rowsPerPartition)
+
+	s, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	tos := &testObjectStorage{
+		path: objectStoragePath,
+	}
+	cachePath := path + "/tiered-storage-cache"
+	if err := s.EnableTieredStorage(tos, cachePath, 1); err != nil {
+		t.Fatalf("cannot enable tiered storage: %s", err)
+	}
+
+	f := func(tr TimeRange, rowsExpected int, downloadsExpected, cachedPartitionsExpected uint64) {
+		t.Helper()
+		tfs := NewTagFilters()
+		if err := tfs.Add(nil, []byte("metric_.*"), false, true); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+		var search Search
+		search.Init(nil, s, []*TagFilters{tfs}, tr, 1e5, noDeadline)
+		rowsCount := 0
+		for search.NextMetricBlock() {
+			var b Block
+			search.MetricBlockRef.BlockRef.MustReadBlock(&b, true)
+			rowsCount += b.RowsCount()
+		}
+		if err := search.Error(); err != nil {
+			t.Fatalf("unexpected error in search: %s", err)
+		}
+		search.MustClose()
+		if rowsCount != rowsExpected {
+			t.Fatalf("unexpected number of rows found; got %d; want %d", rowsCount, rowsExpected)
+		}
+		if n := atomic.LoadUint64(&tos.downloads); n != downloadsExpected {
+			t.Fatalf("unexpected number of downloads; got %d; want %d", n, downloadsExpected)
+		}
+		var m Metrics
+		s.UpdateMetrics(&m)
+		if n := m.TableMetrics.ColdPartitions; n != 2 {
+			t.Fatalf("unexpected number of cold partitions; got %d; want 2", n)
+		}
+		if n := m.TableMetrics.CachedColdPartitions; n != cachedPartitionsExpected {
+			t.Fatalf("unexpected number of cached cold partitions; got %d; want %d", n, cachedPartitionsExpected)
+		}
+	}
+
+	// The partition must be downloaded on the first access.
+	f(trJan, rowsPerPartition, 1, 1)
+
+	// The partition must be served from the local cache on subsequent accesses.
+	f(trJan, rowsPerPartition, 1, 1)
+
+	// The least recently accessed partition must be evicted from the cache.
+	f(trFeb, rowsPerPartition, 2, 1)
+	if fs.IsPathExist(cachePath + "/small/2020_01") {
+		t.Fatalf("the evicted partition must be removed from the cache")
+	}
+
+	// Partitions in use by the search cannot be evicted, so both of them remain cached until the next search.
+	tr := TimeRange{
+		MinTimestamp: trJan.MinTimestamp,
+		MaxTimestamp: trFeb.MaxTimestamp,
+	}
+	f(tr, 2*rowsPerPartition, 3, 2)
+
+	// Time range without cold partitions mustn't trigger downloads.
+	var trMar TimeRange
+	trMar.fromPartitionTime(time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC))
+	f(trMar, 0, 3, 2)
+
+	s.MustClose()
+	if fs.IsPathExist(cachePath + "/small/2020_02") {
+		t.Fatalf("cached partitions must be removed on close")
+	}
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatalf("cannot remove %q: %s", path, err)
+	}
+}
+
+func TestStorageTieredStorageConcurrentDownloads(t *testing.T) {
+	path := "TestStorageTieredStorageConcurrentDownloads"
+	objectStoragePath := path + "-object-storage"
+	defer fs.MustRemoveAll(objectStoragePath)
+
+	trJan, _ := testMustCreateTieredStorage(t, path, objectStoragePath, 100)
+
+	s, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	tos := &testObjectStorage{
+		path:      objectStoragePath,
+		unblockCh: make(chan struct{}),
+	}
+	if err := s.EnableTieredStorage(tos, path+"/tiered-storage-cache", 2); err != nil {
+		t.Fatalf("cannot enable tiered storage: %s", err)
+	}
+	tiered := s.tb.tiered
+
+	// The search must fail with ErrDeadlineExceeded while the download is in progress.
+	deadline := fasttime.UnixTimestamp() + 1
+	ptws, err := tiered.appendPartitions(nil, trJan, deadline)
+	if !errors.Is(err, ErrDeadlineExceeded) {
+		t.Fatalf("unexpected error; got %v; want %v", err, ErrDeadlineExceeded)
+	}
+	if len(ptws) != 0 {
+		t.Fatalf("unexpected partitions returned on error: %d", len(ptws))
+	}
+
+	// Concurrent searches must share the in-flight download.
+	const concurrency = 5
+	resultCh := make(chan error, concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			ptws, err := tiered.appendPartitions(nil, trJan, noDeadline)
+			if err == nil && len(ptws) != 1 {
+				err = fmt.Errorf("unexpected number of partitions; got %d; want 1", len(ptws))
+			}
+			for _, ptw := range ptws {
+				ptw.decRef()
+			}
+			resultCh <- err
+		}()
+	}
+	close(tos.unblockCh)
+	for i := 0; i < concurrency; i++ {
+		if err := <-resultCh; err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if n := atomic.LoadUint64(&tos.downloads); n != 1 {
+		t.Fatalf("unexpected number of downloads; got %d; want 1", n)
+	}
+
+	s.MustClose()
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatalf("cannot remove %q: %s", path, err)
+	}
+}
@@ -29,6 +29,11 @@ func (tr *TimeRange) String() string {
 	return fmt.Sprintf("[%d..%d]", tr.MinTimestamp, tr.MaxTimestamp)
 }
 
+// overlapsWith returns true if tr overlaps with other.
+func (tr *TimeRange) overlapsWith(other TimeRange) bool {
+	return tr.MinTimestamp <= other.MaxTimestamp && other.MinTimestamp <= tr.MaxTimestamp
+}
+
 // timestampToPartitionName returns partition name for the given timestamp.
 func timestampToPartitionName(timestamp int64) string {
 	t := timestampToTime(timestamp)
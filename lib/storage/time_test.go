@@ -52,3 +52,23 @@ func testTimeRangeFromPartition(t *testing.T, initialTime time.Time) {
 		t.Fatalf("unexpected nextY, nextM; got %d, %d; want %d, %d+1;\nnextTime=%s\nmaxTime=%s", nextY, nextM, maxY, maxM, nextTime, maxTime)
 	}
 }
+
+func TestTimeRangeOverlapsWith(t *testing.T) {
+	f := func(tr1, tr2 TimeRange, resultExpected bool) {
+		t.Helper()
+		result := tr1.overlapsWith(tr2)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for %s overlapsWith %s; got %v; want %v", &tr1, &tr2, result, resultExpected)
+		}
+		result = tr2.overlapsWith(tr1)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for %s overlapsWith %s; got %v; want %v", &tr2, &tr1, result, resultExpected)
+		}
+	}
+	f(TimeRange{MinTimestamp: 10, MaxTimestamp: 20}, TimeRange{MinTimestamp: 10, MaxTimestamp: 20}, true)
+	f(TimeRange{MinTimestamp: 10, MaxTimestamp: 20}, TimeRange{MinTimestamp: 15, MaxTimestamp: 30}, true)
+	f(TimeRange{MinTimestamp: 10, MaxTimestamp: 20}, TimeRange{MinTimestamp: 12, MaxTimestamp: 18}, true)
+	f(TimeRange{MinTimestamp: 10, MaxTimestamp: 20}, TimeRange{MinTimestamp: 20, MaxTimestamp: 30}, true)
+	f(TimeRange{MinTimestamp: 10, MaxTimestamp: 20}, TimeRange{MinTimestamp: 21, MaxTimestamp: 30}, false)
+	f(TimeRange{MinTimestamp: 10, MaxTimestamp: 20}, TimeRange{MinTimestamp: 0, MaxTimestamp: 9}, false)
+}